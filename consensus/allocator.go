@@ -80,6 +80,34 @@ type Inspector interface {
 	InspectChan() chan func(tree *etcd.Node)
 }
 
+// TreeObserver is an optional interface of an Allocator which is notified of
+// the Allocator state tree prior to each allocation pass, and before its
+// FixedItems are enumerated. This allows an Allocator to derive its
+// FixedItems from state within the tree.
+type TreeObserver interface {
+	// ObserveTree is invoked from the Allocator's goroutine, and must not
+	// block, modify |tree|, or retain it beyond the call.
+	ObserveTree(tree *etcd.Node)
+}
+
+// ItemReplicator is an optional interface of an Allocator which requires
+// numbers of replicas of individual items, in place of Replicas(). An
+// ItemReplicator which is also a TreeObserver may derive item replica counts
+// from state within the tree.
+type ItemReplicator interface {
+	// ItemReplicas returns the required number of replicas of |item|. It's
+	// invoked from the Allocator's goroutine, and must not block.
+	ItemReplicas(item string) int
+}
+
+// itemReplicas returns the required number of replicas of |item|.
+func itemReplicas(alloc Allocator, item string) int {
+	if r, ok := alloc.(ItemReplicator); ok {
+		return r.ItemReplicas(item)
+	}
+	return alloc.Replicas()
+}
+
 // Create attempts to create an Allocator member lock reflecting instance
 // |alloc|. If the member lock already exists, returns
 // ErrAllocatorInstanceExists. An Allocator member lock should be obtained
@@ -355,6 +383,9 @@ type allocParams struct {
 		OpenMasters  []string     // Names of items in need of a master.
 		OpenReplicas []string     // Names of items in need of a replica.
 		Count        int          // Total number of items.
+		// Sum of item replicas in excess of Replicas(), which is non-zero only if
+		// the Allocator is an ItemReplicator (and may be negative).
+		ExtraReplicas int
 	}
 	Member struct {
 		Entry *etcd.Node // Our member entry.
@@ -392,10 +423,16 @@ func WalkItems(tree *etcd.Node, fixedItems []string, now time.Time, cb func(name
 // allocExtract builds |p.Item| and |p.Member| descriptions of allocParams from
 // |p.Input|.
 func allocExtract(p *allocParams) {
+	if observer, ok := p.Allocator.(TreeObserver); ok {
+		observer.ObserveTree(p.Input.Tree)
+	}
 
 	WalkItems(p.Input.Tree, p.FixedItems(), p.Input.Time, func(name string, route Route) {
 		p.Item.Count += 1
 
+		var replicas = itemReplicas(p, name)
+		p.Item.ExtraReplicas += replicas - p.Replicas()
+
 		var index = route.Index(p.InstanceKey())
 		p.ItemRoute(name, route, index, p.Input.Tree)
 
@@ -403,7 +440,7 @@ func allocExtract(p *allocParams) {
 			// We do not hold a lock on this item.
 			if len(route.Entries) == 0 {
 				p.Item.OpenMasters = append(p.Item.OpenMasters, name)
-			} else if len(route.Entries) < p.Replicas()+1 {
+			} else if len(route.Entries) < replicas+1 {
 				p.Item.OpenReplicas = append(p.Item.OpenReplicas, name)
 			}
 		} else if index == 0 {
@@ -415,7 +452,7 @@ func allocExtract(p *allocParams) {
 			if route.IsReadyForHandoff(p) {
 				p.Item.Releaseable = append(p.Item.Releaseable, route.Entries[0])
 			}
-		} else if index < p.Replicas()+1 {
+		} else if index < replicas+1 {
 			// We act as an item replica.
 			p.Item.Replica = append(p.Item.Replica, route.Entries[index])
 		} else {
@@ -585,6 +622,13 @@ func targetCounts(p *allocParams) (desiredMaster, desiredTotal int) {
 			desiredMaster += 1
 		}
 		desiredTotal = desiredMaster * (p.Replicas() + 1)
+
+		// Scale |desiredTotal| by the total number of item slots, relative to
+		// that of items having uniform Replicas(). Round up.
+		if p.Item.ExtraReplicas != 0 {
+			var slots = p.Item.Count*(p.Replicas()+1) + p.Item.ExtraReplicas
+			desiredTotal = (desiredMaster*slots + p.Item.Count - 1) / p.Item.Count
+		}
 	}
 	return
 }
@@ -156,6 +156,66 @@ func (s *AllocSuite) TestDesiredCounts(c *gc.C) {
 	dm, dt = targetCounts(&p)
 	c.Check(dm, gc.Equals, 3)
 	c.Check(dt, gc.Equals, 9)
+
+	// Items requiring fewer or more replicas scale the desired total by the
+	// total number of item slots (here, 5 * 3 - 4 = 11 slots).
+	p.Item.ExtraReplicas = -4
+	dm, dt = targetCounts(&p)
+	c.Check(dm, gc.Equals, 3)
+	c.Check(dt, gc.Equals, 7) // 3 * 11 / 5, rounded up.
+
+	p.Item.ExtraReplicas = 5 // 20 slots.
+	dm, dt = targetCounts(&p)
+	c.Check(dm, gc.Equals, 3)
+	c.Check(dt, gc.Equals, 12)
+}
+
+func (s *AllocSuite) TestItemReplicatorExtraction(c *gc.C) {
+	var mockAlloc = &MockAllocator{}
+	mockAlloc.On("InstanceKey").Return("my-key")
+	mockAlloc.On("Replicas").Return(1)
+	mockAlloc.On("FixedItems").Return([]string{})
+	mockAlloc.On("ItemRoute", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	var alloc = itemReplicatorAllocator{
+		MockAllocator: mockAlloc,
+		replicas:      map[string]int{"scratch": 0, "important": 2},
+	}
+	var params = allocParams{Allocator: alloc}
+	params.Input.Tree = buildTree(c, []etcd.Node{
+		// Scratch requires no replicas: an extra lock is held.
+		{Key: "/foo/items/scratch/other-key", CreatedIndex: 1},
+		{Key: "/foo/items/scratch/my-key", CreatedIndex: 2},
+		// Important requires two replicas: a replica lock is held.
+		{Key: "/foo/items/important/other-key", CreatedIndex: 3},
+		{Key: "/foo/items/important/another-key", CreatedIndex: 4},
+		{Key: "/foo/items/important/my-key", CreatedIndex: 5},
+		// Default requires Replicas(), and has an open replica slot.
+		{Key: "/foo/items/default/other-key", CreatedIndex: 6},
+	}).Nodes[0]
+
+	allocExtract(&params)
+
+	c.Check(params.Item.Count, gc.Equals, 3)
+	c.Check(params.Item.ExtraReplicas, gc.Equals, 0) // -1 + 1 + 0.
+	c.Check(params.Item.Extra, gc.HasLen, 1)
+	c.Check(params.Item.Extra[0].Key, gc.Equals, "/foo/items/scratch/my-key")
+	c.Check(params.Item.Replica, gc.HasLen, 1)
+	c.Check(params.Item.Replica[0].Key, gc.Equals, "/foo/items/important/my-key")
+	c.Check(params.Item.OpenReplicas, gc.DeepEquals, []string{"default"})
+}
+
+// itemReplicatorAllocator is a MockAllocator which is also an ItemReplicator.
+type itemReplicatorAllocator struct {
+	*MockAllocator
+	replicas map[string]int
+}
+
+func (a itemReplicatorAllocator) ItemReplicas(item string) int {
+	if r, ok := a.replicas[item]; ok {
+		return r
+	}
+	return a.Replicas()
 }
 
 func (s *AllocSuite) TestAllocationActions(c *gc.C) {
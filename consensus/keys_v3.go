@@ -0,0 +1,648 @@
+package consensus
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/coreos/etcd/store"
+	"golang.org/x/net/context"
+)
+
+// NewV3KeysAPI returns an etcd.KeysAPI which stores the v2 keyspace of
+// allocators, routes, and other users of the v2 API in the keyspace of an
+// etcd v3 cluster. It allows Gazette brokers and consumers to run against
+// clusters which don't serve the v2 API, or which serve it only through the
+// (deprecated) v2 emulation.
+//
+// The v2 hierarchy is mapped onto flat v3 keys:
+//   - A v2 key is stored as the v3 key of the same name, and v2 modified and
+//     created indices are v3 mod and create revisions.
+//   - An explicit directory (a Set with Dir: true) is stored as a marker key of
+//     the directory name with a trailing slash. Directories are otherwise
+//     implied by the keys they contain.
+//   - A TTL is applied by granting a lease of the TTL, and attaching it to the
+//     key. Expirations of keys are reported from their leases.
+//   - Watches are v3 watches of the key (or its prefix, if recursive), and a
+//     compaction of the watched revision is surfaced as the v2
+//     ErrorCodeEventIndexCleared, which prompts consumers such as RetryWatcher
+//     to refresh.
+//
+// CreateInOrder is not supported. The v2 and v3 keyspaces are distinct: see
+// CopyTree for migration of a v2 keyspace into a v3 one.
+func NewV3KeysAPI(client *clientv3.Client) etcd.KeysAPI {
+	return newV3KeysAPI(client.KV, client.Lease, client.Watcher)
+}
+
+func newV3KeysAPI(kv clientv3.KV, lease clientv3.Lease, watcher clientv3.Watcher) *v3KeysAPI {
+	return &v3KeysAPI{
+		kv:          kv,
+		lease:       lease,
+		watcher:     watcher,
+		expirations: make(map[clientv3.LeaseID]time.Time),
+		now:         time.Now,
+	}
+}
+
+// ErrCreateInOrderUnsupported is returned by CreateInOrder of a KeysAPI
+// returned by NewV3KeysAPI.
+var ErrCreateInOrderUnsupported = errors.New("CreateInOrder is not supported by the etcd v3 KeysAPI")
+
+type v3KeysAPI struct {
+	kv      clientv3.KV
+	lease   clientv3.Lease
+	watcher clientv3.Watcher
+
+	// Expirations of observed leases. Leases are never kept alive (a refresh
+	// of a key attaches a new lease), so the expiration of a lease is fixed
+	// once known. Guarded by |mu|.
+	expirations map[clientv3.LeaseID]time.Time
+	mu          sync.Mutex
+
+	now func() time.Time
+}
+
+func (k *v3KeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	if opts == nil {
+		opts = new(etcd.GetOptions)
+	}
+	key = normalizeV3Key(key)
+
+	// Fetch the key and its descendants at a single revision.
+	resp, err := k.kv.Txn(ctx).Then(
+		clientv3.OpGet(key),
+		clientv3.OpGet(childPrefix(key), clientv3.WithPrefix()),
+	).Commit()
+	if err != nil {
+		return nil, err
+	}
+	var rev = uint64(resp.Header.Revision)
+	var leaf = resp.Responses[0].GetResponseRange().Kvs
+	var children = resp.Responses[1].GetResponseRange().Kvs
+
+	var node *etcd.Node
+	if len(leaf) != 0 {
+		node = nodeFromKV(leaf[0])
+	} else if len(children) != 0 {
+		node = treeFromKVs(key, children, opts.Recursive)
+	} else {
+		return nil, v3KeysError(etcd.ErrorCodeKeyNotFound, key, rev)
+	}
+	if err = k.setExpirations(ctx, node, append(leaf, children...)); err != nil {
+		return nil, err
+	}
+	return &etcd.Response{Action: store.Get, Node: node, Index: rev}, nil
+}
+
+func (k *v3KeysAPI) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	if opts == nil {
+		opts = new(etcd.SetOptions)
+	}
+	key = normalizeV3Key(key)
+
+	var target = key
+	if opts.Dir {
+		target, value = childPrefix(key), ""
+	}
+
+	var cmps []clientv3.Cmp
+	var action = store.Set
+
+	switch opts.PrevExist {
+	case etcd.PrevNoExist:
+		cmps = append(cmps, clientv3.Compare(clientv3.CreateRevision(target), "=", 0))
+		action = store.Create
+	case etcd.PrevExist:
+		cmps = append(cmps, clientv3.Compare(clientv3.CreateRevision(target), ">", 0))
+		action = store.Update
+	}
+	if opts.PrevIndex != 0 {
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(target), "=", int64(opts.PrevIndex)))
+		action = store.CompareAndSwap
+	}
+	if opts.PrevValue != "" {
+		cmps = append(cmps, clientv3.Compare(clientv3.Value(target), "=", opts.PrevValue))
+		action = store.CompareAndSwap
+	}
+
+	var putOpts = []clientv3.OpOption{clientv3.WithPrevKV()}
+	var expiration time.Time
+
+	if opts.TTL > 0 {
+		var ttl = int64((opts.TTL + time.Second - 1) / time.Second) // Round up.
+
+		var grant, err = k.lease.Grant(ctx, ttl)
+		if err != nil {
+			return nil, err
+		}
+		expiration = k.now().Add(time.Duration(grant.TTL) * time.Second)
+		k.observeLease(grant.ID, expiration)
+
+		putOpts = append(putOpts, clientv3.WithLease(grant.ID))
+	}
+	if opts.Refresh {
+		putOpts = append(putOpts, clientv3.WithIgnoreValue())
+		action = store.Update
+	}
+
+	resp, err := k.kv.Txn(ctx).If(cmps...).
+		Then(clientv3.OpPut(target, value, putOpts...)).
+		Else(clientv3.OpGet(target)).
+		Commit()
+	if err != nil {
+		return nil, err
+	}
+	var rev = uint64(resp.Header.Revision)
+
+	if !resp.Succeeded {
+		var exists = len(resp.Responses[0].GetResponseRange().Kvs) != 0
+
+		if !exists && opts.PrevExist != etcd.PrevNoExist {
+			return nil, v3KeysError(etcd.ErrorCodeKeyNotFound, key, rev)
+		} else if exists && opts.PrevExist == etcd.PrevNoExist {
+			return nil, v3KeysError(etcd.ErrorCodeNodeExist, key, rev)
+		}
+		return nil, v3KeysError(etcd.ErrorCodeTestFailed, key, rev)
+	}
+
+	var out = &etcd.Response{
+		Action: action,
+		Node: &etcd.Node{
+			Key:           key,
+			Dir:           opts.Dir,
+			Value:         value,
+			CreatedIndex:  rev,
+			ModifiedIndex: rev,
+		},
+		Index: rev,
+	}
+	if prev := resp.Responses[0].GetResponsePut().PrevKv; prev != nil {
+		out.PrevNode = nodeFromKV(prev)
+		out.Node.CreatedIndex = uint64(prev.CreateRevision)
+
+		if opts.Refresh {
+			out.Node.Value = string(prev.Value)
+		}
+	}
+	if !expiration.IsZero() {
+		out.Node.Expiration = &expiration
+		out.Node.TTL = int64(opts.TTL / time.Second)
+	}
+	return out, nil
+}
+
+func (k *v3KeysAPI) Delete(ctx context.Context, key string, opts *etcd.DeleteOptions) (*etcd.Response, error) {
+	if opts == nil {
+		opts = new(etcd.DeleteOptions)
+	}
+	key = normalizeV3Key(key)
+
+	var cmps []clientv3.Cmp
+	var action = store.Delete
+
+	if opts.PrevIndex != 0 {
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(key), "=", int64(opts.PrevIndex)))
+		action = store.CompareAndDelete
+	}
+	if opts.PrevValue != "" {
+		cmps = append(cmps, clientv3.Compare(clientv3.Value(key), "=", opts.PrevValue))
+		action = store.CompareAndDelete
+	}
+
+	var ops = []clientv3.Op{clientv3.OpDelete(key, clientv3.WithPrevKV())}
+
+	if opts.Recursive {
+		ops = append(ops, clientv3.OpDelete(childPrefix(key), clientv3.WithPrefix()))
+	} else if opts.Dir {
+		// Only an empty directory may be deleted. Note this check isn't atomic
+		// with the deletion itself.
+		var resp, err = k.kv.Get(ctx, childPrefix(key), clientv3.WithPrefix(),
+			clientv3.WithKeysOnly(), clientv3.WithLimit(2))
+		if err != nil {
+			return nil, err
+		} else if len(resp.Kvs) > 1 || (len(resp.Kvs) == 1 && string(resp.Kvs[0].Key) != childPrefix(key)) {
+			return nil, v3KeysError(etcd.ErrorCodeDirNotEmpty, key, uint64(resp.Header.Revision))
+		}
+		ops = append(ops, clientv3.OpDelete(childPrefix(key)))
+	}
+
+	resp, err := k.kv.Txn(ctx).If(cmps...).Then(ops...).Else(clientv3.OpGet(key)).Commit()
+	if err != nil {
+		return nil, err
+	}
+	var rev = uint64(resp.Header.Revision)
+
+	if !resp.Succeeded {
+		if len(resp.Responses[0].GetResponseRange().Kvs) == 0 {
+			return nil, v3KeysError(etcd.ErrorCodeKeyNotFound, key, rev)
+		}
+		return nil, v3KeysError(etcd.ErrorCodeTestFailed, key, rev)
+	}
+
+	var deleted int64
+	for _, r := range resp.Responses {
+		deleted += r.GetResponseDeleteRange().Deleted
+	}
+	if deleted == 0 {
+		return nil, v3KeysError(etcd.ErrorCodeKeyNotFound, key, rev)
+	}
+
+	var out = &etcd.Response{
+		Action: action,
+		Node:   &etcd.Node{Key: key, Dir: opts.Dir || opts.Recursive, ModifiedIndex: rev},
+		Index:  rev,
+	}
+	if prev := resp.Responses[0].GetResponseDeleteRange().PrevKvs; len(prev) != 0 {
+		out.PrevNode = nodeFromKV(prev[0])
+		out.Node.Dir = false
+		out.Node.CreatedIndex = uint64(prev[0].CreateRevision)
+	}
+	return out, nil
+}
+
+func (k *v3KeysAPI) Create(ctx context.Context, key, value string) (*etcd.Response, error) {
+	return k.Set(ctx, key, value, &etcd.SetOptions{PrevExist: etcd.PrevNoExist})
+}
+
+func (k *v3KeysAPI) CreateInOrder(ctx context.Context, dir, value string, opts *etcd.CreateInOrderOptions) (*etcd.Response, error) {
+	return nil, ErrCreateInOrderUnsupported
+}
+
+func (k *v3KeysAPI) Update(ctx context.Context, key, value string) (*etcd.Response, error) {
+	return k.Set(ctx, key, value, &etcd.SetOptions{PrevExist: etcd.PrevExist})
+}
+
+func (k *v3KeysAPI) Watcher(key string, opts *etcd.WatcherOptions) etcd.Watcher {
+	if opts == nil {
+		opts = new(etcd.WatcherOptions)
+	}
+	var w = &v3Watcher{
+		keys:      k,
+		key:       normalizeV3Key(key),
+		recursive: opts.Recursive,
+	}
+	if opts.AfterIndex != 0 {
+		w.nextRev = int64(opts.AfterIndex) + 1
+	}
+	return w
+}
+
+// observeLease records the |expiration| of lease |id|, and prunes
+// expirations of leases which have since expired.
+func (k *v3KeysAPI) observeLease(id clientv3.LeaseID, expiration time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var now = k.now()
+	for id, exp := range k.expirations {
+		if exp.Before(now) {
+			delete(k.expirations, id)
+		}
+	}
+	k.expirations[id] = expiration
+}
+
+// leaseExpiration returns the expiration of lease |id|, querying the cluster
+// for its time-to-live if it's not already known.
+func (k *v3KeysAPI) leaseExpiration(ctx context.Context, id clientv3.LeaseID) (time.Time, error) {
+	k.mu.Lock()
+	var exp, ok = k.expirations[id]
+	k.mu.Unlock()
+
+	if ok {
+		return exp, nil
+	}
+	resp, err := k.lease.TimeToLive(ctx, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	exp = k.now().Add(time.Duration(resp.TTL) * time.Second)
+	k.observeLease(id, exp)
+
+	return exp, nil
+}
+
+// setExpirations sets the Expiration and TTL of each Node under |root| which
+// is attached to a lease.
+func (k *v3KeysAPI) setExpirations(ctx context.Context, root *etcd.Node, kvs []*mvccpb.KeyValue) error {
+	var leases = make(map[string]clientv3.LeaseID)
+	for _, kv := range kvs {
+		if kv.Lease != 0 {
+			leases[string(kv.Key)] = clientv3.LeaseID(kv.Lease)
+		}
+	}
+	if len(leases) == 0 {
+		return nil
+	}
+	return walkNodes(root, func(node *etcd.Node) error {
+		var id, ok = leases[node.Key]
+		if !ok || node.Dir {
+			return nil
+		}
+		var exp, err = k.leaseExpiration(ctx, id)
+		if err != nil {
+			return err
+		}
+		node.Expiration = &exp
+		node.TTL = int64(exp.Sub(k.now()) / time.Second)
+		return nil
+	})
+}
+
+// v3Watcher is an etcd.Watcher of a v3KeysAPI.
+type v3Watcher struct {
+	keys      *v3KeysAPI
+	key       string
+	recursive bool
+
+	// Revision from which the watch resumes, or zero if from the current one.
+	nextRev int64
+	// Current v3 watch, and its cancellation. A watch is cancelled if the
+	// context of Next is, and is resumed from |nextRev| by a following Next.
+	ch     clientv3.WatchChan
+	cancel context.CancelFunc
+	// Converted events not yet returned by Next.
+	pending []*etcd.Response
+}
+
+func (w *v3Watcher) Next(ctx context.Context) (*etcd.Response, error) {
+	for len(w.pending) == 0 {
+		if w.ch == nil {
+			var wctx, cancel = context.WithCancel(context.Background())
+			var opts = []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithPrevKV()}
+
+			if w.nextRev != 0 {
+				opts = append(opts, clientv3.WithRev(w.nextRev))
+			}
+			w.ch, w.cancel = w.keys.watcher.Watch(wctx, w.key, opts...), cancel
+		}
+
+		var resp clientv3.WatchResponse
+		var ok bool
+
+		select {
+		case resp, ok = <-w.ch:
+		case <-ctx.Done():
+			w.close()
+			return nil, ctx.Err()
+		}
+
+		if !ok {
+			w.close() // Re-open from |nextRev|.
+			continue
+		} else if resp.CompactRevision != 0 {
+			w.close()
+			return nil, v3KeysError(etcd.ErrorCodeEventIndexCleared, w.key, uint64(resp.CompactRevision))
+		} else if err := resp.Err(); err != nil {
+			w.close()
+			return nil, err
+		}
+
+		for _, ev := range resp.Events {
+			if w.matches(string(ev.Kv.Key)) {
+				var out, err = w.keys.responseFromEvent(ctx, ev)
+				if err != nil {
+					w.close() // Resume from |ev| on the next call.
+					return nil, err
+				}
+				w.pending = append(w.pending, out)
+			}
+			w.nextRev = ev.Kv.ModRevision + 1
+		}
+	}
+
+	var out = w.pending[0]
+	w.pending = w.pending[1:]
+	return out, nil
+}
+
+// matches returns whether v3 |key| is watched by the v3Watcher. A v3 watch
+// of the prefix also matches keys of which |w.key| is only a string prefix.
+func (w *v3Watcher) matches(key string) bool {
+	var prefix = childPrefix(w.key)
+
+	if key == w.key || key == prefix {
+		return true
+	}
+	return w.recursive && strings.HasPrefix(key, prefix)
+}
+
+func (w *v3Watcher) close() {
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.ch, w.cancel = nil, nil
+}
+
+// responseFromEvent converts v3 Event |ev| into an equivalent etcd.Response.
+func (k *v3KeysAPI) responseFromEvent(ctx context.Context, ev *clientv3.Event) (*etcd.Response, error) {
+	var out = &etcd.Response{
+		Node:  nodeFromKV(ev.Kv),
+		Index: uint64(ev.Kv.ModRevision),
+	}
+	if ev.PrevKv != nil {
+		out.PrevNode = nodeFromKV(ev.PrevKv)
+	}
+
+	switch ev.Type {
+	case mvccpb.PUT:
+		if ev.IsCreate() {
+			out.Action = store.Create
+		} else {
+			out.Action = store.Set
+		}
+		if ev.Kv.Lease != 0 {
+			var exp, err = k.leaseExpiration(ctx, clientv3.LeaseID(ev.Kv.Lease))
+			if err != nil {
+				return nil, err
+			}
+			out.Node.Expiration = &exp
+			out.Node.TTL = int64(exp.Sub(k.now()) / time.Second)
+		}
+	case mvccpb.DELETE:
+		// v3 doesn't distinguish the expiry of a key's lease from its deletion.
+		out.Action = store.Delete
+		out.Node.Value = ""
+
+		if out.PrevNode != nil {
+			out.Node.CreatedIndex = out.PrevNode.CreatedIndex
+		}
+	}
+	return out, nil
+}
+
+// normalizeV3Key returns the cleaned, absolute form of v2 |key|.
+func normalizeV3Key(key string) string {
+	return path.Join("/", key)
+}
+
+// childPrefix returns the v3 key prefix of children of v2 directory |key|.
+// It's also the key of the directory's marker.
+func childPrefix(key string) string {
+	if key == "/" {
+		return key
+	}
+	return key + "/"
+}
+
+// nodeFromKV returns the etcd.Node of |kv|, which may be a directory marker.
+func nodeFromKV(kv *mvccpb.KeyValue) *etcd.Node {
+	var node = &etcd.Node{
+		Key:           string(kv.Key),
+		Value:         string(kv.Value),
+		CreatedIndex:  uint64(kv.CreateRevision),
+		ModifiedIndex: uint64(kv.ModRevision),
+	}
+	if len(node.Key) > 1 && strings.HasSuffix(node.Key, "/") {
+		node.Key, node.Value, node.Dir = node.Key[:len(node.Key)-1], "", true
+	}
+	return node
+}
+
+// treeFromKVs builds the directory Node |key| from |kvs|, its descendants
+// ordered on key. Unless |recursive|, only immediate children of |key| are
+// included. Nodes are recursively sorted. The indices of a directory are those
+// of its marker, if it has one, and are otherwise the earliest created and
+// latest modified indices of its descendants.
+func treeFromKVs(key string, kvs []*mvccpb.KeyValue, recursive bool) *etcd.Node {
+	var root = &etcd.Node{Key: key, Dir: true}
+	var dirs = map[string]*etcd.Node{key: root}
+	var marked = make(map[string]bool)
+
+	// dir returns the directory Node |name|, creating it (and its parents)
+	// as required.
+	var dir func(name string) *etcd.Node
+	dir = func(name string) *etcd.Node {
+		if node, ok := dirs[name]; ok {
+			return node
+		}
+		var node = &etcd.Node{Key: name, Dir: true}
+		var parent = dir(path.Dir(name))
+		parent.Nodes = append(parent.Nodes, node)
+		dirs[name] = node
+		return node
+	}
+	// depth returns the depth of |name| beneath |key|.
+	var depth = func(name string) int {
+		return strings.Count(strings.TrimPrefix(name, childPrefix(key)), "/") + 1
+	}
+
+	for _, kv := range kvs {
+		var node = nodeFromKV(kv)
+
+		if !recursive && depth(node.Key) > 1 {
+			// Include only the immediate child directory of |key|.
+			var name = node.Key
+			for depth(name) > 1 {
+				name = path.Dir(name)
+			}
+			dir(name)
+			continue
+		}
+
+		var target *etcd.Node
+		if node.Dir {
+			target = dir(node.Key)
+			target.CreatedIndex, target.ModifiedIndex = node.CreatedIndex, node.ModifiedIndex
+			marked[node.Key] = true
+		} else {
+			target = node
+			var parent = dir(path.Dir(node.Key))
+			parent.Nodes = append(parent.Nodes, node)
+		}
+
+		// Fold indices into unmarked parent directories.
+		for name := path.Dir(target.Key); len(name) >= len(key); name = path.Dir(name) {
+			var parent = dirs[name]
+			if !marked[name] {
+				if parent.CreatedIndex == 0 || target.CreatedIndex < parent.CreatedIndex {
+					parent.CreatedIndex = target.CreatedIndex
+				}
+				if target.ModifiedIndex > parent.ModifiedIndex {
+					parent.ModifiedIndex = target.ModifiedIndex
+				}
+			}
+			if name == "/" {
+				break
+			}
+		}
+	}
+	walkNodes(root, func(node *etcd.Node) error {
+		sort.Sort(node.Nodes)
+		return nil
+	})
+	return root
+}
+
+// walkNodes invokes |fn| with |node| and each of its descendants.
+func walkNodes(node *etcd.Node, fn func(*etcd.Node) error) error {
+	if err := fn(node); err != nil {
+		return err
+	}
+	for _, child := range node.Nodes {
+		if err := walkNodes(child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func v3KeysError(code int, key string, index uint64) error {
+	var message string
+
+	switch code {
+	case etcd.ErrorCodeKeyNotFound:
+		message = "Key not found"
+	case etcd.ErrorCodeTestFailed:
+		message = "Compare failed"
+	case etcd.ErrorCodeNodeExist:
+		message = "Key already exists"
+	case etcd.ErrorCodeDirNotEmpty:
+		message = "Directory not empty"
+	case etcd.ErrorCodeEventIndexCleared:
+		message = "The event in requested index is outdated and cleared"
+	}
+	return etcd.Error{Code: code, Message: message, Cause: key, Index: index}
+}
+
+// CopyTree copies the tree rooted at |key| of |from| into |to|, as when
+// migrating a v2 keyspace into the v3 keyspace of a KeysAPI returned by
+// NewV3KeysAPI. Directories and values are copied, and existing values of
+// |to| are overwritten. Keys having a TTL are not copied: they're ephemeral
+// (eg, allocator member announcements and item locks), and are re-created by
+// their owners. The number of copied Nodes is returned.
+func CopyTree(ctx context.Context, from, to KeysAPI, key string) (int, error) {
+	var resp, err = from.Get(ctx, key, &etcd.GetOptions{Recursive: true, Sort: true})
+	if err != nil {
+		return 0, err
+	}
+	var count int
+
+	err = walkNodes(resp.Node, func(node *etcd.Node) error {
+		if node.Expiration != nil || node.TTL != 0 {
+			return nil
+		}
+		var err error
+		if node.Dir {
+			_, err = to.Set(ctx, node.Key, "", &etcd.SetOptions{Dir: true})
+
+			// A v2 |to| fails the Set of an existing directory.
+			if etcdErr, ok := err.(etcd.Error); ok && etcdErr.Code == etcd.ErrorCodeNotFile {
+				err = nil
+			}
+		} else {
+			_, err = to.Set(ctx, node.Key, node.Value, nil)
+		}
+		if err == nil {
+			count++
+		}
+		return err
+	})
+	return count, err
+}
@@ -0,0 +1,174 @@
+package consensus
+
+import (
+	"context"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/coreos/etcd/store"
+	gc "github.com/go-check/check"
+	"github.com/stretchr/testify/mock"
+)
+
+type KeysV3Suite struct{}
+
+func (s *KeysV3Suite) TestNodeFromKV(c *gc.C) {
+	c.Check(nodeFromKV(&mvccpb.KeyValue{
+		Key: []byte("/foo/bar"), Value: []byte("val"), CreateRevision: 10, ModRevision: 12,
+	}), gc.DeepEquals, &etcd.Node{Key: "/foo/bar", Value: "val", CreatedIndex: 10, ModifiedIndex: 12})
+
+	// Directory markers are mapped to directory Nodes.
+	c.Check(nodeFromKV(&mvccpb.KeyValue{
+		Key: []byte("/foo/bar/"), CreateRevision: 10, ModRevision: 10,
+	}), gc.DeepEquals, &etcd.Node{Key: "/foo/bar", Dir: true, CreatedIndex: 10, ModifiedIndex: 10})
+
+	c.Check(normalizeV3Key("foo/bar/"), gc.Equals, "/foo/bar")
+	c.Check(normalizeV3Key("/"), gc.Equals, "/")
+	c.Check(childPrefix("/foo"), gc.Equals, "/foo/")
+	c.Check(childPrefix("/"), gc.Equals, "/")
+}
+
+func (s *KeysV3Suite) TestTreeFromKVs(c *gc.C) {
+	var kv = func(key string, rev int64) *mvccpb.KeyValue {
+		return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(key), CreateRevision: rev, ModRevision: rev}
+	}
+	// Ordered on key, as returned by a v3 range. Note "/root/a-b/c" orders
+	// before "/root/a/", but "a" orders before "a-b" in the v2 hierarchy.
+	var kvs = []*mvccpb.KeyValue{
+		kv("/root/a-b/c", 14),
+		kv("/root/a/", 10),
+		kv("/root/a/x", 11),
+		kv("/root/a/y/z", 13),
+		kv("/root/b", 12),
+		kv("/root/empty/", 15),
+	}
+
+	var tree = treeFromKVs("/root", kvs, true)
+	c.Check(tree, gc.DeepEquals, &etcd.Node{
+		Key: "/root", Dir: true, CreatedIndex: 10, ModifiedIndex: 15,
+		Nodes: etcd.Nodes{
+			{Key: "/root/a", Dir: true, CreatedIndex: 10, ModifiedIndex: 10, Nodes: etcd.Nodes{
+				{Key: "/root/a/x", Value: "/root/a/x", CreatedIndex: 11, ModifiedIndex: 11},
+				{Key: "/root/a/y", Dir: true, CreatedIndex: 13, ModifiedIndex: 13, Nodes: etcd.Nodes{
+					{Key: "/root/a/y/z", Value: "/root/a/y/z", CreatedIndex: 13, ModifiedIndex: 13},
+				}},
+			}},
+			{Key: "/root/a-b", Dir: true, CreatedIndex: 14, ModifiedIndex: 14, Nodes: etcd.Nodes{
+				{Key: "/root/a-b/c", Value: "/root/a-b/c", CreatedIndex: 14, ModifiedIndex: 14},
+			}},
+			{Key: "/root/b", Value: "/root/b", CreatedIndex: 12, ModifiedIndex: 12},
+			{Key: "/root/empty", Dir: true, CreatedIndex: 15, ModifiedIndex: 15},
+		},
+	})
+	// The tree may be navigated with Child, which requires sorted Nodes.
+	c.Check(Child(tree, "a", "y", "z").Value, gc.Equals, "/root/a/y/z")
+	c.Check(Child(tree, "a-b", "c").Value, gc.Equals, "/root/a-b/c")
+
+	// Non-recursive trees include only immediate children.
+	tree = treeFromKVs("/root", kvs, false)
+
+	var keys []string
+	c.Check(walkNodes(tree, func(n *etcd.Node) error {
+		keys = append(keys, n.Key)
+		return nil
+	}), gc.IsNil)
+	c.Check(keys, gc.DeepEquals, []string{
+		"/root", "/root/a", "/root/a-b", "/root/b", "/root/empty"})
+}
+
+func (s *KeysV3Suite) TestWatcherMatching(c *gc.C) {
+	var w = &v3Watcher{key: "/foo"}
+
+	c.Check(w.matches("/foo"), gc.Equals, true)
+	c.Check(w.matches("/foo/"), gc.Equals, true) // Directory marker.
+	c.Check(w.matches("/foo/bar"), gc.Equals, false)
+	c.Check(w.matches("/foobar"), gc.Equals, false)
+
+	w.recursive = true
+	c.Check(w.matches("/foo/bar"), gc.Equals, true)
+	c.Check(w.matches("/foo/bar/baz"), gc.Equals, true)
+	c.Check(w.matches("/foobar"), gc.Equals, false)
+
+	// Watches of AfterIndex resume from the following revision.
+	var keys = newV3KeysAPI(nil, nil, nil)
+	c.Check(keys.Watcher("foo", &etcd.WatcherOptions{AfterIndex: 41}).(*v3Watcher).nextRev,
+		gc.Equals, int64(42))
+	c.Check(keys.Watcher("foo", nil).(*v3Watcher).nextRev, gc.Equals, int64(0))
+}
+
+func (s *KeysV3Suite) TestResponseFromEvent(c *gc.C) {
+	var keys = newV3KeysAPI(nil, nil, nil)
+	var now = time.Unix(1000, 0)
+	keys.now = func() time.Time { return now }
+
+	// Lease expirations are served from those already observed.
+	keys.observeLease(clientv3.LeaseID(7), now.Add(10*time.Second))
+
+	var created = &mvccpb.KeyValue{
+		Key: []byte("/foo/bar"), Value: []byte("val"), CreateRevision: 5, ModRevision: 5, Version: 1, Lease: 7}
+
+	var resp, err = keys.responseFromEvent(context.Background(), &clientv3.Event{Type: mvccpb.PUT, Kv: created})
+	c.Check(err, gc.IsNil)
+	c.Check(resp.Action, gc.Equals, store.Create)
+	c.Check(resp.Index, gc.Equals, uint64(5))
+	c.Check(resp.Node.Value, gc.Equals, "val")
+	c.Check(*resp.Node.Expiration, gc.Equals, now.Add(10*time.Second))
+	c.Check(resp.Node.TTL, gc.Equals, int64(10))
+
+	var updated = &mvccpb.KeyValue{
+		Key: []byte("/foo/bar"), Value: []byte("new"), CreateRevision: 5, ModRevision: 6, Version: 2}
+
+	resp, err = keys.responseFromEvent(context.Background(),
+		&clientv3.Event{Type: mvccpb.PUT, Kv: updated, PrevKv: created})
+	c.Check(err, gc.IsNil)
+	c.Check(resp.Action, gc.Equals, store.Set)
+	c.Check(resp.Node.Expiration, gc.IsNil)
+	c.Check(resp.PrevNode.Value, gc.Equals, "val")
+
+	resp, err = keys.responseFromEvent(context.Background(), &clientv3.Event{
+		Type:   mvccpb.DELETE,
+		Kv:     &mvccpb.KeyValue{Key: []byte("/foo/bar"), ModRevision: 8},
+		PrevKv: updated,
+	})
+	c.Check(err, gc.IsNil)
+	c.Check(resp.Action, gc.Equals, store.Delete)
+	c.Check(resp.Node, gc.DeepEquals, &etcd.Node{Key: "/foo/bar", CreatedIndex: 5, ModifiedIndex: 8})
+	c.Check(IsEtcdRemoveOp(resp.Action), gc.Equals, true)
+}
+
+func (s *KeysV3Suite) TestCopyTree(c *gc.C) {
+	var ctx = context.Background()
+	var from, to MockKeysAPI
+	var expiration = time.Unix(1234, 0)
+
+	from.On("Get", ctx, "/root", &etcd.GetOptions{Recursive: true, Sort: true}).
+		Return(&etcd.Response{
+			Node: &etcd.Node{Key: "/root", Dir: true, Nodes: etcd.Nodes{
+				{Key: "/root/items", Dir: true, Nodes: etcd.Nodes{
+					{Key: "/root/items/an-item", Dir: true, Nodes: etcd.Nodes{
+						{Key: "/root/items/an-item/a-member", Value: "ready", Expiration: &expiration, TTL: 10},
+					}},
+				}},
+				{Key: "/root/members", Dir: true, Nodes: etcd.Nodes{
+					{Key: "/root/members/a-member", Expiration: &expiration, TTL: 10},
+				}},
+				{Key: "/root/topology", Value: "{}"},
+			}},
+		}, nil)
+
+	for _, dir := range []string{"/root", "/root/items", "/root/items/an-item", "/root/members"} {
+		to.On("Set", ctx, dir, "", &etcd.SetOptions{Dir: true}).Return(&etcd.Response{}, nil).Once()
+	}
+	to.On("Set", ctx, "/root/topology", "{}", (*etcd.SetOptions)(nil)).Return(&etcd.Response{}, nil).Once()
+
+	var count, err = CopyTree(ctx, &from, &to, "/root")
+	c.Check(err, gc.IsNil)
+	c.Check(count, gc.Equals, 5)
+
+	to.AssertExpectations(c)
+	to.AssertNotCalled(c, "Set", ctx, "/root/members/a-member", mock.Anything, mock.Anything)
+}
+
+var _ = gc.Suite(&KeysV3Suite{})
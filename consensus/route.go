@@ -42,13 +42,13 @@ func (rt Route) Index(name string) int {
 
 // IsReadyForHandoff returns whether all replicas are ready for the item
 // master to hand off item responsibility, without causing a violation of the
-// required replica count.
+// required replica count (see also ItemReplicator).
 func (rt Route) IsReadyForHandoff(alloc Allocator) bool {
-	if wanted := alloc.Replicas() + 1; len(rt.Entries) < wanted {
+	item := path.Base(rt.Item.Key)
+
+	if wanted := itemReplicas(alloc, item) + 1; len(rt.Entries) < wanted {
 		return false
 	} else {
-		item := path.Base(rt.Item.Key)
-
 		for j := 1; j != wanted; j++ {
 			if !alloc.ItemIsReadyForPromotion(item, rt.Entries[j].Value) {
 				return false
@@ -50,6 +50,22 @@ func (s *RouteSuite) TestReadyForHandoff(c *gc.C) {
 	c.Check(rt.IsReadyForHandoff(alloc), gc.Equals, true)
 }
 
+func (s *RouteSuite) TestHandoffWithItemReplicator(c *gc.C) {
+	var rt = s.fixture(time.Time{}, nil)
+	var mockAlloc = new(MockAllocator)
+	mockAlloc.On("ItemIsReadyForPromotion", "bar", "ready").Return(true)
+	mockAlloc.On("ItemIsReadyForPromotion", "bar", "not-ready").Return(false)
+
+	// Replicas() is not consulted: the item's replica count is used instead.
+	var alloc = itemReplicatorAllocator{MockAllocator: mockAlloc, replicas: map[string]int{"bar": 1}}
+	c.Check(rt.IsReadyForHandoff(alloc), gc.Equals, true)
+
+	alloc.replicas["bar"] = 2
+	c.Check(rt.IsReadyForHandoff(alloc), gc.Equals, false)
+
+	mockAlloc.AssertNotCalled(c, "Replicas")
+}
+
 func (s *RouteSuite) TestCopy(c *gc.C) {
 	var rt1 = s.fixture(time.Time{}, nil)
 	var rt2 = rt1.Copy()
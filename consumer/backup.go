@@ -0,0 +1,249 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	rocks "github.com/tecbot/gorocksdb"
+
+	"github.com/LiveRamp/gazette/cloudstore"
+	"github.com/LiveRamp/gazette/recoverylog"
+)
+
+// Name of the recoverylog.Snapshot file of a backup. The Snapshot is written
+// only after all Fnode content of the backup, and its presence marks the
+// backup as complete.
+const backupSnapshotName = "snapshot.json"
+
+// backupDir returns the directory of the |shard| backup at recovery log
+// |offset|. Offsets are fixed-width, such that directories order on offset.
+func backupDir(shard ShardID, offset int64) string {
+	return fmt.Sprintf("%s/%016x", shard, offset)
+}
+
+// snapshot captures a consistent recoverylog.Snapshot of the database, staging
+// its content into |stageDir| (which must be on the same file system as the
+// database directory). The memtable is first flushed, which briefly blocks
+// writes but bounds the size of write-ahead logs captured by the snapshot.
+func (db *database) snapshot(stageDir string) (recoverylog.Snapshot, error) {
+	var flushOpts = rocks.NewDefaultFlushOptions()
+	defer flushOpts.Destroy()
+	flushOpts.SetWait(true)
+
+	if err := db.Flush(flushOpts); err != nil {
+		return recoverylog.Snapshot{}, err
+	}
+	return db.recorder.Snapshot(db.dir, stageDir)
+}
+
+// uploadBackup uploads |snapshot| of |shard|, with Fnode content staged in
+// |stageDir|, to |store|. The caller must ensure recovery log operations
+// through the snapshot have committed before calling uploadBackup.
+func uploadBackup(ctx context.Context, store cloudstore.FileSystem, shard ShardID,
+	snapshot recoverylog.Snapshot, stageDir string) error {
+
+	var dir = backupDir(shard, snapshot.Offset)
+	if err := store.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+
+	for _, node := range snapshot.Fnodes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var staged, err = os.Open(filepath.Join(stageDir, node.ContentName()))
+		if err != nil {
+			return err
+		}
+		// Staged content may be appended to beyond the snapshot. Copy only
+		// through the snapshot Size.
+		err = copyToStore(store, path.Join(dir, node.ContentName()),
+			io.LimitReader(staged, node.Size), node.Size)
+		staged.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	var b, err = json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return copyToStore(store, path.Join(dir, backupSnapshotName), bytes.NewReader(b), int64(len(b)))
+}
+
+// downloadBackup downloads the most recent complete backup of |shard| from
+// |store|, placing Fnode content into |seedDir| as expected by
+// recoverylog.Player.SeedFromSnapshot. If no backup exists, the returned
+// Snapshot is nil.
+func downloadBackup(ctx context.Context, store cloudstore.FileSystem, shard ShardID,
+	seedDir string) (*recoverylog.Snapshot, error) {
+
+	var latest string
+	var err = store.Walk(shard.String(), func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if path.Base(name) == backupSnapshotName && name > latest {
+			latest = name
+		}
+		return nil
+	})
+
+	if os.IsNotExist(err) || (err == nil && latest == "") {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var snapshot = new(recoverylog.Snapshot)
+	if f, err := store.Open(latest); err != nil {
+		return nil, err
+	} else if err = json.NewDecoder(f).Decode(snapshot); err != nil {
+		f.Close()
+		return nil, err
+	} else {
+		f.Close()
+	}
+
+	for _, node := range snapshot.Fnodes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		} else if err = downloadFromStore(store, path.Join(path.Dir(latest), node.ContentName()),
+			filepath.Join(seedDir, node.ContentName()), node.Size); err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// copyToStore atomically copies exactly |size| bytes of |r| to |name| of |store|.
+func copyToStore(store cloudstore.FileSystem, name string, r io.Reader, size int64) error {
+	var w, err = store.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+
+	if n, err := store.CopyAtomic(w, r); err != nil {
+		return err
+	} else if n != size {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// downloadFromStore copies exactly |size| bytes of |name| of |store| to |local|.
+func downloadFromStore(store cloudstore.FileSystem, name, local string, size int64) error {
+	var r, err = store.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.OpenFile(local, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+
+	if n, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	} else if n != size {
+		w.Close()
+		return io.ErrUnexpectedEOF
+	}
+	return w.Close()
+}
+
+// startBackup snapshots the master database, and uploads the snapshot to the
+// Runner BackupStore in the background. The upload begins only after the
+// recovery log has committed all operations through the snapshot. No backup
+// is started if a previous upload is still in progress.
+func (m *master) startBackup(runner *Runner) {
+	if m.backupCh != nil {
+		select {
+		case <-m.backupCh:
+		default:
+			return // Previous upload is still in progress.
+		}
+	}
+
+	// The stage directory must be a sibling of |m.localDir|, as snapshot
+	// content is hard-linked.
+	var stageDir, err = ioutil.TempDir(runner.LocalDir, "backup-"+m.shard.String())
+	if err != nil {
+		log.WithFields(log.Fields{"shard": m.shard, "err": err}).Warn("failed to create backup directory")
+		return
+	}
+
+	snapshot, err := m.database.snapshot(stageDir)
+	if err != nil {
+		log.WithFields(log.Fields{"shard": m.shard, "err": err}).Warn("failed to snapshot database")
+		os.RemoveAll(stageDir)
+		return
+	}
+	var barrier = m.database.recorder.WriteBarrier()
+
+	m.backupCh = make(chan struct{})
+	go func(doneCh chan struct{}) {
+		defer close(doneCh)
+		defer os.RemoveAll(stageDir)
+
+		<-barrier.Ready
+
+		if err := uploadBackup(context.Background(), runner.BackupStore, m.shard,
+			snapshot, stageDir); err != nil {
+			log.WithFields(log.Fields{"shard": m.shard, "err": err}).Warn("failed to upload backup")
+		} else {
+			log.WithFields(log.Fields{"shard": m.shard, "offset": snapshot.Offset}).Info("uploaded backup")
+		}
+	}(m.backupCh)
+}
+
+// seedFromBackup seeds the replica Player from the most recent backup of the
+// Shard, if one exists which is more recent than the replica's hints. Failure
+// to seed is logged, and the replica falls back to playback of its hints.
+func (r *replica) seedFromBackup(runner *Runner) {
+	// Hinted playback begins from the first offset of any hinted segment.
+	var hintedOffset int64 = -1
+	for _, node := range r.hints.LiveNodes {
+		for _, segment := range node.Segments {
+			if hintedOffset == -1 || segment.FirstOffset < hintedOffset {
+				hintedOffset = segment.FirstOffset
+			}
+		}
+	}
+
+	// Clear any content remaining from a prior replica.
+	if err := os.RemoveAll(r.seedDir); err != nil {
+		log.WithFields(log.Fields{"shard": r.shard, "err": err}).Warn("failed to clear seed directory")
+		return
+	} else if err = os.MkdirAll(r.seedDir, 0750); err != nil {
+		log.WithFields(log.Fields{"shard": r.shard, "err": err}).Warn("failed to create seed directory")
+		return
+	}
+
+	var snapshot, err = downloadBackup(context.Background(), runner.BackupStore, r.shard, r.seedDir)
+	if err != nil {
+		log.WithFields(log.Fields{"shard": r.shard, "err": err}).Warn("failed to download backup")
+		return
+	} else if snapshot == nil {
+		return // No backup exists.
+	} else if hintedOffset != -1 && hintedOffset >= snapshot.Offset {
+		return // Hints are more recent than the backup.
+	}
+
+	if err = r.player.SeedFromSnapshot(*snapshot, r.seedDir); err != nil {
+		log.WithFields(log.Fields{"shard": r.shard, "err": err}).Warn("failed to seed from backup")
+		return
+	}
+	log.WithFields(log.Fields{"shard": r.shard, "offset": snapshot.Offset}).Info("seeded from backup")
+}
@@ -0,0 +1,83 @@
+package consumer
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gc "github.com/go-check/check"
+
+	"github.com/LiveRamp/gazette/cloudstore"
+	"github.com/LiveRamp/gazette/recoverylog"
+)
+
+type BackupSuite struct{}
+
+func (s *BackupSuite) TestUploadAndDownload(c *gc.C) {
+	var store = cloudstore.NewTmpFileSystem()
+	defer store.Close()
+
+	stageDir, err := ioutil.TempDir("", "backup-suite")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(stageDir)
+
+	// No backups exist yet.
+	snapshot, err := downloadBackup(context.Background(), store, "a-shard", stageDir)
+	c.Check(err, gc.IsNil)
+	c.Check(snapshot, gc.IsNil)
+
+	// Stage content of two Fnodes. The content of Fnode 3 extends beyond the
+	// snapshot, and is expected to be truncated.
+	c.Assert(ioutil.WriteFile(filepath.Join(stageDir, "2"), []byte("two"), 0666), gc.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(stageDir, "3"), []byte("three-and-more"), 0666), gc.IsNil)
+
+	var older = recoverylog.Snapshot{
+		Log:       "a/recovery/log",
+		Offset:    0x100,
+		NextSeqNo: 10,
+		Fnodes: []recoverylog.SnapshotFnode{
+			{Fnode: 2, Links: []string{"/two"}, Size: 3},
+		},
+	}
+	var newer = recoverylog.Snapshot{
+		Log:       "a/recovery/log",
+		Offset:    0x1000,
+		NextSeqNo: 20,
+		Fnodes: []recoverylog.SnapshotFnode{
+			{Fnode: 2, Links: []string{"/two"}, Size: 3},
+			{Fnode: 3, Links: []string{"/three"}, Size: 5},
+		},
+	}
+	c.Check(uploadBackup(context.Background(), store, "a-shard", older, stageDir), gc.IsNil)
+	c.Check(uploadBackup(context.Background(), store, "a-shard", newer, stageDir), gc.IsNil)
+
+	// A failed upload at a later offset leaves an incomplete backup (without
+	// a Snapshot), which is ignored.
+	c.Check(store.MkdirAll(backupDir("a-shard", 0x2000), 0750), gc.IsNil)
+	c.Check(copyToStore(store, backupDir("a-shard", 0x2000)+"/2",
+		strings.NewReader("tw"), 3), gc.Equals, io.ErrUnexpectedEOF)
+
+	seedDir, err := ioutil.TempDir("", "backup-suite")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(seedDir)
+
+	snapshot, err = downloadBackup(context.Background(), store, "a-shard", seedDir)
+	c.Check(err, gc.IsNil)
+	c.Check(snapshot, gc.DeepEquals, &newer)
+
+	for name, expect := range map[string]string{"2": "two", "3": "three"} {
+		var content, err = ioutil.ReadFile(filepath.Join(seedDir, name))
+		c.Check(err, gc.IsNil)
+		c.Check(string(content), gc.Equals, expect)
+	}
+
+	// Backups of other shards are unaffected.
+	snapshot, err = downloadBackup(context.Background(), store, "other-shard", seedDir)
+	c.Check(err, gc.IsNil)
+	c.Check(snapshot, gc.IsNil)
+}
+
+var _ = gc.Suite(&BackupSuite{})
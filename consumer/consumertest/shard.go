@@ -15,6 +15,8 @@ import (
 type Shard struct {
 	IDFixture        consumer.ShardID
 	PartitionFixture topic.Partition
+	// Maximum serialized size of the Shard Transaction. Zero is unbounded.
+	MaxTransactionBytes int64
 
 	tmpdir string
 
@@ -22,7 +24,9 @@ type Shard struct {
 	opts *rocks.Options
 	ro   *rocks.ReadOptions
 	wo   *rocks.WriteOptions
+	txWo *rocks.WriteOptions
 	db   *rocks.DB
+	cfs  map[string]*rocks.ColumnFamilyHandle
 
 	tx *rocks.WriteBatch
 
@@ -39,6 +43,50 @@ func (s *Shard) Transaction() *rocks.WriteBatch    { return s.tx }
 func (s *Shard) ReadOptions() *rocks.ReadOptions   { return s.ro }
 func (s *Shard) WriteOptions() *rocks.WriteOptions { return s.wo }
 
+// AbortTransaction discards the current Shard transaction WriteBatch.
+func (s *Shard) AbortTransaction() { s.tx.Clear() }
+
+// SetTransactionWriteOptions sets WriteOptions used by the next
+// FlushTransaction, in place of WriteOptions().
+func (s *Shard) SetTransactionWriteOptions(options *rocks.WriteOptions) { s.txWo = options }
+
+// CheckTransaction returns consumer.ErrTransactionTooLarge if the Shard
+// Transaction exceeds MaxTransactionBytes.
+func (s *Shard) CheckTransaction() error {
+	return consumer.CheckTransactionSize(s.tx, s.MaxTransactionBytes)
+}
+
+// CommittedReadOptions returns the Shard ReadOptions. The test Shard has no
+// recovery log, and flushed transactions are immediately committed.
+func (s *Shard) CommittedReadOptions() *rocks.ReadOptions { return s.ro }
+
+// CommittedOffset returns -1. The test Shard has no recovery log.
+func (s *Shard) CommittedOffset() int64 { return -1 }
+
+// ColumnFamily returns the named column family, creating it if it doesn't
+// exist. As this is a test support method, it panics on error.
+func (s *Shard) ColumnFamily(name string) *rocks.ColumnFamilyHandle {
+	if cf, ok := s.cfs[name]; ok {
+		return cf
+	}
+	var cf, err = s.db.CreateColumnFamily(s.opts, name)
+	if err != nil {
+		panic(err.Error())
+	}
+	s.cfs[name] = cf
+	return cf
+}
+
+// CompactRecoveryLog flushes the database memtable. The test Shard has no
+// recovery log, and its database isn't re-opened.
+func (s *Shard) CompactRecoveryLog() error {
+	var opts = rocks.NewDefaultFlushOptions()
+	defer opts.Destroy()
+	opts.SetWait(true)
+
+	return s.db.Flush(opts)
+}
+
 // Initializes a Shard & database backed by a temporary directory.
 // TODO(johnny): Since this is test support, panic on error (rather than returning it).
 func NewShard(prefix string) (*Shard, error) {
@@ -63,23 +111,30 @@ func NewShard(prefix string) (*Shard, error) {
 		return nil, err
 	}
 
+	s.cfs = make(map[string]*rocks.ColumnFamilyHandle)
 	s.tx = rocks.NewWriteBatch()
 	return s, nil
 }
 
 // Flushes the current Shard transaction WriteBatch to the database.
 func (s *Shard) FlushTransaction() error {
-	var err = s.db.Write(s.wo, s.tx)
+	var wo = s.wo
+	if s.txWo != nil {
+		wo = s.txWo
+	}
+	var err = s.db.Write(wo, s.tx)
 	s.tx.Clear()
+	s.txWo = nil
 	return err
 }
 
-// DatabaseContents enumerates and returns keys and values from the database
-// as a map. As this is a test support method, it panics on iterator error.
+// DatabaseContents enumerates and returns keys and values from a consistent
+// snapshot of the database as a map. As this is a test support method, it
+// panics on iterator error.
 func (s *Shard) DatabaseContent() map[string]string {
 	var results = make(map[string]string)
 
-	var it = s.db.NewIterator(s.ro)
+	var it = consumer.NewSnapshotIterator(s.db, nil)
 	defer it.Close()
 
 	for it.SeekToFirst(); it.Valid(); it.Next() {
@@ -96,6 +151,9 @@ func (s *Shard) Close() error {
 	s.opts.Destroy()
 	s.ro.Destroy()
 	s.wo.Destroy()
+	for _, cf := range s.cfs {
+		cf.Destroy()
+	}
 	s.db.Close()
 	s.env.Destroy()
 	return os.RemoveAll(s.tmpdir)
@@ -1,30 +1,91 @@
 package consumer
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
 	rocks "github.com/tecbot/gorocksdb"
 
 	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/metrics"
 	"github.com/LiveRamp/gazette/recoverylog"
 )
 
+// Default maximum size of a database MANIFEST file. See newDefaultOptions.
+const kDefaultMaxManifestFileSize = 1 << 17 // 131072 bytes.
+
+// Largest maximum size of a database MANIFEST file which may be configured.
+// See Runner.MaxManifestFileSize.
+const kMaxManifestFileSize = 1 << 26 // 64MB.
+
+// Name of the RocksDB column family which always exists.
+const kDefaultColumnFamily = "default"
+
+// ErrTransactionTooLarge is returned if the serialized size of a consumer
+// transaction exceeds its configured maximum. See Runner.MaxTransactionBytes.
+// Size is checked prior to commit: a rejected transaction is not written to
+// the database, and no commit barrier is issued for it. The commit barrier of
+// the last committed transaction (and CommittedOffset) is unaffected.
+var ErrTransactionTooLarge = errors.New("transaction exceeds maximum size")
+
+// ErrPriorCommitFailed is the Error of a commit barrier which resolved after
+// the barrier of a preceding transaction failed. Though the transaction's own
+// content may have been appended, it's not durable, as it depends on content
+// of the failed transaction. See orderBarrier.
+var ErrPriorCommitFailed = errors.New("a prior transaction failed to commit")
+
 type database struct {
 	recoveryLog journal.Name
 	logWriter   journal.Writer
 	recorder    *recoverylog.Recorder
+	// Local directory of the database.
+	dir string
 
 	*rocks.DB
+	// Guards |DB| and |options| against concurrent reads of database
+	// properties (see properties), while the database is compacted or torn down.
+	mu sync.RWMutex
+	// Open column families of the database, keyed on name. Always includes
+	// the default column family.
+	columnFamilies map[string]*rocks.ColumnFamilyHandle
+
 	env          *rocks.Env
 	options      *rocks.Options
 	writeOptions *rocks.WriteOptions
 	readOptions  *rocks.ReadOptions
 	writeBatch   *rocks.WriteBatch
+	// WriteOptions of the current transaction, if not |writeOptions|. Owned
+	// by the caller. See Shard.SetTransactionWriteOptions.
+	txWriteOptions *rocks.WriteOptions
+	// Maximum serialized size of |writeBatch|, or zero if unbounded.
+	maxTransactionBytes int64
+
+	// Commit barrier of the last committed transaction. See waitForCommit.
+	lastBarrier *journal.AsyncAppend
+	// Guards |lastBarrier| and |committed| against concurrent committedOffset
+	// calls.
+	commitMu sync.Mutex
+	// Recovery log write head of the last resolved commit barrier.
+	committed int64
 }
 
+// newDatabase opens a database at |dir|, recorded to the recovery log of |fsm|
+// via |writer|. |options| are provided by the caller (and may be customized via
+// OptionsIniter), and are augmented with options reserved for correct recovery
+// of the database, which replace any prior values. The database takes
+// ownership of |options|, even on error: they're destroyed by newDatabase if a
+// database isn't returned, and otherwise by its teardown. Column families of
+// |columnFamilies| are opened, and created if they don't already exist.
 func newDatabase(options *rocks.Options, fsm *recoverylog.FSM, dir string,
-	writer journal.Writer) (*database, error) {
+	writer journal.Writer, columnFamilies []string) (*database, error) {
 
 	recorder, err := recoverylog.NewRecorder(fsm, len(dir), writer)
 	if err != nil {
+		options.Destroy()
 		return nil, err
 	}
 
@@ -32,16 +93,115 @@ func newDatabase(options *rocks.Options, fsm *recoverylog.FSM, dir string,
 		recoveryLog: fsm.LogMark.Journal,
 		logWriter:   writer,
 		recorder:    recorder,
+		dir:         dir,
 
 		env:          rocks.NewObservedEnv(recorder),
 		options:      options,
 		readOptions:  rocks.NewDefaultReadOptions(),
 		writeOptions: rocks.NewDefaultWriteOptions(),
 		writeBatch:   rocks.NewWriteBatch(),
+		committed:    -1,
+	}
+
+	applyReservedOptions(db.options, db.env)
+
+	db.DB, db.columnFamilies, err = openColumnFamilies(db.options, dir, columnFamilies)
+	if err != nil {
+		return db, err
 	}
+	openDatabases.add(db)
+	return db, nil
+}
+
+// openColumnFamilies opens the database at |dir| with all of its existing
+// column families, and then creates any of |names| which don't yet exist.
+//
+// Column family metadata lives in the database MANIFEST (and OPTIONS) files,
+// which like all other database files are written through the recorded Env.
+// A replica recovered from the recovery log therefore has the same MANIFEST,
+// and the column families it lists are re-opened here. Column families must
+// be enumerated in this way because RocksDB refuses to open a database without
+// naming every column family it contains.
+func openColumnFamilies(options *rocks.Options, dir string,
+	names []string) (*rocks.DB, map[string]*rocks.ColumnFamilyHandle, error) {
+
+	var existing = []string{kDefaultColumnFamily}
 
-	db.options.SetEnv(db.env)
-	db.options.SetCreateIfMissing(true)
+	if _, err := os.Stat(filepath.Join(dir, "CURRENT")); err == nil {
+		if existing, err = rocks.ListColumnFamilies(options, dir); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var cfOptions = make([]*rocks.Options, len(existing))
+	for i := range cfOptions {
+		cfOptions[i] = options
+	}
+
+	db, handles, err := rocks.OpenDbColumnFamilies(options, dir, existing, cfOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var columnFamilies = make(map[string]*rocks.ColumnFamilyHandle, len(existing))
+	for i, name := range existing {
+		columnFamilies[name] = handles[i]
+	}
+
+	for _, name := range names {
+		if _, ok := columnFamilies[name]; ok {
+			continue
+		}
+		if columnFamilies[name], err = db.CreateColumnFamily(options, name); err != nil {
+			return db, columnFamilies, err
+		}
+	}
+	return db, columnFamilies, nil
+}
+
+// newDefaultOptions returns database options with consumer defaults applied.
+// Defaults may be further customized by the Consumer via OptionsIniter.
+func newDefaultOptions() *rocks.Options {
+	var options = rocks.NewDefaultOptions()
+
+	// The MANIFEST file is a WAL of database file state, including current live
+	// SST files and their begin & ending key ranges. A new MANIFEST-00XYZ is
+	// created at database start, where XYZ is the next available sequence number,
+	// and CURRENT is updated to point at the live MANIFEST. By default MANIFEST
+	// files may grow to 4GB, but they are typically written very slowly and thus
+	// artificially inflate the recovery log horizon. We use a much smaller limit
+	// to encourage more frequent snapshotting and rolling into new files.
+	//
+	// Databases with a high rate of file churn may see excessive MANIFEST rolls
+	// at this limit, and can raise it via Runner.MaxManifestFileSize at the cost
+	// of a longer recovery log horizon. Databases with little churn may instead
+	// prefer a lower limit, or explicit compaction of the horizon (see
+	// database.compact).
+	options.SetMaxManifestFileSize(kDefaultMaxManifestFileSize)
+	return options
+}
+
+// maxManifestFileSize returns the MaxManifestFileSize of a database having
+// configured |size| (see Runner.MaxManifestFileSize). Zero selects
+// kDefaultMaxManifestFileSize, and a |size| above kMaxManifestFileSize is an
+// error.
+func maxManifestFileSize(size uint64) (uint64, error) {
+	if size == 0 {
+		return kDefaultMaxManifestFileSize, nil
+	} else if size > kMaxManifestFileSize {
+		return 0, fmt.Errorf("MaxManifestFileSize %d exceeds the maximum of %d",
+			size, kMaxManifestFileSize)
+	}
+	return size, nil
+}
+
+// applyReservedOptions applies options to |options| which are required for
+// correct recording and recovery of the database, overriding any prior values.
+func applyReservedOptions(options *rocks.Options, env *rocks.Env) {
+	// All file operations must be observed by the recovery log Recorder. A
+	// custom Env of |options| is replaced.
+	options.SetEnv(env)
+	options.SetCreateIfMissing(true)
 
 	// By default, we instruct RocksDB *not* to perform data syncs. We already
 	// capture linearization of file write/rename/link operations via Gazette,
@@ -50,30 +210,41 @@ func newDatabase(options *rocks.Options, fsm *recoverylog.FSM, dir string,
 	//
 	// Note that the consumer loop also installs a write-barrier between
 	// transactions, which will block a current transaction from committing
-	// until the previous one has been fully synced by Gazette.
+	// until the previous one has been fully synced by Gazette. A transaction
+	// may still request a synced write (see Shard.SetTransactionWriteOptions),
+	// which the Recorder implements as an additional write-barrier.
 
 	// TODO(johnny): This option has been removed from Rocks. Research if
 	// there's another option we should use.
-	//db.options.SetDisableDataSync(true)
+	//options.SetDisableDataSync(true)
+}
 
-	// The MANIFEST file is a WAL of database file state, including current live
-	// SST files and their begin & ending key ranges. A new MANIFEST-00XYZ is
-	// created at database start, where XYZ is the next available sequence number,
-	// and CURRENT is updated to point at the live MANIFEST. By default MANIFEST
-	// files may grow to 4GB, but they are typically written very slowly and thus
-	// artificially inflate the recovery log horizon. We use a much smaller limit
-	// to encourage more frequent snapshotting and rolling into new files.
-	db.options.SetMaxManifestFileSize(1 << 17) // 131072 bytes.
+// commit atomically writes the current transaction together with |offsets|,
+// the journal offsets consumed through by the transaction. Offsets are stored
+// under reserved keys of the transaction's writeBatch, such that a database
+// recovered from the recovery log describes exactly where consumption should
+// resume (see checkpoint).
+//
+// The returned commit barrier resolves only after those of all previously
+// committed transactions have also resolved, and fails if any of them failed.
+// A caller may therefore commit a transaction before the barrier of the
+// previous one has resolved (pipelining transactions), and still observe
+// their durability strictly in commit order.
+func (db *database) commit(offsets map[journal.Name]int64) (*journal.AsyncAppend, error) {
+	storeOffsetsToDB(db.writeBatch, offsets)
 
-	db.DB, err = rocks.OpenDb(db.options, dir)
-	if err != nil {
-		return db, err
+	var started = time.Now()
+	metrics.GazetteConsumerCommitBytes.Observe(float64(len(db.writeBatch.Data())))
+
+	var options = db.writeOptions
+	if db.txWriteOptions != nil {
+		options = db.txWriteOptions
 	}
-	return db, nil
-}
+	// Options of the transaction apply only to its Write, whether or not it
+	// succeeds. The following transaction again uses |writeOptions|.
+	db.txWriteOptions = nil
 
-func (db *database) commit() (*journal.AsyncAppend, error) {
-	if err := db.Write(db.writeOptions, db.writeBatch); err != nil {
+	if err := db.Write(options, db.writeBatch); err != nil {
 		return nil, err
 	}
 	db.writeBatch.Clear()
@@ -81,10 +252,178 @@ func (db *database) commit() (*journal.AsyncAppend, error) {
 	// Issue an empty write. As writes from a client to a journal are applied
 	// strictly in order, this is effectively a commit barrier: when it resolves,
 	// the client knows the commit has been fully synced by Gazette.
-	return db.logWriter.Write(db.recoveryLog, nil)
+	var barrier, err = db.logWriter.Write(db.recoveryLog, nil)
+	if err != nil {
+		return nil, err
+	} else if db.lastBarrier != nil {
+		barrier = orderBarrier(db.lastBarrier, barrier)
+	}
+
+	go func() {
+		<-barrier.Ready
+		metrics.GazetteConsumerCommitDurationSeconds.Observe(time.Now().Sub(started).Seconds())
+
+		db.commitMu.Lock()
+		db.resolvedBarrier(barrier)
+		db.commitMu.Unlock()
+	}()
+
+	db.commitMu.Lock()
+	db.lastBarrier = barrier
+	db.commitMu.Unlock()
+
+	return barrier, nil
+}
+
+// orderBarrier returns an AsyncAppend which resolves with the result of
+// |barrier|, but not before |prior| has resolved. If |prior| failed, so does
+// the returned AsyncAppend (with ErrPriorCommitFailed, if |barrier| itself
+// succeeded). Failures thus propagate through a sequence of ordered barriers.
+// If |prior| has already resolved without error, |barrier| is returned as-is.
+func orderBarrier(prior, barrier *journal.AsyncAppend) *journal.AsyncAppend {
+	select {
+	case <-prior.Ready:
+		if prior.Error == nil {
+			return barrier
+		}
+	default:
+	}
+
+	var ordered = &journal.AsyncAppend{Ready: make(chan struct{})}
+
+	go func() {
+		<-prior.Ready
+		<-barrier.Ready
+
+		ordered.AppendResult = barrier.AppendResult
+		if prior.Error != nil && ordered.Error == nil {
+			ordered.Error = ErrPriorCommitFailed
+		}
+		close(ordered.Ready)
+	}()
+	return ordered
+}
+
+// committedOffset returns the recovery log write head which followed the
+// commit barrier of the most recent transaction to have durably committed,
+// or -1 if no commit barrier has yet resolved without error. All content
+// of committed transactions lies before the returned offset. It may be
+// called from any goroutine.
+func (db *database) committedOffset() int64 {
+	db.commitMu.Lock()
+	defer db.commitMu.Unlock()
+
+	if db.lastBarrier != nil {
+		select {
+		case <-db.lastBarrier.Ready:
+			db.resolvedBarrier(db.lastBarrier)
+		default:
+		}
+	}
+	return db.committed
+}
+
+// resolvedBarrier updates |committed| from resolved commit |barrier|.
+// |commitMu| must be held.
+func (db *database) resolvedBarrier(barrier *journal.AsyncAppend) {
+	if barrier.Error == nil && barrier.WriteHead > db.committed {
+		db.committed = barrier.WriteHead
+	}
+}
+
+// waitForCommit blocks until the commit barrier of the last committed
+// transaction has resolved, at which point all transactions committed thus
+// far are durable in the recovery log.
+func (db *database) waitForCommit() {
+	if db.lastBarrier != nil {
+		<-db.lastBarrier.Ready
+	}
+}
+
+// compact shortens the recovery log horizon of the database, which is the
+// portion of the recovery log a replica must play to recover it. The default
+// column family memtable is flushed to SST files, and the database is then
+// re-opened. Re-opening rolls a new MANIFEST, and replays and flushes the
+// write-ahead logs of other column families, after which prior MANIFEST and
+// log files are deleted. Hints built by the Recorder after compact returns
+// therefore no longer reference recovery log segments of those files, but
+// note that hints built (and stored) prior to compact continue to: replicas
+// recover from the compacted horizon only once updated hints are available.
+// *rocks.DB and column family handles obtained prior to compact are invalidated.
+func (db *database) compact() error {
+	var flushOpts = rocks.NewDefaultFlushOptions()
+	defer flushOpts.Destroy()
+	flushOpts.SetWait(true)
+
+	if err := db.Flush(flushOpts); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var names []string
+	for name, handle := range db.columnFamilies {
+		names = append(names, name)
+		handle.Destroy()
+	}
+	db.columnFamilies = nil
+
+	db.DB.Close()
+	db.DB = nil
+
+	var err error
+	db.DB, db.columnFamilies, err = openColumnFamilies(db.options, db.dir, names)
+	return err
+}
+
+// checkpoint returns journal offsets of the last committed transaction, as
+// stored by commit. A database recovered by recoverylog.Player returns the
+// checkpoint of the last transaction committed to the recovery log.
+func (db *database) checkpoint() (map[journal.Name]int64, error) {
+	return LoadOffsetsFromDB(db.DB, db.readOptions)
+}
+
+// checkTransaction returns ErrTransactionTooLarge if the current transaction
+// exceeds |maxTransactionBytes|. See CheckTransactionSize.
+func (db *database) checkTransaction() error {
+	return CheckTransactionSize(db.writeBatch, db.maxTransactionBytes)
+}
+
+// CheckTransactionSize returns ErrTransactionTooLarge if the serialized size
+// of |wb| exceeds |maxBytes|. The serialized size is that of the WriteBatch
+// representation written to the database (and recorded to the recovery log)
+// on commit, which includes per-mutation headers, column family identifiers,
+// and length prefixes in addition to keys and values. A |maxBytes| of zero is
+// unbounded. |wb| is unmodified.
+func CheckTransactionSize(wb *rocks.WriteBatch, maxBytes int64) error {
+	if maxBytes != 0 && int64(len(wb.Data())) > maxBytes {
+		return ErrTransactionTooLarge
+	}
+	return nil
+}
+
+// abort discards the current transaction. Pending mutations of |writeBatch|
+// are cleared without being written to the database, and no commit barrier is
+// issued: the recovery log is unchanged, and a replica recovered from it will
+// not observe the discarded mutations. WriteOptions of the transaction are
+// also discarded.
+func (db *database) abort() {
+	db.writeBatch.Clear()
+	db.txWriteOptions = nil
 }
 
 func (db *database) teardown() {
+	openDatabases.remove(db)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, handle := range db.columnFamilies {
+		handle.Destroy()
+	}
+	db.columnFamilies = nil
+
 	if db.DB != nil {
 		// Blocks until all background compaction has completed.
 		db.DB.Close()
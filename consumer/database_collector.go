@@ -0,0 +1,180 @@
+package consumer
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Maximum number of LSM levels inspected for live SST files.
+const kMaxDatabaseLevels = 7
+
+// Curated RocksDB properties of consumer databases, exported by
+// DatabaseCollector. Properties are numeric, and gauges.
+var databaseProperties = []struct {
+	property, metric, help string
+}{
+	{"rocksdb.live-sst-files-size", "live_sst_files_bytes",
+		"Total size of live SST files of the database."},
+	{"rocksdb.estimate-pending-compaction-bytes", "pending_compaction_bytes",
+		"Estimated bytes which compaction must rewrite to bring levels within their target sizes."},
+	{"rocksdb.cur-size-all-mem-tables", "memtable_bytes",
+		"Approximate size of active and unflushed immutable memtables."},
+	{"rocksdb.estimate-num-keys", "estimated_keys",
+		"Estimated number of keys of the database."},
+	{"rocksdb.num-running-compactions", "running_compactions",
+		"Number of currently running compactions."},
+	{"rocksdb.block-cache-usage", "block_cache_bytes",
+		"Memory size of entries residing in the block cache."},
+}
+
+// RocksDB statistics tickers exported by DatabaseCollector, if statistics are
+// enabled by the database Options (see OptionsIniter). Tickers are counters.
+var databaseTickers = []struct {
+	ticker, metric, help string
+}{
+	{"rocksdb.block.cache.hit", "block_cache_hit_total",
+		"Cumulative number of block cache hits."},
+	{"rocksdb.block.cache.miss", "block_cache_miss_total",
+		"Cumulative number of block cache misses."},
+}
+
+// properties returns current values of curated RocksDB properties of the
+// database, keyed on metric name, as well as the number of live SST files and
+// statistics tickers (if statistics are enabled). It may be called from any
+// goroutine. If the database is closed (or is being torn down or compacted)
+// false is returned.
+func (db *database) properties() (map[string]float64, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.DB == nil {
+		return nil, false
+	}
+	var out = make(map[string]float64)
+
+	for _, p := range databaseProperties {
+		if v, err := strconv.ParseUint(db.GetProperty(p.property), 10, 64); err == nil {
+			out[p.metric] = float64(v)
+		}
+	}
+
+	var files uint64
+	for level := 0; level != kMaxDatabaseLevels; level++ {
+		var prop = fmt.Sprintf("rocksdb.num-files-at-level%d", level)
+
+		if v, err := strconv.ParseUint(db.GetProperty(prop), 10, 64); err == nil {
+			files += v
+		}
+	}
+	out["live_sst_files"] = float64(files)
+
+	// Statistics are formatted as lines of "<ticker> COUNT : <value>".
+	var stats = parseDatabaseStatistics(db.options.GetStatisticsString())
+	for _, t := range databaseTickers {
+		if v, ok := stats[t.ticker]; ok {
+			out[t.metric] = v
+		}
+	}
+	return out, true
+}
+
+// parseDatabaseStatistics parses ticker counts of a RocksDB statistics string.
+func parseDatabaseStatistics(stats string) map[string]float64 {
+	var out = make(map[string]float64)
+
+	var s = bufio.NewScanner(strings.NewReader(stats))
+	for s.Scan() {
+		var fields = strings.Fields(s.Text())
+
+		if len(fields) != 4 || fields[1] != "COUNT" || fields[2] != ":" {
+			continue // Not a ticker (eg, a histogram).
+		} else if v, err := strconv.ParseUint(fields[3], 10, 64); err == nil {
+			out[fields[0]] = float64(v)
+		}
+	}
+	return out
+}
+
+// DatabaseCollector returns a prometheus.Collector of RocksDB properties and
+// statistics of each consumer database currently open in the process,
+// labeled by the recovery log of the database.
+func DatabaseCollector() prometheus.Collector { return openDatabases }
+
+type databaseCollector struct {
+	mu  sync.Mutex
+	dbs map[*database]struct{}
+
+	descs map[string]*prometheus.Desc
+}
+
+// openDatabases tracks databases opened by newDatabase, until teardown.
+var openDatabases = newDatabaseCollector()
+
+func newDatabaseCollector() *databaseCollector {
+	var c = &databaseCollector{
+		dbs:   make(map[*database]struct{}),
+		descs: make(map[string]*prometheus.Desc),
+	}
+	var add = func(metric, help string) {
+		c.descs[metric] = prometheus.NewDesc("gazette_consumer_rocksdb_"+metric,
+			help, []string{"recovery_log"}, nil)
+	}
+	for _, p := range databaseProperties {
+		add(p.metric, p.help)
+	}
+	for _, t := range databaseTickers {
+		add(t.metric, t.help)
+	}
+	add("live_sst_files", "Number of live SST files of the database.")
+
+	return c
+}
+
+func (c *databaseCollector) add(db *database) {
+	c.mu.Lock()
+	c.dbs[db] = struct{}{}
+	c.mu.Unlock()
+}
+
+func (c *databaseCollector) remove(db *database) {
+	c.mu.Lock()
+	delete(c.dbs, db)
+	c.mu.Unlock()
+}
+
+// Describe implements prometheus.Collector.
+func (c *databaseCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *databaseCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	var dbs = make([]*database, 0, len(c.dbs))
+	for db := range c.dbs {
+		dbs = append(dbs, db)
+	}
+	c.mu.Unlock()
+
+	for _, db := range dbs {
+		var props, ok = db.properties()
+		if !ok {
+			continue // Database is closed or is being torn down.
+		}
+		for metric, value := range props {
+			var valueType = prometheus.GaugeValue
+			if strings.HasSuffix(metric, "_total") {
+				valueType = prometheus.CounterValue
+			}
+			ch <- prometheus.MustNewConstMetric(c.descs[metric], valueType,
+				value, db.recoveryLog.String())
+		}
+	}
+}
@@ -3,12 +3,17 @@ package consumer
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
 	gc "github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/mock"
 	rocks "github.com/tecbot/gorocksdb"
 
 	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/metrics"
 	"github.com/LiveRamp/gazette/recoverylog"
 )
 
@@ -24,7 +29,8 @@ func (s *DatabaseSuite) TestDatabase(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 
 	var result = journal.AsyncAppend{
-		Ready: make(chan struct{}),
+		AppendResult: journal.AppendResult{WriteHead: 4567},
+		Ready:        make(chan struct{}),
 	}
 	close(result.Ready)
 
@@ -32,25 +38,37 @@ func (s *DatabaseSuite) TestDatabase(c *gc.C) {
 	writer.On("Write", logName, mock.AnythingOfType("[]uint8")).Return(&result, nil)
 	writer.On("ReadFrom", logName, mock.Anything).Return(&result, nil)
 
-	var opts = rocks.NewDefaultOptions()
+	var opts = newDefaultOptions()
 	defer opts.Destroy()
 
-	db, err := newDatabase(opts, fsm, path, writer)
+	db, err := newDatabase(opts, fsm, path, writer, nil)
 
 	// Expect that database operations are being replicated to |logName|.
 	c.Check(err, gc.IsNil)
 	c.Check(writer.Calls, gc.Not(gc.HasLen), 0)
+	c.Check(db.committedOffset(), gc.Equals, int64(-1))
 
 	// Populate the current transaction.
 	db.writeBatch.Put([]byte("foo"), []byte("bar"))
 	db.writeBatch.Put([]byte("baz"), []byte("quux"))
 	c.Check(db.writeBatch.Count(), gc.Equals, 2)
 
+	var commitBytes = func() uint64 {
+		var m dto.Metric
+		c.Assert(metrics.GazetteConsumerCommitBytes.Write(&m), gc.IsNil)
+		return m.GetHistogram().GetSampleCount()
+	}
+	var priorCommits = commitBytes()
+
 	// Commit. Expect |result| is passed through as a write barrier,
 	// and that writeBatch was flushed.
-	barrier, err := db.commit()
+	barrier, err := db.commit(map[journal.Name]int64{"a/journal": 1234})
 	c.Check(db.writeBatch.Count(), gc.Equals, 0)
 	c.Check(barrier, gc.Equals, &result)
+	// Expect the WriteHead of the resolved barrier is the committed offset.
+	c.Check(db.committedOffset(), gc.Equals, int64(4567))
+	// Expect the size of the write batch was observed.
+	c.Check(commitBytes(), gc.Equals, priorCommits+1)
 
 	// Values are now reflected in the database.
 	value, _ := db.GetBytes(db.readOptions, []byte("foo"))
@@ -58,7 +76,535 @@ func (s *DatabaseSuite) TestDatabase(c *gc.C) {
 	value, _ = db.GetBytes(db.readOptions, []byte("baz"))
 	c.Check(string(value), gc.Equals, "quux")
 
+	// As are committed offsets, which are updated by further commits.
+	offsets, err := db.checkpoint()
+	c.Check(err, gc.IsNil)
+	c.Check(offsets, gc.DeepEquals, map[journal.Name]int64{"a/journal": 1234})
+
+	_, err = db.commit(map[journal.Name]int64{"a/journal": 5678, "other/journal": 90})
+	c.Check(err, gc.IsNil)
+
+	offsets, err = db.checkpoint()
+	c.Check(err, gc.IsNil)
+	c.Check(offsets, gc.DeepEquals, map[journal.Name]int64{"a/journal": 5678, "other/journal": 90})
+
+	db.teardown()
+}
+
+func (s *DatabaseSuite) TestAbort(c *gc.C) {
+	path, err := ioutil.TempDir("", "database-suite")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(os.RemoveAll(path), gc.IsNil) }()
+
+	var logName journal.Name = "a/recovery/log"
+	fsm, err := recoverylog.NewFSM(recoverylog.FSMHints{Log: logName})
+	c.Assert(err, gc.IsNil)
+
+	var result = journal.AsyncAppend{
+		Ready: make(chan struct{}),
+	}
+	close(result.Ready)
+
+	var writer = &journal.MockWriter{}
+	writer.On("Write", logName, mock.AnythingOfType("[]uint8")).Return(&result, nil)
+	writer.On("ReadFrom", logName, mock.Anything).Return(&result, nil)
+
+	db, err := newDatabase(newDefaultOptions(), fsm, path, writer, nil)
+	c.Assert(err, gc.IsNil)
+
+	db.writeBatch.Put([]byte("foo"), []byte("bar"))
+	var calls = len(writer.Calls)
+
+	// Abort. Expect the writeBatch is cleared, and that nothing was written
+	// to the recovery log.
+	db.abort()
+	c.Check(db.writeBatch.Count(), gc.Equals, 0)
+	c.Check(writer.Calls, gc.HasLen, calls)
+
+	// A following transaction commits as usual, and doesn't include "foo".
+	db.writeBatch.Put([]byte("baz"), []byte("quux"))
+	_, err = db.commit(nil)
+	c.Check(err, gc.IsNil)
+
+	value, _ := db.GetBytes(db.readOptions, []byte("foo"))
+	c.Check(value, gc.IsNil)
+	value, _ = db.GetBytes(db.readOptions, []byte("baz"))
+	c.Check(string(value), gc.Equals, "quux")
+
+	db.teardown()
+}
+
+func (s *DatabaseSuite) TestReservedOptions(c *gc.C) {
+	path, err := ioutil.TempDir("", "database-suite")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(os.RemoveAll(path), gc.IsNil) }()
+
+	var logName journal.Name = "a/recovery/log"
+	fsm, err := recoverylog.NewFSM(recoverylog.FSMHints{Log: logName})
+	c.Assert(err, gc.IsNil)
+
+	var result = journal.AsyncAppend{
+		Ready: make(chan struct{}),
+	}
+	close(result.Ready)
+
+	var writer = &journal.MockWriter{}
+	writer.On("Write", logName, mock.AnythingOfType("[]uint8")).Return(&result, nil)
+	writer.On("ReadFrom", logName, mock.Anything).Return(&result, nil)
+
+	// A custom Env is replaced by the Env observed by the recovery log.
+	var env = rocks.NewMemEnv()
+	defer env.Destroy()
+
+	var opts = newDefaultOptions()
+	opts.SetEnv(env)
+
+	db, err := newDatabase(opts, fsm, path, writer, nil)
+	c.Assert(err, gc.IsNil)
+	c.Check(writer.Calls, gc.Not(gc.HasLen), 0)
+
+	_, err = os.Stat(filepath.Join(path, "CURRENT"))
+	c.Check(err, gc.IsNil)
+	db.teardown()
+
+	// MaxManifestFileSize defaults if not set, and may not exceed its maximum.
+	for _, fixture := range []struct {
+		size, expect uint64
+		err          string
+	}{
+		{0, kDefaultMaxManifestFileSize, ""},
+		{1 << 20, 1 << 20, ""},
+		{kMaxManifestFileSize, kMaxManifestFileSize, ""},
+		{kMaxManifestFileSize + 1, 0, "MaxManifestFileSize 67108865 exceeds the maximum of 67108864"},
+	} {
+		var size, err = maxManifestFileSize(fixture.size)
+		c.Check(size, gc.Equals, fixture.expect)
+
+		if fixture.err == "" {
+			c.Check(err, gc.IsNil)
+		} else {
+			c.Check(err, gc.ErrorMatches, fixture.err)
+		}
+	}
+}
+
+func (s *DatabaseSuite) TestTransactionWriteOptions(c *gc.C) {
+	path, err := ioutil.TempDir("", "database-suite")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(os.RemoveAll(path), gc.IsNil) }()
+
+	var logName journal.Name = "a/recovery/log"
+	fsm, err := recoverylog.NewFSM(recoverylog.FSMHints{Log: logName})
+	c.Assert(err, gc.IsNil)
+
+	var result = journal.AsyncAppend{
+		Ready: make(chan struct{}),
+	}
+	close(result.Ready)
+
+	var writer = &journal.MockWriter{}
+	writer.On("Write", logName, mock.AnythingOfType("[]uint8")).Return(&result, nil)
+	writer.On("ReadFrom", logName, mock.Anything).Return(&result, nil)
+
+	db, err := newDatabase(newDefaultOptions(), fsm, path, writer, nil)
+	c.Assert(err, gc.IsNil)
+
+	// Returns the number of write barriers issued to the recovery log by |fn|.
+	var barriers = func(fn func()) int {
+		var count, calls = 0, len(writer.Calls)
+		fn()
+
+		for _, call := range writer.Calls[calls:] {
+			if call.Method == "Write" && call.Arguments.Get(1).([]byte) == nil {
+				count++
+			}
+		}
+		return count
+	}
+	var commit = func() {
+		db.writeBatch.Put([]byte("foo"), []byte("bar"))
+		var _, err = db.commit(nil)
+		c.Check(err, gc.IsNil)
+	}
+
+	// By default, a commit issues only its commit barrier.
+	c.Check(barriers(commit), gc.Equals, 1)
+
+	// A transaction may opt into a synced write, which is implemented as an
+	// additional barrier of the recovery log.
+	var synced = rocks.NewDefaultWriteOptions()
+	defer synced.Destroy()
+	synced.SetSync(true)
+
+	db.txWriteOptions = synced
+	c.Check(barriers(commit), gc.Not(gc.Equals), 1)
+	c.Check(db.txWriteOptions, gc.IsNil)
+
+	// The following transaction again uses default options.
+	c.Check(barriers(commit), gc.Equals, 1)
+
+	// Options of an aborted transaction are also discarded.
+	db.txWriteOptions = synced
+	db.writeBatch.Put([]byte("foo"), []byte("bar"))
+	db.abort()
+	c.Check(db.txWriteOptions, gc.IsNil)
+
+	c.Check(barriers(commit), gc.Equals, 1)
+
+	db.teardown()
+}
+
+func (s *DatabaseSuite) TestTransactionSizeLimit(c *gc.C) {
+	path, err := ioutil.TempDir("", "database-suite")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(os.RemoveAll(path), gc.IsNil) }()
+
+	var logName journal.Name = "a/recovery/log"
+	fsm, err := recoverylog.NewFSM(recoverylog.FSMHints{Log: logName})
+	c.Assert(err, gc.IsNil)
+
+	var result = journal.AsyncAppend{
+		Ready: make(chan struct{}),
+	}
+	close(result.Ready)
+
+	var writer = &journal.MockWriter{}
+	writer.On("Write", logName, mock.AnythingOfType("[]uint8")).Return(&result, nil)
+	writer.On("ReadFrom", logName, mock.Anything).Return(&result, nil)
+
+	db, err := newDatabase(newDefaultOptions(), fsm, path, writer, nil)
+	c.Assert(err, gc.IsNil)
+	defer db.teardown()
+
+	// Unbounded by default.
+	db.writeBatch.Put([]byte("key"), make([]byte, 1024))
+	c.Check(db.checkTransaction(), gc.IsNil)
+
+	// The serialized batch includes a 12-byte header, as well as a tag and
+	// length prefixes of each mutation, and is larger than its keys & values.
+	var size = int64(len(db.writeBatch.Data()))
+	c.Check(size > 3+1024, gc.Equals, true)
+
+	db.maxTransactionBytes = size
+	c.Check(db.checkTransaction(), gc.IsNil)
+
+	db.writeBatch.Put([]byte("k"), nil)
+	c.Check(db.checkTransaction(), gc.Equals, ErrTransactionTooLarge)
+
+	// The rejected transaction is left intact.
+	c.Check(db.writeBatch.Count(), gc.Equals, 2)
+
+	// Once aborted, a following transaction may commit.
+	db.abort()
+	c.Check(db.checkTransaction(), gc.IsNil)
+
+	db.writeBatch.Put([]byte("other-key"), []byte("value"))
+	c.Check(db.checkTransaction(), gc.IsNil)
+	_, err = db.commit(nil)
+	c.Check(err, gc.IsNil)
+}
+
+func (s *DatabaseSuite) TestCompact(c *gc.C) {
+	path, err := ioutil.TempDir("", "database-suite")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(os.RemoveAll(path), gc.IsNil) }()
+
+	var logName journal.Name = "a/recovery/log"
+	fsm, err := recoverylog.NewFSM(recoverylog.FSMHints{Log: logName})
+	c.Assert(err, gc.IsNil)
+
+	var result = journal.AsyncAppend{
+		Ready: make(chan struct{}),
+	}
+	close(result.Ready)
+
+	var writer = &journal.MockWriter{}
+	writer.On("Write", logName, mock.AnythingOfType("[]uint8")).Return(&result, nil)
+	writer.On("ReadFrom", logName, mock.Anything).Return(&result, nil)
+
+	db, err := newDatabase(newDefaultOptions(), fsm, path, writer, []string{"index"})
+	c.Assert(err, gc.IsNil)
+
+	db.writeBatch.Put([]byte("foo"), []byte("bar"))
+	db.writeBatch.PutCF(db.columnFamilies["index"], []byte("baz"), []byte("quux"))
+	_, err = db.commit(nil)
+	c.Check(err, gc.IsNil)
+
+	// Returns the first hinted sequence number of any live Fnode.
+	var firstHintedSeqNo = func() int64 {
+		var first int64 = -1
+		for _, node := range db.recorder.BuildHints().LiveNodes {
+			for _, segment := range node.Segments {
+				if first == -1 || segment.FirstSeqNo < first {
+					first = segment.FirstSeqNo
+				}
+			}
+		}
+		return first
+	}
+	var before = firstHintedSeqNo()
+
+	// Compact. Expect the hinted horizon moved forward, as files created when
+	// the database was first opened are no longer live.
+	c.Check(db.compact(), gc.IsNil)
+	c.Check(firstHintedSeqNo() > before, gc.Equals, true)
+
+	// Content of all column families remains readable.
+	value, _ := db.GetBytes(db.readOptions, []byte("foo"))
+	c.Check(string(value), gc.Equals, "bar")
+	slice, err := db.GetCF(db.readOptions, db.columnFamilies["index"], []byte("baz"))
+	c.Check(err, gc.IsNil)
+	c.Check(string(slice.Data()), gc.Equals, "quux")
+	slice.Free()
+
+	db.teardown()
+}
+
+func (s *DatabaseSuite) TestProperties(c *gc.C) {
+	path, err := ioutil.TempDir("", "database-suite")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(os.RemoveAll(path), gc.IsNil) }()
+
+	var logName journal.Name = "a/recovery/log"
+	fsm, err := recoverylog.NewFSM(recoverylog.FSMHints{Log: logName})
+	c.Assert(err, gc.IsNil)
+
+	var result = journal.AsyncAppend{
+		Ready: make(chan struct{}),
+	}
+	close(result.Ready)
+
+	var writer = &journal.MockWriter{}
+	writer.On("Write", logName, mock.AnythingOfType("[]uint8")).Return(&result, nil)
+	writer.On("ReadFrom", logName, mock.Anything).Return(&result, nil)
+
+	var opts = newDefaultOptions()
+	opts.EnableStatistics()
+
+	db, err := newDatabase(opts, fsm, path, writer, nil)
+	c.Assert(err, gc.IsNil)
+
+	db.writeBatch.Put([]byte("foo"), []byte("bar"))
+	_, err = db.commit(nil)
+	c.Check(err, gc.IsNil)
+
+	props, ok := db.properties()
+	c.Check(ok, gc.Equals, true)
+	c.Check(props["estimated_keys"] >= 1, gc.Equals, true)
+	c.Check(props["memtable_bytes"] > 0, gc.Equals, true)
+	for _, metric := range []string{"live_sst_files", "block_cache_hit_total"} {
+		_, ok = props[metric]
+		c.Check(ok, gc.Equals, true, gc.Commentf(metric))
+	}
+
+	// Expect the collector produces metrics of the open database.
+	var collect = func() (n int) {
+		var ch = make(chan prometheus.Metric, 100)
+		DatabaseCollector().Collect(ch)
+		close(ch)
+
+		for m := range ch {
+			var out dto.Metric
+			c.Check(m.Write(&out), gc.IsNil)
+
+			if out.GetLabel()[0].GetValue() == logName.String() {
+				n++
+			}
+		}
+		return
+	}
+	c.Check(collect(), gc.Equals, len(props))
+
+	// A database which is mid-compaction (or teardown) is skipped.
+	var rdb = db.DB
+	db.DB = nil
+	_, ok = db.properties()
+	c.Check(ok, gc.Equals, false)
+	c.Check(collect(), gc.Equals, 0)
+	db.DB = rdb
+
+	// After teardown, the database is no longer collected.
 	db.teardown()
+	c.Check(collect(), gc.Equals, 0)
+}
+
+func (s *DatabaseSuite) TestParseStatistics(c *gc.C) {
+	c.Check(parseDatabaseStatistics(`rocksdb.block.cache.miss COUNT : 12
+rocksdb.block.cache.hit COUNT : 34
+rocksdb.db.get.micros P50 : 1.0 P95 : 2.0 P99 : 3.0 P100 : 4.0 COUNT : 5 SUM : 6
+`), gc.DeepEquals, map[string]float64{
+		"rocksdb.block.cache.miss": 12,
+		"rocksdb.block.cache.hit":  34,
+	})
+	c.Check(parseDatabaseStatistics(""), gc.HasLen, 0)
+}
+
+func (s *DatabaseSuite) TestWaitForCommit(c *gc.C) {
+	var db = &database{}
+	db.waitForCommit() // No commit has been made. Doesn't block.
+
+	db.lastBarrier = &journal.AsyncAppend{Ready: make(chan struct{})}
+
+	var doneCh = make(chan struct{})
+	go func() {
+		db.waitForCommit()
+		close(doneCh)
+	}()
+
+	select {
+	case <-doneCh:
+		c.Error("expected waitForCommit to block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Resolve the barrier. Expect waitForCommit returns.
+	close(db.lastBarrier.Ready)
+	<-doneCh
+}
+
+func (s *DatabaseSuite) TestCommittedOffset(c *gc.C) {
+	var db = &database{committed: -1}
+	c.Check(db.committedOffset(), gc.Equals, int64(-1))
+
+	// A pending barrier doesn't update the committed offset.
+	db.lastBarrier = &journal.AsyncAppend{
+		AppendResult: journal.AppendResult{WriteHead: 1234},
+		Ready:        make(chan struct{}),
+	}
+	c.Check(db.committedOffset(), gc.Equals, int64(-1))
+
+	close(db.lastBarrier.Ready)
+	c.Check(db.committedOffset(), gc.Equals, int64(1234))
+
+	// Nor does a barrier which failed.
+	db.lastBarrier = &journal.AsyncAppend{
+		AppendResult: journal.AppendResult{Error: journal.ErrNotBroker, WriteHead: 5678},
+		Ready:        make(chan struct{}),
+	}
+	close(db.lastBarrier.Ready)
+	c.Check(db.committedOffset(), gc.Equals, int64(1234))
+}
+
+func (s *DatabaseSuite) TestOrderBarrier(c *gc.C) {
+	var newBarrier = func(writeHead int64, err error) *journal.AsyncAppend {
+		return &journal.AsyncAppend{
+			AppendResult: journal.AppendResult{Error: err, WriteHead: writeHead},
+			Ready:        make(chan struct{}),
+		}
+	}
+	var isReady = func(b *journal.AsyncAppend) bool {
+		select {
+		case <-b.Ready:
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}
+
+	// A barrier following a successfully resolved one is returned as-is.
+	var prior, barrier = newBarrier(1234, nil), newBarrier(5678, nil)
+	close(prior.Ready)
+	c.Check(orderBarrier(prior, barrier), gc.Equals, barrier)
+
+	// A barrier which resolves before a pending prior barrier is ordered after it.
+	prior, barrier = newBarrier(1234, nil), newBarrier(5678, nil)
+	var ordered = orderBarrier(prior, barrier)
+
+	close(barrier.Ready)
+	c.Check(isReady(ordered), gc.Equals, false)
+
+	close(prior.Ready)
+	c.Check(isReady(ordered), gc.Equals, true)
+	c.Check(ordered.AppendResult, gc.Equals, journal.AppendResult{WriteHead: 5678})
+
+	// Failure of a prior barrier fails following ones, transitively.
+	prior, barrier = newBarrier(1234, journal.ErrNotBroker), newBarrier(5678, nil)
+	ordered = orderBarrier(prior, barrier)
+	var next = newBarrier(9012, nil)
+	var orderedNext = orderBarrier(ordered, next)
+
+	close(barrier.Ready)
+	close(next.Ready)
+	c.Check(isReady(orderedNext), gc.Equals, false)
+
+	close(prior.Ready)
+	c.Check(isReady(ordered), gc.Equals, true)
+	c.Check(ordered.Error, gc.Equals, ErrPriorCommitFailed)
+	c.Check(isReady(orderedNext), gc.Equals, true)
+	c.Check(orderedNext.Error, gc.Equals, ErrPriorCommitFailed)
+
+	// A failed barrier retains its own error.
+	prior, barrier = newBarrier(1234, journal.ErrNotBroker), newBarrier(5678, journal.ErrNotFound)
+	close(prior.Ready)
+	close(barrier.Ready)
+	ordered = orderBarrier(prior, barrier)
+	c.Check(isReady(ordered), gc.Equals, true)
+	c.Check(ordered.Error, gc.Equals, journal.ErrNotFound)
+}
+
+func (s *DatabaseSuite) TestColumnFamilies(c *gc.C) {
+	path, err := ioutil.TempDir("", "database-suite")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(os.RemoveAll(path), gc.IsNil) }()
+
+	var logName journal.Name = "a/recovery/log"
+	fsm, err := recoverylog.NewFSM(recoverylog.FSMHints{Log: logName})
+	c.Assert(err, gc.IsNil)
+
+	var result = journal.AsyncAppend{
+		Ready: make(chan struct{}),
+	}
+	close(result.Ready)
+
+	var writer = &journal.MockWriter{}
+	writer.On("Write", logName, mock.AnythingOfType("[]uint8")).Return(&result, nil)
+	writer.On("ReadFrom", logName, mock.Anything).Return(&result, nil)
+
+	db, err := newDatabase(newDefaultOptions(), fsm, path, writer, []string{"index"})
+	c.Assert(err, gc.IsNil)
+
+	var index = db.columnFamilies["index"]
+	c.Assert(index, gc.NotNil)
+	c.Check(db.columnFamilies[kDefaultColumnFamily], gc.NotNil)
+
+	// Write to both the default & "index" column families within a transaction.
+	db.writeBatch.Put([]byte("foo"), []byte("data"))
+	db.writeBatch.PutCF(index, []byte("foo"), []byte("index"))
+
+	_, err = db.commit(nil)
+	c.Check(err, gc.IsNil)
+
+	value, _ := db.GetBytes(db.readOptions, []byte("foo"))
+	c.Check(string(value), gc.Equals, "data")
+
+	slice, err := db.GetCF(db.readOptions, index, []byte("foo"))
+	c.Check(err, gc.IsNil)
+	c.Check(string(slice.Data()), gc.Equals, "index")
+	slice.Free()
+
+	db.teardown()
+
+	// Re-open the database files directly (as would a recovered replica, which
+	// plays back the same MANIFEST). Expect the column family is listed and
+	// re-opened, even though it's not requested, and that a newly requested
+	// column family is created.
+	var opts, ro = rocks.NewDefaultOptions(), rocks.NewDefaultReadOptions()
+	defer opts.Destroy()
+	defer ro.Destroy()
+
+	rdb, columnFamilies, err := openColumnFamilies(opts, path, []string{"other"})
+	c.Assert(err, gc.IsNil)
+	c.Check(columnFamilies, gc.HasLen, 3)
+
+	slice, err = rdb.GetCF(ro, columnFamilies["index"], []byte("foo"))
+	c.Check(err, gc.IsNil)
+	c.Check(string(slice.Data()), gc.Equals, "index")
+	slice.Free()
+
+	for _, handle := range columnFamilies {
+		handle.Destroy()
+	}
+	rdb.Close()
 }
 
 var _ = gc.Suite(&DatabaseSuite{})
@@ -0,0 +1,181 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/cockroachdb/cockroach/util/encoding"
+	log "github.com/sirupsen/logrus"
+	rocks "github.com/tecbot/gorocksdb"
+
+	"github.com/LiveRamp/gazette/topic"
+)
+
+const (
+	// Number of sequence numbers, preceding the greatest consumed sequence of
+	// a producer, for which the deduplicator tracks whether each was consumed.
+	dedupWindowSize = 64
+	// Producers which haven't been consumed from within this interval are
+	// forgotten when the deduplicator is next loaded.
+	dedupProducerTTL = 30 * 24 * time.Hour
+)
+
+// Prefix of reserved database keys under which deduplicator states of
+// producers are stored.
+var producerStatePrefix = encoding.EncodeStringAscending(encoding.EncodeNullAscending(nil), "producer-states")
+
+// deduplicator identifies duplicate messages of a Shard by their topic.Stamp.
+// For each producer, it tracks the greatest consumed sequence number, and a
+// window of which preceding sequence numbers were also consumed. A stamped
+// message is a duplicate if its sequence was already consumed, or if it
+// precedes the window (as it's then presumed to have been consumed). Messages
+// of a producer may therefore be re-ordered by up to dedupWindowSize
+// sequences, as can happen with concurrent writes of a producer.
+//
+// Producer states are stored in the Shard database within each transaction,
+// and are thus committed atomically with consumed offsets: a recovered Shard
+// which re-reads messages of an uncommitted transaction doesn't treat them as
+// duplicates, while messages which were committed and then re-written by a
+// retrying producer are. Reserved keys aren't copied from further parents of
+// a merged Shard, so deduplication of a merged Shard begins from the states
+// of its first parent.
+type deduplicator struct {
+	producers map[topic.ProducerID]*producerState
+	// Producers modified since the last store, and keys of producer states
+	// which expired at load.
+	dirty   map[topic.ProducerID]struct{}
+	expired [][]byte
+
+	timeNow func() time.Time
+}
+
+// producerState is the deduplicator state of a single producer.
+type producerState struct {
+	// Greatest consumed sequence number.
+	last uint64
+	// Bit i is set if sequence |last - i| was consumed.
+	window uint64
+	// Time at which the state was last stored.
+	updated time.Time
+}
+
+func newDeduplicator() *deduplicator {
+	return &deduplicator{
+		producers: make(map[topic.ProducerID]*producerState),
+		dirty:     make(map[topic.ProducerID]struct{}),
+		timeNow:   time.Now,
+	}
+}
+
+// load producer states of |db|. States which haven't been updated within
+// dedupProducerTTL are removed by the next store.
+func (d *deduplicator) load(db *rocks.DB, ro *rocks.ReadOptions) error {
+	var expireBefore = d.timeNow().Add(-dedupProducerTTL)
+
+	var it = db.NewIterator(ro)
+	defer it.Close()
+
+	for it.Seek(producerStatePrefix); it.ValidForPrefix(producerStatePrefix); it.Next() {
+		var k, v = it.Key(), it.Value()
+		var key = append([]byte(nil), k.Data()...)
+		var value = append([]byte(nil), v.Data()...)
+		k.Free()
+		v.Free()
+
+		var producer, state, err = decodeProducerState(key, value)
+		if err != nil {
+			return err
+		} else if state.updated.Before(expireBefore) {
+			d.expired = append(d.expired, key)
+			continue
+		}
+		d.producers[producer] = state
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	if len(d.producers) != 0 || len(d.expired) != 0 {
+		log.WithFields(log.Fields{"producers": len(d.producers), "expired": len(d.expired)}).
+			Info("loaded producer states")
+	}
+	return nil
+}
+
+// isDuplicate returns whether a message of |stamp| was already consumed, and
+// otherwise marks it as consumed.
+func (d *deduplicator) isDuplicate(stamp topic.Stamp) bool {
+	var state, ok = d.producers[stamp.Producer]
+	if !ok {
+		state = new(producerState)
+		d.producers[stamp.Producer] = state
+	}
+
+	if seq := stamp.Sequence; seq > state.last {
+		if shift := seq - state.last; shift >= dedupWindowSize {
+			state.window = 1
+		} else {
+			state.window = state.window<<shift | 1
+		}
+		state.last = seq
+	} else if delta := state.last - seq; delta >= dedupWindowSize {
+		return true // Precedes the window.
+	} else if bit := uint64(1) << delta; state.window&bit != 0 {
+		return true
+	} else {
+		state.window |= bit
+	}
+
+	d.dirty[stamp.Producer] = struct{}{}
+	return false
+}
+
+// store adds producer states modified since the last store to |wb|.
+func (d *deduplicator) store(wb *rocks.WriteBatch) {
+	for _, key := range d.expired {
+		wb.Delete(key)
+	}
+	d.expired = nil
+
+	var now = d.timeNow()
+	for producer := range d.dirty {
+		var state = d.producers[producer]
+		state.updated = now
+
+		wb.Put(producerStateKey(producer), encodeProducerState(state))
+		delete(d.dirty, producer)
+	}
+}
+
+// producerStateKey returns the reserved database key of |producer|.
+func producerStateKey(producer topic.ProducerID) []byte {
+	return encoding.EncodeBytesAscending(append([]byte(nil), producerStatePrefix...), producer[:])
+}
+
+func encodeProducerState(state *producerState) []byte {
+	var b = encoding.EncodeUvarintAscending(nil, state.last)
+	b = encoding.EncodeUint64Ascending(b, state.window)
+	return encoding.EncodeVarintAscending(b, state.updated.Unix())
+}
+
+func decodeProducerState(key, value []byte) (topic.ProducerID, *producerState, error) {
+	var producer topic.ProducerID
+	var state = new(producerState)
+
+	var _, id, err = encoding.DecodeBytesAscending(key[len(producerStatePrefix):], nil)
+	if err != nil {
+		return producer, nil, err
+	}
+	copy(producer[:], id)
+
+	var updated int64
+	if value, state.last, err = encoding.DecodeUvarintAscending(value); err != nil {
+		return producer, nil, err
+	} else if value, state.window, err = encoding.DecodeUint64Ascending(value); err != nil {
+		return producer, nil, err
+	} else if _, updated, err = encoding.DecodeVarintAscending(value); err != nil {
+		return producer, nil, err
+	}
+	state.updated = time.Unix(updated, 0)
+
+	return producer, state, nil
+}
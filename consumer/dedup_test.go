@@ -0,0 +1,112 @@
+package consumer
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	gc "github.com/go-check/check"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/recoverylog"
+	"github.com/LiveRamp/gazette/topic"
+)
+
+type DedupSuite struct{}
+
+func (s *DedupSuite) TestWindow(c *gc.C) {
+	var d = newDeduplicator()
+	var stamp = func(seq uint64) topic.Stamp {
+		return topic.Stamp{Producer: topic.ProducerID{1}, Sequence: seq}
+	}
+
+	c.Check(d.isDuplicate(stamp(1)), gc.Equals, false)
+	c.Check(d.isDuplicate(stamp(3)), gc.Equals, false)
+	c.Check(d.isDuplicate(stamp(1)), gc.Equals, true)
+	c.Check(d.isDuplicate(stamp(3)), gc.Equals, true)
+
+	// A re-ordered sequence within the window is not a duplicate, once.
+	c.Check(d.isDuplicate(stamp(2)), gc.Equals, false)
+	c.Check(d.isDuplicate(stamp(2)), gc.Equals, true)
+
+	// Sequences of other producers are tracked independently.
+	c.Check(d.isDuplicate(topic.Stamp{Producer: topic.ProducerID{2}, Sequence: 2}), gc.Equals, false)
+
+	// Advance such that sequence 4 is at the trailing edge of the window.
+	c.Check(d.isDuplicate(stamp(4+dedupWindowSize-1)), gc.Equals, false)
+	c.Check(d.isDuplicate(stamp(3)), gc.Equals, true) // Precedes the window.
+	c.Check(d.isDuplicate(stamp(4)), gc.Equals, false)
+	c.Check(d.isDuplicate(stamp(4)), gc.Equals, true)
+
+	// Advance beyond the entire window.
+	c.Check(d.isDuplicate(stamp(1000)), gc.Equals, false)
+	c.Check(d.isDuplicate(stamp(999)), gc.Equals, false)
+	c.Check(d.isDuplicate(stamp(1000)), gc.Equals, true)
+	c.Check(d.isDuplicate(stamp(1000-dedupWindowSize)), gc.Equals, true)
+}
+
+func (s *DedupSuite) TestStoreAndLoad(c *gc.C) {
+	path, err := ioutil.TempDir("", "dedup-suite")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Assert(os.RemoveAll(path), gc.IsNil) }()
+
+	var logName journal.Name = "a/recovery/log"
+	fsm, err := recoverylog.NewFSM(recoverylog.FSMHints{Log: logName})
+	c.Assert(err, gc.IsNil)
+
+	var result = journal.AsyncAppend{Ready: make(chan struct{})}
+	close(result.Ready)
+
+	var writer = &journal.MockWriter{}
+	writer.On("Write", logName, mock.AnythingOfType("[]uint8")).Return(&result, nil)
+	writer.On("ReadFrom", logName, mock.Anything).Return(&result, nil)
+
+	db, err := newDatabase(newDefaultOptions(), fsm, path, writer, nil)
+	c.Assert(err, gc.IsNil)
+	defer db.teardown()
+
+	var now = time.Unix(1500000000, 0)
+	var live, stale = topic.ProducerID{1}, topic.ProducerID{2}
+
+	var d = newDeduplicator()
+	d.timeNow = func() time.Time { return now }
+
+	d.isDuplicate(topic.Stamp{Producer: live, Sequence: 10})
+	d.isDuplicate(topic.Stamp{Producer: live, Sequence: 8})
+	d.isDuplicate(topic.Stamp{Producer: stale, Sequence: 5})
+
+	d.store(db.writeBatch)
+	c.Check(db.writeBatch.Count(), gc.Equals, 2)
+	_, err = db.commit(nil)
+	c.Check(err, gc.IsNil)
+
+	// Only producers modified since the last store are stored.
+	now = now.Add(dedupProducerTTL + time.Second)
+	d.isDuplicate(topic.Stamp{Producer: live, Sequence: 11})
+
+	d.store(db.writeBatch)
+	c.Check(db.writeBatch.Count(), gc.Equals, 1)
+	_, err = db.commit(nil)
+	c.Check(err, gc.IsNil)
+
+	// Expect states are loaded, and that the stale producer has expired.
+	var loaded = newDeduplicator()
+	loaded.timeNow = d.timeNow
+	c.Assert(loaded.load(db.DB, db.readOptions), gc.IsNil)
+
+	c.Check(loaded.producers, gc.HasLen, 1)
+	c.Check(loaded.producers[live].last, gc.Equals, uint64(11))
+	c.Check(loaded.producers[live].window, gc.Equals, uint64(0xb)) // 11, 10, & 8.
+	c.Check(loaded.producers[live].updated.Equal(now), gc.Equals, true)
+
+	c.Check(loaded.isDuplicate(topic.Stamp{Producer: live, Sequence: 8}), gc.Equals, true)
+	c.Check(loaded.isDuplicate(topic.Stamp{Producer: live, Sequence: 9}), gc.Equals, false)
+
+	// The expired producer state is removed by the next store.
+	loaded.store(db.writeBatch)
+	c.Check(db.writeBatch.Count(), gc.Equals, 2)
+	c.Check(loaded.expired, gc.HasLen, 0)
+}
+
+var _ = gc.Suite(&DedupSuite{})
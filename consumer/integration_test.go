@@ -9,8 +9,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
+	"os"
 	"strconv"
 	"testing"
 	"time"
@@ -53,6 +55,9 @@ const (
 	consumerRoot               = "/tests/ConsumerSuite"
 )
 
+// Recovery log of databases recorded directly by tests.
+const abortRecoveryLog journal.Name = "pippio-journals/integration-tests/abort-recovery-log"
+
 func init() {
 	addSubTopic.Partitions = topic.EnumeratePartitions(addSubTopic.Name, 4)
 	addSubTopic.MappedPartition = topic.ModuloPartitionMapping(addSubTopic.Partitions,
@@ -299,6 +304,68 @@ func (s *ConsumerSuite) TestMasterWritesLastReadHints(c *gc.C) {
 	keysAPI.Delete(context.Background(), hintsPath(consumerRoot, sid)+".lastRecovered", nil)
 }
 
+func (s *ConsumerSuite) TestAbortedTransactionIsNotRecovered(c *gc.C) {
+	var err = s.gazette.Create(abortRecoveryLog)
+	if err != journal.ErrExists {
+		c.Assert(err, gc.IsNil)
+	}
+
+	// Open a database which records from the current recovery log head.
+	fsm, err := recoverylog.NewFSM(recoverylog.FSMHints{Log: abortRecoveryLog})
+	c.Assert(err, gc.IsNil)
+
+	dir, err := ioutil.TempDir("", "abort-recorded")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(dir)
+
+	db, err := newDatabase(newDefaultOptions(), fsm, dir, s.gazette, nil)
+	c.Assert(err, gc.IsNil)
+
+	db.writeBatch.Put([]byte("committed"), []byte("one"))
+	_, err = db.commit(nil)
+	c.Assert(err, gc.IsNil)
+
+	db.writeBatch.Put([]byte("aborted"), []byte("two"))
+	db.abort()
+
+	db.writeBatch.Put([]byte("also-committed"), []byte("three"))
+	barrier, err := db.commit(map[journal.Name]int64{addSubOutput: 1234})
+	c.Assert(err, gc.IsNil)
+	<-barrier.Ready
+
+	var hints = db.recorder.BuildHints()
+	db.teardown()
+
+	// Recover a fresh replica from |hints|, and expect it observes only
+	// committed keys.
+	recoveredDir, err := ioutil.TempDir("", "abort-recovered")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(recoveredDir)
+
+	player, err := recoverylog.NewPlayer(hints, recoveredDir)
+	c.Assert(err, gc.IsNil)
+	go func() { c.Check(player.Play(s.gazette), gc.IsNil) }()
+
+	fsm, _, err = player.MakeLive()
+	c.Assert(err, gc.IsNil)
+
+	db, err = newDatabase(newDefaultOptions(), fsm, recoveredDir, s.gazette, nil)
+	c.Assert(err, gc.IsNil)
+	defer db.teardown()
+
+	var expect = map[string]string{"committed": "one", "also-committed": "three", "aborted": ""}
+	for key, value := range expect {
+		var b, err = db.GetBytes(db.readOptions, []byte(key))
+		c.Check(err, gc.IsNil)
+		c.Check(string(b), gc.Equals, value)
+	}
+
+	// Expect the recovered database also describes its consumption checkpoint.
+	offsets, err := db.checkpoint()
+	c.Check(err, gc.IsNil)
+	c.Check(offsets, gc.DeepEquals, map[journal.Name]int64{addSubOutput: 1234})
+}
+
 func (s *ConsumerSuite) buildRunner(i, replicas int) *Runner {
 	return &Runner{
 		Consumer:        new(testConsumer),
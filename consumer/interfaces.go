@@ -34,6 +34,11 @@ type Shard interface {
 
 	// Returns the database of the Shard.
 	Database() *rocks.DB
+	// Returns the named column family of the database, or nil if the column
+	// family doesn't exist. Column families are declared by ColumnFamilyIniter.
+	// Reads and writes (including those of the Transaction) may target a
+	// column family through the *CF variants of database and WriteBatch methods.
+	ColumnFamily(name string) *rocks.ColumnFamilyHandle
 
 	// Current Transaction of the consumer shard. All writes issued through
 	// Transaction will commit atomically and be check-pointed with consumed
@@ -44,10 +49,69 @@ type Shard interface {
 	// example, because a Shard is recovered to a state after a write was applied
 	// but before corresponding Journal offsets were written).
 	Transaction() *rocks.WriteBatch
+	// Discards all writes of the current Transaction. The writes are never
+	// applied to the database nor recorded to the recovery log. Note that
+	// Journal offsets consumed by the transaction are still check-pointed with
+	// the next commit: a consumer which aborts is rejecting the input it has
+	// consumed thus far. To instead re-process input from the last committed
+	// offsets, return an error from Consume or Flush.
+	AbortTransaction()
+	// Returns ErrTransactionTooLarge if the serialized size of the current
+	// Transaction exceeds Runner.MaxTransactionBytes. Consumers which may
+	// build large transactions can check as they add writes, and react before
+	// the Runner fails the Shard upon the return of Consume or Flush. The
+	// Transaction is left intact, and may be inspected, but must be reduced
+	// (eg, by AbortTransaction) to be committed. As mutations can't be removed
+	// from a WriteBatch, consumers which wish to split large updates across
+	// transactions should hold them in the Shard Cache, and add them to
+	// Transaction only as its size permits.
+	CheckTransaction() error
 
 	// Returns initialized read and write options for the database.
 	ReadOptions() *rocks.ReadOptions
 	WriteOptions() *rocks.WriteOptions
+	// Sets WriteOptions used to commit the current Transaction, in place of
+	// WriteOptions(). The following Transaction again uses WriteOptions(). The
+	// caller retains ownership of |options|, which must remain valid through
+	// the commit. Durability of a Shard is provided by the recovery log: a
+	// Transaction is durable once its commit barrier resolves, regardless of
+	// options. Setting Sync additionally syncs the RocksDB WAL, which the
+	// recovery log Recorder implements as a write barrier of the log, adding
+	// a log round-trip to the commit without strengthening durability. It's
+	// useful only where local database files must themselves be durable (eg,
+	// prior to an external backup of the database directory). DisableWAL must
+	// not be set: the Transaction would then not be recorded to the recovery
+	// log until a later memtable flush, and a recovered Shard would lack it.
+	SetTransactionWriteOptions(options *rocks.WriteOptions)
+	// Returns read options for reads which must reflect only state which is
+	// durably committed to the recovery log. By default, a read issued just
+	// after a commit may observe the committed transaction before its commit
+	// barrier has resolved, and a Shard recovered after a failure could then
+	// lack state the read observed. CommittedReadOptions instead blocks until
+	// the commit barrier of the last transaction resolves, which adds up to a
+	// recovery log round-trip of latency to the read. Reads using
+	// ReadOptions() are unaffected. Note that writes made directly to the
+	// database (rather than through Transaction) are observed by either mode
+	// immediately, and are not covered by this guarantee.
+	CommittedReadOptions() *rocks.ReadOptions
+	// Returns the recovery log offset through which transactions of the Shard
+	// are durably committed: the write head which followed the commit barrier
+	// of the most recent resolved transaction, or -1 if no transaction has yet
+	// committed. Consumers may record it (eg, as an external checkpoint) without
+	// issuing further requests of the recovery log.
+	CommittedOffset() int64
+
+	// Compacts the recovery log horizon of the database, which is the portion
+	// of the recovery log a recovering replica must play. The database is
+	// flushed and re-opened (rolling a new MANIFEST), and updated recovery
+	// hints are stored once the compaction has committed to the recovery log.
+	// Replicas which begin recovery from those hints play only the log written
+	// since the compaction. Previously stored hints are unaffected, and
+	// replicas already recovering continue to play from them. Compaction blocks
+	// the Shard while the database is flushed, and invalidates *rocks.DB and
+	// ColumnFamilyHandle instances previously returned by Database and
+	// ColumnFamily. It may be called only from InitShard, Consume, or Flush.
+	CompactRecoveryLog() error
 }
 
 type Consumer interface {
@@ -82,7 +146,32 @@ type ShardHalter interface {
 }
 
 // Optional Consumer interface for customization of Shard database options
-// prior to initial open.
+// prior to initial open. Implementations may tune any option (eg, block
+// cache, compaction style, bloom filters, or write buffer size) with the
+// exception of those reserved by the consumer for correct recovery, which
+// are applied after InitOptions and replace any values it sets. Env is always
+// an Env observed by the Shard's recovery log recorder: a custom Env is not
+// supported. CreateIfMissing is always true. MaxManifestFileSize bounds the
+// recovery log horizon, and is configured by Runner.MaxManifestFileSize.
 type OptionsIniter interface {
 	InitOptions(*rocks.Options)
 }
+
+// Optional Consumer interface for declaration of Shard database column
+// families, in addition to the default column family. Declared column
+// families are created if they don't exist, and are opened with the options
+// of the database. Column families are never dropped: a column family which
+// exists in a recovered database but is no longer declared remains open.
+type ColumnFamilyIniter interface {
+	InitColumnFamilies() []string
+}
+
+// Optional Consumer interface for mapping messages to a hash of their key,
+// which is required to split Shards (see Runner.SplitShard). A split Shard
+// consumes only messages of its Journal having a key hash within its
+// KeyRange, and skips others. KeyHash must be stable across processes, and
+// messages which read or modify common database state must have a common key
+// hash.
+type KeyHasher interface {
+	KeyHash(topic.Envelope) uint32
+}
@@ -0,0 +1,53 @@
+package consumer
+
+import (
+	rocks "github.com/tecbot/gorocksdb"
+)
+
+// SnapshotIterator is a rocks.Iterator bound to a database Snapshot. It
+// observes a single, consistent view of the database as of its creation, and
+// is unaffected by writes (or commits of concurrent transactions) which occur
+// while iterating. As consumer transactions are applied to the database as an
+// atomic WriteBatch, the view always reflects a transaction commit point.
+//
+// The Snapshot is pinned until the SnapshotIterator is closed, and Close must
+// be called to release it: a pinned Snapshot prevents compaction from dropping
+// overwritten or deleted values of SST files.
+type SnapshotIterator struct {
+	*rocks.Iterator
+
+	db       *rocks.DB
+	snapshot *rocks.Snapshot
+	options  *rocks.ReadOptions
+}
+
+// NewSnapshotIterator returns a SnapshotIterator of |db|. If |cf| is non-nil,
+// the iterator ranges over |cf|, and otherwise over the default column family.
+func NewSnapshotIterator(db *rocks.DB, cf *rocks.ColumnFamilyHandle) *SnapshotIterator {
+	var it = &SnapshotIterator{
+		db:       db,
+		snapshot: db.NewSnapshot(),
+		options:  rocks.NewDefaultReadOptions(),
+	}
+	it.options.SetSnapshot(it.snapshot)
+
+	if cf != nil {
+		it.Iterator = db.NewIteratorCF(it.options, cf)
+	} else {
+		it.Iterator = db.NewIterator(it.options)
+	}
+	return it
+}
+
+// Close closes the iterator and releases its Snapshot. Close may be called
+// multiple times, and calls after the first have no effect.
+func (it *SnapshotIterator) Close() {
+	if it.Iterator == nil {
+		return
+	}
+	it.Iterator.Close()
+	it.db.ReleaseSnapshot(it.snapshot)
+	it.options.Destroy()
+
+	it.Iterator, it.snapshot, it.options = nil, nil, nil
+}
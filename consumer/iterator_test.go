@@ -0,0 +1,64 @@
+package consumer
+
+import (
+	"io/ioutil"
+	"os"
+
+	gc "github.com/go-check/check"
+	rocks "github.com/tecbot/gorocksdb"
+)
+
+type IteratorSuite struct{}
+
+func (s *IteratorSuite) TestSnapshotIsolation(c *gc.C) {
+	path, err := ioutil.TempDir("", "iterator-suite")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Check(os.RemoveAll(path), gc.IsNil) }()
+
+	var options = rocks.NewDefaultOptions()
+	options.SetCreateIfMissing(true)
+	defer options.Destroy()
+
+	db, err := rocks.OpenDb(options, path)
+	c.Assert(err, gc.IsNil)
+	defer db.Close()
+
+	var wo = rocks.NewDefaultWriteOptions()
+	defer wo.Destroy()
+
+	c.Assert(db.Put(wo, []byte("a"), []byte("1")), gc.IsNil)
+	c.Assert(db.Put(wo, []byte("b"), []byte("2")), gc.IsNil)
+
+	var it = NewSnapshotIterator(db, nil)
+
+	// Writes which follow creation of the iterator aren't observed by it.
+	var wb = rocks.NewWriteBatch()
+	defer wb.Destroy()
+
+	wb.Delete([]byte("a"))
+	wb.Put([]byte("b"), []byte("3"))
+	wb.Put([]byte("c"), []byte("4"))
+	c.Assert(db.Write(wo, wb), gc.IsNil)
+
+	var content = make(map[string]string)
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		content[string(it.Key().Data())] = string(it.Value().Data())
+	}
+	c.Check(it.Err(), gc.IsNil)
+	c.Check(content, gc.DeepEquals, map[string]string{"a": "1", "b": "2"})
+
+	it.Close()
+	it.Close() // Subsequent calls are no-ops.
+
+	// A new iterator observes the current database.
+	it = NewSnapshotIterator(db, nil)
+	defer it.Close()
+
+	content = make(map[string]string)
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		content[string(it.Key().Data())] = string(it.Value().Data())
+	}
+	c.Check(content, gc.DeepEquals, map[string]string{"b": "3", "c": "4"})
+}
+
+var _ = gc.Suite(&IteratorSuite{})
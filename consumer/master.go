@@ -71,12 +71,15 @@ const (
 type master struct {
 	shard     ShardID
 	partition topic.Partition
+	spec      ShardSpec
 	localDir  string
 
 	// Etcd path into which FSMHints are stored.
 	hintsPath string
 	// Offsets read from Etcd at master initialization.
 	etcdOffsets map[journal.Name]int64
+	// KeysAPI via which FSMHints are stored, set at master initialization.
+	keysAPI etcd.KeysAPI
 
 	cancelCh  <-chan struct{} // master.serve exists when selectable.
 	servingCh chan struct{}   // Blocks until master.serve exits.
@@ -84,6 +87,15 @@ type master struct {
 
 	database *database
 	cache    interface{}
+	// Filters consumed messages of a split or merged Shard. May be nil.
+	filter *messageFilter
+	// Publisher of transaction messages, if Runner.ExactlyOncePublish.
+	txPublisher *txPublisher
+	// Identifies duplicates of stamped messages.
+	dedup *deduplicator
+
+	// Closed when the upload of the last backup completes. See startBackup.
+	backupCh chan struct{}
 }
 
 func newMaster(shard *shard, tree *etcd.Node) (*master, error) {
@@ -100,6 +112,7 @@ func newMaster(shard *shard, tree *etcd.Node) (*master, error) {
 	return &master{
 		shard:       shard.id,
 		partition:   shard.partition,
+		spec:        shard.spec,
 		localDir:    shard.localDir,
 		hintsPath:   hintsPath(tree.Key, shard.id),
 		etcdOffsets: etcdOffsets,
@@ -165,13 +178,36 @@ func (m *master) init(runner *Runner, replica *replica) error {
 	var err error
 	var fsm *recoverylog.FSM
 
+	m.keysAPI = runner.KeysAPI()
+
+	// A split or merged Shard recovers the database of a parent, which must
+	// have exited before we can be certain we've read its final recorded state.
+	if len(m.spec.Parents) != 0 {
+		if err = waitForRetiredParents(runner, m.spec.Parents, m.cancelCh); err != nil {
+			return err
+		}
+	}
+
 	// Ask replica to become "live" once caught up to the recovery-log write head.
 	// This could potentially take a while, depending on how far behind we are.
-	fsm, err = replica.player.MakeLive()
+	fsm, _, err = replica.player.MakeLive()
 	if err != nil {
 		return err
 	}
 
+	// If the recovered database is that of a parent, fork it into our own
+	// recovery log, and store hints of the fork before recording to it.
+	if ownLog := recoveryLog(runner.RecoveryLogRoot, m.shard); len(m.spec.Parents) != 0 &&
+		fsm.LogMark.Journal != ownLog {
+
+		if fsm, err = recoverylog.ForkLog(fsm, m.localDir, ownLog, runner.Gazette); err != nil {
+			return err
+		} else if err = prepAndStoreHintsToEtcd(fsm.BuildHints(), m.hintsPath, m.keysAPI); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{"shard": m.shard, "log": ownLog}).Info("forked parent recovery log")
+	}
+
 	// Write last recovered hints to etcd.
 	if err := prepAndStoreHintsToEtcd(fsm.BuildHints(), m.hintsPath+".lastRecovered", runner.KeysAPI()); err != nil {
 		log.WithField("err", err).Warn("failed to store last recovered hints on master init.")
@@ -181,14 +217,41 @@ func (m *master) init(runner *Runner, replica *replica) error {
 
 	log.WithFields(log.Fields{"shard": m.shard}).Info("makeLive finished")
 
-	var opts = rocks.NewDefaultOptions()
+	manifestSize, err := maxManifestFileSize(runner.MaxManifestFileSize)
+	if err != nil {
+		return err
+	}
+	var opts = newDefaultOptions()
 	if initer, ok := runner.Consumer.(OptionsIniter); ok {
 		initer.InitOptions(opts)
 	}
+	// MaxManifestFileSize is reserved, and is configured by the Runner.
+	opts.SetMaxManifestFileSize(manifestSize)
+
+	var columnFamilies []string
+	if initer, ok := runner.Consumer.(ColumnFamilyIniter); ok {
+		columnFamilies = initer.InitColumnFamilies()
+	}
 
-	if m.database, err = newDatabase(opts, fsm, m.localDir, runner.Gazette); err != nil {
+	if m.database, err = newDatabase(opts, fsm, m.localDir, runner.Gazette, columnFamilies); err != nil {
 		return err
 	}
+	m.database.maxTransactionBytes = runner.MaxTransactionBytes
+
+	if err = m.initFilter(runner); err != nil {
+		return err
+	}
+	m.dedup = newDeduplicator()
+	if err = m.dedup.load(m.database.DB, m.database.readOptions); err != nil {
+		return err
+	}
+	// Content staged by a prior master is published even if ExactlyOncePublish
+	// is no longer set.
+	if err = replayPendingPublishes(m.database, runner.Gazette); err != nil {
+		return err
+	} else if runner.ExactlyOncePublish {
+		m.txPublisher = newTxPublisher(runner.Gazette)
+	}
 
 	if runner.ShardPreInitHook != nil {
 		runner.ShardPreInitHook(m)
@@ -204,7 +267,7 @@ func (m *master) init(runner *Runner, replica *replica) error {
 }
 
 func (m *master) startPumpingMessages(runner *Runner) (<-chan topic.Envelope, error) {
-	var dbOffsets, err = LoadOffsetsFromDB(m.database.DB, m.database.readOptions)
+	var dbOffsets, err = m.database.checkpoint()
 	if err != nil {
 		return nil, err
 	}
@@ -228,6 +291,14 @@ func (m *master) consumerLoop(runner *Runner, source <-chan topic.Envelope) erro
 	// Rate at which we publish recovery hints to Etcd.
 	var storeToEtcdInterval = time.NewTicker(storeToEtcdInterval)
 
+	// Rate at which we back up the database, if a BackupStore is configured.
+	var backupTickCh <-chan time.Time
+	if runner.BackupStore != nil {
+		var backupTicker = time.NewTicker(runner.BackupInterval)
+		defer backupTicker.Stop()
+		backupTickCh = backupTicker.C
+	}
+
 	// Timepoint at which the current transaction began.
 	// Set on the first message of a new transaction.
 	var txBegin time.Time
@@ -249,14 +320,17 @@ func (m *master) consumerLoop(runner *Runner, source <-chan topic.Envelope) erro
 	// Commit write-barrier of a previous transaction, which selects only after
 	// the previous transaction has been sync'd by Gazette. We allow a current
 	// transaction to process in the meantime (so we don't stall on Gazette I/O),
-	// but it cannot commit until |lastWriteBarrier| is selectable.
+	// but it cannot commit until |lastWriteBarrier| is selectable, unless
+	// commits are pipelined (in which case the database orders barriers).
 	var lastWriteBarrier = &zeroedAsyncAppend
-	// Specific topic.Publisher implementation passed to Consumers.
-	// TODO(johnny): Eventually, we want to track partitions written to under the
-	// current transaction (for later confirmation), and will also ensure that
-	// messages are appropriately tagged and sequenced. We can do so with a
-	// transaction-aware topic.Publisher. For now, use SimplePublisher.
+	// Specific topic.Publisher implementation passed to Consumers. Unless
+	// publishes are transactional, messages are written immediately.
 	var publisher = topic.NewPublisher(runner.Gazette)
+	if m.txPublisher != nil {
+		publisher = topic.NewPublisher(m.txPublisher)
+	}
+	// Transaction content staged for publishing upon commit.
+	var staged []stagedPublish
 
 	// We synchronize transaction concurrency via |txConcurrencyCh|. We must
 	// return a held lock on exit if we are in a transaction (txBegin != 0).
@@ -281,8 +355,8 @@ func (m *master) consumerLoop(runner *Runner, source <-chan topic.Envelope) erro
 
 		// We block if the minimum quantum hasn't elapsed (or we're not in a
 		// transaction in the first place). We also block if the previous
-		// transaction still has not sync'd to Gazette.
-		if !minQuantumElapsed || lastWriteBarrier.Ready != nil {
+		// transaction still has not sync'd to Gazette, unless pipelining.
+		if !minQuantumElapsed || (lastWriteBarrier.Ready != nil && !runner.PipelineCommits) {
 			select {
 			case <-m.cancelCh:
 				return nil
@@ -313,6 +387,13 @@ func (m *master) consumerLoop(runner *Runner, source <-chan topic.Envelope) erro
 				return nil
 			case lastTick = <-txTimer.C:
 				goto TIMER_TICK
+			case <-lastWriteBarrier.Ready:
+				// Selectable only if pipelining.
+				if lastWriteBarrier.Error != nil {
+					panic("expected write to resolve without error, or not resolve")
+				}
+				lastWriteBarrier = &zeroedAsyncAppend
+				continue
 			case msg = <-maybeSrc:
 				goto CONSUME_MSG
 			default:
@@ -358,7 +439,14 @@ func (m *master) consumerLoop(runner *Runner, source <-chan topic.Envelope) erro
 			txTimer.Reset(*minConsumeQuantum)
 		}
 
-		if err = runner.Consumer.Consume(msg, m, publisher); err != nil {
+		if m.filter.skips(msg) {
+			// The message isn't consumed by this Shard, but its offset is committed.
+		} else if !msg.Stamp.IsZero() && m.dedup.isDuplicate(msg.Stamp) {
+			// The message was already consumed, but its offset is committed.
+			metrics.GazetteConsumerDuplicateMessages.Inc()
+		} else if err = runner.Consumer.Consume(msg, m, publisher); err != nil {
+			return err
+		} else if err = m.database.checkTransaction(); err != nil {
 			return err
 		}
 
@@ -375,8 +463,17 @@ func (m *master) consumerLoop(runner *Runner, source <-chan topic.Envelope) erro
 
 		if err = runner.Consumer.Flush(m, publisher); err != nil {
 			return err
+		} else if err = m.database.checkTransaction(); err != nil {
+			// The transaction is not committed, and nothing is recorded to the
+			// recovery log. Consumption resumes from the last committed offsets.
+			return err
+		} else if m.txPublisher != nil {
+			if staged, err = m.txPublisher.stage(m.database.writeBatch); err != nil {
+				return err
+			}
 		}
-		storeOffsetsToDB(m.database.writeBatch, txOffsets)
+		// Producer states are committed with the offsets of consumed messages.
+		m.dedup.store(m.database.writeBatch)
 
 		select {
 		case <-storeToEtcdInterval.C:
@@ -392,23 +489,31 @@ func (m *master) consumerLoop(runner *Runner, source <-chan topic.Envelope) erro
 				hints = string(b)
 			}
 
-			if lastWriteBarrier, err = m.database.commit(); err != nil {
+			if lastWriteBarrier, err = m.database.commit(txOffsets); err != nil {
 				return err
 			}
 
 			go func(hints string, offsets map[journal.Name]int64, barrier *journal.AsyncAppend) {
 				<-barrier.Ready
 
+				if barrier.Error != nil {
+					return // Hinted content isn't committed.
+				}
 				storeHintsToEtcd(m.hintsPath, hints, runner.KeysAPI())
 				StoreOffsetsToEtcd(runner.ConsumerRoot, offsets, runner.KeysAPI())
 			}(hints, copyOffsets(txOffsets), lastWriteBarrier)
 
 		default:
-			if lastWriteBarrier, err = m.database.commit(); err != nil {
+			if lastWriteBarrier, err = m.database.commit(txOffsets); err != nil {
 				return err
 			}
 		}
 
+		if len(staged) != 0 {
+			m.txPublisher.publish(staged, lastWriteBarrier)
+			staged = nil
+		}
+
 		// Record transaction metrics.
 		var txDuration = time.Now().Sub(txBegin)
 		if txDuration > *maxConsumeQuantum {
@@ -420,6 +525,12 @@ func (m *master) consumerLoop(runner *Runner, source <-chan topic.Envelope) erro
 		metrics.GazetteConsumerTxMessagesTotal.Add(float64(txMessages))
 		metrics.GazetteConsumerTxCountTotal.Inc()
 
+		select {
+		case <-backupTickCh:
+			m.startBackup(runner)
+		default:
+		}
+
 		// Reset for next transaction.
 		clearOffsets(txOffsets)
 		minQuantumElapsed, maxQuantumElapsed = false, false
@@ -444,6 +555,50 @@ func (m *master) Transaction() *rocks.WriteBatch    { return m.database.writeBat
 func (m *master) ReadOptions() *rocks.ReadOptions   { return m.database.readOptions }
 func (m *master) WriteOptions() *rocks.WriteOptions { return m.database.writeOptions }
 
+func (m *master) AbortTransaction() {
+	m.database.abort()
+
+	if m.txPublisher != nil {
+		m.txPublisher.abort()
+	}
+}
+
+func (m *master) SetTransactionWriteOptions(options *rocks.WriteOptions) {
+	m.database.txWriteOptions = options
+}
+
+func (m *master) CheckTransaction() error { return m.database.checkTransaction() }
+
+func (m *master) CommittedReadOptions() *rocks.ReadOptions {
+	m.database.waitForCommit()
+	return m.database.readOptions
+}
+
+func (m *master) CommittedOffset() int64 { return m.database.committedOffset() }
+
+func (m *master) ColumnFamily(name string) *rocks.ColumnFamilyHandle {
+	return m.database.columnFamilies[name]
+}
+
+func (m *master) CompactRecoveryLog() error {
+	if err := m.database.compact(); err != nil {
+		return err
+	}
+	// As in consumerLoop, hints are built now but stored only after the write
+	// barrier resolves, so that hinted content is committed before it's
+	// observable by other processes.
+	var hints = m.database.recorder.BuildHints()
+	var barrier = m.database.recorder.WriteBarrier()
+
+	go func() {
+		<-barrier.Ready
+		prepAndStoreHintsToEtcd(hints, m.hintsPath, m.keysAPI)
+	}()
+
+	log.WithFields(log.Fields{"shard": m.shard}).Info("compacted recovery log")
+	return nil
+}
+
 // A buffered channel which can be sized by flag.Var.
 type flaggedBufferedChan chan struct{}
 
@@ -0,0 +1,328 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cockroachdb/cockroach/util/encoding"
+	etcd "github.com/coreos/etcd/client"
+	log "github.com/sirupsen/logrus"
+	rocks "github.com/tecbot/gorocksdb"
+
+	"github.com/LiveRamp/gazette/consensus"
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/recoverylog"
+	"github.com/LiveRamp/gazette/topic"
+)
+
+const (
+	// Approximate size of each WriteBatch of keys copied from a merged parent.
+	mergeBatchBytes = 1 << 22 // 4MB.
+	// Interval with which the Etcd items of retired parents are polled.
+	retiredParentsPollInterval = time.Second
+)
+
+// skipRule skips messages of a Range of key hashes at or below an Offset,
+// which were consumed by a parent Shard prior to a merge.
+type skipRule struct {
+	Range  KeyRange
+	Offset int64
+}
+
+// messageFilter determines messages which are not consumed by a Shard.
+type messageFilter struct {
+	hasher   KeyHasher
+	keyRange KeyRange
+	rules    []skipRule
+}
+
+// newMessageFilter returns a messageFilter of Consumer |c| for |keyRange| and
+// |rules|. If neither constrains consumed messages, nil is returned.
+func newMessageFilter(c Consumer, keyRange KeyRange, rules []skipRule) (*messageFilter, error) {
+	if keyRange == FullKeyRange && len(rules) == 0 {
+		return nil, nil
+	}
+	var hasher, ok = c.(KeyHasher)
+	if !ok {
+		return nil, fmt.Errorf("consumer of key range %v doesn't implement KeyHasher", keyRange)
+	}
+	return &messageFilter{hasher: hasher, keyRange: keyRange, rules: rules}, nil
+}
+
+// skips returns whether |env| should not be consumed: because its key hash is
+// outside the filter's KeyRange, or it was already consumed by a parent Shard.
+// A nil messageFilter skips no messages.
+func (f *messageFilter) skips(env topic.Envelope) bool {
+	if f == nil {
+		return false
+	}
+	var hash = f.hasher.KeyHash(env)
+
+	if !f.keyRange.Contains(hash) {
+		return true
+	}
+	for _, rule := range f.rules {
+		if rule.Range.Contains(hash) && env.Mark.Offset <= rule.Offset {
+			return true
+		}
+	}
+	return false
+}
+
+// Prefix of reserved database keys under which skipRules are stored.
+var skipRulesPrefix = encoding.EncodeStringAscending(encoding.EncodeNullAscending(nil), "skip-rules")
+
+// skipRulesKey returns the reserved database key of skipRules of |shard|.
+func skipRulesKey(shard ShardID) []byte {
+	return encoding.EncodeStringAscending(append([]byte(nil), skipRulesPrefix...), shard.String())
+}
+
+// loadSkipRules loads skipRules of |shard| from |db|. It returns false if no
+// rules have been stored for |shard|.
+func loadSkipRules(db *rocks.DB, ro *rocks.ReadOptions, shard ShardID) ([]skipRule, bool, error) {
+	var value, err = db.GetBytes(ro, skipRulesKey(shard))
+	if err != nil || value == nil {
+		return nil, false, err
+	}
+	var rules []skipRule
+	if err = json.Unmarshal(value, &rules); err != nil {
+		return nil, false, err
+	}
+	return rules, true, nil
+}
+
+// initFilter initializes the messageFilter of the master. A Shard with
+// parents which hasn't yet stored its skipRules first merges its parents.
+func (m *master) initFilter(runner *Runner) error {
+	var rules, ok, err = loadSkipRules(m.database.DB, m.database.readOptions, m.shard)
+	if err != nil {
+		return err
+	} else if !ok && len(m.spec.Parents) != 0 {
+		if rules, err = m.mergeParents(runner); err != nil {
+			return err
+		}
+	}
+	m.filter, err = newMessageFilter(runner.Consumer, m.spec.Range, rules)
+	return err
+}
+
+// mergeParents copies into the database (recovered from the first parent of
+// the Shard) the databases of each further parent. Consumed offsets of the
+// database become the least of its parents, and skipRules are added for
+// messages which any other parent had already consumed. SkipRules of the
+// parents are carried forward. The skipRules of the Shard are stored in the
+// final written batch, and mark the merge as complete: should the master fail
+// part-way, the merge is retried from its recovered database.
+func (m *master) mergeParents(runner *Runner) ([]skipRule, error) {
+	var rules, _, err = loadSkipRules(m.database.DB, m.database.readOptions, m.spec.Parents[0].ID)
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := m.database.checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	var parentOffsets = []map[journal.Name]int64{offsets}
+
+	var wb = rocks.NewWriteBatch()
+	defer wb.Destroy()
+
+	for _, parent := range m.spec.Parents[1:] {
+		var parentRules, offsets, err = m.copyParent(runner, parent.ID, wb)
+		if err != nil {
+			return nil, fmt.Errorf("merging parent %s: %s", parent.ID, err)
+		}
+		rules = append(rules, parentRules...)
+		parentOffsets = append(parentOffsets, offsets)
+	}
+
+	// Consumption resumes from the least offset of any parent. Messages between
+	// it and the offset of each other parent were consumed by that parent.
+	var merged, found = int64(0), false
+	for i, offsets := range parentOffsets {
+		if offset := offsets[m.spec.Journal]; i == 0 || offset < merged {
+			merged = offset
+		}
+		if _, ok := offsets[m.spec.Journal]; ok {
+			found = true
+		}
+	}
+	for i, parent := range m.spec.Parents {
+		if offset := parentOffsets[i][m.spec.Journal]; offset > merged {
+			rules = append(rules, skipRule{Range: parent.Range, Offset: offset})
+		}
+	}
+
+	value, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	wb.Put(skipRulesKey(m.shard), value)
+
+	if found {
+		storeOffsetsToDB(wb, map[journal.Name]int64{m.spec.Journal: merged})
+	}
+	if err = m.writeMergeBatch(wb); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"shard": m.shard, "parents": m.spec.Parents, "offset": merged, "rules": rules}).
+		Info("merged parent shards")
+
+	return rules, nil
+}
+
+// copyParent recovers the database of |parent| into a temporary directory,
+// and copies its keys into the database via |wb|. Reserved keys are not
+// copied. It returns the skipRules and consumed offsets of |parent|.
+func (m *master) copyParent(runner *Runner, parent ShardID,
+	wb *rocks.WriteBatch) ([]skipRule, map[journal.Name]int64, error) {
+
+	var hints, err = runner.fetchHints(parent)
+	if err != nil {
+		return nil, nil, err
+	}
+	var dir = m.localDir + ".merge-" + parent.String()
+	defer os.RemoveAll(dir)
+
+	player, err := recoverylog.NewPlayer(hints, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var playErrCh = make(chan error, 1)
+	go func() { playErrCh <- player.Play(runner.Gazette) }()
+
+	// Cancel playback if the master is cancelled.
+	var doneCh = make(chan struct{})
+	defer close(doneCh)
+
+	go func() {
+		select {
+		case <-m.cancelCh:
+			player.Cancel()
+		case <-doneCh:
+		}
+	}()
+
+	if _, _, err = player.MakeLive(); err != nil {
+		<-playErrCh
+		return nil, nil, err
+	} else if err = <-playErrCh; err != nil {
+		return nil, nil, err
+	}
+
+	var opts = rocks.NewDefaultOptions()
+	defer opts.Destroy()
+
+	if families, err := rocks.ListColumnFamilies(opts, dir); err != nil {
+		return nil, nil, err
+	} else if len(families) != 1 || families[0] != kDefaultColumnFamily {
+		return nil, nil, fmt.Errorf("merging column families %v is not supported", families)
+	}
+
+	db, err := rocks.OpenDbForReadOnly(opts, dir, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	var ro = rocks.NewDefaultReadOptions()
+	defer ro.Destroy()
+
+	rules, _, err := loadSkipRules(db, ro, parent)
+	if err != nil {
+		return nil, nil, err
+	}
+	offsets, err := LoadOffsetsFromDB(db, ro)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var markPrefix = encoding.EncodeStringAscending(encoding.EncodeNullAscending(nil), "mark")
+	var it = db.NewIterator(ro)
+	defer it.Close()
+
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		var key, value = it.Key(), it.Value()
+
+		if k := key.Data(); !bytes.HasPrefix(k, markPrefix) && !bytes.HasPrefix(k, skipRulesPrefix) {
+			wb.Put(k, value.Data())
+		}
+		key.Free()
+		value.Free()
+
+		if len(wb.Data()) >= mergeBatchBytes {
+			if err = m.writeMergeBatch(wb); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if err = it.Err(); err != nil {
+		return nil, nil, err
+	}
+	return rules, offsets, nil
+}
+
+// writeMergeBatch writes and clears |wb|, returning after the write has
+// committed to the recovery log.
+func (m *master) writeMergeBatch(wb *rocks.WriteBatch) error {
+	if err := m.database.Write(m.database.writeOptions, wb); err != nil {
+		return err
+	}
+	wb.Clear()
+
+	var barrier, err = m.database.logWriter.Write(m.database.recoveryLog, nil)
+	if err != nil {
+		return err
+	}
+	<-barrier.Ready
+	return barrier.Error
+}
+
+// waitForRetiredParents blocks until no locks are held on the Etcd items of
+// |parents|, which ensures retired parent Shards have fully exited and will
+// no longer record to their recovery logs.
+func waitForRetiredParents(runner *Runner, parents []ParentShard, cancelCh <-chan struct{}) error {
+	for {
+		var resultCh = make(chan bool, 1)
+		var inspect = func(tree *etcd.Node) {
+			for _, parent := range parents {
+				if item := consensus.Child(tree, consensus.ItemsPrefix, parent.ID.String()); item != nil && len(item.Nodes) != 0 {
+					resultCh <- false
+					return
+				}
+			}
+			resultCh <- true
+		}
+
+		select {
+		case runner.InspectChan() <- inspect:
+		case <-cancelCh:
+			return recoverylog.ErrPlaybackCancelled
+		}
+		if <-resultCh {
+			return nil
+		}
+
+		select {
+		case <-time.After(retiredParentsPollInterval):
+		case <-cancelCh:
+			return recoverylog.ErrPlaybackCancelled
+		}
+	}
+}
+
+// removeItemDir removes the empty Etcd item directory |key| of a retired
+// Shard, so that it's no longer allocated. It fails harmlessly if a lock of
+// the item has since been acquired.
+func removeItemDir(runner *Runner, key string) {
+	var _, err = runner.KeysAPI().Delete(context.Background(), key, &etcd.DeleteOptions{Dir: true})
+	if err != nil {
+		log.WithFields(log.Fields{"key": key, "err": err}).Warn("failed to remove retired item")
+	}
+}
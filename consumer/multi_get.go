@@ -0,0 +1,52 @@
+package consumer
+
+import (
+	rocks "github.com/tecbot/gorocksdb"
+)
+
+// MultiGet reads the values of |keys| from |db| against a single, pinned
+// database Snapshot, such that values are mutually consistent as of a
+// transaction commit point, even as concurrent transactions commit. If |cf| is
+// non-nil keys are read from |cf|, and otherwise from the default column
+// family. Values are returned in the order of |keys|. A key which is not found
+// has a nil value, which is distinct from a found key having an empty value
+// (a non-nil, zero-length slice). Errors are of the read itself. The Snapshot
+// is released before MultiGet returns.
+func MultiGet(db *rocks.DB, cf *rocks.ColumnFamilyHandle, keys [][]byte) ([][]byte, error) {
+	var snapshot = db.NewSnapshot()
+	defer db.ReleaseSnapshot(snapshot)
+
+	var options = rocks.NewDefaultReadOptions()
+	defer options.Destroy()
+	options.SetSnapshot(snapshot)
+
+	// Use the native RocksDB MultiGet, which batches lookups of |keys|.
+	var slices rocks.Slices
+	var err error
+
+	if cf != nil {
+		slices, err = db.MultiGetCF(options, cf, keys...)
+	} else {
+		slices, err = db.MultiGet(options, keys...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer slices.Destroy()
+
+	var out = make([][]byte, len(slices))
+	for i, slice := range slices {
+		if slice.Exists() {
+			out[i] = append([]byte{}, slice.Data()...)
+		}
+	}
+	return out, nil
+}
+
+// MultiGet reads |keys| of the default column family. See MultiGet.
+func (db *database) MultiGet(keys [][]byte) ([][]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return MultiGet(db.DB, nil, keys)
+}
@@ -0,0 +1,75 @@
+package consumer
+
+import (
+	"io/ioutil"
+	"os"
+
+	gc "github.com/go-check/check"
+	rocks "github.com/tecbot/gorocksdb"
+)
+
+type MultiGetSuite struct{}
+
+func (s *MultiGetSuite) TestFoundEmptyAndMissingKeys(c *gc.C) {
+	path, err := ioutil.TempDir("", "multi-get-suite")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Check(os.RemoveAll(path), gc.IsNil) }()
+
+	var options = rocks.NewDefaultOptions()
+	options.SetCreateIfMissing(true)
+	defer options.Destroy()
+
+	db, err := rocks.OpenDb(options, path)
+	c.Assert(err, gc.IsNil)
+	defer db.Close()
+
+	var wo = rocks.NewDefaultWriteOptions()
+	defer wo.Destroy()
+
+	c.Assert(db.Put(wo, []byte("a"), []byte("1")), gc.IsNil)
+	c.Assert(db.Put(wo, []byte("empty"), []byte{}), gc.IsNil)
+	c.Assert(db.Put(wo, []byte("c"), []byte("3")), gc.IsNil)
+
+	values, err := MultiGet(db, nil, [][]byte{
+		[]byte("c"), []byte("missing"), []byte("empty"), []byte("a")})
+	c.Check(err, gc.IsNil)
+	c.Check(values, gc.DeepEquals, [][]byte{[]byte("3"), nil, {}, []byte("1")})
+
+	// Expect values are distinguished from not-found keys.
+	c.Check(values[1], gc.IsNil)
+	c.Check(values[2], gc.NotNil)
+
+	values, err = MultiGet(db, nil, nil)
+	c.Check(err, gc.IsNil)
+	c.Check(values, gc.HasLen, 0)
+}
+
+func (s *MultiGetSuite) TestColumnFamily(c *gc.C) {
+	path, err := ioutil.TempDir("", "multi-get-suite")
+	c.Assert(err, gc.IsNil)
+	defer func() { c.Check(os.RemoveAll(path), gc.IsNil) }()
+
+	var options = rocks.NewDefaultOptions()
+	options.SetCreateIfMissing(true)
+	defer options.Destroy()
+
+	db, err := rocks.OpenDb(options, path)
+	c.Assert(err, gc.IsNil)
+	defer db.Close()
+
+	cf, err := db.CreateColumnFamily(options, "other")
+	c.Assert(err, gc.IsNil)
+	defer cf.Destroy()
+
+	var wo = rocks.NewDefaultWriteOptions()
+	defer wo.Destroy()
+
+	c.Assert(db.Put(wo, []byte("a"), []byte("default")), gc.IsNil)
+	c.Assert(db.PutCF(wo, cf, []byte("a"), []byte("other")), gc.IsNil)
+
+	values, err := MultiGet(db, cf, [][]byte{[]byte("a"), []byte("b")})
+	c.Check(err, gc.IsNil)
+	c.Check(values, gc.DeepEquals, [][]byte{[]byte("other"), nil})
+}
+
+var _ = gc.Suite(&MultiGetSuite{})
@@ -0,0 +1,331 @@
+package consumer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/cockroachdb/cockroach/util/encoding"
+	log "github.com/sirupsen/logrus"
+	rocks "github.com/tecbot/gorocksdb"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// Prefix of reserved database keys under which published content of committed
+// transactions is staged, until it's been appended to its journal.
+var pendingPublishPrefix = encoding.EncodeStringAscending(encoding.EncodeNullAscending(nil), "pending-publish")
+
+// txPublisher is a journal.Writer which publishes content written during a
+// consumer transaction only once the transaction has committed. Written
+// content is staged in the transaction WriteBatch (and thus recorded to the
+// recovery log with it), and is appended to journals once the transaction
+// commit barrier resolves. Staged content is removed by a following
+// transaction once it's been appended. A recovered master re-publishes any
+// staged content which hadn't been removed, first checking whether it was
+// in fact appended (see replayPendingPublishes). Each transaction therefore
+// publishes its content exactly once.
+//
+// Content of a transaction is appended to each journal as a single atomic
+// write, and transactions are published in commit order. Write returns an
+// AsyncAppend which resolves once the transaction content is published.
+type txPublisher struct {
+	client journal.Client
+
+	// Content written in the current transaction, and its AsyncAppends.
+	content  map[journal.Name][]byte
+	promises map[journal.Name]*journal.AsyncAppend
+	// Sequence number of the next staged transaction.
+	seq int64
+	// Closed when publishing of the last staged transaction completes.
+	lastDone chan struct{}
+
+	mu sync.Mutex
+	// Known lower bounds of the write heads of published-to journals.
+	heads map[journal.Name]int64
+	// Staged keys of content which has been appended, to be removed.
+	published [][]byte
+	// Error which failed a publish of staged content.
+	err error
+}
+
+// stagedPublish is content of a transaction which was staged for publishing.
+type stagedPublish struct {
+	journal journal.Name
+	key     []byte
+	content []byte
+	promise *journal.AsyncAppend
+}
+
+func newTxPublisher(client journal.Client) *txPublisher {
+	return &txPublisher{
+		client:   client,
+		content:  make(map[journal.Name][]byte),
+		promises: make(map[journal.Name]*journal.AsyncAppend),
+		heads:    make(map[journal.Name]int64),
+	}
+}
+
+// journal.Writer implementation.
+func (p *txPublisher) Write(name journal.Name, buffer []byte) (*journal.AsyncAppend, error) {
+	p.content[name] = append(p.content[name], buffer...)
+
+	var promise, ok = p.promises[name]
+	if !ok {
+		promise = &journal.AsyncAppend{Ready: make(chan struct{})}
+		p.promises[name] = promise
+	}
+	return promise, nil
+}
+
+// journal.Writer implementation.
+func (p *txPublisher) ReadFrom(name journal.Name, r io.Reader) (*journal.AsyncAppend, error) {
+	if buffer, err := ioutil.ReadAll(r); err != nil {
+		return nil, err
+	} else {
+		return p.Write(name, buffer)
+	}
+}
+
+// abort discards content written in the current transaction. Its
+// AsyncAppends never resolve.
+func (p *txPublisher) abort() {
+	p.content = make(map[journal.Name][]byte)
+	p.promises = make(map[journal.Name]*journal.AsyncAppend)
+}
+
+// stage writes to |wb| the content of the current transaction, and removals
+// of previously staged content which has since been published. It returns
+// staged content, to be published after |wb| commits (see publish), or an
+// error if a prior publish failed.
+func (p *txPublisher) stage(wb *rocks.WriteBatch) ([]stagedPublish, error) {
+	p.mu.Lock()
+	for _, key := range p.published {
+		wb.Delete(key)
+	}
+	p.published = nil
+	var err = p.err
+	p.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	} else if len(p.content) == 0 {
+		return nil, nil
+	}
+
+	var names []string
+	for name := range p.content {
+		names = append(names, name.String())
+	}
+	sort.Strings(names)
+
+	var out []stagedPublish
+	for _, n := range names {
+		var name = journal.Name(n)
+
+		// Content is staged with a lower bound on the offset at which it will be
+		// appended, which bounds the search for it upon replay.
+		var bound, err = p.headBound(name)
+		if err != nil {
+			return nil, err
+		}
+		var staged = stagedPublish{
+			journal: name,
+			key:     pendingPublishKey(p.seq, name),
+			content: p.content[name],
+			promise: p.promises[name],
+		}
+		wb.Put(staged.key, append(encoding.EncodeVarintAscending(nil, bound), staged.content...))
+		out = append(out, staged)
+	}
+	p.seq += 1
+	p.abort()
+
+	return out, nil
+}
+
+// publish appends |staged| content once |barrier| resolves, and after content
+// of previously staged transactions has been published. If |barrier| fails,
+// content is not published and further stage calls fail.
+func (p *txPublisher) publish(staged []stagedPublish, barrier *journal.AsyncAppend) {
+	var prevDone, done = p.lastDone, make(chan struct{})
+	p.lastDone = done
+
+	go func() {
+		defer close(done)
+
+		if <-barrier.Ready; prevDone != nil {
+			<-prevDone
+		}
+		p.mu.Lock()
+		var err = p.err
+		p.mu.Unlock()
+
+		if err == nil {
+			err = barrier.Error
+		}
+
+		for _, s := range staged {
+			var head int64
+			if err == nil {
+				head, err = appendAndWait(p.client, s.journal, s.content)
+			}
+			s.promise.Error, s.promise.WriteHead = err, head
+			close(s.promise.Ready)
+
+			p.mu.Lock()
+			if err == nil {
+				p.heads[s.journal] = head
+				p.published = append(p.published, s.key)
+			} else if p.err == nil {
+				p.err = err
+			}
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// headBound returns a lower bound on the offset at which content will next be
+// appended to |name|: the write head following our last append, or if none,
+// the current write head.
+func (p *txPublisher) headBound(name journal.Name) (int64, error) {
+	p.mu.Lock()
+	var head, ok = p.heads[name]
+	p.mu.Unlock()
+
+	if ok {
+		return head, nil
+	}
+	head, err := writeHead(p.client, name)
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	p.heads[name] = head
+	p.mu.Unlock()
+
+	return head, nil
+}
+
+// replayPendingPublishes publishes content staged by transactions of |db|
+// which may not have been published, and removes it from |db|. Content which
+// was already appended (eg, by a prior master which failed before removing
+// it) is not appended again.
+func replayPendingPublishes(db *database, client journal.Client) error {
+	var wb = rocks.NewWriteBatch()
+	defer wb.Destroy()
+
+	var it = db.NewIterator(db.readOptions)
+	defer it.Close()
+
+	var count int
+	for it.Seek(pendingPublishPrefix); it.ValidForPrefix(pendingPublishPrefix); it.Next() {
+		var k, v = it.Key(), it.Value()
+		var key = append([]byte(nil), k.Data()...)
+		var value = append([]byte(nil), v.Data()...)
+		k.Free()
+		v.Free()
+
+		var name, err = decodePendingPublishKey(key)
+		if err != nil {
+			return err
+		}
+		content, bound, err := encoding.DecodeVarintAscending(value)
+		if err != nil {
+			return err
+		}
+
+		if ok, err := wasPublished(client, name, bound, content); err != nil {
+			return err
+		} else if !ok {
+			if _, err = appendAndWait(client, name, content); err != nil {
+				return err
+			}
+			count += 1
+		}
+		wb.Delete(key)
+	}
+	if err := it.Err(); err != nil {
+		return err
+	} else if wb.Count() == 0 {
+		return nil
+	}
+
+	if err := db.Write(db.writeOptions, wb); err != nil {
+		return err
+	}
+	var barrier, err = db.logWriter.Write(db.recoveryLog, nil)
+	if err != nil {
+		return err
+	} else if <-barrier.Ready; barrier.Error != nil {
+		return barrier.Error
+	}
+
+	log.WithFields(log.Fields{"staged": wb.Count(), "published": count}).
+		Info("replayed pending transaction publishes")
+	return nil
+}
+
+// wasPublished returns whether |content| was appended to |name| at or after
+// offset |bound|. As appends are atomic, it's published iff it appears
+// contiguously within the journal content following |bound|. Note identical
+// content appended by another writer is indistinguishable, though in practice
+// content includes distinguishing message fields (eg, keys or UUIDs).
+func wasPublished(client journal.Client, name journal.Name, bound int64, content []byte) (bool, error) {
+	var head, err = writeHead(client, name)
+	if err != nil {
+		return false, err
+	} else if head-bound < int64(len(content)) {
+		return false, nil
+	}
+
+	var rr = journal.NewRetryReader(journal.NewMark(name, bound), client)
+	defer rr.Close()
+
+	var written = make([]byte, head-bound)
+	if _, err := io.ReadFull(rr, written); err != nil {
+		return false, err
+	}
+	return bytes.Contains(written, content), nil
+}
+
+// writeHead returns the current write head of |name|.
+func writeHead(client journal.Header, name journal.Name) (int64, error) {
+	var result, _ = client.Head(journal.ReadArgs{Journal: name, Blocking: false, Offset: -1})
+	if result.Error != nil && result.Error != journal.ErrNotYetAvailable {
+		return 0, result.Error
+	}
+	return result.WriteHead, nil
+}
+
+// appendAndWait appends |content| to |name|, and returns the resulting write
+// head once the append has committed.
+func appendAndWait(client journal.Writer, name journal.Name, content []byte) (int64, error) {
+	var aa, err = client.Write(name, content)
+	if err != nil {
+		return 0, err
+	}
+	<-aa.Ready
+	return aa.WriteHead, aa.Error
+}
+
+// pendingPublishKey returns the reserved database key of content of |name|
+// staged by the transaction of sequence |seq|.
+func pendingPublishKey(seq int64, name journal.Name) []byte {
+	var key = append([]byte(nil), pendingPublishPrefix...)
+	key = encoding.EncodeVarintAscending(key, seq)
+	return encoding.EncodeStringAscending(key, name.String())
+}
+
+// decodePendingPublishKey returns the journal of a pendingPublishKey.
+func decodePendingPublishKey(key []byte) (journal.Name, error) {
+	var rest, _, err = encoding.DecodeVarintAscending(key[len(pendingPublishPrefix):])
+	if err != nil {
+		return "", err
+	}
+	_, name, err := encoding.DecodeStringAscending(rest, nil)
+	return journal.Name(name), err
+}
@@ -0,0 +1,127 @@
+package consumer
+
+import (
+	"errors"
+
+	gc "github.com/go-check/check"
+	rocks "github.com/tecbot/gorocksdb"
+
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/recoverylog"
+)
+
+type PublishSuite struct{}
+
+func (s *PublishSuite) TestStageAndPublish(c *gc.C) {
+	var client = recoverylog.NewMemoryClient()
+	client.Write("a/journal", []byte("prior content "))
+
+	var pub = newTxPublisher(client)
+	var aa, _ = pub.Write("a/journal", []byte("hello, "))
+	pub.Write("a/journal", []byte("world"))
+	var bb, _ = pub.Write("b/journal", []byte("other"))
+
+	var wb = rocks.NewWriteBatch()
+	defer wb.Destroy()
+
+	var staged, err = pub.stage(wb)
+	c.Check(err, gc.IsNil)
+	c.Check(staged, gc.HasLen, 2)
+	c.Check(wb.Count(), gc.Equals, 2)
+
+	c.Check(staged[0].journal, gc.Equals, journal.Name("a/journal"))
+	c.Check(staged[0].key, gc.DeepEquals, pendingPublishKey(0, "a/journal"))
+	c.Check(string(staged[0].content), gc.Equals, "hello, world")
+	c.Check(staged[1].journal, gc.Equals, journal.Name("b/journal"))
+
+	name, err := decodePendingPublishKey(staged[1].key)
+	c.Check(err, gc.IsNil)
+	c.Check(name, gc.Equals, journal.Name("b/journal"))
+
+	// Content is not published until the commit barrier resolves.
+	var barrier = &journal.AsyncAppend{Ready: make(chan struct{})}
+	pub.publish(staged, barrier)
+	c.Check(string(client.Content("a/journal")), gc.Equals, "prior content ")
+
+	close(barrier.Ready)
+	<-aa.Ready
+	<-bb.Ready
+
+	c.Check(aa.Error, gc.IsNil)
+	c.Check(aa.WriteHead, gc.Equals, int64(len("prior content hello, world")))
+	c.Check(string(client.Content("a/journal")), gc.Equals, "prior content hello, world")
+	c.Check(string(client.Content("b/journal")), gc.Equals, "other")
+
+	// The next transaction removes published staged content.
+	wb.Clear()
+	staged, err = pub.stage(wb)
+	c.Check(err, gc.IsNil)
+	c.Check(staged, gc.HasLen, 0)
+	c.Check(wb.Count(), gc.Equals, 2)
+}
+
+func (s *PublishSuite) TestFailedCommitIsNotPublished(c *gc.C) {
+	var client = recoverylog.NewMemoryClient()
+	var pub = newTxPublisher(client)
+	var aa, _ = pub.Write("a/journal", []byte("content"))
+
+	var wb = rocks.NewWriteBatch()
+	defer wb.Destroy()
+
+	var staged, err = pub.stage(wb)
+	c.Check(err, gc.IsNil)
+
+	var barrier = &journal.AsyncAppend{Ready: make(chan struct{})}
+	barrier.Error = errors.New("commit failed")
+	close(barrier.Ready)
+
+	pub.publish(staged, barrier)
+	<-aa.Ready
+
+	c.Check(aa.Error, gc.ErrorMatches, "commit failed")
+	c.Check(client.Content("a/journal"), gc.HasLen, 0)
+
+	// Further transactions fail.
+	_, err = pub.stage(wb)
+	c.Check(err, gc.ErrorMatches, "commit failed")
+}
+
+func (s *PublishSuite) TestAbortDiscardsContent(c *gc.C) {
+	var pub = newTxPublisher(recoverylog.NewMemoryClient())
+	pub.Write("a/journal", []byte("content"))
+	pub.abort()
+
+	var wb = rocks.NewWriteBatch()
+	defer wb.Destroy()
+
+	var staged, err = pub.stage(wb)
+	c.Check(err, gc.IsNil)
+	c.Check(staged, gc.HasLen, 0)
+	c.Check(wb.Count(), gc.Equals, 0)
+}
+
+func (s *PublishSuite) TestWasPublished(c *gc.C) {
+	var client = recoverylog.NewMemoryClient()
+	client.Write("a/journal", []byte("prior "))
+	var bound = client.WriteHead("a/journal")
+
+	// Not yet published.
+	var ok, err = wasPublished(client, "a/journal", bound, []byte("content"))
+	c.Check(err, gc.IsNil)
+	c.Check(ok, gc.Equals, false)
+
+	client.Write("a/journal", []byte("interleaved "))
+	client.Write("a/journal", []byte("content"))
+	client.Write("a/journal", []byte(" trailing"))
+
+	ok, err = wasPublished(client, "a/journal", bound, []byte("content"))
+	c.Check(err, gc.IsNil)
+	c.Check(ok, gc.Equals, true)
+
+	// Content before |bound| doesn't count.
+	ok, err = wasPublished(client, "a/journal", bound, []byte("prior"))
+	c.Check(err, gc.IsNil)
+	c.Check(ok, gc.Equals, false)
+}
+
+var _ = gc.Suite(&PublishSuite{})
@@ -22,6 +22,12 @@ func newPump(get journal.Getter, sink chan<- topic.Envelope, cancel <-chan struc
 func (p *pump) pump(desc *topic.Description, mark journal.Mark) {
 	log.WithField("mark", mark).Info("now consuming from journal")
 
+	var framing, err = desc.ResolveFraming()
+	if err != nil {
+		log.WithFields(log.Fields{"mark": mark, "err": err}).Error("resolving framing")
+		return
+	}
+
 	var rr = journal.NewRetryReader(mark, p.getter)
 	defer func() {
 		if err := rr.Close(); err != nil {
@@ -30,17 +36,19 @@ func (p *pump) pump(desc *topic.Description, mark journal.Mark) {
 	}()
 
 	var br = bufio.NewReader(rr)
+	var stamped, _ = framing.(*topic.StampedFraming)
 
 	for {
-		var frame, err = desc.Framing.Unpack(br)
+		var frame, err = framing.Unpack(br)
 		if err != nil {
 			log.WithFields(log.Fields{"mark": rr.AdjustedMark(br), "err": err}).Error("unpacking frame")
 			continue
 		}
 
 		var msg = desc.GetMessage()
-		if err := desc.Framing.Unmarshal(frame, msg); err == topic.ErrDesyncDetected {
-			// Only WARN level log for desync.
+		if err := framing.Unmarshal(frame, msg); err == topic.ErrDesyncDetected ||
+			err == topic.ErrCorruptFrame {
+			// Only WARN level log for desync or a corrupt frame.
 			// See https://jira.liveramp.com/browse/PUB-1777 for detail.
 			log.WithFields(log.Fields{"mark": rr.Mark, "err": err}).Warn("message decode")
 			continue
@@ -49,8 +57,13 @@ func (p *pump) pump(desc *topic.Description, mark journal.Mark) {
 			continue
 		}
 
+		var env = topic.Envelope{Topic: desc, Mark: rr.AdjustedMark(br), Message: msg}
+		if stamped != nil {
+			env.Stamp, _ = stamped.Stamp(frame)
+		}
+
 		select {
-		case p.sink <- topic.Envelope{desc, rr.AdjustedMark(br), msg}:
+		case p.sink <- env:
 		case <-p.cancelCh:
 			return
 		}
@@ -55,6 +55,44 @@ func (s *PumpSuite) TestPump(c *gc.C) {
 	<-reader.closeCh
 }
 
+func (s *PumpSuite) TestPumpWithStampedFraming(c *gc.C) {
+	var framing = topic.NewStampedFraming(topic.FixedFraming, topic.NewProducerID())
+
+	var buffer, err = framing.Encode(msgStr("foobar"), nil)
+	c.Assert(err, gc.IsNil)
+
+	var reader = struct {
+		io.Reader
+		closeCh
+	}{bytes.NewReader(buffer), make(closeCh)}
+
+	var getter journal.MockGetter
+	getter.On("Get", journal.ReadArgs{Journal: "a/journal", Offset: 0, Blocking: true}).
+		Return(journal.ReadResult{Offset: 0}, reader).Once()
+
+	var desc = &topic.Description{
+		GetMessage: func() topic.Message {
+			var m msgStr
+			return &m
+		},
+		Framing: framing,
+	}
+
+	var msgCh = make(chan topic.Envelope)
+	var cancelCh = make(chan struct{})
+
+	go newPump(&getter, msgCh, cancelCh).pump(desc, journal.NewMark("a/journal", 0))
+
+	// Expect the message is accompanied by its Stamp.
+	var msg = <-msgCh
+	c.Check(msg.Mark, gc.Equals, journal.NewMark("a/journal", int64(len(buffer))))
+	c.Check(*msg.Message.(*msgStr), gc.Equals, msgStr("foobar"))
+	c.Check(msg.Stamp, gc.Equals, topic.Stamp{Producer: framing.Producer(), Sequence: 1})
+
+	close(cancelCh)
+	<-reader.closeCh
+}
+
 // FixedFraming-compatible string type.
 type msgStr string
 
@@ -1,6 +1,8 @@
 package consumer
 
 import (
+	"os"
+
 	etcd "github.com/coreos/etcd/client"
 	log "github.com/sirupsen/logrus"
 
@@ -9,8 +11,12 @@ import (
 
 type replica struct {
 	shard     ShardID
+	hints     recoverylog.FSMHints
 	player    *recoverylog.Player
 	servingCh chan struct{} // Blocks until replica.serve exists.
+
+	// Directory into which a backup is downloaded, if Runner.BackupStore is set.
+	seedDir string
 }
 
 func newReplica(shard *shard, runner *Runner, tree *etcd.Node) (*replica, error) {
@@ -30,14 +36,21 @@ func newReplica(shard *shard, runner *Runner, tree *etcd.Node) (*replica, error)
 
 	return &replica{
 		shard:     shard.id,
+		hints:     hints,
 		player:    player,
 		servingCh: make(chan struct{}),
+		seedDir:   shard.localDir + ".seed",
 	}, nil
 }
 
 func (r *replica) serve(runner *Runner) {
 	defer close(r.servingCh)
 
+	if runner.BackupStore != nil {
+		defer os.RemoveAll(r.seedDir)
+		r.seedFromBackup(runner)
+	}
+
 	var err = r.player.Play(runner.Gazette)
 
 	if err != nil && err != recoverylog.ErrPlaybackCancelled {
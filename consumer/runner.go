@@ -9,6 +9,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 
+	"github.com/LiveRamp/gazette/cloudstore"
 	"github.com/LiveRamp/gazette/consensus"
 	"github.com/LiveRamp/gazette/journal"
 	"github.com/LiveRamp/gazette/topic"
@@ -39,9 +40,45 @@ type Runner struct {
 	RecoveryLogRoot string
 	// Required number of replicas of the consumer.
 	ReplicaCount int
+	// Optional FileSystem to which Shard databases are backed up, at most once
+	// per BackupInterval. A recovering replica seeds its database from the
+	// most recent backup of the Shard, and then plays only the recovery log
+	// which follows the backup.
+	BackupStore    cloudstore.FileSystem
+	BackupInterval time.Duration
+	// Optional maximum serialized size of a Shard transaction, in bytes. A
+	// transaction which grows beyond it is never committed: the Shard fails
+	// with ErrTransactionTooLarge upon the Consume or Flush which grew it.
+	// Consumers may instead check the transaction as they add to it (see
+	// Shard.CheckTransaction), and abort or otherwise limit it. Zero is
+	// unbounded.
+	MaxTransactionBytes int64
+	// Optional maximum size of a Shard database MANIFEST file, in bytes. The
+	// MANIFEST is rolled (and the recovery log horizon advanced) upon reaching
+	// it. Larger values reduce MANIFEST churn of write-heavy databases, but
+	// lengthen recovery of replicas (see also Shard.CompactRecoveryLog). It may
+	// be at most 64MB: Shards fail to initialize with a larger value. Zero uses
+	// a small default.
+	MaxManifestFileSize uint64
+	// If true, Shards pipeline transactions: a transaction may commit before
+	// the commit barrier of the previous transaction has resolved, rather than
+	// stalling until it does. Commit barriers still resolve in transaction
+	// order, and a barrier which fails also fails those of all following
+	// transactions (see ErrPriorCommitFailed). Pipelining improves throughput
+	// where recovery log appends are slow relative to transaction processing.
+	PipelineCommits bool
+	// If true, messages which Shards publish via the topic.Publisher passed to
+	// Consume and Flush are published exactly once. Messages are staged with
+	// the transaction, and appended only after it commits. Should the master
+	// fail, staged messages which weren't yet appended are published by its
+	// successor.
+	ExactlyOncePublish bool
 
 	Etcd    etcd.Client
 	Gazette journal.Client
+	// Optional KeysAPI used in place of a KeysAPI of |Etcd| (eg, a
+	// consensus.NewV3KeysAPI).
+	EtcdKeysAPI etcd.KeysAPI
 
 	// Optional hooks for notification of Shard lifecycle. These are largely
 	// intended to facilitate testing cases.
@@ -57,6 +94,12 @@ type Runner struct {
 	liveShards   map[ShardID]*shard          // Live shards, by name.
 	zombieShards map[*shard]struct{}         // Cancelled shards which are shutting down.
 
+	topology        Topology              // Current Topology, loaded from Etcd.
+	topologyIndex   uint64                // Etcd ModifiedIndex of |topology|.
+	topologyChanged bool                  // Set if |topology| changed since updateShards.
+	shardSpecs      map[ShardID]ShardSpec // ShardSpecs of |allShards|.
+	releasing       map[ShardID]bool      // Retired shards having a pending lock release.
+
 	inspectCh chan func(*etcd.Node)
 }
 
@@ -126,11 +169,17 @@ func (r *Runner) updateShards() {
 			}
 		}
 	}
-	if !added {
+	if !added && !r.topologyChanged {
 		return
 	}
+	r.topologyChanged = false
+
+	r.shardSpecs = EnumerateShardSpecs(r.Consumer, r.topology)
+	r.allShards = make(map[ShardID]topic.Partition, len(r.shardSpecs))
 
-	r.allShards = EnumerateShards(r.Consumer)
+	for id, spec := range r.shardSpecs {
+		r.allShards[id] = topic.Partition{Topic: r.partitions[spec.Journal], Journal: spec.Journal}
+	}
 
 	var names []string
 	for id := range r.allShards {
@@ -149,6 +198,8 @@ func (r *Runner) Run() error {
 	r.allShards = make(map[ShardID]topic.Partition)
 	r.liveShards = make(map[ShardID]*shard)
 	r.zombieShards = make(map[*shard]struct{})
+	r.shardSpecs = make(map[ShardID]ShardSpec)
+	r.releasing = make(map[ShardID]bool)
 	r.inspectCh = make(chan func(*etcd.Node))
 
 	var err = consensus.CreateAndAllocateWithSignalHandling(r)
@@ -178,10 +229,15 @@ func (r *Runner) FixedItems() []string {
 	r.updateShards()
 	return r.shardNames
 }
-func (r *Runner) InstanceKey() string   { return r.LocalRouteKey }
-func (r *Runner) KeysAPI() etcd.KeysAPI { return etcd.NewKeysAPI(r.Etcd) }
-func (r *Runner) PathRoot() string      { return r.ConsumerRoot }
-func (r *Runner) Replicas() int         { return r.ReplicaCount }
+func (r *Runner) InstanceKey() string { return r.LocalRouteKey }
+func (r *Runner) KeysAPI() etcd.KeysAPI {
+	if r.EtcdKeysAPI != nil {
+		return r.EtcdKeysAPI
+	}
+	return etcd.NewKeysAPI(r.Etcd)
+}
+func (r *Runner) PathRoot() string { return r.ConsumerRoot }
+func (r *Runner) Replicas() int    { return r.ReplicaCount }
 
 func (r *Runner) ItemState(name string) string {
 	if shard, ok := r.liveShards[ShardID(name)]; !ok {
@@ -199,10 +255,39 @@ func (r *Runner) ItemIsReadyForPromotion(item, state string) bool {
 	return state == Ready
 }
 
+// consensus.TreeObserver implementation.
+func (r *Runner) ObserveTree(tree *etcd.Node) {
+	var topology, index, err = LoadTopology(tree)
+	if err != nil {
+		log.WithField("err", err).Warn("failed to load consumer topology")
+		return
+	} else if index != r.topologyIndex {
+		r.topology, r.topologyIndex = topology, index
+		r.topologyChanged = true
+	}
+}
+
 func (r *Runner) ItemRoute(name string, rt consensus.Route, index int, tree *etcd.Node) {
 	var id = ShardID(name)
+
+	if r.topology.Retired[id] {
+		r.retireShard(id, rt, index)
+		return
+	}
 	var current, exists = r.liveShards[id]
 
+	// A replica of a split or merged shard which is playing the recovery log
+	// of a parent must restart once the shard's own log has been forked (by its
+	// master), as it would otherwise never observe further recorded operations.
+	if exists && index > 0 && current.hasStaleFork(r, tree) {
+		log.WithField("shard", id).Info("restarting replica of forked recovery log")
+
+		current.transitionCancel()
+		delete(r.liveShards, id)
+		r.zombieShards[current] = struct{}{}
+		exists = false
+	}
+
 	// |index| captures the allocator's role in processing |current|.
 	var isMaster, isReplica = (index == 0), (index > 0 && index <= r.ReplicaCount)
 
@@ -249,3 +334,32 @@ func (r *Runner) ItemRoute(name string, rt consensus.Route, index int, tree *etc
 }
 
 func (r *Runner) InspectChan() chan func(*etcd.Node) { return r.inspectCh }
+
+// retireShard cancels a local instance of retired Shard |id|. Once it has
+// halted, the held item lock at |index| of |rt| is released, and once no
+// locks of the item remain, its Etcd item directory is removed.
+func (r *Runner) retireShard(id ShardID, rt consensus.Route, index int) {
+	if current, ok := r.liveShards[id]; ok {
+		current.transitionCancel()
+		delete(r.liveShards, id)
+		r.zombieShards[current] = struct{}{}
+	}
+
+	if index == -1 {
+		delete(r.releasing, id)
+
+		if rt.Item != nil && len(rt.Entries) == 0 {
+			go removeItemDir(r, rt.Item.Key)
+		}
+		return
+	}
+	for s := range r.zombieShards {
+		if s.id == id && !s.hasHalted() {
+			return // Release only after the instance has halted.
+		}
+	}
+	if !r.releasing[id] {
+		r.releasing[id] = true
+		go abort(r, id)
+	}
+}
@@ -23,6 +23,7 @@ const (
 type shard struct {
 	id        ShardID
 	partition topic.Partition
+	spec      ShardSpec
 
 	localDir string
 	state    shardState
@@ -41,10 +42,15 @@ type shard struct {
 }
 
 func newShard(id ShardID, partition topic.Partition, runner *Runner, zombie *shard) *shard {
+	var spec, ok = runner.shardSpecs[id]
+	if !ok {
+		spec = ShardSpec{ID: id, Journal: partition.Journal, Range: FullKeyRange}
+	}
 	return &shard{
 		cancelCh:  make(chan struct{}),
 		id:        id,
 		partition: partition,
+		spec:      spec,
 		localDir:  filepath.Join(runner.LocalDir, id.String()),
 		state:     shardStateInit,
 		zombie:    zombie,
@@ -151,3 +157,16 @@ func (s *shard) hasHalted() bool {
 	}
 	return true
 }
+
+// Returns whether the shard is a replica playing the recovery log of a parent
+// Shard, though the Shard's master has since forked its own recovery log
+// (see ShardSpec). Called from Allocate() goroutine.
+func (s *shard) hasStaleFork(runner *Runner, tree *etcd.Node) bool {
+	var own = recoveryLog(runner.RecoveryLogRoot, s.id)
+
+	if s.state != shardStateReplica || s.replica == nil || s.replica.hints.Log == own {
+		return false
+	}
+	var hints, err = loadHintsFromEtcd(s.id, runner, tree)
+	return err == nil && hints.Log == own
+}
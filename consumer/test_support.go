@@ -7,7 +7,6 @@ import (
 	"os"
 
 	log "github.com/sirupsen/logrus"
-	rocks "github.com/tecbot/gorocksdb"
 
 	"github.com/LiveRamp/gazette/journal"
 	"github.com/LiveRamp/gazette/recoverylog"
@@ -39,7 +38,7 @@ func resetShard(runner *Runner, id ShardID, partition topic.Partition) error {
 	log.WithFields(log.Fields{"partition": partition.Journal, "offset": offset}).
 		Info("resetting logs to write heads")
 
-	var options = rocks.NewDefaultOptions()
+	var options = newDefaultOptions()
 	defer options.Destroy()
 
 	// Initialize a database for the Shard at the recovery-log head which
@@ -57,15 +56,15 @@ func resetShard(runner *Runner, id ShardID, partition topic.Partition) error {
 	}
 	defer os.RemoveAll(localDir)
 
-	// Open the database & store offsets,
-	db, err := newDatabase(options, fsm, localDir, runner.Gazette)
+	// Open the database. Column families are created by the
+	// master when the Shard is next initialized.
+	db, err := newDatabase(options, fsm, localDir, runner.Gazette, nil)
 	if err != nil {
 		return err
 	}
-	storeOffsetsToDB(db.writeBatch, map[journal.Name]int64{partition.Journal: offset})
 
-	// Commit, and store resulting hints to Etcd.
-	barrier, err := db.commit()
+	// Commit offsets, and store resulting hints to Etcd.
+	barrier, err := db.commit(map[journal.Name]int64{partition.Journal: offset})
 	if err != nil {
 		return err
 	}
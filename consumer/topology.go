@@ -0,0 +1,306 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	etcd "github.com/coreos/etcd/client"
+
+	"github.com/LiveRamp/gazette/consensus"
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/recoverylog"
+)
+
+// Etcd key, under the consumer root, of the JSON-encoded consumer Topology.
+const topologyKey = "topology"
+
+// Error returned by Runner.SplitShard and Runner.MergeShards if the Topology
+// was concurrently modified by another party.
+var ErrTopologyConflict = errors.New("consumer topology was concurrently modified")
+
+// KeyRange is an inclusive range of message key hashes (see KeyHasher).
+type KeyRange struct {
+	Begin, End uint32
+}
+
+// FullKeyRange is the KeyRange of every message key hash. It's the KeyRange
+// of each Shard which hasn't been split.
+var FullKeyRange = KeyRange{Begin: 0, End: math.MaxUint32}
+
+// Contains returns whether |hash| falls within the KeyRange.
+func (r KeyRange) Contains(hash uint32) bool { return hash >= r.Begin && hash <= r.End }
+
+// split divides the KeyRange into two halves. It returns false if the
+// KeyRange is a single hash, and cannot be split.
+func (r KeyRange) split() (KeyRange, KeyRange, bool) {
+	if r.Begin == r.End {
+		return r, r, false
+	}
+	var mid = r.Begin + (r.End-r.Begin)/2
+	return KeyRange{r.Begin, mid}, KeyRange{mid + 1, r.End}, true
+}
+
+// ShardSpec describes a Shard which was created by splitting or merging
+// other Shards. Such a Shard consumes only messages of its Journal having a
+// key hash within its Range.
+type ShardSpec struct {
+	ID ShardID
+	// Consumed Journal of the Shard.
+	Journal journal.Name
+	// Range of message key hashes consumed by the Shard.
+	Range KeyRange
+	// Shards from which the Shard was split or merged. The database of the
+	// Shard is initialized from those of its parents: a split Shard from its
+	// single parent, and a merged Shard from each of its parents.
+	Parents []ParentShard `json:",omitempty"`
+}
+
+// ParentShard is a parent of a split or merged Shard.
+type ParentShard struct {
+	ID ShardID
+	// Range of message key hashes consumed by the parent.
+	Range KeyRange
+}
+
+// Topology records the Shards of a consumer which have been split or merged.
+// It's stored under the consumer root in Etcd, and consulted by each Runner
+// when enumerating Shards.
+type Topology struct {
+	// Shards created by splits and merges, including those which have since
+	// been retired by a further split or merge.
+	Shards map[ShardID]ShardSpec `json:",omitempty"`
+	// Shards which have been retired by a split or merge, and are no longer
+	// served.
+	Retired map[ShardID]bool `json:",omitempty"`
+	// Number of applied splits and merges, which is used to generate unique
+	// ShardIDs.
+	Generation int
+}
+
+// LoadTopology loads the Topology stored under consumer |tree|, and returns
+// it with the Etcd ModifiedIndex of its key. If no Topology is stored, an
+// empty Topology and zero index are returned.
+func LoadTopology(tree *etcd.Node) (Topology, uint64, error) {
+	var topology Topology
+	var key = tree.Key + "/" + topologyKey
+	var parent, i = consensus.FindNode(tree, key)
+
+	if i < len(parent.Nodes) && parent.Nodes[i].Key == key {
+		if err := json.Unmarshal([]byte(parent.Nodes[i].Value), &topology); err != nil {
+			return Topology{}, 0, err
+		}
+		return topology, parent.Nodes[i].ModifiedIndex, nil
+	}
+	return topology, 0, nil
+}
+
+// EnumerateShardSpecs returns ShardSpecs of the Shards of Consumer |c| under
+// |topology|: those of Partitions of the Consumer's Topics (see
+// EnumerateShards) which haven't been retired, and those created by splits and
+// merges of them which haven't been retired.
+func EnumerateShardSpecs(c Consumer, topology Topology) map[ShardID]ShardSpec {
+	var out = make(map[ShardID]ShardSpec)
+	var journals = make(map[journal.Name]bool)
+
+	for id, partition := range EnumerateShards(c) {
+		journals[partition.Journal] = true
+
+		if !topology.Retired[id] {
+			out[id] = ShardSpec{ID: id, Journal: partition.Journal, Range: FullKeyRange}
+		}
+	}
+	for id, spec := range topology.Shards {
+		if !topology.Retired[id] && journals[spec.Journal] {
+			out[id] = spec
+		}
+	}
+	return out
+}
+
+// SplitShard splits Shard |id| into two Shards, which each consume half of its
+// range of message key hashes, and returns their IDs. The Consumer must be a
+// KeyHasher. The recovery hints of |id| are duplicated to each new Shard,
+// and |id| is retired: it's cancelled by its current Runners, and upon its
+// exit the new Shards begin serving. Each recovers the database of |id|
+// through the end of its recovery log, and then forks the database into its
+// own recovery log before consuming further messages.
+func (r *Runner) SplitShard(id ShardID) ([]ShardID, error) {
+	if _, ok := r.Consumer.(KeyHasher); !ok {
+		return nil, errors.New("consumer doesn't implement KeyHasher")
+	}
+	var topology, index, err = r.fetchTopology()
+	if err != nil {
+		return nil, err
+	}
+	spec, err := r.shardSpec(topology, id)
+	if err != nil {
+		return nil, err
+	}
+	var lo, hi, ok = spec.Range.split()
+	if !ok {
+		return nil, fmt.Errorf("shard %s key range cannot be split", id)
+	}
+	topology.Generation += 1
+
+	var parents = []ParentShard{{ID: id, Range: spec.Range}}
+	var children = []ShardSpec{
+		{ID: r.newShardID(topology, spec.Journal, 0), Journal: spec.Journal, Range: lo, Parents: parents},
+		{ID: r.newShardID(topology, spec.Journal, 1), Journal: spec.Journal, Range: hi, Parents: parents},
+	}
+	if err = r.applyTopology(topology, index, children, []ShardID{id}); err != nil {
+		return nil, err
+	}
+	return []ShardID{children[0].ID, children[1].ID}, nil
+}
+
+// MergeShards merges Shards |a| and |b|, which must consume adjacent ranges
+// of message key hashes of the same Journal, into a single Shard, and returns
+// its ID. The recovery hints of the lower range are duplicated to the new
+// Shard, and |a| and |b| are retired. Upon their exit, the new Shard recovers
+// and forks the database of the lower range, and then copies into it the
+// database of the upper range. Database keys of the merged Shards must be
+// disjoint (eg, because they're derived from message keys). Messages which
+// either parent had already consumed are not consumed again.
+func (r *Runner) MergeShards(a, b ShardID) (ShardID, error) {
+	var topology, index, err = r.fetchTopology()
+	if err != nil {
+		return "", err
+	}
+	specA, err := r.shardSpec(topology, a)
+	if err != nil {
+		return "", err
+	}
+	specB, err := r.shardSpec(topology, b)
+	if err != nil {
+		return "", err
+	}
+
+	if specA.Range.Begin > specB.Range.Begin {
+		specA, specB = specB, specA
+	}
+	if specA.Journal != specB.Journal {
+		return "", fmt.Errorf("shards %s and %s consume different journals", a, b)
+	} else if specA.Range.End == math.MaxUint32 || specA.Range.End+1 != specB.Range.Begin {
+		return "", fmt.Errorf("shards %s and %s have non-adjacent key ranges", a, b)
+	}
+	topology.Generation += 1
+
+	var merged = ShardSpec{
+		ID:      r.newShardID(topology, specA.Journal, 0),
+		Journal: specA.Journal,
+		Range:   KeyRange{Begin: specA.Range.Begin, End: specB.Range.End},
+		Parents: []ParentShard{
+			{ID: specA.ID, Range: specA.Range},
+			{ID: specB.ID, Range: specB.Range},
+		},
+	}
+	if err = r.applyTopology(topology, index, []ShardSpec{merged}, []ShardID{a, b}); err != nil {
+		return "", err
+	}
+	return merged.ID, nil
+}
+
+// newShardID returns the ID of the |n|th Shard of |journal| created by the
+// current Generation of |topology|. It extends the ShardID of the Journal's
+// Partition (eg, "shard-my-topic-123-g4-1").
+func (r *Runner) newShardID(topology Topology, journal journal.Name, n int) ShardID {
+	var base = ShardID(journal.String())
+
+	for id, partition := range EnumerateShards(r.Consumer) {
+		if partition.Journal == journal {
+			base = id
+		}
+	}
+	return ShardID(fmt.Sprintf("%s-g%d-%d", base, topology.Generation, n))
+}
+
+// shardSpec returns the ShardSpec of current Shard |id| under |topology|.
+func (r *Runner) shardSpec(topology Topology, id ShardID) (ShardSpec, error) {
+	if spec, ok := EnumerateShardSpecs(r.Consumer, topology)[id]; ok {
+		return spec, nil
+	}
+	return ShardSpec{}, fmt.Errorf("shard %s is not a current shard", id)
+}
+
+// fetchTopology returns the current Topology of the consumer and its Etcd
+// ModifiedIndex.
+func (r *Runner) fetchTopology() (Topology, uint64, error) {
+	var topology Topology
+
+	var resp, err = r.KeysAPI().Get(context.Background(), r.topologyPath(), nil)
+	if etcdErr, ok := err.(etcd.Error); ok && etcdErr.Code == etcd.ErrorCodeKeyNotFound {
+		return topology, 0, nil
+	} else if err != nil {
+		return topology, 0, err
+	} else if err = json.Unmarshal([]byte(resp.Node.Value), &topology); err != nil {
+		return topology, 0, err
+	}
+	return topology, resp.Node.ModifiedIndex, nil
+}
+
+// applyTopology duplicates the hints of the first parent of each of |added|,
+// and then stores |topology| with |added| Shards and |retired| Shards. The
+// Topology must not have been modified since it was fetched at |index|.
+func (r *Runner) applyTopology(topology Topology, index uint64, added []ShardSpec, retired []ShardID) error {
+	if topology.Shards == nil {
+		topology.Shards = make(map[ShardID]ShardSpec)
+	}
+	if topology.Retired == nil {
+		topology.Retired = make(map[ShardID]bool)
+	}
+
+	for _, spec := range added {
+		var hints, err = r.fetchHints(spec.Parents[0].ID)
+		if err != nil {
+			return err
+		} else if err = prepAndStoreHintsToEtcd(hints, hintsPath(r.ConsumerRoot, spec.ID), r.KeysAPI()); err != nil {
+			return err
+		}
+		topology.Shards[spec.ID] = spec
+	}
+	for _, id := range retired {
+		topology.Retired[id] = true
+	}
+
+	var b, err = json.Marshal(topology)
+	if err != nil {
+		return err
+	}
+
+	var opts = &etcd.SetOptions{PrevExist: etcd.PrevNoExist}
+	if index != 0 {
+		opts = &etcd.SetOptions{PrevExist: etcd.PrevExist, PrevIndex: index}
+	}
+	_, err = r.KeysAPI().Set(context.Background(), r.topologyPath(), string(b), opts)
+
+	if etcdErr, ok := err.(etcd.Error); ok &&
+		(etcdErr.Code == etcd.ErrorCodeTestFailed || etcdErr.Code == etcd.ErrorCodeNodeExist) {
+		return ErrTopologyConflict
+	}
+	return err
+}
+
+// fetchHints returns the FSMHints currently stored for |shard|, or hints of
+// its empty recovery log if none are stored.
+func (r *Runner) fetchHints(shard ShardID) (recoverylog.FSMHints, error) {
+	var hints recoverylog.FSMHints
+
+	var resp, err = r.KeysAPI().Get(context.Background(), hintsPath(r.ConsumerRoot, shard), nil)
+	if etcdErr, ok := err.(etcd.Error); ok && etcdErr.Code == etcd.ErrorCodeKeyNotFound {
+		// Pass.
+	} else if err != nil {
+		return hints, err
+	} else if err = json.Unmarshal([]byte(resp.Node.Value), &hints); err != nil {
+		return hints, err
+	}
+
+	if hints.Log == "" {
+		hints.Log = recoveryLog(r.RecoveryLogRoot, shard)
+	}
+	return hints, nil
+}
+
+func (r *Runner) topologyPath() string { return r.ConsumerRoot + "/" + topologyKey }
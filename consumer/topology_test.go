@@ -0,0 +1,153 @@
+package consumer
+
+import (
+	"encoding/json"
+	"math"
+
+	etcd "github.com/coreos/etcd/client"
+	gc "github.com/go-check/check"
+
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/topic"
+)
+
+type TopologySuite struct{}
+
+func (s *TopologySuite) TestKeyRangeSplit(c *gc.C) {
+	var lo, hi, ok = FullKeyRange.split()
+	c.Check(ok, gc.Equals, true)
+	c.Check(lo, gc.Equals, KeyRange{Begin: 0, End: math.MaxUint32 / 2})
+	c.Check(hi, gc.Equals, KeyRange{Begin: math.MaxUint32/2 + 1, End: math.MaxUint32})
+
+	c.Check(lo.Contains(0), gc.Equals, true)
+	c.Check(lo.Contains(math.MaxUint32/2), gc.Equals, true)
+	c.Check(lo.Contains(math.MaxUint32/2+1), gc.Equals, false)
+	c.Check(hi.Contains(math.MaxUint32), gc.Equals, true)
+
+	lo, hi, ok = KeyRange{Begin: 10, End: 11}.split()
+	c.Check(ok, gc.Equals, true)
+	c.Check(lo, gc.Equals, KeyRange{Begin: 10, End: 10})
+	c.Check(hi, gc.Equals, KeyRange{Begin: 11, End: 11})
+
+	_, _, ok = lo.split()
+	c.Check(ok, gc.Equals, false)
+}
+
+func (s *TopologySuite) TestLoadTopology(c *gc.C) {
+	var tree = &etcd.Node{Key: "/foo", Dir: true}
+
+	// An absent Topology loads as empty.
+	var topology, index, err = LoadTopology(tree)
+	c.Check(err, gc.IsNil)
+	c.Check(index, gc.Equals, uint64(0))
+	c.Check(topology, gc.DeepEquals, Topology{})
+
+	b, _ := json.Marshal(s.topologyFixture())
+	tree.Nodes = etcd.Nodes{{Key: "/foo/topology", Value: string(b), ModifiedIndex: 1234}}
+
+	topology, index, err = LoadTopology(tree)
+	c.Check(err, gc.IsNil)
+	c.Check(index, gc.Equals, uint64(1234))
+	c.Check(topology, gc.DeepEquals, s.topologyFixture())
+
+	tree.Nodes[0].Value = "... malformed ..."
+	_, _, err = LoadTopology(tree)
+	c.Check(err, gc.ErrorMatches, "invalid character .*")
+}
+
+func (s *TopologySuite) TestEnumerateShardSpecs(c *gc.C) {
+	var specs = EnumerateShardSpecs(&testConsumer{}, s.topologyFixture())
+	c.Check(specs, gc.HasLen, 8)
+
+	// Retired shards are not enumerated.
+	for _, id := range []ShardID{"shard-reverse-in-001", "shard-reverse-in-001-g1-0"} {
+		var _, ok = specs[id]
+		c.Check(ok, gc.Equals, false)
+	}
+
+	c.Check(specs["shard-reverse-in-000"], gc.DeepEquals, ShardSpec{
+		ID:      "shard-reverse-in-000",
+		Journal: "pippio-journals/integration-tests/reverse-in/part-000",
+		Range:   FullKeyRange,
+	})
+	c.Check(specs["shard-reverse-in-001-g1-1"], gc.DeepEquals,
+		s.topologyFixture().Shards["shard-reverse-in-001-g1-1"])
+	c.Check(specs["shard-reverse-in-001-g2-0"], gc.DeepEquals,
+		s.topologyFixture().Shards["shard-reverse-in-001-g2-0"])
+}
+
+func (s *TopologySuite) TestMessageFilter(c *gc.C) {
+	// Without a key range or rules, no filter is required.
+	var filter, err = newMessageFilter(&testConsumer{}, FullKeyRange, nil)
+	c.Check(err, gc.IsNil)
+	c.Check(filter, gc.IsNil)
+	c.Check(filter.skips(topic.Envelope{}), gc.Equals, false)
+
+	// A Consumer which isn't a KeyHasher cannot consume a partial range.
+	_, err = newMessageFilter(&testConsumer{}, KeyRange{Begin: 0, End: 100}, nil)
+	c.Check(err, gc.ErrorMatches, "consumer of key range .* doesn't implement KeyHasher")
+
+	filter, err = newMessageFilter(&offsetHasher{}, KeyRange{Begin: 100, End: 299}, []skipRule{
+		{Range: KeyRange{Begin: 200, End: 299}, Offset: 1000},
+	})
+	c.Check(err, gc.IsNil)
+
+	var env = func(offset int64) topic.Envelope {
+		return topic.Envelope{Mark: journal.Mark{Journal: "a/journal", Offset: offset}}
+	}
+	// Outside of the filter key range.
+	c.Check(filter.skips(env(99)), gc.Equals, true)
+	c.Check(filter.skips(env(300)), gc.Equals, true)
+	// Within range, and not covered by a rule.
+	c.Check(filter.skips(env(100)), gc.Equals, false)
+	c.Check(filter.skips(env(199)), gc.Equals, false)
+	// Covered by the rule.
+	c.Check(filter.skips(env(200)), gc.Equals, true)
+	c.Check(filter.skips(env(299)), gc.Equals, true)
+}
+
+func (s *TopologySuite) topologyFixture() Topology {
+	var name = journal.Name("pippio-journals/integration-tests/reverse-in/part-001")
+	var lo, hi, _ = FullKeyRange.split()
+
+	return Topology{
+		Shards: map[ShardID]ShardSpec{
+			"shard-reverse-in-001-g1-0": {
+				ID:      "shard-reverse-in-001-g1-0",
+				Journal: name,
+				Range:   lo,
+				Parents: []ParentShard{{ID: "shard-reverse-in-001", Range: FullKeyRange}},
+			},
+			"shard-reverse-in-001-g1-1": {
+				ID:      "shard-reverse-in-001-g1-1",
+				Journal: name,
+				Range:   hi,
+				Parents: []ParentShard{{ID: "shard-reverse-in-001", Range: FullKeyRange}},
+			},
+			"shard-reverse-in-001-g2-0": {
+				ID:      "shard-reverse-in-001-g2-0",
+				Journal: name,
+				Range:   lo,
+				Parents: []ParentShard{{ID: "shard-reverse-in-001-g1-0", Range: lo}},
+			},
+			// A Shard of a Journal which is no longer consumed.
+			"shard-retired-topic-000-g1-0": {
+				ID:      "shard-retired-topic-000-g1-0",
+				Journal: "a/retired/topic/part-000",
+				Range:   lo,
+			},
+		},
+		Retired: map[ShardID]bool{
+			"shard-reverse-in-001":      true,
+			"shard-reverse-in-001-g1-0": true,
+		},
+		Generation: 2,
+	}
+}
+
+// offsetHasher is a KeyHasher which hashes a message to its offset.
+type offsetHasher struct{ testConsumer }
+
+func (offsetHasher) KeyHash(env topic.Envelope) uint32 { return uint32(env.Mark.Offset) }
+
+var _ = gc.Suite(&TopologySuite{})
@@ -0,0 +1,240 @@
+package gazette
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// Verb is an operation of a broker request, which is authorized against the
+// journal it names.
+type Verb string
+
+const (
+	VerbRead      Verb = "read"
+	VerbAppend    Verb = "append"
+	VerbReplicate Verb = "replicate"
+	VerbCreate    Verb = "create"
+	VerbDelete    Verb = "delete"
+	VerbDrain     Verb = "drain" // Of the broker, rather than a journal.
+)
+
+// Authorizer authorizes requests of broker endpoints. Authorize is invoked
+// for each Read (and Head), Append, Replicate, Create, Delete, and Drain
+// request, with the bearer |token| presented by the request (which may be
+// empty), and the |verb| and journal |name| of the request. It returns nil if the request is
+// permitted, and otherwise an error (typically journal.ErrUnauthorized) with
+// which the request fails.
+type Authorizer interface {
+	Authorize(token string, name journal.Name, verb Verb) error
+}
+
+// AuthorizerFunc adapts a function to an Authorizer.
+type AuthorizerFunc func(token string, name journal.Name, verb Verb) error
+
+// Authorize invokes the AuthorizerFunc.
+func (f AuthorizerFunc) Authorize(token string, name journal.Name, verb Verb) error {
+	return f(token, name, verb)
+}
+
+// NewAuthorizingHandler returns an http.Handler which authorizes requests of
+// the ReadAPI, WriteAPI, ReplicateAPI, CreateAPI, DeleteAPI, and DrainAPI with
+// |auth| before passing them to |next|. Unauthorized requests fail with the
+// HTTP status of the Authorize error (for journal.ErrUnauthorized, 401).
+// Requests of other methods are passed through.
+func NewAuthorizingHandler(auth Authorizer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var verb Verb
+
+		switch r.Method {
+		case "HEAD", "GET":
+			verb = VerbRead
+		case "PUT":
+			verb = VerbAppend
+		case "REPLICATE":
+			verb = VerbReplicate
+		case "POST":
+			verb = VerbCreate
+		case "DELETE":
+			verb = VerbDelete
+		case "DRAIN":
+			verb = VerbDrain
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var name = journal.Name(strings.TrimPrefix(r.URL.Path, "/"))
+		if err := auth.Authorize(bearerToken(r.Header.Get("Authorization")), name, verb); err != nil {
+			observeServerRequest(string(verb), err)
+			http.Error(w, err.Error(), journal.StatusCodeForError(err))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SetReplicateClientToken sets the bearer token presented by ReplicateClients
+// to peer brokers, which must be authorized for VerbReplicate of journals the
+// broker brokers. An empty |token| presents no token.
+func SetReplicateClientToken(token string) {
+	replicateTokenMu.Lock()
+	replicateToken = token
+	replicateTokenMu.Unlock()
+}
+
+// bearerToken returns the token of an Authorization |header| value.
+func bearerToken(header string) string {
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return header[7:]
+	}
+	return ""
+}
+
+// TokenClaims are claims of a token of an HMACAuthorizer. Each of Read,
+// Append, Replicate, Create, and Delete are journal name prefixes for which the
+// respective Verb is permitted. An empty prefix permits all journals. Drain
+// permits VerbDrain.
+type TokenClaims struct {
+	// Subject (eg, the service) to which the token was issued.
+	Subject string `json:"sub,omitempty"`
+	// Expiry of the token, in Unix seconds. Zero never expires.
+	ExpiresAt int64 `json:"exp,omitempty"`
+
+	Read      []string `json:"read,omitempty"`
+	Append    []string `json:"append,omitempty"`
+	Replicate []string `json:"replicate,omitempty"`
+	Create    []string `json:"create,omitempty"`
+	Delete    []string `json:"delete,omitempty"`
+	Drain     bool     `json:"drain,omitempty"`
+}
+
+// HMACAuthorizer is an Authorizer of JSON Web Tokens, signed with HMAC
+// SHA-256 (the "HS256" algorithm) under a shared key, and having TokenClaims.
+// A request is authorized if its token is validly signed and unexpired, and
+// its claims permit the request Verb for a prefix of the journal.
+type HMACAuthorizer struct {
+	key []byte
+	// Returns the current time. Overridden by tests.
+	now func() time.Time
+}
+
+// NewHMACAuthorizer returns an HMACAuthorizer of tokens signed by |key|.
+func NewHMACAuthorizer(key []byte) *HMACAuthorizer {
+	return &HMACAuthorizer{key: key, now: time.Now}
+}
+
+// Authorize implements Authorizer.
+func (a *HMACAuthorizer) Authorize(token string, name journal.Name, verb Verb) error {
+	var claims, err = a.verify(token)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err, "journal": name, "verb": verb}).
+			Debug("rejected token")
+		return journal.ErrUnauthorized
+	}
+
+	var prefixes []string
+	switch verb {
+	case VerbRead:
+		prefixes = claims.Read
+	case VerbAppend:
+		prefixes = claims.Append
+	case VerbReplicate:
+		prefixes = claims.Replicate
+	case VerbCreate:
+		prefixes = claims.Create
+	case VerbDelete:
+		prefixes = claims.Delete
+	case VerbDrain:
+		if claims.Drain {
+			return nil
+		}
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name.String(), prefix) {
+			return nil
+		}
+	}
+	return journal.ErrUnauthorized
+}
+
+// Sign returns a token of |claims|, signed by the key of the HMACAuthorizer.
+func (a *HMACAuthorizer) Sign(claims TokenClaims) (string, error) {
+	var payload, err = json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	var signed = hmacTokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(a.mac(signed)), nil
+}
+
+// verify checks the signature and expiry of |token|, and returns its claims.
+func (a *HMACAuthorizer) verify(token string) (TokenClaims, error) {
+	var claims TokenClaims
+
+	var parts = strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errMalformedToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if b, err := base64.RawURLEncoding.DecodeString(parts[0]); err != nil {
+		return claims, errMalformedToken
+	} else if err = json.Unmarshal(b, &header); err != nil {
+		return claims, errMalformedToken
+	} else if header.Alg != "HS256" {
+		// Only the HS256 algorithm is accepted. Notably, tokens may not
+		// select another algorithm (eg, "none").
+		return claims, errMalformedToken
+	}
+
+	var sig, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errMalformedToken
+	} else if !hmac.Equal(sig, a.mac(parts[0]+"."+parts[1])) {
+		return claims, errBadSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, errMalformedToken
+	} else if err = json.Unmarshal(payload, &claims); err != nil {
+		return claims, err
+	}
+
+	if claims.ExpiresAt != 0 && a.now().Unix() >= claims.ExpiresAt {
+		return claims, errExpiredToken
+	}
+	return claims, nil
+}
+
+func (a *HMACAuthorizer) mac(signed string) []byte {
+	var h = hmac.New(sha256.New, a.key)
+	h.Write([]byte(signed))
+	return h.Sum(nil)
+}
+
+var (
+	// Encoded JOSE header of HS256 tokens: {"alg":"HS256","typ":"JWT"}.
+	hmacTokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+	errMalformedToken = errors.New("malformed token")
+	errBadSignature   = errors.New("invalid token signature")
+	errExpiredToken   = errors.New("expired token")
+
+	// Bearer token of ReplicateClient requests. See SetReplicateClientToken.
+	replicateToken   string
+	replicateTokenMu sync.Mutex
+)
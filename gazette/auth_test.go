@@ -0,0 +1,144 @@
+package gazette
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	gc "github.com/go-check/check"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type AuthSuite struct{}
+
+func (s *AuthSuite) TestHMACAuthorizerGrants(c *gc.C) {
+	var auth = NewHMACAuthorizer([]byte("secret"))
+
+	var token, err = auth.Sign(TokenClaims{
+		Subject: "a-service",
+		Read:    []string{""},
+		Append:  []string{"foo/", "bar/baz"},
+	})
+	c.Assert(err, gc.IsNil)
+
+	var cases = []struct {
+		name   journal.Name
+		verb   Verb
+		expect error
+	}{
+		{"foo/bar", VerbRead, nil},
+		{"other/journal", VerbRead, nil},
+		{"foo/bar", VerbAppend, nil},
+		{"bar/bazzle", VerbAppend, nil},
+		{"bar/bat", VerbAppend, journal.ErrUnauthorized},
+		{"other/journal", VerbAppend, journal.ErrUnauthorized},
+		{"foo/bar", VerbReplicate, journal.ErrUnauthorized},
+		{"foo/bar", VerbCreate, journal.ErrUnauthorized},
+		{"foo/bar", VerbDelete, journal.ErrUnauthorized},
+		{"", VerbDrain, journal.ErrUnauthorized},
+	}
+	for _, tc := range cases {
+		c.Check(auth.Authorize(token, tc.name, tc.verb), gc.Equals, tc.expect)
+	}
+
+	// Drain is granted independently of journal prefixes.
+	token, err = auth.Sign(TokenClaims{Subject: "an-operator", Drain: true})
+	c.Assert(err, gc.IsNil)
+
+	c.Check(auth.Authorize(token, "", VerbDrain), gc.IsNil)
+	c.Check(auth.Authorize(token, "foo/bar", VerbRead), gc.Equals, journal.ErrUnauthorized)
+}
+
+func (s *AuthSuite) TestHMACAuthorizerRejectsInvalidTokens(c *gc.C) {
+	var auth = NewHMACAuthorizer([]byte("secret"))
+	var claims = TokenClaims{Append: []string{""}, ExpiresAt: 1000}
+
+	auth.now = func() time.Time { return time.Unix(999, 0) }
+
+	var token, err = auth.Sign(claims)
+	c.Assert(err, gc.IsNil)
+	c.Check(auth.Authorize(token, "a/journal", VerbAppend), gc.IsNil)
+
+	// Expired.
+	auth.now = func() time.Time { return time.Unix(1000, 0) }
+	c.Check(auth.Authorize(token, "a/journal", VerbAppend), gc.Equals, journal.ErrUnauthorized)
+	auth.now = time.Now
+
+	claims.ExpiresAt = 0
+
+	// Signed by another key.
+	other, err := NewHMACAuthorizer([]byte("other")).Sign(claims)
+	c.Assert(err, gc.IsNil)
+	c.Check(auth.Authorize(other, "a/journal", VerbAppend), gc.Equals, journal.ErrUnauthorized)
+
+	// Claims modified after signing.
+	token, err = auth.Sign(TokenClaims{Read: []string{""}})
+	c.Assert(err, gc.IsNil)
+	var parts = strings.Split(token, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"append":[""]}`))
+	c.Check(auth.Authorize(strings.Join(parts, "."), "a/journal", VerbAppend),
+		gc.Equals, journal.ErrUnauthorized)
+
+	// Unsigned, with the "none" algorithm.
+	parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	parts[2] = ""
+	c.Check(auth.Authorize(strings.Join(parts, "."), "a/journal", VerbAppend),
+		gc.Equals, journal.ErrUnauthorized)
+
+	// Missing or malformed.
+	c.Check(auth.Authorize("", "a/journal", VerbRead), gc.Equals, journal.ErrUnauthorized)
+	c.Check(auth.Authorize("a.b.c", "a/journal", VerbRead), gc.Equals, journal.ErrUnauthorized)
+}
+
+func (s *AuthSuite) TestAuthorizingHandler(c *gc.C) {
+	type call struct {
+		token string
+		name  journal.Name
+		verb  Verb
+	}
+	var calls []call
+
+	var auth = AuthorizerFunc(func(token string, name journal.Name, verb Verb) error {
+		calls = append(calls, call{token, name, verb})
+		if token != "good" {
+			return journal.ErrUnauthorized
+		}
+		return nil
+	})
+	var handler = NewAuthorizingHandler(auth,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+	var serve = func(method, token string) int {
+		var r = httptest.NewRequest(method, "/a/journal", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		var w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	c.Check(serve("GET", "good"), gc.Equals, http.StatusNoContent)
+	c.Check(serve("HEAD", "good"), gc.Equals, http.StatusNoContent)
+	c.Check(serve("PUT", "bad"), gc.Equals, http.StatusUnauthorized)
+	c.Check(serve("REPLICATE", ""), gc.Equals, http.StatusUnauthorized)
+	c.Check(serve("POST", "good"), gc.Equals, http.StatusNoContent)
+	c.Check(serve("DELETE", "bad"), gc.Equals, http.StatusUnauthorized)
+	c.Check(serve("OPTIONS", ""), gc.Equals, http.StatusNoContent) // Not authorized.
+
+	c.Check(calls, gc.DeepEquals, []call{
+		{"good", "a/journal", VerbRead},
+		{"good", "a/journal", VerbRead},
+		{"bad", "a/journal", VerbAppend},
+		{"", "a/journal", VerbReplicate},
+		{"good", "a/journal", VerbCreate},
+		{"bad", "a/journal", VerbDelete},
+	})
+}
+
+var _ = gc.Suite(&AuthSuite{})
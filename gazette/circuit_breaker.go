@@ -0,0 +1,107 @@
+package gazette
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/LiveRamp/gazette/metrics"
+)
+
+// ErrCircuitOpen is returned for requests to a broker endpoint which has
+// repeatedly failed, and has not yet cooled down.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// circuitBreaker tracks failures of requests to broker endpoints (keyed on
+// URL host). After |threshold| consecutive failures within |window|, the
+// endpoint's circuit is opened and requests fail fast for |cooldown|. Once
+// |cooldown| elapses a single probe request is allowed: if it succeeds the
+// circuit is closed, and otherwise it's re-opened for another |cooldown|.
+type circuitBreaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	endpoints map[string]*endpointCircuit
+	mu        sync.Mutex
+}
+
+type endpointCircuit struct {
+	// Number of consecutive failures, the first of which was at |firstFailure|.
+	failures     int
+	firstFailure time.Time
+	// Time at which the circuit was opened, or zero if closed.
+	openedAt time.Time
+	// Whether a probe request of a half-open circuit is in flight.
+	probing bool
+}
+
+func newCircuitBreaker(threshold int, window, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		endpoints: make(map[string]*endpointCircuit),
+	}
+}
+
+// allow returns whether a request to |endpoint| may proceed at |now|.
+func (b *circuitBreaker) allow(endpoint string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var ec, ok = b.endpoints[endpoint]
+	if !ok || ec.openedAt.IsZero() {
+		return true // Circuit is closed.
+	} else if now.Before(ec.openedAt.Add(b.cooldown)) || ec.probing {
+		return false
+	}
+	// Cooldown has elapsed. Allow a single probe.
+	ec.probing = true
+	return true
+}
+
+// release clears the probe of a half-open circuit of |endpoint|, which was
+// allowed but never sent (eg, because the request failed to be throttled or
+// authorized). A further probe may then be allowed.
+func (b *circuitBreaker) release(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ec, ok := b.endpoints[endpoint]; ok {
+		ec.probing = false
+	}
+}
+
+// record updates the circuit of |endpoint| with the outcome of a request.
+func (b *circuitBreaker) record(endpoint string, failed bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var ec, ok = b.endpoints[endpoint]
+	if !ok {
+		ec = new(endpointCircuit)
+		b.endpoints[endpoint] = ec
+	}
+
+	if !failed {
+		if !ec.openedAt.IsZero() {
+			metrics.GazetteCircuitBreakerOpen.WithLabelValues(endpoint).Set(0)
+		}
+		*ec = endpointCircuit{}
+		return
+	}
+
+	if ec.probing {
+		// Probe of a half-open circuit failed. Re-open it.
+		ec.openedAt, ec.probing = now, false
+		return
+	} else if ec.failures == 0 || now.Sub(ec.firstFailure) > b.window {
+		ec.failures, ec.firstFailure = 0, now
+	}
+
+	if ec.failures++; ec.failures >= b.threshold && ec.openedAt.IsZero() {
+		ec.openedAt = now
+		metrics.GazetteCircuitBreakerOpen.WithLabelValues(endpoint).Set(1)
+	}
+}
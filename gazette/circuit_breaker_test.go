@@ -0,0 +1,137 @@
+package gazette
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	gc "github.com/go-check/check"
+	"github.com/stretchr/testify/mock"
+)
+
+type CircuitBreakerSuite struct{}
+
+func (s *CircuitBreakerSuite) TestStateTransitions(c *gc.C) {
+	var b = newCircuitBreaker(3, time.Minute, 10*time.Second)
+	var t0 = time.Unix(1000, 0)
+
+	// Failures outside of |window| don't accumulate.
+	b.record("host", true, t0)
+	b.record("host", true, t0.Add(time.Second))
+	b.record("host", true, t0.Add(2*time.Minute))
+	c.Check(b.allow("host", t0.Add(2*time.Minute)), gc.Equals, true)
+
+	// A success resets the failure count.
+	b.record("host", false, t0.Add(2*time.Minute))
+	b.record("host", true, t0.Add(2*time.Minute))
+	b.record("host", true, t0.Add(2*time.Minute))
+	c.Check(b.allow("host", t0.Add(2*time.Minute)), gc.Equals, true)
+
+	// Third consecutive failure opens the circuit.
+	var t1 = t0.Add(3 * time.Minute)
+	b.record("host", true, t1)
+	c.Check(b.allow("host", t1), gc.Equals, false)
+	c.Check(b.allow("host", t1.Add(9*time.Second)), gc.Equals, false)
+	// Other endpoints are unaffected.
+	c.Check(b.allow("other", t1), gc.Equals, true)
+
+	// After |cooldown|, a single probe is allowed. It fails.
+	c.Check(b.allow("host", t1.Add(10*time.Second)), gc.Equals, true)
+	c.Check(b.allow("host", t1.Add(10*time.Second)), gc.Equals, false)
+	b.record("host", true, t1.Add(10*time.Second))
+
+	// The circuit re-opened. Next probe succeeds, and the circuit closes.
+	c.Check(b.allow("host", t1.Add(19*time.Second)), gc.Equals, false)
+	c.Check(b.allow("host", t1.Add(20*time.Second)), gc.Equals, true)
+	b.record("host", false, t1.Add(20*time.Second))
+
+	c.Check(b.allow("host", t1.Add(20*time.Second)), gc.Equals, true)
+	c.Check(b.allow("host", t1.Add(20*time.Second)), gc.Equals, true)
+}
+
+func (s *CircuitBreakerSuite) TestClientFailover(c *gc.C) {
+	gazetteMap.Init()
+
+	var mockClient = &mockHttpClient{}
+	client, err := NewClient("http://default")
+	c.Assert(err, gc.IsNil)
+	client.timeNow = func() time.Time { return time.Unix(1234, 0) } // Fix time.
+	client.httpClient = mockClient
+	client.SetCircuitBreaker(1, time.Minute, time.Minute)
+
+	// A request is routed to a cached broker, which fails and opens its circuit.
+	client.locationCache.Add("/a/journal", newURL("http://broker/a/journal"))
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.Host == "broker"
+	})).Return(nil, io.ErrUnexpectedEOF).Once()
+
+	request, _ := http.NewRequest("HEAD", "/a/journal", nil)
+	_, err = client.Do(request)
+	c.Check(err, gc.Equals, io.ErrUnexpectedEOF)
+
+	// Route to the failed broker again. Expect the request fails over to the
+	// default endpoint, which also fails.
+	client.locationCache.Add("/a/journal", newURL("http://broker/a/journal"))
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.String() == "http://default/a/journal"
+	})).Return(nil, io.ErrUnexpectedEOF).Once()
+
+	request, _ = http.NewRequest("HEAD", "/a/journal", nil)
+	_, err = client.Do(request)
+	c.Check(err, gc.Equals, io.ErrUnexpectedEOF)
+
+	// Both circuits are now open. Expect requests fail fast.
+	request, _ = http.NewRequest("HEAD", "/a/journal", nil)
+	_, err = client.Do(request)
+	c.Check(err, gc.Equals, ErrCircuitOpen)
+
+	mockClient.AssertExpectations(c)
+}
+
+func (s *CircuitBreakerSuite) TestProbeReleasedIfNotSent(c *gc.C) {
+	gazetteMap.Init()
+
+	var mockClient = &mockHttpClient{}
+	client, err := NewClient("http://default")
+	c.Assert(err, gc.IsNil)
+
+	var now = time.Unix(1234, 0)
+	client.timeNow = func() time.Time { return now }
+	client.httpClient = mockClient
+	client.SetCircuitBreaker(1, time.Minute, time.Minute)
+
+	var tokenErr error
+	client.SetTokenProvider(func(bool) (string, error) { return "a-token", tokenErr })
+
+	// A failed request opens the circuit.
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).
+		Return(nil, io.ErrUnexpectedEOF).Once()
+
+	request, _ := http.NewRequest("HEAD", "/a/journal", nil)
+	_, err = client.Do(request)
+	c.Check(err, gc.Equals, io.ErrUnexpectedEOF)
+
+	// After the cooldown, a probe is allowed but fails to be authorized.
+	now = now.Add(time.Minute)
+	tokenErr = errors.New("token error")
+
+	request, _ = http.NewRequest("HEAD", "/a/journal", nil)
+	_, err = client.Do(request)
+	c.Check(err, gc.Equals, tokenErr)
+
+	// Expect the probe was released, and a following probe is sent.
+	tokenErr = nil
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).
+		Return(newReadResponseFixture(), nil).Once()
+
+	request, _ = http.NewRequest("HEAD", "/a/journal", nil)
+	_, err = client.Do(request)
+	c.Check(err, gc.IsNil)
+
+	mockClient.AssertExpectations(c)
+}
+
+var _ = gc.Suite(&CircuitBreakerSuite{})
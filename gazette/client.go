@@ -1,7 +1,11 @@
 package gazette
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"expvar"
 	"fmt"
 	"io"
@@ -13,10 +17,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/golang-lru"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
 
 	"github.com/LiveRamp/gazette/journal"
 	"github.com/LiveRamp/gazette/keepalive"
@@ -30,6 +36,11 @@ const (
 	// route future requests to cached locations. This allows the client to
 	// discover direct, responsible endpoints for journals it uses.
 	kClientRouteCacheSize = 1024
+	// Number of committed journal.AppendArgs.Token's retained by the client.
+	kClientTokenCacheSize = 1 << 14
+	// Maximum number of times a resumable append is re-sent. See
+	// Client.SetResumableAppends.
+	kMaxPutResumes = 3
 
 	statsJournalBytes = "bytes"
 	statsJournalHead  = "head"
@@ -37,7 +48,6 @@ const (
 
 type httpClient interface {
 	Do(*http.Request) (*http.Response, error)
-	Get(url string) (*http.Response, error)
 }
 
 type requestData struct {
@@ -52,14 +62,25 @@ type currentRequestList struct {
 
 var kContentRangeRegexp = regexp.MustCompile("bytes\\s+(\\d+)-\\d+/\\d+")
 
+// ErrClientClosed is returned by requests of a Client which has been closed.
+var ErrClientClosed = errors.New("client is closed")
+
+// Returned by listFragments if the broker doesn't serve the FragmentsAPI.
+var errFragmentsAPIUnavailable = errors.New("fragments API unavailable")
+
 type Client struct {
-	// Endpoint which is queried by default.
-	defaultEndpoint *url.URL
+	// Endpoints which are queried by default. |endpointIndex| is the last-good
+	// endpoint, which is used until a request to it fails.
+	endpoints     []*url.URL
+	endpointIndex int
+	endpointMu    sync.Mutex
 
 	// Maps request.URL.Path to previously-received "Location:" headers,,
 	// stripped of URL query arguments. Future requests of the same URL path are
 	// first attempted against the cached endpoint.
 	locationCache *lru.Cache
+	// Maps appendTokens of committed appends to their journal.AppendResult.
+	committedTokens *lru.Cache
 
 	// Exported reader/writer statistics, and a mutex to guard creation of journal
 	// specific entries in the maps.
@@ -73,31 +94,78 @@ type Client struct {
 
 	// Underlying HTTP Client to use for all requests.
 	httpClient httpClient
-	// Test support: allow time.Now() to be swapped out.
-	timeNow func() time.Time
+	// Transport of |httpClient| (beneath any RoundTripperMiddleware), if it
+	// pools connections which can be closed by Close.
+	idleCloser interface {
+		CloseIdleConnections()
+	}
+	// Non-zero once the Client is closed. Accessed atomically.
+	closed int32
+	// Optional circuit breaker of failing broker endpoints.
+	breaker *circuitBreaker
+	// Optional provider of bearer tokens, and whether it may refresh tokens.
+	tokenProvider TokenProvider
+	tokenRefresh  bool
+	// Logger of Client events. Defaults to the standard logrus Logger.
+	logger log.FieldLogger
+	// Optional Tracer of Client requests.
+	tracer Tracer
+	// Optional rate limits of read and write requests, and the policy applied
+	// when they're reached.
+	readLimiter     *rateLimiter
+	writeLimiter    *rateLimiter
+	rateLimitPolicy OverflowPolicy
+	// Whether appends of seekable content are resumed upon transport errors.
+	resumableAppends bool
+	// ReadStrategy of reads, and its hedge delay. |routeCache| maps
+	// request.URL.Path to replicas of the journal route, as last observed.
+	readStrategy ReadStrategy
+	hedgeAfter   time.Duration
+	routeCache   *lru.Cache
+	// Test support: allow time.Now() and time.After() to be swapped out.
+	timeNow   func() time.Time
+	timeAfter func(time.Duration) <-chan time.Time
 }
 
-// NewClient returns a new Client. To export metrics, register the
+// NewClient returns a new Client of one or more broker |endpoints|. Requests
+// are issued against the first endpoint, and rotate to the next endpoint should
+// a connection to the current one fail. To export metrics, register the
 // prometheus.Collector instances in metrics.GazetteClientCollectors().
-func NewClient(endpoint string) (*Client, error) {
-	return NewClientWithHttpClient(endpoint, &http.Client{})
+func NewClient(endpoints ...string) (*Client, error) {
+	return NewClientWithEndpoints(endpoints, &http.Client{})
 }
 
 func NewClientWithHttpClient(endpoint string, hc *http.Client) (*Client, error) {
-	// Assume HTTP if no protocol is specified.
-	if strings.Index(endpoint, "://") == -1 {
-		endpoint = "http://" + endpoint
+	return NewClientWithEndpoints([]string{endpoint}, hc)
+}
+
+func NewClientWithEndpoints(endpoints []string, hc *http.Client) (*Client, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("expected at least one endpoint")
 	}
+	var eps []*url.URL
 
-	ep, err := url.Parse(endpoint)
-	if err != nil {
-		return nil, err
+	for _, endpoint := range endpoints {
+		// Assume HTTP if no protocol is specified.
+		if strings.Index(endpoint, "://") == -1 {
+			endpoint = "http://" + endpoint
+		}
+
+		ep, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		eps = append(eps, ep)
 	}
 
 	cache, err := lru.New(kClientRouteCacheSize)
 	if err != nil {
 		return nil, err
 	}
+	tokens, err := lru.New(kClientTokenCacheSize)
+	if err != nil {
+		return nil, err
+	}
 
 	// If an API consumer sets his own transport, respect it, though things may
 	// fail if (for example) the file URL handler is not set.
@@ -106,11 +174,20 @@ func NewClientWithHttpClient(endpoint string, hc *http.Client) (*Client, error)
 	}
 
 	c := &Client{
-		defaultEndpoint: ep,
+		endpoints:       eps,
 		locationCache:   cache,
+		committedTokens: tokens,
 		httpClient:      hc,
 		requests:        &currentRequestList{m: make(map[string]requestData)},
+		logger:          log.StandardLogger(),
 		timeNow:         time.Now,
+		timeAfter:       time.After,
+	}
+
+	if ic, ok := hc.Transport.(interface {
+		CloseIdleConnections()
+	}); ok {
+		c.idleCloser = ic
 	}
 
 	// Create expvar skeleton under /gazette.
@@ -124,6 +201,61 @@ func NewClientWithHttpClient(endpoint string, hc *http.Client) (*Client, error)
 	return c, nil
 }
 
+// SetCircuitBreaker enables a circuit breaker of broker endpoints. After
+// |threshold| consecutive failed requests to an endpoint within |window|,
+// requests routed to that endpoint fail over to the default endpoint (or,
+// if the default endpoint is itself failing, fail fast with ErrCircuitOpen)
+// for |cooldown|, after which a single probe request is allowed through.
+// SetCircuitBreaker must be called before the Client is used.
+func (c *Client) SetCircuitBreaker(threshold int, window, cooldown time.Duration) {
+	c.breaker = newCircuitBreaker(threshold, window, cooldown)
+}
+
+// SetResumableAppends determines whether Put recovers from transport errors
+// (eg, a dropped connection) of appends having seekable Content, rather than
+// returning the error. Brokers commit appends atomically: an append commits
+// in full, or not at all. Put uses the Content offset reached by the transport
+// and the journal write head to determine which occurred:
+//  * If the transport didn't send all Content, the append cannot have
+//    committed, and it's re-sent from the beginning of Content.
+//  * If all Content was sent and the journal holds it at the write head
+//    observed prior to the append, the append committed and its result is
+//    returned (and recorded under the AppendArgs.Token, if set).
+//  * Otherwise, whether the append committed is unknown, and the transport
+//    error is returned. Put never re-sends Content which may have committed.
+// Resumable appends issue an additional HEAD request prior to each append.
+func (c *Client) SetResumableAppends(enabled bool) {
+	c.resumableAppends = enabled
+}
+
+// SetLogger directs logging of the Client to |logger|, in place of the standard
+// logrus Logger. A WriteService created after SetLogger also logs to |logger|.
+// SetLogger must be called before the Client is used.
+func (c *Client) SetLogger(logger log.FieldLogger) {
+	c.logger = logger
+}
+
+// Close closes the Client. Idle connections of its transport are closed, and
+// further requests of the Client fail with ErrClientClosed. Requests already
+// in-flight (including streamed reads) are unaffected, and their connections
+// are released as they complete. The Client has no background routines
+// requiring cancellation. Close returns ErrClientClosed if the Client is
+// already closed.
+func (c *Client) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return ErrClientClosed
+	}
+	if c.idleCloser != nil {
+		c.idleCloser.CloseIdleConnections()
+	}
+	return nil
+}
+
+// isClosed returns whether the Client has been closed.
+func (c *Client) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) != 0
+}
+
 // If you want to use your own |http.Transport| with Gazette, start with this one.
 func MakeHttpTransport() *http.Transport {
 	// See definition of |http.DefaultTransport| here:
@@ -149,12 +281,71 @@ func MakeHttpTransport() *http.Transport {
 	return httpTransport
 }
 
+// MakeHttp2Transport returns a Transport as MakeHttpTransport, which
+// additionally negotiates HTTP/2 with https:// endpoints which support it,
+// using |tlsConfig| (which may be nil). Concurrent requests of an HTTP/2
+// endpoint, including long-polling reads, are multiplexed over a single
+// connection. Cleartext http:// endpoints continue to use HTTP/1.1.
+func MakeHttp2Transport(tlsConfig *tls.Config) (*http.Transport, error) {
+	var httpTransport = MakeHttpTransport()
+	httpTransport.TLSClientConfig = tlsConfig
+
+	if err := http2.ConfigureTransport(httpTransport); err != nil {
+		return nil, err
+	}
+	return httpTransport, nil
+}
+
+// HeadResult composes the ReadResult of a HEAD operation with the direct
+// location of its Fragment, and describes the fragment covering an offset.
+type HeadResult struct {
+	journal.ReadResult
+	// Signed or authorized URL of the Fragment in its backing store. Nil if the
+	// Fragment has not been persisted (eg, it's still being written).
+	FragmentLocation *url.URL
+}
+
+// Name of the Fragment within its journal.
+func (r HeadResult) FragmentName() string {
+	return r.Fragment.ContentName()
+}
+
+// Performs a Gazette HEAD operation. On success, |result.Offset| and
+// |result.WriteHead| are set, and if |args.Offset| is covered by a Fragment,
+// |result.Fragment| is populated with its metadata. |fragmentLocation| is the
+// Fragment's direct URL if it's persisted, or nil otherwise. Errors of
+// reaching a broker are returned as-is via |result.Error| (eg, as a net.Error).
+// Failure responses of the broker are returned as a Journal protocol error
+// (eg, journal.ErrNotFound) or *journal.StatusError (see
+// journal.ErrorFromResponse). Get and Put return errors in the same way.
 func (c *Client) Head(args journal.ReadArgs) (journal.ReadResult, *url.URL) {
+	return c.head(context.Background(), args)
+}
+
+// HeadContext is Head, with the request issued under |ctx|. Cancellation or
+// expiry of |ctx| aborts the request, and its error is returned.
+func (c *Client) HeadContext(ctx context.Context, args journal.ReadArgs) (journal.ReadResult, *url.URL) {
+	return c.head(ctx, args)
+}
+
+// HeadFragment performs a Head, returning a HeadResult which composes the
+// result and location of the Fragment covering |args.Offset|.
+func (c *Client) HeadFragment(args journal.ReadArgs) HeadResult {
+	var result, location = c.Head(args)
+	return HeadResult{ReadResult: result, FragmentLocation: location}
+}
+
+func (c *Client) head(ctx context.Context, args journal.ReadArgs) (result journal.ReadResult, loc *url.URL) {
+	defer c.observeRequest(ctx, "head", c.timeNow(), &result.Error)
+
+	if err := args.Journal.Validate(); err != nil {
+		return journal.ReadResult{Error: err}, nil
+	}
 	request, err := http.NewRequest("HEAD", c.buildReadURL(args).String(), nil)
 	if err != nil {
 		return journal.ReadResult{Error: err}, nil
 	}
-	response, err := c.Do(request)
+	response, err := c.doRead(ctx, request)
 	if err != nil {
 		return journal.ReadResult{Error: err}, nil
 	}
@@ -165,11 +356,18 @@ func (c *Client) Head(args journal.ReadArgs) (journal.ReadResult, *url.URL) {
 }
 
 func (c *Client) GetDirect(args journal.ReadArgs) (journal.ReadResult, io.ReadCloser) {
+	return c.getDirect(context.Background(), args)
+}
+
+func (c *Client) getDirect(ctx context.Context, args journal.ReadArgs) (journal.ReadResult, io.ReadCloser) {
+	if err := args.Journal.Validate(); err != nil {
+		return journal.ReadResult{Error: err}, nil
+	}
 	request, err := http.NewRequest("GET", c.buildReadURL(args).String(), nil)
 	if err != nil {
 		return journal.ReadResult{Error: err}, nil
 	}
-	response, err := c.Do(request)
+	response, err := c.doRead(ctx, request)
 	if err != nil {
 		return journal.ReadResult{Error: err}, nil
 	}
@@ -179,31 +377,51 @@ func (c *Client) GetDirect(args journal.ReadArgs) (journal.ReadResult, io.ReadCl
 		response.Body.Close()
 		return result, nil
 	}
-	return result, c.makeReadStatsWrapper(response.Body, args.Journal, result.Offset)
+	return result, limitBody(args, c.makeReadStatsWrapper(response.Body, args.Journal, result.Offset))
 }
 
+// Performs a Gazette GET operation. If |args.Blocking| is false and
+// |args.Offset| is at the journal write head, ErrNotYetAvailable is returned.
+// Otherwise, the returned body reads through available content and returns
+// io.EOF (rather than blocking) upon reaching the write head. The caller may
+// resume from |result.Offset| plus the number of bytes read.
 func (c *Client) Get(args journal.ReadArgs) (journal.ReadResult, io.ReadCloser) {
+	return c.get(context.Background(), args)
+}
+
+// GetContext is Get, with requests issued under |ctx|. Cancellation or expiry
+// of |ctx| aborts a request which is blocked awaiting content, as well as
+// reads of a returned body: a read which is blocked returns |ctx|'s error.
+func (c *Client) GetContext(ctx context.Context, args journal.ReadArgs) (journal.ReadResult, io.ReadCloser) {
+	return c.get(ctx, args)
+}
+
+// get implements Get, issuing requests under |ctx|. Cancellation of |ctx|
+// aborts a blocked request, as well as reads of a returned streaming body.
+func (c *Client) get(ctx context.Context, args journal.ReadArgs) (result journal.ReadResult, body io.ReadCloser) {
+	defer c.observeRequest(ctx, "get", c.timeNow(), &result.Error)
+
 	// Perform a non-blocking HEAD first, to check for an available persisted fragment.
 	headArgs := args
 	headArgs.Blocking = false
 	headArgs.Deadline = time.Time{}
-	result, fragmentLocation := c.Head(headArgs)
+	result, fragmentLocation := c.head(ctx, headArgs)
 
 	if result.Error == journal.ErrNotYetAvailable {
 		// Fall-through, re-attempting request as a GET.
 	} else if result.Error != nil {
 		return result, nil
 	} else if fragmentLocation != nil {
-		if body, err := c.openFragment(fragmentLocation, result); err != nil {
+		if body, err := c.openFragment(ctx, fragmentLocation, result); err != nil {
 			result.Error = err
 			return result, nil
 		} else {
-			return result, c.makeReadStatsWrapper(body, args.Journal, result.Offset)
+			return result, limitBody(args, c.makeReadStatsWrapper(body, args.Journal, result.Offset))
 		}
 	}
 	// No persisted fragment is available. We must repeat the request as a GET.
 	// Data will be streamed directly from the server.
-	return c.GetDirect(args)
+	return c.getDirect(ctx, args)
 }
 
 func (c *Client) obtainJournalCounters(name journal.Name, isWrite bool, offset int64) (counter *expvar.Int, head *expvar.Int) {
@@ -256,89 +474,354 @@ func (c *Client) makeReadStatsWrapper(stream io.ReadCloser, name journal.Name, o
 // Returns a reader by reading directly from a fragment. |location| is a
 // potentially signed or authorized URL to fragment storage. The fragment is
 // opened, seek'd to the desired |result.Offset|, and returned. Note we don't
-// use a range request here, as the fragment is usually gzip'd (and implicitly
+// use a range request here, as the fragment is usually compressed (and
 // decompressed while being read).
-func (c *Client) openFragment(location *url.URL,
+func (c *Client) openFragment(ctx context.Context, location *url.URL,
 	result journal.ReadResult) (io.ReadCloser, error) {
 
-	response, err := c.httpClient.Get(location.String())
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+	request, err := http.NewRequest("GET", location.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.httpClient.Do(request.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	} else if response.StatusCode != http.StatusOK {
 		response.Body.Close()
 		return nil, fmt.Errorf("fetching fragment: %s", response.Status)
 	}
+	// Transparently decompress content of a compressed fragment.
+	body, err := result.Fragment.Codec.NewDecompressor(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing fragment: %s", err)
+	}
 	// Attempt to seek to |result.Offset| within the fragment.
 	delta := result.Offset - result.Fragment.Begin
-	if _, err := io.CopyN(ioutil.Discard, response.Body, delta); err != nil {
-		response.Body.Close()
+	if _, err := io.CopyN(ioutil.Discard, body, delta); err != nil {
+		body.Close()
 		return nil, fmt.Errorf("seeking fragment: %s", err)
 	}
 
 	var deltaF64 = float64(delta)
 	metrics.GazetteReadBytesTotal.Add(deltaF64)
 	metrics.GazetteDiscardBytesTotal.Add(deltaF64)
-	return response.Body, nil // Success.
+	return body, nil // Success.
 }
 
 // Creates the Journal of the given name.
 func (c *Client) Create(name journal.Name) error {
-	url := c.defaultEndpoint // Copy.
+	return c.CreateContext(context.Background(), name)
+}
+
+// CreateContext is Create, with the request issued under |ctx|.
+func (c *Client) CreateContext(ctx context.Context, name journal.Name) error {
+	return c.CreateWithReplication(ctx, name, 0)
+}
+
+// CreateWithReplication is CreateContext, with the Journal served by
+// |replication| brokers (including its master). If zero, the broker default
+// replication applies. See JournalSpec.
+func (c *Client) CreateWithReplication(ctx context.Context, name journal.Name, replication int) error {
+	if err := name.Validate(); err != nil {
+		return err
+	} else if c.isClosed() {
+		return ErrClientClosed
+	}
+	url := *c.defaultEndpoint() // Copy.
 	url.Path = "/" + name.String()
 
+	if replication != 0 {
+		url.RawQuery = "replication=" + strconv.Itoa(replication)
+	}
+
 	request, err := http.NewRequest("POST", url.String(), nil)
 	if err != nil {
 		return err
+	} else if err = c.authorize(request, false); err != nil {
+		return err
 	}
 	// Issue the request without using or updating the Journal location cache.
-	response, err := c.httpClient.Do(request)
+	response, err := c.httpClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	return journal.ErrorFromResponse(response)
+}
+
+// Deletes the Journal of the given name. See DeleteAPI.
+func (c *Client) Delete(name journal.Name) error {
+	return c.DeleteContext(context.Background(), name)
+}
+
+// DeleteContext is Delete, with the request issued under |ctx|.
+func (c *Client) DeleteContext(ctx context.Context, name journal.Name) error {
+	if err := name.Validate(); err != nil {
+		return err
+	} else if c.isClosed() {
+		return ErrClientClosed
+	}
+	url := *c.defaultEndpoint() // Copy.
+	url.Path = "/" + name.String()
+
+	request, err := http.NewRequest("DELETE", url.String(), nil)
+	if err != nil {
+		return err
+	} else if err = c.authorize(request, false); err != nil {
+		return err
+	}
+	// Issue the request without using the Journal location cache, and
+	// drop any cached location of the deleted Journal.
+	response, err := c.httpClient.Do(request.WithContext(ctx))
 	if err != nil {
 		return err
 	}
+	c.locationCache.Remove(url.Path)
+
 	return journal.ErrorFromResponse(response)
 }
 
 // Performs a Gazette PUT operation, which appends content to the named journal.
-// Put panics if |args.Content| does not implement io.ReadSeeker.
+// If |args.Token| is set and an append of the same journal and Token previously
+// committed through this Client, Put returns the prior AppendResult without
+// re-sending |args.Content|.
 func (c *Client) Put(args journal.AppendArgs) journal.AppendResult {
+	return c.put(context.Background(), args)
+}
+
+// PutContext is Put, with requests issued under |ctx|. Cancellation or expiry
+// of |ctx| aborts the append, and its outcome is then unknown: it may or may
+// not have committed.
+func (c *Client) PutContext(ctx context.Context, args journal.AppendArgs) journal.AppendResult {
+	return c.put(ctx, args)
+}
+
+// put implements Put, issuing requests under |ctx|. Cancellation of |ctx|
+// aborts the append, and its outcome is then unknown: it may or may not have
+// committed.
+func (c *Client) put(ctx context.Context, args journal.AppendArgs) (result journal.AppendResult) {
+	defer c.observeRequest(ctx, "put", c.timeNow(), &result.Error)
+
+	if err := args.Journal.Validate(); err != nil {
+		return journal.AppendResult{Error: err}
+	}
+	var token = appendToken{journal: args.Journal, token: args.Token}
+
+	if args.Token != "" {
+		if prior, ok := c.committedTokens.Get(token); ok {
+			return prior.(journal.AppendResult)
+		}
+	}
 	request, err := http.NewRequest("PUT", "/"+args.Journal.String(), args.Content)
 	if err != nil {
 		return journal.AppendResult{Error: err}
 	}
 	if _, ok := c.locationCache.Get(request.URL.Path); !ok {
 		// Speculatively issue a HEAD to fill the location cache for this path.
-		result, _ := c.Head(journal.ReadArgs{Journal: args.Journal, Blocking: false, Offset: -1})
+		result, _ := c.head(ctx, journal.ReadArgs{Journal: args.Journal, Blocking: false, Offset: -1})
 		if result.Error != nil && result.Error != journal.ErrNotYetAvailable {
 			return journal.AppendResult{Error: result.Error}
 		}
 	}
 
+	// Determine the content length, if it's known, such that the request is
+	// sent with a Content-Length rather than streamed with chunked encoding.
+	// http.NewRequest has already done so for common in-memory readers.
+	if l, ok := args.Content.(interface {
+		Len() int
+	}); ok && request.ContentLength == 0 {
+		request.ContentLength = int64(l.Len())
+	}
 	// Use Seek() to determine the content length, if available.
-	rs := args.Content.(io.ReadSeeker)
-	if start, err := rs.Seek(0, os.SEEK_CUR); err != nil {
-	} else if end, err := rs.Seek(0, os.SEEK_END); err != nil {
-	} else if _, err := rs.Seek(start, os.SEEK_SET); err != nil {
+	var rs, seekable = args.Content.(io.ReadSeeker)
+	var start, end int64
+
+	if !seekable {
+	} else if start, end, err = seekBounds(rs); err != nil {
+		seekable = false
 	} else {
 		request.ContentLength = end - start
+
+		// Allow the request to be re-played (eg, after a token refresh).
+		request.GetBody = func() (io.ReadCloser, error) {
+			var _, err = rs.Seek(start, os.SEEK_SET)
+			return ioutil.NopCloser(rs), err
+		}
+	}
+	if args.ContentLength != 0 {
+		request.ContentLength = args.ContentLength
+	}
+
+	// A resumable append requires the journal write head prior to the append.
+	var priorHead int64 = -1
+	if c.resumableAppends && seekable && request.ContentLength == end-start {
+		var head, _ = c.head(ctx, journal.ReadArgs{Journal: args.Journal, Blocking: false, Offset: -1})
+		if head.Error == nil || head.Error == journal.ErrNotYetAvailable {
+			priorHead = head.WriteHead
+		}
 	}
 
-	response, err := c.Do(request)
+	response, err := c.Do(request.WithContext(ctx))
+	if err != nil && priorHead != -1 {
+		var confirmed *journal.AppendResult
+		response, confirmed, err = c.resumePut(ctx, args.Journal, rs, start, end, priorHead, err)
+
+		if confirmed != nil {
+			result = *confirmed
+			request.ContentLength = end - start
+		}
+	}
 	if err != nil {
 		return journal.AppendResult{Error: err}
+	} else if response != nil {
+		defer response.Body.Close()
+		result = c.parseAppendResponse(response)
 	}
-	defer response.Body.Close()
-	result := c.parseAppendResponse(response)
 
 	// Record the result.WriteHead as well as a cumulative count of all
 	// bytes written to this journal, if the write succeeded.
 	if result.Error == nil {
 		written, _ := c.obtainJournalCounters(args.Journal, true, result.WriteHead)
 		written.Add(request.ContentLength)
+
+		if args.Token != "" {
+			c.committedTokens.Add(token, result)
+		}
 	}
 
 	return result
 }
 
+// seekBounds returns the current and final offsets of |rs|, and restores
+// |rs| to its current offset.
+func seekBounds(rs io.ReadSeeker) (start, end int64, err error) {
+	if start, err = rs.Seek(0, os.SEEK_CUR); err != nil {
+	} else if end, err = rs.Seek(0, os.SEEK_END); err != nil {
+	} else {
+		_, err = rs.Seek(start, os.SEEK_SET)
+	}
+	return
+}
+
+// resumePut recovers from transport error |err| of an append to journal |name|
+// of content [start, end) of |rs|, which was issued when the journal write
+// head was |priorHead|. See SetResumableAppends. It returns the response of a
+// re-sent append, or the AppendResult of an append confirmed to have already
+// committed, or an error. An append aborted by cancellation of |ctx| is not
+// resumed.
+func (c *Client) resumePut(ctx context.Context, name journal.Name, rs io.ReadSeeker,
+	start, end, priorHead int64, err error) (*http.Response, *journal.AppendResult, error) {
+
+	for attempt := 0; attempt != kMaxPutResumes; attempt++ {
+		if ctx.Err() != nil {
+			return nil, nil, err
+		}
+		var offset, seekErr = rs.Seek(0, os.SEEK_CUR)
+		if seekErr != nil {
+			return nil, nil, err
+		}
+
+		if offset == end {
+			// All content was sent, and the broker may have committed it.
+			if confirmed, confirmErr := c.confirmAppend(name, rs, start, end, priorHead); confirmErr != nil {
+				c.logger.WithFields(log.Fields{"journal": name, "err": confirmErr}).
+					Warn("failed to confirm append")
+			} else if confirmed != nil {
+				return nil, confirmed, nil
+			}
+			return nil, nil, err
+		}
+
+		// The broker didn't receive all content, and cannot have committed the
+		// append. Re-send it from the beginning.
+		c.logger.WithFields(log.Fields{
+			"journal": name,
+			"sent":    offset - start,
+			"length":  end - start,
+			"err":     err,
+		}).Warn("resuming interrupted append")
+
+		if _, seekErr = rs.Seek(start, os.SEEK_SET); seekErr != nil {
+			return nil, nil, err
+		}
+		var request, reqErr = http.NewRequest("PUT", "/"+name.String(), ioutil.NopCloser(rs))
+		if reqErr != nil {
+			return nil, nil, reqErr
+		}
+		request.ContentLength = end - start
+		request.GetBody = func() (io.ReadCloser, error) {
+			var _, err = rs.Seek(start, os.SEEK_SET)
+			return ioutil.NopCloser(rs), err
+		}
+
+		var response *http.Response
+		if response, err = c.Do(request.WithContext(ctx)); err == nil {
+			return response, nil, nil
+		}
+	}
+	return nil, nil, err
+}
+
+// confirmAppend returns an AppendResult if journal |name| holds content
+// [start, end) of |rs| at offset |priorHead|, confirming that an append of the
+// content committed. Otherwise, it returns nil.
+func (c *Client) confirmAppend(name journal.Name, rs io.ReadSeeker, start, end,
+	priorHead int64) (*journal.AppendResult, error) {
+
+	var head, _ = c.Head(journal.ReadArgs{Journal: name, Blocking: false, Offset: -1})
+	if head.Error != nil && head.Error != journal.ErrNotYetAvailable {
+		return nil, head.Error
+	} else if head.WriteHead < priorHead+(end-start) {
+		return nil, nil // Content cannot have committed.
+	}
+
+	if _, err := rs.Seek(start, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	var rr = journal.NewRetryReader(journal.NewMark(name, priorHead), c)
+	defer rr.Close()
+
+	if eq, err := readersEqual(io.LimitReader(rr, end-start), io.LimitReader(rs, end-start)); err != nil || !eq {
+		return nil, err
+	}
+	return &journal.AppendResult{WriteHead: priorHead + (end - start)}, nil
+}
+
+// readersEqual returns whether |a| and |b| produce identical content.
+func readersEqual(a, b io.Reader) (bool, error) {
+	var bufA, bufB = make([]byte, 32*1024), make([]byte, 32*1024)
+
+	for {
+		var nA, errA = io.ReadFull(a, bufA)
+		var nB, errB = io.ReadFull(b, bufB)
+
+		if errA == io.ErrUnexpectedEOF {
+			errA = io.EOF
+		}
+		if errB == io.ErrUnexpectedEOF {
+			errB = io.EOF
+		}
+
+		if errA != nil && errA != io.EOF {
+			return false, errA
+		} else if errB != nil && errB != io.EOF {
+			return false, errB
+		} else if !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return false, nil
+		} else if errA == io.EOF || errB == io.EOF {
+			return errA == errB, nil
+		}
+	}
+}
+
+// appendToken keys a journal.AppendArgs.Token of a journal.
+type appendToken struct {
+	journal journal.Name
+	token   string
+}
+
 func (c *Client) buildReadURL(args journal.ReadArgs) *url.URL {
 	v := url.Values{
 		"offset": {strconv.FormatInt(args.Offset, 10)},
@@ -367,7 +850,7 @@ func (c *Client) parseReadResult(args journal.ReadArgs,
 			return
 		} else if offset, err := strconv.ParseInt(m[1], 10, 64); err != nil {
 			// Regular expression match asserts this should parse.
-			log.WithFields(log.Fields{"err": err, "match": m[1]}).Panic("failed to convert")
+			c.logger.WithFields(log.Fields{"err": err, "match": m[1]}).Panic("failed to convert")
 		} else {
 			result.Offset = offset
 		}
@@ -469,7 +952,7 @@ func (c *Client) parseAppendResponse(response *http.Response) journal.AppendResu
 	if writeHead := response.Header.Get(WriteHeadHeader); writeHead != "" {
 		var err error
 		if result.WriteHead, err = strconv.ParseInt(writeHead, 10, 64); err != nil {
-			log.WithFields(log.Fields{"err": err, "writeHead": writeHead}).
+			c.logger.WithFields(log.Fields{"err": err, "writeHead": writeHead}).
 				Error("error parsing write head")
 		}
 	}
@@ -483,8 +966,13 @@ func (c *Client) parseAppendResponse(response *http.Response) journal.AppendResu
 // redirect or response with a Location: header. On error, cache entries are
 // expunged (eg, future requests are performed against the default endpoint).
 func (c *Client) Do(request *http.Request) (*http.Response, error) {
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
 	var cacheKey = request.URL.Path // We may mutate |request| later.
 
+	var defaultEndpoint = c.defaultEndpoint()
+
 	// Apply a cached re-write for this request path if found.
 	if cached, ok := c.locationCache.Get(cacheKey); ok {
 		location := cached.(*url.URL)
@@ -495,18 +983,75 @@ func (c *Client) Do(request *http.Request) (*http.Response, error) {
 		// Note that RawQuery is not re-written.
 	} else {
 		// Otherwise, re-write to use the default endpoint.
-		request.URL.Scheme = c.defaultEndpoint.Scheme
-		request.URL.User = c.defaultEndpoint.User
-		request.URL.Host = c.defaultEndpoint.Host
+		request.URL.Scheme = defaultEndpoint.Scheme
+		request.URL.User = defaultEndpoint.User
+		request.URL.Host = defaultEndpoint.Host
 		// Note that Path & RawQuery are not re-written.
 	}
 
+	if c.breaker != nil && !c.breaker.allow(request.URL.Host, c.timeNow()) {
+		// Fail over to a default endpoint with a closed circuit, which will
+		// re-direct as required.
+		c.locationCache.Remove(cacheKey)
+
+		if defaultEndpoint = c.allowedEndpoint(); defaultEndpoint == nil {
+			return nil, ErrCircuitOpen
+		}
+		request.URL.Scheme = defaultEndpoint.Scheme
+		request.URL.User = defaultEndpoint.User
+		request.URL.Host = defaultEndpoint.Host
+		request.URL.Path = cacheKey
+	}
+	return c.send(request, cacheKey, defaultEndpoint)
+}
+
+// send issues |request|, which Do or doAt have routed to an endpoint, and
+// updates the Client.locationCache entry |cacheKey| from its outcome. The
+// |defaultEndpoint| is rotated if it's the endpoint, and the request fails.
+func (c *Client) send(request *http.Request, cacheKey string,
+	defaultEndpoint *url.URL) (*http.Response, error) {
+
+	var endpoint = request.URL.Host
+	var sent bool
+
+	if c.breaker != nil {
+		// A request which fails before it's sent records no outcome, but must
+		// release a probe of a half-open circuit which allowed it.
+		defer func() {
+			if !sent {
+				c.breaker.release(endpoint)
+			}
+		}()
+	}
+	if err := c.throttle(request); err != nil {
+		return nil, err
+	}
 	c.requests.Put(request.URL.String(), requestData{request.Method, c.timeNow()})
 	defer c.requests.Delete(request.URL.String())
 
+	if err := c.authorize(request, false); err != nil {
+		return nil, err
+	}
+	var span = c.startSpan(request, cacheKey)
+	sent = true
 	response, err := c.httpClient.Do(request)
+
+	if err == nil && response.StatusCode == http.StatusUnauthorized {
+		response, err = c.retryUnauthorized(request, response)
+	}
+	if span != nil {
+		span.Finish(response, err)
+	}
+	if c.breaker != nil {
+		c.breaker.record(endpoint,
+			err != nil || response.StatusCode >= http.StatusInternalServerError, c.timeNow())
+	}
 	if err != nil {
 		c.locationCache.Remove(cacheKey)
+
+		if endpoint == defaultEndpoint.Host {
+			c.rotateEndpoint(defaultEndpoint)
+		}
 		return response, err
 	}
 
@@ -515,7 +1060,7 @@ func (c *Client) Do(request *http.Request) (*http.Response, error) {
 		// It probably also indicates request failure as well (30X or 404 response).
 		c.locationCache.Add(cacheKey, location)
 	} else if err != http.ErrNoLocation {
-		log.WithField("err", err).Warn("parsing Gazette Location header")
+		c.logger.WithField("err", err).Warn("parsing Gazette Location header")
 	} else if response.Request != nil {
 		// We successfully talked to a Gazette server. Cache the final request path
 		// resulting in this response. If we followed a redirect chain, this will
@@ -525,6 +1070,46 @@ func (c *Client) Do(request *http.Request) (*http.Response, error) {
 	return response, err
 }
 
+// defaultEndpoint returns the current default endpoint.
+func (c *Client) defaultEndpoint() *url.URL {
+	c.endpointMu.Lock()
+	defer c.endpointMu.Unlock()
+
+	return c.endpoints[c.endpointIndex]
+}
+
+// rotateEndpoint advances the default endpoint past |failed|, if it remains
+// the current default endpoint.
+func (c *Client) rotateEndpoint(failed *url.URL) {
+	c.endpointMu.Lock()
+	defer c.endpointMu.Unlock()
+
+	if c.endpoints[c.endpointIndex] == failed && len(c.endpoints) > 1 {
+		c.endpointIndex = (c.endpointIndex + 1) % len(c.endpoints)
+
+		c.logger.WithFields(log.Fields{"failed": failed, "next": c.endpoints[c.endpointIndex]}).
+			Warn("rotated default endpoint")
+	}
+}
+
+// allowedEndpoint returns the first endpoint, beginning with the current
+// default, which is allowed by the circuit breaker. The returned endpoint
+// becomes the default. If all circuits are open, nil is returned.
+func (c *Client) allowedEndpoint() *url.URL {
+	c.endpointMu.Lock()
+	defer c.endpointMu.Unlock()
+
+	for i := 0; i != len(c.endpoints); i++ {
+		var ind = (c.endpointIndex + i) % len(c.endpoints)
+
+		if c.breaker.allow(c.endpoints[ind].Host, c.timeNow()) {
+			c.endpointIndex = ind
+			return c.endpoints[ind]
+		}
+	}
+	return nil
+}
+
 // Returns the |Fragment| whose Modified time is closest to but prior to the
 // given |t|. Can return a zeroed Fragment structure, if no fragment matches.
 func (c *Client) FragmentBeforeTime(name journal.Name, t time.Time) (journal.Fragment, error) {
@@ -571,6 +1156,70 @@ func (c *Client) FragmentBeforeTime(name journal.Name, t time.Time) (journal.Fra
 	}
 }
 
+// OffsetForTime returns the offset of journal |name| from which content was
+// written at or after time |t|. The offset is determined from modification
+// times of persisted Fragments, and is approximate to Fragment boundaries:
+// it's the Begin of the first Fragment persisted at or after |t|, and content
+// of that Fragment may have been written prior to |t|. All content before
+// the returned offset was written before |t|. If no persisted Fragment was
+// modified at or after |t|, the returned offset is the End of the last
+// persisted Fragment (or the write head, if all content is persisted).
+//
+// Modification times are drawn from a single listing of the broker
+// FragmentsAPI, which is scanned for the first Fragment (in offset order)
+// modified at or after |t|. Brokers which don't serve the FragmentsAPI are
+// instead binary-searched with HEAD requests, which presumes modification
+// times increase with offset.
+func (c *Client) OffsetForTime(name journal.Name, t time.Time) (int64, error) {
+	var set, _, err = c.listFragments(name, 0, -1)
+	if err == errFragmentsAPIUnavailable {
+		return c.offsetForTimeByHead(name, t)
+	} else if err != nil {
+		return 0, err
+	} else if len(set) == 0 {
+		return 0, nil // No content is persisted.
+	}
+
+	for _, fragment := range set {
+		if !fragment.RemoteModTime.Before(t) {
+			return fragment.Begin, nil
+		}
+	}
+	return set[len(set)-1].End, nil
+}
+
+// offsetForTimeByHead implements OffsetForTime by binary-searching HEAD
+// requests of journal |name|.
+func (c *Client) offsetForTimeByHead(name journal.Name, t time.Time) (int64, error) {
+	var args = journal.ReadArgs{Journal: name}
+	var result journal.ReadResult
+
+	if result, _ = c.Head(args); result.Error != nil {
+		return 0, result.Error
+	}
+
+	// Binary-search between 0 and the write-head for the first offset having
+	// a Fragment which isn't persisted, or was persisted at or after |t|.
+	var err error
+	var off = search(result.WriteHead, func(off int64) bool {
+		if err != nil {
+			return true // Unwind the search.
+		}
+		args.Offset = off
+
+		if result, _ = c.Head(args); result.Error != nil {
+			err = result.Error
+			return true
+		}
+		return result.Fragment.RemoteModTime.IsZero() || !result.Fragment.RemoteModTime.Before(t)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+	return off, nil
+}
+
 // Returns a list of |Fragment|s that service the given offset range in |journal|.
 func (c *Client) FragmentsInRange(name journal.Name, minOff, maxOff int64) ([]journal.Fragment, error) {
 	var off = minOff
@@ -592,6 +1241,165 @@ func (c *Client) FragmentsInRange(name journal.Name, minOff, maxOff int64) ([]jo
 	return fragments, nil
 }
 
+// FragmentDescriptor describes a persisted Fragment of a journal, and its
+// location in the Fragment backing store. The embedded Fragment provides its
+// offset range, Size, and RemoteModTime.
+type FragmentDescriptor struct {
+	journal.Fragment
+	// Signed or authorized URL of the Fragment in its backing store.
+	Location *url.URL
+}
+
+// ListFragments returns descriptors of persisted Fragments of journal |name|
+// which cover offsets [begin, end), ordered on offset. If |end| is -1, all
+// Fragments from |begin| are listed. Listing stops early at the first offset
+// not covered by a persisted Fragment (eg, because its content is still being
+// written by the broker, or is at the write head).
+//
+// Fragments are listed with a single request of the broker FragmentsAPI.
+// Brokers which don't serve the FragmentsAPI are instead issued a HEAD
+// request for each listed Fragment.
+func (c *Client) ListFragments(name journal.Name, begin, end int64) ([]FragmentDescriptor, error) {
+	var set, locations, err = c.listFragments(name, begin, end)
+	if err == errFragmentsAPIUnavailable {
+		return c.listFragmentsByHead(name, begin, end)
+	} else if err != nil {
+		return nil, err
+	}
+
+	// As would a sequence of HEADs, walk the longest Fragment covering each
+	// offset, until reaching |end| or an offset not covered by a Fragment.
+	// Like a read, a |begin| preceding the first Fragment (eg, because earlier
+	// Fragments were removed under a retention policy) skips to it.
+	var out []FragmentDescriptor
+	for off := begin; end == -1 || off < end; {
+		var ind = set.LongestOverlappingFragment(off)
+		if ind == len(set) || (set[ind].Begin > off && off != begin) {
+			break
+		}
+		out = append(out, FragmentDescriptor{
+			Fragment: set[ind],
+			Location: locations[set[ind].ContentName()],
+		})
+		off = set[ind].End
+	}
+	return out, nil
+}
+
+// listFragments requests a FragmentListing of |name| over [begin, end) from
+// the broker FragmentsAPI. It returns listed Fragments, and their locations
+// indexed on content name. If the broker doesn't serve the FragmentsAPI,
+// errFragmentsAPIUnavailable is returned.
+func (c *Client) listFragments(name journal.Name, begin, end int64) (journal.FragmentSet, map[string]*url.URL, error) {
+	if err := name.Validate(); err != nil {
+		return nil, nil, err
+	} else if c.isClosed() {
+		return nil, nil, ErrClientClosed
+	}
+	var endpoint = *c.defaultEndpoint() // Copy.
+	endpoint.Path = "/" + name.String()
+	endpoint.RawQuery = fmt.Sprintf("fragments=true&begin=%d&end=%d", begin, end)
+
+	var request, err = http.NewRequest("GET", endpoint.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	} else if err = c.authorize(request, false); err != nil {
+		return nil, nil, err
+	}
+	// Any broker may serve the listing: issue the request without using or
+	// updating the Journal location cache.
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusBadRequest {
+		// Brokers without a FragmentsAPI reject the "fragments" argument.
+		return nil, nil, errFragmentsAPIUnavailable
+	} else if response.StatusCode != http.StatusOK {
+		return nil, nil, journal.ErrorFromResponse(response)
+	}
+
+	var listing FragmentListing
+	if err = json.NewDecoder(response.Body).Decode(&listing); err != nil {
+		return nil, nil, err
+	}
+
+	var set journal.FragmentSet
+	var locations = make(map[string]*url.URL)
+
+	for _, lf := range listing.Fragments {
+		var fragment, err = journal.ParseFragment(name, lf.ContentName)
+		if err != nil {
+			return nil, nil, err
+		}
+		fragment.RemoteModTime = lf.ModTime
+
+		if locations[lf.ContentName], err = url.Parse(lf.URL); err != nil {
+			return nil, nil, err
+		}
+		set.Add(fragment)
+	}
+	return set, locations, nil
+}
+
+// listFragmentsByHead lists Fragments as ListFragments, by issuing a HEAD
+// request for each Fragment.
+func (c *Client) listFragmentsByHead(name journal.Name, begin, end int64) ([]FragmentDescriptor, error) {
+	var out []FragmentDescriptor
+
+	for off := begin; end == -1 || off < end; {
+		var result = c.HeadFragment(journal.ReadArgs{Journal: name, Offset: off})
+
+		if result.Error == journal.ErrNotYetAvailable {
+			break // |off| is at the write head.
+		} else if result.Error != nil {
+			return nil, result.Error
+		} else if result.FragmentLocation == nil {
+			break // Reached offsets which aren't yet persisted.
+		}
+
+		out = append(out, FragmentDescriptor{
+			Fragment: result.Fragment,
+			Location: result.FragmentLocation,
+		})
+		off = result.Fragment.End
+	}
+	return out, nil
+}
+
+// observeRequest records the duration of an |operation| begun at |started|,
+// with an outcome determined by |ctx| and the final value of |err|. Requests
+// aborted by cancellation of |ctx| are distinguished from other errors.
+// ErrNotYetAvailable is a regular response of non-blocking reads, and is
+// recorded as a success.
+func (c *Client) observeRequest(ctx context.Context, operation string, started time.Time, err *error) {
+	var outcome = "success"
+
+	if ctx.Err() != nil {
+		outcome = "cancelled"
+	} else if *err != nil && *err != journal.ErrNotYetAvailable {
+		outcome = "error"
+	}
+	metrics.GazetteRequestDurationSeconds.WithLabelValues(operation, outcome).
+		Observe(c.timeNow().Sub(started).Seconds())
+}
+
+// limitedReadCloser is an io.ReadCloser which reads through a bounded Reader.
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitBody wraps |body| to return io.EOF after |args.MaxBytes|, if set.
+func limitBody(args journal.ReadArgs, body io.ReadCloser) io.ReadCloser {
+	if args.MaxBytes == 0 {
+		return body
+	}
+	return limitedReadCloser{Reader: io.LimitReader(body, args.MaxBytes), Closer: body}
+}
+
 type readStatsWrapper struct {
 	stream io.ReadCloser
 	name   journal.Name
@@ -2,20 +2,33 @@ package gazette
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"expvar"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	gc "github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
+	"golang.org/x/net/http2"
 
 	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/metrics"
 )
 
 const (
@@ -116,6 +129,58 @@ func (s *ClientSuite) TestHeadRequestWithInvalidation(c *gc.C) {
 	c.Check(ok, gc.Equals, false)
 }
 
+func (s *ClientSuite) TestEndpointRotation(c *gc.C) {
+	var mockClient = &mockHttpClient{}
+
+	client, err := NewClient("http://one", "two:8080")
+	c.Assert(err, gc.IsNil)
+	client.httpClient = mockClient
+
+	// Request to the first endpoint fails.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.String() == "http://one/a/journal"
+	})).Return(nil, io.ErrUnexpectedEOF).Once()
+
+	// Successive requests rotate to, and remain with, the second endpoint.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.String() == "http://two:8080/a/journal"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNoContent,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Twice()
+
+	for _, expectErr := range []error{io.ErrUnexpectedEOF, nil, nil} {
+		request, _ := http.NewRequest("PUT", "/a/journal", nil)
+		_, err = client.Do(request)
+		c.Check(err, gc.Equals, expectErr)
+	}
+	mockClient.AssertExpectations(c)
+
+	_, err = NewClient()
+	c.Check(err, gc.ErrorMatches, "expected at least one endpoint")
+}
+
+func (s *ClientSuite) TestHeadFragment(c *gc.C) {
+	var mockClient = &mockHttpClient{}
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD" &&
+			request.URL.String() == "http://default/a/journal?block=false&offset=1005"
+	})).Return(newReadResponseFixture(), nil).Once()
+
+	s.client.httpClient = mockClient
+	var result = s.client.HeadFragment(journal.ReadArgs{Journal: "a/journal", Offset: 1005})
+
+	c.Check(result.Error, gc.IsNil)
+	c.Check(result.Offset, gc.Equals, int64(1005))
+	c.Check(result.WriteHead, gc.Equals, int64(3000))
+	c.Check(result.Fragment, gc.DeepEquals, fragmentFixture)
+	c.Check(result.FragmentName(), gc.Equals, kFragmentFixtureStr)
+	c.Check(result.FragmentLocation, gc.DeepEquals, newURL("http://cloud/fragment/location"))
+
+	mockClient.AssertExpectations(c)
+}
+
 func (s *ClientSuite) TestDirectGet(c *gc.C) {
 	mockClient := &mockHttpClient{}
 
@@ -140,6 +205,29 @@ func (s *ClientSuite) TestDirectGet(c *gc.C) {
 	c.Check(body.(readStatsWrapper).stream, gc.Equals, responseFixture.Body)
 }
 
+func (s *ClientSuite) TestDirectGetWithMaxBytes(c *gc.C) {
+	mockClient := &mockHttpClient{}
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "GET" &&
+			request.URL.String() == "http://default/a/journal?block=false&offset=1005"
+	})).Return(newReadResponseFixture(), nil).Once()
+
+	s.client.httpClient = mockClient
+	result, body := s.client.GetDirect(journal.ReadArgs{
+		Journal: "a/journal", Offset: 1005, Blocking: false, MaxBytes: 3})
+	c.Check(result.Error, gc.IsNil)
+	c.Check(result.Offset, gc.Equals, int64(1005))
+
+	// Expect the body is truncated to |MaxBytes|.
+	content, err := ioutil.ReadAll(body)
+	c.Check(err, gc.IsNil)
+	c.Check(string(content), gc.Equals, "bod")
+	c.Check(body.Close(), gc.IsNil)
+
+	mockClient.AssertExpectations(c)
+}
+
 func (s *ClientSuite) TestDirectGetFails(c *gc.C) {
 	mockClient := &mockHttpClient{}
 
@@ -218,7 +306,7 @@ func (s *ClientSuite) TestGetWithFragmentLocation(c *gc.C) {
 	})).Return(newReadResponseFixture(), nil).Once()
 
 	// Expect a following GET request to the returned cloud URL.
-	mockClient.On("Get", "http://cloud/fragment/location").Return(&http.Response{
+	mockClient.On("Do", getRequest("http://cloud/fragment/location")).Return(&http.Response{
 		StatusCode: http.StatusOK,
 		Body:       ioutil.NopCloser(strings.NewReader("xxxxxfragment-content...")),
 	}, nil).Once()
@@ -250,7 +338,7 @@ func (s *ClientSuite) TestGetWithFragmentLocationFails(c *gc.C) {
 	})).Return(newReadResponseFixture(), nil).Once()
 
 	// Expect a following GET request to the returned cloud URL, which fails.
-	mockClient.On("Get", "http://cloud/fragment/location").Return(&http.Response{
+	mockClient.On("Do", getRequest("http://cloud/fragment/location")).Return(&http.Response{
 		StatusCode: http.StatusInternalServerError,
 		Status:     "Internal Error",
 		Body:       ioutil.NopCloser(strings.NewReader("message")),
@@ -274,30 +362,30 @@ func (s *ClientSuite) TestGetPersistedErrorCases(c *gc.C) {
 	readResult := journal.ReadResult{Offset: 1005, WriteHead: 3000, Fragment: fragmentFixture}
 
 	// Expect response errors are passed through.
-	mockClient.On("Get", "http://cloud/location").Return(nil, errors.New("error!")).Once()
+	mockClient.On("Do", getRequest("http://cloud/location")).Return(nil, errors.New("error!")).Once()
 
-	body, err := s.client.openFragment(location, readResult)
+	body, err := s.client.openFragment(context.Background(), location, readResult)
 	c.Check(body, gc.IsNil)
 	c.Check(err, gc.ErrorMatches, "error!")
 
 	// Expect non-200 is turned into an error.
-	mockClient.On("Get", "http://cloud/location").Return(&http.Response{
+	mockClient.On("Do", getRequest("http://cloud/location")).Return(&http.Response{
 		StatusCode: http.StatusTeapot,
 		Status:     "error!",
 		Body:       ioutil.NopCloser(nil),
 	}, nil).Once()
 
-	body, err = s.client.openFragment(location, readResult)
+	body, err = s.client.openFragment(context.Background(), location, readResult)
 	c.Check(body, gc.IsNil)
 	c.Check(err, gc.ErrorMatches, "fetching fragment: error!")
 
 	// Seek failure (too little content). Expect error is returned.
-	mockClient.On("Get", "http://cloud/location").Return(&http.Response{
+	mockClient.On("Do", getRequest("http://cloud/location")).Return(&http.Response{
 		StatusCode: http.StatusOK,
 		Body:       ioutil.NopCloser(strings.NewReader("abc")),
 	}, nil).Once()
 
-	body, err = s.client.openFragment(location, readResult)
+	body, err = s.client.openFragment(context.Background(), location, readResult)
 	c.Check(body, gc.IsNil)
 	c.Check(err, gc.ErrorMatches, "seeking fragment: EOF")
 }
@@ -327,9 +415,142 @@ func (s *ClientSuite) TestCreate(c *gc.C) {
 	c.Check(s.client.Create("a/journal"), gc.Equals, journal.ErrExists)
 	c.Check(s.client.Create("a/journal"), gc.IsNil)
 
+	// Expect a replication argument is passed through.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "POST" &&
+			request.URL.String() == "http://default/a/journal?replication=3"
+	})).Return(&http.Response{
+		StatusCode: http.StatusCreated,
+		Body:       ioutil.NopCloser(nil),
+	}, nil).Once()
+
+	c.Check(s.client.CreateWithReplication(context.Background(), "a/journal", 3), gc.IsNil)
+
+	mockClient.AssertExpectations(c)
+}
+
+func (s *ClientSuite) TestDelete(c *gc.C) {
+	mockClient := &mockHttpClient{}
+
+	// Expect a DELETE of the journal. Fail as not found.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "DELETE" &&
+			request.URL.String() == "http://default/a/journal"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(nil),
+	}, nil).Once()
+
+	// Expect a second DELETE, which succeeds.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "DELETE" &&
+			request.URL.String() == "http://default/a/journal"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNoContent,
+		Body:       ioutil.NopCloser(nil),
+	}, nil).Once()
+
+	s.client.httpClient = mockClient
+	c.Check(s.client.Delete("a/journal"), gc.Equals, journal.ErrNotFound)
+	c.Check(s.client.Delete("a/journal"), gc.IsNil)
+	c.Check(s.client.Delete("/a/journal"), gc.ErrorMatches, "invalid journal name .*")
+
 	mockClient.AssertExpectations(c)
 }
 
+func (s *ClientSuite) TestContextCancelsRequests(c *gc.C) {
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "HEAD":
+				w.Header().Set(WriteHeadHeader, "100")
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			default:
+				<-r.Context().Done() // Long-poll until the request is aborted.
+			}
+		}))
+	defer server.Close()
+
+	var client, err = NewClientWithHttpClient(server.URL, &http.Client{})
+	c.Assert(err, gc.IsNil)
+
+	// Expect a blocked GET is aborted by cancellation.
+	var ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	var result, body = client.GetContext(ctx,
+		journal.ReadArgs{Journal: "a/journal", Offset: 100, Blocking: true})
+	c.Check(result.Error, gc.NotNil)
+	c.Check(body, gc.IsNil)
+	c.Check(ctx.Err(), gc.Equals, context.Canceled)
+
+	// Requests under an expired context fail immediately.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	result, _ = client.HeadContext(ctx, journal.ReadArgs{Journal: "a/journal"})
+	c.Check(result.Error, gc.NotNil)
+	c.Check(client.PutContext(ctx, journal.AppendArgs{
+		Journal: "a/journal",
+		Content: strings.NewReader("content"),
+	}).Error, gc.NotNil)
+	c.Check(client.CreateContext(ctx, "a/journal"), gc.NotNil)
+}
+
+func (s *ClientSuite) TestClose(c *gc.C) {
+	var transport = &idleTrackingTransport{}
+	var client, err = NewClientWithHttpClient("http://default", &http.Client{Transport: transport})
+	c.Assert(err, gc.IsNil)
+
+	// Middleware doesn't hide the transport from Close.
+	client.SetRoundTripper(func(next http.RoundTripper) http.RoundTripper { return next })
+
+	c.Check(client.Close(), gc.IsNil)
+	c.Check(transport.closed, gc.Equals, 1)
+
+	// Further requests fail without reaching the transport.
+	var result, _ = client.Head(journal.ReadArgs{Journal: "a/journal"})
+	c.Check(result.Error, gc.Equals, ErrClientClosed)
+	result, _ = client.Get(journal.ReadArgs{Journal: "a/journal"})
+	c.Check(result.Error, gc.Equals, ErrClientClosed)
+
+	var appendResult = client.Put(journal.AppendArgs{
+		Journal: "a/journal",
+		Content: strings.NewReader("content"),
+	})
+	c.Check(appendResult.Error, gc.Equals, ErrClientClosed)
+	c.Check(client.Create("a/journal"), gc.Equals, ErrClientClosed)
+
+	_, err = client.openFragment(context.Background(), newURL("http://cloud/location"), journal.ReadResult{})
+	c.Check(err, gc.Equals, ErrClientClosed)
+
+	c.Check(transport.requests, gc.Equals, 0)
+
+	// A repeated Close fails.
+	c.Check(client.Close(), gc.Equals, ErrClientClosed)
+	c.Check(transport.closed, gc.Equals, 1)
+}
+
+func (s *ClientSuite) TestInvalidNamesAreRejected(c *gc.C) {
+	// Expect no requests are issued.
+	s.client.httpClient = &mockHttpClient{}
+
+	c.Check(s.client.Create("/a/journal"), gc.ErrorMatches, "invalid journal name .*")
+
+	var result, _ = s.client.Head(journal.ReadArgs{Journal: "a/journal/"})
+	c.Check(result.Error, gc.ErrorMatches, "invalid journal name .*")
+
+	result, _ = s.client.Get(journal.ReadArgs{Journal: "a//journal"})
+	c.Check(result.Error, gc.ErrorMatches, "invalid journal name .*")
+
+	var appendResult = s.client.Put(journal.AppendArgs{
+		Journal: "a/jour nal",
+		Content: strings.NewReader("content"),
+	})
+	c.Check(appendResult.Error, gc.ErrorMatches, "invalid journal name .*")
+}
+
 func (s *ClientSuite) TestPut(c *gc.C) {
 	content := strings.NewReader("foobar")
 	mockClient := &mockHttpClient{}
@@ -380,6 +601,7 @@ func (s *ClientSuite) TestPut(c *gc.C) {
 
 	res = s.client.Put(journal.AppendArgs{Journal: "a/journal", Content: content})
 	c.Check(res.Error, gc.ErrorMatches, `Internal Server Error \(some reason\)`)
+	c.Check(res.Error.(*journal.StatusError).StatusCode, gc.Equals, http.StatusInternalServerError)
 
 	// WriteHead was parsed despite the failure.
 	c.Check(res.WriteHead, gc.Equals, int64(12341234))
@@ -420,6 +642,212 @@ func (s *ClientSuite) TestPut(c *gc.C) {
 	c.Check(writerMap.Get("head").(*expvar.Int).String(), gc.Equals, "12341235")
 }
 
+func (s *ClientSuite) TestPutContentLength(c *gc.C) {
+	mockClient := &mockHttpClient{}
+	s.client.httpClient = mockClient
+	s.client.locationCache.Add("/a/journal", newURL("http://default/a/journal"))
+
+	var expectPut = func(contentLength int64, chunked bool) {
+		mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+			// Chunked encoding is used by net/http for a non-nil Body having
+			// an unknown (zero) ContentLength.
+			return request.Method == "PUT" &&
+				request.ContentLength == contentLength &&
+				(request.Body != nil && request.ContentLength == 0) == chunked
+		})).Return(&http.Response{
+			StatusCode: http.StatusNoContent,
+			Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+			Header:     http.Header{WriteHeadHeader: []string{"1234"}},
+		}, nil).Once()
+	}
+
+	// A bytes.Reader body is sent with its Content-Length.
+	expectPut(6, false)
+	c.Check(s.client.Put(journal.AppendArgs{
+		Journal: "a/journal",
+		Content: bytes.NewReader([]byte("foobar")),
+	}).Error, gc.IsNil)
+
+	// As is a reader of explicit ContentLength.
+	expectPut(6, false)
+	c.Check(s.client.Put(journal.AppendArgs{
+		Journal:       "a/journal",
+		Content:       io.MultiReader(strings.NewReader("foo"), strings.NewReader("bar")),
+		ContentLength: 6,
+	}).Error, gc.IsNil)
+
+	// A reader of unknown length is streamed.
+	expectPut(0, true)
+	c.Check(s.client.Put(journal.AppendArgs{
+		Journal: "a/journal",
+		Content: io.MultiReader(strings.NewReader("foo"), strings.NewReader("bar")),
+	}).Error, gc.IsNil)
+
+	mockClient.AssertExpectations(c)
+}
+
+func (s *ClientSuite) TestResumablePut(c *gc.C) {
+	mockClient := &mockHttpClient{}
+	s.client.httpClient = mockClient
+	s.client.locationCache.Add("/a/journal", newURL("http://default/a/journal"))
+	s.client.SetResumableAppends(true)
+
+	var expectHead = func(writeHead string) {
+		mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+			return request.Method == "HEAD" && request.URL.Query().Get("offset") == "-1"
+		})).Return(&http.Response{
+			StatusCode: http.StatusRequestedRangeNotSatisfiable,
+			Header:     http.Header{WriteHeadHeader: []string{writeHead}},
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil).Once()
+	}
+	// expectPut expects a PUT, of which |read| bytes of content are read by the
+	// transport prior to a failure (if |fail|).
+	var expectPut = func(read int64, fail bool) {
+		var call = mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+			return request.Method == "PUT" && request.ContentLength == 6
+		})).Run(func(args mock.Arguments) {
+			io.CopyN(ioutil.Discard, args.Get(0).(*http.Request).Body, read)
+		}).Once()
+
+		if fail {
+			call.Return((*http.Response)(nil), errors.New("connection reset"))
+		} else {
+			call.Return(&http.Response{
+				StatusCode: http.StatusNoContent,
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+				Header:     http.Header{WriteHeadHeader: []string{"106"}},
+			}, nil)
+		}
+	}
+	var put = func() journal.AppendResult {
+		return s.client.Put(journal.AppendArgs{
+			Journal: "a/journal",
+			Content: bytes.NewReader([]byte("foobar")),
+			Token:   "a-token",
+		})
+	}
+
+	// Case: The connection fails after partially sending content. Expect the
+	// append is re-sent, and succeeds.
+	expectHead("100")
+	expectPut(3, true)
+	expectPut(6, false)
+
+	c.Check(put(), gc.DeepEquals, journal.AppendResult{WriteHead: 106})
+	mockClient.AssertExpectations(c)
+
+	// Case: The connection fails after all content is sent, and the journal
+	// holds the content at the prior write head. Expect the append is confirmed.
+	s.client.committedTokens.Purge()
+
+	mockClient = &mockHttpClient{}
+	s.client.httpClient = mockClient
+
+	expectHead("100")
+	expectPut(6, true)
+	expectHead("106")
+
+	// Reads of offset 100 are served directly by the broker.
+	for _, method := range []string{"HEAD", "GET"} {
+		var method = method
+		mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+			return request.Method == method && request.URL.Query().Get("offset") == "100"
+		})).Return(&http.Response{
+			StatusCode: http.StatusPartialContent,
+			Header: http.Header{
+				"Content-Range": []string{"bytes 100-9999999999/9999999999"},
+				WriteHeadHeader: []string{"106"},
+			},
+			Body: ioutil.NopCloser(strings.NewReader("foobar")),
+		}, nil).Once()
+	}
+
+	c.Check(put(), gc.DeepEquals, journal.AppendResult{WriteHead: 106})
+	mockClient.AssertExpectations(c)
+
+	// A repeated Put of the Token returns the confirmed result.
+	c.Check(put(), gc.DeepEquals, journal.AppendResult{WriteHead: 106})
+
+	// Case: All content is sent, but the journal write head is unchanged.
+	// Whether the append will commit is unknown, and the error is returned.
+	s.client.committedTokens.Purge()
+
+	mockClient = &mockHttpClient{}
+	s.client.httpClient = mockClient
+
+	expectHead("100")
+	expectPut(6, true)
+	expectHead("100")
+
+	c.Check(put().Error, gc.ErrorMatches, "connection reset")
+	mockClient.AssertExpectations(c)
+}
+
+func (s *ClientSuite) TestPutWithToken(c *gc.C) {
+	mockClient := &mockHttpClient{}
+	s.client.httpClient = mockClient
+	s.client.locationCache.Add("/a/journal", newURL("http://default/a/journal"))
+
+	var expectPut = func(status int, writeHead string) {
+		mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+			return request.Method == "PUT" && request.URL.Path == "/a/journal"
+		})).Return(&http.Response{
+			Status:     http.StatusText(status),
+			StatusCode: status,
+			Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+			Header:     http.Header{WriteHeadHeader: []string{writeHead}},
+		}, nil).Once()
+	}
+	var put = func(token string) journal.AppendResult {
+		return s.client.Put(journal.AppendArgs{
+			Journal: "a/journal",
+			Content: strings.NewReader("foobar"),
+			Token:   token,
+		})
+	}
+
+	// A failed append of a token doesn't prevent its retry.
+	expectPut(http.StatusInternalServerError, "100")
+	c.Check(put("token-1").Error, gc.NotNil)
+
+	expectPut(http.StatusNoContent, "106")
+	c.Check(put("token-1"), gc.DeepEquals, journal.AppendResult{WriteHead: 106})
+
+	// The append of "token-1" committed. Expect it's not re-sent.
+	c.Check(put("token-1"), gc.DeepEquals, journal.AppendResult{WriteHead: 106})
+
+	// Other tokens, and appends without a token, are sent.
+	expectPut(http.StatusNoContent, "112")
+	c.Check(put("token-2"), gc.DeepEquals, journal.AppendResult{WriteHead: 112})
+	expectPut(http.StatusNoContent, "118")
+	c.Check(put(""), gc.DeepEquals, journal.AppendResult{WriteHead: 118})
+	expectPut(http.StatusNoContent, "124")
+	c.Check(put(""), gc.DeepEquals, journal.AppendResult{WriteHead: 124})
+
+	mockClient.AssertExpectations(c)
+}
+
+func (s *ClientSuite) TestLoggerInjection(c *gc.C) {
+	var buf bytes.Buffer
+	var logger = log.New()
+	logger.Out = &buf
+
+	s.client.SetLogger(logger.WithField("app", "test"))
+	var writer = NewWriteService(s.client)
+	c.Check(writer.logger, gc.Equals, s.client.logger)
+
+	// Expect a malformed write head is logged through the injected logger,
+	// with its fields.
+	s.client.parseAppendResponse(&http.Response{
+		StatusCode: http.StatusNoContent,
+		Header:     http.Header{WriteHeadHeader: []string{"invalid"}},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	})
+	c.Check(buf.String(), gc.Matches, `(?s).*msg="error parsing write head".*`)
+	c.Check(buf.String(), gc.Matches, `(?s).*app=test.*`)
+}
+
 func (s *ClientSuite) TestReadResultParsingErrorCases(c *gc.C) {
 	args := journal.ReadArgs{Journal: "a/journal"}
 
@@ -517,6 +945,88 @@ func (s *ClientSuite) TestDialerIsNonNil(c *gc.C) {
 	c.Check(client.httpClient.(*http.Client).Transport.(*http.Transport).Dial, gc.NotNil)
 }
 
+func (s *ClientSuite) TestHttp2Transport(c *gc.C) {
+	var release = make(chan struct{})
+	var conns, h2Requests int32
+
+	var server = httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.ProtoMajor == 2 {
+				atomic.AddInt32(&h2Requests, 1)
+			}
+			switch r.Method {
+			case "HEAD":
+				w.Header().Set(WriteHeadHeader, "100")
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			case "GET":
+				<-release // Long-poll until content is "written".
+
+				w.Header().Set("Content-Range", "bytes 100-105/106")
+				w.Header().Set(WriteHeadHeader, "106")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte("foobar"))
+			case "PUT":
+				var n, _ = io.Copy(ioutil.Discard, r.Body)
+				w.Header().Set(WriteHeadHeader, strconv.FormatInt(100+n, 10))
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	c.Assert(http2.ConfigureServer(server.Config, nil), gc.IsNil)
+	server.TLS = server.Config.TLSConfig
+	server.StartTLS()
+	defer server.Close()
+
+	transport, err := MakeHttp2Transport(&tls.Config{InsecureSkipVerify: true})
+	c.Assert(err, gc.IsNil)
+	client, err := NewClientWithHttpClient(server.URL, &http.Client{Transport: transport})
+	c.Assert(err, gc.IsNil)
+
+	// Establish the connection with an initial append.
+	c.Check(client.Put(journal.AppendArgs{
+		Journal: "a/journal",
+		Content: strings.NewReader("warm-up"),
+	}).Error, gc.IsNil)
+
+	// Begin concurrent long-polling reads.
+	var wg sync.WaitGroup
+	for i := 0; i != 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var result, body = client.Get(journal.ReadArgs{
+				Journal: "a/journal", Offset: 100, Blocking: true})
+			c.Check(result.Error, gc.IsNil)
+			c.Check(result.Offset, gc.Equals, int64(100))
+
+			var content, err = ioutil.ReadAll(body)
+			c.Check(err, gc.IsNil)
+			c.Check(string(content), gc.Equals, "foobar")
+			body.Close()
+		}()
+	}
+
+	// While reads are blocked, a large append completes.
+	var result = client.Put(journal.AppendArgs{
+		Journal: "a/journal",
+		Content: bytes.NewReader(make([]byte, 1<<22)),
+	})
+	c.Check(result.Error, gc.IsNil)
+	c.Check(result.WriteHead, gc.Equals, int64(100+1<<22))
+
+	close(release)
+	wg.Wait()
+
+	// Expect all requests were multiplexed over a single HTTP/2 connection.
+	c.Check(atomic.LoadInt32(&conns), gc.Equals, int32(1))
+	c.Check(atomic.LoadInt32(&h2Requests) >= 22, gc.Equals, true)
+}
+
 func (s *ClientSuite) TestFragmentBeforeTime(c *gc.C) {
 	var mockClient = new(mockHttpClient)
 	var response = newReadResponseFixture()
@@ -578,6 +1088,110 @@ func (s *ClientSuite) TestFragmentBeforeTimeNoMatch(c *gc.C) {
 	c.Check(frag, gc.DeepEquals, journal.Fragment{})
 }
 
+func (s *ClientSuite) TestOffsetForTime(c *gc.C) {
+	var mockClient = new(mockHttpClient)
+	var response = newReadResponseFixture()
+	var baseDate = time.Date(2016, 7, 12, 23, 0, 0, 0, time.UTC)
+
+	// Expect the Client falls back to a binary search of HEAD requests.
+	expectFragmentsAPIUnavailable(mockClient)
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		// Every fragment contains 1000 bytes, and is timed an hour after the
+		// last fragment. The write head is 3000.
+		var off, err = strconv.Atoi(request.URL.Query()["offset"][0])
+		c.Assert(err, gc.IsNil)
+		var fragmentIndex = int64(off) / 1000
+
+		var fragment = journal.Fragment{
+			Begin:         fragmentIndex * 1000,
+			End:           (fragmentIndex + 1) * 1000,
+			RemoteModTime: baseDate.Add(time.Hour * time.Duration(fragmentIndex)),
+			Sum:           fakeSum,
+		}
+
+		response.Header.Set(FragmentNameHeader, fragment.ContentName())
+		response.Header.Set(FragmentLastModifiedHeader, fragment.RemoteModTime.Format(http.TimeFormat))
+
+		return true
+	})).Return(response, nil)
+
+	s.client.httpClient = mockClient
+
+	for _, tc := range []struct {
+		t      time.Time
+		expect int64
+	}{
+		{baseDate.Add(-time.Hour), 0},          // Prior to all fragments.
+		{baseDate.Add(time.Hour), 1000},        // Exactly the mod time of a fragment.
+		{baseDate.Add(90 * time.Minute), 2000}, // Between fragment mod times.
+		{baseDate.Add(3 * time.Hour), 3000},    // After all fragments.
+	} {
+		var offset, err = s.client.OffsetForTime("a/journal", tc.t)
+		c.Check(err, gc.IsNil)
+		c.Check(offset, gc.Equals, tc.expect)
+	}
+}
+
+func (s *ClientSuite) TestOffsetForTimeError(c *gc.C) {
+	var mockClient = new(mockHttpClient)
+	expectFragmentsAPIUnavailable(mockClient)
+
+	// The initial HEAD succeeds, but a following one fails.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.Query()["offset"][0] == "0"
+	})).Return(newReadResponseFixture(), nil).Once()
+	mockClient.On("Do", mock.Anything).Return(nil, errors.New("error!"))
+
+	s.client.httpClient = mockClient
+
+	var _, err = s.client.OffsetForTime("a/journal", time.Now())
+	c.Check(err, gc.ErrorMatches, ".*error!")
+}
+
+func (s *ClientSuite) TestOffsetForTimeFromListing(c *gc.C) {
+	var mockClient = new(mockHttpClient)
+	var baseDate = time.Date(2016, 7, 12, 23, 0, 0, 0, time.UTC)
+
+	var listed = func(begin, end int64, modTime time.Time) ListedFragment {
+		var f = journal.Fragment{Begin: begin, End: end, Sum: fakeSum}
+		return ListedFragment{ContentName: f.ContentName(), ModTime: modTime, URL: "http://cloud/"}
+	}
+	// Fragment mod times needn't increase with offset (eg, because a Fragment
+	// was persisted late, after a broker failure).
+	var listing, _ = json.Marshal(FragmentListing{Fragments: []ListedFragment{
+		listed(1000, 2000, baseDate),
+		listed(2000, 3000, baseDate.Add(2*time.Hour)),
+		listed(3000, 4000, baseDate.Add(time.Hour)),
+	}})
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "GET" && request.URL.Query().Get("fragments") == "true"
+	})).Return(func(*http.Request) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(listing)),
+		}
+	}, nil)
+
+	s.client.httpClient = mockClient
+
+	for _, tc := range []struct {
+		t      time.Time
+		expect int64
+	}{
+		{baseDate.Add(-time.Hour), 1000},       // Prior to all fragments.
+		{baseDate, 1000},                       // Exactly the mod time of a fragment.
+		{baseDate.Add(30 * time.Minute), 2000}, // First fragment (by offset) modified after.
+		{baseDate.Add(90 * time.Minute), 2000},
+		{baseDate.Add(3 * time.Hour), 4000}, // After all fragments.
+	} {
+		var offset, err = s.client.OffsetForTime("a/journal", tc.t)
+		c.Check(err, gc.IsNil)
+		c.Check(offset, gc.Equals, tc.expect)
+	}
+}
+
 func (s *ClientSuite) TestFragmentsInRange(c *gc.C) {
 	var mockClient = new(mockHttpClient)
 	var response = newReadResponseFixture()
@@ -615,6 +1229,192 @@ func (s *ClientSuite) TestFragmentsInRange(c *gc.C) {
 	mockClient.AssertExpectations(c)
 }
 
+func (s *ClientSuite) TestListFragments(c *gc.C) {
+	var mockClient = new(mockHttpClient)
+	var response = newReadResponseFixture()
+	var baseDate = time.Date(2016, 7, 12, 23, 0, 0, 0, time.UTC)
+
+	// Expect the Client falls back to a HEAD of each Fragment.
+	expectFragmentsAPIUnavailable(mockClient)
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		var off, _ = strconv.Atoi(request.URL.Query()["offset"][0])
+		off -= off % 1000
+
+		if off >= 3000 {
+			// Fragments from offset 3000 aren't yet persisted.
+			response.Header.Del(FragmentLocationHeader)
+		} else {
+			response.Header.Set(FragmentLocationHeader, fmt.Sprintf("http://cloud/fragment/%d", off))
+		}
+
+		var fragment = journal.Fragment{
+			Begin:         int64(off),
+			End:           int64(off + 1000),
+			RemoteModTime: baseDate.Add(time.Hour * time.Duration(off/1000)),
+			Sum:           fakeSum,
+		}
+		response.Header.Set(FragmentNameHeader, fragment.ContentName())
+		response.Header.Set(FragmentLastModifiedHeader, fragment.RemoteModTime.Format(http.TimeFormat))
+
+		return request.Method == "HEAD" && request.URL.Path == "/a/journal"
+	})).Return(response, nil)
+
+	s.client.httpClient = mockClient
+
+	var descriptor = func(off int64) FragmentDescriptor {
+		return FragmentDescriptor{
+			Fragment: journal.Fragment{
+				Journal:       "a/journal",
+				Begin:         off,
+				End:           off + 1000,
+				RemoteModTime: baseDate.Add(time.Hour * time.Duration(off/1000)),
+				Sum:           fakeSum,
+			},
+			Location: newURL(fmt.Sprintf("http://cloud/fragment/%d", off)),
+		}
+	}
+
+	// List a bounded range.
+	frags, err := s.client.ListFragments("a/journal", 1001, 1999)
+	c.Check(err, gc.IsNil)
+	c.Check(frags, gc.DeepEquals, []FragmentDescriptor{descriptor(1000)})
+
+	// List through the last persisted fragment.
+	frags, err = s.client.ListFragments("a/journal", 0, -1)
+	c.Check(err, gc.IsNil)
+	c.Check(frags, gc.DeepEquals, []FragmentDescriptor{
+		descriptor(0), descriptor(1000), descriptor(2000)})
+	c.Check(frags[1].Size(), gc.Equals, int64(1000))
+}
+
+func (s *ClientSuite) TestListFragmentsFromListing(c *gc.C) {
+	var mockClient = new(mockHttpClient)
+	var baseDate = time.Date(2016, 7, 12, 23, 0, 0, 0, time.UTC)
+
+	var fragment = func(begin, end int64) journal.Fragment {
+		return journal.Fragment{
+			Journal:       "a/journal",
+			Begin:         begin,
+			End:           end,
+			RemoteModTime: baseDate.Add(time.Duration(begin) * time.Second),
+			Sum:           fakeSum,
+		}
+	}
+	var listed = func(f journal.Fragment) ListedFragment {
+		return ListedFragment{
+			ContentName: f.ContentName(),
+			ModTime:     f.RemoteModTime,
+			URL:         "http://cloud/" + f.ContentName(),
+		}
+	}
+	var listing, _ = json.Marshal(FragmentListing{Fragments: []ListedFragment{
+		listed(fragment(0, 1000)),
+		listed(fragment(500, 1500)),
+		listed(fragment(1000, 2000)),
+		// Offsets [2000, 3000) aren't persisted.
+		listed(fragment(3000, 4000)),
+	}})
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "GET" &&
+			request.URL.String() == "http://default/a/journal?fragments=true&begin=0&end=-1"
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader(listing)),
+	}, nil).Once()
+
+	s.client.httpClient = mockClient
+
+	var descriptor = func(f journal.Fragment) FragmentDescriptor {
+		return FragmentDescriptor{Fragment: f, Location: newURL("http://cloud/" + f.ContentName())}
+	}
+
+	// Expect the longest Fragment covering each offset is listed, through the
+	// first offset not covered by a Fragment.
+	frags, err := s.client.ListFragments("a/journal", 0, -1)
+	c.Check(err, gc.IsNil)
+	c.Check(frags, gc.DeepEquals, []FragmentDescriptor{
+		descriptor(fragment(0, 1000)), descriptor(fragment(1000, 2000))})
+
+	// A |begin| before the first listed Fragment skips to it.
+	listing, _ = json.Marshal(FragmentListing{Fragments: []ListedFragment{
+		listed(fragment(3000, 4000)),
+	}})
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "GET" &&
+			request.URL.String() == "http://default/a/journal?fragments=true&begin=2500&end=-1"
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader(listing)),
+	}, nil).Once()
+
+	frags, err = s.client.ListFragments("a/journal", 2500, -1)
+	c.Check(err, gc.IsNil)
+	c.Check(frags, gc.DeepEquals, []FragmentDescriptor{descriptor(fragment(3000, 4000))})
+
+	mockClient.AssertExpectations(c)
+}
+
+func (s *ClientSuite) TestRequestDurationOutcomes(c *gc.C) {
+	var sampleCount = func(outcome string) uint64 {
+		var m dto.Metric
+		var h = metrics.GazetteRequestDurationSeconds.WithLabelValues("test-op", outcome)
+		c.Assert(h.(prometheus.Metric).Write(&m), gc.IsNil)
+		return m.GetHistogram().GetSampleCount()
+	}
+	var ctx, cancel = context.WithCancel(context.Background())
+	var started = time.Unix(1230, 0)
+
+	var err error
+	s.client.observeRequest(ctx, "test-op", started, &err)
+	err = journal.ErrNotYetAvailable
+	s.client.observeRequest(ctx, "test-op", started, &err)
+	err = io.ErrUnexpectedEOF
+	s.client.observeRequest(ctx, "test-op", started, &err)
+
+	// Cancelled requests are recorded as such, regardless of error.
+	cancel()
+	s.client.observeRequest(ctx, "test-op", started, &err)
+
+	c.Check(sampleCount("success"), gc.Equals, uint64(2))
+	c.Check(sampleCount("error"), gc.Equals, uint64(1))
+	c.Check(sampleCount("cancelled"), gc.Equals, uint64(1))
+}
+
+// idleTrackingTransport is an http.RoundTripper which counts requests, and
+// calls of CloseIdleConnections.
+type idleTrackingTransport struct {
+	requests, closed int
+}
+
+func (t *idleTrackingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	t.requests++
+	return nil, errors.New("unexpected request")
+}
+
+func (t *idleTrackingTransport) CloseIdleConnections() { t.closed++ }
+
+// getRequest matches a GET request of |url|.
+func getRequest(url string) interface{} {
+	return mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "GET" && request.URL.String() == url
+	})
+}
+
+// expectFragmentsAPIUnavailable expects FragmentsAPI requests of |m|, and
+// responds as a broker which doesn't serve the FragmentsAPI.
+func expectFragmentsAPIUnavailable(m *mockHttpClient) {
+	m.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "GET" && request.URL.Query().Get("fragments") != ""
+	})).Return(func(*http.Request) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusBadRequest,
+			Body:       ioutil.NopCloser(strings.NewReader(`schema: invalid path "fragments"`)),
+		}
+	}, nil)
+}
+
 func newURL(s string) *url.URL {
 	u, err := url.Parse(s)
 	if err != nil {
@@ -2,9 +2,11 @@ package gazette
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"time"
 
 	etcd "github.com/coreos/etcd/client"
@@ -16,9 +18,15 @@ import (
 	"github.com/LiveRamp/gazette/journal"
 )
 
-// API for creation of a new Journal. In particular, CreateAPI creates an Etcd
-// item directory for the Journal under Gazette's consensus.Allocator root
-// and responds to the client when the Journal is ready for transactions.
+// API for creation of a new Journal. In particular, CreateAPI validates the
+// Journal name, creates its fragment directory in the (routed) fragment
+// store, creates an Etcd item directory for the Journal under Gazette's
+// consensus.Allocator root, and responds to the client when the Journal is
+// ready for transactions. Brokers serve only Journals so created: appends of
+// other Journals fail with journal.ErrNotFound. See also DeleteAPI.
+//
+// A "replication" query argument optionally sets the number of brokers which
+// serve the Journal (see JournalSpec), in place of the broker default.
 type CreateAPI struct {
 	cfs              cloudstore.FileSystem
 	keysAPI          etcd.KeysAPI
@@ -39,7 +47,21 @@ func (h *CreateAPI) Register(router *mux.Router) {
 }
 
 func (h *CreateAPI) Create(w http.ResponseWriter, r *http.Request) {
-	var name = path.Clean(r.URL.Path[1:])
+	var name = r.URL.Path[1:]
+
+	if err := journal.Name(name).Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var spec JournalSpec
+	if arg := r.URL.Query().Get("replication"); arg != "" {
+		var err error
+		if spec.Replication, err = strconv.Atoi(arg); err != nil || spec.Replication < 1 {
+			http.Error(w, "invalid replication: "+arg, http.StatusBadRequest)
+			return
+		}
+	}
 
 	// Create the fragment directory. Add a trailing slash to unambiguously
 	// represent it as a directory: some cloudstore implementations (eg, GCS)
@@ -65,7 +87,21 @@ func (h *CreateAPI) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.WithFields(log.Fields{"path": itemPath, "name": name}).Info("created journal")
+	// Write the JournalSpec. It follows creation of the item, which fails if
+	// the Journal exists, and until it's observed the allocator briefly applies
+	// the broker default replication.
+	if spec != (JournalSpec{}) {
+		var b, _ = json.Marshal(spec) // Cannot fail.
+
+		if _, err = h.keysAPI.Set(context.Background(),
+			journalSpecPath(journal.Name(name)), string(b), nil); err != nil {
+			http.Error(w, err.Error(), journal.StatusCodeForError(err))
+			return
+		}
+	}
+	var requiredReplicas = spec.replicas(h.requiredReplicas)
+
+	log.WithFields(log.Fields{"path": itemPath, "name": name, "spec": spec}).Info("created journal")
 
 	// Briefly block until we see the required number of ready replicas under
 	// the new item. If we returned immediately, the client will likely race
@@ -96,7 +132,7 @@ func (h *CreateAPI) Create(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		if readyCount > h.requiredReplicas {
+		if readyCount > requiredReplicas {
 			w.WriteHeader(http.StatusCreated)
 			return
 		}
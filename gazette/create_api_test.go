@@ -71,6 +71,52 @@ func (s *CreateAPISuite) TestCreateSuccess(c *gc.C) {
 	}
 }
 
+func (s *CreateAPISuite) TestCreateWithReplication(c *gc.C) {
+	s.keys.On("Set", mock.Anything, ServiceRoot+"/items/journal%2Fname", "",
+		&etcd.SetOptions{
+			Dir:       true,
+			PrevExist: etcd.PrevNoExist}).
+		Return(&etcd.Response{Index: 1234}, nil)
+	s.keys.On("Set", mock.Anything, ServiceRoot+"/journals/journal%2Fname",
+		`{"replication":1}`, (*etcd.SetOptions)(nil)).
+		Return(&etcd.Response{Index: 1235}, nil)
+
+	var watcher consensus.MockWatcher
+
+	s.keys.On("Watcher", ServiceRoot+"/items/journal%2Fname",
+		&etcd.WatcherOptions{
+			AfterIndex: 1234,
+			Recursive:  true}).
+		Return(&watcher)
+
+	// A single ready master suffices, as the Journal requires no replicas.
+	watcher.On("Next", mock.Anything).Return(
+		&etcd.Response{
+			Action: "get",
+			Node:   &etcd.Node{Nodes: etcd.Nodes{{Value: "ready"}}},
+		}, nil)
+
+	req, _ := http.NewRequest("POST", "/journal/name?replication=1", nil)
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+	c.Check(w.Code, gc.Equals, http.StatusCreated)
+	s.keys.AssertExpectations(c)
+}
+
+func (s *CreateAPISuite) TestInvalidReplication(c *gc.C) {
+	for _, arg := range []string{"0", "-1", "two"} {
+		var req, _ = http.NewRequest("POST", "/journal/name?replication="+arg, nil)
+		var w = httptest.NewRecorder()
+
+		s.mux.ServeHTTP(w, req)
+		c.Check(w.Code, gc.Equals, http.StatusBadRequest)
+		c.Check(w.Body.String(), gc.Equals, "invalid replication: "+arg+"\n")
+	}
+	// Expect no Etcd operations were attempted.
+	s.keys.AssertExpectations(c)
+}
+
 func (s *CreateAPISuite) TestEtcdConflict(c *gc.C) {
 	s.keys.On("Set", mock.Anything, ServiceRoot+"/items/journal%2Fname", "",
 		&etcd.SetOptions{
@@ -101,4 +147,17 @@ func (s *CreateAPISuite) TestJournalIsAlreadyCFSFile(c *gc.C) {
 	c.Check(w.Body.String(), gc.Matches, "mkdir .*: not a directory\n")
 }
 
+func (s *CreateAPISuite) TestInvalidJournalName(c *gc.C) {
+	for _, path := range []string{"/journal/name/", "/journal/na%20me", "/journal:name"} {
+		var req, _ = http.NewRequest("POST", path, nil)
+		var w = httptest.NewRecorder()
+
+		s.mux.ServeHTTP(w, req)
+		c.Check(w.Code, gc.Equals, http.StatusBadRequest)
+		c.Check(w.Body.String(), gc.Matches, "invalid journal name .*\n")
+	}
+	// Expect no Etcd operations were attempted.
+	s.keys.AssertExpectations(c)
+}
+
 var _ = gc.Suite(&CreateAPISuite{})
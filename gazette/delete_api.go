@@ -0,0 +1,66 @@
+package gazette
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiveRamp/gazette/consensus"
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// API for deletion of a Journal. DeleteAPI removes the Etcd item directory of
+// the Journal (created by CreateAPI), which releases its replicas: brokers
+// stop serving the Journal, and further requests of it fail with
+// journal.ErrNotFound. Its JournalSpec, if any, is also removed. Persisted
+// Fragments of the Journal are not removed, and a Journal later re-created
+// under the same name resumes from them.
+type DeleteAPI struct {
+	keysAPI etcd.KeysAPI
+}
+
+func NewDeleteAPI(keysAPI etcd.KeysAPI) *DeleteAPI {
+	return &DeleteAPI{keysAPI: keysAPI}
+}
+
+func (h *DeleteAPI) Register(router *mux.Router) {
+	router.NewRoute().Methods("DELETE").HandlerFunc(h.Delete)
+}
+
+func (h *DeleteAPI) Delete(w http.ResponseWriter, r *http.Request) {
+	var name = r.URL.Path[1:]
+
+	if err := journal.Name(name).Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var itemPath = path.Join(ServiceRoot, consensus.ItemsPrefix, url.QueryEscape(name))
+	var _, err = h.keysAPI.Delete(context.Background(), itemPath,
+		&etcd.DeleteOptions{
+			Dir:       true,
+			Recursive: true,
+		})
+	// Map a etcd KeyNotFound error into corresponding journal error.
+	if etcdErr, _ := err.(etcd.Error); etcdErr.Code == etcd.ErrorCodeKeyNotFound {
+		err = journal.ErrNotFound
+	}
+	if err != nil {
+		http.Error(w, err.Error(), journal.StatusCodeForError(err))
+		return
+	}
+
+	_, err = h.keysAPI.Delete(context.Background(), journalSpecPath(journal.Name(name)), nil)
+
+	if etcdErr, _ := err.(etcd.Error); err != nil && etcdErr.Code != etcd.ErrorCodeKeyNotFound {
+		// The item was removed, and the Journal is deleted. Log but don't fail.
+		log.WithFields(log.Fields{"err": err, "name": name}).Warn("failed to delete journal spec")
+	}
+	log.WithFields(log.Fields{"path": itemPath, "name": name}).Info("deleted journal")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+package gazette
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	etcd "github.com/coreos/etcd/client"
+	gc "github.com/go-check/check"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/LiveRamp/gazette/consensus"
+)
+
+type DeleteAPISuite struct {
+	keys *consensus.MockKeysAPI
+	mux  *mux.Router
+}
+
+func (s *DeleteAPISuite) SetUpTest(c *gc.C) {
+	s.keys = new(consensus.MockKeysAPI)
+	s.mux = mux.NewRouter()
+	NewDeleteAPI(s.keys).Register(s.mux)
+}
+
+func (s *DeleteAPISuite) TestDeleteSuccess(c *gc.C) {
+	s.keys.On("Delete", mock.Anything, ServiceRoot+"/items/journal%2Fname",
+		&etcd.DeleteOptions{
+			Dir:       true,
+			Recursive: true}).
+		Return(&etcd.Response{Index: 1234}, nil)
+	// The Journal has no JournalSpec, which is not an error.
+	s.keys.On("Delete", mock.Anything, ServiceRoot+"/journals/journal%2Fname",
+		(*etcd.DeleteOptions)(nil)).
+		Return(nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound})
+
+	req, _ := http.NewRequest("DELETE", "/journal/name", nil)
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+	c.Check(w.Code, gc.Equals, http.StatusNoContent)
+	s.keys.AssertExpectations(c)
+}
+
+func (s *DeleteAPISuite) TestJournalNotFound(c *gc.C) {
+	s.keys.On("Delete", mock.Anything, ServiceRoot+"/items/journal%2Fname",
+		&etcd.DeleteOptions{
+			Dir:       true,
+			Recursive: true}).
+		Return(nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound})
+
+	req, _ := http.NewRequest("DELETE", "/journal/name", nil)
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+	c.Check(w.Code, gc.Equals, http.StatusNotFound)
+	s.keys.AssertExpectations(c)
+}
+
+func (s *DeleteAPISuite) TestInvalidJournalName(c *gc.C) {
+	req, _ := http.NewRequest("DELETE", "/journal/name/", nil)
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+	c.Check(w.Code, gc.Equals, http.StatusBadRequest)
+	s.keys.AssertExpectations(c)
+}
+
+var _ = gc.Suite(&DeleteAPISuite{})
@@ -0,0 +1,42 @@
+package gazette
+
+import (
+	"net/http"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiveRamp/gazette/consensus"
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// API for graceful drain of a broker, as is also initiated by SIGTERM. A DRAIN
+// request of any path cancels the broker's Allocator (see consensus.Cancel):
+// the broker accepts no further journal assignments, and hands off each of
+// its journals as peers become ready to serve them. Once all are handed off,
+// Runner.Run returns, and the broker flushes its spools to the fragment store
+// and exits. Eg: curl -X DRAIN http://broker:8081/
+type DrainAPI struct {
+	alloc consensus.Allocator
+}
+
+func NewDrainAPI(alloc consensus.Allocator) *DrainAPI {
+	return &DrainAPI{alloc: alloc}
+}
+
+func (h *DrainAPI) Register(router *mux.Router) {
+	router.NewRoute().Methods("DRAIN").HandlerFunc(h.Drain)
+}
+
+func (h *DrainAPI) Drain(w http.ResponseWriter, r *http.Request) {
+	var err = consensus.Cancel(h.alloc)
+
+	// A missing member announcement implies a drain is already underway.
+	if etcdErr, _ := err.(etcd.Error); err != nil && etcdErr.Code != etcd.ErrorCodeKeyNotFound {
+		http.Error(w, err.Error(), journal.StatusCodeForError(err))
+		return
+	}
+	log.WithField("instance", h.alloc.InstanceKey()).Info("draining broker")
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,71 @@
+package gazette
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	etcd "github.com/coreos/etcd/client"
+	gc "github.com/go-check/check"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/LiveRamp/gazette/consensus"
+)
+
+type DrainAPISuite struct {
+	keys  *consensus.MockKeysAPI
+	alloc *consensus.MockAllocator
+	mux   *mux.Router
+}
+
+func (s *DrainAPISuite) SetUpTest(c *gc.C) {
+	s.keys = new(consensus.MockKeysAPI)
+	s.alloc = new(consensus.MockAllocator)
+	s.alloc.On("KeysAPI").Return(s.keys)
+	s.alloc.On("PathRoot").Return(ServiceRoot)
+	s.alloc.On("InstanceKey").Return("a-broker")
+
+	s.mux = mux.NewRouter()
+	NewDrainAPI(s.alloc).Register(s.mux)
+}
+
+func (s *DrainAPISuite) TestDrain(c *gc.C) {
+	// Expect the member announcement is removed.
+	s.keys.On("Delete", mock.Anything, ServiceRoot+"/members/a-broker",
+		(*etcd.DeleteOptions)(nil)).
+		Return(&etcd.Response{Index: 1234}, nil).Once()
+
+	req, _ := http.NewRequest("DRAIN", "/", nil)
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+	c.Check(w.Code, gc.Equals, http.StatusAccepted)
+
+	// A repeated drain is not an error.
+	s.keys.On("Delete", mock.Anything, ServiceRoot+"/members/a-broker",
+		(*etcd.DeleteOptions)(nil)).
+		Return(nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}).Once()
+
+	w = httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	c.Check(w.Code, gc.Equals, http.StatusAccepted)
+
+	s.keys.AssertExpectations(c)
+}
+
+func (s *DrainAPISuite) TestEtcdError(c *gc.C) {
+	s.keys.On("Delete", mock.Anything, ServiceRoot+"/members/a-broker",
+		(*etcd.DeleteOptions)(nil)).
+		Return(nil, errors.New("etcd unavailable"))
+
+	req, _ := http.NewRequest("DRAIN", "/", nil)
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+	c.Check(w.Code, gc.Equals, http.StatusInternalServerError)
+	c.Check(w.Body.String(), gc.Equals, "etcd unavailable\n")
+	s.keys.AssertExpectations(c)
+}
+
+var _ = gc.Suite(&DrainAPISuite{})
@@ -0,0 +1,122 @@
+package gazette
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/schema"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiveRamp/gazette/cloudstore"
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// Duration for which Fragment URLs of a FragmentsAPI listing are valid.
+const fragmentListingURLTTL = time.Hour
+
+// API for listing the persisted Fragments of a Journal. FragmentsAPI serves
+// GET requests having a "fragments" query argument (eg, "GET /a/journal?fragments"),
+// and responds with a JSON FragmentListing drawn from a single listing of the
+// Journal's fragment directory. Any broker may serve the request: it's not
+// routed to a Journal replica. "begin" and "end" query arguments optionally
+// restrict the listing to Fragments overlapping offsets [begin, end). An
+// "end" of -1 (the default) is unbounded.
+//
+// Batch jobs use the listing to read Fragments directly from the backing
+// store, rather than reading (or issuing a HEAD for each Fragment) through
+// brokers. See Client.ListFragments.
+type FragmentsAPI struct {
+	cfs     cloudstore.FileSystem
+	decoder *schema.Decoder
+}
+
+// FragmentListing is the response of a FragmentsAPI request.
+type FragmentListing struct {
+	// Listed Fragments, ordered on offset. Fragments fully covered by other
+	// listed Fragments are omitted.
+	Fragments []ListedFragment `json:"fragments"`
+}
+
+// ListedFragment describes a persisted Fragment of a FragmentListing.
+type ListedFragment struct {
+	// Content name of the Fragment, encoding its offset range, SHA1 sum, and
+	// compression codec (see journal.Fragment.ContentName).
+	ContentName string `json:"contentName"`
+	// Modification time of the Fragment in its backing store.
+	ModTime time.Time `json:"modTime"`
+	// Signed or authorized URL of the Fragment in its backing store.
+	URL string `json:"url"`
+}
+
+func NewFragmentsAPI(cfs cloudstore.FileSystem) *FragmentsAPI {
+	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(false)
+	decoder.SetAliasTag("json")
+
+	return &FragmentsAPI{cfs: cfs, decoder: decoder}
+}
+
+// Register registers the FragmentsAPI with |router|. It must be registered
+// before the ReadAPI, which otherwise serves all GET requests.
+func (h *FragmentsAPI) Register(router *mux.Router) {
+	router.NewRoute().Methods("GET").MatcherFunc(
+		func(r *http.Request, _ *mux.RouteMatch) bool {
+			var _, ok = r.URL.Query()["fragments"]
+			return ok
+		}).HandlerFunc(h.List)
+}
+
+func (h *FragmentsAPI) List(w http.ResponseWriter, r *http.Request) {
+	var schema = struct {
+		Fragments string
+		Begin     int64
+		End       int64
+	}{End: -1}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err = h.decoder.Decode(&schema, r.Form); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var name = journal.Name(r.URL.Path[1:])
+	if err := name.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var set, err = journal.LoadFragmentSet(name, h.cfs)
+	observeServerRequest("fragments", err)
+
+	if err != nil {
+		log.WithFields(log.Fields{"err": err, "journal": name}).Warn("failed to list fragments")
+		http.Error(w, err.Error(), journal.StatusCodeForError(err))
+		return
+	}
+
+	var listing = FragmentListing{Fragments: []ListedFragment{}}
+	for _, fragment := range set {
+		if fragment.End <= schema.Begin || (schema.End != -1 && fragment.Begin >= schema.End) {
+			continue
+		}
+		var url, err = fragment.AsDirectURL(h.cfs, fragmentListingURLTTL)
+		if err != nil {
+			http.Error(w, err.Error(), journal.StatusCodeForError(err))
+			return
+		}
+		listing.Fragments = append(listing.Fragments, ListedFragment{
+			ContentName: fragment.ContentName(),
+			ModTime:     fragment.RemoteModTime,
+			URL:         url.String(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(listing); err != nil {
+		log.WithFields(log.Fields{"err": err, "journal": name}).Warn("failed to write listing")
+	}
+}
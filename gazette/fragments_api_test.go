@@ -0,0 +1,101 @@
+package gazette
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	gc "github.com/go-check/check"
+	"github.com/gorilla/mux"
+
+	"github.com/LiveRamp/gazette/cloudstore"
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type FragmentsAPISuite struct {
+	cfs cloudstore.FileSystem
+	mux *mux.Router
+}
+
+func (s *FragmentsAPISuite) SetUpTest(c *gc.C) {
+	s.cfs = cloudstore.NewTmpFileSystem()
+	s.mux = mux.NewRouter()
+	NewFragmentsAPI(s.cfs).Register(s.mux)
+
+	for _, f := range []journal.Fragment{
+		{Journal: "a/journal", Begin: 0, End: 1000},
+		{Journal: "a/journal", Begin: 1000, End: 2000},
+		{Journal: "a/journal", Begin: 1200, End: 1800}, // Covered by [1000, 2000).
+		{Journal: "a/journal", Begin: 2000, End: 3000, Codec: journal.CompressionGzip},
+		{Journal: "another/journal", Begin: 0, End: 1000},
+	} {
+		c.Assert(s.cfs.MkdirAll(f.Journal.String(), 0750), gc.IsNil)
+
+		var file, err = s.cfs.OpenFile(f.ContentPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+		c.Assert(err, gc.IsNil)
+		_, err = file.Write([]byte("content"))
+		c.Assert(err, gc.IsNil)
+		c.Assert(file.Close(), gc.IsNil)
+	}
+}
+
+func (s *FragmentsAPISuite) TearDownTest(c *gc.C) {
+	c.Check(s.cfs.Close(), gc.IsNil)
+}
+
+func (s *FragmentsAPISuite) TestListing(c *gc.C) {
+	var names = func(query string) []string {
+		var req, _ = http.NewRequest("GET", "/a/journal?"+query, nil)
+		var w = httptest.NewRecorder()
+		s.mux.ServeHTTP(w, req)
+		c.Assert(w.Code, gc.Equals, http.StatusOK)
+
+		var listing FragmentListing
+		c.Assert(json.NewDecoder(w.Body).Decode(&listing), gc.IsNil)
+
+		var out = []string{}
+		for _, f := range listing.Fragments {
+			c.Check(strings.HasPrefix(f.URL, "file://"), gc.Equals, true)
+			c.Check(f.ModTime.IsZero(), gc.Equals, false)
+			out = append(out, f.ContentName)
+		}
+		return out
+	}
+	var name = func(begin, end int64, codec journal.CompressionCodec) string {
+		return journal.Fragment{Begin: begin, End: end, Codec: codec}.ContentName()
+	}
+
+	c.Check(names("fragments"), gc.DeepEquals, []string{
+		name(0, 1000, journal.CompressionNone),
+		name(1000, 2000, journal.CompressionNone),
+		name(2000, 3000, journal.CompressionGzip),
+	})
+	c.Check(names("fragments=true&begin=1000&end=2000"), gc.DeepEquals, []string{
+		name(1000, 2000, journal.CompressionNone),
+	})
+	c.Check(names("fragments=true&begin=999"), gc.DeepEquals, []string{
+		name(0, 1000, journal.CompressionNone),
+		name(1000, 2000, journal.CompressionNone),
+		name(2000, 3000, journal.CompressionGzip),
+	})
+	c.Check(names("fragments=true&begin=3000"), gc.DeepEquals, []string{})
+}
+
+func (s *FragmentsAPISuite) TestErrorCases(c *gc.C) {
+	var serve = func(method, target string) int {
+		var req, _ = http.NewRequest(method, target, nil)
+		var w = httptest.NewRecorder()
+		s.mux.ServeHTTP(w, req)
+		return w.Code
+	}
+	// Unknown query arguments, and invalid journal names, are rejected.
+	c.Check(serve("GET", "/a/journal?fragments&other=1"), gc.Equals, http.StatusBadRequest)
+	c.Check(serve("GET", "/a/journal/?fragments"), gc.Equals, http.StatusBadRequest)
+	// GET requests without a "fragments" argument are not matched (and are
+	// served by the ReadAPI).
+	c.Check(serve("GET", "/a/journal?offset=0"), gc.Equals, http.StatusNotFound)
+}
+
+var _ = gc.Suite(&FragmentsAPISuite{})
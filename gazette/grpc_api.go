@@ -0,0 +1,405 @@
+package gazette
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/LiveRamp/gazette/cloudstore"
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/metrics"
+)
+
+const (
+	// Size of content chunks sent by BrokerAPI Read RPCs.
+	grpcReadChunkSize = 1 << 15
+	// Maximum number of appends of a StreamAppend RPC which may be in-flight
+	// (dispatched, but not yet acknowledged).
+	grpcMaxPipelinedAppends = 1024
+)
+
+// BrokerAPI serves the Broker gRPC service (see broker.proto), which is an
+// alternative to the HTTP API of ReadAPI, WriteAPI, and ReplicateAPI having
+// equivalent semantics. Journal protocol errors are returned as a response
+// Status, rather than an HTTP status code.
+type BrokerAPI struct {
+	handler interface {
+		AppendOpHandler
+		ReadOpHandler
+		ReplicateOpHandler
+	}
+	cfs  cloudstore.FileSystem
+	auth Authorizer
+}
+
+func NewBrokerAPI(router *Router, cfs cloudstore.FileSystem) *BrokerAPI {
+	return &BrokerAPI{handler: router, cfs: cfs}
+}
+
+// SetAuthorizer authorizes RPCs of the BrokerAPI with |auth|. RPCs present
+// their bearer token as "authorization" metadata (eg, "Bearer <token>").
+// Unauthorized RPCs fail with the Status of the Authorize error. By default,
+// all RPCs are permitted. SetAuthorizer must be called before the BrokerAPI
+// is registered.
+func (h *BrokerAPI) SetAuthorizer(auth Authorizer) {
+	h.auth = auth
+}
+
+// Register registers the BrokerAPI with |server|.
+func (h *BrokerAPI) Register(server *grpc.Server) {
+	RegisterBrokerServer(server, h)
+}
+
+// Read implements BrokerServer. As with ReadAPI, content of a local Fragment
+// is streamed from the broker. If the first Fragment read is persisted, its
+// content is streamed as well, but the client is expected to instead read it
+// from the returned ReadResponse.FragmentLocation. Other persisted Fragments
+// end the RPC, and the client must re-issue its request.
+func (h *BrokerAPI) Read(req *ReadRequest, stream Broker_ReadServer) error {
+	var op = journal.ReadOp{
+		ReadArgs: journal.ReadArgs{
+			Journal: req.Journal,
+			Offset:  req.Offset,
+		},
+		Result: make(chan journal.ReadResult, 1),
+	}
+	var result journal.ReadResult
+
+	if result.Error = h.authorize(stream.Context(), req.Journal, VerbRead); result.Error == nil {
+		// Perform an initial non-blocking read to test for request legality.
+		h.handler.Read(op)
+		result = <-op.Result
+	}
+	observeServerRequest("read", result.Error)
+
+	var resp = &ReadResponse{
+		Offset:     result.Offset,
+		WriteHead:  result.WriteHead,
+		RouteToken: result.RouteToken,
+	}
+	if result.Error != nil {
+		resp.Status, resp.Error = statusForError(result.Error)
+
+		// Fail now if we encountered an error other than ErrNotYetAvailable,
+		// or we saw ErrNotYetAvailable for a non-blocking read.
+		if result.Error != journal.ErrNotYetAvailable || !(req.Block || req.BlockMs != 0) {
+			return stream.Send(resp)
+		}
+		resp.Status, resp.Error = Status_OK, ""
+	} else {
+		resp.FragmentName = result.Fragment.ContentName()
+
+		if !result.Fragment.IsLocal() {
+			if url, err := result.Fragment.AsDirectURL(h.cfs, time.Minute); err == nil {
+				resp.FragmentLocation = url.String()
+			} else {
+				log.WithFields(log.Fields{"err": err, "fragment": result.Fragment}).
+					Warn("failed to generate remote URL")
+			}
+		}
+	}
+	if err := stream.Send(resp); err != nil {
+		return err
+	}
+
+	// Switch to the requested blocking mode.
+	op.Blocking = req.Block || req.BlockMs != 0
+	if req.BlockMs != 0 {
+		op.Deadline = time.Now().Add(time.Duration(req.BlockMs) * time.Millisecond)
+	}
+	if result.Error == journal.ErrNotYetAvailable {
+		// Retry, actually blocking this time.
+		op.Offset = result.Offset
+		h.handler.Read(op)
+		result = <-op.Result
+	}
+
+	var buf = make([]byte, grpcReadChunkSize)
+
+	for iter := 0; ; iter++ {
+		if result.Error != nil {
+			return nil // Read has completed. Status is conveyed by stream end.
+		} else if !result.Fragment.IsLocal() && iter != 0 {
+			return nil // Client must re-issue the request. See ReadAPI.Read.
+		}
+
+		var reader, err = result.Fragment.ReaderFromOffset(result.Offset, h.cfs)
+		if err != nil {
+			log.WithFields(log.Fields{"err": err, "ReadOp": op, "ReadIter": iter}).
+				Warn("failed to get a fragment reader")
+			return err
+		}
+		var offset = result.Offset
+
+		for {
+			var n, err = reader.Read(buf)
+			if n != 0 {
+				if err := stream.Send(&ReadResponse{
+					Offset:    offset,
+					WriteHead: result.WriteHead,
+					Content:   buf[:n],
+				}); err != nil {
+					return err
+				}
+				offset += int64(n)
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+
+		// Next incremental read.
+		op.Offset = offset
+		h.handler.Read(op)
+		result = <-op.Result
+	}
+}
+
+// Append implements BrokerServer.
+func (h *BrokerAPI) Append(stream Broker_AppendServer) error {
+	var started = time.Now()
+
+	var req, err = stream.Recv()
+	if err != nil {
+		return err
+	}
+	var op = journal.AppendOp{
+		AppendArgs: journal.AppendArgs{
+			Journal: req.Journal,
+			Content: &appendStreamReader{stream: stream, next: req.Content},
+		},
+		Result: make(chan journal.AppendResult, 1),
+	}
+	var result journal.AppendResult
+
+	if result.Error = h.authorize(stream.Context(), req.Journal, VerbAppend); result.Error == nil {
+		h.handler.Append(op)
+		result = <-op.Result
+	}
+
+	observeServerRequest("append", result.Error)
+	metrics.GazetteServerAppendDurationSeconds.Observe(time.Since(started).Seconds())
+
+	var resp = &AppendResponse{
+		WriteHead:  result.WriteHead,
+		RouteToken: result.RouteToken,
+	}
+	resp.Status, resp.Error = statusForError(result.Error)
+
+	return stream.SendAndClose(resp)
+}
+
+// StreamAppend implements BrokerServer. Each request is dispatched as an
+// AppendOp upon its receipt, without awaiting the completion of prior appends,
+// and responses are sent as appends complete, in request order. As a broker
+// applies AppendOps of a journal in the order they're dispatched, requests of
+// a journal are also appended in request order.
+func (h *BrokerAPI) StreamAppend(stream Broker_StreamAppendServer) error {
+	var pending = make(chan chan journal.AppendResult, grpcMaxPipelinedAppends)
+	var sendErrCh = make(chan error, 1)
+
+	go func() {
+		var err error
+		for resultCh := range pending {
+			var result = <-resultCh
+
+			observeServerRequest("append", result.Error)
+
+			if err != nil {
+				continue // Stream is broken. Drain remaining results.
+			}
+			var resp = &StreamAppendResponse{
+				WriteHead:  result.WriteHead,
+				RouteToken: result.RouteToken,
+			}
+			resp.Status, resp.Error = statusForError(result.Error)
+			err = stream.Send(resp)
+		}
+		sendErrCh <- err
+	}()
+
+	var err error
+	for {
+		var req *StreamAppendRequest
+		if req, err = stream.Recv(); err != nil {
+			break
+		}
+		var op = journal.AppendOp{
+			AppendArgs: journal.AppendArgs{
+				Journal: req.Journal,
+				Content: bytes.NewReader(req.Content),
+			},
+			Result: make(chan journal.AppendResult, 1),
+		}
+		if err := h.authorize(stream.Context(), req.Journal, VerbAppend); err != nil {
+			op.Result <- journal.AppendResult{Error: err}
+		} else {
+			h.handler.Append(op)
+		}
+		pending <- op.Result // Blocks if |grpcMaxPipelinedAppends| are in-flight.
+	}
+	close(pending)
+
+	var sendErr = <-sendErrCh
+	if err == io.EOF {
+		err = sendErr // Client closed its stream. All responses have been sent.
+	}
+	return err
+}
+
+// Replicate implements BrokerServer.
+func (h *BrokerAPI) Replicate(stream Broker_ReplicateServer) error {
+	var req, err = stream.Recv()
+	if err != nil {
+		return err
+	}
+	var op = journal.ReplicateOp{
+		ReplicateArgs: journal.ReplicateArgs{
+			Journal:    req.Journal,
+			RouteToken: req.RouteToken,
+			WriteHead:  req.WriteHead,
+			NewSpool:   req.NewSpool,
+		},
+		Result: make(chan journal.ReplicateResult, 1),
+	}
+	var result journal.ReplicateResult
+
+	if result.Error = h.authorize(stream.Context(), req.Journal, VerbReplicate); result.Error == nil {
+		h.handler.Replicate(op)
+		result = <-op.Result
+	}
+
+	observeServerRequest("replicate", result.Error)
+
+	if result.Error != nil {
+		var resp = &ReplicateResponse{ErrorWriteHead: result.ErrorWriteHead}
+		resp.Status, resp.Error = statusForError(result.Error)
+		return stream.SendAndClose(resp)
+	}
+
+	// Write transaction content to the replica, through the final request.
+	for ; err == nil; req, err = stream.Recv() {
+		if _, err = result.Writer.Write(req.Content); err != nil {
+			break
+		} else if req.Commit {
+			if err = result.Writer.Commit(req.CommitDelta); err != nil {
+				break
+			}
+			return stream.SendAndClose(&ReplicateResponse{Status: Status_OK})
+		}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF // Stream ended without a commit.
+	}
+	result.Writer.Commit(0) // Abort.
+
+	log.WithField("err", err).Warn("failed to commit transaction")
+	metrics.FailedCommitsTotal.Inc()
+	return err
+}
+
+// authorize authorizes |verb| of journal |name| by an RPC of |ctx|.
+func (h *BrokerAPI) authorize(ctx context.Context, name journal.Name, verb Verb) error {
+	if h.auth == nil {
+		return nil
+	}
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md["authorization"]; len(v) != 0 {
+			token = bearerToken(v[0])
+		}
+	}
+	return h.auth.Authorize(token, name, verb)
+}
+
+// appendStreamReader is an io.Reader of AppendRequest content of a stream.
+type appendStreamReader struct {
+	stream Broker_AppendServer
+	// Content of the last request which remains to be read.
+	next []byte
+}
+
+func (r *appendStreamReader) Read(p []byte) (int, error) {
+	for len(r.next) == 0 {
+		// Errors (including io.EOF, upon the client closing its stream)
+		// are passed through.
+		var req, err = r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.next = req.Content
+	}
+	var n = copy(p, r.next)
+	r.next = r.next[n:]
+	return n, nil
+}
+
+// statusForError maps |err| to its Status, and a description of the error
+// if it's not a Journal protocol error.
+func statusForError(err error) (Status, string) {
+	switch err {
+	case nil:
+		return Status_OK, ""
+	case journal.ErrBrokerUnavailable:
+		return Status_BROKER_UNAVAILABLE, ""
+	case journal.ErrExists:
+		return Status_EXISTS, ""
+	case journal.ErrNotBroker:
+		return Status_NOT_BROKER, ""
+	case journal.ErrNotFound:
+		return Status_NOT_FOUND, ""
+	case journal.ErrNotReplica:
+		return Status_NOT_REPLICA, ""
+	case journal.ErrNotYetAvailable:
+		return Status_NOT_YET_AVAILABLE, ""
+	case journal.ErrReplicationFailed:
+		return Status_REPLICATION_FAILED, ""
+	case journal.ErrUnauthorized:
+		return Status_UNAUTHORIZED, ""
+	case journal.ErrWrongRouteToken:
+		return Status_WRONG_ROUTE_TOKEN, ""
+	case journal.ErrWrongWriteHead:
+		return Status_WRONG_WRITE_HEAD, ""
+	default:
+		return Status_INTERNAL_ERROR, err.Error()
+	}
+}
+
+// errorForStatus maps |status| to its Journal protocol error. An
+// INTERNAL_ERROR status is mapped to an error having description |desc|.
+func errorForStatus(status Status, desc string) error {
+	switch status {
+	case Status_OK:
+		return nil
+	case Status_BROKER_UNAVAILABLE:
+		return journal.ErrBrokerUnavailable
+	case Status_EXISTS:
+		return journal.ErrExists
+	case Status_NOT_BROKER:
+		return journal.ErrNotBroker
+	case Status_NOT_FOUND:
+		return journal.ErrNotFound
+	case Status_NOT_REPLICA:
+		return journal.ErrNotReplica
+	case Status_NOT_YET_AVAILABLE:
+		return journal.ErrNotYetAvailable
+	case Status_REPLICATION_FAILED:
+		return journal.ErrReplicationFailed
+	case Status_UNAUTHORIZED:
+		return journal.ErrUnauthorized
+	case Status_WRONG_ROUTE_TOKEN:
+		return journal.ErrWrongRouteToken
+	case Status_WRONG_WRITE_HEAD:
+		return journal.ErrWrongWriteHead
+	default:
+		return errors.New(desc)
+	}
+}
@@ -0,0 +1,176 @@
+package gazette
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+
+	gc "github.com/go-check/check"
+	"google.golang.org/grpc"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type BrokerAPISuite struct {
+	appendCallback    func(journal.AppendOp)
+	replicateCallback func(journal.ReplicateOp)
+}
+
+func (s *BrokerAPISuite) TestAppendStreamsContent(c *gc.C) {
+	var api = &BrokerAPI{handler: s}
+
+	s.appendCallback = func(op journal.AppendOp) {
+		c.Check(op.Journal, gc.Equals, journal.Name("a/journal"))
+
+		var content, err = ioutil.ReadAll(op.Content)
+		c.Check(err, gc.IsNil)
+		c.Check(string(content), gc.Equals, "hello, world!")
+
+		op.Result <- journal.AppendResult{WriteHead: 1234}
+	}
+	var stream = &appendStreamFixture{reqs: []*AppendRequest{
+		{Journal: "a/journal", Content: []byte("hello")},
+		{Content: []byte(", ")},
+		{},
+		{Content: []byte("world!")},
+	}}
+	c.Check(api.Append(stream), gc.IsNil)
+	c.Check(stream.resp, gc.DeepEquals, &AppendResponse{Status: Status_OK, WriteHead: 1234})
+
+	// Journal protocol errors are returned as a Status.
+	s.appendCallback = func(op journal.AppendOp) {
+		op.Result <- journal.AppendResult{Error: journal.ErrNotBroker, RouteToken: "http://broker"}
+	}
+	stream = &appendStreamFixture{reqs: []*AppendRequest{{Journal: "a/journal"}}}
+	c.Check(api.Append(stream), gc.IsNil)
+	c.Check(stream.resp, gc.DeepEquals, &AppendResponse{
+		Status:     Status_NOT_BROKER,
+		RouteToken: "http://broker",
+	})
+}
+
+func (s *BrokerAPISuite) TestReplicateCommitsOrAborts(c *gc.C) {
+	var api = &BrokerAPI{handler: s}
+	var writer = &writeCommitterFixture{}
+
+	s.replicateCallback = func(op journal.ReplicateOp) {
+		c.Check(op.ReplicateArgs, gc.DeepEquals, journal.ReplicateArgs{
+			Journal:    "a/journal",
+			WriteHead:  100,
+			RouteToken: "http://broker|http://replica",
+			NewSpool:   true,
+		})
+		op.Result <- journal.ReplicateResult{Writer: writer}
+	}
+	var stream = &replicateStreamFixture{reqs: []*ReplicateRequest{
+		{
+			Journal:    "a/journal",
+			WriteHead:  100,
+			RouteToken: "http://broker|http://replica",
+			NewSpool:   true,
+		},
+		{Content: []byte("transaction")},
+		{Content: []byte(" content"), Commit: true, CommitDelta: 19},
+	}}
+	c.Check(api.Replicate(stream), gc.IsNil)
+	c.Check(stream.resp, gc.DeepEquals, &ReplicateResponse{Status: Status_OK})
+	c.Check(writer.content, gc.Equals, "transaction content")
+	c.Check(writer.commits, gc.DeepEquals, []int64{19})
+
+	// A stream which ends without a commit is aborted.
+	writer = &writeCommitterFixture{}
+	s.replicateCallback = func(op journal.ReplicateOp) {
+		op.Result <- journal.ReplicateResult{Writer: writer}
+	}
+	stream = &replicateStreamFixture{reqs: []*ReplicateRequest{
+		{Journal: "a/journal", Content: []byte("partial")},
+	}}
+	c.Check(api.Replicate(stream), gc.Equals, io.ErrUnexpectedEOF)
+	c.Check(writer.commits, gc.DeepEquals, []int64{0})
+
+	// Protocol errors of the replica are returned as a Status.
+	s.replicateCallback = func(op journal.ReplicateOp) {
+		op.Result <- journal.ReplicateResult{Error: journal.ErrWrongWriteHead, ErrorWriteHead: 200}
+	}
+	stream = &replicateStreamFixture{reqs: []*ReplicateRequest{{Journal: "a/journal"}}}
+	c.Check(api.Replicate(stream), gc.IsNil)
+	c.Check(stream.resp, gc.DeepEquals, &ReplicateResponse{
+		Status:         Status_WRONG_WRITE_HEAD,
+		ErrorWriteHead: 200,
+	})
+}
+
+func (s *BrokerAPISuite) TestStatusForError(c *gc.C) {
+	var status, desc = statusForError(nil)
+	c.Check(status, gc.Equals, Status_OK)
+	c.Check(desc, gc.Equals, "")
+
+	status, desc = statusForError(journal.ErrNotYetAvailable)
+	c.Check(status, gc.Equals, Status_NOT_YET_AVAILABLE)
+	c.Check(desc, gc.Equals, "")
+
+	status, desc = statusForError(errors.New("whoops"))
+	c.Check(status, gc.Equals, Status_INTERNAL_ERROR)
+	c.Check(desc, gc.Equals, "whoops")
+}
+
+func (s *BrokerAPISuite) Append(op journal.AppendOp)       { s.appendCallback(op) }
+func (s *BrokerAPISuite) Read(op journal.ReadOp)           { panic("not expected") }
+func (s *BrokerAPISuite) Replicate(op journal.ReplicateOp) { s.replicateCallback(op) }
+
+type appendStreamFixture struct {
+	grpc.ServerStream
+	reqs []*AppendRequest
+	resp *AppendResponse
+}
+
+func (s *appendStreamFixture) Recv() (*AppendRequest, error) {
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+	var req = s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *appendStreamFixture) SendAndClose(resp *AppendResponse) error {
+	s.resp = resp
+	return nil
+}
+
+type replicateStreamFixture struct {
+	grpc.ServerStream
+	reqs []*ReplicateRequest
+	resp *ReplicateResponse
+}
+
+func (s *replicateStreamFixture) Recv() (*ReplicateRequest, error) {
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+	var req = s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *replicateStreamFixture) SendAndClose(resp *ReplicateResponse) error {
+	s.resp = resp
+	return nil
+}
+
+type writeCommitterFixture struct {
+	content string
+	commits []int64
+}
+
+func (w *writeCommitterFixture) Write(p []byte) (int, error) {
+	w.content += string(p)
+	return len(p), nil
+}
+
+func (w *writeCommitterFixture) Commit(count int64) error {
+	w.commits = append(w.commits, count)
+	return nil
+}
+
+var _ = gc.Suite(&BrokerAPISuite{})
@@ -22,6 +22,7 @@ type JournalReplica interface {
 	ReadOpHandler
 	ReplicateOpHandler
 	Shutdown()
+	WaitForShutdown()
 	StartBrokeringWithPeers(journal.RouteToken, []journal.Replicator)
 	StartReplicating(journal.RouteToken)
 }
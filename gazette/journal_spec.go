@@ -0,0 +1,33 @@
+package gazette
+
+import (
+	"path"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// Etcd directory, under ServiceRoot, of JournalSpecs.
+const JournalsPrefix = "journals"
+
+// JournalSpec is optional metadata of a Journal. It's stored in Etcd as JSON,
+// under JournalsPrefix at the escaped Journal name. A JournalSpec is written
+// by CreateAPI (if the request specifies one), and removed by DeleteAPI.
+type JournalSpec struct {
+	// Number of brokers which serve the Journal, including its master (eg, 1
+	// for scratch journals, or 3 for recovery logs). If zero, the broker
+	// default applies: one master, plus its required number of replicas.
+	Replication int `json:"replication,omitempty"`
+}
+
+// replicas returns the number of required replicas of the JournalSpec, which
+// is |defaultReplicas| if Replication is unset.
+func (s JournalSpec) replicas(defaultReplicas int) int {
+	if s.Replication == 0 {
+		return defaultReplicas
+	}
+	return s.Replication - 1
+}
+
+func journalSpecPath(name journal.Name) string {
+	return path.Join(ServiceRoot, JournalsPrefix, journalToItem(name))
+}
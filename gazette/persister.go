@@ -35,6 +35,7 @@ type Persister struct {
 
 	queue        map[string]journal.Fragment
 	shuttingDown uint32
+	stopCh       chan struct{}
 	loopExited   chan struct{}
 	mu           sync.Mutex
 
@@ -52,6 +53,7 @@ func NewPersister(directory string, cfs cloudstore.FileSystem,
 		osRemove:         os.Remove,
 		persisterLockTTL: kPersisterLockTTL,
 		queue:            make(map[string]journal.Fragment),
+		stopCh:           make(chan struct{}),
 		loopExited:       make(chan struct{}),
 		routeKey:         routeKey,
 	}
@@ -86,16 +88,26 @@ func (p *Persister) IsShuttingDown() bool {
 	return atomic.LoadUint32(&p.shuttingDown) == 1
 }
 
+// Stop begins an immediate convergence of queued Fragments, and blocks until
+// all have been persisted. Convergence is retried on failure.
 func (p *Persister) Stop() {
 	atomic.StoreUint32(&p.shuttingDown, 1)
+	close(p.stopCh)
 	<-p.loopExited
 }
 
 func (p *Persister) StartPersisting() *Persister {
 	go func() {
 		interval := time.Tick(kPersisterConvergeInterval)
+		stopCh := p.stopCh
+
 		for {
-			<-interval
+			select {
+			case <-interval:
+			case <-stopCh:
+				// Converge immediately on Stop, and thereafter on |interval|.
+				stopCh = nil
+			}
 
 			// Attempt to converge all items in the queue.
 			p.converge()
@@ -205,6 +217,11 @@ func (p *Persister) convergeOne(fragment journal.Fragment) bool {
 }
 
 func transferFragmentToGCS(cfs cloudstore.FileSystem, fragment journal.Fragment) bool {
+	// Fragments are persisted with the CompressionCodec of their FragmentStore.
+	if store, ok := cfs.(journal.FragmentStore); ok {
+		fragment.Codec = store.CodecFor(fragment.Journal)
+	}
+
 	// Create the journal's fragment directory, if not already present.
 	if err := cfs.MkdirAll(fragment.Journal.String(), 0750); err != nil {
 		log.WithFields(log.Fields{"err": err, "path": fragment.Journal}).
@@ -223,7 +240,13 @@ func transferFragmentToGCS(cfs cloudstore.FileSystem, fragment journal.Fragment)
 			Warn("failed to open fragment for writing")
 		return false
 	}
-	var r = io.NewSectionReader(fragment.File, 0, fragment.End-fragment.Begin)
+	var r io.Reader = io.NewSectionReader(fragment.File, 0, fragment.End-fragment.Begin)
+
+	if fragment.Codec != journal.CompressionNone {
+		var pr = compressFragment(r, fragment.Codec)
+		defer pr.Close() // Unblocks the compressor, if CopyAtomic fails early.
+		r = pr
+	}
 
 	if _, err := cfs.CopyAtomic(w, r); err != nil {
 		log.WithFields(log.Fields{"err": err, "path": fragment.ContentPath()}).
@@ -234,6 +257,24 @@ func transferFragmentToGCS(cfs cloudstore.FileSystem, fragment journal.Fragment)
 	}
 }
 
+// compressFragment returns a Reader of |r| compressed with |codec|.
+func compressFragment(r io.Reader, codec journal.CompressionCodec) *io.PipeReader {
+	var pr, pw = io.Pipe()
+
+	go func() {
+		var w, err = codec.NewCompressor(pw)
+		if err == nil {
+			_, err = io.Copy(w, r)
+
+			if cErr := w.Close(); err == nil {
+				err = cErr
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
 func (p *Persister) removeLocal(fragment journal.Fragment) {
 	localPath := filepath.Join(p.directory, fragment.ContentPath())
 
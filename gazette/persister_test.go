@@ -167,6 +167,37 @@ func (s *PersisterSuite) TestTargetFileAlreadyExists(c *gc.C) {
 	c.Check(s.persister.osRemove, gc.IsNil)
 }
 
+func (s *PersisterSuite) TestCompressedTransfer(c *gc.C) {
+	var dir, err = ioutil.TempDir("", "persister-suite")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(dir)
+
+	store, err := journal.NewFragmentStore(nil, "file://"+dir+"?codec=gzip", nil)
+	c.Assert(err, gc.IsNil)
+	defer store.Close()
+
+	var contentFixture = []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	s.file.On("ReadAt", mock.AnythingOfType("[]uint8"), int64(0)).
+		Return(10, nil).
+		Run(func(args mock.Arguments) {
+			copy(args.Get(0).([]byte), contentFixture)
+		}).Once()
+
+	c.Check(transferFragmentToGCS(store, s.fragment), gc.Equals, true)
+	s.file.AssertExpectations(c)
+
+	// Expect the fragment was persisted with a codec extension, and its
+	// content is compressed.
+	var persisted = s.fragment
+	persisted.Codec = journal.CompressionGzip
+
+	r, err := persisted.ReaderFromOffset(1003, store)
+	c.Assert(err, gc.IsNil)
+	content, _ := ioutil.ReadAll(r)
+	c.Check(content, gc.DeepEquals, contentFixture[3:])
+	c.Check(r.Close(), gc.IsNil)
+}
+
 func (s *PersisterSuite) TestEmptyFragment(c *gc.C) {
 	emptyFragment := journal.Fragment{
 		Journal: "a/journal",
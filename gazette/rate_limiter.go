@@ -0,0 +1,131 @@
+package gazette
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned for requests of a Client having an ErrorOnFull
+// rate limit policy, if its rate limit has been reached.
+var ErrRateLimited = errors.New("rate limited")
+
+// rateLimiter is a token bucket which admits requests at a sustained |rate|
+// per second, with bursts of up to |burst| requests.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	// Available tokens as of |last|. May be negative, if tokens have been
+	// reserved ahead of their availability.
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+func newRateLimiter(rate float64, burst int, now time.Time) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// take takes a token at |now|, returning whether one was available.
+func (l *rateLimiter) take(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.refill(now); l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// reserve takes a token at |now|, returning the delay after which the token
+// is available. A reservation which isn't used must be returned via cancel.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(now)
+	l.tokens--
+
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel returns a reserved token.
+func (l *rateLimiter) cancel() {
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+// refill adds tokens accrued through |now|. |mu| must be held.
+func (l *rateLimiter) refill(now time.Time) {
+	if now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		l.last = now
+	}
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// SetRateLimits bounds the rate of requests issued by the Client (including
+// those of a WriteService or reader using the Client). Reads (GET and HEAD
+// requests) are limited to |reads| per second, and other requests to |writes|
+// per second, each with bursts of up to |burst| requests. A zero rate is
+// unlimited. Under the BlockOnFull policy, requests wait until the rate limit
+// allows them (or until the request context is cancelled). Under ErrorOnFull,
+// requests instead fail immediately with ErrRateLimited. SetRateLimits must be
+// called before the Client is used.
+func (c *Client) SetRateLimits(reads, writes float64, burst int, policy OverflowPolicy) {
+	c.readLimiter, c.writeLimiter = nil, nil
+
+	if reads != 0 {
+		c.readLimiter = newRateLimiter(reads, burst, c.timeNow())
+	}
+	if writes != 0 {
+		c.writeLimiter = newRateLimiter(writes, burst, c.timeNow())
+	}
+	c.rateLimitPolicy = policy
+}
+
+// throttle applies the rate limit of |request|, if any.
+func (c *Client) throttle(request *http.Request) error {
+	var limiter = c.writeLimiter
+	if request.Method == "GET" || request.Method == "HEAD" {
+		limiter = c.readLimiter
+	}
+
+	if limiter == nil {
+		return nil
+	} else if c.rateLimitPolicy == ErrorOnFull {
+		if !limiter.take(c.timeNow()) {
+			return ErrRateLimited
+		}
+		return nil
+	}
+
+	var delay = limiter.reserve(c.timeNow())
+	if delay == 0 {
+		return nil
+	}
+	var timer = time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-request.Context().Done():
+		limiter.cancel()
+		return request.Context().Err()
+	}
+}
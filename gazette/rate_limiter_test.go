@@ -0,0 +1,103 @@
+package gazette
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	gc "github.com/go-check/check"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type RateLimiterSuite struct{}
+
+func (s *RateLimiterSuite) TestTokenBucket(c *gc.C) {
+	var t0 = time.Unix(1000, 0)
+	var l = newRateLimiter(2, 3, t0) // 2 per second, with bursts of 3.
+
+	// A full burst is immediately available.
+	for i := 0; i != 3; i++ {
+		c.Check(l.take(t0), gc.Equals, true)
+	}
+	c.Check(l.take(t0), gc.Equals, false)
+
+	// Tokens accrue at |rate|.
+	c.Check(l.take(t0.Add(250*time.Millisecond)), gc.Equals, false)
+	c.Check(l.take(t0.Add(500*time.Millisecond)), gc.Equals, true)
+	c.Check(l.take(t0.Add(500*time.Millisecond)), gc.Equals, false)
+
+	// Reservations are made ahead of token availability.
+	var t1 = t0.Add(500 * time.Millisecond)
+	c.Check(l.reserve(t1), gc.Equals, 500*time.Millisecond)
+	c.Check(l.reserve(t1), gc.Equals, time.Second)
+	l.cancel()
+	c.Check(l.reserve(t1), gc.Equals, time.Second)
+
+	// Tokens never accrue beyond |burst|.
+	var t2 = t1.Add(time.Hour)
+	for i := 0; i != 3; i++ {
+		c.Check(l.reserve(t2), gc.Equals, time.Duration(0))
+	}
+	c.Check(l.reserve(t2), gc.Equals, 500*time.Millisecond)
+}
+
+func (s *RateLimiterSuite) TestClientPolicies(c *gc.C) {
+	gazetteMap.Init()
+
+	var mockClient = &mockHttpClient{}
+	client, err := NewClient("http://default")
+	c.Assert(err, gc.IsNil)
+	client.timeNow = func() time.Time { return time.Unix(1234, 0) } // Fix time.
+	client.httpClient = mockClient
+	client.locationCache.Add("/a/journal", newURL("http://default/a/journal"))
+
+	// Writes are limited, while reads are not.
+	client.SetRateLimits(0, 1, 1, ErrorOnFull)
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNoContent,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Twice()
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD"
+	})).Return(&http.Response{
+		StatusCode: http.StatusRequestedRangeNotSatisfiable,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Twice()
+
+	var put = func() error {
+		return client.Put(journal.AppendArgs{
+			Journal: "a/journal",
+			Content: strings.NewReader("content"),
+		}).Error
+	}
+	c.Check(put(), gc.IsNil)
+	c.Check(put(), gc.Equals, ErrRateLimited)
+
+	for i := 0; i != 2; i++ {
+		var result, _ = client.Head(journal.ReadArgs{Journal: "a/journal"})
+		c.Check(result.Error, gc.Equals, journal.ErrNotYetAvailable)
+	}
+
+	// Under BlockOnFull, a throttled request waits until its context is cancelled.
+	client.SetRateLimits(0, 1, 1, BlockOnFull)
+	c.Check(put(), gc.IsNil)
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	request, _ := http.NewRequest("PUT", "/a/journal", strings.NewReader("content"))
+
+	time.AfterFunc(time.Millisecond, cancel)
+	_, err = client.Do(request.WithContext(ctx))
+	c.Check(err, gc.Equals, context.Canceled)
+
+	mockClient.AssertExpectations(c)
+}
+
+var _ = gc.Suite(&RateLimiterSuite{})
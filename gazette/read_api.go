@@ -37,6 +37,7 @@ func (h *ReadAPI) Register(router *mux.Router) {
 
 func (h *ReadAPI) Head(w http.ResponseWriter, r *http.Request) {
 	op, result := h.initialRead(w, r)
+	observeServerRequest("head", result.Error)
 
 	switch result.Error {
 	case nil, journal.ErrNotYetAvailable, journal.ErrNotReplica, journal.ErrNotFound:
@@ -48,6 +49,7 @@ func (h *ReadAPI) Head(w http.ResponseWriter, r *http.Request) {
 
 func (h *ReadAPI) Read(w http.ResponseWriter, r *http.Request) {
 	op, result := h.initialRead(w, r)
+	observeServerRequest("read", result.Error)
 
 	// Loop performing incremental reads and copying to the client. If we fail
 	// here, we log and just drop the connection (since we've already written
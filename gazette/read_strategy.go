@@ -0,0 +1,271 @@
+package gazette
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+)
+
+// ReadStrategy determines how reads (Head, Get, and GetDirect) of a Client
+// are issued when the broker serving a journal is slow or unreachable.
+type ReadStrategy int
+
+const (
+	// ReadPrimaryOnly issues reads only to the broker which the Client routes
+	// the journal to (its cached location, or otherwise the default endpoint).
+	// It's the default ReadStrategy.
+	ReadPrimaryOnly ReadStrategy = iota
+	// ReadAnyReplica retries a read which fails with a transport error or a
+	// server error (a 5xx status) against each other replica of the journal,
+	// as known from the route of a previous read, and then each other endpoint
+	// of the Client. Brokers respond to reads of persisted content with the
+	// location of its Fragment, which the Client then reads directly from the
+	// fragment store: any responding replica suffices for such reads.
+	ReadAnyReplica
+	// ReadHedged is ReadAnyReplica, and additionally issues a "hedged" read to
+	// another replica if the broker hasn't responded within a hedge delay.
+	// The first successful response is used, and the other is cancelled.
+	// Blocking reads, which may legitimately await content, aren't hedged.
+	ReadHedged
+)
+
+// SetReadStrategy sets the ReadStrategy of the Client. |hedgeAfter| is the
+// hedge delay of ReadHedged, and is otherwise ignored. SetReadStrategy must
+// be called before the Client is used.
+func (c *Client) SetReadStrategy(strategy ReadStrategy, hedgeAfter time.Duration) {
+	c.readStrategy = strategy
+	c.hedgeAfter = hedgeAfter
+
+	if c.routeCache == nil {
+		c.routeCache, _ = lru.New(kClientRouteCacheSize) // Cannot fail.
+	}
+}
+
+// readAttempt is the outcome of an attempt of a read request.
+type readAttempt struct {
+	id       int
+	response *http.Response
+	err      error
+}
+
+// doRead issues read |request| under |ctx|, per the Client's ReadStrategy.
+func (c *Client) doRead(ctx context.Context, request *http.Request) (*http.Response, error) {
+	if c.readStrategy == ReadPrimaryOnly {
+		return c.Do(request.WithContext(ctx))
+	}
+	var cacheKey = request.URL.Path
+	var replicas = c.readReplicas(cacheKey)
+
+	var results = make(chan readAttempt, len(replicas)+1)
+	var cancels []context.CancelFunc
+
+	// start begins a read attempt of |replica|, or of the primary if nil.
+	var start = func(replica *url.URL) {
+		var attemptCtx, cancel = context.WithCancel(ctx)
+		var attempt = readAttempt{id: len(cancels)}
+		var req = cloneReadRequest(attemptCtx, request)
+		cancels = append(cancels, cancel)
+
+		go func() {
+			if replica == nil {
+				attempt.response, attempt.err = c.Do(req)
+			} else {
+				attempt.response, attempt.err = c.doAt(req, replica)
+			}
+			results <- attempt
+		}()
+	}
+
+	var hedgeCh <-chan time.Time
+	if c.readStrategy == ReadHedged && len(replicas) != 0 && isHedgeable(request) {
+		var timer = time.NewTimer(c.hedgeAfter)
+		defer timer.Stop()
+		hedgeCh = timer.C
+	}
+	start(nil)
+
+	var pending = 1
+	var failed *readAttempt // Most recent retryable failure.
+
+	for {
+		var attempt readAttempt
+
+		select {
+		case <-hedgeCh:
+			if hedgeCh = nil; len(replicas) != 0 {
+				start(replicas[0])
+				replicas, pending = replicas[1:], pending+1
+			}
+			continue
+		case attempt = <-results:
+			pending--
+		}
+
+		if isRetryableRead(attempt) && ctx.Err() == nil {
+			if failed != nil {
+				if failed.response != nil {
+					failed.response.Body.Close()
+				}
+				cancels[failed.id]()
+			}
+			failed = &attempt
+
+			if pending != 0 {
+				continue // Await the outstanding attempt.
+			} else if len(replicas) != 0 {
+				start(replicas[0])
+				replicas, pending = replicas[1:], pending+1
+				continue
+			}
+		}
+		// |attempt| is the outcome of the read. Cancel other attempts, and
+		// release any which are still to complete.
+		if failed != nil && failed.id != attempt.id && failed.response != nil {
+			failed.response.Body.Close()
+		}
+		for id, cancel := range cancels {
+			if id != attempt.id {
+				cancel()
+			}
+		}
+		if pending != 0 {
+			go discardReadAttempts(results, pending)
+		}
+
+		if attempt.response != nil {
+			c.observeRoute(cacheKey, attempt.response)
+			// Retain the attempt context until the body is closed.
+			attempt.response.Body = cancelOnClose{attempt.response.Body, cancels[attempt.id]}
+		} else {
+			cancels[attempt.id]()
+		}
+		return attempt.response, attempt.err
+	}
+}
+
+// doAt is Do, with |request| routed to |replica| rather than the cached
+// location or default endpoint. A successful response updates the cached
+// location of the request path to |replica|.
+func (c *Client) doAt(request *http.Request, replica *url.URL) (*http.Response, error) {
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+	var cacheKey = request.URL.Path
+
+	request.URL.Scheme = replica.Scheme
+	request.URL.User = replica.User
+	request.URL.Host = replica.Host
+
+	if c.breaker != nil && !c.breaker.allow(request.URL.Host, c.timeNow()) {
+		return nil, ErrCircuitOpen
+	}
+	return c.send(request, cacheKey, c.defaultEndpoint())
+}
+
+// readReplicas returns endpoints to which a read of |cacheKey| may be issued
+// should its primary fail: replicas of the journal's last observed route,
+// followed by endpoints of the Client, each excluding the primary.
+func (c *Client) readReplicas(cacheKey string) []*url.URL {
+	var primary = c.defaultEndpoint()
+	if cached, ok := c.locationCache.Get(cacheKey); ok {
+		primary = cached.(*url.URL)
+	}
+	var seen = map[string]bool{primary.Host: true}
+	var out []*url.URL
+
+	var add = func(u *url.URL) {
+		if !seen[u.Host] {
+			seen[u.Host] = true
+			out = append(out, u)
+		}
+	}
+	if route, ok := c.routeCache.Get(cacheKey); ok {
+		for _, u := range route.([]*url.URL) {
+			add(u)
+		}
+	}
+	c.endpointMu.Lock()
+	for _, u := range c.endpoints {
+		add(u)
+	}
+	c.endpointMu.Unlock()
+
+	return out
+}
+
+// observeRoute caches replicas of the journal route of read |response|.
+func (c *Client) observeRoute(cacheKey string, response *http.Response) {
+	var token = response.Header.Get(RouteTokenHeader)
+	if token == "" {
+		return
+	}
+	var route []*url.URL
+
+	for _, entry := range strings.Split(token, "|") {
+		if u, err := url.Parse(entry); err == nil && u.Host != "" {
+			route = append(route, u)
+		}
+	}
+	c.routeCache.Add(cacheKey, route)
+}
+
+// isRetryableRead returns whether |attempt| failed in a way which another
+// replica may not: with a transport error, or a server error.
+func isRetryableRead(attempt readAttempt) bool {
+	switch attempt.err {
+	case nil:
+		return attempt.response.StatusCode >= http.StatusInternalServerError
+	case ErrClientClosed, ErrRateLimited:
+		return false
+	default:
+		return true
+	}
+}
+
+// isHedgeable returns whether read |request| is expected to be promptly
+// answered by a healthy broker: it's a HEAD, or a non-blocking GET.
+func isHedgeable(request *http.Request) bool {
+	return request.Method == "HEAD" || request.URL.Query().Get("block") != "true"
+}
+
+// cloneReadRequest returns a copy of |request| under |ctx|, having its own
+// URL and Header which may be modified independently of |request|. As reads
+// have no body, the copy may be issued concurrently with |request|.
+func cloneReadRequest(ctx context.Context, request *http.Request) *http.Request {
+	var out = request.WithContext(ctx)
+
+	var u = *request.URL
+	out.URL = &u
+
+	out.Header = make(http.Header, len(request.Header))
+	for k, v := range request.Header {
+		out.Header[k] = append([]string(nil), v...)
+	}
+	return out
+}
+
+// discardReadAttempts receives |n| attempts of |results|, closing responses.
+func discardReadAttempts(results <-chan readAttempt, n int) {
+	for ; n != 0; n-- {
+		if attempt := <-results; attempt.response != nil {
+			attempt.response.Body.Close()
+		}
+	}
+}
+
+// cancelOnClose is an io.ReadCloser which invokes |cancel| upon Close.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	var err = c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,138 @@
+package gazette
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	gc "github.com/go-check/check"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type ReadStrategySuite struct {
+	client *Client
+	mock   *mockHttpClient
+}
+
+func (s *ReadStrategySuite) SetUpTest(c *gc.C) {
+	gazetteMap.Init()
+
+	var client, err = NewClient("http://default", "http://other")
+	c.Assert(err, gc.IsNil)
+	client.timeNow = func() time.Time { return time.Unix(1234, 0) } // Fix time.
+
+	s.mock = new(mockHttpClient)
+	client.httpClient = s.mock
+	s.client = client
+}
+
+func (s *ReadStrategySuite) TestPrimaryOnly(c *gc.C) {
+	s.client.SetReadStrategy(ReadPrimaryOnly, 0)
+	s.client.locationCache.Add("/a/journal", newURL("http://broker/a/journal"))
+	s.client.routeCache.Add("/a/journal", []*url.URL{newURL("http://broker"), newURL("http://replica")})
+
+	s.mock.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.Host == "broker"
+	})).Return(nil, io.ErrUnexpectedEOF).Once()
+
+	// Expect the failure is returned, without attempting other replicas.
+	var result, _ = s.client.Head(journal.ReadArgs{Journal: "a/journal", Offset: 1005})
+	c.Check(result.Error, gc.Equals, io.ErrUnexpectedEOF)
+
+	s.mock.AssertExpectations(c)
+}
+
+func (s *ReadStrategySuite) TestAnyReplicaFallback(c *gc.C) {
+	s.client.SetReadStrategy(ReadAnyReplica, 0)
+	s.client.locationCache.Add("/a/journal", newURL("http://broker/a/journal"))
+	s.client.routeCache.Add("/a/journal", []*url.URL{newURL("http://broker"), newURL("http://replica")})
+
+	// The broker is unreachable, and the replica fails with a server error.
+	s.mock.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.Host == "broker"
+	})).Return(nil, io.ErrUnexpectedEOF).Once()
+
+	s.mock.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.Host == "replica"
+	})).Return(&http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Body:       http.NoBody,
+	}, nil).Once()
+
+	// Expect the read falls back to the default endpoint, which succeeds.
+	var fixture = newReadResponseFixture()
+	fixture.Header.Set(RouteTokenHeader, "http://broker|http://replica-two")
+
+	s.mock.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.String() == "http://default/a/journal?block=false&offset=1005"
+	})).Return(fixture, nil).Once()
+
+	var result, loc = s.client.Head(journal.ReadArgs{Journal: "a/journal", Offset: 1005})
+	c.Check(result.Error, gc.IsNil)
+	c.Check(result.WriteHead, gc.Equals, int64(3000))
+	c.Check(loc, gc.DeepEquals, newURL("http://cloud/fragment/location"))
+
+	s.mock.AssertExpectations(c)
+
+	// The observed route was cached.
+	c.Check(s.client.readReplicas("/a/journal"), gc.DeepEquals, []*url.URL{
+		newURL("http://broker"), newURL("http://replica-two"),
+		newURL("http://default"), newURL("http://other")})
+}
+
+func (s *ReadStrategySuite) TestNonRetryableFailure(c *gc.C) {
+	s.client.SetReadStrategy(ReadAnyReplica, 0)
+
+	s.mock.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.Host == "default"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       http.NoBody,
+	}, nil).Once()
+
+	// Expect a journal protocol error is returned, without other attempts.
+	var result, _ = s.client.Head(journal.ReadArgs{Journal: "a/journal", Offset: 1005})
+	c.Check(result.Error, gc.Equals, journal.ErrNotFound)
+
+	s.mock.AssertExpectations(c)
+}
+
+func (s *ReadStrategySuite) TestHedgedRead(c *gc.C) {
+	s.client.SetReadStrategy(ReadHedged, time.Millisecond)
+	s.client.routeCache.Add("/a/journal", []*url.URL{newURL("http://default"), newURL("http://replica")})
+
+	// The default endpoint is slow to respond.
+	var release = make(chan time.Time)
+	s.mock.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.Host == "default"
+	})).Return(newReadResponseFixture(), nil).WaitUntil(release).Once()
+
+	// Expect a hedged read of the replica is issued, and its response is used.
+	var fixture = newReadResponseFixture()
+	fixture.Header.Set(WriteHeadHeader, "4000")
+
+	s.mock.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.Host == "replica"
+	})).Return(fixture, nil).Once()
+
+	var result, _ = s.client.Head(journal.ReadArgs{Journal: "a/journal", Offset: 1005})
+	c.Check(result.Error, gc.IsNil)
+	c.Check(result.WriteHead, gc.Equals, int64(4000))
+
+	close(release)
+}
+
+func (s *ReadStrategySuite) TestHedgeableRequests(c *gc.C) {
+	var newRequest = func(method string, args journal.ReadArgs) *http.Request {
+		var r, _ = http.NewRequest(method, s.client.buildReadURL(args).String(), nil)
+		return r
+	}
+	c.Check(isHedgeable(newRequest("HEAD", journal.ReadArgs{Journal: "a/journal", Blocking: true})), gc.Equals, true)
+	c.Check(isHedgeable(newRequest("GET", journal.ReadArgs{Journal: "a/journal"})), gc.Equals, true)
+	c.Check(isHedgeable(newRequest("GET", journal.ReadArgs{Journal: "a/journal", Blocking: true})), gc.Equals, false)
+}
+
+var _ = gc.Suite(&ReadStrategySuite{})
@@ -0,0 +1,189 @@
+package gazette
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// ErrReaderClosed is returned by Read of a journal.ReadCloser which was Closed.
+var ErrReaderClosed = errors.New("reader closed")
+
+// Effectively constant; mutable for test support.
+var readerErrCooloff = 5 * time.Second
+
+// Open returns a journal.ReadCloser of |args.Journal| beginning at |args.Offset|.
+// The returned reader presents a continuous bytestream: as the current broker
+// stream is closed (eg, at a fragment boundary or due to a transient error),
+// a new stream is transparently opened from the last read offset.
+//
+// If |args.Blocking|, Read blocks until content is available at the journal
+// head (or until |args.Deadline|, if set, after which io.EOF is returned).
+// Otherwise, Read returns io.EOF upon reaching the journal head. If
+// |args.MaxBytes| is set, Read returns io.EOF after |args.MaxBytes| in total
+// have been read.
+//
+// Historical offsets covered by a persisted Fragment are read directly from
+// the fragment store, and other offsets are streamed from a broker (long-polling
+// at the journal head if |args.Blocking|). The reader switches between the two
+// as it crosses Fragment boundaries. Requests which fail transiently (see
+// isTransientReadError) are logged and retried after a cool-off, by which time
+// the Client has rotated to another broker endpoint if the request's broker
+// couldn't be reached. Other errors are returned by Read.
+//
+// Close may be called concurrently with Read, and aborts any in-flight request
+// (including a blocked long-poll) such that the Read returns ErrReaderClosed.
+func (c *Client) Open(args journal.ReadArgs) (journal.ReadCloser, error) {
+	return c.OpenContext(context.Background(), args)
+}
+
+// OpenContext is Open, with reader requests issued under |ctx|. Cancellation
+// or expiry of |ctx| closes the reader.
+func (c *Client) OpenContext(ctx context.Context, args journal.ReadArgs) (journal.ReadCloser, error) {
+	if args.Journal == "" {
+		return nil, errors.New("expected a journal name")
+	} else if err := args.Journal.Validate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &reader{
+		client: c,
+		args:   args,
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+type reader struct {
+	client *Client
+	// Arguments of the next request. |args.Offset| is updated with each Read.
+	args journal.ReadArgs
+	// Result & body of the current stream, or nil if a stream is not open.
+	result journal.ReadResult
+	body   io.ReadCloser
+	// Total bytes read.
+	read int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for {
+		if r.ctx.Err() != nil {
+			r.closeBody()
+			return 0, ErrReaderClosed
+		}
+
+		if r.body == nil {
+			if !r.args.Deadline.IsZero() && !r.client.timeNow().Before(r.args.Deadline) {
+				return 0, io.EOF
+			}
+			var args = r.args
+
+			if args.MaxBytes != 0 {
+				if args.MaxBytes -= r.read; args.MaxBytes <= 0 {
+					return 0, io.EOF
+				}
+			}
+			r.result, r.body = r.client.get(r.ctx, args)
+
+			switch r.result.Error {
+			case nil:
+				r.args.Offset = r.result.Offset
+			case journal.ErrNotYetAvailable:
+				// Non-blocking read at the journal head.
+				return 0, io.EOF
+			default:
+				if r.ctx.Err() != nil {
+					continue // Read returns ErrReaderClosed.
+				} else if !isTransientReadError(r.result.Error) {
+					return 0, r.result.Error
+				}
+				r.client.logger.WithFields(log.Fields{"args": r.args, "err": r.result.Error}).
+					Warn("open failed")
+				r.cooloff()
+				continue
+			}
+		}
+
+		var n, err = r.body.Read(p)
+		r.args.Offset += int64(n)
+		r.read += int64(n)
+
+		if err == io.EOF {
+			// The broker closed the stream. Re-open from the current offset.
+			r.closeBody()
+		} else if err != nil {
+			r.closeBody()
+
+			if r.ctx.Err() == nil {
+				r.client.logger.WithFields(log.Fields{"args": r.args, "err": err}).Warn("read failed")
+				r.cooloff()
+			}
+		}
+
+		if n != 0 {
+			return n, nil
+		}
+	}
+}
+
+// Offset returns the journal offset of the next byte to be read. If the
+// reader was opened at offset -1, Offset is -1 until the first stream is opened.
+func (r *reader) Offset() int64 {
+	return r.args.Offset
+}
+
+// Close aborts in-flight requests and releases the reader.
+func (r *reader) Close() error {
+	r.cancel()
+	return nil
+}
+
+func (r *reader) closeBody() {
+	if r.body == nil {
+		return
+	}
+	if err := r.body.Close(); err != nil && r.ctx.Err() == nil {
+		r.client.logger.WithField("err", err).Warn("closing stream")
+	}
+	r.body = nil
+}
+
+// cooloff blocks for |readerErrCooloff|, or until the reader is Closed.
+func (r *reader) cooloff() {
+	select {
+	case <-r.client.timeAfter(readerErrCooloff):
+	case <-r.ctx.Done():
+	}
+}
+
+// isTransientReadError returns whether a read request which failed with |err|
+// may succeed if retried: |err| is an error of the network transport, a
+// server error, or a circuit breaker which will later allow the request.
+// Journal protocol errors and other client errors (eg, ErrUnauthorized, or a
+// *journal.StatusError of a bad request) are not transient.
+func isTransientReadError(err error) bool {
+	switch err {
+	case ErrCircuitOpen:
+		return true
+	case ErrClientClosed, ErrRateLimited:
+		return false
+	}
+	if se, ok := err.(*journal.StatusError); ok {
+		return se.StatusCode >= http.StatusInternalServerError
+	} else if code := journal.StatusCodeForError(err); code != http.StatusInternalServerError {
+		// A Journal protocol error. ErrBrokerUnavailable and ErrReplicationFailed
+		// map to server errors.
+		return code >= http.StatusInternalServerError
+	}
+	return true // An error of the network transport.
+}
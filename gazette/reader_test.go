@@ -0,0 +1,302 @@
+package gazette
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	gc "github.com/go-check/check"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type ReaderSuite struct {
+	client *Client
+}
+
+func (s *ReaderSuite) SetUpTest(c *gc.C) {
+	gazetteMap.Init()
+
+	client, err := NewClient("http://default")
+	c.Assert(err, gc.IsNil)
+	client.timeNow = func() time.Time { return time.Unix(1234, 0) } // Fix time.
+	s.client = client
+
+	readerErrCooloff = 0
+}
+
+func (s *ReaderSuite) TearDownTest(c *gc.C) {
+	readerErrCooloff = 5 * time.Second
+}
+
+func (s *ReaderSuite) TestReadAcrossStreamsUntilHead(c *gc.C) {
+	var mockClient = &mockHttpClient{}
+
+	// First stream: HEAD & GET of offset 1005, returning "body".
+	var first = newReadResponseFixture()
+	first.Header.Del(FragmentLocationHeader)
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD" && request.URL.Query().Get("offset") == "1005"
+	})).Return(first, nil).Once()
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "GET" && request.URL.Query().Get("offset") == "1005"
+	})).Return(first, nil).Once()
+
+	// Second stream: HEAD of offset 1009 fails with a transient error, and is
+	// retried. The stream then returns "more".
+	var second = newReadResponseFixture()
+	second.Header.Del(FragmentLocationHeader)
+	second.Header.Set("Content-Range", "bytes 1009-9999999999/9999999999")
+	second.Body = ioutil.NopCloser(strings.NewReader("more"))
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD" && request.URL.Query().Get("offset") == "1009"
+	})).Return(nil, io.ErrUnexpectedEOF).Once()
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD" && request.URL.Query().Get("offset") == "1009"
+	})).Return(second, nil).Once()
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "GET" && request.URL.Query().Get("offset") == "1009"
+	})).Return(second, nil).Once()
+
+	// Third stream: the journal head has been reached.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD" && request.URL.Query().Get("offset") == "1013"
+	})).Return(&http.Response{
+		StatusCode: http.StatusRequestedRangeNotSatisfiable,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Once()
+
+	s.client.httpClient = mockClient
+
+	var rc, err = s.client.Open(journal.ReadArgs{Journal: "a/journal", Offset: 1005})
+	c.Assert(err, gc.IsNil)
+	c.Check(rc.Offset(), gc.Equals, int64(1005))
+
+	content, err := ioutil.ReadAll(rc)
+	c.Check(err, gc.IsNil)
+	c.Check(string(content), gc.Equals, "bodymore")
+	c.Check(rc.Offset(), gc.Equals, int64(1013))
+
+	c.Check(rc.Close(), gc.IsNil)
+	mockClient.AssertExpectations(c)
+}
+
+func (s *ReaderSuite) TestReadFromFragmentThenBroker(c *gc.C) {
+	var mockClient = &mockHttpClient{}
+
+	// First stream: offset 1995 is covered by a persisted fragment [1000, 2000),
+	// which is read directly.
+	var first = newReadResponseFixture()
+	first.Header.Set("Content-Range", "bytes 1995-9999999999/9999999999")
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD" && request.URL.Query().Get("offset") == "1995"
+	})).Return(first, nil).Once()
+	mockClient.On("Do", getRequest("http://cloud/fragment/location")).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 995) + "frag!")),
+	}, nil).Once()
+
+	// Second stream: offset 2000 isn't yet persisted, and is read from the broker.
+	var second = newReadResponseFixture()
+	second.Header.Del(FragmentNameHeader)
+	second.Header.Del(FragmentLastModifiedHeader)
+	second.Header.Del(FragmentLocationHeader)
+	second.Header.Set("Content-Range", "bytes 2000-9999999999/9999999999")
+	second.Body = ioutil.NopCloser(strings.NewReader("live"))
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD" && request.URL.Query().Get("offset") == "2000"
+	})).Return(second, nil).Once()
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "GET" && request.URL.Query().Get("offset") == "2000"
+	})).Return(second, nil).Once()
+
+	// Third stream: the journal head has been reached.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD" && request.URL.Query().Get("offset") == "2004"
+	})).Return(&http.Response{
+		StatusCode: http.StatusRequestedRangeNotSatisfiable,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Once()
+
+	s.client.httpClient = mockClient
+
+	var rc, err = s.client.Open(journal.ReadArgs{Journal: "a/journal", Offset: 1995})
+	c.Assert(err, gc.IsNil)
+
+	content, err := ioutil.ReadAll(rc)
+	c.Check(err, gc.IsNil)
+	c.Check(string(content), gc.Equals, "frag!live")
+	c.Check(rc.Offset(), gc.Equals, int64(2004))
+
+	c.Check(rc.Close(), gc.IsNil)
+	mockClient.AssertExpectations(c)
+}
+
+func (s *ReaderSuite) TestContextCancellationCloses(c *gc.C) {
+	// Expect no requests are issued.
+	s.client.httpClient = &mockHttpClient{}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	var rc, err = s.client.OpenContext(ctx, journal.ReadArgs{Journal: "a/journal", Blocking: true})
+	c.Assert(err, gc.IsNil)
+
+	cancel()
+	_, err = rc.Read(make([]byte, 1))
+	c.Check(err, gc.Equals, ErrReaderClosed)
+}
+
+func (s *ReaderSuite) TestNotFoundIsReturned(c *gc.C) {
+	var mockClient = &mockHttpClient{}
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Once()
+
+	s.client.httpClient = mockClient
+
+	var rc, err = s.client.Open(journal.ReadArgs{Journal: "a/journal", Blocking: true})
+	c.Assert(err, gc.IsNil)
+
+	_, err = rc.Read(make([]byte, 1))
+	c.Check(err, gc.Equals, journal.ErrNotFound)
+
+	mockClient.AssertExpectations(c)
+}
+
+func (s *ReaderSuite) TestNonTransientErrorsAreReturned(c *gc.C) {
+	for _, fixture := range []struct {
+		status int
+		err    string
+	}{
+		{http.StatusUnauthorized, "unauthorized"},
+		{http.StatusBadRequest, "Bad Request \\(invalid offset\\)"},
+	} {
+		var mockClient = &mockHttpClient{}
+
+		mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+			return request.Method == "HEAD"
+		})).Return(&http.Response{
+			StatusCode: fixture.status,
+			Status:     http.StatusText(fixture.status),
+			Body:       ioutil.NopCloser(strings.NewReader("invalid offset")),
+		}, nil).Once()
+
+		s.client.httpClient = mockClient
+
+		var rc, err = s.client.Open(journal.ReadArgs{Journal: "a/journal", Blocking: true})
+		c.Assert(err, gc.IsNil)
+
+		// Expect the error is returned, and the request is not retried.
+		_, err = rc.Read(make([]byte, 1))
+		c.Check(err, gc.ErrorMatches, fixture.err)
+
+		mockClient.AssertExpectations(c)
+	}
+}
+
+func (s *ReaderSuite) TestServerErrorIsRetriedAfterCooloff(c *gc.C) {
+	var clock = journal.NewManualClock(time.Unix(1234, 0))
+	s.client.timeAfter = clock.After
+	readerErrCooloff = time.Second
+
+	var mockClient = &mockHttpClient{}
+
+	// HEAD fails with a server error, and is retried after the cool-off.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD"
+	})).Return(&http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Status:     "Whoops!",
+		Body:       ioutil.NopCloser(strings.NewReader("error")),
+	}, nil).Once()
+
+	var fixture = newReadResponseFixture()
+	fixture.Header.Del(FragmentLocationHeader)
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD"
+	})).Return(fixture, nil).Once()
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "GET"
+	})).Return(fixture, nil).Once()
+
+	s.client.httpClient = mockClient
+
+	var rc, err = s.client.Open(journal.ReadArgs{Journal: "a/journal", Offset: 1005})
+	c.Assert(err, gc.IsNil)
+
+	var readCh = make(chan error)
+	go func() {
+		var _, err = rc.Read(make([]byte, 4))
+		readCh <- err
+	}()
+
+	// Expect the Read awaits the cool-off.
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-readCh:
+		c.Fatal("unexpected Read completion")
+	default:
+	}
+	clock.Advance(time.Second)
+
+	c.Check(<-readCh, gc.IsNil)
+	c.Check(rc.Offset(), gc.Equals, int64(1009))
+
+	mockClient.AssertExpectations(c)
+}
+
+func (s *ReaderSuite) TestTransientErrorClassification(c *gc.C) {
+	for err, transient := range map[error]bool{
+		io.ErrUnexpectedEOF:                   true,
+		journal.ErrBrokerUnavailable:          true,
+		journal.ErrReplicationFailed:          true,
+		ErrCircuitOpen:                        true,
+		&journal.StatusError{StatusCode: 500}: true,
+		&journal.StatusError{StatusCode: 400}: false,
+		journal.ErrUnauthorized:               false,
+		journal.ErrNotFound:                   false,
+		ErrClientClosed:                       false,
+		ErrRateLimited:                        false,
+	} {
+		c.Check(isTransientReadError(err), gc.Equals, transient, gc.Commentf("%v", err))
+	}
+}
+
+func (s *ReaderSuite) TestDeadlineAndClose(c *gc.C) {
+	// Expect no requests are issued.
+	s.client.httpClient = &mockHttpClient{}
+
+	var rc, err = s.client.Open(journal.ReadArgs{
+		Journal:  "a/journal",
+		Blocking: true,
+		Deadline: time.Unix(1234, 0),
+	})
+	c.Assert(err, gc.IsNil)
+
+	// Deadline has already elapsed.
+	_, err = rc.Read(make([]byte, 1))
+	c.Check(err, gc.Equals, io.EOF)
+
+	c.Check(rc.Close(), gc.IsNil)
+	_, err = rc.Read(make([]byte, 1))
+	c.Check(err, gc.Equals, ErrReaderClosed)
+
+	_, err = s.client.Open(journal.ReadArgs{})
+	c.Check(err, gc.ErrorMatches, "expected a journal name")
+}
+
+var _ = gc.Suite(&ReaderSuite{})
@@ -56,6 +56,7 @@ func (h *ReplicateAPI) Replicate(w http.ResponseWriter, r *http.Request) {
 
 	h.handler.Replicate(op)
 	result := <-op.Result
+	observeServerRequest("replicate", result.Error)
 
 	if result.Error != nil {
 		if result.ErrorWriteHead != 0 {
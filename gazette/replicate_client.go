@@ -88,6 +88,13 @@ func (t *replicaClientTransaction) start(op journal.ReplicateOp) {
 	req.URL.RawQuery = queryArgs.Encode()
 	req.Header.Add("Expect", "100-continue")
 	req.Header.Add("Trailer", CommitDeltaHeader)
+
+	replicateTokenMu.Lock()
+	if replicateToken != "" {
+		req.Header.Add("Authorization", "Bearer "+replicateToken)
+	}
+	replicateTokenMu.Unlock()
+
 	req.TransferEncoding = []string{"chunked"}
 
 	reqBytes, err := httpdump.DumpRequest(req, false)
@@ -157,6 +164,11 @@ func (t *replicaClientTransaction) takeConn() (replicaClientConn, error) {
 		t.client.endpoint.InvalidateResolution()
 		return replicaClientConn{}, err
 	}
+	if url.Scheme == "https" {
+		if raw, err = dialReplicaTLS(raw, url.Host); err != nil {
+			return replicaClientConn{}, err
+		}
+	}
 	return replicaClientConn{raw,
 		bufio.NewReadWriter(bufio.NewReader(raw), bufio.NewWriter(raw))}, nil
 }
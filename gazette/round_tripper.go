@@ -0,0 +1,42 @@
+package gazette
+
+import (
+	"net/http"
+)
+
+// RoundTripperMiddleware wraps the http.RoundTripper |next| of the Client
+// transport, returning a RoundTripper which is used in its place. Middleware
+// may intercept, modify, or observe requests and their responses (eg, for
+// fault-injection, request signing, or tracing), and generally delegates to
+// |next|.
+type RoundTripperMiddleware func(next http.RoundTripper) http.RoundTripper
+
+// SetRoundTripper composes |middleware| into the transport of the Client. The
+// transport of the Client (see MakeHttpTransport), and any TLS configuration
+// of it, remains beneath |middleware| and continues to manage connections.
+//
+// Ordering of |middleware| is outermost-first: |middleware[0]| receives each
+// request first, and passes it to |middleware[1]|, and so on to the transport.
+// Middleware receive requests after the Client has attached its own headers
+// (eg, Authorization of a TokenProvider, and trace context of a Tracer), and
+// see each request actually issued, including retries and redirects to
+// Fragment locations. Subsequent calls of SetRoundTripper compose further
+// middleware outside of that already set. SetRoundTripper must be called
+// before the Client is used.
+func (c *Client) SetRoundTripper(middleware ...RoundTripperMiddleware) {
+	var hc = c.httpClient.(*http.Client)
+
+	var transport = hc.Transport
+	for i := len(middleware) - 1; i >= 0; i-- {
+		transport = middleware[i](transport)
+	}
+	hc.Transport = transport
+}
+
+// RoundTripperFunc adapts a function to an http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip invokes the RoundTripperFunc.
+func (f RoundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
@@ -0,0 +1,70 @@
+package gazette
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	gc "github.com/go-check/check"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type RoundTripperSuite struct{}
+
+func (s *RoundTripperSuite) TestMiddlewareOrderingAndHeaders(c *gc.C) {
+	gazetteMap.Init()
+
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.Header.Get("X-Signature"), gc.Equals, "signed")
+
+			w.Header().Set(WriteHeadHeader, "100")
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		}))
+	defer server.Close()
+
+	var client, err = NewClient(server.URL)
+	c.Assert(err, gc.IsNil)
+	client.SetBearerToken("a-token")
+
+	var calls []string
+	var middleware = func(name string) RoundTripperMiddleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				// Expect the Client's own headers are already attached.
+				c.Check(r.Header.Get("Authorization"), gc.Equals, "Bearer a-token")
+
+				calls = append(calls, name)
+				r.Header.Set("X-Signature", "signed")
+				return next.RoundTrip(r)
+			})
+		}
+	}
+	client.SetRoundTripper(middleware("first"), middleware("second"))
+	client.SetRoundTripper(middleware("outer"))
+
+	var result, _ = client.Head(journal.ReadArgs{Journal: "a/journal", Offset: 100})
+	c.Check(result.Error, gc.Equals, journal.ErrNotYetAvailable)
+	c.Check(result.WriteHead, gc.Equals, int64(100))
+	c.Check(calls, gc.DeepEquals, []string{"outer", "first", "second"})
+}
+
+func (s *RoundTripperSuite) TestFaultInjection(c *gc.C) {
+	gazetteMap.Init()
+
+	var client, err = NewClient("http://default")
+	c.Assert(err, gc.IsNil)
+
+	var injected = errors.New("injected fault")
+	client.SetRoundTripper(func(http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+			return nil, injected
+		})
+	})
+
+	var result, _ = client.Head(journal.ReadArgs{Journal: "a/journal", Offset: 0})
+	c.Check(result.Error, gc.ErrorMatches, ".*injected fault")
+}
+
+var _ = gc.Suite(&RoundTripperSuite{})
@@ -29,6 +29,8 @@ type Router struct {
 	// This mutex guards any read or write operation on |routes| *and* its
 	// underlying |*journalRoute| values.
 	routesMu sync.Mutex
+	// Tracks JournalReplicas which are shutting down.
+	shutdowns sync.WaitGroup
 }
 
 func NewRouter(factory ReplicaFactory) *Router {
@@ -209,7 +211,7 @@ func (r *Router) transition(name journal.Name, rt journal.RouteToken,
 		route.replica = r.replicaFactory(name)
 	} else if route.replica != nil && !replica {
 		// The replica exists, but should not.
-		route.replica.Shutdown()
+		r.shutdownReplica(route.replica)
 		route.replica = nil
 	}
 
@@ -241,6 +243,35 @@ func (r *Router) transition(name journal.Name, rt journal.RouteToken,
 	}
 }
 
+// Shutdown shuts down all local JournalReplicas, and blocks until they and
+// any JournalReplicas previously shut down have completed, at which point
+// their spooled Fragments have been passed to the persister. The Router serves
+// no operations after Shutdown, which should be called only after the Runner
+// of the Router has released its items (eg, after Runner.Run returns).
+func (r *Router) Shutdown() {
+	r.routesMu.Lock()
+	for _, route := range r.routes {
+		if route.replica != nil {
+			r.shutdownReplica(route.replica)
+		}
+		*route = journalRoute{}
+	}
+	r.routesMu.Unlock()
+
+	r.shutdowns.Wait()
+}
+
+// shutdownReplica begins shutdown of |replica|, tracking its completion.
+func (r *Router) shutdownReplica(replica JournalReplica) {
+	replica.Shutdown()
+
+	r.shutdowns.Add(1)
+	go func() {
+		replica.WaitForShutdown()
+		r.shutdowns.Done()
+	}()
+}
+
 func (r *Router) readRoute(name journal.Name) (journalRoute, bool) {
 	r.routesMu.Lock()
 	defer r.routesMu.Unlock()
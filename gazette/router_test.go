@@ -198,6 +198,34 @@ func (s *RouterSuite) TestBrokerRedirect(c *gc.C) {
 // which records calls.
 type routerRecorder []string
 
+func (s *RouterSuite) TestShutdown(c *gc.C) {
+	var recorder routerRecorder
+	var router = NewRouter(recorder.NewReplica)
+
+	router.transition("foo/bar", "http://local|http://remote", 0, 1)
+	router.transition("baz/bing", "http://remote|http://local", 1, 1)
+	router.transition("other", "http://remote|http://peer", -1, 1)
+	recorder.verify(c,
+		"created replica foo/bar",
+		"foo/bar => broker http://local|http://remote ([remote])",
+		"created replica baz/bing",
+		"baz/bing => replica http://remote|http://local")
+
+	// Expect each local replica is shut down.
+	router.Shutdown()
+	c.Check(recorder, gc.HasLen, 2)
+	c.Check(strings.Join([]string(recorder), ","), gc.Matches,
+		"(foo/bar => shutdown,baz/bing => shutdown|baz/bing => shutdown,foo/bar => shutdown)")
+
+	// Journals are no longer served.
+	var resultCh = make(chan journal.ReadResult, 1)
+	router.Read(journal.ReadOp{
+		ReadArgs: journal.ReadArgs{Journal: "foo/bar"},
+		Result:   resultCh,
+	})
+	c.Check(<-resultCh, gc.DeepEquals, journal.ReadResult{Error: journal.ErrNotFound})
+}
+
 type replicaRecorder struct {
 	journal.Name
 	recorder *routerRecorder
@@ -229,6 +257,8 @@ func (r replicaRecorder) Shutdown() {
 	*r.recorder = append(*r.recorder, fmt.Sprintf("%s => shutdown", r.Name))
 }
 
+func (r replicaRecorder) WaitForShutdown() {}
+
 // Trivial implementations of each operation handler,
 // which pass back a distinguishing WriteHead.
 func (r replicaRecorder) Append(op journal.AppendOp) {
@@ -2,6 +2,7 @@ package gazette
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/url"
 	"time"
 
@@ -17,9 +18,13 @@ const ServiceRoot = "/gazette/cluster"
 
 type Runner struct {
 	client        etcd.Client
+	keysAPI       etcd.KeysAPI
 	localRouteKey string
 	replicaCount  int
 	router        *Router
+	// Required replicas of items having a JournalSpec with a Replication,
+	// as of the last observed tree. Accessed only from the allocator goroutine.
+	itemReplicas map[string]int
 }
 
 func NewRunner(client etcd.Client, localRouteKey string, replicaCount int, router *Router) *Runner {
@@ -33,6 +38,12 @@ func NewRunner(client etcd.Client, localRouteKey string, replicaCount int, route
 	return &runner
 }
 
+// SetKeysAPI directs the Runner to use |keysAPI| in place of a KeysAPI of its
+// etcd.Client (eg, a consensus.NewV3KeysAPI). It must be called before Run.
+func (r *Runner) SetKeysAPI(keysAPI etcd.KeysAPI) {
+	r.keysAPI = keysAPI
+}
+
 func (r *Runner) Run() error {
 	return consensus.CreateAndAllocateWithSignalHandling(r)
 }
@@ -40,11 +51,47 @@ func (r *Runner) Run() error {
 // consumer.Allocator implementation.
 func (r *Runner) FixedItems() []string         { return nil }
 func (r *Runner) InstanceKey() string          { return r.localRouteKey }
-func (r *Runner) KeysAPI() etcd.KeysAPI        { return etcd.NewKeysAPI(r.client) }
 func (r *Runner) PathRoot() string             { return ServiceRoot }
 func (r *Runner) Replicas() int                { return r.replicaCount }
 func (r *Runner) ItemState(item string) string { return "ready" }
 
+// ObserveTree indexes the JournalSpecs of |tree|. It implements
+// consensus.TreeObserver.
+func (r *Runner) ObserveTree(tree *etcd.Node) {
+	r.itemReplicas = make(map[string]int)
+
+	var dir = consensus.Child(tree, JournalsPrefix)
+	if dir == nil {
+		return
+	}
+	for _, node := range dir.Nodes {
+		var item = node.Key[len(dir.Key)+1:]
+		var spec JournalSpec
+
+		if err := json.Unmarshal([]byte(node.Value), &spec); err != nil {
+			log.WithFields(log.Fields{"err": err, "key": node.Key}).Warn("failed to decode journal spec")
+		} else if spec.Replication != 0 {
+			r.itemReplicas[item] = spec.replicas(r.replicaCount)
+		}
+	}
+}
+
+// ItemReplicas returns the required replicas of |item|, per its JournalSpec.
+// It implements consensus.ItemReplicator.
+func (r *Runner) ItemReplicas(item string) int {
+	if replicas, ok := r.itemReplicas[item]; ok {
+		return replicas
+	}
+	return r.replicaCount
+}
+
+func (r *Runner) KeysAPI() etcd.KeysAPI {
+	if r.keysAPI != nil {
+		return r.keysAPI
+	}
+	return etcd.NewKeysAPI(r.client)
+}
+
 func (r *Runner) ItemIsReadyForPromotion(item, state string) bool {
 	name, err := itemToJournal(item)
 	if err != nil {
@@ -78,7 +125,7 @@ func (r *Runner) ItemRoute(item string, route consensus.Route, index int, tree *
 		return
 	}
 
-	r.router.transition(name, token, index, r.replicaCount)
+	r.router.transition(name, token, index, r.ItemReplicas(item))
 }
 
 func itemToJournal(s string) (journal.Name, error) {
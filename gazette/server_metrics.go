@@ -0,0 +1,18 @@
+package gazette
+
+import (
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/metrics"
+)
+
+// observeServerRequest records a served request of |operation| which
+// completed with |err|. As with Client requests, ErrNotYetAvailable is
+// an expected outcome of reads and is not considered an error.
+func observeServerRequest(operation string, err error) {
+	var outcome = "success"
+
+	if err != nil && err != journal.ErrNotYetAvailable {
+		outcome = "error"
+	}
+	metrics.GazetteServerRequestsTotal.WithLabelValues(operation, outcome).Inc()
+}
@@ -0,0 +1,157 @@
+package gazette
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// ErrStreamAppenderClosed is returned by writes to a closed StreamAppender.
+var ErrStreamAppenderClosed = errors.New("stream appender closed")
+
+// StreamAppender is a journal.Writer which pipelines appends over a single
+// Broker StreamAppend RPC. Each Write is sent as it's made, without waiting
+// for prior writes to be acknowledged, and returns an AsyncAppend which is
+// resolved by the broker's acknowledgement. Acknowledgements (and thus
+// AsyncAppends) resolve in write order. This removes the per-request overhead
+// of Client.Put, and suits producers of many small, frequent appends (eg, a
+// recoverylog.Recorder).
+//
+// Appends are made by the connected broker. Writes of journals for which it
+// isn't the broker fail with ErrNotBroker, and writes aren't retried: should
+// the RPC fail, pending and further writes fail with its error.
+type StreamAppender struct {
+	stream Broker_StreamAppendClient
+	// Bounds the number of unacknowledged writes.
+	slots chan struct{}
+	// Serializes Sends of the stream, and the enqueue of their AsyncAppends.
+	sendMu sync.Mutex
+
+	mu sync.Mutex
+	// Sent writes, in write order.
+	pending []streamWrite
+	// Error which failed the stream, if any.
+	err error
+
+	doneCh chan struct{} // Closed when the stream has been fully received.
+}
+
+// streamWrite is a sent write of |size| bytes, resolved by |aa|.
+type streamWrite struct {
+	aa   *journal.AsyncAppend
+	size int64
+}
+
+// NewStreamAppender begins a StreamAppend RPC of |client|, which lasts for
+// the lifetime of |ctx|, or until the StreamAppender is closed.
+func NewStreamAppender(ctx context.Context, client BrokerClient) (*StreamAppender, error) {
+	var stream, err = client.StreamAppend(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamAppender(stream), nil
+}
+
+func newStreamAppender(stream Broker_StreamAppendClient) *StreamAppender {
+	var a = &StreamAppender{
+		stream: stream,
+		slots:  make(chan struct{}, grpcMaxPipelinedAppends),
+		doneCh: make(chan struct{}),
+	}
+	go a.receive()
+	return a
+}
+
+// Write implements journal.Writer. |buffer| is sent before Write returns, and
+// may be re-used by the caller. Write blocks if the maximum number of
+// unacknowledged writes are outstanding.
+func (a *StreamAppender) Write(name journal.Name, buffer []byte) (*journal.AsyncAppend, error) {
+	a.slots <- struct{}{}
+
+	a.sendMu.Lock()
+	defer a.sendMu.Unlock()
+
+	var aa = &journal.AsyncAppend{Journal: name, Ready: make(chan struct{})}
+
+	a.mu.Lock()
+	if err := a.err; err != nil {
+		a.mu.Unlock()
+		<-a.slots
+		return nil, err
+	}
+	a.pending = append(a.pending, streamWrite{aa: aa, size: int64(len(buffer))})
+	a.mu.Unlock()
+
+	// If Send fails, the stream is broken, and |aa| is failed by receive.
+	if err := a.stream.Send(&StreamAppendRequest{Journal: name, Content: buffer}); err != nil {
+		return nil, err
+	}
+	return aa, nil
+}
+
+// ReadFrom implements journal.Writer. Content of |r| is read into memory,
+// and sent as a single write.
+func (a *StreamAppender) ReadFrom(name journal.Name, r io.Reader) (*journal.AsyncAppend, error) {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return a.Write(name, buf.Bytes())
+}
+
+// Close closes the StreamAppender to further writes, and blocks until all
+// pending writes have been acknowledged.
+func (a *StreamAppender) Close() error {
+	a.sendMu.Lock()
+	var err = a.stream.CloseSend()
+	a.sendMu.Unlock()
+
+	<-a.doneCh
+	return err
+}
+
+// receive resolves pending AsyncAppends from responses of the stream. Upon a
+// stream error (including its close), remaining AsyncAppends are failed.
+func (a *StreamAppender) receive() {
+	defer close(a.doneCh)
+
+	for {
+		var resp, err = a.stream.Recv()
+
+		a.mu.Lock()
+		if err == nil && len(a.pending) == 0 {
+			err = errors.New("unexpected StreamAppendResponse")
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = ErrStreamAppenderClosed
+			}
+			for _, w := range a.pending {
+				w.aa.Error = err
+				close(w.aa.Ready)
+				<-a.slots
+			}
+			a.pending, a.err = nil, err
+			a.mu.Unlock()
+			return
+		}
+		var w = a.pending[0]
+		a.pending = a.pending[1:]
+		a.mu.Unlock()
+
+		w.aa.AppendResult = journal.AppendResult{
+			Error:      errorForStatus(resp.Status, resp.Error),
+			WriteHead:  resp.WriteHead,
+			RouteToken: resp.RouteToken,
+		}
+		if w.aa.Error == nil {
+			w.aa.Begin, w.aa.End = resp.WriteHead-w.size, resp.WriteHead
+		}
+		close(w.aa.Ready)
+		<-a.slots
+	}
+}
@@ -0,0 +1,180 @@
+package gazette
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+
+	gc "github.com/go-check/check"
+	"google.golang.org/grpc"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type StreamAppenderSuite struct {
+	mu      sync.Mutex
+	content map[journal.Name]string
+	// Results of appends, which resolve only when released.
+	results chan func()
+}
+
+func (s *StreamAppenderSuite) SetUpTest(c *gc.C) {
+	s.content = make(map[journal.Name]string)
+	s.results = make(chan func(), 100)
+}
+
+func (s *StreamAppenderSuite) TestPipelinedAppendsAreAcknowledgedInOrder(c *gc.C) {
+	var appender, serveErrCh = s.start()
+
+	var buf = []byte("one")
+	var first, err = appender.Write("a/journal", buf)
+	c.Check(err, gc.IsNil)
+	copy(buf, "XXX") // |buf| may be re-used once Write returns.
+
+	second, err := appender.Write("b/journal", []byte("two"))
+	c.Check(err, gc.IsNil)
+	third, err := appender.Write("not/broker", []byte("three"))
+	c.Check(err, gc.IsNil)
+	fourth, err := appender.Write("a/journal", []byte("four"))
+	c.Check(err, gc.IsNil)
+
+	// Complete appends out of order. Acknowledgements are still in order.
+	var completions []func()
+	for i := 0; i != 4; i++ {
+		completions = append(completions, <-s.results)
+	}
+	completions[3]()
+	completions[1]()
+
+	select {
+	case <-second.Ready:
+		c.Error("expected |second| to wait for |first|")
+	default:
+	}
+	completions[0]()
+	completions[2]()
+
+	for _, aa := range []*journal.AsyncAppend{first, second, third, fourth} {
+		<-aa.Ready
+	}
+	c.Check(first.AppendResult, gc.DeepEquals, journal.AppendResult{WriteHead: 3})
+	c.Check(second.AppendResult, gc.DeepEquals, journal.AppendResult{WriteHead: 3})
+	c.Check(third.AppendResult, gc.DeepEquals, journal.AppendResult{
+		Error:      journal.ErrNotBroker,
+		RouteToken: "http://broker",
+	})
+	c.Check(fourth.AppendResult, gc.DeepEquals, journal.AppendResult{WriteHead: 7})
+
+	// Successful writes resolve with their journal region.
+	c.Check([]int64{first.Begin, first.End, fourth.Begin, fourth.End},
+		gc.DeepEquals, []int64{0, 3, 3, 7})
+	c.Check(second.Journal, gc.Equals, journal.Name("b/journal"))
+	c.Check([]int64{second.Begin, second.End}, gc.DeepEquals, []int64{0, 3})
+
+	c.Check(s.content, gc.DeepEquals, map[journal.Name]string{
+		"a/journal": "onefour",
+		"b/journal": "two",
+	})
+
+	c.Check(appender.Close(), gc.IsNil)
+	c.Check(<-serveErrCh, gc.IsNil)
+
+	// Further writes fail.
+	_, err = appender.Write("a/journal", []byte("five"))
+	c.Check(err, gc.Equals, ErrStreamAppenderClosed)
+}
+
+func (s *StreamAppenderSuite) TestStatusRoundTrip(c *gc.C) {
+	for status := range Status_name {
+		var err = errorForStatus(Status(status), "some description")
+		var out, desc = statusForError(err)
+		c.Check(out, gc.Equals, Status(status))
+
+		if Status(status) == Status_INTERNAL_ERROR {
+			c.Check(desc, gc.Equals, "some description")
+		}
+	}
+}
+
+// start serves a StreamAppend RPC of the suite, and returns a StreamAppender
+// of it, and a channel of the RPC result.
+func (s *StreamAppenderSuite) start() (*StreamAppender, <-chan error) {
+	var reqCh = make(chan *StreamAppendRequest, 10)
+	var respCh = make(chan *StreamAppendResponse, 10)
+	var serveErrCh = make(chan error, 1)
+
+	var api = &BrokerAPI{handler: s}
+	go func() {
+		serveErrCh <- api.StreamAppend(&streamAppendServerFixture{reqCh: reqCh, respCh: respCh})
+		close(respCh)
+	}()
+	return newStreamAppender(&streamAppendClientFixture{reqCh: reqCh, respCh: respCh}), serveErrCh
+}
+
+func (s *StreamAppenderSuite) Append(op journal.AppendOp) {
+	var content, _ = ioutil.ReadAll(op.Content)
+
+	if op.Journal == "not/broker" {
+		s.results <- func() {
+			op.Result <- journal.AppendResult{Error: journal.ErrNotBroker, RouteToken: "http://broker"}
+		}
+		return
+	}
+
+	// Like a broker, appends of a journal are applied in dispatch order.
+	s.mu.Lock()
+	s.content[op.Journal] += string(content)
+	var head = int64(len(s.content[op.Journal]))
+	s.mu.Unlock()
+
+	s.results <- func() { op.Result <- journal.AppendResult{WriteHead: head} }
+}
+
+func (s *StreamAppenderSuite) Read(op journal.ReadOp)           { panic("not expected") }
+func (s *StreamAppenderSuite) Replicate(op journal.ReplicateOp) { panic("not expected") }
+
+type streamAppendServerFixture struct {
+	grpc.ServerStream
+	reqCh  <-chan *StreamAppendRequest
+	respCh chan<- *StreamAppendResponse
+}
+
+func (s *streamAppendServerFixture) Recv() (*StreamAppendRequest, error) {
+	if req, ok := <-s.reqCh; ok {
+		return req, nil
+	}
+	return nil, io.EOF
+}
+
+func (s *streamAppendServerFixture) Send(resp *StreamAppendResponse) error {
+	s.respCh <- resp
+	return nil
+}
+
+type streamAppendClientFixture struct {
+	grpc.ClientStream
+	reqCh  chan<- *StreamAppendRequest
+	respCh <-chan *StreamAppendResponse
+}
+
+func (s *streamAppendClientFixture) Send(req *StreamAppendRequest) error {
+	// Like gRPC, |req| is marshalled before Send returns.
+	var cp = *req
+	cp.Content = append([]byte(nil), req.Content...)
+	s.reqCh <- &cp
+	return nil
+}
+
+func (s *streamAppendClientFixture) CloseSend() error {
+	close(s.reqCh)
+	return nil
+}
+
+func (s *streamAppendClientFixture) Recv() (*StreamAppendResponse, error) {
+	if resp, ok := <-s.respCh; ok {
+		return resp, nil
+	}
+	return nil, io.EOF
+}
+
+var _ = gc.Suite(&StreamAppenderSuite{})
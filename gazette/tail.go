@@ -0,0 +1,162 @@
+package gazette
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/topic"
+)
+
+// Interval after which Tail reads of expected content return EOF, rather
+// than blocking, should content be unexpectedly missing.
+const tailEOFTimeout = 5 * time.Second
+
+// Tail returns up to the last |n| frames of journal |name|, decoded using
+// |framing| and ordered on ascending offset. Tail is intended for inspection
+// of recent journal content (eg, when debugging), and avoids reading from the
+// beginning of the journal: it determines the journal write head, and reads
+// backward from it one Fragment at a time until |n| frames are collected or
+// the first available offset of the journal is reached.
+//
+// A Fragment needn't begin on a frame boundary, and frames parsed from its
+// beginning may be de-synchronized. Frames are returned only once confirmed:
+// either their parse began at the first offset of the journal (which is
+// presumed to begin a frame), or a parse beginning at the preceding Fragment
+// re-synchronized with them. Returned frames are copies, and remain valid.
+func (c *Client) Tail(name journal.Name, n int, framing topic.Framing) ([][]byte, error) {
+	return tailFrames(c, name, n, framing)
+}
+
+// tailClient is the subset of Client used by tailFrames.
+type tailClient interface {
+	journal.Getter
+	journal.Header
+}
+
+func tailFrames(client tailClient, name journal.Name, n int, framing topic.Framing) ([][]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	var head, _ = client.Head(journal.ReadArgs{Journal: name, Offset: 0})
+
+	// The journal may not begin at offset zero, if content has been removed.
+	var floor int64
+	if head.Error == nil {
+		floor = head.Offset
+	} else if head.Error != journal.ErrNotYetAvailable {
+		return nil, head.Error
+	}
+
+	// |frames| are confirmed frames, beginning at frame boundary |boundary|
+	// (initially the write head). |pending| are offsets of unconfirmed frames
+	// of the previous parse, which precede |boundary|.
+	var frames [][]byte
+	var pending []int64
+	var boundary, lookup = head.WriteHead, head.WriteHead
+
+	for len(frames) < n && lookup > floor {
+		var begin int64
+
+		if result, _ := client.Head(journal.ReadArgs{Journal: name, Offset: lookup - 1}); result.Error != nil {
+			return nil, result.Error
+		} else {
+			begin = result.Fragment.Begin
+		}
+		if begin < floor {
+			begin = floor
+		}
+
+		var parsed, offsets, err = readFrames(client, name, begin, boundary, framing)
+		if err != nil {
+			return nil, err
+		}
+
+		// Frames parsed from the first offset of the journal are synchronized.
+		// Otherwise, find the first frame at which this parse agrees with the
+		// previous one: it and all following frames are on frame boundaries.
+		var confirm = len(parsed)
+		if begin == floor {
+			confirm = 0
+		} else {
+			for i, offset := range offsets {
+				if containsOffset(pending, offset) {
+					confirm = i
+					break
+				}
+			}
+		}
+
+		if confirm != len(parsed) {
+			frames = append(parsed[confirm:len(parsed):len(parsed)], frames...)
+			boundary = offsets[confirm]
+		}
+		pending = offsets[:confirm]
+		lookup = begin
+	}
+
+	if len(frames) > n {
+		frames = frames[len(frames)-n:]
+	}
+	return frames, nil
+}
+
+// containsOffset returns whether ascending |offsets| includes |offset|.
+func containsOffset(offsets []int64, offset int64) bool {
+	var i = sort.Search(len(offsets), func(i int) bool { return offsets[i] >= offset })
+	return i != len(offsets) && offsets[i] == offset
+}
+
+// readFrames returns copies of frames of journal |name| within [begin, end),
+// as well as the offset at which each frame begins.
+func readFrames(client journal.Getter, name journal.Name, begin, end int64,
+	framing topic.Framing) ([][]byte, []int64, error) {
+
+	var rr = journal.NewRetryReader(journal.NewMark(name, begin), client)
+	defer rr.Close()
+
+	rr.EOFTimeout = tailEOFTimeout
+
+	var cr = &countingReader{r: io.LimitReader(rr, end-begin)}
+	var br = bufio.NewReader(cr)
+
+	var frames [][]byte
+	var offsets []int64
+
+	for {
+		// Offset of the next frame is that of content read from |cr|, less
+		// content which remains buffered by |br|.
+		var offset = begin + cr.n - int64(br.Buffered())
+
+		var frame, err = framing.Unpack(br)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// A partial frame at |end| can occur only of a de-synchronized parse.
+			return frames, offsets, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+		frames = append(frames, append([]byte(nil), frame...))
+		offsets = append(offsets, offset)
+	}
+}
+
+// countingReader counts bytes read from the wrapped Reader. Reads fill |p|
+// unless an error is encountered, such that reads of de-synchronized content
+// aren't aligned to Fragment boundaries, and parses beginning at different
+// offsets don't spuriously agree on the offsets of leading, jumbled frames.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	var n, err = io.ReadFull(c.r, p)
+	c.n += int64(n)
+
+	if err == io.ErrUnexpectedEOF {
+		err = nil // Returned again (as io.EOF) by the next Read.
+	}
+	return n, err
+}
@@ -0,0 +1,180 @@
+package gazette
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+
+	gc "github.com/go-check/check"
+
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/topic"
+)
+
+type TailSuite struct{}
+
+func (s *TailSuite) TestTailWithinSingleFragment(c *gc.C) {
+	var content, _ = tailFixture(c, 5, 16)
+	var client = &fragmentedJournal{content: content, bounds: []int64{0, int64(len(content))}}
+
+	var frames, err = tailFrames(client, tailJournal, 2, topic.FixedFraming)
+	c.Check(err, gc.IsNil)
+	c.Check(tailPayloads(c, frames), gc.DeepEquals, []string{"message-3", "message-4"})
+}
+
+func (s *TailSuite) TestTailAcrossUnalignedFragments(c *gc.C) {
+	var content, offsets = tailFixture(c, 8, 16)
+
+	// Fragments begin in the middle of frames, including the final Fragment.
+	var client = &fragmentedJournal{content: content, bounds: []int64{
+		0, offsets[2] + 3, offsets[5] + 7, offsets[7] + 1, int64(len(content))}}
+
+	var frames, err = tailFrames(client, tailJournal, 1, topic.FixedFraming)
+	c.Check(err, gc.IsNil)
+	c.Check(tailPayloads(c, frames), gc.DeepEquals, []string{"message-7"})
+
+	frames, err = tailFrames(client, tailJournal, 4, topic.FixedFraming)
+	c.Check(err, gc.IsNil)
+	c.Check(tailPayloads(c, frames), gc.DeepEquals,
+		[]string{"message-4", "message-5", "message-6", "message-7"})
+
+	// Reading more frames than exist returns all frames of the journal.
+	frames, err = tailFrames(client, tailJournal, 100, topic.FixedFraming)
+	c.Check(err, gc.IsNil)
+	c.Check(frames, gc.HasLen, 8)
+	c.Check(tailPayloads(c, frames)[0], gc.Equals, "message-0")
+}
+
+func (s *TailSuite) TestTailOfFrameSpanningFragments(c *gc.C) {
+	var content, offsets = tailFixture(c, 3, 10000)
+
+	// The last frame spans several Fragments, each larger than the buffer
+	// of a bufio.Reader.
+	var client = &fragmentedJournal{content: content, bounds: []int64{
+		0, offsets[1] + 11, offsets[2] + 100, offsets[2] + 5000, offsets[2] + 9000,
+		int64(len(content))}}
+
+	var frames, err = tailFrames(client, tailJournal, 2, topic.FixedFraming)
+	c.Check(err, gc.IsNil)
+	c.Check(tailPayloads(c, frames), gc.DeepEquals, []string{"message-1", "message-2"})
+}
+
+func (s *TailSuite) TestTailFromRemovedContent(c *gc.C) {
+	var content, offsets = tailFixture(c, 6, 16)
+
+	// Content prior to |offsets[2]| has been removed.
+	var client = &fragmentedJournal{content: content, bounds: []int64{
+		offsets[2], offsets[4] + 2, int64(len(content))}}
+
+	var frames, err = tailFrames(client, tailJournal, 10, topic.FixedFraming)
+	c.Check(err, gc.IsNil)
+	c.Check(tailPayloads(c, frames), gc.DeepEquals,
+		[]string{"message-2", "message-3", "message-4", "message-5"})
+}
+
+func (s *TailSuite) TestTailOfEmptyJournal(c *gc.C) {
+	var frames, err = tailFrames(&fragmentedJournal{}, tailJournal, 3, topic.FixedFraming)
+	c.Check(err, gc.IsNil)
+	c.Check(frames, gc.IsNil)
+}
+
+func (s *TailSuite) TestHeadErrorIsReturned(c *gc.C) {
+	var client = &fragmentedJournal{err: journal.ErrNotFound}
+
+	var _, err = tailFrames(client, tailJournal, 3, topic.FixedFraming)
+	c.Check(err, gc.Equals, journal.ErrNotFound)
+}
+
+const tailJournal journal.Name = "a/tailed/journal"
+
+// tailMessage is a fixed-frameable message of a string, padded to a length.
+type tailMessage struct {
+	content string
+	length  int
+}
+
+func (m tailMessage) Size() int { return m.length }
+func (m tailMessage) MarshalTo(b []byte) (int, error) {
+	var n = copy(b, m.content)
+	for ; n != m.length; n++ {
+		b[n] = ' '
+	}
+	return n, nil
+}
+
+// tailFixture returns |count| fixed frames of |length| payload bytes, and
+// the offset at which each frame begins.
+func tailFixture(c *gc.C, count, length int) ([]byte, []int64) {
+	var content []byte
+	var offsets []int64
+
+	for i := 0; i != count; i++ {
+		offsets = append(offsets, int64(len(content)))
+
+		var err error
+		content, err = topic.FixedFraming.Encode(
+			tailMessage{content: "message-" + strconv.Itoa(i), length: length}, content)
+		c.Assert(err, gc.IsNil)
+	}
+	return content, offsets
+}
+
+// tailPayloads returns trimmed payloads of fixed |frames|.
+func tailPayloads(c *gc.C, frames [][]byte) []string {
+	var out []string
+	for _, frame := range frames {
+		var payload, err = topic.FixedFramePayload(frame)
+		c.Assert(err, gc.IsNil)
+		out = append(out, string(bytes.TrimRight(payload, " ")))
+	}
+	return out
+}
+
+// fragmentedJournal is a journal.Getter and journal.Header of |content|,
+// having Fragments with |bounds|. Content before bounds[0] was removed.
+type fragmentedJournal struct {
+	content []byte
+	bounds  []int64
+	err     error
+}
+
+func (j *fragmentedJournal) result(args journal.ReadArgs) journal.ReadResult {
+	var writeHead = int64(len(j.content))
+
+	if j.err != nil {
+		return journal.ReadResult{Error: j.err}
+	} else if args.Offset == 0 && len(j.bounds) != 0 {
+		args.Offset = j.bounds[0]
+	}
+	for i := 1; i < len(j.bounds); i++ {
+		if args.Offset >= j.bounds[i-1] && args.Offset < j.bounds[i] {
+			return journal.ReadResult{
+				Offset:    args.Offset,
+				WriteHead: writeHead,
+				Fragment: journal.Fragment{
+					Journal: args.Journal,
+					Begin:   j.bounds[i-1],
+					End:     j.bounds[i],
+				},
+			}
+		}
+	}
+	return journal.ReadResult{Error: journal.ErrNotYetAvailable, WriteHead: writeHead}
+}
+
+func (j *fragmentedJournal) Head(args journal.ReadArgs) (journal.ReadResult, *url.URL) {
+	return j.result(args), nil
+}
+
+func (j *fragmentedJournal) Get(args journal.ReadArgs) (journal.ReadResult, io.ReadCloser) {
+	var result = j.result(args)
+	if result.Error != nil {
+		return result, nil
+	}
+	return result, ioutil.NopCloser(
+		bytes.NewReader(j.content[result.Offset:result.Fragment.End]))
+}
+
+var _ = gc.Suite(&TailSuite{})
@@ -0,0 +1,128 @@
+package gazette
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// NewClientTLSConfig returns a tls.Config of Gazette clients. If |certFile|
+// and |keyFile| are non-empty, the PEM-encoded certificate and key they name
+// are presented to servers which require client authentication (mutual TLS).
+// If |caFile| is non-empty, servers are verified against the PEM-encoded CA
+// bundle it names, rather than the system roots.
+func NewClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	var config = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if certFile != "" || keyFile != "" {
+		var cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		var pool, err = loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// NewServerTLSConfig returns a tls.Config of Gazette servers, which present
+// the PEM-encoded certificate and key of |certFile| and |keyFile|. If
+// |clientCAFile| is non-empty, clients must present a certificate which
+// verifies against the PEM-encoded CA bundle it names (mutual TLS).
+func NewServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	var cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	var config = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if clientCAFile != "" {
+		var pool, err = loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// NewClientWithTLS returns a Client as NewClientWithEndpoints, which uses
+// |config| for https:// |endpoints| (and https:// routes of brokers). A nil
+// |config| uses the default TLS configuration.
+func NewClientWithTLS(endpoints []string, config *tls.Config) (*Client, error) {
+	var transport = MakeHttpTransport()
+	transport.TLSClientConfig = config
+
+	return NewClientWithEndpoints(endpoints, &http.Client{Transport: transport})
+}
+
+// SetReplicateClientTLS sets the tls.Config used by ReplicateClients to
+// connect to https:// peer endpoints. Brokers which serve their API over TLS
+// (and require client certificates) must set a configuration which verifies,
+// and is verified by, their peers. A nil |config| uses the default TLS
+// configuration.
+func SetReplicateClientTLS(config *tls.Config) {
+	replicateTLSMu.Lock()
+	replicateTLSConfig = config
+	replicateTLSMu.Unlock()
+}
+
+// dialReplicaTLS performs a TLS handshake over |raw|, a connection to |addr|.
+func dialReplicaTLS(raw net.Conn, addr string) (net.Conn, error) {
+	replicateTLSMu.Lock()
+	var config = replicateTLSConfig
+	replicateTLSMu.Unlock()
+
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		} else {
+			config.ServerName = addr
+		}
+	}
+
+	var conn = tls.Client(raw, config)
+	if err := conn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// loadCertPool loads PEM-encoded certificates of |path| into a CertPool.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	var pem, err = ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+var (
+	// TLS configuration of ReplicateClient connections. See SetReplicateClientTLS.
+	replicateTLSConfig *tls.Config
+	replicateTLSMu     sync.Mutex
+)
@@ -0,0 +1,179 @@
+package gazette
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	gc "github.com/go-check/check"
+)
+
+type TLSSuite struct {
+	dir string
+}
+
+func (s *TLSSuite) SetUpTest(c *gc.C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "tls-suite")
+	c.Assert(err, gc.IsNil)
+
+	// Build a CA, and server and client certificates signed by it.
+	var caKey, caCert = s.issue(c, "ca", nil, nil)
+	s.issue(c, "server", caKey, caCert)
+	s.issue(c, "client", caKey, caCert)
+	// A client certificate which is self-signed, rather than signed by the CA.
+	s.issue(c, "other", nil, nil)
+}
+
+func (s *TLSSuite) TearDownTest(c *gc.C) {
+	os.RemoveAll(s.dir)
+}
+
+func (s *TLSSuite) TestMutualAuthentication(c *gc.C) {
+	var serverConfig, err = NewServerTLSConfig(s.path("server.crt"), s.path("server.key"), s.path("ca.crt"))
+	c.Assert(err, gc.IsNil)
+	c.Check(serverConfig.ClientAuth, gc.Equals, tls.RequireAndVerifyClientCert)
+
+	clientConfig, err := NewClientTLSConfig(s.path("client.crt"), s.path("client.key"), s.path("ca.crt"))
+	c.Assert(err, gc.IsNil)
+	c.Check(s.handshake(c, serverConfig, clientConfig), gc.IsNil)
+
+	// A client without a certificate is rejected.
+	clientConfig, err = NewClientTLSConfig("", "", s.path("ca.crt"))
+	c.Assert(err, gc.IsNil)
+	c.Check(s.handshake(c, serverConfig, clientConfig), gc.NotNil)
+
+	// As is a client having a certificate not signed by the CA.
+	clientConfig, err = NewClientTLSConfig(s.path("other.crt"), s.path("other.key"), s.path("ca.crt"))
+	c.Assert(err, gc.IsNil)
+	c.Check(s.handshake(c, serverConfig, clientConfig), gc.NotNil)
+
+	// Without a client CA, client certificates are not required.
+	serverConfig, err = NewServerTLSConfig(s.path("server.crt"), s.path("server.key"), "")
+	c.Assert(err, gc.IsNil)
+	clientConfig, err = NewClientTLSConfig("", "", s.path("ca.crt"))
+	c.Assert(err, gc.IsNil)
+	c.Check(s.handshake(c, serverConfig, clientConfig), gc.IsNil)
+}
+
+func (s *TLSSuite) TestReplicaDialUsesClientConfig(c *gc.C) {
+	var serverConfig, err = NewServerTLSConfig(s.path("server.crt"), s.path("server.key"), s.path("ca.crt"))
+	c.Assert(err, gc.IsNil)
+	clientConfig, err := NewClientTLSConfig(s.path("client.crt"), s.path("client.key"), s.path("ca.crt"))
+	c.Assert(err, gc.IsNil)
+
+	defer SetReplicateClientTLS(nil)
+	SetReplicateClientTLS(clientConfig)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	c.Assert(err, gc.IsNil)
+	defer listener.Close()
+	var serverErrCh = s.accept(listener)
+
+	raw, err := net.Dial("tcp", listener.Addr().String())
+	c.Assert(err, gc.IsNil)
+
+	conn, err := dialReplicaTLS(raw, listener.Addr().String())
+	c.Assert(err, gc.IsNil)
+	c.Check(<-serverErrCh, gc.IsNil)
+	conn.Close()
+}
+
+func (s *TLSSuite) TestLoadErrors(c *gc.C) {
+	var _, err = NewClientTLSConfig("", "", s.path("does-not-exist"))
+	c.Check(err, gc.NotNil)
+
+	c.Assert(ioutil.WriteFile(s.path("empty.crt"), []byte("not a PEM"), 0600), gc.IsNil)
+	_, err = NewClientTLSConfig("", "", s.path("empty.crt"))
+	c.Check(err, gc.ErrorMatches, "no certificates found in .*")
+
+	_, err = NewServerTLSConfig(s.path("server.crt"), s.path("client.key"), "")
+	c.Check(err, gc.NotNil) // Mismatched key.
+}
+
+// handshake performs a TLS handshake of |client| with a server of |server|,
+// and returns the server's handshake error.
+func (s *TLSSuite) handshake(c *gc.C, server, client *tls.Config) error {
+	var listener, err = tls.Listen("tcp", "127.0.0.1:0", server)
+	c.Assert(err, gc.IsNil)
+	defer listener.Close()
+
+	var serverErrCh = s.accept(listener)
+
+	client = client.Clone()
+	client.ServerName = "127.0.0.1"
+
+	if conn, err := tls.Dial("tcp", listener.Addr().String(), client); err == nil {
+		defer conn.Close()
+	}
+	return <-serverErrCh
+}
+
+// accept accepts a single connection of |listener|, and returns a channel of
+// its handshake result.
+func (s *TLSSuite) accept(listener net.Listener) <-chan error {
+	var errCh = make(chan error, 1)
+
+	go func() {
+		var conn, err = listener.Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer conn.Close()
+		errCh <- conn.(*tls.Conn).Handshake()
+	}()
+	return errCh
+}
+
+func (s *TLSSuite) path(name string) string { return filepath.Join(s.dir, name) }
+
+// issue generates a certificate and key of |name| for 127.0.0.1, signed by
+// |parentKey| and |parent|, or self-signed (as a CA) if |parent| is nil.
+func (s *TLSSuite) issue(c *gc.C, name string, parentKey *ecdsa.PrivateKey,
+	parent *x509.Certificate) (*ecdsa.PrivateKey, *x509.Certificate) {
+
+	var key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, gc.IsNil)
+
+	var template = &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	c.Assert(err, gc.IsNil)
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, gc.IsNil)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, gc.IsNil)
+
+	c.Assert(ioutil.WriteFile(s.path(name+".crt"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600), gc.IsNil)
+	c.Assert(ioutil.WriteFile(s.path(name+".key"),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600), gc.IsNil)
+
+	return key, cert
+}
+
+var _ = gc.Suite(&TLSSuite{})
@@ -0,0 +1,67 @@
+package gazette
+
+import (
+	"net/http"
+)
+
+// TokenProvider returns a bearer token to be attached to Client requests.
+// |refresh| is true if a previously provided token was rejected by the server,
+// and a fresh token should be obtained.
+type TokenProvider func(refresh bool) (string, error)
+
+// SetBearerToken attaches a static bearer |token| to all broker requests
+// (including those of a WriteService using the Client). Requests which are
+// rejected by the server fail with journal.ErrUnauthorized.
+func (c *Client) SetBearerToken(token string) {
+	c.tokenProvider = func(bool) (string, error) { return token, nil }
+	c.tokenRefresh = false
+}
+
+// SetTokenProvider attaches bearer tokens obtained from |provider| to all
+// broker requests (including those of a WriteService using the Client).
+// |provider| is invoked for each request. If a request is rejected by the
+// server, |provider| is given one chance to refresh its token and the request
+// is retried, before failing with journal.ErrUnauthorized.
+func (c *Client) SetTokenProvider(provider TokenProvider) {
+	c.tokenProvider = provider
+	c.tokenRefresh = true
+}
+
+// authorize attaches a bearer token to |request|, if a TokenProvider is set.
+func (c *Client) authorize(request *http.Request, refresh bool) error {
+	if c.tokenProvider == nil {
+		return nil
+	}
+	if token, err := c.tokenProvider(refresh); err != nil {
+		return err
+	} else {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// retryUnauthorized retries |request| with a refreshed token, if the request
+// was rejected with |response| and a refresh-able TokenProvider is set.
+// Otherwise, |response| is returned unmodified.
+func (c *Client) retryUnauthorized(request *http.Request,
+	response *http.Response) (*http.Response, error) {
+
+	if !c.tokenRefresh {
+		return response, nil
+	} else if request.Body != nil && request.GetBody == nil {
+		return response, nil // Request body cannot be re-played.
+	}
+	response.Body.Close()
+
+	if request.GetBody != nil {
+		if body, err := request.GetBody(); err != nil {
+			return nil, err
+		} else {
+			request.Body = body
+		}
+	}
+	if err := c.authorize(request, true); err != nil {
+		return nil, err
+	}
+	return c.httpClient.Do(request)
+}
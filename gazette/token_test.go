@@ -0,0 +1,81 @@
+package gazette
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	gc "github.com/go-check/check"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type TokenSuite struct {
+	client *Client
+	mock   *mockHttpClient
+}
+
+func (s *TokenSuite) SetUpTest(c *gc.C) {
+	gazetteMap.Init()
+
+	var err error
+	s.client, err = NewClient("http://default")
+	c.Assert(err, gc.IsNil)
+
+	s.mock = &mockHttpClient{}
+	s.client.httpClient = s.mock
+	s.client.locationCache.Add("/a/journal", newURL("http://default/a/journal"))
+}
+
+func (s *TokenSuite) TestProviderRefreshAndRetry(c *gc.C) {
+	var calls []bool
+	s.client.SetTokenProvider(func(refresh bool) (string, error) {
+		calls = append(calls, refresh)
+		if refresh {
+			return "fresh-token", nil
+		}
+		return "stale-token", nil
+	})
+
+	s.expectPut(c, "Bearer stale-token", http.StatusUnauthorized)
+	s.expectPut(c, "Bearer fresh-token", http.StatusNoContent)
+
+	var result = s.client.Put(journal.AppendArgs{
+		Journal: "a/journal",
+		Content: strings.NewReader("content"),
+	})
+	c.Check(result.Error, gc.IsNil)
+	c.Check(calls, gc.DeepEquals, []bool{false, true})
+
+	s.mock.AssertExpectations(c)
+}
+
+func (s *TokenSuite) TestStaticTokenIsNotRetried(c *gc.C) {
+	s.client.SetBearerToken("a-token")
+	s.expectPut(c, "Bearer a-token", http.StatusUnauthorized)
+
+	var result = s.client.Put(journal.AppendArgs{
+		Journal: "a/journal",
+		Content: strings.NewReader("content"),
+	})
+	c.Check(result.Error, gc.Equals, journal.ErrUnauthorized)
+
+	s.mock.AssertExpectations(c)
+}
+
+func (s *TokenSuite) expectPut(c *gc.C, authorization string, status int) {
+	s.mock.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT" &&
+			request.Header.Get("Authorization") == authorization
+	})).Return(&http.Response{
+		StatusCode: status,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Run(func(args mock.Arguments) {
+		// Expect the complete request body is (re-)played.
+		content, _ := ioutil.ReadAll(args[0].(*http.Request).Body)
+		c.Check(string(content), gc.Equals, "content")
+	}).Once()
+}
+
+var _ = gc.Suite(&TokenSuite{})
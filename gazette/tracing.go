@@ -0,0 +1,46 @@
+package gazette
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Tracer instruments Client requests with distributed tracing spans. It
+// adapts a tracing implementation (eg, OpenTelemetry) to the Client, which
+// doesn't itself depend on one.
+type Tracer interface {
+	// StartSpan starts a span |name| of |request|, as a child of any trace
+	// carried by request.Context(). The Tracer should inject the context of the
+	// span into request.Header, so that the broker may continue the trace.
+	// |attributes| describe the request, and include its "journal" and (if
+	// present) "offset".
+	StartSpan(request *http.Request, name string, attributes map[string]string) TraceSpan
+}
+
+// TraceSpan is an in-progress span started by a Tracer.
+type TraceSpan interface {
+	// Finish ends the span with the |response| or |err| of its request. Note
+	// that for reads, the span ends upon receiving response headers and does
+	// not include streaming of the response body.
+	Finish(response *http.Response, err error)
+}
+
+// SetTracer enables tracing of Client requests (including those of a
+// WriteService or reader using the Client) by |tracer|. By default, requests
+// are not traced. SetTracer must be called before the Client is used.
+func (c *Client) SetTracer(tracer Tracer) {
+	c.tracer = tracer
+}
+
+// startSpan starts a span of |request| if a Tracer is set, or returns nil.
+func (c *Client) startSpan(request *http.Request, path string) TraceSpan {
+	if c.tracer == nil {
+		return nil
+	}
+	var attributes = map[string]string{"journal": strings.TrimPrefix(path, "/")}
+
+	if offset := request.URL.Query().Get("offset"); offset != "" {
+		attributes["offset"] = offset
+	}
+	return c.tracer.StartSpan(request, "gazette."+strings.ToLower(request.Method), attributes)
+}
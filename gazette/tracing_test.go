@@ -0,0 +1,97 @@
+package gazette
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	gc "github.com/go-check/check"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type TracingSuite struct{}
+
+type testSpan struct {
+	name       string
+	attributes map[string]string
+	parent     interface{}
+	status     int
+	err        error
+}
+
+type testTracer struct{ spans []*testSpan }
+
+func (t *testTracer) StartSpan(request *http.Request, name string, attributes map[string]string) TraceSpan {
+	var span = &testSpan{
+		name:       name,
+		attributes: attributes,
+		parent:     request.Context().Value("trace"),
+	}
+	request.Header.Set("X-Test-Trace", name)
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func (s *testSpan) Finish(response *http.Response, err error) {
+	if response != nil {
+		s.status = response.StatusCode
+	}
+	s.err = err
+}
+
+func (s *TracingSuite) TestRequestsAreTraced(c *gc.C) {
+	gazetteMap.Init()
+
+	var mockClient = &mockHttpClient{}
+	client, err := NewClient("http://default")
+	c.Assert(err, gc.IsNil)
+	client.httpClient = mockClient
+	client.locationCache.Add("/a/journal", newURL("http://default/a/journal"))
+
+	var tracer = new(testTracer)
+	client.SetTracer(tracer)
+
+	// Expect the trace context is propagated in request headers.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "HEAD" &&
+			request.Header.Get("X-Test-Trace") == "gazette.head"
+	})).Return(&http.Response{
+		StatusCode: http.StatusRequestedRangeNotSatisfiable,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Once()
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT" &&
+			request.Header.Get("X-Test-Trace") == "gazette.put"
+	})).Return(nil, context.DeadlineExceeded).Once()
+
+	var ctx = context.WithValue(context.Background(), "trace", "parent-trace")
+	var result, _ = client.head(ctx, journal.ReadArgs{Journal: "a/journal", Offset: 1234})
+	c.Check(result.Error, gc.Equals, journal.ErrNotYetAvailable)
+
+	var appendResult = client.Put(journal.AppendArgs{
+		Journal: "a/journal",
+		Content: strings.NewReader("content"),
+	})
+	c.Check(appendResult.Error, gc.Equals, context.DeadlineExceeded)
+
+	c.Check(tracer.spans, gc.DeepEquals, []*testSpan{
+		{
+			name:       "gazette.head",
+			attributes: map[string]string{"journal": "a/journal", "offset": "1234"},
+			parent:     "parent-trace",
+			status:     http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name:       "gazette.put",
+			attributes: map[string]string{"journal": "a/journal"},
+			err:        context.DeadlineExceeded,
+		},
+	})
+	mockClient.AssertExpectations(c)
+}
+
+var _ = gc.Suite(&TracingSuite{})
@@ -3,10 +3,12 @@ package gazette
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/metrics"
 )
 
 type WriteAPI struct {
@@ -22,6 +24,8 @@ func (h *WriteAPI) Register(router *mux.Router) {
 }
 
 func (h *WriteAPI) Write(w http.ResponseWriter, r *http.Request) {
+	var started = time.Now()
+
 	var op = journal.AppendOp{
 		AppendArgs: journal.AppendArgs{
 			Journal: journal.Name(r.URL.Path[1:]),
@@ -32,6 +36,9 @@ func (h *WriteAPI) Write(w http.ResponseWriter, r *http.Request) {
 	h.handler.Append(op)
 	result := <-op.Result
 
+	observeServerRequest("append", result.Error)
+	metrics.GazetteServerAppendDurationSeconds.Observe(time.Since(started).Seconds())
+
 	if result.WriteHead != 0 {
 		w.Header().Set(WriteHeadHeader, strconv.FormatInt(result.WriteHead, 10))
 	}
@@ -2,15 +2,25 @@ package gazette
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"flag"
+	"fmt"
 	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/hashicorp/golang-lru"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/LiveRamp/gazette/journal"
@@ -18,6 +28,18 @@ import (
 )
 
 var (
+	// ErrWriteServiceStopped is returned by writes to a stopped WriteService.
+	ErrWriteServiceStopped = errors.New("write service stopped")
+	// ErrWriteBufferFull is returned by writes to a WriteService having an
+	// ErrorOnFull OverflowPolicy, if its buffer limits are reached.
+	ErrWriteBufferFull = errors.New("write buffer full")
+	// ErrDrainTimeout is returned by Drain if pending writes did not complete
+	// within the timeout.
+	ErrDrainTimeout = errors.New("timeout draining pending writes")
+	// ErrAppendTimeout fails writes of an append which didn't complete within
+	// its timeout (see SetAppendTimeout), and further writes of its journal.
+	ErrAppendTimeout = errors.New("append timed out")
+
 	// Time to wait in between broker write errors. Exposed for debugging.
 	writeServiceCoolOffTimeout = time.Second * 5
 
@@ -30,17 +52,52 @@ var (
 const (
 	kMaxWriteSpoolSize = 1 << 27 // A single spool is up to 128MiB.
 	kWriteQueueSize    = 1024    // Allows a total of 128GiB of spooled writes.
+	// Number of write tokens retained by the WriteService.
+	kWriteTokenCacheSize = 1 << 14
 
 	// Local disk-backed temporary directory where pending writes are spooled.
 	gazetteWriteTmpDir = "/var/tmp/gazette-writes"
 )
 
+// OverflowPolicy determines the handling of writes to a WriteService which
+// has reached its buffer limits.
+type OverflowPolicy int
+
+const (
+	// BlockOnFull blocks the writer until buffered writes are acknowledged.
+	BlockOnFull OverflowPolicy = iota
+	// ErrorOnFull immediately fails the write with ErrWriteBufferFull.
+	ErrorOnFull
+)
+
 type pendingWrite struct {
 	journal journal.Name
 	file    *os.File
 	offset  int64
 	started time.Time
-	result  *journal.AsyncAppend
+	// Writes which have been appended to |file|.
+	writes []batchedWrite
+	// Timeout of the append of |file|, if overridden by a write. See
+	// WriteWithTimeout.
+	timeout time.Duration
+	// Whether |file| is a named file of a durable spool (see SetDurableSpool).
+	// Its content then follows a header recording the committed |offset|.
+	durable bool
+}
+
+// batchedWrite is a write of a pendingWrite, which spans content offsets
+// [begin, end) of the pendingWrite.
+type batchedWrite struct {
+	result     *journal.AsyncAppend
+	begin, end int64
+}
+
+// contentBase returns the offset of the write's content within |file|.
+func (p *pendingWrite) contentBase() int64 {
+	if p.durable {
+		return durableSpoolHeaderLen
+	}
+	return 0
 }
 
 var pendingWritePool = sync.Pool{
@@ -58,6 +115,14 @@ var pendingWritePool = sync.Pool{
 	}}
 
 func releasePendingWrite(p *pendingWrite) error {
+	if p.durable {
+		// Durable spool files are not re-used. Remove the file, as its content
+		// has been acknowledged (or has terminally failed).
+		if err := p.file.Close(); err != nil {
+			return err
+		}
+		return os.Remove(p.file.Name())
+	}
 	*p = pendingWrite{file: p.file}
 	if _, err := p.file.Seek(0, 0); err != nil {
 		return err
@@ -68,29 +133,119 @@ func releasePendingWrite(p *pendingWrite) error {
 
 func writeAllOrNone(write *pendingWrite, r io.Reader) error {
 	n, err := io.Copy(write.file, r)
+	if err == nil && write.durable {
+		err = commitDurableOffset(write.file, write.offset+n)
+	}
 	if err == nil {
 		write.offset += int64(n)
 	} else {
-		write.file.Seek(write.offset, 0)
+		write.file.Seek(write.contentBase()+write.offset, 0)
 	}
 	return err
 }
 
+// Durable spool files begin with a header of the committed content length.
+// Content beyond the committed length is from a partial write, and is ignored
+// on recovery.
+const durableSpoolHeaderLen = 8
+
+// commitDurableOffset records |offset| as the committed content length of
+// durable spool |file|.
+func commitDurableOffset(file *os.File, offset int64) error {
+	var header [durableSpoolHeaderLen]byte
+	binary.BigEndian.PutUint64(header[:], uint64(offset))
+
+	_, err := file.WriteAt(header[:], 0)
+	return err
+}
+
+// durableSpoolName returns the file name of durable spool sequence number
+// |seq| of journal |name|. Names sort in sequence order.
+func durableSpoolName(seq int64, name journal.Name) string {
+	return fmt.Sprintf("%016x.%s", seq, url.QueryEscape(name.String()))
+}
+
+// parseDurableSpoolName is the inverse of durableSpoolName.
+func parseDurableSpoolName(base string) (int64, journal.Name, error) {
+	var ind = strings.IndexByte(base, '.')
+	if ind == -1 {
+		return 0, "", fmt.Errorf("invalid spool file name: %s", base)
+	}
+	seq, err := strconv.ParseInt(base[:ind], 16, 64)
+	if err != nil {
+		return 0, "", err
+	}
+	name, err := url.QueryUnescape(base[ind+1:])
+	if err != nil {
+		return 0, "", err
+	}
+	return seq, journal.Name(name), journal.Name(name).Validate()
+}
+
 // WriteService wraps a Client to provide asynchronous batching and automatic retries
 // of writes to Gazette journals. Writes to each journal are spooled to local
 // disk (and never memory), so back-pressure from slow or down brokers does not
 // affect busy writers (at least, until disk runs out). Writes are retried
-// indefinitely, until aknowledged by a broker.
+// indefinitely, until aknowledged by a broker. By default spooled writes do not
+// survive the process; see SetDurableSpool.
 type WriteService struct {
-	client  *Client
-	stopped chan struct{} // Coordinates exit of service loops.
+	client *Client
+	// Whether |client| is closed once the WriteService stops.
+	ownsClient bool
+	// Number of running service loops, accessed atomically. |stopped| is
+	// closed when the last service loop exits.
+	running int64
+	stopped chan struct{}
 
 	// Concurrent write queues (defaults to *writeConcurrency).
 	writeQueue []chan *pendingWrite
 
+	// Bounds on the batching of writes to a journal. A pendingWrite accepts
+	// further writes until it reaches |maxBatchBytes|, and is held for up to
+	// |maxBatchDelay| after its first write before being sent to a broker.
+	maxBatchBytes int64
+	maxBatchDelay time.Duration
+
+	// Number of pendingWrite's which are queued or in-flight. Accessed atomically.
+	pending int64
+
+	// Limits on buffered bytes & pendingWrite's (zero is unlimited), the policy
+	// applied when they're reached, and the number of buffered bytes. Writers
+	// wait on |bufferCond| under the BlockOnFull policy.
+	maxBufferedBytes  int64
+	maxBufferedWrites int
+	overflowPolicy    OverflowPolicy
+	bufferedBytes     int64
+	bufferCond        *sync.Cond
+	// Guards the close of |writeQueue|. Writers hold a read-lock while
+	// enqueuing, and Stop or Drain take a write-lock to set |isStopped|.
+	stopMu    sync.RWMutex
+	isStopped bool
+
 	// Indexes pendingWrite's which are in |writeQueue|, and still append-able.
 	writeIndex   map[journal.Name]*pendingWrite
 	writeIndexMu sync.Mutex
+	// Journals which have terminally failed, and their errors. Guarded by
+	// |writeIndexMu|.
+	failedJournals map[journal.Name]error
+	// Maps appendTokens of WriteWithToken calls to their AsyncAppend. Guarded
+	// by |writeIndexMu|.
+	tokens *lru.Cache
+
+	// If non-zero, the number of failed attempts of a pendingWrite after
+	// which its journal is failed. |onJournalError| is notified of failures.
+	maxWriteAttempts int
+	onJournalError   func(journal.Name, error)
+	// If non-zero, the duration after which an append fails with
+	// ErrAppendTimeout.
+	appendTimeout time.Duration
+
+	// Optional callback of resolved writes. Resolutions are queued into
+	// |completions| by service loops, and delivered by serveCompletions.
+	onComplete     func(name journal.Name, offset int64, err error)
+	completions    []completion
+	completionCond *sync.Cond
+	completionDone bool
 
 	// RWMutex used in the following way:
 	// - Calls to obtainPendingWrite lock it for READ.
@@ -99,14 +254,32 @@ type WriteService struct {
 	//   block until the condition is resolved. The goroutine logs at ERROR
 	//   until the condition is resolved, so it is easy to diagnose.
 	diskUsageMu sync.RWMutex
+
+	// If non-empty, directory of the durable spool. |spoolSeq| is the last
+	// assigned spool file sequence number, and is accessed atomically.
+	spoolDir string
+	spoolSeq int64
+
+	// Logger of WriteService events. Defaults to the Client's logger.
+	logger log.FieldLogger
+	// Clock of batching delays and retry cool-offs.
+	clock journal.Clock
 }
 
 func NewWriteService(client *Client) *WriteService {
+	var tokens, _ = lru.New(kWriteTokenCacheSize) // Fails only for a non-positive size.
+
 	var writeService = &WriteService{
-		client:     client,
-		stopped:    make(chan struct{}),
-		writeQueue: nil,
-		writeIndex: make(map[journal.Name]*pendingWrite),
+		client:         client,
+		writeQueue:     nil,
+		writeIndex:     make(map[journal.Name]*pendingWrite),
+		failedJournals: make(map[journal.Name]error),
+		tokens:         tokens,
+		maxBatchBytes:  kMaxWriteSpoolSize,
+		bufferCond:     sync.NewCond(new(sync.Mutex)),
+		completionCond: sync.NewCond(new(sync.Mutex)),
+		logger:         client.logger,
+		clock:          journal.SystemClock,
 	}
 
 	writeService.SetConcurrency(*writeConcurrency)
@@ -116,12 +289,129 @@ func NewWriteService(client *Client) *WriteService {
 
 func (c *WriteService) SetConcurrency(concurrency int) {
 	c.writeQueue = make([]chan *pendingWrite, concurrency)
+	c.stopped = make(chan struct{})
 
 	for i := range c.writeQueue {
 		c.writeQueue[i] = make(chan *pendingWrite, kWriteQueueSize)
 	}
 }
 
+// SetBatchLimits bounds the batching of writes to a journal. Writes are
+// coalesced into a single append of up to |maxBytes| (defaults to 128MiB).
+// If |maxDelay| is non-zero, a batch is held for |maxDelay| after its first
+// write to accumulate further writes before it's sent to a broker (by default,
+// a batch is sent as soon as a service loop is available). Writes to a journal
+// are never re-ordered. SetBatchLimits must be called before Start.
+func (c *WriteService) SetBatchLimits(maxBytes int64, maxDelay time.Duration) {
+	c.maxBatchBytes = maxBytes
+	c.maxBatchDelay = maxDelay
+}
+
+// SetBufferLimits bounds the bytes and batched writes which may be buffered
+// by the WriteService and not yet acknowledged by a broker (zero values are
+// unlimited, which is the default). Limits are checked prior to each write:
+// once reached, further writes are handled per |policy|. SetBufferLimits must
+// be called before Start.
+func (c *WriteService) SetBufferLimits(maxBytes int64, maxWrites int, policy OverflowPolicy) {
+	c.maxBufferedBytes = maxBytes
+	c.maxBufferedWrites = maxWrites
+	c.overflowPolicy = policy
+}
+
+// SetClock sets the Clock used to time batching delays, retry cool-offs, and
+// Drain timeouts, in place of the system clock. It's intended for tests, which
+// may drive retries deterministically with a journal.ManualClock. SetClock
+// must be called before Start.
+func (c *WriteService) SetClock(clock journal.Clock) {
+	c.clock = clock
+}
+
+// SetOwnsClient determines whether the WriteService owns its Client, which
+// is intended for Clients created solely for use by the WriteService. An owned
+// Client is closed once the WriteService stops: upon the return of Stop, or
+// of a Drain which completed all pending writes. By default, the Client isn't
+// owned, and remains open. SetOwnsClient must be called before Start.
+func (c *WriteService) SetOwnsClient(owns bool) {
+	c.ownsClient = owns
+}
+
+// SetRetryLimit bounds the number of failed attempts of a batched write, after
+// which the journal is terminally failed: the batch and all further writes to
+// the journal fail with the last encountered error, until ClearJournalError is
+// called. |onError|, if non-nil, is invoked with the journal and error, and
+// must not block. By default, writes are retried indefinitely. SetRetryLimit
+// must be called before Start.
+func (c *WriteService) SetRetryLimit(maxAttempts int, onError func(journal.Name, error)) {
+	c.maxWriteAttempts = maxAttempts
+	c.onJournalError = onError
+}
+
+// SetAppendTimeout bounds the duration of each append to a broker. An append
+// which doesn't complete within |timeout| (eg, because the broker accepted the
+// connection but never responded) fails with ErrAppendTimeout, and the
+// WriteService moves on to other appends. Whether a timed-out append committed
+// is unknown, and it isn't retried. Instead its journal is terminally failed
+// as by SetRetryLimit: writes of the append and all further writes of the
+// journal fail with ErrAppendTimeout until ClearJournalError is called, and
+// the error handler of SetRetryLimit is notified. Writes of a journal are
+// therefore never silently re-ordered or skipped, which callers relying on
+// ordered resolution (such as consumer commit barriers) require. By default,
+// appends have no timeout. SetAppendTimeout must be called before Start.
+func (c *WriteService) SetAppendTimeout(timeout time.Duration) {
+	c.appendTimeout = timeout
+}
+
+// JournalError returns the error of a terminally failed journal, or nil.
+func (c *WriteService) JournalError(name journal.Name) error {
+	c.writeIndexMu.Lock()
+	defer c.writeIndexMu.Unlock()
+
+	return c.failedJournals[name]
+}
+
+// ClearJournalError clears the terminal failure of journal |name|, allowing
+// further writes to be made.
+func (c *WriteService) ClearJournalError(name journal.Name) {
+	c.writeIndexMu.Lock()
+	defer c.writeIndexMu.Unlock()
+
+	delete(c.failedJournals, name)
+}
+
+// SetCompletionCallback registers |fn| to be invoked as each write resolves,
+// with the journal, the journal offset at which the write's content ends (or
+// -1 on error), and the write's error (or nil). Writes batched into a single
+// append are each notified with their own offset, which may be checkpointed
+// as the end of the write's content. Invocations are made in
+// write order from a dedicated goroutine, such that a slow |fn| doesn't block
+// writes. SetCompletionCallback must be called before Start.
+func (c *WriteService) SetCompletionCallback(fn func(name journal.Name, offset int64, err error)) {
+	c.onComplete = fn
+}
+
+// SetDurableSpool spools pending writes to named files of directory |dir|,
+// which survive a crash of the process. Each file holds a batch of writes to a
+// single journal, and is removed once its append is acknowledged by a broker
+// (or terminally fails). Upon Start, files remaining from a prior process are
+// recovered and appended ahead of further writes, giving writers at-least-once
+// semantics across restarts: a write acknowledged by a broker just prior to a
+// crash may be appended again. Recovered writes have no AsyncAppend awaited by
+// a caller, and are not notified to a completion callback. Spooled files are
+// not synced to disk, and may not survive a crash of the host.
+//
+// |dir| must be used by only one WriteService at a time. Writes should not be
+// made prior to Start, as they may then be ordered before recovered writes.
+// SetDurableSpool must be called before Start.
+func (c *WriteService) SetDurableSpool(dir string) {
+	c.spoolDir = dir
+}
+
+// SetLogger directs logging of the WriteService to |logger|, in place of the
+// logger of its Client. SetLogger must be called before Start.
+func (c *WriteService) SetLogger(logger log.FieldLogger) {
+	c.logger = logger
+}
+
 // Begins the write service loop. Be sure to invoke Stop() prior to process
 // exit, to ensure that all pending writes have been flushed.
 func (c *WriteService) Start() {
@@ -131,18 +421,155 @@ func (c *WriteService) Start() {
 	}
 
 	go c.monitorDiskSpace()
+	c.running = int64(len(c.writeQueue))
 	for i := range c.writeQueue {
 		go c.serveWrites(i)
 	}
+	if c.onComplete != nil {
+		go c.serveCompletions()
+	}
+	if c.spoolDir != "" {
+		if err = c.recoverDurableSpool(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// recoverDurableSpool queues writes of spool files remaining in |spoolDir|,
+// in the order in which they were created.
+func (c *WriteService) recoverDurableSpool() error {
+	if err := os.MkdirAll(c.spoolDir, 0700); err != nil {
+		return err
+	}
+	infos, err := ioutil.ReadDir(c.spoolDir) // Sorted on name, and thus sequence.
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		var path = filepath.Join(c.spoolDir, info.Name())
+
+		seq, name, err := parseDurableSpoolName(info.Name())
+		if err != nil {
+			c.logger.WithFields(log.Fields{"path": path, "err": err}).
+				Warn("ignoring unrecognized spool file")
+			continue
+		}
+		if seq > c.spoolSeq {
+			c.spoolSeq = seq
+		}
+
+		file, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		var write = &pendingWrite{
+			journal: name,
+			file:    file,
+			started: c.clock.Now(),
+			durable: true,
+		}
+
+		var header [durableSpoolHeaderLen]byte
+		if _, err = io.ReadFull(file, header[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+			// The process crashed before the header was written. No writes committed.
+		} else if err != nil {
+			return err
+		} else {
+			write.offset = int64(binary.BigEndian.Uint64(header[:]))
+		}
+
+		if write.offset == 0 {
+			if err = releasePendingWrite(write); err != nil {
+				return err
+			}
+			continue
+		}
+		c.logger.WithFields(log.Fields{"journal": name, "path": path, "size": write.offset}).
+			Info("recovered spooled write")
+
+		c.adjustBuffered(write.offset)
+		c.enqueue(write)
+	}
+	return nil
+}
+
+// newDurableWrite returns a pendingWrite of journal |name|, spooled to a new
+// file of |spoolDir|.
+func (c *WriteService) newDurableWrite(name journal.Name) (*pendingWrite, error) {
+	var seq = atomic.AddInt64(&c.spoolSeq, 1)
+	var path = filepath.Join(c.spoolDir, durableSpoolName(seq, name))
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = commitDurableOffset(file, 0); err == nil {
+		_, err = file.Seek(durableSpoolHeaderLen, 0)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return &pendingWrite{file: file, durable: true}, nil
 }
 
 // Stops the write service loop. Returns only after all writes have completed.
 func (c *WriteService) Stop() {
+	c.closeQueues()
+	<-c.stopped
+
+	c.closeCompletions()
+	c.closeClient()
+}
+
+// Drain stops the write service loop, causing further writes to fail with
+// ErrWriteServiceStopped, and waits up to |timeout| for pending writes to
+// complete. If writes are still pending after |timeout|, their number is
+// returned with ErrDrainTimeout. Pending writes continue to be retried
+// in the background, and Drain or Stop may be called again to await them.
+func (c *WriteService) Drain(timeout time.Duration) (int, error) {
+	var deadline = c.clock.After(timeout)
+
+	// Writers blocked on buffer capacity hold |stopMu|, which closeQueues must
+	// obtain. Close queues asynchronously, so that |timeout| is honored.
+	go c.closeQueues()
+
+	select {
+	case <-c.stopped:
+	case <-deadline:
+		return int(atomic.LoadInt64(&c.pending)), ErrDrainTimeout
+	}
+	c.closeCompletions()
+	c.closeClient()
+	return 0, nil
+}
+
+// PendingWrites returns the number of batched writes which are queued or
+// in-flight, and have not yet been acknowledged by a broker.
+func (c *WriteService) PendingWrites() int {
+	return int(atomic.LoadInt64(&c.pending))
+}
+
+func (c *WriteService) closeQueues() {
+	c.stopMu.Lock()
+	defer c.stopMu.Unlock()
+
+	if c.isStopped {
+		return
+	}
+	c.isStopped = true
+
 	for i := range c.writeQueue {
 		close(c.writeQueue[i])
 	}
-	for _ = range c.writeQueue {
-		<-c.stopped
+}
+
+// closeClient closes the Client of the WriteService, if it's owned.
+func (c *WriteService) closeClient() {
+	if c.ownsClient {
+		c.client.Close() // Fails only if already closed.
 	}
 }
 
@@ -154,7 +581,7 @@ func (c *WriteService) monitorDiskSpace() {
 		var err = syscall.Statfs(gazetteWriteTmpDir, &stat)
 		if err != nil {
 			// This should never happen.
-			log.WithField("err", err).Fatal("checking free disk space")
+			c.logger.WithField("err", err).Fatal("checking free disk space")
 		}
 
 		var usagePct = int(((stat.Blocks - stat.Bavail) * 100) / stat.Blocks)
@@ -171,7 +598,7 @@ func (c *WriteService) monitorDiskSpace() {
 			} else {
 				// We were in an alarm state, and still need to be.
 				// Log noisily.
-				log.WithField("usagePct", usagePct).Error(
+				c.logger.WithField("usagePct", usagePct).Error(
 					"WriteService remains in stop-writes mode")
 			}
 		} else if wasAlarming {
@@ -184,30 +611,39 @@ func (c *WriteService) monitorDiskSpace() {
 }
 
 func (c *WriteService) obtainWrite(name journal.Name) (*pendingWrite, bool, error) {
+	if err, ok := c.failedJournals[name]; ok {
+		return nil, false, err
+	}
 	// Is a non-full pendingWrite for this journal already in |writeQueue|?
 	write, ok := c.writeIndex[name]
-	if ok && write.offset < kMaxWriteSpoolSize {
+	if ok && write.offset < c.maxBatchBytes {
 		return write, false, nil
 	}
-	popped := pendingWritePool.Get()
-
-	if err, ok := popped.(error); ok {
-		return nil, false, err
+	if c.spoolDir != "" {
+		var err error
+		if write, err = c.newDurableWrite(name); err != nil {
+			return nil, false, err
+		}
 	} else {
-		write = popped.(*pendingWrite)
-		write.journal = name
-		write.result = &journal.AsyncAppend{
-			Ready: make(chan struct{}),
+		var popped = pendingWritePool.Get()
+		if err, ok := popped.(error); ok {
+			return nil, false, err
 		}
-		write.started = time.Now()
-		c.writeIndex[name] = write
-		return write, true, nil
+		write = popped.(*pendingWrite)
 	}
+
+	write.journal = name
+	write.started = c.clock.Now()
+	c.writeIndex[name] = write
+	return write, true, nil
 }
 
 // Appends |buffer| to |journal|. Either all of |buffer| is written, or none
-// of it is. Returns a AsyncAppendwhich is resolved when the write has
-// been fully committed.
+// of it is. Returns an AsyncAppend which is resolved when the write has
+// been fully committed. Once resolved without error, its WriteHead is the
+// journal write head following the append: |buffer| lies entirely before it.
+// Writes batched into a single append share its WriteHead, and each resolves
+// with the journal region [Begin, End) of its own content.
 func (c *WriteService) Write(name journal.Name, buf []byte) (*journal.AsyncAppend, error) {
 	return c.ReadFrom(name, bytes.NewReader(buf))
 }
@@ -216,36 +652,156 @@ func (c *WriteService) Write(name journal.Name, buf []byte) (*journal.AsyncAppen
 // |r| is written, or none of it is. Returns an AsyncAppend which is
 // resolved when the write has been fully committed.
 func (c *WriteService) ReadFrom(name journal.Name, r io.Reader) (*journal.AsyncAppend, error) {
+	return c.readFrom(name, "", r, 0)
+}
+
+// WriteWithTimeout is like Write, but overrides the append timeout of the
+// WriteService (see SetAppendTimeout) with |timeout|. As writes are batched
+// into appends, an append has the smallest timeout of any of its writes.
+func (c *WriteService) WriteWithTimeout(name journal.Name, buf []byte, timeout time.Duration) (*journal.AsyncAppend, error) {
+	return c.readFrom(name, "", bytes.NewReader(buf), timeout)
+}
+
+// WriteWithToken is like Write, but identifies the write with a caller-supplied
+// idempotency |token|. If a prior write of |name| and |token| is pending, or
+// has committed, its AsyncAppend is returned and |buf| is not written again.
+// A prior write which failed does not prevent a re-try of |token|. Tokens are
+// tracked only within the WriteService, and only for a bounded number of
+// recent writes.
+func (c *WriteService) WriteWithToken(name journal.Name, token string, buf []byte) (*journal.AsyncAppend, error) {
+	return c.readFrom(name, token, bytes.NewReader(buf), 0)
+}
+
+func (c *WriteService) readFrom(name journal.Name, token string, r io.Reader,
+	timeout time.Duration) (*journal.AsyncAppend, error) {
+
 	var result *journal.AsyncAppend
 	var writeErr error
 
+	if err := name.Validate(); err != nil {
+		return nil, err
+	}
+
 	// Obtain a 'read lock' on the disk usage RWMutex. During a disk condition,
 	// this blocks, rather than explicitly failing the write, preventing
 	// repeated spinning and re-attempts at writes.
 	c.diskUsageMu.RLock()
 	defer c.diskUsageMu.RUnlock()
 
+	// Hold |stopMu| to ensure |writeQueue| is not closed while we enqueue.
+	c.stopMu.RLock()
+	defer c.stopMu.RUnlock()
+
+	if c.isStopped {
+		return nil, ErrWriteServiceStopped
+	} else if err := c.awaitBufferCapacity(); err != nil {
+		return nil, err
+	}
+
+	var written int64
+
 	c.writeIndexMu.Lock()
+	if prior, ok := c.priorWrite(name, token); ok {
+		c.writeIndexMu.Unlock()
+		return prior, nil
+	}
 	write, isNew, obtainErr := c.obtainWrite(name)
 	if obtainErr == nil {
-		writeErr = writeAllOrNone(write, r)
-		result = write.result // Retain, as we can't access |write| after unlock.
+		written = write.offset
+		if writeErr = writeAllOrNone(write, r); writeErr == nil {
+			result = &journal.AsyncAppend{Journal: name, Ready: make(chan struct{})}
+			write.writes = append(write.writes, batchedWrite{
+				result: result,
+				begin:  written,
+				end:    write.offset,
+			})
+
+			if timeout != 0 && (write.timeout == 0 || timeout < write.timeout) {
+				write.timeout = timeout
+			}
+
+			if token != "" {
+				c.tokens.Add(appendToken{journal: name, token: token}, result)
+			}
+		}
+		written = write.offset - written
 	}
 	c.writeIndexMu.Unlock()
 
 	if obtainErr != nil {
 		return nil, obtainErr
 	}
+	c.adjustBuffered(written)
 	if isNew {
-		// Hash |name| to identify a service loop to queue |write| on. This allows
-		// for multiple, concurrent service loops while ensuring that |writes| from
-		// a single client are strictly in-order.
-		route := int(crc32.Checksum([]byte(name), crc32.IEEETable))
-		c.writeQueue[route%len(c.writeQueue)] <- write
+		c.enqueue(write)
 	}
 	return result, writeErr
 }
 
+// enqueue queues |write| on a service loop.
+func (c *WriteService) enqueue(write *pendingWrite) {
+	// Hash the journal to identify a service loop to queue |write| on. This
+	// allows for multiple, concurrent service loops while ensuring that |writes|
+	// from a single client are strictly in-order.
+	route := int(crc32.Checksum([]byte(write.journal), crc32.IEEETable))
+	atomic.AddInt64(&c.pending, 1)
+	c.writeQueue[route%len(c.writeQueue)] <- write
+}
+
+// priorWrite returns the AsyncAppend of a prior write of |name| and |token|
+// which is pending or has committed. |writeIndexMu| must be held.
+func (c *WriteService) priorWrite(name journal.Name, token string) (*journal.AsyncAppend, bool) {
+	if token == "" {
+		return nil, false
+	}
+	var v, ok = c.tokens.Get(appendToken{journal: name, token: token})
+	if !ok {
+		return nil, false
+	}
+	var prior = v.(*journal.AsyncAppend)
+
+	select {
+	case <-prior.Ready:
+		if prior.Error != nil {
+			return nil, false // Prior write failed, and may be re-tried.
+		}
+	default:
+		// Prior write is still pending.
+	}
+	return prior, true
+}
+
+// awaitBufferCapacity returns nil if buffered writes are within limits.
+// Otherwise, it either blocks until they are, or returns ErrWriteBufferFull,
+// depending on the OverflowPolicy.
+func (c *WriteService) awaitBufferCapacity() error {
+	c.bufferCond.L.Lock()
+	defer c.bufferCond.L.Unlock()
+
+	for c.isBufferFull() {
+		if c.overflowPolicy == ErrorOnFull {
+			return ErrWriteBufferFull
+		}
+		c.bufferCond.Wait()
+	}
+	return nil
+}
+
+func (c *WriteService) isBufferFull() bool {
+	return (c.maxBufferedBytes != 0 && c.bufferedBytes >= c.maxBufferedBytes) ||
+		(c.maxBufferedWrites != 0 && int(atomic.LoadInt64(&c.pending)) >= c.maxBufferedWrites)
+}
+
+// adjustBuffered updates buffered bytes by |delta|, and wakes blocked writers.
+func (c *WriteService) adjustBuffered(delta int64) {
+	c.bufferCond.L.Lock()
+	c.bufferedBytes += delta
+	metrics.GazetteWriteBufferBytes.Add(float64(delta))
+	c.bufferCond.L.Unlock()
+
+	c.bufferCond.Broadcast()
+}
+
 func (c *WriteService) serveWrites(index int) {
 	for {
 		write := <-c.writeQueue[index]
@@ -254,36 +810,65 @@ func (c *WriteService) serveWrites(index int) {
 			break
 		}
 
+		// Allow further writes to accumulate into |write| until its delay elapses.
+		if d := write.started.Add(c.maxBatchDelay).Sub(c.clock.Now()); d > 0 {
+			<-c.clock.After(d)
+		}
+
 		c.writeIndexMu.Lock()
 		if c.writeIndex[write.journal] == write {
 			delete(c.writeIndex, write.journal)
 		}
 		c.writeIndexMu.Unlock()
 
+		var size = write.offset // Retain, as |write| is released by onWrite.
+
 		if err := c.onWrite(write); err != nil {
-			log.WithFields(log.Fields{"journal": write.journal, "err": err}).
+			c.logger.WithFields(log.Fields{"journal": write.journal, "err": err}).
 				Error("write failed")
 		}
+		atomic.AddInt64(&c.pending, -1)
+		c.adjustBuffered(-size)
+	}
+	// Signal exit, if this is the last service loop.
+	if atomic.AddInt64(&c.running, -1) == 0 {
+		close(c.stopped)
 	}
-	c.stopped <- struct{}{} // Signal exit.
 }
 
 func (c *WriteService) onWrite(write *pendingWrite) error {
 	// We now have exclusive ownership of |write|. Iterate
 	// attempting to write to server, until it's acknowledged.
+	var failures int
+	var lastErr error
+
 	for true {
+		if err := c.JournalError(write.journal); err != nil {
+			// A preceding write has terminally failed. So must this one.
+			return c.failWrite(write, err)
+		} else if c.maxWriteAttempts != 0 && failures >= c.maxWriteAttempts {
+			c.failJournal(write.journal, lastErr)
+			continue
+		}
+
 		if _, err := write.file.Seek(0, 0); err != nil {
 			return err // Not recoverable
 		}
-		result := c.client.Put(journal.AppendArgs{
-			Journal: write.journal,
-			Content: io.NewSectionReader(write.file, 0, write.offset),
-		})
+		result := c.append(write)
 
 		switch result.Error {
 		case nil:
 			break
 
+		case ErrAppendTimeout:
+			metrics.GazetteWriteAppendTimeoutsTotal.WithLabelValues(write.journal.String()).Inc()
+
+			// Whether the append committed is unknown, and it cannot be retried
+			// without risking re-ordering of the journal's writes. Fail the journal,
+			// and thereby this and further writes to it.
+			c.failJournal(write.journal, ErrAppendTimeout)
+			continue
+
 		case journal.ErrNotBroker:
 			// The route topology has changed, generally due to a service update.
 			// Immediately retry against the indicated broker.
@@ -292,37 +877,183 @@ func (c *WriteService) onWrite(write *pendingWrite) error {
 		case journal.ErrNotFound:
 			// First-write case: Implicitly create a Journal which doesn't yet exist.
 			if err := c.client.Create(write.journal); err != nil {
-				log.WithFields(log.Fields{"journal": write.journal, "err": err}).
+				c.logger.WithFields(log.Fields{"journal": write.journal, "err": err}).
 					Warn("failed to create journal")
-				time.Sleep(writeServiceCoolOffTimeout)
+				lastErr, failures = err, failures+1
+				<-c.clock.After(writeServiceCoolOffTimeout)
 			} else {
-				log.WithField("journal", write.journal).Info("created journal")
+				c.logger.WithField("journal", write.journal).Info("created journal")
 			}
 			continue
 
 		default:
-			log.WithFields(log.Fields{"journal": write.journal, "err": result.Error}).
+			c.logger.WithFields(log.Fields{"journal": write.journal, "err": result.Error}).
 				Warn("write failed")
-			time.Sleep(writeServiceCoolOffTimeout)
+			lastErr, failures = result.Error, failures+1
+
+			if c.maxWriteAttempts == 0 || failures < c.maxWriteAttempts {
+				<-c.clock.After(writeServiceCoolOffTimeout)
+			}
 			continue
 		}
 
 		// Success. Notify any waiting clients.
-		write.result.AppendResult = result
-		close(write.result.Ready)
+		c.resolveWrite(write, result)
 
-		metrics.GazetteWriteDurationTotal.Add(time.Now().Sub(write.started).Seconds())
+		metrics.GazetteWriteDurationTotal.Add(c.clock.Now().Sub(write.started).Seconds())
 		metrics.GazetteWriteBytesTotal.Add(float64(write.offset))
 		metrics.GazetteWriteCountTotal.Inc()
 
 		if err := releasePendingWrite(write); err != nil {
-			log.WithField("err", err).Error("failed to release pending write")
+			c.logger.WithField("err", err).Error("failed to release pending write")
 		}
 		return nil
 	}
 	panic("not reached")
 }
 
+// append issues an append of |write| to its journal. The append fails with
+// ErrAppendTimeout if it doesn't complete within its timeout (if any).
+func (c *WriteService) append(write *pendingWrite) journal.AppendResult {
+	var args = journal.AppendArgs{
+		Journal: write.journal,
+		Content: io.NewSectionReader(write.file, write.contentBase(), write.offset),
+	}
+	var timeout = write.timeout
+	if timeout == 0 {
+		timeout = c.appendTimeout
+	}
+	if timeout == 0 {
+		return c.client.Put(args)
+	}
+
+	// Cancel the append after |timeout|, as measured by the WriteService Clock.
+	var ctx, cancel = context.WithCancel(context.Background())
+	var done = make(chan struct{})
+
+	go func() {
+		select {
+		case <-c.clock.After(timeout):
+			cancel()
+		case <-done:
+		}
+	}()
+
+	var result = c.client.put(ctx, args)
+	close(done)
+
+	if result.Error != nil && ctx.Err() != nil {
+		result.Error = ErrAppendTimeout
+	}
+	cancel()
+
+	return result
+}
+
+// failJournal marks journal |name| as terminally failed with |err|, and
+// notifies the error handler (if any).
+func (c *WriteService) failJournal(name journal.Name, err error) {
+	c.writeIndexMu.Lock()
+	c.failedJournals[name] = err
+	c.writeIndexMu.Unlock()
+
+	c.logger.WithFields(log.Fields{"journal": name, "err": err}).Error("journal writes failed")
+
+	if c.onJournalError != nil {
+		c.onJournalError(name, err)
+	}
+}
+
+// failWrite resolves |write| with |err|, and releases it.
+func (c *WriteService) failWrite(write *pendingWrite, err error) error {
+	c.resolveWrite(write, journal.AppendResult{Error: err})
+
+	if err := releasePendingWrite(write); err != nil {
+		c.logger.WithField("err", err).Error("failed to release pending write")
+	}
+	return nil
+}
+
+// resolveWrite resolves each write of |write| with |result|. On success, as
+// the append of |write| ended at the journal WriteHead, the region of each
+// write is the WriteHead less the bytes which followed the write.
+func (c *WriteService) resolveWrite(write *pendingWrite, result journal.AppendResult) {
+	var base = result.WriteHead - write.offset
+
+	for _, w := range write.writes {
+		w.result.AppendResult = result
+		if result.Error == nil {
+			w.result.Begin, w.result.End = base+w.begin, base+w.end
+		}
+		close(w.result.Ready)
+	}
+	c.notifyCompletion(write, result)
+}
+
+// completion is a resolved pendingWrite. If it succeeded, |ends| are the
+// journal offsets at which each of its writes end.
+type completion struct {
+	journal journal.Name
+	ends    []int64
+	result  journal.AppendResult
+}
+
+// notifyCompletion queues the resolution of |write| for the completion
+// callback, if one is set.
+func (c *WriteService) notifyCompletion(write *pendingWrite, result journal.AppendResult) {
+	if c.onComplete == nil {
+		return
+	}
+	var ends = make([]int64, len(write.writes))
+	for i, w := range write.writes {
+		ends[i] = -1
+		if result.Error == nil {
+			ends[i] = result.WriteHead - write.offset + w.end
+		}
+	}
+
+	c.completionCond.L.Lock()
+	c.completions = append(c.completions, completion{
+		journal: write.journal,
+		ends:    ends,
+		result:  result,
+	})
+	c.completionCond.L.Unlock()
+
+	c.completionCond.Signal()
+}
+
+// closeCompletions signals serveCompletions to exit once queued completions
+// have been delivered.
+func (c *WriteService) closeCompletions() {
+	c.completionCond.L.Lock()
+	c.completionDone = true
+	c.completionCond.L.Unlock()
+
+	c.completionCond.Signal()
+}
+
+func (c *WriteService) serveCompletions() {
+	for {
+		c.completionCond.L.Lock()
+		for len(c.completions) == 0 && !c.completionDone {
+			c.completionCond.Wait()
+		}
+		var completions = c.completions
+		c.completions = nil
+		c.completionCond.L.Unlock()
+
+		if len(completions) == 0 {
+			return // |completionDone| and all completions were delivered.
+		}
+		for _, cmp := range completions {
+			for _, end := range cmp.ends {
+				c.onComplete(cmp.journal, end, cmp.result.Error)
+			}
+		}
+	}
+}
+
 // Adapter to allow |WriteService| to return io.Writers for arbitrary journals
 // that can be written to directly.
 type namedWriter struct {
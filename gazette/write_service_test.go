@@ -6,14 +6,17 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
 
 	gc "github.com/go-check/check"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/mock"
 
 	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/metrics"
 )
 
 type WriteServiceSuite struct{}
@@ -92,6 +95,15 @@ func (s *WriteServiceSuite) TestParallelWriteSpooling(c *gc.C) {
 	}
 }
 
+func (s *WriteServiceSuite) TestInvalidNameIsRejected(c *gc.C) {
+	var client, _ = NewClient("http://server")
+	var writer = NewWriteService(client)
+
+	var _, err = writer.Write("/a/journal", []byte("foo"))
+	c.Check(err, gc.ErrorMatches, `invalid journal name "/a/journal" .*`)
+	c.Check(writer.PendingWrites(), gc.Equals, 0)
+}
+
 func (s *WriteServiceSuite) TestWriteLifecycle(c *gc.C) {
 	// Shorten the write error cool-off interval for this test.
 	actualTimeout := writeServiceCoolOffTimeout
@@ -204,4 +216,672 @@ func (s *WriteServiceSuite) TestWriteLifecycle(c *gc.C) {
 	mockClient.AssertExpectations(c)
 }
 
+func (s *WriteServiceSuite) TestDurableSpoolRecovery(c *gc.C) {
+	dir, err := ioutil.TempDir("", "write-service-spool")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(dir)
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockHttpClient{}
+
+	// Spool writes to a WriteService which is never started, and "crashes".
+	writer := NewWriteService(client)
+	writer.SetConcurrency(1)
+	writer.SetDurableSpool(dir)
+
+	_, err = writer.Write("a/journal", []byte("foo"))
+	c.Check(err, gc.IsNil)
+	_, err = writer.ReadFrom("a/journal", errReader{strings.NewReader("xxx")})
+	c.Check(err, gc.ErrorMatches, "error!")
+	_, err = writer.Write("a/journal", []byte("bar"))
+	c.Check(err, gc.IsNil)
+	_, err = writer.Write("another/journal", []byte("baz!"))
+	c.Check(err, gc.IsNil)
+
+	// Also add a file of an uncommitted write, and an unrelated file.
+	c.Check(ioutil.WriteFile(filepath.Join(dir, durableSpoolName(100, "a/journal")),
+		[]byte("zzz"), 0600), gc.IsNil)
+	c.Check(ioutil.WriteFile(filepath.Join(dir, "unrelated"), nil, 0600), gc.IsNil)
+
+	infos, err := ioutil.ReadDir(dir)
+	c.Check(err, gc.IsNil)
+	c.Check(infos, gc.HasLen, 4)
+
+	// A new WriteService recovers and appends the spooled writes.
+	var mockClient mockHttpClient
+	client.httpClient = &mockClient
+	client.locationCache.Add("/a/journal", newURL("http://server/a/journal"))
+	client.locationCache.Add("/another/journal", newURL("http://server/another/journal"))
+
+	var expectPut = func(path, content string) {
+		mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+			return request.Method == "PUT" && request.URL.Path == path
+		})).Return(&http.Response{
+			StatusCode: http.StatusNoContent, // Success.
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil).Run(func(args mock.Arguments) {
+			body, _ := ioutil.ReadAll(args[0].(*http.Request).Body)
+			c.Check(string(body), gc.Equals, content)
+		}).Once()
+	}
+	expectPut("/a/journal", "foobar")
+	expectPut("/another/journal", "baz!")
+
+	writer = NewWriteService(client)
+	writer.SetConcurrency(1)
+	writer.SetDurableSpool(dir)
+	writer.Start()
+
+	c.Check(writer.spoolSeq, gc.Equals, int64(100))
+
+	// Writes following recovery are also durably spooled.
+	expectPut("/a/journal", "quux")
+	promise, err := writer.Write("a/journal", []byte("quux"))
+	c.Check(err, gc.IsNil)
+
+	<-promise.Ready
+	writer.Stop()
+	mockClient.AssertExpectations(c)
+
+	// Expect only the unrelated file remains.
+	infos, err = ioutil.ReadDir(dir)
+	c.Check(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 1)
+	c.Check(infos[0].Name(), gc.Equals, "unrelated")
+}
+
+func (s *WriteServiceSuite) TestBatchLimits(c *gc.C) {
+	var mockClient mockHttpClient
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockClient
+	client.locationCache.Add("/a/journal", newURL("http://server/a/journal"))
+
+	writer := NewWriteService(client)
+	writer.SetConcurrency(1)
+	writer.SetBatchLimits(4, time.Millisecond)
+
+	// Expect "foo" and "bar" are batched, as "foo" is under the byte limit.
+	// "bar" exceeds the limit, and "baz" begins a new batch.
+	var promises []*journal.AsyncAppend
+	for _, content := range []string{"foo", "bar", "baz"} {
+		promise, err := writer.Write("a/journal", []byte(content))
+		c.Check(err, gc.IsNil)
+		promises = append(promises, promise)
+	}
+	for _, expect := range []struct{ content, writeHead string }{
+		{"foobar", "1006"},
+		{"baz", "1009"},
+	} {
+		var expect = expect
+
+		mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+			return request.Method == "PUT" && request.URL.Path == "/a/journal"
+		})).Return(&http.Response{
+			StatusCode: http.StatusNoContent, // Success.
+			Header:     http.Header{WriteHeadHeader: []string{expect.writeHead}},
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil).Run(func(args mock.Arguments) {
+			content, _ := ioutil.ReadAll(args[0].(*http.Request).Body)
+			c.Check(string(content), gc.Equals, expect.content)
+		}).Once()
+	}
+
+	writer.Start()
+	for _, promise := range promises {
+		c.Check(promise.Wait(), gc.IsNil)
+	}
+	writer.Stop()
+
+	// Batched writes share a WriteHead, but resolve with their own regions.
+	for i, expect := range []struct{ head, begin, end int64 }{
+		{1006, 1000, 1003},
+		{1006, 1003, 1006},
+		{1009, 1006, 1009},
+	} {
+		c.Check(promises[i].Journal, gc.Equals, journal.Name("a/journal"))
+		c.Check(promises[i].WriteHead, gc.Equals, expect.head)
+		c.Check([]int64{promises[i].Begin, promises[i].End},
+			gc.DeepEquals, []int64{expect.begin, expect.end})
+	}
+	mockClient.AssertExpectations(c)
+}
+
+func (s *WriteServiceSuite) TestDrain(c *gc.C) {
+	actualTimeout := writeServiceCoolOffTimeout
+	writeServiceCoolOffTimeout = 50 * time.Millisecond
+	defer func() { writeServiceCoolOffTimeout = actualTimeout }()
+
+	var mockClient mockHttpClient
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockClient
+	client.locationCache.Add("/a/journal", newURL("http://server/a/journal"))
+
+	writer := NewWriteService(client)
+	writer.SetConcurrency(1)
+
+	promise, err := writer.Write("a/journal", []byte("foo"))
+	c.Check(err, gc.IsNil)
+	c.Check(writer.PendingWrites(), gc.Equals, 1)
+
+	// First PUT fails, and is retried after the cool-off. Second PUT succeeds.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT" && request.URL.Path == "/a/journal"
+	})).Return(&http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Status:     "Whoops!",
+		Body:       ioutil.NopCloser(strings.NewReader("error")),
+	}, nil).Once()
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT" && request.URL.Path == "/a/journal"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNoContent,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Once()
+
+	writer.Start()
+
+	// Expect a short Drain times out with the write still pending.
+	pending, err := writer.Drain(time.Millisecond)
+	c.Check(pending, gc.Equals, 1)
+	c.Check(err, gc.Equals, ErrDrainTimeout)
+
+	// Further writes are refused.
+	_, err = writer.Write("a/journal", []byte("bar"))
+	c.Check(err, gc.Equals, ErrWriteServiceStopped)
+
+	// A longer Drain completes.
+	pending, err = writer.Drain(time.Minute)
+	c.Check(pending, gc.Equals, 0)
+	c.Check(err, gc.IsNil)
+
+	<-promise.Ready
+	c.Check(writer.PendingWrites(), gc.Equals, 0)
+	mockClient.AssertExpectations(c)
+}
+
+func (s *WriteServiceSuite) TestDrainThenStop(c *gc.C) {
+	var mockClient mockHttpClient
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNoContent,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Times(3)
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockClient
+
+	writer := NewWriteService(client)
+	writer.SetConcurrency(3)
+	writer.SetCompletionCallback(func(journal.Name, int64, error) {})
+	writer.SetOwnsClient(true)
+
+	var promises []*journal.AsyncAppend
+	for _, name := range []journal.Name{"a/journal", "b/journal", "c/journal"} {
+		promise, err := writer.Write(name, []byte("foo"))
+		c.Check(err, gc.IsNil)
+		promises = append(promises, promise)
+	}
+	writer.Start()
+
+	// Expect Drain awaits each of the service loops.
+	pending, err := writer.Drain(time.Minute)
+	c.Check(pending, gc.Equals, 0)
+	c.Check(err, gc.IsNil)
+
+	for _, promise := range promises {
+		c.Check(promise.Wait(), gc.IsNil)
+	}
+	c.Check(writer.completionDone, gc.Equals, true)
+	c.Check(client.isClosed(), gc.Equals, true)
+
+	// A following Drain or Stop returns immediately.
+	pending, err = writer.Drain(time.Minute)
+	c.Check(pending, gc.Equals, 0)
+	c.Check(err, gc.IsNil)
+	writer.Stop()
+
+	mockClient.AssertExpectations(c)
+}
+
+func (s *WriteServiceSuite) TestDrainTimeoutThenStop(c *gc.C) {
+	actualTimeout := writeServiceCoolOffTimeout
+	writeServiceCoolOffTimeout = 50 * time.Millisecond
+	defer func() { writeServiceCoolOffTimeout = actualTimeout }()
+
+	var mockClient mockHttpClient
+
+	// The first PUT of "a/journal" fails, and is retried after the cool-off.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT" && request.URL.Path == "/a/journal"
+	})).Return(&http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Status:     "Whoops!",
+		Body:       ioutil.NopCloser(strings.NewReader("error")),
+	}, nil).Once()
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNoContent,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Twice()
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockClient
+
+	writer := NewWriteService(client)
+	writer.SetConcurrency(2)
+
+	promiseA, err := writer.Write("a/journal", []byte("foo"))
+	c.Check(err, gc.IsNil)
+	promiseB, err := writer.Write("b/journal", []byte("bar"))
+	c.Check(err, gc.IsNil)
+
+	writer.Start()
+
+	// Expect a short Drain times out with the failed write still pending.
+	pending, err := writer.Drain(time.Millisecond)
+	c.Check(pending, gc.Not(gc.Equals), 0)
+	c.Check(err, gc.Equals, ErrDrainTimeout)
+
+	// Stop awaits the remaining writes, rather than blocking indefinitely.
+	writer.Stop()
+
+	c.Check(promiseA.Wait(), gc.IsNil)
+	c.Check(promiseB.Wait(), gc.IsNil)
+	c.Check(writer.PendingWrites(), gc.Equals, 0)
+	mockClient.AssertExpectations(c)
+}
+
+func (s *WriteServiceSuite) TestStopClosesOwnedClient(c *gc.C) {
+	for _, owns := range []bool{false, true} {
+		client, _ := NewClient("http://server")
+		client.httpClient = &mockHttpClient{}
+
+		writer := NewWriteService(client)
+		writer.SetConcurrency(1)
+		writer.SetOwnsClient(owns)
+
+		writer.Start()
+		writer.Stop()
+
+		c.Check(client.isClosed(), gc.Equals, owns)
+	}
+}
+
+func (s *WriteServiceSuite) TestBufferLimits(c *gc.C) {
+	var mockClient mockHttpClient
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockClient
+	client.locationCache.Add("/a/journal", newURL("http://server/a/journal"))
+
+	// Under ErrorOnFull, expect writes fail once the byte limit is reached.
+	writer := NewWriteService(client)
+	writer.SetConcurrency(1)
+	writer.SetBufferLimits(3, 0, ErrorOnFull)
+
+	_, err := writer.Write("a/journal", []byte("foo"))
+	c.Check(err, gc.IsNil)
+	_, err = writer.Write("a/journal", []byte("bar"))
+	c.Check(err, gc.Equals, ErrWriteBufferFull)
+
+	// Under BlockOnFull, expect the writer blocks until buffered writes
+	// are acknowledged.
+	writer = NewWriteService(client)
+	writer.SetConcurrency(1)
+	writer.SetBufferLimits(0, 1, BlockOnFull)
+
+	fooPromise, err := writer.Write("a/journal", []byte("foo"))
+	c.Check(err, gc.IsNil)
+
+	var barCh = make(chan *journal.AsyncAppend)
+	go func() {
+		promise, err := writer.Write("a/journal", []byte("bar"))
+		c.Check(err, gc.IsNil)
+		barCh <- promise
+	}()
+
+	select {
+	case <-barCh:
+		c.Error("expected write to block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	for _, expect := range []string{"foo", "bar"} {
+		var expect = expect
+
+		mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+			return request.Method == "PUT" && request.URL.Path == "/a/journal"
+		})).Return(&http.Response{
+			StatusCode: http.StatusNoContent, // Success.
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil).Run(func(args mock.Arguments) {
+			content, _ := ioutil.ReadAll(args[0].(*http.Request).Body)
+			c.Check(string(content), gc.Equals, expect)
+		}).Once()
+	}
+	writer.Start()
+
+	<-fooPromise.Ready
+	<-(<-barCh).Ready
+	writer.Stop()
+
+	mockClient.AssertExpectations(c)
+}
+
+func (s *WriteServiceSuite) TestRetryLimit(c *gc.C) {
+	actualTimeout := writeServiceCoolOffTimeout
+	writeServiceCoolOffTimeout = time.Millisecond
+	defer func() { writeServiceCoolOffTimeout = actualTimeout }()
+
+	var mockClient mockHttpClient
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockClient
+	client.locationCache.Add("/a/journal", newURL("http://server/a/journal"))
+
+	var failedCh = make(chan error, 1)
+
+	writer := NewWriteService(client)
+	writer.SetConcurrency(1)
+	writer.SetRetryLimit(2, func(name journal.Name, err error) {
+		c.Check(name, gc.Equals, journal.Name("a/journal"))
+		failedCh <- err
+	})
+
+	// Expect two attempts are made, both of which fail.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT" && request.URL.Path == "/a/journal"
+	})).Return(&http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Status:     "Whoops!",
+		Body:       ioutil.NopCloser(strings.NewReader("error")),
+	}, nil).Twice()
+
+	promise, err := writer.Write("a/journal", []byte("foo"))
+	c.Check(err, gc.IsNil)
+
+	writer.Start()
+	<-promise.Ready
+
+	c.Check(promise.Error, gc.ErrorMatches, "Whoops! \\(error\\)")
+	c.Check(<-failedCh, gc.Equals, promise.Error)
+
+	// Further writes to the journal fail, until the error is cleared.
+	_, err = writer.Write("a/journal", []byte("bar"))
+	c.Check(err, gc.Equals, promise.Error)
+	c.Check(writer.JournalError("a/journal"), gc.Equals, promise.Error)
+
+	writer.ClearJournalError("a/journal")
+	c.Check(writer.JournalError("a/journal"), gc.IsNil)
+
+	writer.Stop()
+	mockClient.AssertExpectations(c)
+}
+
+func (s *WriteServiceSuite) TestRetryCoolOffWithClock(c *gc.C) {
+	var mockClient mockHttpClient
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockClient
+	client.locationCache.Add("/a/journal", newURL("http://server/a/journal"))
+
+	var clock = journal.NewManualClock(time.Unix(1234, 0))
+
+	writer := NewWriteService(client)
+	writer.SetConcurrency(1)
+	writer.SetClock(clock)
+
+	// The first attempt fails. The second succeeds.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT" && request.URL.Path == "/a/journal"
+	})).Return(&http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Status:     "Whoops!",
+		Body:       ioutil.NopCloser(strings.NewReader("error")),
+	}, nil).Once()
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT" && request.URL.Path == "/a/journal"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNoContent,
+		Header:     http.Header{WriteHeadHeader: []string{"1234"}},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Once()
+
+	promise, err := writer.Write("a/journal", []byte("foo"))
+	c.Check(err, gc.IsNil)
+	writer.Start()
+
+	// Wait for the service to begin its cool-off following the failure.
+	for clock.Waiters() == 0 {
+		runtime.Gosched()
+	}
+	select {
+	case <-promise.Ready:
+		c.Fatal("unexpected resolution during cool-off")
+	default:
+	}
+
+	// Advancing through most of the cool-off has no effect. Advancing through
+	// the remainder triggers a retry.
+	clock.Advance(writeServiceCoolOffTimeout - time.Millisecond)
+	c.Check(clock.Waiters(), gc.Equals, 1)
+	clock.Advance(time.Millisecond)
+
+	<-promise.Ready
+	c.Check(promise.Error, gc.IsNil)
+	c.Check(promise.WriteHead, gc.Equals, int64(1234))
+
+	writer.Stop()
+	mockClient.AssertExpectations(c)
+}
+
+func (s *WriteServiceSuite) TestAppendTimeout(c *gc.C) {
+	var mockClient mockHttpClient
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockClient
+	client.locationCache.Add("/a/journal", newURL("http://server/a/journal"))
+
+	var clock = journal.NewManualClock(time.Unix(1234, 0))
+	var failedCh = make(chan error, 1)
+
+	writer := NewWriteService(client)
+	writer.SetConcurrency(1)
+	writer.SetClock(clock)
+	writer.SetAppendTimeout(time.Minute)
+	writer.SetRetryLimit(0, func(name journal.Name, err error) {
+		c.Check(name, gc.Equals, journal.Name("a/journal"))
+		failedCh <- err
+	})
+
+	// The broker accepts the append, but never responds. The request is
+	// aborted only by cancellation of its context.
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT" && request.URL.Path == "/a/journal"
+	})).Run(func(args mock.Arguments) {
+		<-args.Get(0).(*http.Request).Context().Done()
+	}).Return(nil, errors.New("request canceled")).Once()
+
+	var timeouts = func() float64 {
+		var m dto.Metric
+		var counter = metrics.GazetteWriteAppendTimeoutsTotal.WithLabelValues("a/journal")
+		c.Assert(counter.Write(&m), gc.IsNil)
+		return m.GetCounter().GetValue()
+	}
+	var priorTimeouts = timeouts()
+
+	promise, err := writer.Write("a/journal", []byte("foo"))
+	c.Check(err, gc.IsNil)
+	writer.Start()
+
+	// Wait for the append to begin, and advance through its timeout.
+	for clock.Waiters() == 0 {
+		runtime.Gosched()
+	}
+	clock.Advance(time.Minute)
+
+	<-promise.Ready
+	c.Check(promise.Error, gc.Equals, ErrAppendTimeout)
+	c.Check(<-failedCh, gc.Equals, ErrAppendTimeout)
+	c.Check(timeouts(), gc.Equals, priorTimeouts+1)
+
+	// Further writes to the journal fail, rather than being re-ordered.
+	_, err = writer.Write("a/journal", []byte("bar"))
+	c.Check(err, gc.Equals, ErrAppendTimeout)
+	c.Check(writer.JournalError("a/journal"), gc.Equals, ErrAppendTimeout)
+
+	writer.Stop()
+	mockClient.AssertExpectations(c)
+}
+
+func (s *WriteServiceSuite) TestAppendTimeoutOverride(c *gc.C) {
+	var mockClient mockHttpClient
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockClient
+	client.locationCache.Add("/a/journal", newURL("http://server/a/journal"))
+
+	var clock = journal.NewManualClock(time.Unix(1234, 0))
+
+	writer := NewWriteService(client)
+	writer.SetConcurrency(1)
+	writer.SetClock(clock)
+
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT" && request.URL.Path == "/a/journal"
+	})).Run(func(args mock.Arguments) {
+		<-args.Get(0).(*http.Request).Context().Done()
+	}).Return(nil, errors.New("request canceled")).Once()
+
+	// Writes batched into a single append. The smallest timeout applies.
+	promise, err := writer.WriteWithTimeout("a/journal", []byte("foo"), time.Hour)
+	c.Check(err, gc.IsNil)
+	_, err = writer.WriteWithTimeout("a/journal", []byte("bar"), time.Second)
+	c.Check(err, gc.IsNil)
+	writer.Start()
+
+	for clock.Waiters() == 0 {
+		runtime.Gosched()
+	}
+	clock.Advance(time.Second)
+
+	<-promise.Ready
+	c.Check(promise.Error, gc.Equals, ErrAppendTimeout)
+
+	writer.Stop()
+	mockClient.AssertExpectations(c)
+}
+
+func (s *WriteServiceSuite) TestWriteWithToken(c *gc.C) {
+	actualTimeout := writeServiceCoolOffTimeout
+	writeServiceCoolOffTimeout = time.Millisecond
+	defer func() { writeServiceCoolOffTimeout = actualTimeout }()
+
+	var mockClient mockHttpClient
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockClient
+	client.locationCache.Add("/a/journal", newURL("http://server/a/journal"))
+
+	writer := NewWriteService(client)
+	writer.SetConcurrency(1)
+	writer.SetRetryLimit(1, func(journal.Name, error) {})
+
+	// A re-write of a pending token returns its AsyncAppend, and isn't spooled.
+	first, err := writer.WriteWithToken("a/journal", "token", []byte("foo"))
+	c.Check(err, gc.IsNil)
+	second, err := writer.WriteWithToken("a/journal", "token", []byte("foo"))
+	c.Check(err, gc.IsNil)
+	c.Check(second, gc.Equals, first)
+
+	_, err = writer.WriteWithToken("a/journal", "other-token", []byte("bar"))
+	c.Check(err, gc.IsNil)
+
+	var expectPut = func(status int, expect string) {
+		mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+			return request.Method == "PUT" && request.URL.Path == "/a/journal"
+		})).Return(&http.Response{
+			Status:     http.StatusText(status),
+			StatusCode: status,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil).Run(func(args mock.Arguments) {
+			content, _ := ioutil.ReadAll(args[0].(*http.Request).Body)
+			c.Check(string(content), gc.Equals, expect)
+		}).Once()
+	}
+	// The batch fails, and the journal is failed.
+	expectPut(http.StatusInternalServerError, "foobar")
+
+	writer.Start()
+	<-first.Ready
+	c.Check(first.Error, gc.NotNil)
+	writer.ClearJournalError("a/journal")
+
+	// As the prior write failed, "token" may be re-tried. It commits.
+	expectPut(http.StatusNoContent, "foo")
+
+	third, err := writer.WriteWithToken("a/journal", "token", []byte("foo"))
+	c.Check(err, gc.IsNil)
+	c.Check(third, gc.Not(gc.Equals), first)
+	<-third.Ready
+	c.Check(third.Error, gc.IsNil)
+
+	// The committed write is not re-sent.
+	fourth, err := writer.WriteWithToken("a/journal", "token", []byte("foo"))
+	c.Check(err, gc.IsNil)
+	c.Check(fourth, gc.Equals, third)
+
+	writer.Stop()
+	mockClient.AssertExpectations(c)
+}
+
+func (s *WriteServiceSuite) TestCompletionCallback(c *gc.C) {
+	var mockClient mockHttpClient
+
+	client, _ := NewClient("http://server")
+	client.httpClient = &mockClient
+	client.locationCache.Add("/a/journal", newURL("http://server/a/journal"))
+
+	type notification struct {
+		name   journal.Name
+		offset int64
+		err    error
+	}
+	var notifyCh = make(chan notification, 3)
+
+	writer := NewWriteService(client)
+	writer.SetConcurrency(1)
+	writer.SetCompletionCallback(func(name journal.Name, offset int64, err error) {
+		notifyCh <- notification{name, offset, err}
+	})
+
+	for _, content := range []string{"foo", "bar", "bazz"} {
+		_, err := writer.Write("a/journal", []byte(content))
+		c.Check(err, gc.IsNil)
+	}
+	mockClient.On("Do", mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == "PUT" && request.URL.Path == "/a/journal"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNoContent, // Success.
+		Header:     http.Header{WriteHeadHeader: []string{"1234"}},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil).Once()
+
+	writer.Start()
+
+	// Expect a notification for each of the three batched writes, with the
+	// offset at which each write ends. The batch ends at the write head.
+	for _, offset := range []int64{1227, 1230, 1234} {
+		c.Check(<-notifyCh, gc.DeepEquals, notification{"a/journal", offset, nil})
+	}
+	writer.Stop()
+
+	mockClient.AssertExpectations(c)
+}
+
 var _ = gc.Suite(&WriteServiceSuite{})
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"flag"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -13,14 +15,17 @@ import (
 	"time"
 
 	etcd "github.com/coreos/etcd/client"
+	"github.com/coreos/etcd/clientv3"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	"golang.org/x/net/trace"
 	"google.golang.org/api/gensupport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
-	"github.com/LiveRamp/gazette/cloudstore"
+	"github.com/LiveRamp/gazette/consensus"
 	"github.com/LiveRamp/gazette/envflagfactory"
 	"github.com/LiveRamp/gazette/gazette"
 	"github.com/LiveRamp/gazette/journal"
@@ -34,6 +39,39 @@ var (
 		"Local directory for journal spools")
 
 	replicaCount = flag.Int("replicaCount", 2, "Number of required journal replicas")
+
+	grpcAddr = flag.String("grpcAddr", ":8082", "Address at which the Broker gRPC API is served")
+
+	retention = flag.String("retention", "",
+		"Comma-separated journal prefix=maxAge:maxBytes retention policies, under which "+
+			"persisted fragments of matched journals are pruned (eg, \"logs/=720h:\")")
+
+	tlsCertFile = flag.String("tlsCertFile", "",
+		"PEM-encoded certificate of the broker. If set (with tlsKeyFile), the HTTP and "+
+			"gRPC APIs are served over TLS, and the broker routes as an https:// endpoint")
+	tlsKeyFile = flag.String("tlsKeyFile", "", "PEM-encoded private key of tlsCertFile")
+	tlsCAFile  = flag.String("tlsCAFile", "",
+		"PEM-encoded CA bundle. If set, clients (including peer brokers) must present a "+
+			"certificate signed by it, and peer brokers are verified against it")
+
+	authKeyFile = flag.String("authKeyFile", "",
+		"File holding a shared HMAC key. If set, requests must present a bearer token "+
+			"(a JWT signed with HS256 by the key) whose claims grant the request's verb "+
+			"for a prefix of its journal")
+
+	etcdAPI = flag.String("etcdAPI", "v2",
+		"Etcd API used for coordination, one of \"v2\" or \"v3\". With \"v3\", the broker "+
+			"keyspace is stored in the v3 keyspace of the cluster (see consensus.NewV3KeysAPI). "+
+			"All brokers of the cluster must use the same API")
+	etcdMigrate = flag.Bool("etcdMigrate", false,
+		"With -etcdAPI=v3, copy the v2 keyspace of brokers (excluding ephemeral "+
+			"members and locks) into the v3 keyspace before starting")
+
+	fragmentStores = flag.String("fragmentStores", "",
+		"Comma-separated journal prefix=URL routes of fragment stores, overriding "+
+			"the cloud filesystem for matched journals (eg, \"foo/=s3://bucket/prefix/\"). "+
+			"A \"codec\" URL query argument of any store selects fragment compression "+
+			"(one of none, gzip, zstd, or snappy)")
 )
 
 // In order for a brokered Journal to be handed off, it must have regular
@@ -51,20 +89,59 @@ func main() {
 	mainboilerplate.Initialize()
 
 	prometheus.MustRegister(metrics.GazetteCollectors()...)
+	prometheus.MustRegister(metrics.GazetteServerCollectors()...)
 	gensupport.RegisterHook(traceRequests)
 
+	var serverTLS *tls.Config
+	if *tlsCertFile != "" {
+		var err error
+		if serverTLS, err = gazette.NewServerTLSConfig(*tlsCertFile, *tlsKeyFile, *tlsCAFile); err != nil {
+			log.WithField("err", err).Fatal("failed to load server TLS configuration")
+		}
+		// Peers are replicated to with our own certificate.
+		clientTLS, err := gazette.NewClientTLSConfig(*tlsCertFile, *tlsKeyFile, *tlsCAFile)
+		if err != nil {
+			log.WithField("err", err).Fatal("failed to load client TLS configuration")
+		}
+		gazette.SetReplicateClientTLS(clientTLS)
+	}
+
+	var authorizer gazette.Authorizer
+	if *authKeyFile != "" {
+		var key, err = ioutil.ReadFile(*authKeyFile)
+		if err != nil {
+			log.WithField("err", err).Fatal("failed to read auth key")
+		}
+		var hmacAuth = gazette.NewHMACAuthorizer(bytes.TrimSpace(key))
+		authorizer = hmacAuth
+
+		// Peers are replicated to with a token we sign ourselves.
+		token, err := hmacAuth.Sign(gazette.TokenClaims{Subject: "gazette", Replicate: []string{""}})
+		if err != nil {
+			log.WithField("err", err).Fatal("failed to sign replication token")
+		}
+		gazette.SetReplicateClientToken(token)
+	}
+
 	var localRoute string
 	if ip, err := routableIP(); err != nil {
 		log.WithField("err", err).Fatal("failed to acquire routable IP")
+	} else if serverTLS != nil {
+		localRoute = url.QueryEscape("https://" + ip.String() + ":8081")
 	} else {
 		localRoute = url.QueryEscape("http://" + ip.String() + ":8081")
 	}
 
 	log.WithFields(log.Fields{
-		"spoolDir":     *spoolDirectory,
-		"replicaCount": *replicaCount,
-		"etcdEndpoint": *etcdEndpoint,
-		"localRoute":   localRoute,
+		"spoolDir":       *spoolDirectory,
+		"replicaCount":   *replicaCount,
+		"etcdEndpoint":   *etcdEndpoint,
+		"localRoute":     localRoute,
+		"fragmentStores": *fragmentStores,
+		"retention":      *retention,
+		"tls":            serverTLS != nil,
+		"auth":           authorizer != nil,
+		"etcdAPI":        *etcdAPI,
 	}).Info("flag configuration")
 
 	// Fail fast if spool directory cannot be created.
@@ -77,16 +154,52 @@ func main() {
 	if err != nil {
 		log.WithField("err", err).Fatal("failed to init etcd client")
 	}
-	keysAPI := etcd.NewKeysAPI(etcdClient)
+	var keysAPI = etcd.NewKeysAPI(etcdClient)
+
+	switch *etcdAPI {
+	case "v2":
+	case "v3":
+		var v2KeysAPI = keysAPI
+		var clientV3, err = clientv3.New(clientv3.Config{
+			Endpoints:   []string{"http://" + *etcdEndpoint},
+			DialTimeout: 10 * time.Second,
+		})
+		if err != nil {
+			log.WithField("err", err).Fatal("failed to init etcd v3 client")
+		}
+		keysAPI = consensus.NewV3KeysAPI(clientV3)
 
-	cfs, err := cloudstore.NewFileSystem(nil, *cloudFSURL)
+		if *etcdMigrate {
+			var count, err = consensus.CopyTree(context.Background(), v2KeysAPI, keysAPI, gazette.ServiceRoot)
+			if err != nil {
+				log.WithField("err", err).Fatal("failed to migrate etcd v2 keyspace")
+			}
+			log.WithField("count", count).Info("migrated etcd v2 keyspace")
+		}
+	default:
+		log.WithField("etcdAPI", *etcdAPI).Fatal("invalid etcdAPI")
+	}
+
+	storeRoutes, err := journal.ParseFragmentStoreRoutes(*fragmentStores)
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to parse fragment store routes")
+	}
+	cfs, err := journal.NewFragmentStore(nil, *cloudFSURL, storeRoutes)
 	if err != nil {
 		log.WithField("err", err).Fatal("failed to initialize cloudstore")
 	}
+	retentionPolicies, err := journal.ParseRetentionPolicies(*retention)
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to parse retention policies")
+	}
 	listener, err := net.Listen("tcp", ":8081")
 	if err != nil {
 		log.WithField("err", err).Fatal("failed to bind listener")
 	}
+	grpcListener, err := net.Listen("tcp", *grpcAddr)
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to bind gRPC listener")
+	}
 
 	persister := gazette.NewPersister(*spoolDirectory, cfs, keysAPI, localRoute)
 	persister.StartPersisting()
@@ -98,7 +211,8 @@ func main() {
 
 	var router = gazette.NewRouter(
 		func(n journal.Name) gazette.JournalReplica {
-			return journal.NewReplica(n, *spoolDirectory, persister, cfs)
+			return journal.NewReplica(n, *spoolDirectory, persister, cfs,
+				retentionPolicies.For(n))
 		},
 	)
 
@@ -124,14 +238,30 @@ func main() {
 		}
 	}()
 
+	var runner = gazette.NewRunner(etcdClient, localRoute, *replicaCount, router)
+	runner.SetKeysAPI(keysAPI)
+
 	var m = mux.NewRouter()
 	gazette.NewCreateAPI(cfs, keysAPI, *replicaCount).Register(m)
+	gazette.NewDeleteAPI(keysAPI).Register(m)
+	gazette.NewDrainAPI(runner).Register(m)
+	gazette.NewFragmentsAPI(cfs).Register(m) // Must precede the ReadAPI.
 	gazette.NewReadAPI(router, cfs).Register(m)
 	gazette.NewReplicateAPI(router).Register(m)
 	gazette.NewWriteAPI(router).Register(m)
 
+	var httpListener net.Listener = keepalive.TCPListener{listener.(*net.TCPListener)}
+	if serverTLS != nil {
+		httpListener = tls.NewListener(httpListener, serverTLS)
+	}
+
+	var handler http.Handler = m
+	if authorizer != nil {
+		handler = gazette.NewAuthorizingHandler(authorizer, m)
+	}
+
 	go func() {
-		err := http.Serve(keepalive.TCPListener{listener.(*net.TCPListener)}, m)
+		err := http.Serve(httpListener, handler)
 
 		if _, ok := err.(net.Error); ok {
 			return // Don't log on listener.Close.
@@ -139,11 +269,33 @@ func main() {
 		log.WithField("err", err).Error("http.Serve failed")
 	}()
 
-	var runner = gazette.NewRunner(etcdClient, localRoute, *replicaCount, router)
+	var grpcOpts []grpc.ServerOption
+	if serverTLS != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(serverTLS)))
+	}
+	var grpcServer = grpc.NewServer(grpcOpts...)
+	var brokerAPI = gazette.NewBrokerAPI(router, cfs)
+	brokerAPI.SetAuthorizer(authorizer)
+	brokerAPI.Register(grpcServer)
+
+	go func() {
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			log.WithField("err", err).Error("grpcServer.Serve failed")
+		}
+	}()
+
+	// Run until drained (by SIGTERM or the DrainAPI), at which point all
+	// journals have been handed off to peers.
 	if err := runner.Run(); err != nil {
 		log.WithField("err", err).Error("runner.Run() failed")
 	}
+	// Wait for replicas to close their spools, and then for the persister to
+	// flush them to the fragment store. Otherwise, spools are recovered and
+	// persisted again on restart.
+	router.Shutdown()
+
 	listener.Close()
+	grpcServer.Stop()
 
 	persister.Stop()
 	log.Info("service stop complete")
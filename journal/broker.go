@@ -119,6 +119,7 @@ func (b *Broker) loop() {
 			}
 		}
 	}
+	metrics.GazetteServerWriteHead.DeleteLabelValues(b.journal.String())
 	log.WithField("journal", b.journal).Debug("broker exiting")
 	close(b.stop)
 }
@@ -247,6 +248,8 @@ func (b *Broker) phaseTwo(writers []WriteCommitter, op AppendOp) error {
 
 		metrics.CommittedBytesTotal.Add(float64(commitDelta))
 		metrics.CoalescedAppendsTotal.Add(float64(len(pending)))
+		metrics.GazetteServerWriteHead.WithLabelValues(b.journal.String()).
+			Set(float64(b.config.WriteHead))
 	}
 	if sawError == nil {
 		// The transacton was fully replicated. Notify client(s) of success and
@@ -6,6 +6,9 @@ import (
 	"testing/iotest"
 
 	gc "github.com/go-check/check"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/LiveRamp/gazette/metrics"
 )
 
 type BrokerSuite struct {
@@ -87,6 +90,11 @@ func (s *BrokerSuite) TestBasicFixture(c *gc.C) {
 
 	c.Check(s.broker.config.WriteHead, gc.Equals, int64(12365))
 	c.Check(s.broker.config.writtenSinceRoll, gc.Equals, int64(20))
+
+	// The exported write head was updated.
+	var m dto.Metric
+	c.Check(metrics.GazetteServerWriteHead.WithLabelValues("a/journal").Write(&m), gc.IsNil)
+	c.Check(m.GetGauge().GetValue(), gc.Equals, float64(12365))
 }
 
 func (s *BrokerSuite) TestSomeCommitErrorsHandling(c *gc.C) {
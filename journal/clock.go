@@ -0,0 +1,93 @@
+package journal
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts the passage of time, such that timers and deadlines of
+// readers and writers may be driven deterministically by tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel which receives the current time once duration
+	// |d| has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is a Clock of the system time, and the default of Clock users.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return timeNow() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ManualClock is a Clock which advances only as directed by Advance. It's
+// intended for testing.
+type ManualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []manualWaiter
+}
+
+type manualWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewManualClock returns a ManualClock initialized to |now|.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the current time of the ManualClock.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// After returns a channel which receives once the ManualClock has been
+// Advanced by at least |d|. A non-positive |d| receives immediately.
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ch = make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+	} else {
+		c.waiters = append(c.waiters, manualWaiter{at: c.now.Add(d), ch: ch})
+	}
+	return ch
+}
+
+// Advance moves the ManualClock forward by |d|, firing channels of After
+// calls which have elapsed.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	var remaining = c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			remaining = append(remaining, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = remaining
+}
+
+// Waiters returns the number of After calls which are yet to fire. Tests may
+// use it to synchronize with a goroutine which is waiting on the ManualClock.
+func (c *ManualClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
@@ -0,0 +1,87 @@
+package journal
+
+import (
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"time"
+
+	gc "github.com/go-check/check"
+)
+
+type ClockSuite struct{}
+
+func (s *ClockSuite) TestManualClock(c *gc.C) {
+	var t0 = time.Unix(1234, 0)
+	var clock = NewManualClock(t0)
+
+	c.Check(clock.Now(), gc.Equals, t0)
+
+	var immediate = clock.After(0)
+	var first, second = clock.After(time.Second), clock.After(2 * time.Second)
+	c.Check(<-immediate, gc.Equals, t0)
+	c.Check(clock.Waiters(), gc.Equals, 2)
+
+	clock.Advance(time.Second)
+	c.Check(<-first, gc.Equals, t0.Add(time.Second))
+	c.Check(clock.Waiters(), gc.Equals, 1)
+
+	select {
+	case <-second:
+		c.Fatal("unexpected fire")
+	default:
+	}
+
+	clock.Advance(5 * time.Second)
+	c.Check(<-second, gc.Equals, t0.Add(6*time.Second))
+	c.Check(clock.Now(), gc.Equals, t0.Add(6*time.Second))
+	c.Check(clock.Waiters(), gc.Equals, 0)
+}
+
+func (s *ClockSuite) TestRetryReaderUsesClock(c *gc.C) {
+	var clock = NewManualClock(time.Unix(1234, 0))
+
+	getter := &MockGetter{}
+	rr := NewRetryReader(Mark{"a/journal", 0}, getter)
+	rr.EOFTimeout = time.Second
+	rr.Clock = clock
+
+	// Expect the read deadline is derived from |clock|.
+	getter.On("Get", ReadArgs{Journal: "a/journal", Offset: 0,
+		Deadline: time.Unix(1235, 0)}).
+		Return(ReadResult{Offset: 0}, ioutil.NopCloser(iotestErrReader{})).Once()
+
+	var buf [8]byte
+	var n, err = rr.Read(buf[:])
+	c.Check(n, gc.Equals, 0)
+	c.Check(err, gc.IsNil) // Read error is masked, and a cool-off begins.
+
+	// Expect the next read blocks until |clock| passes the cool-off.
+	getter.On("Get", ReadArgs{Journal: "a/journal", Offset: 0,
+		Deadline: time.Unix(1234, 0).Add(retryReaderErrCooloff + time.Second)}).
+		Return(ReadResult{Offset: 0}, ioutil.NopCloser(strings.NewReader("foo"))).Once()
+
+	var done = make(chan struct{})
+	go func() {
+		n, err = rr.Read(buf[:])
+		close(done)
+	}()
+
+	for clock.Waiters() == 0 {
+		runtime.Gosched()
+	}
+	clock.Advance(retryReaderErrCooloff)
+	<-done
+
+	c.Check(err, gc.IsNil)
+	c.Check(string(buf[:n]), gc.Equals, "foo")
+	getter.AssertExpectations(c)
+}
+
+// iotestErrReader fails all reads.
+type iotestErrReader struct{}
+
+func (iotestErrReader) Read([]byte) (int, error) { return 0, io.ErrClosedPipe }
+
+var _ = gc.Suite(&ClockSuite{})
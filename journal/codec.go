@@ -0,0 +1,145 @@
+package journal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/DataDog/zstd"
+	"github.com/golang/snappy"
+)
+
+// CompressionCodec is a compression format of persisted Fragment content.
+// The codec of a persisted Fragment is recorded as an extension of its
+// ContentName, so that readers may transparently decompress it.
+type CompressionCodec int
+
+const (
+	// Content is not compressed.
+	CompressionNone CompressionCodec = iota
+	// Content is compressed with gzip, and has extension ".gz".
+	CompressionGzip
+	// Content is compressed with Zstandard, and has extension ".zst".
+	CompressionZstd
+	// Content is compressed with the Snappy framing format, and has
+	// extension ".sz".
+	CompressionSnappy
+)
+
+var codecNames = map[CompressionCodec]string{
+	CompressionNone:   "none",
+	CompressionGzip:   "gzip",
+	CompressionZstd:   "zstd",
+	CompressionSnappy: "snappy",
+}
+
+var codecExtensions = map[CompressionCodec]string{
+	CompressionNone:   "",
+	CompressionGzip:   ".gz",
+	CompressionZstd:   ".zst",
+	CompressionSnappy: ".sz",
+}
+
+// ParseCompressionCodec returns the CompressionCodec named by |name|, which is
+// one of "none", "gzip", "zstd", or "snappy". An empty |name| is
+// CompressionNone.
+func ParseCompressionCodec(name string) (CompressionCodec, error) {
+	if name == "" {
+		return CompressionNone, nil
+	}
+	for codec, n := range codecNames {
+		if n == name {
+			return codec, nil
+		}
+	}
+	return CompressionNone, fmt.Errorf("unknown compression codec: %q", name)
+}
+
+func (c CompressionCodec) String() string {
+	if n, ok := codecNames[c]; ok {
+		return n
+	}
+	return fmt.Sprintf("CompressionCodec(%d)", int(c))
+}
+
+// Extension returns the ContentName extension of the CompressionCodec.
+func (c CompressionCodec) Extension() string {
+	return codecExtensions[c]
+}
+
+// NewCompressor returns an io.WriteCloser which compresses content written
+// to it with the CompressionCodec, and writes compressed content to |w|. The
+// returned Writer must be Closed to flush remaining content. It does not
+// Close |w|.
+func (c CompressionCodec) NewCompressor(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w), nil
+	case CompressionSnappy:
+		return snappy.NewBufferedWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unknown compression codec: %s", c)
+	}
+}
+
+// NewDecompressor returns an io.ReadCloser which reads and decompresses
+// CompressionCodec content of |rc|. Closing the returned Reader also Closes
+// |rc|.
+func (c CompressionCodec) NewDecompressor(rc io.ReadCloser) (io.ReadCloser, error) {
+	var dec io.ReadCloser
+	var err error
+
+	switch c {
+	case CompressionNone:
+		return rc, nil
+	case CompressionGzip:
+		dec, err = gzip.NewReader(bufio.NewReader(rc))
+	case CompressionZstd:
+		dec = zstd.NewReader(rc)
+	case CompressionSnappy:
+		dec = ioutil.NopCloser(snappy.NewReader(rc))
+	default:
+		err = fmt.Errorf("unknown compression codec: %s", c)
+	}
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return decompressor{ReadCloser: dec, source: rc}, nil
+}
+
+// codecOfContentName returns the CompressionCodec of the extension of
+// |contentName|, and |contentName| with the extension removed.
+func codecOfContentName(contentName string) (CompressionCodec, string) {
+	for codec, ext := range codecExtensions {
+		if ext != "" && strings.HasSuffix(contentName, ext) {
+			return codec, strings.TrimSuffix(contentName, ext)
+		}
+	}
+	return CompressionNone, contentName
+}
+
+// decompressor is a decompressing ReadCloser which also closes its source.
+type decompressor struct {
+	io.ReadCloser
+	source io.Closer
+}
+
+func (d decompressor) Close() error {
+	var err = d.ReadCloser.Close()
+	if sErr := d.source.Close(); err == nil {
+		err = sErr
+	}
+	return err
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
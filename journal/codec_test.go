@@ -0,0 +1,83 @@
+package journal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	gc "github.com/go-check/check"
+)
+
+type CodecSuite struct{}
+
+func (s *CodecSuite) TestRoundTrip(c *gc.C) {
+	var content = strings.Repeat("highly compressible content! ", 1000)
+
+	for _, codec := range []CompressionCodec{
+		CompressionNone, CompressionGzip, CompressionZstd, CompressionSnappy} {
+
+		var buf bytes.Buffer
+		var w, err = codec.NewCompressor(&buf)
+		c.Assert(err, gc.IsNil)
+
+		_, err = w.Write([]byte(content))
+		c.Check(err, gc.IsNil)
+		c.Check(w.Close(), gc.IsNil)
+
+		if codec != CompressionNone {
+			c.Check(buf.Len() < len(content), gc.Equals, true)
+		}
+
+		r, err := codec.NewDecompressor(ioutil.NopCloser(&buf))
+		c.Assert(err, gc.IsNil)
+		out, err := ioutil.ReadAll(r)
+		c.Check(err, gc.IsNil)
+		c.Check(string(out), gc.Equals, content)
+		c.Check(r.Close(), gc.IsNil)
+
+		// Codecs round-trip through their names.
+		parsed, err := ParseCompressionCodec(codec.String())
+		c.Check(err, gc.IsNil)
+		c.Check(parsed, gc.Equals, codec)
+	}
+
+	var codec, err = ParseCompressionCodec("")
+	c.Check(err, gc.IsNil)
+	c.Check(codec, gc.Equals, CompressionNone)
+
+	_, err = ParseCompressionCodec("lzma")
+	c.Check(err, gc.ErrorMatches, `unknown compression codec: "lzma"`)
+}
+
+func (s *CodecSuite) TestReadingCompressedFragment(c *gc.C) {
+	var dir, err = ioutil.TempDir("", "codec-suite")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(dir)
+
+	store, err := NewFragmentStore(nil, "file://"+dir+"?codec=zstd", nil)
+	c.Assert(err, gc.IsNil)
+	defer store.Close()
+	c.Check(store.CodecFor("a/journal"), gc.Equals, CompressionZstd)
+
+	var fragment = Fragment{Journal: "a/journal", Begin: 100, End: 111, Codec: CompressionZstd}
+	c.Check(strings.HasSuffix(fragment.ContentPath(), ".zst"), gc.Equals, true)
+
+	c.Assert(store.MkdirAll("a/journal", 0750), gc.IsNil)
+	w, err := store.OpenFile(fragment.ContentPath(), os.O_WRONLY|os.O_CREATE, 0640)
+	c.Assert(err, gc.IsNil)
+	zw, _ := CompressionZstd.NewCompressor(w)
+	zw.Write([]byte("hello world"))
+	c.Check(zw.Close(), gc.IsNil)
+	c.Check(w.Close(), gc.IsNil)
+
+	// Readers of the compressed Fragment "seek" by decompressing and discarding.
+	r, err := fragment.ReaderFromOffset(106, store)
+	c.Assert(err, gc.IsNil)
+	content, err := ioutil.ReadAll(r)
+	c.Check(err, gc.IsNil)
+	c.Check(string(content), gc.Equals, "world")
+	c.Check(r.Close(), gc.IsNil)
+}
+
+var _ = gc.Suite(&CodecSuite{})
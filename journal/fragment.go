@@ -24,6 +24,9 @@ type Fragment struct {
 	Journal    Name
 	Begin, End int64
 	Sum        [sha1.Size]byte
+	// Compression of the fragment's persisted content. Local fragments are
+	// never compressed.
+	Codec CompressionCodec
 
 	// Backing file of the fragment, if present locally.
 	File FragmentFile
@@ -34,7 +37,7 @@ type Fragment struct {
 }
 
 func (f Fragment) ContentName() string {
-	return fmt.Sprintf("%016x-%016x-%x", f.Begin, f.End, f.Sum)
+	return fmt.Sprintf("%016x-%016x-%x%s", f.Begin, f.End, f.Sum, f.Codec.Extension())
 }
 func (f *Fragment) ContentPath() string {
 	return f.Journal.String() + "/" + f.ContentName()
@@ -55,8 +58,21 @@ func (f Fragment) ReaderFromOffset(offset int64,
 	if err != nil {
 		return nil, err
 	}
-	_, err = file.Seek(offset-f.Begin, 0)
-	return file, err
+	if f.Codec == CompressionNone {
+		_, err = file.Seek(offset-f.Begin, 0)
+		return file, err
+	}
+	// Compressed content can't be seeked. Decompress and discard through
+	// |offset| instead.
+	rc, err := f.Codec.NewDecompressor(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.CopyN(ioutil.Discard, rc, offset-f.Begin); err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return rc, nil
 }
 
 func (f Fragment) IsLocal() bool {
@@ -76,6 +92,7 @@ func ParseFragment(journal Name, contentName string) (Fragment, error) {
 	var err error
 
 	r.Journal = journal
+	r.Codec, contentName = codecOfContentName(contentName)
 	fields := strings.Split(contentName, "-")
 
 	if len(fields) != 3 {
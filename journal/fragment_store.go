@@ -0,0 +1,217 @@
+package journal
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LiveRamp/gazette/cloudstore"
+)
+
+// FragmentStore is a cloudstore.FileSystem into which Fragments are persisted,
+// and from which persisted Fragments are listed and read. Paths of the
+// FragmentStore are rooted by Journal Name (see Fragment.ContentPath), which
+// allows a FragmentStore to persist Fragments of different Journals to
+// different storage providers.
+type FragmentStore interface {
+	cloudstore.FileSystem
+
+	// StoreFor returns the FileSystem which persists Fragments of |journal|.
+	StoreFor(journal Name) cloudstore.FileSystem
+	// CodecFor returns the CompressionCodec with which Fragments of |journal|
+	// are persisted.
+	CodecFor(journal Name) CompressionCodec
+}
+
+// NewFragmentStore returns a FragmentStore which persists Fragments of each
+// Journal to the FileSystem of the longest Journal Name prefix of |routes|
+// which matches the Journal, or to the FileSystem of |defaultURL| if none do.
+// |routes| maps Journal Name prefixes to FileSystem URLs, and as with
+// cloudstore.NewFileSystem the FileSystem implementation is selected by the
+// URL scheme (eg, "s3://bucket/prefix/", "gs://bucket/prefix/", or
+// "file:///path/to/dir"). An optional "codec" URL query argument selects the
+// CompressionCodec of Fragments persisted to the FileSystem (eg,
+// "s3://bucket/prefix/?codec=zstd").
+func NewFragmentStore(properties cloudstore.Properties, defaultURL string,
+	routes map[string]string) (FragmentStore, error) {
+
+	var store = &fragmentStore{}
+	var byURL = make(map[string]cloudstore.FileSystem)
+
+	var open = func(prefix, rawURL string) (storeRoute, error) {
+		var route = storeRoute{prefix: prefix}
+
+		if u, err := url.Parse(rawURL); err != nil {
+			return route, err
+		} else if route.codec, err = ParseCompressionCodec(u.Query().Get("codec")); err != nil {
+			return route, err
+		}
+		if cfs, ok := byURL[rawURL]; ok {
+			route.cfs = cfs
+			return route, nil
+		}
+		var cfs, err = cloudstore.NewFileSystem(properties, rawURL)
+		if err != nil {
+			return route, err
+		}
+		byURL[rawURL] = cfs
+		store.all = append(store.all, cfs)
+
+		route.cfs = cfs
+		return route, nil
+	}
+
+	var err error
+	if store.fallback, err = open("", defaultURL); err != nil {
+		store.Close()
+		return nil, err
+	}
+	for prefix, rawURL := range routes {
+		if route, err := open(prefix, rawURL); err != nil {
+			store.Close()
+			return nil, err
+		} else {
+			store.routes = append(store.routes, route)
+		}
+	}
+	// Order on descending prefix length, so that the first matched route is
+	// also the most specific one.
+	sort.Sort(routeOrder(store.routes))
+	return store, nil
+}
+
+// ParseFragmentStoreRoutes parses |spec| of the form
+// "prefix=url[,prefix=url...]" into routes suitable for NewFragmentStore. An
+// empty |spec| has no routes.
+func ParseFragmentStoreRoutes(spec string) (map[string]string, error) {
+	var routes = make(map[string]string)
+	if spec == "" {
+		return routes, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		var kv = strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid fragment store route: %q", part)
+		} else if _, ok := routes[kv[0]]; ok {
+			return nil, fmt.Errorf("duplicate fragment store route: %q", kv[0])
+		} else if _, err := url.Parse(kv[1]); err != nil {
+			return nil, err
+		}
+		routes[kv[0]] = kv[1]
+	}
+	return routes, nil
+}
+
+type storeRoute struct {
+	prefix string
+	cfs    cloudstore.FileSystem
+	codec  CompressionCodec
+}
+
+// routeOrder orders storeRoutes on descending prefix length.
+type routeOrder []storeRoute
+
+func (o routeOrder) Len() int           { return len(o) }
+func (o routeOrder) Less(i, j int) bool { return len(o[i].prefix) > len(o[j].prefix) }
+func (o routeOrder) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+
+type fragmentStore struct {
+	fallback storeRoute
+	routes   []storeRoute // Ordered on descending |prefix| length.
+	all      []cloudstore.FileSystem
+}
+
+// routedFile is a cloudstore.File opened via a fragmentStore, which
+// remembers the FileSystem it was opened from.
+type routedFile struct {
+	cloudstore.File
+	cfs cloudstore.FileSystem
+}
+
+func (s *fragmentStore) StoreFor(journal Name) cloudstore.FileSystem {
+	return s.route(journal.String()).cfs
+}
+
+func (s *fragmentStore) CodecFor(journal Name) CompressionCodec {
+	return s.route(journal.String()).codec
+}
+
+func (s *fragmentStore) route(name string) storeRoute {
+	name = strings.TrimPrefix(name, "/")
+
+	for _, r := range s.routes {
+		if strings.HasPrefix(name, r.prefix) {
+			return r
+		}
+	}
+	return s.fallback
+}
+
+func (s *fragmentStore) Open(name string) (http.File, error) {
+	return s.route(name).cfs.Open(name)
+}
+
+func (s *fragmentStore) Close() error {
+	var err error
+	for _, cfs := range s.all {
+		if cErr := cfs.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
+
+func (s *fragmentStore) CopyAtomic(to cloudstore.File, from io.Reader) (int64, error) {
+	// FileSystem implementations expect a File of their own making, so
+	// unwrap |to| and pass it to the FileSystem which opened it.
+	if rf, ok := to.(routedFile); ok {
+		return rf.cfs.CopyAtomic(rf.File, from)
+	}
+	return s.fallback.cfs.CopyAtomic(to, from)
+}
+
+func (s *fragmentStore) MkdirAll(name string, perm os.FileMode) error {
+	return s.route(name).cfs.MkdirAll(name, perm)
+}
+
+func (s *fragmentStore) OpenFile(name string, flag int, perm os.FileMode) (cloudstore.File, error) {
+	var cfs = s.route(name).cfs
+
+	if f, err := cfs.OpenFile(name, flag, perm); err != nil {
+		return nil, err
+	} else {
+		return routedFile{File: f, cfs: cfs}, nil
+	}
+}
+
+// ProducesAuthorizedURL is true only if all routed FileSystems produce
+// authorized URLs.
+func (s *fragmentStore) ProducesAuthorizedURL() bool {
+	for _, cfs := range s.all {
+		if !cfs.ProducesAuthorizedURL() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *fragmentStore) Remove(name string) error {
+	return s.route(name).cfs.Remove(name)
+}
+
+func (s *fragmentStore) ToURL(name, method string, validFor time.Duration) (*url.URL, error) {
+	return s.route(name).cfs.ToURL(name, method, validFor)
+}
+
+// Walk walks the FileSystem routed by |root|. Paths under |root| which route
+// to other FileSystems are not walked.
+func (s *fragmentStore) Walk(root string, walkFn filepath.WalkFunc) error {
+	return s.route(root).cfs.Walk(root, walkFn)
+}
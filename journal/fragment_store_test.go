@@ -0,0 +1,106 @@
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gc "github.com/go-check/check"
+)
+
+type FragmentStoreSuite struct {
+	defaultDir, routedDir string
+}
+
+func (s *FragmentStoreSuite) SetUpTest(c *gc.C) {
+	var err error
+	s.defaultDir, err = ioutil.TempDir("", "fragment-store-suite")
+	c.Assert(err, gc.IsNil)
+	s.routedDir, err = ioutil.TempDir("", "fragment-store-suite")
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *FragmentStoreSuite) TearDownTest(c *gc.C) {
+	os.RemoveAll(s.defaultDir)
+	os.RemoveAll(s.routedDir)
+}
+
+func (s *FragmentStoreSuite) TestRoutingByJournalPrefix(c *gc.C) {
+	var store, err = NewFragmentStore(nil, "file://"+s.defaultDir, map[string]string{
+		"routed/":         "file://" + s.routedDir,
+		"routed/default/": "file://" + s.defaultDir,
+	})
+	c.Assert(err, gc.IsNil)
+	defer store.Close()
+
+	var persist = func(journal Name) {
+		var fragment = Fragment{Journal: journal, Begin: 0, End: 5}
+
+		c.Assert(store.MkdirAll(journal.String(), 0750), gc.IsNil)
+		var w, err = store.OpenFile(fragment.ContentPath(),
+			os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+		c.Assert(err, gc.IsNil)
+
+		_, err = store.CopyAtomic(w, strings.NewReader("hello"))
+		c.Assert(err, gc.IsNil)
+	}
+	persist("a/journal")
+	persist("routed/journal")
+	persist("routed/default/journal")
+
+	var expect = func(dir string, journal Name, exists bool) {
+		var _, err = os.Stat(filepath.Join(dir, journal.String()))
+		c.Check(err == nil, gc.Equals, exists, gc.Commentf("%s %s", dir, journal))
+	}
+	expect(s.defaultDir, "a/journal", true)
+	expect(s.routedDir, "a/journal", false)
+	expect(s.defaultDir, "routed/journal", false)
+	expect(s.routedDir, "routed/journal", true)
+	// The longest matching prefix is used.
+	expect(s.defaultDir, "routed/default/journal", true)
+	expect(s.routedDir, "routed/default/journal", false)
+
+	// Persisted Fragments are readable via the store.
+	var fragment = Fragment{Journal: "routed/journal", Begin: 0, End: 5}
+	r, err := fragment.ReaderFromOffset(2, store)
+	c.Assert(err, gc.IsNil)
+	content, err := ioutil.ReadAll(r)
+	c.Check(err, gc.IsNil)
+	c.Check(string(content), gc.Equals, "llo")
+
+	url, err := fragment.AsDirectURL(store, 0)
+	c.Check(err, gc.IsNil)
+	c.Check(url.Path, gc.Equals, filepath.Join(s.routedDir, fragment.ContentPath()))
+
+	// FileSystems of the same URL are shared.
+	c.Check(store.StoreFor("a/journal"), gc.Equals, store.StoreFor("routed/default/journal"))
+	c.Check(store.StoreFor("a/journal"), gc.Not(gc.Equals), store.StoreFor("routed/journal"))
+}
+
+func (s *FragmentStoreSuite) TestUnsupportedScheme(c *gc.C) {
+	var _, err = NewFragmentStore(nil, "file://"+s.defaultDir, map[string]string{
+		"routed/": "unknown://container/prefix",
+	})
+	c.Check(err, gc.ErrorMatches, "filesystem not supported: unknown://container/prefix")
+}
+
+func (s *FragmentStoreSuite) TestParsingRoutes(c *gc.C) {
+	var routes, err = ParseFragmentStoreRoutes("")
+	c.Check(err, gc.IsNil)
+	c.Check(routes, gc.HasLen, 0)
+
+	routes, err = ParseFragmentStoreRoutes("foo/=s3://bucket/prefix/,bar/=gs://other/")
+	c.Check(err, gc.IsNil)
+	c.Check(routes, gc.DeepEquals, map[string]string{
+		"foo/": "s3://bucket/prefix/",
+		"bar/": "gs://other/",
+	})
+
+	_, err = ParseFragmentStoreRoutes("foo/=s3://bucket,foo/=gs://other")
+	c.Check(err, gc.ErrorMatches, `duplicate fragment store route: "foo/"`)
+	_, err = ParseFragmentStoreRoutes("foo/")
+	c.Check(err, gc.ErrorMatches, `invalid fragment store route: "foo/"`)
+}
+
+var _ = gc.Suite(&FragmentStoreSuite{})
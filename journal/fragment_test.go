@@ -57,6 +57,14 @@ func (s *FragmentSuite) TestParsing(c *gc.C) {
 		Sum:     [sha1.Size]byte{},
 	})
 
+	// Compressed fragment, having a codec extension.
+	fragment, err = ParseFragment("a/journal",
+		"00000000499602d2-7fffffffffffffff-0102030405060708090a0b0c0d0e0f1011121314.sz")
+	c.Assert(err, gc.IsNil)
+	c.Assert(fragment.Codec, gc.Equals, CompressionSnappy)
+	c.Assert(fragment.ContentName(), gc.Equals,
+		"00000000499602d2-7fffffffffffffff-0102030405060708090a0b0c0d0e0f1011121314.sz")
+
 	_, err = ParseFragment("a/journal",
 		"00000000499602d2-7fffffffffffffff-010203040506")
 	c.Assert(err, gc.ErrorMatches, "invalid checksum")
@@ -89,8 +89,25 @@ func (w *IndexWatcher) loop() {
 }
 
 func (w *IndexWatcher) onRefresh() error {
+	return walkFragments(w.journal, w.cfs, func(fragment Fragment) {
+		w.updates <- fragment
+	})
+}
+
+// LoadFragmentSet lists the persisted Fragments of |journal| in |cfs|, and
+// returns them as a FragmentSet (which omits Fragments fully covered by
+// others).
+func LoadFragmentSet(journal Name, cfs cloudstore.FileSystem) (FragmentSet, error) {
+	var set FragmentSet
+	var err = walkFragments(journal, cfs, func(fragment Fragment) { set.Add(fragment) })
+	return set, err
+}
+
+// walkFragments lists the fragment directory of |journal| in |cfs|, invoking
+// |fn| with each parsed Fragment.
+func walkFragments(journal Name, cfs cloudstore.FileSystem, fn func(Fragment)) error {
 	// Open the fragment directory.
-	var dir, err = w.cfs.Open(w.journal.String())
+	var dir, err = cfs.Open(journal.String())
 	if os.IsNotExist(err) {
 		// Non-existent directories are permitted. In theory, we should be stricter
 		// here because the CreateAPI first makes the journal fragment directory.
@@ -112,7 +129,7 @@ func (w *IndexWatcher) onRefresh() error {
 				continue
 			}
 
-			fragment, err := ParseFragment(w.journal, file.Name())
+			fragment, err := ParseFragment(journal, file.Name())
 			if err != nil {
 				log.WithFields(log.Fields{"path": file.Name(), "err": err}).
 					Warning("failed to parse content-name")
@@ -125,7 +142,7 @@ func (w *IndexWatcher) onRefresh() error {
 			}
 
 			fragment.RemoteModTime = file.ModTime()
-			w.updates <- fragment
+			fn(fragment)
 		}
 
 		if err == io.EOF {
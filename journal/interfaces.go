@@ -1,9 +1,11 @@
 package journal
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 // A typed journal name. By convention, journals are named using a forward-
@@ -16,6 +18,36 @@ func (n Name) String() string {
 	return string(n)
 }
 
+// Validate returns an error if the Name is not a valid journal name. A Name is
+// a forward-slash delimited path of one or more segments. It may not begin or
+// end with a slash, and segments may not be empty, "." or "..". Brokers clean
+// the paths of created journals: these rules ensure a Name is unchanged by
+// cleaning, and are also enforced by brokers upon journal creation.
+func (n Name) Validate() error {
+	if len(n) == 0 {
+		return fmt.Errorf("invalid journal name %q (must not be empty)", n)
+	}
+	for _, segment := range strings.Split(string(n), "/") {
+		if segment == "" {
+			return fmt.Errorf("invalid journal name %q (leading, trailing, or repeated slash)", n)
+		} else if segment == "." || segment == ".." {
+			return fmt.Errorf("invalid journal name %q (relative path segment %q)", n, segment)
+		}
+	}
+	return nil
+}
+
+// Parent returns the namespace containing the Name, which is the Name through
+// its final forward-slash. The Parent of a single-segment Name is empty.
+// For example, the Parent of "company-journals/topic/part-1234" is
+// "company-journals/topic".
+func (n Name) Parent() Name {
+	if i := strings.LastIndexByte(string(n), '/'); i != -1 {
+		return n[:i]
+	}
+	return ""
+}
+
 // A Mark references a specific |Offset| within a |Journal|.
 type Mark struct {
 	Journal Name
@@ -30,7 +62,9 @@ func NewMark(name Name, offset int64) Mark {
 type Writer interface {
 	// Appends |buffer| to |journal|. Either all of |buffer| is written, or none
 	// of it is. Returns a Promise which is resolved when the write has been
-	// fully committed.
+	// fully committed. Many writes may be pending at once: writes of a journal
+	// commit in the order they were made, and each Promise resolves with the
+	// journal region of its write (see AsyncAppend).
 	Write(journal Name, buffer []byte) (*AsyncAppend, error)
 
 	// Appends |r|'s content to |journal|, by reading until io.EOF. Either all of
@@ -44,6 +78,14 @@ type Getter interface {
 	Get(args ReadArgs) (ReadResult, io.ReadCloser)
 }
 
+// A ReadCloser is a continuous stream of journal content, beginning at a
+// requested offset. Offset returns the journal offset of the next byte to be
+// read, and is suitable for checkpointing by the caller. See gazette.Client.Open.
+type ReadCloser interface {
+	io.ReadCloser
+	Offset() int64
+}
+
 // Performs a Gazette HEAD operation.
 type Header interface {
 	Head(args ReadArgs) (result ReadResult, fragmentLocation *url.URL)
@@ -0,0 +1,42 @@
+package journal
+
+import (
+	gc "github.com/go-check/check"
+)
+
+type NameSuite struct{}
+
+func (s *NameSuite) TestValidation(c *gc.C) {
+	for _, name := range []Name{
+		"a",
+		"a/journal",
+		"pippio-journals/integration-tests/recovery-log",
+		"company_journals/topic.v2/part=001+b",
+		"legacy/journal:with%escapes",
+		"a/..journal/.v2",
+	} {
+		c.Check(name.Validate(), gc.IsNil)
+	}
+
+	for _, tc := range []struct {
+		name Name
+		err  string
+	}{
+		{"", `invalid journal name "" \(must not be empty\)`},
+		{"/a/journal", `.* \(leading, trailing, or repeated slash\)`},
+		{"a/journal/", `.* \(leading, trailing, or repeated slash\)`},
+		{"a//journal", `.* \(leading, trailing, or repeated slash\)`},
+		{"a/../journal", `.* \(relative path segment "\.\."\)`},
+		{"./journal", `.* \(relative path segment "\."\)`},
+	} {
+		c.Check(tc.name.Validate(), gc.ErrorMatches, tc.err)
+	}
+}
+
+func (s *NameSuite) TestParent(c *gc.C) {
+	c.Check(Name("company-journals/topic/part-1234").Parent(), gc.Equals, Name("company-journals/topic"))
+	c.Check(Name("company-journals/topic").Parent(), gc.Equals, Name("company-journals"))
+	c.Check(Name("company-journals").Parent(), gc.Equals, Name(""))
+}
+
+var _ = gc.Suite(&NameSuite{})
@@ -68,6 +68,9 @@ type RetryReader struct {
 	EOFTimeout time.Duration
 	// Result of the most recent read.
 	Result ReadResult
+	// Clock used for read deadlines, and to cool off after read errors.
+	// If nil, SystemClock is used.
+	Clock Clock
 
 	getter  Getter
 	cooloff bool
@@ -82,7 +85,7 @@ func NewRetryReader(mark Mark, getter Getter) *RetryReader {
 
 func (rr *RetryReader) Read(p []byte) (int, error) {
 	if rr.cooloff {
-		time.Sleep(retryReaderErrCooloff)
+		<-rr.clock().After(retryReaderErrCooloff)
 		rr.cooloff = false
 	}
 
@@ -125,6 +128,13 @@ func (rr *RetryReader) Read(p []byte) (int, error) {
 	return n, nil
 }
 
+func (rr *RetryReader) clock() Clock {
+	if rr.Clock != nil {
+		return rr.Clock
+	}
+	return SystemClock
+}
+
 func (rr *RetryReader) open() (ReadArgs, error) {
 	var args = ReadArgs{
 		Journal:  rr.Mark.Journal,
@@ -132,7 +142,7 @@ func (rr *RetryReader) open() (ReadArgs, error) {
 		Blocking: rr.EOFTimeout == 0,
 	}
 	if rr.EOFTimeout != 0 {
-		args.Deadline = timeNow().Add(rr.EOFTimeout)
+		args.Deadline = rr.clock().Now().Add(rr.EOFTimeout)
 	}
 
 	rr.Result, rr.ReadCloser = rr.getter.Get(args)
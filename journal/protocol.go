@@ -9,23 +9,29 @@ import (
 	"time"
 )
 
+// Errors of the Journal protocol. Clients receive these from broker responses
+// via ErrorFromResponse, and may compare against them directly.
 var (
+	ErrBrokerUnavailable = errors.New("broker unavailable")
 	ErrExists            = errors.New("journal exists")
 	ErrNotBroker         = errors.New("not journal broker")
 	ErrNotFound          = errors.New("journal not found")
 	ErrNotReplica        = errors.New("not journal replica")
 	ErrNotYetAvailable   = errors.New("offset not yet available")
 	ErrReplicationFailed = errors.New("replication failed")
+	ErrUnauthorized      = errors.New("unauthorized")
 	ErrWrongRouteToken   = errors.New("wrong route token")
 	ErrWrongWriteHead    = errors.New("wrong write head")
 
 	protocolErrors = []error{
+		ErrBrokerUnavailable,
 		ErrExists,
 		ErrNotBroker,
 		ErrNotFound,
 		ErrNotReplica,
 		ErrNotYetAvailable,
 		ErrReplicationFailed,
+		ErrUnauthorized,
 		ErrWrongRouteToken,
 		ErrWrongWriteHead,
 	}
@@ -76,6 +82,10 @@ type ReadArgs struct {
 	Blocking bool
 	// The time at which blocking will expire
 	Deadline time.Time
+	// If non-zero, the maximum number of bytes which may be read. MaxBytes is
+	// enforced by the client, which returns io.EOF from a read body once
+	// |MaxBytes| have been read.
+	MaxBytes int64
 }
 
 type ReadResult struct {
@@ -106,12 +116,24 @@ type AppendArgs struct {
 	// until io.EOF, and abort the append (without committing any content)
 	// if any other error is returned by |Content.Read()|.
 	Content io.Reader
+	// Optional length of |Content|. If non-zero, the append is sent with a
+	// Content-Length of |ContentLength|, and |Content| must produce exactly
+	// that many bytes. Otherwise, the length is determined from |Content| if
+	// it reports one (eg, a bytes.Reader or io.Seeker), and the append is
+	// streamed with chunked encoding only if the length is unknown.
+	ContentLength int64
+	// Optional idempotency token of the append. Brokers don't de-duplicate
+	// appends, but clients track the tokens of appends observed to commit, and
+	// will not re-send an append of an already-committed |Token|.
+	Token string
 }
 
 type AppendResult struct {
 	// Any error that occurred during the append operation (PUT request.)
 	Error error
-	// Write head at the completion of the operation.
+	// Write head at the completion of the operation. On success, appended
+	// content lies entirely before WriteHead, which is durable: it's the
+	// offset through which the journal is committed.
 	WriteHead int64
 	// RouteToken of the Journal. Set on ErrNotBroker.
 	RouteToken
@@ -128,14 +150,33 @@ type AppendOp struct {
 type AsyncAppend struct {
 	// Read-only, and valid only after Ready is signaled.
 	AppendResult
+	// Journal of the append, and the region [Begin, End) of journal offsets
+	// at which its content was committed. Read-only, and valid only after Ready
+	// is signaled without Error. Writers which batch appends resolve each write
+	// with its own region, and the WriteHead of its batch. Writers unable to
+	// determine the region of a write leave Begin and End as zero.
+	Journal    Name
+	Begin, End int64
 	// Signaled with the AppendOp has completed.
 	Ready chan struct{}
 }
 
+// Done returns a channel which is closed when the AsyncAppend has completed.
+// It's equivalent to Ready.
+func (a *AsyncAppend) Done() <-chan struct{} { return a.Ready }
+
+// Wait blocks until the AsyncAppend has completed, and returns its Error.
+func (a *AsyncAppend) Wait() error {
+	<-a.Ready
+	return a.Error
+}
+
 // Maps Journal protocol errors into a unique HTTP status code.
 // Other errors are mapped into http.StatusInternalServerError.
 func StatusCodeForError(err error) int {
 	switch err {
+	case ErrBrokerUnavailable:
+		return http.StatusBadGateway // 502.
 	case ErrExists:
 		return http.StatusConflict // 409.
 	case ErrNotBroker:
@@ -148,6 +189,8 @@ func StatusCodeForError(err error) int {
 		return http.StatusRequestedRangeNotSatisfiable // 416.
 	case ErrReplicationFailed:
 		return http.StatusServiceUnavailable // 503.
+	case ErrUnauthorized:
+		return http.StatusUnauthorized // 401.
 	case ErrWrongRouteToken:
 		return http.StatusProxyAuthRequired // 407.
 	case ErrWrongWriteHead:
@@ -157,15 +200,29 @@ func StatusCodeForError(err error) int {
 	}
 }
 
+// StatusError is an HTTP response status which doesn't map to a Journal
+// protocol error, along with the body of the response.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string { return fmt.Sprintf("%s (%s)", e.Status, e.Body) }
+
 // Maps a HTTP status code into a correponding Journal protocol error, or nil.
-// Unknown status codes are converted into an error.
+// Bad Gateway and Gateway Timeout responses (of a proxy or load balancer
+// unable to reach a broker) map to ErrBrokerUnavailable. Other unknown status
+// codes are converted into a *StatusError. Note that errors of the transport
+// itself (eg, a net.Error) never reach ErrorFromResponse, and should be
+// returned as-is by callers.
 func ErrorFromResponse(response *http.Response) error {
 	switch response.StatusCode {
 	case http.StatusPartialContent:
 		// Successful Read. Leave response body alone.
 		return nil
 	case http.StatusNoContent, http.StatusCreated:
-		// Successful Append, Replicate, or Create. No body expected.
+		// Successful Append, Replicate, Create, or Delete. No body expected.
 		_ = response.Body.Close()
 		return nil
 	default:
@@ -187,15 +244,23 @@ func ErrorFromResponse(response *http.Response) error {
 		return ErrNotYetAvailable
 	case http.StatusServiceUnavailable: // 503.
 		return ErrReplicationFailed
+	case http.StatusUnauthorized: // 401.
+		return ErrUnauthorized
 	case http.StatusProxyAuthRequired: // 407.
 		return ErrWrongRouteToken
 	case http.StatusPreconditionFailed: // 412.
 		return ErrWrongWriteHead
+	case http.StatusBadGateway, http.StatusGatewayTimeout: // 502, 504.
+		return ErrBrokerUnavailable
 	default:
 		if body, err := ioutil.ReadAll(response.Body); err != nil {
 			return err
 		} else {
-			return fmt.Errorf("%s (%s)", response.Status, string(body))
+			return &StatusError{
+				StatusCode: response.StatusCode,
+				Status:     response.Status,
+				Body:       string(body),
+			}
 		}
 	}
 }
@@ -42,7 +42,21 @@ func (s *ProtocolSuite) TestErrorsAsStatusCodes(c *gc.C) {
 		Status:     "error!",
 		Body:       ioutil.NopCloser(bytes.NewBufferString("body")),
 	}
-	c.Check(ErrorFromResponse(&response), gc.ErrorMatches, `error! \(body\)`)
+	var err = ErrorFromResponse(&response)
+	c.Check(err, gc.ErrorMatches, `error! \(body\)`)
+	c.Check(err, gc.DeepEquals, &StatusError{
+		StatusCode: http.StatusTeapot,
+		Status:     "error!",
+		Body:       "body",
+	})
+
+	// A gateway unable to reach a broker.
+	response = http.Response{
+		StatusCode: http.StatusGatewayTimeout,
+		Status:     "504 Gateway Timeout",
+		Body:       ioutil.NopCloser(bytes.NewBufferString("timeout")),
+	}
+	c.Check(ErrorFromResponse(&response), gc.Equals, ErrBrokerUnavailable)
 }
 
 var _ = gc.Suite(&ProtocolSuite{})
@@ -0,0 +1,79 @@
+package journal
+
+import (
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiveRamp/gazette/cloudstore"
+)
+
+const prunerPeriod = 10 * time.Minute
+
+// Pruner periodically expires persisted Fragments of a journal under its
+// RetentionPolicy. Expired Fragments are first pruned from the journal Tail,
+// which advances the earliest readable offset of the journal, and are then
+// removed from the cloud filesystem.
+type Pruner struct {
+	journal Name
+	policy  RetentionPolicy
+	cfs     cloudstore.FileSystem
+	tail    *Tail
+
+	// Fragments pruned from |tail| which have yet to be removed from |cfs|.
+	pending []Fragment
+
+	stop chan struct{}
+}
+
+func NewPruner(journal Name, policy RetentionPolicy, cfs cloudstore.FileSystem,
+	tail *Tail) *Pruner {
+
+	return &Pruner{
+		journal: journal,
+		policy:  policy,
+		cfs:     cfs,
+		tail:    tail,
+		stop:    make(chan struct{}),
+	}
+}
+
+func (p *Pruner) StartPruning() *Pruner {
+	go p.loop()
+	return p
+}
+
+func (p *Pruner) Stop() {
+	p.stop <- struct{}{}
+	<-p.stop // Blocks until loop() exits.
+}
+
+func (p *Pruner) loop() {
+	var ticker = time.NewTicker(prunerPeriod)
+
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+			p.onPrune(time.Now())
+		case <-p.stop:
+			done = true
+		}
+	}
+	ticker.Stop()
+	close(p.stop)
+}
+
+func (p *Pruner) onPrune(now time.Time) {
+	p.pending = append(p.pending, p.tail.Prune(p.policy, now)...)
+
+	var remaining []Fragment
+	for _, fragment := range p.pending {
+		if err := p.cfs.Remove(fragment.ContentPath()); err != nil && !os.IsNotExist(err) {
+			log.WithFields(log.Fields{"path": fragment.ContentPath(), "err": err}).
+				Warn("failed to remove expired fragment")
+			remaining = append(remaining, fragment) // Retry on next prune.
+		}
+	}
+	p.pending = remaining
+}
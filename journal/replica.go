@@ -23,10 +23,14 @@ type Replica struct {
 	head *Head
 	// Brokers transactions which result in replicated writes to the journal.
 	broker *Broker
+	// Prunes expired fragments. Nil if the journal has no RetentionPolicy.
+	pruner *Pruner
+	// Closed upon completion of Shutdown.
+	stopped chan struct{}
 }
 
 func NewReplica(journal Name, localDir string, persister FragmentPersister,
-	cfs cloudstore.FileSystem) *Replica {
+	cfs cloudstore.FileSystem, retention RetentionPolicy) *Replica {
 
 	updates := make(chan Fragment, 1)
 	r := &Replica{
@@ -36,6 +40,10 @@ func NewReplica(journal Name, localDir string, persister FragmentPersister,
 		tail:    NewTail(journal, updates).StartServingOps(),
 		head:    NewHead(journal, localDir, persister, updates),
 		broker:  NewBroker(journal),
+		stopped: make(chan struct{}),
+	}
+	if !retention.IsZero() {
+		r.pruner = NewPruner(journal, retention, cfs, r.tail).StartPruning()
 	}
 
 	// Defer writes until local fragments & the remote index are fully loaded.
@@ -87,14 +95,25 @@ func (r *Replica) StartBrokeringWithPeers(routeToken RouteToken, peers []Replica
 	r.broker.UpdateConfig(config)
 }
 
+// Shutdown begins an asynchronous shutdown of the Replica. The current spool
+// Fragment of the Replica is passed to its FragmentPersister as it completes.
 func (r *Replica) Shutdown() {
 	log.WithField("journal", r.journal).Debug("beginning journal shutdown")
 	go func() {
 		r.broker.Stop()
 		r.head.Stop()
 		r.index.Stop()
+		if r.pruner != nil {
+			r.pruner.Stop()
+		}
 		close(r.updates)
 		r.tail.Stop()
 		log.WithField("journal", r.journal).Debug("completed journal shutdown")
+		close(r.stopped)
 	}()
 }
+
+// WaitForShutdown blocks until a prior Shutdown of the Replica completes.
+func (r *Replica) WaitForShutdown() {
+	<-r.stopped
+}
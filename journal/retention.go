@@ -0,0 +1,108 @@
+package journal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy bounds the persisted content of a Journal which is
+// retained. Persisted Fragments are expired, oldest first, once they were
+// persisted more than |MaxAge| ago, or once the Journal has at least
+// |MaxBytes| of content following the Fragment. A zero-valued bound is
+// unlimited. The most recent Fragment of a Journal is always retained.
+type RetentionPolicy struct {
+	MaxAge   time.Duration
+	MaxBytes int64
+}
+
+// IsZero returns whether the RetentionPolicy retains all content.
+func (p RetentionPolicy) IsZero() bool {
+	return p.MaxAge == 0 && p.MaxBytes == 0
+}
+
+// expiredCount returns the number of leading Fragments of |set| which are
+// expired under the RetentionPolicy as of |now|. Fragments which are not (yet)
+// known to be persisted never expire, nor do Fragments which follow them.
+func (p RetentionPolicy) expiredCount(set FragmentSet, now time.Time) int {
+	if p.IsZero() {
+		return 0
+	}
+	var n int
+	for ; n+1 < len(set); n++ {
+		var f = set[n]
+
+		if f.RemoteModTime.IsZero() {
+			break // Not persisted.
+		}
+		var aged = p.MaxAge != 0 && now.Sub(f.RemoteModTime) > p.MaxAge
+		var excess = p.MaxBytes != 0 && set.EndOffset()-f.End >= p.MaxBytes
+
+		if !aged && !excess {
+			break
+		}
+	}
+	return n
+}
+
+// RetentionPolicies maps Journal Name prefixes to RetentionPolicies.
+type RetentionPolicies map[string]RetentionPolicy
+
+// For returns the RetentionPolicy of the longest prefix of |journal|, or
+// the zero-valued RetentionPolicy if no prefix matches.
+func (p RetentionPolicies) For(journal Name) RetentionPolicy {
+	var policy RetentionPolicy
+	var longest = -1
+
+	for prefix, pp := range p {
+		if len(prefix) > longest && strings.HasPrefix(journal.String(), prefix) {
+			policy, longest = pp, len(prefix)
+		}
+	}
+	return policy
+}
+
+// ParseRetentionPolicies parses |spec| of the form
+// "prefix=maxAge:maxBytes[,prefix=maxAge:maxBytes...]" into
+// RetentionPolicies, where |maxAge| is a time.Duration and |maxBytes| an
+// integer. Either bound may be empty (eg, "logs/=720h:"). An empty |spec| has
+// no policies.
+func ParseRetentionPolicies(spec string) (RetentionPolicies, error) {
+	var policies = make(RetentionPolicies)
+	if spec == "" {
+		return policies, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		var kv = strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid retention policy: %q", part)
+		}
+		var bounds = strings.SplitN(kv[1], ":", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid retention policy: %q", part)
+		}
+
+		var policy RetentionPolicy
+		var err error
+
+		if bounds[0] != "" {
+			if policy.MaxAge, err = time.ParseDuration(bounds[0]); err != nil {
+				return nil, err
+			}
+		}
+		if bounds[1] != "" {
+			if policy.MaxBytes, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		if policy.MaxAge < 0 || policy.MaxBytes < 0 {
+			return nil, fmt.Errorf("invalid retention policy: %q", part)
+		} else if _, ok := policies[kv[0]]; ok {
+			return nil, fmt.Errorf("duplicate retention policy: %q", kv[0])
+		}
+		policies[kv[0]] = policy
+	}
+	return policies, nil
+}
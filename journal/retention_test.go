@@ -0,0 +1,114 @@
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	gc "github.com/go-check/check"
+
+	"github.com/LiveRamp/gazette/cloudstore"
+)
+
+type RetentionSuite struct{}
+
+func (s *RetentionSuite) TestExpiredCount(c *gc.C) {
+	var now = time.Unix(1000000, 0)
+	var set = FragmentSet{
+		{Begin: 0, End: 100, RemoteModTime: now.Add(-4 * time.Hour)},
+		{Begin: 100, End: 200, RemoteModTime: now.Add(-3 * time.Hour)},
+		{Begin: 200, End: 300, RemoteModTime: now.Add(-2 * time.Hour)},
+		{Begin: 300, End: 400}, // Not yet persisted.
+		{Begin: 400, End: 500, RemoteModTime: now.Add(-5 * time.Hour)},
+	}
+
+	c.Check(RetentionPolicy{}.expiredCount(set, now), gc.Equals, 0)
+	c.Check(RetentionPolicy{MaxAge: 150 * time.Minute}.expiredCount(set, now), gc.Equals, 2)
+	c.Check(RetentionPolicy{MaxAge: time.Hour}.expiredCount(set, now), gc.Equals, 3)
+	// Fragments from 300 are retained, as [300, 400) isn't persisted.
+	c.Check(RetentionPolicy{MaxAge: time.Minute}.expiredCount(set, now), gc.Equals, 3)
+
+	c.Check(RetentionPolicy{MaxBytes: 300}.expiredCount(set, now), gc.Equals, 2)
+	c.Check(RetentionPolicy{MaxBytes: 301}.expiredCount(set, now), gc.Equals, 1)
+	// Either bound expires a Fragment.
+	c.Check(RetentionPolicy{MaxAge: 210 * time.Minute, MaxBytes: 301}.
+		expiredCount(set, now), gc.Equals, 1)
+	c.Check(RetentionPolicy{MaxAge: 150 * time.Minute, MaxBytes: 301}.
+		expiredCount(set, now), gc.Equals, 2)
+
+	// The final Fragment is always retained.
+	c.Check(RetentionPolicy{MaxAge: time.Minute}.expiredCount(set[4:], now), gc.Equals, 0)
+}
+
+func (s *RetentionSuite) TestPolicySelectionAndParsing(c *gc.C) {
+	var policies, err = ParseRetentionPolicies("logs/=720h:,logs/keep/=:,topics/=1h:1024")
+	c.Assert(err, gc.IsNil)
+	c.Check(policies, gc.DeepEquals, RetentionPolicies{
+		"logs/":      {MaxAge: 720 * time.Hour},
+		"logs/keep/": {},
+		"topics/":    {MaxAge: time.Hour, MaxBytes: 1024},
+	})
+
+	c.Check(policies.For("logs/a"), gc.Equals, RetentionPolicy{MaxAge: 720 * time.Hour})
+	c.Check(policies.For("logs/keep/a"), gc.Equals, RetentionPolicy{})
+	c.Check(policies.For("topics/a"), gc.Equals, RetentionPolicy{MaxAge: time.Hour, MaxBytes: 1024})
+	c.Check(policies.For("other/a"), gc.Equals, RetentionPolicy{})
+
+	policies, err = ParseRetentionPolicies("")
+	c.Check(err, gc.IsNil)
+	c.Check(policies, gc.HasLen, 0)
+
+	_, err = ParseRetentionPolicies("logs/=720h")
+	c.Check(err, gc.ErrorMatches, `invalid retention policy: "logs/=720h"`)
+	_, err = ParseRetentionPolicies("logs/=:-1")
+	c.Check(err, gc.ErrorMatches, `invalid retention policy: "logs/=:-1"`)
+	_, err = ParseRetentionPolicies("logs/=1h:,logs/=2h:")
+	c.Check(err, gc.ErrorMatches, `duplicate retention policy: "logs/"`)
+	_, err = ParseRetentionPolicies("logs/=bad:")
+	c.Check(err, gc.NotNil)
+}
+
+func (s *RetentionSuite) TestPrunerRemovesExpiredFragments(c *gc.C) {
+	var cfs = cloudstore.NewTmpFileSystem()
+	defer cfs.Close()
+
+	var now = time.Now()
+	var fragments = []Fragment{
+		{Journal: "a/journal", Begin: 0, End: 100, RemoteModTime: now.Add(-2 * time.Hour)},
+		{Journal: "a/journal", Begin: 100, End: 200, RemoteModTime: now.Add(-2 * time.Hour)},
+		{Journal: "a/journal", Begin: 200, End: 300, RemoteModTime: now},
+	}
+	c.Assert(cfs.MkdirAll("a/journal", 0750), gc.IsNil)
+	for _, f := range fragments[1:] {
+		var w, err = cfs.OpenFile(f.ContentPath(), os.O_WRONLY|os.O_CREATE, 0640)
+		c.Assert(err, gc.IsNil)
+		c.Assert(w.Close(), gc.IsNil)
+	}
+
+	var updates = make(chan Fragment)
+	var tail = NewTail("a/journal", updates).StartServingOps()
+	for _, f := range fragments {
+		updates <- f
+	}
+
+	var pruner = NewPruner("a/journal", RetentionPolicy{MaxAge: time.Hour}, cfs, tail)
+	pruner.onPrune(now)
+
+	// The first Fragment was already removed. The second is removed by the
+	// Pruner, and the third is retained.
+	c.Check(pruner.pending, gc.HasLen, 0)
+	var _, err = cfs.Open(fragments[1].ContentPath())
+	c.Check(os.IsNotExist(err), gc.Equals, true)
+	r, err := cfs.Open(fragments[2].ContentPath())
+	c.Check(err, gc.IsNil)
+	_, err = ioutil.ReadAll(r)
+	c.Check(err, gc.IsNil)
+
+	// A subsequent prune has nothing to do.
+	c.Check(tail.Prune(RetentionPolicy{MaxAge: time.Hour}, now), gc.HasLen, 0)
+
+	close(updates)
+	tail.Stop()
+}
+
+var _ = gc.Suite(&RetentionSuite{})
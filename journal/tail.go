@@ -4,6 +4,8 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/LiveRamp/gazette/metrics"
 )
 
 const (
@@ -22,6 +24,11 @@ type Tail struct {
 	readOps   chan ReadOp
 	updates   <-chan Fragment
 	endOffset chan int64
+	pruneOps  chan pruneOp
+
+	// Offset through which the journal has been pruned. Reads of lesser
+	// offsets are advanced to |pruneOffset|.
+	pruneOffset int64
 
 	// Reads which can't (yet) be satisfied by a fragment in |fragments|.
 	blockedReads []ReadOp
@@ -39,6 +46,7 @@ func NewTail(journal Name, updates <-chan Fragment) *Tail {
 		updates:   updates,
 		readOps:   make(chan ReadOp, kReadOpBufferSize),
 		endOffset: make(chan int64),
+		pruneOps:  make(chan pruneOp),
 		stop:      make(chan struct{}),
 	}
 	t.deadline.timer = time.NewTimer(0)
@@ -63,6 +71,22 @@ func (t *Tail) EndOffset() int64 {
 	return <-t.endOffset
 }
 
+// pruneOp is a request to prune Fragments expired under |policy|.
+type pruneOp struct {
+	policy RetentionPolicy
+	now    time.Time
+	result chan []Fragment
+}
+
+// Prune removes Fragments which are expired under |policy| as of |now|, and
+// returns them. Reads of offsets covered only by pruned Fragments are
+// thereafter advanced to the first offset not pruned.
+func (t *Tail) Prune(policy RetentionPolicy, now time.Time) []Fragment {
+	var op = pruneOp{policy: policy, now: now, result: make(chan []Fragment, 1)}
+	t.pruneOps <- op
+	return <-op.result
+}
+
 func (t *Tail) loop() {
 	for t.updates != nil || t.readOps != nil {
 		// Consume available fragment updates prior to serving reads.
@@ -96,10 +120,13 @@ func (t *Tail) loop() {
 			// A zero value t.deadline.next indicates the timer is not in use
 			t.deadline.next = time.Time{}
 			t.wakeBlockedReads(done)
+		case op := <-t.pruneOps:
+			t.onPrune(op)
 		case t.endOffset <- t.fragments.EndOffset():
 		}
 	}
 	close(t.endOffset) // After close(), EndOffset() will thereafter return 0.
+	metrics.GazetteServerFragments.DeleteLabelValues(t.journal.String())
 	log.WithField("journal", t.journal).Debug("tail loop exiting")
 	close(t.stop)
 }
@@ -109,8 +136,12 @@ func (t *Tail) onUpdate(fragment Fragment) {
 		log.WithFields(log.Fields{"fragment.Journal": fragment.Journal,
 			"tail.journal": t.journal}).Error("unexpected fragment journal")
 		return
+	} else if fragment.End <= t.pruneOffset {
+		return // Fragment was previously pruned.
 	}
 	t.fragments.Add(fragment)
+	metrics.GazetteServerFragments.WithLabelValues(t.journal.String()).
+		Set(float64(len(t.fragments)))
 	t.wakeBlockedReads(time.Time{})
 }
 
@@ -122,6 +153,8 @@ func (t *Tail) onRead(op ReadOp) {
 	// Special handling for explicit reads from the journal write head.
 	if op.Offset == -1 {
 		op.Offset = t.fragments.EndOffset()
+	} else if op.Offset < t.pruneOffset {
+		op.Offset = t.pruneOffset
 	}
 
 	// Attempt to find a covering fragment for the read.
@@ -171,6 +204,22 @@ func (t *Tail) onRead(op ReadOp) {
 	}
 }
 
+func (t *Tail) onPrune(op pruneOp) {
+	var n = op.policy.expiredCount(t.fragments, op.now)
+	var expired = append([]Fragment(nil), t.fragments[:n]...)
+
+	if n != 0 {
+		t.pruneOffset = t.fragments[n-1].End
+		t.fragments = append(FragmentSet(nil), t.fragments[n:]...)
+
+		metrics.GazetteServerFragments.WithLabelValues(t.journal.String()).
+			Set(float64(len(t.fragments)))
+		log.WithFields(log.Fields{"journal": t.journal, "offset": t.pruneOffset,
+			"fragments": n}).Info("pruned expired fragments")
+	}
+	op.result <- expired
+}
+
 func (t *Tail) wakeBlockedReads(when time.Time) {
 	woken := t.blockedReads
 	t.blockedReads = nil
@@ -257,6 +257,37 @@ func (s *TailSuite) TestReadFromMiddleSkipsToFirstAvailable(c *gc.C) {
 	}
 }
 
+func (s *TailSuite) TestPruning(c *gc.C) {
+	var now = time.Now()
+	var fragments = []Fragment{
+		{Journal: "a/journal", Begin: 100, End: 200, RemoteModTime: now.Add(-2 * time.Hour)},
+		{Journal: "a/journal", Begin: 200, End: 300, RemoteModTime: now},
+	}
+	for _, f := range fragments {
+		s.updates <- f
+	}
+	c.Check(s.tail.Prune(RetentionPolicy{MaxAge: time.Hour}, now),
+		gc.DeepEquals, fragments[:1])
+
+	// Reads of pruned offsets are advanced to the first offset not pruned.
+	results := make(chan ReadResult)
+	s.tail.Read(ReadOp{
+		ReadArgs: ReadArgs{Journal: "a/journal", Offset: 150},
+		Result:   results})
+	c.Check(<-results, gc.DeepEquals, ReadResult{
+		Offset:    200,
+		WriteHead: 300,
+		Fragment:  fragments[1],
+	})
+
+	// A pruned Fragment which is re-discovered is ignored.
+	s.updates <- fragments[0]
+	s.tail.Read(ReadOp{
+		ReadArgs: ReadArgs{Journal: "a/journal", Offset: 0},
+		Result:   results})
+	c.Check((<-results).Fragment, gc.DeepEquals, fragments[1])
+}
+
 func (s *TailSuite) TestEndOffsetGenerator(c *gc.C) {
 	c.Check(s.tail.EndOffset(), gc.Equals, int64(0))
 	s.updates <- Fragment{Journal: "a/journal", Begin: 100, End: 200}
@@ -11,6 +11,7 @@ const (
 	CommittedBytesTotalKey            = "gazette_committed_bytes_total"
 	FailedCommitsTotalKey             = "gazette_failed_commits_total"
 	ItemRouteDurationSecondsKey       = "gazette_item_route_duration_seconds"
+	RecoveryLogHorizonMarginBytesKey  = "gazette_recoverylog_horizon_margin_bytes"
 	RecoveryLogRecoveredBytesTotalKey = "gazette_recoverylog_recovered_bytes_total"
 )
 
@@ -32,6 +33,10 @@ var (
 		Name: ItemRouteDurationSecondsKey,
 		Help: "Benchmarking of Runner.ItemRoute calls.",
 	})
+	RecoveryLogHorizonMarginBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: RecoveryLogHorizonMarginBytesKey,
+		Help: "Bytes between the first available offset of a recovery log and the horizon required by its published hints.",
+	}, []string{"log"})
 	RecoveryLogRecoveredBytesTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: RecoveryLogRecoveredBytesTotalKey,
 		Help: "Cumulative number of bytes recovered.",
@@ -44,6 +49,7 @@ func GazetteCollectors() []prometheus.Collector {
 		CommittedBytesTotal,
 		FailedCommitsTotal,
 		ItemRouteDurationSeconds,
+		RecoveryLogHorizonMarginBytes,
 		RecoveryLogRecoveredBytesTotal,
 	}
 }
@@ -104,8 +110,12 @@ func GazretentionCollectors() []prometheus.Collector {
 
 // Keys for gazette.Client and gazette.WriteService metrics.
 const (
+	GazetteCircuitBreakerOpenKey        = "gazette_circuit_breaker_open"
 	GazetteDiscardBytesTotalKey         = "gazette_discard_bytes_total"
 	GazetteReadBytesTotalKey            = "gazette_read_bytes_total"
+	GazetteRequestDurationSecondsKey    = "gazette_request_duration_seconds"
+	GazetteWriteAppendTimeoutsTotalKey  = "gazette_write_append_timeouts_total"
+	GazetteWriteBufferBytesKey          = "gazette_write_buffer_bytes"
 	GazetteWriteBytesTotalKey           = "gazette_write_bytes_total"
 	GazetteWriteCountTotalKey           = "gazette_write_count_total"
 	GazetteWriteDurationSecondsTotalKey = "gazette_write_duration_seconds_total"
@@ -114,6 +124,10 @@ const (
 // Collectors for gazette.Client and gazette.WriteService metrics.
 // TODO(rupert): Should prefix be GazetteClient-, "gazette_client_-"?
 var (
+	GazetteCircuitBreakerOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: GazetteCircuitBreakerOpenKey,
+		Help: "Whether the circuit breaker of a broker endpoint is open (1) or closed (0).",
+	}, []string{"endpoint"})
 	GazetteDiscardBytesTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: GazetteDiscardBytesTotalKey,
 		Help: "Cumulative number of bytes read but discarded.",
@@ -122,6 +136,21 @@ var (
 		Name: GazetteReadBytesTotalKey,
 		Help: "Cumulative number of bytes read.",
 	})
+	GazetteRequestDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: GazetteRequestDurationSecondsKey,
+		Help: "Duration of Get, Put, and Head requests, by operation and outcome.",
+		// Spans fast HEAD requests through long-polled reads, which may
+		// legitimately block for many seconds.
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"operation", "outcome"})
+	GazetteWriteAppendTimeoutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: GazetteWriteAppendTimeoutsTotalKey,
+		Help: "Cumulative number of WriteService appends which timed out, by journal.",
+	}, []string{"journal"})
+	GazetteWriteBufferBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: GazetteWriteBufferBytesKey,
+		Help: "Number of bytes spooled by WriteService and not yet acknowledged.",
+	})
 	GazetteWriteBytesTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: GazetteWriteBytesTotalKey,
 		Help: "Cumulative number of bytes written.",
@@ -140,16 +169,63 @@ var (
 // gazette.WriteService.
 func GazetteClientCollectors() []prometheus.Collector {
 	return []prometheus.Collector{
+		GazetteCircuitBreakerOpen,
 		GazetteDiscardBytesTotal,
 		GazetteReadBytesTotal,
+		GazetteRequestDurationSeconds,
+		GazetteWriteAppendTimeoutsTotal,
+		GazetteWriteBufferBytes,
 		GazetteWriteBytesTotal,
 		GazetteWriteCountTotal,
 		GazetteWriteDurationTotal,
 	}
 }
 
+// Keys for gazette broker (server) metrics.
+const (
+	GazetteServerAppendDurationSecondsKey = "gazette_server_append_duration_seconds"
+	GazetteServerFragmentsKey             = "gazette_server_fragments"
+	GazetteServerRequestsTotalKey         = "gazette_server_requests_total"
+	GazetteServerWriteHeadKey             = "gazette_server_write_head"
+)
+
+// Collectors for gazette broker (server) metrics. Per-journal metrics are
+// labeled only with journals which are replicated or brokered by the server.
+var (
+	GazetteServerAppendDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    GazetteServerAppendDurationSecondsKey,
+		Help:    "Duration of append requests served by the broker.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	})
+	GazetteServerFragments = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: GazetteServerFragmentsKey,
+		Help: "Number of local and persisted fragments indexed by a journal replica.",
+	}, []string{"journal"})
+	GazetteServerRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: GazetteServerRequestsTotalKey,
+		Help: "Cumulative number of requests served, by operation and outcome.",
+	}, []string{"operation", "outcome"})
+	GazetteServerWriteHead = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: GazetteServerWriteHeadKey,
+		Help: "Write head of a journal brokered by the server.",
+	}, []string{"journal"})
+)
+
+// GazetteServerCollectors returns the metrics used by the gazette broker.
+func GazetteServerCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		GazetteServerAppendDurationSeconds,
+		GazetteServerFragments,
+		GazetteServerRequestsTotal,
+		GazetteServerWriteHead,
+	}
+}
+
 // Keys for consumer.Runner metrics.
 const (
+	GazetteConsumerCommitBytesKey           = "gazette_consumer_commit_bytes"
+	GazetteConsumerCommitDurationSecondsKey = "gazette_consumer_commit_duration_seconds"
+	GazetteConsumerDuplicateMessagesKey     = "gazette_consumer_duplicate_messages_total"
 	GazetteConsumerTxCountTotalKey          = "gazette_consumer_tx_count_total"
 	GazetteConsumerTxMessagesTotalKey       = "gazette_consumer_tx_messages_total"
 	GazetteConsumerTxSecondsTotalKey        = "gazette_consumer_tx_seconds_total"
@@ -158,9 +234,24 @@ const (
 
 // Collectors for consumer.Runner metrics.
 var (
+	GazetteConsumerCommitBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: GazetteConsumerCommitBytesKey,
+		Help: "Size of committed transaction write batches, in bytes.",
+		// 1KB through 256MB.
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 10),
+	})
+	GazetteConsumerCommitDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    GazetteConsumerCommitDurationSecondsKey,
+		Help:    "Duration from the start of a transaction commit through resolution of its recovery log write barrier.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	})
+	GazetteConsumerDuplicateMessages = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: GazetteConsumerDuplicateMessagesKey,
+		Help: "Cumulative number of stamped messages which were skipped as duplicates.",
+	})
 	GazetteConsumerTxCountTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: GazetteConsumerTxCountTotalKey,
-		Help: "Cumulative number of transactions",
+		Help: "Cumulative number of committed transactions.",
 	})
 	GazetteConsumerTxMessagesTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: GazetteConsumerTxMessagesTotalKey,
@@ -179,9 +270,50 @@ var (
 // GazetteConsumerCollectors returns the metrics used by the consumer package.
 func GazetteConsumerCollectors() []prometheus.Collector {
 	return []prometheus.Collector{
+		GazetteConsumerCommitBytes,
+		GazetteConsumerCommitDurationSeconds,
+		GazetteConsumerDuplicateMessages,
 		GazetteConsumerTxCountTotal,
 		GazetteConsumerTxMessagesTotal,
 		GazetteConsumerTxSecondsTotal,
 		GazetteConsumerTxStalledSecondsTotal,
 	}
 }
+
+// Keys for recoverylog.Recorder metrics.
+const (
+	RecorderAppendedBytesTotalKey  = "gazette_recorder_appended_bytes_total"
+	RecorderBlockedSecondsTotalKey = "gazette_recorder_blocked_seconds_total"
+	RecorderInFlightAppendsKey     = "gazette_recorder_in_flight_appends"
+	RecorderOpsTotalKey            = "gazette_recorder_ops_total"
+)
+
+// Collectors for recoverylog.Recorder metrics, labeled by recovery log.
+var (
+	RecorderAppendedBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: RecorderAppendedBytesTotalKey,
+		Help: "Cumulative number of bytes appended to a recovery log by Recorders.",
+	}, []string{"log"})
+	RecorderBlockedSecondsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: RecorderBlockedSecondsTotalKey,
+		Help: "Cumulative number of seconds database syncs have blocked on recovery log commits.",
+	}, []string{"log"})
+	RecorderInFlightAppends = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: RecorderInFlightAppendsKey,
+		Help: "Number of recovery log appends issued by Recorders which have not yet committed.",
+	}, []string{"log"})
+	RecorderOpsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: RecorderOpsTotalKey,
+		Help: "Cumulative number of file operations recorded to a recovery log.",
+	}, []string{"log"})
+)
+
+// RecorderCollectors returns the metrics used by recoverylog.Recorder.
+func RecorderCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		RecorderAppendedBytesTotal,
+		RecorderBlockedSecondsTotal,
+		RecorderInFlightAppends,
+		RecorderOpsTotal,
+	}
+}
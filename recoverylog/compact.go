@@ -0,0 +1,224 @@
+package recoverylog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Directory of temporary paths to which Compact links Fnodes while their
+// content is re-recorded.
+const compactionDir = "/.compaction"
+
+// Length of content recorded by each Write operation of a re-recorded Fnode.
+var compactChunkSize = 1 << 20
+
+// CompactResult describes Fnodes re-recorded by Recorder.Compact.
+type CompactResult struct {
+	// Number of re-recorded Fnodes, and the total length of their content.
+	Fnodes int
+	Bytes  int64
+	// FSMHints of the Recorder upon completion of compaction. Content of the
+	// recovery log below the horizon of Hints (see CollectGarbage) is no longer
+	// required to play them back.
+	Hints FSMHints
+}
+
+// Compact re-records live Fnodes having operations recorded below recovery
+// log offset |horizon|, so that hints built after compaction reference only
+// log content at or above it. Once compacted hints have been published (see
+// SetHintsJournal), the log range below the horizon may be pruned with
+// CollectGarbage. A typical |horizon| is the current log write head, which
+// compacts all recorded history into the latest portion of the log.
+//
+// The content of each Fnode is read from its path under |localDir| (the
+// recorded directory), and recorded to a new Fnode linked at a temporary path.
+// A single atomic frame then re-links each path of the original Fnode to the
+// new one. Should recording fail part-way, the temporary path is recovered by
+// Players, and is removed by the next Compact. Recording of database
+// operations is blocked only while each chunk of content is recorded.
+//
+// Fnodes which are open for writing (eg, the current WAL or MANIFEST) are
+// not compacted, and continue to hold the horizon of their first recorded
+// operation. Fnodes unlinked while being compacted are skipped.
+func (r *Recorder) Compact(localDir string, horizon int64) (CompactResult, error) {
+	var result CompactResult
+
+	for _, node := range r.compactionCandidates(horizon) {
+		var size, err = r.compactFnode(localDir, node)
+		if err != nil {
+			return result, err
+		} else if size != -1 {
+			result.Fnodes += 1
+			result.Bytes += size
+		}
+	}
+
+	result.Hints = r.BuildHints()
+
+	log.WithFields(log.Fields{
+		"log":     r.fsm.LogMark.Journal,
+		"horizon": horizon,
+		"fnodes":  result.Fnodes,
+		"bytes":   result.Bytes,
+	}).Info("compacted recovery log")
+
+	return result, nil
+}
+
+// compactionCandidates unlinks temporary paths remaining from a prior
+// Compact, and returns live Fnodes not open for writing which have operations
+// recorded below |horizon|, ordered on Fnode.
+func (r *Recorder) compactionCandidates(horizon int64) []Fnode {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	var stale []string
+	for path := range r.fsm.Links {
+		if strings.HasPrefix(path, compactionDir+"/") {
+			stale = append(stale, path)
+		}
+	}
+	sort.Strings(stale)
+
+	for _, path := range stale {
+		r.recordFrame(r.process(RecordedOp{
+			Unlink: &RecordedOp_Link{Fnode: r.fsm.Links[path], Path: path}}, nil))
+	}
+
+	var out []Fnode
+	for fnode, state := range r.fsm.LiveNodes {
+		if _, isOpen := r.openFnodes[fnode]; isOpen || len(state.Segments) == 0 {
+			continue
+		} else if first := state.Segments[0].FirstOffset; first >= 0 && first >= horizon {
+			continue
+		}
+		out = append(out, fnode)
+	}
+	sort.Sort(fnodeOrder(out))
+	return out
+}
+
+// compactFnode re-records |fnode| from its content under |localDir|, and
+// returns its length. If |fnode| is no longer live, -1 is returned.
+func (r *Recorder) compactFnode(localDir string, fnode Fnode) (int64, error) {
+	var file, size, fr, err = r.beginCompaction(localDir, fnode)
+	if err != nil || fr == nil {
+		return -1, err
+	}
+	defer file.Close()
+
+	var chunk = make([]byte, compactChunkSize)
+	for fr.offset != size {
+		if remain := size - fr.offset; remain < int64(len(chunk)) {
+			chunk = chunk[:remain]
+		}
+		if _, err = io.ReadFull(file, chunk); err != nil {
+			return -1, fmt.Errorf("reading %s of fnode %d: %s", file.Name(), fnode, err)
+		}
+
+		r.mu.Lock()
+		fr.append(chunk)
+		r.mu.Unlock()
+	}
+
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	var tmpPath = compactionPath(fnode)
+	var state, ok = r.fsm.LiveNodes[fnode]
+	if !ok {
+		// |fnode| was unlinked while being compacted. Discard its copy.
+		r.recordFrame(r.process(RecordedOp{
+			Unlink: &RecordedOp_Link{Fnode: fr.fnode, Path: tmpPath}}, nil))
+		return -1, nil
+	}
+
+	var links []string
+	for link := range state.Links {
+		links = append(links, link)
+	}
+	sort.Strings(links)
+
+	// Re-link each path from |fnode| to its copy, and remove the temporary
+	// path, as a single atomic frame.
+	r.reserve(2*len(links) + 1)
+
+	var frame []byte
+	for _, link := range links {
+		frame = r.process(RecordedOp{
+			Unlink: &RecordedOp_Link{Fnode: fnode, Path: link}}, frame)
+		frame = r.process(RecordedOp{
+			Link: &RecordedOp_Link{Fnode: fr.fnode, Path: link}}, frame)
+	}
+	frame = r.process(RecordedOp{
+		Unlink: &RecordedOp_Link{Fnode: fr.fnode, Path: tmpPath}}, frame)
+
+	r.recordFrame(frame)
+	return size, nil
+}
+
+// beginCompaction opens the local file of |fnode|, and records the creation
+// of its copy at a temporary path. It returns the opened file, the length of
+// |fnode| content, and a fileRecorder of the copy. If |fnode| is no longer
+// live, the returned fileRecorder is nil.
+func (r *Recorder) beginCompaction(localDir string,
+	fnode Fnode) (*os.File, int64, *fileRecorder, error) {
+
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	var state, ok = r.fsm.LiveNodes[fnode]
+	if !ok {
+		return nil, 0, nil, nil
+	}
+	var links []string
+	for link := range state.Links {
+		links = append(links, link)
+	}
+	sort.Strings(links)
+
+	// The database doesn't modify |fnode| while we hold |r.mu|. Once opened,
+	// the file remains readable even if it's subsequently deleted.
+	var file, err = os.Open(filepath.Join(localDir, links[0]))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var size int64
+	if s, ok := r.fnodeSizes[fnode]; ok {
+		size = s
+	} else if info, err := file.Stat(); err != nil {
+		file.Close()
+		return nil, 0, nil, err
+	} else {
+		// |fnode| was not written by this Recorder, and is not being appended to.
+		size = info.Size()
+	}
+
+	var tmpPath = compactionPath(fnode)
+	r.recordFrame(r.process(RecordedOp{Create: &RecordedOp_Create{Path: tmpPath}}, nil))
+
+	var copied = r.fsm.Links[tmpPath]
+	r.fnodeSizes[copied] = 0
+
+	return file, size, &fileRecorder{Recorder: r, fnode: copied}, nil
+}
+
+// compactionPath returns the temporary path of the copy of |fnode|.
+func compactionPath(fnode Fnode) string {
+	return compactionDir + "/" + strconv.FormatInt(int64(fnode), 10)
+}
+
+// sort.Interface Fnode implementation.
+type fnodeOrder []Fnode
+
+func (o fnodeOrder) Len() int           { return len(o) }
+func (o fnodeOrder) Less(i, j int) bool { return o[i] < o[j] }
+func (o fnodeOrder) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
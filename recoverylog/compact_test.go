@@ -0,0 +1,130 @@
+package recoverylog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gc "github.com/go-check/check"
+)
+
+type CompactSuite struct{}
+
+func (s *CompactSuite) TestCompactAndPlayback(c *gc.C) {
+	defer func(size int) { compactChunkSize = size }(compactChunkSize)
+	compactChunkSize = 3 // Re-record content across multiple operations.
+
+	var recDir, err = ioutil.TempDir("", "compact-recorder")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(recDir)
+
+	var log = NewMemoryClient()
+	fsm, err := NewFSM(FSMHints{Log: aRecoveryLog})
+	c.Assert(err, gc.IsNil)
+	recorder, err := NewRecorder(fsm, len(recDir), log)
+	c.Assert(err, gc.IsNil)
+
+	// Record files, mirroring each operation in |recDir|.
+	var record = func(path, content string, close bool) {
+		c.Assert(ioutil.WriteFile(filepath.Join(recDir, path), []byte(content), 0644), gc.IsNil)
+
+		var f = recorder.NewWritableFile(recDir + path)
+		f.Append([]byte(content))
+		if close {
+			f.Close()
+		}
+	}
+	record("/000001.sst", "first sst", true)
+	record("/000002.sst", "the second sst", true)
+	record("/deleted.sst", "deleted", true)
+	record("/LOG", "open log", false)
+
+	recorder.LinkFile(recDir+"/000002.sst", recDir+"/linked.sst")
+	c.Assert(os.Link(filepath.Join(recDir, "000002.sst"), filepath.Join(recDir, "linked.sst")), gc.IsNil)
+	recorder.DeleteFile(recDir + "/deleted.sst")
+	c.Assert(os.Remove(filepath.Join(recDir, "deleted.sst")), gc.IsNil)
+
+	<-recorder.WriteBarrier().Ready
+	var horizon = log.WriteHead(aRecoveryLog)
+
+	result, err := recorder.Compact(recDir, horizon)
+	c.Assert(err, gc.IsNil)
+	c.Check(result.Fnodes, gc.Equals, 2)
+	c.Check(result.Bytes, gc.Equals, int64(len("first sst")+len("the second sst")))
+
+	// Expect only the open Fnode is still recorded below the horizon.
+	var openFnode = recorder.fsm.Links["/LOG"]
+	c.Check(result.Hints.LiveNodes, gc.HasLen, 3)
+
+	for _, node := range result.Hints.LiveNodes {
+		var first = node.Segments[0].FirstOffset
+
+		if node.Fnode == openFnode {
+			c.Check(first < horizon, gc.Equals, true)
+		} else {
+			c.Check(first >= horizon, gc.Equals, true, gc.Commentf("fnode %d", node.Fnode))
+		}
+	}
+
+	// Compacting again is a no-op.
+	again, err := recorder.Compact(recDir, horizon)
+	c.Check(err, gc.IsNil)
+	c.Check(again.Fnodes, gc.Equals, 0)
+	c.Check(again.Hints, gc.DeepEquals, result.Hints)
+
+	// Compacted hints play back the recorded file state.
+	<-recorder.WriteBarrier().Ready
+
+	playDir, err := ioutil.TempDir("", "compact-player")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(playDir)
+
+	player, err := NewPlayer(result.Hints, playDir)
+	c.Assert(err, gc.IsNil)
+
+	var playErrCh = make(chan error, 1)
+	go func() { playErrCh <- player.Play(log) }()
+
+	var _, _, liveErr = player.MakeLive()
+	c.Check(liveErr, gc.IsNil)
+	c.Check(<-playErrCh, gc.IsNil)
+
+	for path, content := range map[string]string{
+		"000001.sst": "first sst",
+		"000002.sst": "the second sst",
+		"linked.sst": "the second sst",
+		"LOG":        "open log",
+	} {
+		var b, err = ioutil.ReadFile(filepath.Join(playDir, path))
+		c.Check(err, gc.IsNil)
+		c.Check(string(b), gc.Equals, content)
+	}
+	_, err = os.Stat(filepath.Join(playDir, "deleted.sst"))
+	c.Check(os.IsNotExist(err), gc.Equals, true)
+	_, err = os.Stat(filepath.Join(playDir, compactionDir))
+	c.Check(os.IsNotExist(err), gc.Equals, true)
+}
+
+func (s *CompactSuite) TestStaleCompactionPathsAreRemoved(c *gc.C) {
+	var recDir, err = ioutil.TempDir("", "compact-recorder")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(recDir)
+
+	var log = NewMemoryClient()
+	fsm, err := NewFSM(FSMHints{Log: aRecoveryLog})
+	c.Assert(err, gc.IsNil)
+	recorder, err := NewRecorder(fsm, len(recDir), log)
+	c.Assert(err, gc.IsNil)
+
+	// Model a temporary path remaining from a failed compaction.
+	recorder.NewWritableFile(recDir + compactionPath(1)).Close()
+	c.Check(recorder.fsm.Links, gc.HasLen, 1)
+
+	result, err := recorder.Compact(recDir, 0)
+	c.Check(err, gc.IsNil)
+	c.Check(result.Fnodes, gc.Equals, 0)
+	c.Check(recorder.fsm.Links, gc.HasLen, 0)
+	c.Check(result.Hints.LiveNodes, gc.HasLen, 0)
+}
+
+var _ = gc.Suite(&CompactSuite{})
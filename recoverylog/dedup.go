@@ -0,0 +1,177 @@
+package recoverylog
+
+import (
+	"crypto/sha256"
+	"strings"
+)
+
+// SetSSTDedup enables deduplication of SST files having content identical to
+// that of an SST file previously recorded by the Recorder (as produced, eg, by
+// ingestion of the same external file, or a trivial compaction). Rather than
+// appending its content again, the path of a duplicate SST is linked to the
+// Fnode of the existing content, and Players recover the path from that
+// content. Duplicates are detected only by a full match of content size and
+// SHA-256 digest, so that recovered files remain bit-exact.
+//
+// To detect duplicates, content of an SST file is buffered until the file is
+// synced or closed, rather than recorded as it's appended. SST files larger
+// than |maxFileSize| are recorded as they otherwise would be, and bound the
+// memory used for buffering. At most |maxIndexed| digests of recorded SST
+// files are retained, with the oldest evicted first. SetSSTDedup must be
+// called before any SST files are recorded.
+func (r *Recorder) SetSSTDedup(maxFileSize int64, maxIndexed int) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	r.sstIndex = &sstIndex{
+		maxFileSize: maxFileSize,
+		maxIndexed:  maxIndexed,
+		fnodes:      make(map[sstDigest]Fnode),
+	}
+}
+
+// sstDigest identifies SST file content.
+type sstDigest struct {
+	sum  [sha256.Size]byte
+	size int64
+}
+
+func digestOf(content []byte) sstDigest {
+	return sstDigest{sum: sha256.Sum256(content), size: int64(len(content))}
+}
+
+// sstIndex indexes Fnodes of SST files recorded by a Recorder on digest.
+type sstIndex struct {
+	maxFileSize int64
+	maxIndexed  int
+
+	fnodes map[sstDigest]Fnode
+	// Indexed digests, in the order they were added.
+	order []sstDigest
+}
+
+// add indexes |fnode| as having content |digest|, evicting the oldest
+// indexed digest if the index is full.
+func (x *sstIndex) add(digest sstDigest, fnode Fnode) {
+	if _, ok := x.fnodes[digest]; !ok {
+		x.order = append(x.order, digest)
+	}
+	x.fnodes[digest] = fnode
+
+	for len(x.order) > x.maxIndexed {
+		delete(x.fnodes, x.order[0])
+		x.order = x.order[1:]
+	}
+}
+
+// indexedFnode returns the live Fnode having content |digest|, if there is one.
+// |mu| must be held.
+func (r *Recorder) indexedFnode(digest sstDigest) (Fnode, bool) {
+	var fnode, ok = r.sstIndex.fnodes[digest]
+	if !ok {
+		return 0, false
+	}
+	// The indexed Fnode may have since been unlinked from all paths.
+	if _, isLive := r.fsm.LiveNodes[fnode]; !isLive || r.fnodeSizes[fnode] != digest.size {
+		return 0, false
+	}
+	return fnode, true
+}
+
+// isDedupCandidate returns whether |path| is an SST file which may be
+// deduplicated. |mu| must be held.
+func (r *Recorder) isDedupCandidate(path string) bool {
+	return r.sstIndex != nil && strings.HasSuffix(path, ".sst")
+}
+
+// dedupFile is the buffered content of an SST file which may be deduplicated.
+type dedupFile struct {
+	path    string
+	content []byte
+	// Number of leading bytes of |content| which have been recorded.
+	written int
+	// Fnode of identical content to which |path| is linked, or zero if
+	// |path| is linked to the file's own Fnode.
+	linked Fnode
+}
+
+// bufferForDedup buffers |data| appended to a dedup candidate. It returns
+// false if the file may no longer be deduplicated, in which case its buffered
+// content has been recorded, and |data| must be recorded by the caller.
+// |mu| must be held.
+func (r *fileRecorder) bufferForDedup(data []byte) bool {
+	var d = r.dedup
+
+	if d.linked != 0 {
+		// The file is being extended, and is no longer a duplicate of |linked|.
+		// Restore a distinct Fnode of the path, to which buffered content is
+		// recorded. This is unexpected of an SST, but is handled for correctness.
+		r.reserve(2)
+
+		var frame = r.process(RecordedOp{
+			Unlink: &RecordedOp_Link{Fnode: d.linked, Path: d.path}}, nil)
+		frame = r.process(RecordedOp{Create: &RecordedOp_Create{Path: d.path}}, frame)
+		r.recordFrame(frame)
+
+		r.fnode, r.offset = r.fsm.Links[d.path], 0
+		r.fnodeSizes[r.fnode] = 0
+		d.linked, d.written = 0, 0
+	}
+
+	if int64(len(d.content)+len(data)) > r.sstIndex.maxFileSize {
+		r.recordBuffered()
+		r.dedup = nil
+		return false
+	}
+	d.content = append(d.content, data...)
+	return true
+}
+
+// flushDedup links the path of a dedup candidate to an indexed Fnode of
+// identical content, or otherwise records its buffered content. |mu| must
+// be held.
+func (r *fileRecorder) flushDedup() {
+	var d = r.dedup
+
+	if d.linked != 0 {
+		return // Already linked, and not since appended to.
+	} else if d.written == 0 && len(d.content) != 0 {
+		if fnode, ok := r.indexedFnode(digestOf(d.content)); ok {
+			r.reserve(2)
+
+			var frame = r.process(RecordedOp{
+				Unlink: &RecordedOp_Link{Fnode: r.fnode, Path: d.path}}, nil)
+			frame = r.process(RecordedOp{
+				Link: &RecordedOp_Link{Fnode: fnode, Path: d.path}}, frame)
+			r.recordFrame(frame)
+
+			delete(r.fnodeContent, r.fnode)
+			d.linked = fnode
+			return
+		}
+	}
+	r.recordBuffered()
+}
+
+// recordBuffered records buffered content of a dedup candidate which hasn't
+// yet been recorded. |mu| must be held.
+func (r *fileRecorder) recordBuffered() {
+	var d = r.dedup
+
+	if d.written != len(d.content) {
+		r.append(d.content[d.written:])
+		d.written = len(d.content)
+	}
+}
+
+// closeDedup flushes a dedup candidate being closed, and indexes its content
+// if it was recorded. |mu| must be held.
+func (r *fileRecorder) closeDedup() {
+	var d = r.dedup
+	r.flushDedup()
+
+	if d.linked == 0 && len(d.content) != 0 {
+		r.sstIndex.add(digestOf(d.content), r.fnode)
+	}
+	r.dedup = nil
+}
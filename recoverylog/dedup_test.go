@@ -0,0 +1,158 @@
+package recoverylog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gc "github.com/go-check/check"
+)
+
+type DedupSuite struct {
+	dir      string
+	client   *MemoryClient
+	recorder *Recorder
+}
+
+func (s *DedupSuite) SetUpTest(c *gc.C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "dedup-suite")
+	c.Assert(err, gc.IsNil)
+
+	s.client = NewMemoryClient()
+
+	fsm, err := NewFSM(FSMHints{Log: aRecoveryLog})
+	c.Assert(err, gc.IsNil)
+	s.recorder, err = NewRecorder(fsm, len(s.dir), s.client)
+	c.Assert(err, gc.IsNil)
+
+	s.recorder.SetSSTDedup(64, 2)
+}
+
+func (s *DedupSuite) TearDownTest(c *gc.C) {
+	os.RemoveAll(s.dir)
+}
+
+func (s *DedupSuite) TestDuplicateSSTsAreLinked(c *gc.C) {
+	s.writeFile("/000001.sst", "sst content")
+	s.writeFile("/000002.sst", "sst content")
+	s.writeFile("/000003.sst", "other content")
+	// Only SST files are deduplicated.
+	s.writeFile("/LOG", "sst content")
+
+	var links = s.recorder.fsm.Links
+	c.Check(links["/000002.sst"], gc.Equals, links["/000001.sst"])
+	c.Check(links["/000003.sst"], gc.Not(gc.Equals), links["/000001.sst"])
+	c.Check(links["/LOG"], gc.Not(gc.Equals), links["/000001.sst"])
+
+	// Expect duplicated content was recorded just once, for each of the
+	// first SST and the LOG.
+	c.Check(strings.Count(string(s.client.Content(aRecoveryLog)), "sst content"), gc.Equals, 2)
+
+	// The original SST may be removed, and the duplicate remains recoverable.
+	s.recorder.DeleteFile(s.dir + "/000001.sst")
+
+	s.expectRecovered(c, map[string]string{
+		"000002.sst": "sst content",
+		"000003.sst": "other content",
+		"LOG":        "sst content",
+	})
+}
+
+func (s *DedupSuite) TestLargeSSTsAreRecorded(c *gc.C) {
+	var content = strings.Repeat("x", 65)
+
+	s.writeFile("/000001.sst", content)
+	s.writeFile("/000002.sst", content)
+
+	var links = s.recorder.fsm.Links
+	c.Check(links["/000002.sst"], gc.Not(gc.Equals), links["/000001.sst"])
+
+	s.expectRecovered(c, map[string]string{
+		"000001.sst": content,
+		"000002.sst": content,
+	})
+}
+
+func (s *DedupSuite) TestAppendAfterLinkRestoresFnode(c *gc.C) {
+	s.writeFile("/000001.sst", "sst content")
+
+	var file = s.recorder.NewWritableFile(s.dir + "/000002.sst")
+	file.Append([]byte("sst "))
+	file.Append([]byte("content"))
+	file.Sync()
+
+	var links = s.recorder.fsm.Links
+	c.Check(links["/000002.sst"], gc.Equals, links["/000001.sst"])
+
+	// The file is further extended after being linked.
+	file.Append([]byte(", extended"))
+	file.Close()
+
+	c.Check(links["/000002.sst"], gc.Not(gc.Equals), links["/000001.sst"])
+
+	s.expectRecovered(c, map[string]string{
+		"000001.sst": "sst content",
+		"000002.sst": "sst content, extended",
+	})
+}
+
+func (s *DedupSuite) TestUnlinkedContentIsNotReferenced(c *gc.C) {
+	s.writeFile("/000001.sst", "sst content")
+	s.recorder.DeleteFile(s.dir + "/000001.sst")
+	s.writeFile("/000002.sst", "sst content")
+
+	s.expectRecovered(c, map[string]string{"000002.sst": "sst content"})
+}
+
+func (s *DedupSuite) TestIndexEviction(c *gc.C) {
+	var index = sstIndex{maxIndexed: 2, fnodes: make(map[sstDigest]Fnode)}
+	var a, b, d = digestOf([]byte("a")), digestOf([]byte("b")), digestOf([]byte("d"))
+
+	index.add(a, 1)
+	index.add(b, 2)
+	index.add(a, 3) // Updates |a| in place.
+	c.Check(index.fnodes, gc.DeepEquals, map[sstDigest]Fnode{a: 3, b: 2})
+
+	index.add(d, 4) // Evicts |a|.
+	c.Check(index.fnodes, gc.DeepEquals, map[sstDigest]Fnode{b: 2, d: 4})
+}
+
+// writeFile records a file of |content| at |path|.
+func (s *DedupSuite) writeFile(path, content string) {
+	var file = s.recorder.NewWritableFile(s.dir + path)
+	file.Append([]byte(content))
+	file.Sync()
+	file.Close()
+}
+
+// expectRecovered plays back the recorded log, and expects it recovers
+// exactly |files|.
+func (s *DedupSuite) expectRecovered(c *gc.C, files map[string]string) {
+	<-s.recorder.WriteBarrier().Ready
+
+	var dir, err = ioutil.TempDir("", "dedup-suite-play")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(dir)
+
+	player, err := NewPlayer(s.recorder.BuildHints(), dir)
+	c.Assert(err, gc.IsNil)
+
+	go player.Play(s.client)
+	_, _, err = player.MakeLive()
+	c.Assert(err, gc.IsNil)
+
+	var recovered = make(map[string]string)
+	c.Check(filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			var b, _ = ioutil.ReadFile(path)
+			recovered[path[len(dir)+1:]] = string(b)
+		}
+		return err
+	}), gc.IsNil)
+
+	c.Check(recovered, gc.DeepEquals, files)
+}
+
+var _ = gc.Suite(&DedupSuite{})
@@ -0,0 +1,103 @@
+package recoverylog
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// ForkLog records the file state of |fsm|, which has been recovered into
+// |localDir| (eg, by Player.MakeLive), into a new recovery log |log| via
+// |writer|. It returns an FSM of |log| from which a Recorder may continue to
+// record further file operations, and from which hints may be built which
+// reference only |log|. The log of |fsm| is not modified, and may continue to
+// be played (or recorded to) independently. Forking allows a database
+// recovered from one log to be duplicated into multiple databases, each with
+// its own log (eg, when splitting a consumer Shard).
+//
+// Files of |localDir| must not be modified while ForkLog runs. ForkLog returns
+// once all recorded operations have committed to |log|.
+func ForkLog(fsm *FSM, localDir string, log journal.Name, writer journal.Writer) (*FSM, error) {
+	fork, err := NewFSM(FSMHints{Log: log})
+	if err != nil {
+		return nil, err
+	}
+	recorder, err := NewRecorder(fork, len(localDir), writer)
+	if err != nil {
+		return nil, err
+	}
+
+	var fnodes []Fnode
+	for fnode := range fsm.LiveNodes {
+		fnodes = append(fnodes, fnode)
+	}
+	sort.Sort(fnodeOrder(fnodes))
+
+	for _, fnode := range fnodes {
+		var links []string
+		for link := range fsm.LiveNodes[fnode].Links {
+			links = append(links, link)
+		}
+		sort.Strings(links)
+
+		if err = forkFile(recorder, localDir, links[0]); err != nil {
+			return nil, err
+		}
+		for _, link := range links[1:] {
+			recorder.LinkFile(localDir+links[0], localDir+link)
+		}
+	}
+
+	var paths []string
+	for path := range fsm.Properties {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		recorder.recordProperty(path, fsm.Properties[path])
+	}
+
+	var barrier = recorder.WriteBarrier()
+	if <-barrier.Ready; barrier.Error != nil {
+		return nil, barrier.Error
+	}
+	return recorder.fsm, nil
+}
+
+// forkFile records the creation of |path|, and its content under |localDir|.
+func forkFile(recorder *Recorder, localDir, path string) error {
+	var file, err = os.Open(filepath.Join(localDir, path))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var observer = recorder.NewWritableFile(localDir + path)
+	defer observer.Close()
+
+	var chunk = make([]byte, compactChunkSize)
+	for {
+		var n, err = file.Read(chunk)
+		if n != 0 {
+			observer.Append(chunk[:n])
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// recordProperty records property |path| having |content|.
+func (r *Recorder) recordProperty(path, content string) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	r.recordFrame(r.process(RecordedOp{
+		Property: &Property{Path: path, Content: content}}, nil))
+}
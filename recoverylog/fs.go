@@ -0,0 +1,91 @@
+package recoverylog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// FS is a file system into which a Player applies recovered file state. All
+// file mutations of playback (including removal of prior or partial content)
+// are made through the Player's FS, which allows for alternate
+// implementations: for example, an in-memory FS for fast unit tests of
+// playback, or an FS which wraps OSFS to verify invariants of the operations
+// applied to it. By default, Players use OSFS.
+type FS interface {
+	// Create creates new file |path| for writing. It fails if |path| exists.
+	Create(path string) (File, error)
+	// OpenForWrite opens existing file |path| for writing.
+	OpenForWrite(path string) (File, error)
+	// Open opens existing file |path| for reading.
+	Open(path string) (io.ReadCloser, error)
+	// Stat returns the FileInfo of |path|.
+	Stat(path string) (os.FileInfo, error)
+	// Rename renames |oldpath| to |newpath|.
+	Rename(oldpath, newpath string) error
+	// Link creates |newpath| as a hard link of |oldpath|. Should hard links be
+	// unsupported between the paths, ErrCrossDevice is returned and the Player
+	// instead copies |oldpath| to |newpath|.
+	Link(oldpath, newpath string) error
+	// Remove removes file or empty directory |path|.
+	Remove(path string) error
+	// RemoveAll removes |path| and any children it contains. It's not an error
+	// if |path| doesn't exist.
+	RemoveAll(path string) error
+	// MkdirAll creates directory |path|, along with any missing parents.
+	MkdirAll(path string) error
+}
+
+// File is a file of an FS, opened for writing.
+type File interface {
+	io.Writer
+	io.Seeker
+	io.Closer
+	// Truncate changes the size of the File.
+	Truncate(size int64) error
+	// Name returns the path of the File.
+	Name() string
+}
+
+// ErrCrossDevice is returned by FS.Link if hard links aren't supported
+// between its paths.
+var ErrCrossDevice = fmt.Errorf("hard link crosses file systems")
+
+// OSFS is an FS of the local file system, implemented by package os. Players
+// which will be made live for a database Recorder must use OSFS.
+type OSFS struct{}
+
+func (OSFS) Create(path string) (File, error) {
+	return openFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+}
+
+func (OSFS) OpenForWrite(path string) (File, error) { return openFile(path, os.O_WRONLY) }
+
+func (OSFS) Open(path string) (io.ReadCloser, error) { return os.Open(path) }
+
+func (OSFS) Stat(path string) (os.FileInfo, error) { return os.Stat(path) }
+
+func (OSFS) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+
+func (OSFS) Link(oldpath, newpath string) error {
+	var err = os.Link(oldpath, newpath)
+	if le, ok := err.(*os.LinkError); ok && le.Err == syscall.EXDEV {
+		err = ErrCrossDevice
+	}
+	return err
+}
+
+func (OSFS) Remove(path string) error { return os.Remove(path) }
+
+func (OSFS) RemoveAll(path string) error { return os.RemoveAll(path) }
+
+func (OSFS) MkdirAll(path string) error { return os.MkdirAll(path, 0777) }
+
+func openFile(path string, flag int) (File, error) {
+	var f, err = os.OpenFile(path, flag, 0666)
+	if err != nil {
+		return nil, err // Don't return a nil *os.File as a non-nil File.
+	}
+	return f, nil
+}
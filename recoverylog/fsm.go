@@ -15,6 +15,7 @@ var (
 	ErrNoSuchLink       = fmt.Errorf("fnode has no such link")
 	ErrNotHinted        = fmt.Errorf("op recorder is not hinted")
 	ErrPropertyExists   = fmt.Errorf("property exists")
+	ErrStaleEpoch       = fmt.Errorf("op recorder epoch is stale")
 	ErrWrongSeqNo       = fmt.Errorf("wrong sequence number")
 
 	crcTable = crc32.MakeTable(crc32.Castagnoli)
@@ -46,10 +47,17 @@ type FSM struct {
 	// Log, and maximum offset progress of this FSM. Note that FSM does not
 	// maintain the LogMark.Offset field itself (it expects the caller too).
 	LogMark journal.Mark
+	// Of a sharded recovery log, Marks of each of its additional journals
+	// (see FSMHints.Shards), which are maintained in the same manner as LogMark.
+	ShardMarks []journal.Mark
 
 	// Expected sequence number and checksum of next operation.
 	NextSeqNo    int64
 	NextChecksum uint32
+	// Highest Recorder epoch of applied operations. Operations of a lower
+	// epoch are from a Recorder which has been superseded (see
+	// Recorder.Handoff), and are rejected.
+	Epoch int64
 
 	// Target paths and contents of small files which are managed outside of
 	// regular Fnode tracking. Property updates are triggered upon rename of
@@ -71,6 +79,11 @@ type FSM struct {
 	hintedSegments []Segment
 	// Ordered Fnodes which are still live at |hintedSegments| completion.
 	hintedFnodes []Fnode
+	// Author of the final hinted Segment.
+	hintedAuthor Author
+	// Epoch of the FSMHints, which takes effect once |hintedSegments| have
+	// been applied: hinted operations may be of lower epochs.
+	hintedEpoch int64
 }
 
 func NewFSM(hints FSMHints) (*FSM, error) {
@@ -83,24 +96,28 @@ func NewFSM(hints FSMHints) (*FSM, error) {
 		Links:        make(map[string]Fnode),
 	}
 
+	if err := validateShards(hints.Log, hints.Shards); err != nil {
+		return nil, err
+	}
+	for _, shard := range hints.Shards {
+		fsm.ShardMarks = append(fsm.ShardMarks, journal.NewMark(shard, -1))
+	}
+
 	// Flatten all hinted LiveNodes Segments into single |set|.
-	var set SegmentSet
-	for i, n := range hints.LiveNodes {
-		if i != 0 && fsm.hintedFnodes[i-1] >= n.Fnode {
-			return nil, fmt.Errorf("invalid hint fnode ordering")
-		}
+	var set, err = hintedSegmentSet(hints)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range hints.LiveNodes {
 		fsm.hintedFnodes = append(fsm.hintedFnodes, n.Fnode)
-
-		for _, s := range n.Segments {
-			if err := set.Add(s); err != nil {
-				return nil, err
-			}
-		}
 	}
 	if len(set) != 0 {
 		fsm.NextSeqNo, fsm.NextChecksum = set[0].FirstSeqNo, set[0].FirstChecksum
 		fsm.hintedSegments = []Segment(set)
+		fsm.hintedAuthor = set[len(set)-1].Author
 	}
+	fsm.hintedEpoch = hints.Epoch
+	fsm.fenceHintedEpoch()
 
 	// Flatten hinted properties into |fsm|.
 	for _, p := range hints.Properties {
@@ -110,7 +127,10 @@ func NewFSM(hints FSMHints) (*FSM, error) {
 }
 
 func (m *FSM) Apply(op *RecordedOp, frame []byte) error {
-	if op.SeqNo != m.NextSeqNo {
+	if op.GetEpoch() < m.Epoch {
+		// The operation is of a Recorder which has been superseded.
+		return ErrStaleEpoch
+	} else if op.SeqNo != m.NextSeqNo {
 		return ErrWrongSeqNo
 	} else if op.Checksum != m.NextChecksum {
 		return ErrChecksumMismatch
@@ -147,6 +167,10 @@ func (m *FSM) Apply(op *RecordedOp, frame []byte) error {
 	m.NextSeqNo += 1
 	m.NextChecksum = crc32.Update(m.NextChecksum, crcTable, frame)
 
+	if e := op.GetEpoch(); e > m.Epoch {
+		m.Epoch = e
+	}
+
 	// If we've exhausted the current hinted Segment, pop and skip to the next.
 	if len(m.hintedSegments) != 0 && m.hintedSegments[0].LastSeqNo < m.NextSeqNo {
 		m.hintedSegments = m.hintedSegments[1:]
@@ -156,9 +180,35 @@ func (m *FSM) Apply(op *RecordedOp, frame []byte) error {
 			m.NextChecksum = m.hintedSegments[0].FirstChecksum
 		}
 	}
+	m.fenceHintedEpoch()
 	return err
 }
 
+// fenceHintedEpoch raises the FSM Epoch to that of its FSMHints, once all
+// hinted Segments have been applied.
+func (m *FSM) fenceHintedEpoch() {
+	if len(m.hintedSegments) == 0 && m.hintedEpoch > m.Epoch {
+		m.Epoch = m.hintedEpoch
+	}
+}
+
+// skipTo steps the FSM forward to expect operation |seqNo| having |checksum|,
+// discarding hinted Segments which end before it. It's used to resume playback
+// following a skipped range of the log.
+func (m *FSM) skipTo(seqNo int64, checksum uint32) {
+	for len(m.hintedSegments) != 0 && m.hintedSegments[0].LastSeqNo < seqNo {
+		m.hintedSegments = m.hintedSegments[1:]
+	}
+	if len(m.hintedSegments) != 0 && m.hintedSegments[0].FirstSeqNo > seqNo {
+		// |seqNo| falls between hinted Segments. Expect the next Segment.
+		m.NextSeqNo = m.hintedSegments[0].FirstSeqNo
+		m.NextChecksum = m.hintedSegments[0].FirstChecksum
+		return
+	}
+	m.NextSeqNo, m.NextChecksum = seqNo, checksum
+	m.fenceHintedEpoch()
+}
+
 func (m *FSM) applyCreate(op *RecordedOp) error {
 	if _, ok := m.Links[op.Create.Path]; ok {
 		return ErrLinkExists
@@ -247,14 +297,26 @@ func (m *FSM) applyProperty(op *Property) error {
 }
 
 // Constructs memoized hints enabling a future FSM to rebuild this FSM's state.
+// Hints are canonically ordered: LiveNodes on Fnode, their Segments on SeqNo
+// (and hence offset), and Properties on Path. FSMs which applied identical
+// operations build identical hints, having identical serializations.
 func (m *FSM) BuildHints() FSMHints {
 	var hints = FSMHints{
-		Log: m.LogMark.Journal,
+		Log:   m.LogMark.Journal,
+		Epoch: m.Epoch,
+	}
+	if m.hintedEpoch > hints.Epoch {
+		hints.Epoch = m.hintedEpoch
+	}
+	for _, mark := range m.ShardMarks {
+		hints.Shards = append(hints.Shards, mark.Journal)
 	}
 
-	// Flatten LiveNodes into ordered HintedFnodes.
+	// Flatten LiveNodes into ordered HintedFnodes. Segments are copied, as
+	// those of |m| are updated in place as further operations are applied.
 	for fnode, state := range m.LiveNodes {
-		hints.LiveNodes = append(hints.LiveNodes, HintedFnode{fnode, state.Segments})
+		hints.LiveNodes = append(hints.LiveNodes,
+			HintedFnode{fnode, append([]Segment(nil), state.Segments...)})
 	}
 	sort.Sort(FnodeOrder(hints.LiveNodes))
 
@@ -262,9 +324,48 @@ func (m *FSM) BuildHints() FSMHints {
 	for path, content := range m.Properties {
 		hints.Properties = append(hints.Properties, Property{Path: path, Content: content})
 	}
+	sort.Sort(propertyOrder(hints.Properties))
+
 	return hints
 }
 
+// Validate returns an error if the FSMHints are malformed: if the Log or
+// Shards are invalid, LiveNodes are not strictly ordered on Fnode, or Segments
+// are inconsistent with one another.
+func (h *FSMHints) Validate() error {
+	if err := h.Log.Validate(); err != nil {
+		return err
+	} else if err = validateShards(h.Log, h.Shards); err != nil {
+		return err
+	}
+	var _, err = hintedSegmentSet(*h)
+	return err
+}
+
+// hintedSegmentSet verifies the Fnode ordering of |hints|, and flattens the
+// Segments of all its LiveNodes into a single SegmentSet.
+func hintedSegmentSet(hints FSMHints) (SegmentSet, error) {
+	var set SegmentSet
+	for i, n := range hints.LiveNodes {
+		if i != 0 && hints.LiveNodes[i-1].Fnode >= n.Fnode {
+			return nil, fmt.Errorf("invalid hint fnode ordering")
+		}
+		for _, s := range n.Segments {
+			if err := set.Add(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return set, nil
+}
+
+// HintedAuthor returns the Author of the final Segment of the FSMHints from
+// which the FSM was built. Where Recorders have interleaved writes into the
+// log, it identifies the Author whose branch of log history was selected by
+// the hints (and reconstructed by playback). Zero is returned if the hints
+// had no Segments.
+func (m *FSM) HintedAuthor() Author { return m.hintedAuthor }
+
 func (m *FSM) HasHints() bool {
 	return len(m.hintedSegments) != 0 || len(m.hintedFnodes) != 0
 }
@@ -279,6 +380,7 @@ func (m *FSM) extendSegments(s *[]Segment, op *RecordedOp) {
 			FirstOffset:   m.LogMark.Offset,
 			FirstSeqNo:    op.SeqNo,
 			LastSeqNo:     op.SeqNo,
+			ShardOffsets:  m.shardOffsets(),
 		})
 	}
 }
@@ -64,6 +64,30 @@ func (s *FSMSuite) TestInitializationFromHints(c *gc.C) {
 	c.Check(s.fsm.BuildHints(), gc.DeepEquals, hints)
 }
 
+func (s *FSMSuite) TestHintsValidation(c *gc.C) {
+	var hints = FSMHints{
+		Log: "a/log",
+		LiveNodes: []HintedFnode{
+			{Fnode: 42, Segments: []Segment{
+				{Author: 100, FirstOffset: 2, FirstSeqNo: 42, LastSeqNo: 43}}},
+			{Fnode: 44, Segments: []Segment{
+				{Author: 100, FirstOffset: 5, FirstSeqNo: 44, LastSeqNo: 44}}},
+		},
+	}
+	c.Check(hints.Validate(), gc.IsNil)
+
+	hints.LiveNodes[0].Fnode = 44
+	c.Check(hints.Validate(), gc.ErrorMatches, "invalid hint fnode ordering")
+	hints.LiveNodes[0].Fnode = 42
+
+	hints.LiveNodes[1].Segments[0].Author = 200
+	hints.LiveNodes[1].Segments[0].FirstSeqNo = 43
+	c.Check(hints.Validate(), gc.ErrorMatches, "overlapping Segment Authors differ")
+
+	hints.Log = ""
+	c.Check(hints.Validate(), gc.ErrorMatches, "invalid journal name .*")
+}
+
 func (s *FSMSuite) TestFnodeCreation(c *gc.C) {
 	s.fsm = s.newFSM(c, FSMHints{
 		Properties: []Property{{Path: "/property/path", Content: "content"}},
@@ -319,6 +343,30 @@ func (s *FSMSuite) TestPropertyUpdates(c *gc.C) {
 	})
 }
 
+func (s *FSMSuite) TestHintsAreCanonicallyOrdered(c *gc.C) {
+	s.fsm = s.newFSM(c, FSMHints{Log: "a/log"})
+
+	c.Check(s.create(1, s.fsm.NextChecksum, 100, "/a/path"), gc.IsNil)
+	c.Check(s.property(2, s.fsm.NextChecksum, 100, "/c/property", "c"), gc.IsNil)
+	c.Check(s.property(3, s.fsm.NextChecksum, 100, "/a/property", "a"), gc.IsNil)
+	c.Check(s.create(4, s.fsm.NextChecksum, 100, "/another/path"), gc.IsNil)
+	c.Check(s.property(5, s.fsm.NextChecksum, 100, "/b/property", "b"), gc.IsNil)
+
+	// Expect hints order Properties on Path, regardless of map iteration order.
+	for i := 0; i != 10; i++ {
+		var hints = s.fsm.BuildHints()
+
+		c.Check(hints.Properties, gc.DeepEquals, []Property{
+			{Path: "/a/property", Content: "a"},
+			{Path: "/b/property", Content: "b"},
+			{Path: "/c/property", Content: "c"},
+		})
+		c.Check(hints.LiveNodes, gc.HasLen, 2)
+		c.Check(hints.LiveNodes[0].Fnode, gc.Equals, Fnode(1))
+		c.Check(hints.LiveNodes[1].Fnode, gc.Equals, Fnode(4))
+	}
+}
+
 func (s *FSMSuite) TestFnodeWrites(c *gc.C) {
 	s.fsm = s.newFSM(c, FSMHints{Log: "a/log"})
 	s.fsm.NextSeqNo, s.fsm.NextChecksum = 42, 0xfeedbeef
@@ -361,6 +409,9 @@ func (s *FSMSuite) TestUseOfHintedAuthors(c *gc.C) {
 	}
 	s.fsm = s.newFSM(c, hints)
 
+	// Expect the Author of the final hinted Segment is reported.
+	c.Check(s.fsm.HintedAuthor(), gc.Equals, Author(400))
+
 	// Intermix a "bad" recorder (666) which uses valid SeqNo & Checksums.
 	// Expect that we still reconstruct the recorder-hinted history.
 	c.Check(s.create(42, 0x0, 666, "/evil/path"), gc.Equals, ErrNotHinted)
@@ -400,6 +451,33 @@ func (s *FSMSuite) TestUseOfHintedAuthors(c *gc.C) {
 	})
 }
 
+func (s *FSMSuite) TestStaleEpochsAreRejected(c *gc.C) {
+	s.fsm = s.newFSM(c, FSMHints{
+		Log: "a/log",
+		LiveNodes: []HintedFnode{
+			{Fnode: 1, Segments: []Segment{
+				{Author: 100, FirstSeqNo: 1, LastSeqNo: 1}}},
+		},
+		Epoch: 2,
+	})
+	// Hinted operations apply, though of a prior epoch.
+	c.Check(s.fsm.Epoch, gc.Equals, int64(0))
+	c.Check(s.create(1, 0x00000000, 100, "/path/A"), gc.IsNil)
+
+	// Once hints are exhausted, operations of prior epochs are rejected.
+	c.Check(s.fsm.Epoch, gc.Equals, int64(2))
+	c.Check(s.link(2, s.fsm.NextChecksum, 100, 1, "/path/B"), gc.Equals, ErrStaleEpoch)
+	c.Check(s.epochLink(2, s.fsm.NextChecksum, 200, 1, 1, "/path/B"), gc.Equals, ErrStaleEpoch)
+
+	// Operations of the current or a later epoch are applied, and raise it.
+	c.Check(s.epochLink(2, s.fsm.NextChecksum, 200, 2, 1, "/path/B"), gc.IsNil)
+	c.Check(s.epochLink(3, s.fsm.NextChecksum, 300, 3, 1, "/path/C"), gc.IsNil)
+	c.Check(s.fsm.Epoch, gc.Equals, int64(3))
+	c.Check(s.epochLink(4, s.fsm.NextChecksum, 200, 2, 1, "/path/D"), gc.Equals, ErrStaleEpoch)
+
+	c.Check(s.fsm.BuildHints().Epoch, gc.Equals, int64(3))
+}
+
 func (s *FSMSuite) apply(op RecordedOp) error {
 	// Ordinarily |op| bytes (as framed by the recorder) is digested by FSM to
 	// produce updated checksums. To decouple these tests from the particular
@@ -425,6 +503,12 @@ func (s *FSMSuite) link(seqNo int64, checksum uint32, auth Author,
 		Link: &RecordedOp_Link{Fnode: fnode, Path: path}})
 }
 
+func (s *FSMSuite) epochLink(seqNo int64, checksum uint32, auth Author,
+	epoch int64, fnode Fnode, path string) error {
+	return s.apply(RecordedOp{SeqNo: seqNo, Checksum: checksum, Author: auth,
+		Epoch: &epoch, Link: &RecordedOp_Link{Fnode: fnode, Path: path}})
+}
+
 func (s *FSMSuite) unlink(seqNo int64, checksum uint32, auth Author,
 	fnode Fnode, path string) error {
 	return s.apply(RecordedOp{SeqNo: seqNo, Checksum: checksum, Author: auth,
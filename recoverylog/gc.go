@@ -0,0 +1,127 @@
+package recoverylog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiveRamp/gazette/cloudstore"
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// Error returned by CollectGarbage if provided hints don't match the hints
+// most recently published to the hints journal.
+var ErrHintsNotCurrent = fmt.Errorf("hints are not the current published hints")
+
+// Number of fragment directory entries read by CollectGarbage per iteration.
+var gcReaddirSize = 1000
+
+// GCResult describes recovery log Fragments removed by CollectGarbage.
+type GCResult struct {
+	// Offset of the recovery log below which content is no longer required.
+	Horizon int64
+	// Number of removed Fragments, and the total length of their content.
+	Fragments int
+	Bytes     int64
+}
+
+// CollectGarbage removes Fragments of the recovery log of |hints| which lie
+// entirely below the horizon of the log still required by |hints|: the
+// minimum FirstOffset of any live Fnode segment. Fragments are removed from
+// |cfs|, the Fragment store of the recovery log.
+//
+// Removal is safe only if no Player may still be playing from older hints.
+// CollectGarbage requires that |hints| have been published to |hintsJournal|
+// (see Recorder.SetHintsJournal), and confirms that they reference the same
+// live segments as the hints most recently published there (which standbys
+// read). If they do not, ErrHintsNotCurrent is returned and nothing is removed.
+// If any live segment has an unknown offset, nothing is removed. Of a sharded
+// recovery log, only Fragments of hints.Log are removed.
+//
+// Brokers are not informed of removed Fragments. Reads of removed offsets
+// fail (or skip forward, per the broker) until brokers refresh their index.
+func CollectGarbage(client journal.Client, cfs cloudstore.FileSystem,
+	hintsJournal journal.Name, hints FSMHints) (GCResult, error) {
+
+	var result GCResult
+
+	var published, err = ReadPublishedHints(client, hintsJournal)
+	if err == ErrNoPublishedHints {
+		return result, ErrHintsNotCurrent
+	} else if err != nil {
+		return result, err
+	}
+
+	var segments, pubSegments SegmentSet
+	if segments, err = hintedSegmentSet(hints); err != nil {
+		return result, err
+	} else if pubSegments, err = hintedSegmentSet(published); err != nil {
+		return result, err
+	} else if published.Log != hints.Log || !reflect.DeepEqual(segments, pubSegments) {
+		return result, ErrHintsNotCurrent
+	}
+
+	if horizon, ok := segmentsHorizon(segments); ok {
+		result.Horizon = horizon
+	} else if len(segments) == 0 {
+		// Without live segments, there's no recorded horizon of the log. Retain
+		// all content: the log may still be in the process of being written.
+		return result, nil
+	} else {
+		log.WithFields(log.Fields{"log": hints.Log}).
+			Warn("hinted segment has unknown offset; not collecting garbage")
+		return result, nil
+	}
+
+	dir, err := cfs.Open(hints.Log.String())
+	if os.IsNotExist(err) {
+		return result, nil
+	} else if err != nil {
+		return result, err
+	}
+	defer dir.Close()
+
+	for {
+		var files, err = dir.Readdir(gcReaddirSize)
+
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			var fragment, parseErr = journal.ParseFragment(hints.Log, file.Name())
+			if parseErr != nil {
+				log.WithFields(log.Fields{"path": file.Name(), "err": parseErr}).
+					Warn("failed to parse content-name")
+				continue
+			} else if fragment.End > result.Horizon {
+				continue
+			}
+
+			if rmErr := cfs.Remove(fragment.ContentPath()); os.IsNotExist(rmErr) {
+				continue // Removed concurrently.
+			} else if rmErr != nil {
+				return result, rmErr
+			}
+			result.Fragments += 1
+			result.Bytes += fragment.Size()
+		}
+
+		if err == io.EOF || (err == nil && len(files) == 0) {
+			break
+		} else if err != nil {
+			return result, err
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"log":       hints.Log,
+		"horizon":   result.Horizon,
+		"fragments": result.Fragments,
+		"bytes":     result.Bytes,
+	}).Info("collected recovery log garbage")
+
+	return result, nil
+}
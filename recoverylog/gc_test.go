@@ -0,0 +1,95 @@
+package recoverylog
+
+import (
+	"os"
+
+	gc "github.com/go-check/check"
+
+	"github.com/LiveRamp/gazette/cloudstore"
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/topic"
+)
+
+type GCSuite struct{}
+
+func (s *GCSuite) TestCollectGarbage(c *gc.C) {
+	var cfs = cloudstore.NewTmpFileSystem()
+	defer cfs.Close()
+
+	var hints = FSMHints{
+		Log: aRecoveryLog,
+		LiveNodes: []HintedFnode{
+			{Fnode: 42, Segments: []Segment{
+				{Author: 100, FirstSeqNo: 42, FirstOffset: 1200, LastSeqNo: 45},
+				{Author: 100, FirstSeqNo: 50, FirstOffset: 1800, LastSeqNo: 50}}},
+			{Fnode: 44, Segments: []Segment{
+				{Author: 100, FirstSeqNo: 44, FirstOffset: 1300, LastSeqNo: 44}}},
+		},
+	}
+
+	c.Assert(cfs.MkdirAll(aRecoveryLog.String(), 0750), gc.IsNil)
+	for _, r := range []struct{ begin, end int64 }{
+		{0, 500},
+		{500, 1000},
+		{400, 1100}, // Overlaps.
+		{1000, 1500},
+		{1500, 2000},
+	} {
+		var f = journal.Fragment{Journal: aRecoveryLog, Begin: r.begin, End: r.end}
+		var file, err = cfs.OpenFile(f.ContentPath(), os.O_WRONLY|os.O_CREATE, 0640)
+		c.Assert(err, gc.IsNil)
+		_, err = file.Write(make([]byte, f.Size()))
+		c.Assert(err, gc.IsNil)
+		c.Assert(file.Close(), gc.IsNil)
+	}
+
+	// Expect removal is refused if the hints journal has no hints.
+	var _, err = CollectGarbage(fixedJournalClient{}, cfs, hintsLog, hints)
+	c.Check(err, gc.Equals, ErrHintsNotCurrent)
+
+	// Or if published hints differ (eg, a standby may be playing older hints).
+	var stale = FSMHints{
+		Log: aRecoveryLog,
+		LiveNodes: []HintedFnode{{Fnode: 10, Segments: []Segment{
+			{Author: 100, FirstSeqNo: 10, FirstOffset: 400, LastSeqNo: 44}}}},
+	}
+	_, err = CollectGarbage(s.publishedClient(c, hints, stale), cfs, hintsLog, hints)
+	c.Check(err, gc.Equals, ErrHintsNotCurrent)
+
+	// Success. Fragments entirely below offset 1200 are removed.
+	result, err := CollectGarbage(s.publishedClient(c, stale, hints), cfs, hintsLog, hints)
+	c.Check(err, gc.IsNil)
+	c.Check(result, gc.Equals, GCResult{Horizon: 1200, Fragments: 3, Bytes: 1700})
+
+	var names []string
+	c.Check(cfs.Walk(aRecoveryLog.String(), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			names = append(names, info.Name())
+		}
+		return err
+	}), gc.IsNil)
+
+	c.Check(names, gc.DeepEquals, []string{
+		journal.Fragment{Begin: 1000, End: 1500}.ContentName(),
+		journal.Fragment{Begin: 1500, End: 2000}.ContentName(),
+	})
+
+	// A repeated collection removes nothing further.
+	result, err = CollectGarbage(s.publishedClient(c, hints), cfs, hintsLog, hints)
+	c.Check(err, gc.IsNil)
+	c.Check(result, gc.Equals, GCResult{Horizon: 1200})
+}
+
+// publishedClient returns a journal.Client of a hints journal into which
+// each of |hints| has been published, in order.
+func (s *GCSuite) publishedClient(c *gc.C, hints ...FSMHints) journal.Client {
+	var content []byte
+	for i := range hints {
+		var err error
+		content, err = topic.FixedFramingCRC.Encode(&hints[i], content)
+		c.Assert(err, gc.IsNil, gc.Commentf("hints %d", i))
+	}
+	return fixedJournalClient{content: content}
+}
+
+var _ = gc.Suite(&GCSuite{})
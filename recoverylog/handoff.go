@@ -0,0 +1,68 @@
+package recoverylog
+
+import (
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// Handoff is the final state of a Recorder which has handed off recording of
+// its log to a Recorder of another process (eg, during a deployment), allowing
+// the incoming process to continue recording without first playing back the
+// log. See Recorder.Handoff and NewRecorderFromHandoff.
+type Handoff struct {
+	// Recorded file state as of the hand-off. Snapshot.Offset (and the Offsets
+	// of Snapshot.Shards) are log write heads following the final operation of
+	// the outgoing Recorder. Snapshot.Epoch is the epoch of the outgoing
+	// Recorder: the incoming Recorder records at the following epoch, and
+	// operations of prior epochs (eg, of a stale outgoing process) are
+	// thereafter rejected by playback.
+	Snapshot
+	// Author of the outgoing Recorder. The incoming Recorder is assigned a
+	// distinct Author, such that hinted Segments of each are distinguished.
+	Author Author
+}
+
+// Handoff ends recording by the Recorder, and returns a Handoff from which a
+// Recorder of another process may continue recording into the log. Handoff
+// blocks until all recorded operations have committed. |localDir| is the
+// recorded directory, which must not be further modified until the incoming
+// Recorder takes over. The database should be closed prior to Handoff:
+// thereafter, the Recorder panics if asked to record further operations.
+func (r *Recorder) Handoff(localDir string) (Handoff, error) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	if r.paused != nil {
+		return Handoff{}, ErrRecorderPaused
+	}
+
+	// Await the commit of all recorded operations, and the resulting write
+	// head of each journal of the log.
+	for shard, barrier := range r.barriers() {
+		<-barrier.Ready
+
+		if barrier.Error != nil {
+			return Handoff{}, barrier.Error
+		}
+		r.fsm.mark(shard).Offset = barrier.WriteHead
+	}
+
+	var snapshot, err = r.snapshot(localDir, "")
+	if err != nil {
+		return Handoff{}, err
+	}
+	r.handedOff = true
+
+	return Handoff{Snapshot: snapshot, Author: r.id}, nil
+}
+
+// NewRecorderFromHandoff returns a Recorder which continues recording from
+// |handoff|, produced by the Recorder of another process. The returned
+// Recorder's operations follow the final operation of the outgoing Recorder
+// in sequence, are written at or after the handed-off log offset, and are of
+// a strictly higher epoch.
+func NewRecorderFromHandoff(handoff Handoff, stripLen int, writer journal.Writer) (*Recorder, error) {
+	var fsm, sizes = fsmFromSnapshot(handoff.Snapshot)
+	fsm.Epoch = handoff.Epoch + 1
+
+	return newRecorder(fsm, sizes, handoff.Author, stripLen, writer)
+}
@@ -0,0 +1,204 @@
+package recoverylog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/topic"
+)
+
+// Error returned by ReadPublishedHints if the hints journal has no hints.
+var ErrNoPublishedHints = fmt.Errorf("no published hints")
+
+// Length of the hints journal suffix initially read by ReadPublishedHints.
+// It's doubled until published hints are found.
+var publishedHintsWindow int64 = 1 << 20
+
+// hintsPublisher tracks the periodic publication of Recorder FSMHints to
+// a hints journal or HintsStore. See Recorder.SetHintsJournal and
+// Recorder.SetHintsStore.
+type hintsPublisher struct {
+	store    interface{ StoreHints(FSMHints) error }
+	interval time.Duration
+	ops      int
+
+	// Operations recorded since, and time of, the last publication.
+	pendingOps  int
+	lastPublish time.Time
+	// Closed when the in-flight publication completes. Nil if none is in-flight.
+	inFlight chan struct{}
+}
+
+// SetHintsJournal arranges for the Recorder to publish its FSMHints to
+// |hintsJournal| as operations are recorded: after every |ops| operations, or
+// once |interval| has elapsed since the last publication, whichever is first.
+// A zero |ops| or |interval| disables that trigger. Standbys may read the
+// latest hints of |hintsJournal| via ReadPublishedHints, without an external
+// dependency (eg, Etcd).
+//
+// Each publication is a single FixedFramingCRC frame written with the
+// Recorder's journal.Writer, and is appended only after a write barrier of the
+// recovery log has committed. Published hints therefore never reference
+// operations or offsets beyond the committed recovery log. Publication is
+// best-effort: failed writes are logged, and hints are re-published with the
+// next trigger.
+func (r *Recorder) SetHintsJournal(hintsJournal journal.Name, interval time.Duration, ops int) error {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	for shard := 0; shard != r.fsm.shardCount(); shard++ {
+		if hintsJournal == r.fsm.mark(shard).Journal {
+			return fmt.Errorf("hints journal must differ from recovery log %s", hintsJournal)
+		}
+	}
+	r.hints = &hintsPublisher{
+		store:       journalHintsWriter{writer: r.writer, journal: hintsJournal},
+		interval:    interval,
+		ops:         ops,
+		lastPublish: time.Now(),
+	}
+	return nil
+}
+
+// SetHintsStore is SetHintsJournal, but publishes FSMHints to |store| rather
+// than a hints journal. As with SetHintsJournal, published hints never
+// reference operations beyond the committed recovery log, and publication is
+// best-effort. Only one of SetHintsJournal or SetHintsStore may be in effect.
+func (r *Recorder) SetHintsStore(store HintsStore, interval time.Duration, ops int) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	r.hints = &hintsPublisher{
+		store:       store,
+		interval:    interval,
+		ops:         ops,
+		lastPublish: time.Now(),
+	}
+}
+
+// journalHintsWriter publishes FSMHints to a hints journal via a
+// journal.Writer.
+type journalHintsWriter struct {
+	writer  journal.Writer
+	journal journal.Name
+}
+
+func (w journalHintsWriter) StoreHints(hints FSMHints) error {
+	return appendHintsFrame(w.writer, w.journal, hints)
+}
+
+func (w journalHintsWriter) String() string { return w.journal.String() }
+
+// maybePublishHints publishes FSMHints if a trigger of the hints journal has
+// been reached, and a previous publication isn't still in-flight. |r.mu| must
+// be held.
+func (r *Recorder) maybePublishHints() {
+	var p = r.hints
+
+	if p == nil || p.pendingOps == 0 {
+		return
+	} else if p.inFlight != nil {
+		select {
+		case <-p.inFlight:
+			p.inFlight = nil
+		default:
+			return // Previous publication is still in-flight.
+		}
+	}
+
+	if !(p.ops != 0 && p.pendingOps >= p.ops) &&
+		!(p.interval != 0 && time.Since(p.lastPublish) >= p.interval) {
+		return
+	}
+	p.pendingOps, p.lastPublish = 0, time.Now()
+
+	var hints = r.fsm.BuildHints()
+
+	// |hints| may reference recorded operations which haven't yet committed.
+	// Order publication after a barrier which follows each of them.
+	var barrier = r.recordFrame(nil)
+	var done = make(chan struct{})
+	p.inFlight = done
+
+	go func(store interface{ StoreHints(FSMHints) error }) {
+		defer close(done)
+
+		<-barrier.Ready
+
+		var err = barrier.Error
+		if err == nil {
+			err = store.StoreHints(hints)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"store": store, "err": err}).Warn("failed to publish hints")
+		}
+	}(p.store)
+}
+
+// ReadPublishedHints returns the most recent FSMHints published to
+// |hintsJournal| by a Recorder. Only a suffix of the journal is read, which is
+// extended until hints are found. If the journal has no published hints,
+// ErrNoPublishedHints is returned.
+func ReadPublishedHints(client journal.Client, hintsJournal journal.Name) (FSMHints, error) {
+	var head, _ = client.Head(journal.ReadArgs{Journal: hintsJournal, Offset: 0})
+
+	// The journal may not begin at offset zero, if content has been removed.
+	var floor int64
+	if head.Error == nil {
+		floor = head.Offset
+	} else if head.Error != journal.ErrNotYetAvailable {
+		return FSMHints{}, head.Error
+	}
+
+	for window := publishedHintsWindow; ; window *= 2 {
+		var begin = head.WriteHead - window
+		if begin < floor {
+			begin = floor
+		}
+
+		if hints, ok := readLastHints(client, hintsJournal, begin, head.WriteHead); ok {
+			return hints, nil
+		} else if begin == floor {
+			return FSMHints{}, ErrNoPublishedHints
+		}
+	}
+}
+
+// readLastHints returns the last FSMHints framed within [begin, end) of
+// |hintsJournal|. As |begin| may not fall on a frame boundary, leading
+// content is re-synchronized with the next frame.
+func readLastHints(client journal.Getter, hintsJournal journal.Name, begin, end int64) (FSMHints, bool) {
+	var rr = journal.NewRetryReader(journal.NewMark(hintsJournal, begin), client)
+	defer rr.Close()
+
+	// Return EOF rather than block, should content be unexpectedly missing.
+	rr.EOFTimeout = blockInterval
+
+	var br = bufio.NewReader(io.LimitReader(rr, end-begin))
+	var hints FSMHints
+	var found bool
+
+	for {
+		var frame, err = topic.FixedFraming.Unpack(br)
+		if err != nil {
+			// EOF, or a partial frame at |end| (which can occur only if the frame
+			// header was spuriously matched).
+			return hints, found
+		}
+
+		var payload []byte
+		var next FSMHints
+
+		if payload, err = topic.FixedFramePayload(frame); err != nil {
+			continue // Leading or de-synchronized content.
+		} else if err = next.Unmarshal(payload); err != nil || next.Log == "" {
+			continue
+		}
+		hints, found = next, true
+	}
+}
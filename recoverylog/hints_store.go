@@ -0,0 +1,155 @@
+package recoverylog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/topic"
+)
+
+// Error returned by EtcdHintsStore.StoreHints if hints were stored by another
+// party since this EtcdHintsStore last loaded or stored them.
+var ErrHintsVersionConflict = fmt.Errorf("hints were concurrently modified")
+
+// HintsStore durably stores FSMHints, and retrieves the most recently stored
+// FSMHints. See Recorder.SetHintsStore and LoadHints.
+type HintsStore interface {
+	// StoreHints durably stores |hints|, superseding those previously stored.
+	StoreHints(hints FSMHints) error
+	// LoadHints returns the most recently stored FSMHints, or
+	// ErrNoPublishedHints if no hints are stored.
+	LoadHints() (FSMHints, error)
+}
+
+// LoadHints loads FSMHints of |store| for use by a Player, as at startup of
+// a consumer shard. If |store| has no hints, FSMHints of an empty recovery
+// log |log| are returned, from which playback begins at the start of |log|.
+func LoadHints(store HintsStore, log journal.Name) (FSMHints, error) {
+	var hints, err = store.LoadHints()
+	if err == ErrNoPublishedHints {
+		return FSMHints{Log: log}, nil
+	}
+	return hints, err
+}
+
+// JournalHintsStore is a HintsStore which appends FSMHints as frames of a
+// hints journal, in the format published by Recorder.SetHintsJournal.
+// The hints journal itself versions stored hints: the latest hints are
+// those of its last frame.
+type JournalHintsStore struct {
+	Client  journal.Client
+	Journal journal.Name
+}
+
+// StoreHints implements HintsStore.
+func (s JournalHintsStore) StoreHints(hints FSMHints) error {
+	return appendHintsFrame(s.Client, s.Journal, hints)
+}
+
+// LoadHints implements HintsStore.
+func (s JournalHintsStore) LoadHints() (FSMHints, error) {
+	return ReadPublishedHints(s.Client, s.Journal)
+}
+
+func (s JournalHintsStore) String() string { return s.Journal.String() }
+
+// appendHintsFrame writes |hints| as a frame of |hintsJournal| via |writer|,
+// and awaits its commit.
+func appendHintsFrame(writer journal.Writer, hintsJournal journal.Name, hints FSMHints) error {
+	var frame, err = topic.FixedFramingCRC.Encode(&hints, nil)
+	if err != nil {
+		return err
+	}
+	write, err := writer.Write(hintsJournal, frame)
+	if err != nil {
+		return err
+	}
+	<-write.Ready
+	return write.Error
+}
+
+// EtcdHintsStore is a HintsStore of JSON-encoded FSMHints under an Etcd key.
+// Stored hints are versioned by the key's Etcd ModifiedIndex: StoreHints
+// succeeds only if the key is unchanged since this EtcdHintsStore last loaded
+// or stored it, and otherwise fails with ErrHintsVersionConflict. A Recorder
+// which has been superseded (eg, by a new primary of its shard) therefore
+// cannot overwrite hints of its successor. LoadHints must be called prior to
+// StoreHints, if the key may already exist.
+type EtcdHintsStore struct {
+	keysAPI etcd.KeysAPI
+	key     string
+
+	// Etcd ModifiedIndex of |key| as last loaded or stored, or zero if |key|
+	// isn't known to exist.
+	index uint64
+	mu    sync.Mutex
+}
+
+// NewEtcdHintsStore returns an EtcdHintsStore of |key|.
+func NewEtcdHintsStore(keysAPI etcd.KeysAPI, key string) *EtcdHintsStore {
+	return &EtcdHintsStore{keysAPI: keysAPI, key: key}
+}
+
+// StoreHints implements HintsStore.
+func (s *EtcdHintsStore) StoreHints(hints FSMHints) error {
+	var b, err = json.Marshal(hints)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var opts = &etcd.SetOptions{PrevExist: etcd.PrevNoExist}
+	if s.index != 0 {
+		opts = &etcd.SetOptions{PrevExist: etcd.PrevExist, PrevIndex: s.index}
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), etcdHintsTimeout)
+	defer cancel()
+
+	resp, err := s.keysAPI.Set(ctx, s.key, string(b), opts)
+	if etcdErr, ok := err.(etcd.Error); ok &&
+		(etcdErr.Code == etcd.ErrorCodeTestFailed || etcdErr.Code == etcd.ErrorCodeNodeExist) {
+		return ErrHintsVersionConflict
+	} else if err != nil {
+		return err
+	}
+	s.index = resp.Node.ModifiedIndex
+	return nil
+}
+
+// LoadHints implements HintsStore.
+func (s *EtcdHintsStore) LoadHints() (FSMHints, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ctx, cancel = context.WithTimeout(context.Background(), etcdHintsTimeout)
+	defer cancel()
+
+	var resp, err = s.keysAPI.Get(ctx, s.key, nil)
+	if etcd.IsKeyNotFound(err) {
+		s.index = 0
+		return FSMHints{}, ErrNoPublishedHints
+	} else if err != nil {
+		return FSMHints{}, err
+	}
+
+	var hints FSMHints
+	if err = json.Unmarshal([]byte(resp.Node.Value), &hints); err != nil {
+		return FSMHints{}, err
+	}
+	s.index = resp.Node.ModifiedIndex
+	return hints, nil
+}
+
+func (s *EtcdHintsStore) String() string { return s.key }
+
+// Timeout of EtcdHintsStore requests.
+const etcdHintsTimeout = 10 * time.Second
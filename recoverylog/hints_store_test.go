@@ -0,0 +1,106 @@
+package recoverylog
+
+import (
+	"encoding/json"
+
+	etcd "github.com/coreos/etcd/client"
+	gc "github.com/go-check/check"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/LiveRamp/gazette/consensus"
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type HintsStoreSuite struct{}
+
+func (s *HintsStoreSuite) TestJournalStoreRoundTrip(c *gc.C) {
+	var client = NewMemoryClient()
+	c.Assert(client.Create(hintsLog), gc.IsNil)
+
+	var store = JournalHintsStore{Client: client, Journal: hintsLog}
+
+	// Without stored hints, LoadHints begins from an empty recovery log.
+	var _, err = store.LoadHints()
+	c.Check(err, gc.Equals, ErrNoPublishedHints)
+
+	hints, err := LoadHints(store, aRecoveryLog)
+	c.Check(err, gc.IsNil)
+	c.Check(hints, gc.DeepEquals, FSMHints{Log: aRecoveryLog})
+
+	// The most recently stored hints are loaded.
+	c.Check(store.StoreHints(FSMHints{Log: aRecoveryLog, Properties: []Property{
+		{Path: "/IDENTITY", Content: "one"}}}), gc.IsNil)
+	c.Check(store.StoreHints(FSMHints{Log: aRecoveryLog, Properties: []Property{
+		{Path: "/IDENTITY", Content: "two"}}}), gc.IsNil)
+
+	hints, err = LoadHints(store, aRecoveryLog)
+	c.Check(err, gc.IsNil)
+	c.Check(hints.Properties, gc.DeepEquals, []Property{{Path: "/IDENTITY", Content: "two"}})
+}
+
+func (s *HintsStoreSuite) TestEtcdStoreVersioning(c *gc.C) {
+	var keysAPI = new(consensus.MockKeysAPI)
+	var store = NewEtcdHintsStore(keysAPI, "/hints/shard-000")
+
+	var one = FSMHints{Log: aRecoveryLog, Properties: []Property{{Path: "/IDENTITY", Content: "one"}}}
+	var oneJSON, _ = json.Marshal(one)
+
+	// Hints don't yet exist.
+	keysAPI.On("Get", mock.Anything, "/hints/shard-000", (*etcd.GetOptions)(nil)).
+		Return(nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}).Once()
+
+	hints, err := LoadHints(store, aRecoveryLog)
+	c.Check(err, gc.IsNil)
+	c.Check(hints, gc.DeepEquals, FSMHints{Log: aRecoveryLog})
+
+	// Expect the first store requires that the key not exist.
+	keysAPI.On("Set", mock.Anything, "/hints/shard-000", string(oneJSON),
+		&etcd.SetOptions{PrevExist: etcd.PrevNoExist}).
+		Return(&etcd.Response{Node: &etcd.Node{ModifiedIndex: 10}}, nil).Once()
+	c.Check(store.StoreHints(one), gc.IsNil)
+
+	// Subsequent stores require the key is unchanged since the last store.
+	keysAPI.On("Set", mock.Anything, "/hints/shard-000", string(oneJSON),
+		&etcd.SetOptions{PrevExist: etcd.PrevExist, PrevIndex: 10}).
+		Return(nil, etcd.Error{Code: etcd.ErrorCodeTestFailed}).Once()
+	c.Check(store.StoreHints(one), gc.Equals, ErrHintsVersionConflict)
+
+	// Loading hints updates the expected version.
+	keysAPI.On("Get", mock.Anything, "/hints/shard-000", (*etcd.GetOptions)(nil)).
+		Return(&etcd.Response{Node: &etcd.Node{Value: string(oneJSON), ModifiedIndex: 20}}, nil).Once()
+	hints, err = store.LoadHints()
+	c.Check(err, gc.IsNil)
+	c.Check(hints, gc.DeepEquals, one)
+
+	keysAPI.On("Set", mock.Anything, "/hints/shard-000", string(oneJSON),
+		&etcd.SetOptions{PrevExist: etcd.PrevExist, PrevIndex: 20}).
+		Return(&etcd.Response{Node: &etcd.Node{ModifiedIndex: 30}}, nil).Once()
+	c.Check(store.StoreHints(one), gc.IsNil)
+
+	keysAPI.AssertExpectations(c)
+}
+
+func (s *HintsStoreSuite) TestRecorderPublishesToStore(c *gc.C) {
+	var client = NewMemoryClient()
+	c.Assert(client.Create(aRecoveryLog), gc.IsNil)
+	c.Assert(client.Create(hintsLog), gc.IsNil)
+
+	var fsm, err = NewFSM(FSMHints{Log: aRecoveryLog})
+	c.Assert(err, gc.IsNil)
+	recorder, err := NewRecorder(fsm, 0, client)
+	c.Assert(err, gc.IsNil)
+
+	var store = JournalHintsStore{Client: client, Journal: hintsLog}
+	recorder.SetHintsStore(store, 0, 1)
+
+	recorder.NewWritableFile("/path/one")
+	<-recorder.hints.inFlight
+
+	hints, err := store.LoadHints()
+	c.Check(err, gc.IsNil)
+	c.Check(hints, gc.DeepEquals, recorder.BuildHints())
+}
+
+var _ journal.Client = NewMemoryClient()
+
+var _ = gc.Suite(&HintsStoreSuite{})
@@ -0,0 +1,118 @@
+package recoverylog
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/metrics"
+)
+
+// Error returned by HorizonMargin if hints don't define a recovery log horizon.
+var ErrUnknownHorizon = fmt.Errorf("hints have no known recovery log horizon")
+
+// segmentsHorizon returns the horizon of the recovery log required by
+// |segments|, a SegmentSet of live hinted Fnodes: the minimum FirstOffset of
+// any segment. Log content below the horizon isn't required to play back
+// |segments|. The horizon is unknown if there are no segments, or if any
+// segment has an unknown offset, and false is returned.
+func segmentsHorizon(segments SegmentSet) (int64, bool) {
+	if len(segments) == 0 {
+		return 0, false
+	}
+	for _, s := range segments {
+		if s.FirstOffset < 0 {
+			return 0, false
+		}
+	}
+	// Segments of a SegmentSet are ordered on SeqNo, and hence also on offset.
+	return segments[0].FirstOffset, true
+}
+
+// HorizonMargin returns the number of bytes of the recovery log of |hints|
+// which lie between the first offset still available in the log, and the
+// horizon of the log required by |hints| (see CollectGarbage). A margin which
+// shrinks toward zero indicates that log content removal is approaching
+// content required by Players of |hints|. A negative margin indicates that
+// required content has already been removed, and that |hints| can no longer
+// be played back (see Player.Verify). If |hints| have no known horizon,
+// ErrUnknownHorizon is returned. Of a sharded recovery log, the margin is that
+// of hints.Log.
+func HorizonMargin(client journal.Header, hints FSMHints) (int64, error) {
+	var segments, err = hintedSegmentSet(hints)
+	if err != nil {
+		return 0, err
+	}
+	var horizon, ok = segmentsHorizon(segments)
+	if !ok {
+		return 0, ErrUnknownHorizon
+	}
+
+	var head, _ = client.Head(journal.ReadArgs{Journal: hints.Log, Offset: 0})
+
+	var first int64
+	switch head.Error {
+	case nil:
+		first = head.Offset
+	case journal.ErrNotYetAvailable:
+		// All log content (if any) has been removed.
+		first = head.WriteHead
+	default:
+		return 0, head.Error
+	}
+	return horizon - first, nil
+}
+
+// MonitorHorizon checks the HorizonMargin of the FSMHints most recently
+// published to |hintsJournal| (see ReadPublishedHints) every |interval|, until
+// |stopCh| is closed. Each checked margin is reported as the
+// metrics.RecoveryLogHorizonMarginBytes gauge of the recovery log. Should the
+// margin be less than |threshold| bytes, a warning is also logged: standbys of
+// the recovery log are at risk of becoming unrecoverable. Failed checks are
+// logged, and retried after the next |interval|.
+func MonitorHorizon(client journal.Client, hintsJournal journal.Name,
+	interval time.Duration, threshold int64, stopCh <-chan struct{}) {
+
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checkHorizon(client, hintsJournal, threshold)
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// checkHorizon performs a single check of MonitorHorizon.
+func checkHorizon(client journal.Client, hintsJournal journal.Name, threshold int64) {
+	var hints, err = ReadPublishedHints(client, hintsJournal)
+	if err != nil {
+		log.WithFields(log.Fields{"hintsJournal": hintsJournal, "err": err}).
+			Warn("failed to read published hints")
+		return
+	}
+
+	margin, err := HorizonMargin(client, hints)
+	if err == ErrUnknownHorizon {
+		return // Hints don't yet require any log content.
+	} else if err != nil {
+		log.WithFields(log.Fields{"log": hints.Log, "err": err}).
+			Warn("failed to determine recovery log horizon margin")
+		return
+	}
+	metrics.RecoveryLogHorizonMarginBytes.WithLabelValues(hints.Log.String()).Set(float64(margin))
+
+	if margin < threshold {
+		log.WithFields(log.Fields{
+			"log":       hints.Log,
+			"margin":    margin,
+			"threshold": threshold,
+		}).Warn("recovery log horizon is approaching removed content")
+	}
+}
@@ -0,0 +1,78 @@
+package recoverylog
+
+import (
+	gc "github.com/go-check/check"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/metrics"
+	"github.com/LiveRamp/gazette/topic"
+)
+
+type HorizonSuite struct{}
+
+func (s *HorizonSuite) TestMargin(c *gc.C) {
+	var hints = horizonFixture(1200)
+
+	for _, tc := range []struct {
+		head   journal.ReadResult
+		margin int64
+	}{
+		// Content below the horizon remains.
+		{journal.ReadResult{Offset: 1000, WriteHead: 2000}, 200},
+		// Content through the horizon has been removed.
+		{journal.ReadResult{Offset: 1200, WriteHead: 2000}, 0},
+		{journal.ReadResult{Offset: 1300, WriteHead: 2000}, -100},
+		// All content has been removed.
+		{journal.ReadResult{Error: journal.ErrNotYetAvailable, WriteHead: 2000}, -800},
+	} {
+		var margin, err = HorizonMargin(stubHeader{0: tc.head}, hints)
+		c.Check(err, gc.IsNil)
+		c.Check(margin, gc.Equals, tc.margin)
+	}
+
+	// Errors of the log are passed through.
+	var _, err = HorizonMargin(stubHeader{0: {Error: journal.ErrNotFound}}, hints)
+	c.Check(err, gc.Equals, journal.ErrNotFound)
+
+	// Hints without live segments, or with an unknown offset, have no horizon.
+	var head = stubHeader{0: {Offset: 1000, WriteHead: 2000}}
+
+	_, err = HorizonMargin(head, FSMHints{Log: aRecoveryLog})
+	c.Check(err, gc.Equals, ErrUnknownHorizon)
+	_, err = HorizonMargin(head, horizonFixture(-1))
+	c.Check(err, gc.Equals, ErrUnknownHorizon)
+}
+
+func (s *HorizonSuite) TestCheckReportsPublishedHintsMargin(c *gc.C) {
+	var client = NewMemoryClient()
+	client.Write(aRecoveryLog, make([]byte, 2000))
+
+	var hints = horizonFixture(1200)
+	var frame, err = topic.FixedFramingCRC.Encode(&hints, nil)
+	c.Assert(err, gc.IsNil)
+	client.Write(hintsLog, frame)
+
+	checkHorizon(client, hintsLog, 1<<20)
+
+	var m dto.Metric
+	c.Assert(metrics.RecoveryLogHorizonMarginBytes.
+		WithLabelValues(aRecoveryLog.String()).Write(&m), gc.IsNil)
+	c.Check(m.GetGauge().GetValue(), gc.Equals, float64(1200))
+}
+
+// horizonFixture returns FSMHints of aRecoveryLog having horizon |offset|.
+func horizonFixture(offset int64) FSMHints {
+	return FSMHints{
+		Log: aRecoveryLog,
+		LiveNodes: []HintedFnode{
+			{Fnode: 42, Segments: []Segment{
+				{Author: 100, FirstSeqNo: 42, FirstOffset: offset, LastSeqNo: 45},
+				{Author: 100, FirstSeqNo: 50, FirstOffset: 1800, LastSeqNo: 50}}},
+			{Fnode: 44, Segments: []Segment{
+				{Author: 100, FirstSeqNo: 44, FirstOffset: 1300, LastSeqNo: 44}}},
+		},
+	}
+}
+
+var _ = gc.Suite(&HorizonSuite{})
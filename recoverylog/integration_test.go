@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -116,6 +117,35 @@ func (s *RecoveryLogSuite) TestSimpleWarmStandby(c *gc.C) {
 	c.Assert(replica1.makeLive(), gc.IsNil)
 	replica1.put("key foo", "baz")
 	replica1.put("key bar", "bing")
+	<-replica1.recorder.WriteBarrier().Ready
+
+	// While |replica2| is still reading, expect |replica1|'s content becomes
+	// readable from a WarmReader as playback progresses.
+	var warmDir = replica2.tmpdir + ".warm"
+	defer os.RemoveAll(warmDir)
+
+	var warmOpts = rocks.NewDefaultOptions()
+	defer warmOpts.Destroy()
+	var warm = NewWarmReader(replica2.player, warmDir, warmOpts)
+	defer warm.Close()
+
+	var value string
+	for i := 0; i != 100 && value != "baz"; i++ {
+		time.Sleep(50 * time.Millisecond)
+
+		if warm.Refresh() != nil {
+			continue // Database may not yet exist in the played log.
+		}
+		c.Check(warm.View(func(db *rocks.DB) error {
+			var ro = rocks.NewDefaultReadOptions()
+			defer ro.Destroy()
+
+			var b, err = db.GetBytes(ro, []byte("key foo"))
+			value = string(b)
+			return err
+		}), gc.IsNil)
+	}
+	c.Check(value, gc.Equals, "baz")
 
 	// Make |replica2| live. Expect |replica1|'s content to be present.
 	c.Assert(replica2.makeLive(), gc.IsNil)
@@ -171,6 +201,10 @@ func (s *RecoveryLogSuite) TestResolutionOfConflictingWriters(c *gc.C) {
 	replica4.startReading(replica2.recorder.BuildHints())
 	c.Assert(replica4.makeLive(), gc.IsNil)
 
+	// Expect each recovered FSM reports the Author of its selected history.
+	c.Check(replica3.fsm.HintedAuthor(), gc.Equals, replica1.recorder.Author())
+	c.Check(replica4.fsm.HintedAuthor(), gc.Equals, replica2.recorder.Author())
+
 	// Expect |replica3| recovered |replica1| history.
 	replica3.expectValues(map[string]string{
 		"key one":  "value one",
@@ -185,6 +219,132 @@ func (s *RecoveryLogSuite) TestResolutionOfConflictingWriters(c *gc.C) {
 	})
 }
 
+func (s *RecoveryLogSuite) TestHandoffMidWriteStream(c *gc.C) {
+	var env = testEnv{c, s.gazette}
+
+	var replica1 = NewTestReplica(&env)
+	defer replica1.teardown()
+
+	replica1.startReading(FSMHints{Log: kTestLogName})
+	c.Assert(replica1.makeLive(), gc.IsNil)
+	replica1.put("key one", "value one")
+	replica1.put("key two", "value two")
+
+	// |replica1| closes its database and hands off recording. |replica2|
+	// takes over its local directory, and continues writing to the log.
+	replica1.closeDB()
+	handoff, err := replica1.recorder.Handoff(replica1.tmpdir)
+	c.Assert(err, gc.IsNil)
+
+	var replica2 = &testReplica{testEnv: &env, tmpdir: replica1.tmpdir}
+	defer replica2.teardown()
+
+	replica2.recorder, err = NewRecorderFromHandoff(handoff, len(replica2.tmpdir), s.gazette)
+	c.Assert(err, gc.IsNil)
+	c.Check(replica2.recorder.fsm.Epoch, gc.Equals, handoff.Epoch+1)
+
+	// Hints of |replica2| prior to its first operation.
+	var hints = replica2.recorder.BuildHints()
+
+	// A stale process of |replica1| continues recording as though it hadn't
+	// handed off, with its Author and epoch, and races ahead of |replica2|.
+	var staleFSM, staleSizes = fsmFromSnapshot(handoff.Snapshot)
+	stale, err := newRecorder(staleFSM, staleSizes, 0, len(replica1.tmpdir), s.gazette)
+	c.Assert(err, gc.IsNil)
+	stale.SetAuthor(handoff.Author)
+
+	stale.NewWritableFile(replica1.tmpdir + "/STALE").Append([]byte("stale content"))
+	<-stale.WriteBarrier().Ready
+
+	replica2.openDB()
+	replica2.put("key two", "value two, again")
+	replica2.put("key three", "value three")
+
+	// Expect |replica3|, hinted from |replica2|, recovers the merged history.
+	var replica3 = NewTestReplica(&env)
+	defer replica3.teardown()
+
+	replica3.startReading(replica2.recorder.BuildHints())
+	c.Assert(replica3.makeLive(), gc.IsNil)
+
+	replica3.expectValues(map[string]string{
+		"key one":   "value one",
+		"key two":   "value two, again",
+		"key three": "value three",
+	})
+
+	// Expect |replica4|, hinted from |replica2| prior to its first operation,
+	// rejects operations of the stale process and recovers the same history.
+	var replica4 = NewTestReplica(&env)
+	defer replica4.teardown()
+
+	replica4.startReading(hints)
+	c.Assert(replica4.makeLive(), gc.IsNil)
+
+	replica4.expectValues(map[string]string{
+		"key one":   "value one",
+		"key two":   "value two, again",
+		"key three": "value three",
+	})
+	_, err = os.Stat(filepath.Join(replica4.tmpdir, "STALE"))
+	c.Check(os.IsNotExist(err), gc.Equals, true)
+}
+
+func (s *RecoveryLogSuite) TestPauseAroundFlush(c *gc.C) {
+	var env = testEnv{c, s.gazette}
+
+	var replica1 = NewTestReplica(&env)
+	defer replica1.teardown()
+
+	replica1.startReading(FSMHints{Log: kTestLogName})
+	c.Assert(replica1.makeLive(), gc.IsNil)
+	replica1.put("key one", "value one")
+
+	c.Assert(replica1.recorder.Pause(), gc.IsNil)
+
+	// Unsynced writes proceed while paused.
+	var wo = rocks.NewDefaultWriteOptions()
+	defer wo.Destroy()
+	c.Check(replica1.db.Put(wo, []byte("key two"), []byte("value two")), gc.IsNil)
+
+	// A flush writes and syncs a new SST file, and blocks until resumed.
+	var flushed = make(chan error)
+	go func() {
+		var fo = rocks.NewDefaultFlushOptions()
+		defer fo.Destroy()
+		fo.SetWait(true)
+
+		flushed <- replica1.db.Flush(fo)
+	}()
+
+	select {
+	case <-flushed:
+		c.Error("flush completed while paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	resumed, err := replica1.recorder.Resume()
+	c.Assert(err, gc.IsNil)
+	<-resumed.Ready
+	c.Check(resumed.Error, gc.IsNil)
+	c.Check(<-flushed, gc.IsNil)
+
+	replica1.put("key three", "value three")
+
+	// Expect |replica2| recovers writes from before, during, and after the pause.
+	var replica2 = NewTestReplica(&env)
+	defer replica2.teardown()
+
+	replica2.startReading(replica1.recorder.BuildHints())
+	c.Assert(replica2.makeLive(), gc.IsNil)
+
+	replica2.expectValues(map[string]string{
+		"key one":   "value one",
+		"key two":   "value two",
+		"key three": "value three",
+	})
+}
+
 func (s *RecoveryLogSuite) TestPlayThenCancel(c *gc.C) {
 	var r = NewTestReplica(&testEnv{c, s.gazette})
 	defer r.teardown()
@@ -209,7 +369,7 @@ func (s *RecoveryLogSuite) TestPlayThenCancel(c *gc.C) {
 
 	c.Check(r.player.Play(r.gazette), gc.Equals, ErrPlaybackCancelled)
 
-	_, err = r.player.MakeLive()
+	_, _, err = r.player.MakeLive()
 	c.Check(err, gc.Equals, ErrPlaybackCancelled)
 
 	// Expect the local directory was deleted.
@@ -228,7 +388,7 @@ func (s *RecoveryLogSuite) TestCancelThenPlay(c *gc.C) {
 	r.player.Cancel()
 	c.Check(r.player.Play(r.gazette), gc.Equals, ErrPlaybackCancelled)
 
-	_, err = r.player.MakeLive()
+	_, _, err = r.player.MakeLive()
 	c.Check(err, gc.Equals, ErrPlaybackCancelled)
 }
 
@@ -251,6 +411,7 @@ type testReplica struct {
 	dbRO   *rocks.ReadOptions
 	db     *rocks.DB
 
+	fsm      *FSM
 	recorder *Recorder
 	player   *Player
 }
@@ -277,15 +438,24 @@ func (r *testReplica) startReading(hints FSMHints) {
 
 // Finish playback, build a new recorder, and open an observed database.
 func (r *testReplica) makeLive() error {
-	fsm, err := r.player.MakeLive()
+	fsm, _, err := r.player.MakeLive()
 	if err != nil {
 		return err
 	}
 	r.Check(r.player.IsAtLogHead(), gc.Equals, true)
 
+	r.fsm = fsm
 	r.recorder, err = NewRecorder(fsm, len(r.tmpdir), r.gazette)
 	r.Assert(err, gc.IsNil)
 
+	r.openDB()
+	return nil
+}
+
+// Open a database observed by the replica's recorder.
+func (r *testReplica) openDB() {
+	var err error
+
 	r.dbO = rocks.NewDefaultOptions()
 	r.dbO.SetCreateIfMissing(true)
 	r.dbO.SetEnv(rocks.NewObservedEnv(r.recorder))
@@ -297,7 +467,6 @@ func (r *testReplica) makeLive() error {
 
 	r.db, err = rocks.OpenDb(r.dbO, r.tmpdir)
 	r.Assert(err, gc.IsNil)
-	return nil
 }
 
 func (r *testReplica) put(key, value string) {
@@ -319,12 +488,17 @@ func (r *testReplica) expectValues(expect map[string]string) {
 	r.Check(expect, gc.HasLen, 0)
 }
 
+func (r *testReplica) closeDB() {
+	r.db.Close()
+	r.dbRO.Destroy()
+	r.dbWO.Destroy()
+	r.dbO.Destroy()
+	r.db = nil
+}
+
 func (r *testReplica) teardown() {
 	if r.db != nil {
-		r.db.Close()
-		r.dbRO.Destroy()
-		r.dbWO.Destroy()
-		r.dbO.Destroy()
+		r.closeDB()
 	}
 	r.Assert(os.RemoveAll(r.tmpdir), gc.IsNil)
 }
@@ -0,0 +1,264 @@
+package recoverylog
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// MemoryClient is a journal.Client of in-memory journals, intended for unit
+// tests of Recorders and Players which don't require a Gazette broker. Appends
+// commit immediately, and journals are created by Create or implicitly by
+// their first append.
+//
+// Reads honor ReadArgs as a broker would. An Offset of -1 reads from the write
+// head, and an Offset of 0 from the beginning of the journal. A non-blocking
+// read at or beyond the readable end of the journal fails with
+// ErrNotYetAvailable. A blocking read (having Blocking or a Deadline) instead
+// returns a reader which blocks at the readable end until more content is
+// available, returning EOF once the Deadline (if any) passes or the reader is
+// closed.
+type MemoryClient struct {
+	mu       sync.Mutex
+	journals map[journal.Name]*memoryJournal
+	clock    journal.Clock
+}
+
+type memoryJournal struct {
+	content []byte
+	// Offset through which content is readable, or -1 if all content is.
+	readable int64
+	// Closed and replaced as content is appended or becomes readable.
+	changed chan struct{}
+}
+
+// NewMemoryClient returns an empty MemoryClient.
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		journals: make(map[journal.Name]*memoryJournal),
+		clock:    journal.SystemClock,
+	}
+}
+
+// SetClock sets the Clock against which read Deadlines are evaluated.
+// By default, journal.SystemClock is used.
+func (c *MemoryClient) SetClock(clock journal.Clock) {
+	c.mu.Lock()
+	c.clock = clock
+	c.mu.Unlock()
+}
+
+// SetReadable limits reads of journal |name| to content before |offset|,
+// which may be less than its write head. This simulates a broker which has not
+// yet made appended content available: reads block (or fail with
+// ErrNotYetAvailable) at |offset|, and ReadResults report |offset| as the
+// WriteHead. An |offset| of -1 makes all content readable.
+func (c *MemoryClient) SetReadable(name journal.Name, offset int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var j = c.journal(name)
+	j.readable = offset
+	j.notify()
+}
+
+// WriteHead returns the write head of journal |name|.
+func (c *MemoryClient) WriteHead(name journal.Name) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if j, ok := c.journals[name]; ok {
+		return int64(len(j.content))
+	}
+	return 0
+}
+
+// Content returns a copy of all content of journal |name|.
+func (c *MemoryClient) Content(name journal.Name) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if j, ok := c.journals[name]; ok {
+		return append([]byte(nil), j.content...)
+	}
+	return nil
+}
+
+// Create implements journal.Creator.
+func (c *MemoryClient) Create(name journal.Name) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.journals[name]; ok {
+		return journal.ErrExists
+	}
+	c.journal(name)
+	return nil
+}
+
+// Write implements journal.Writer.
+func (c *MemoryClient) Write(name journal.Name, buf []byte) (*journal.AsyncAppend, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var j = c.journal(name)
+	j.content = append(j.content, buf...)
+
+	if len(buf) != 0 {
+		j.notify()
+	}
+
+	var result = &journal.AsyncAppend{
+		AppendResult: journal.AppendResult{WriteHead: int64(len(j.content))},
+		Journal:      name,
+		Begin:        int64(len(j.content) - len(buf)),
+		End:          int64(len(j.content)),
+		Ready:        make(chan struct{}),
+	}
+	close(result.Ready)
+
+	return result, nil
+}
+
+// ReadFrom implements journal.Writer.
+func (c *MemoryClient) ReadFrom(name journal.Name, r io.Reader) (*journal.AsyncAppend, error) {
+	var buf, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return c.Write(name, buf)
+}
+
+// Head implements journal.Header. The returned Fragment spans all readable
+// content of the journal.
+func (c *MemoryClient) Head(args journal.ReadArgs) (journal.ReadResult, *url.URL) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.resolve(args), nil
+}
+
+// Get implements journal.Getter.
+func (c *MemoryClient) Get(args journal.ReadArgs) (journal.ReadResult, io.ReadCloser) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var result = c.resolve(args)
+	var blocking = args.Blocking || !args.Deadline.IsZero()
+
+	if result.Error == journal.ErrNotYetAvailable && blocking {
+		result.Error = nil
+	} else if result.Error != nil {
+		return result, nil
+	}
+
+	return result, &memoryReader{
+		client:   c,
+		journal:  c.journals[args.Journal],
+		offset:   result.Offset,
+		blocking: blocking,
+		deadline: args.Deadline,
+		closeCh:  make(chan struct{}),
+	}
+}
+
+// journal returns the named journal, creating it if it doesn't exist.
+// |mu| must be held.
+func (c *MemoryClient) journal(name journal.Name) *memoryJournal {
+	var j, ok = c.journals[name]
+	if !ok {
+		j = &memoryJournal{readable: -1, changed: make(chan struct{})}
+		c.journals[name] = j
+	}
+	return j
+}
+
+// resolve returns the ReadResult of |args|. |mu| must be held.
+func (c *MemoryClient) resolve(args journal.ReadArgs) journal.ReadResult {
+	var j, ok = c.journals[args.Journal]
+	if !ok {
+		return journal.ReadResult{Error: journal.ErrNotFound}
+	}
+	var end = j.end()
+
+	var result = journal.ReadResult{Offset: args.Offset, WriteHead: end}
+	if result.Offset == -1 {
+		result.Offset = end
+	}
+
+	if result.Offset >= end {
+		result.Error = journal.ErrNotYetAvailable
+	} else {
+		result.Fragment = journal.Fragment{Journal: args.Journal, Begin: 0, End: end}
+	}
+	return result
+}
+
+// end returns the readable end offset of the journal.
+func (j *memoryJournal) end() int64 {
+	if j.readable != -1 && j.readable < int64(len(j.content)) {
+		return j.readable
+	}
+	return int64(len(j.content))
+}
+
+// notify wakes readers blocked on the journal.
+func (j *memoryJournal) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// memoryReader reads content of a memoryJournal from |offset|.
+type memoryReader struct {
+	client   *MemoryClient
+	journal  *memoryJournal
+	offset   int64
+	blocking bool
+	deadline time.Time
+	// Fires at |deadline|. Set on the first blocked read.
+	deadlineCh <-chan time.Time
+	closeCh    chan struct{}
+}
+
+func (r *memoryReader) Read(p []byte) (int, error) {
+	var c = r.client
+
+	for {
+		c.mu.Lock()
+
+		if end := r.journal.end(); r.offset < end {
+			var n = copy(p, r.journal.content[r.offset:end])
+			r.offset += int64(n)
+
+			c.mu.Unlock()
+			return n, nil
+		} else if !r.blocking {
+			c.mu.Unlock()
+			return 0, io.EOF
+		}
+		var changed = r.journal.changed
+
+		if r.deadlineCh == nil && !r.deadline.IsZero() {
+			r.deadlineCh = c.clock.After(r.deadline.Sub(c.clock.Now()))
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-r.deadlineCh:
+			return 0, io.EOF
+		case <-r.closeCh:
+			return 0, io.EOF
+		}
+	}
+}
+
+// Close releases a Read which is blocked.
+func (r *memoryReader) Close() error {
+	close(r.closeCh)
+	return nil
+}
@@ -0,0 +1,169 @@
+package recoverylog
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	gc "github.com/go-check/check"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type MemoryClientSuite struct{}
+
+func (s *MemoryClientSuite) TestCreateAndAppend(c *gc.C) {
+	var client = NewMemoryClient()
+
+	c.Check(client.Create(aRecoveryLog), gc.IsNil)
+	c.Check(client.Create(aRecoveryLog), gc.Equals, journal.ErrExists)
+
+	var result, err = client.Write(aRecoveryLog, []byte("hello, "))
+	c.Check(err, gc.IsNil)
+	<-result.Ready
+	c.Check(result.WriteHead, gc.Equals, int64(7))
+
+	result, err = client.ReadFrom(aRecoveryLog, strings.NewReader("world"))
+	c.Check(err, gc.IsNil)
+	<-result.Ready
+	c.Check(result.WriteHead, gc.Equals, int64(12))
+
+	c.Check(client.WriteHead(aRecoveryLog), gc.Equals, int64(12))
+	c.Check(string(client.Content(aRecoveryLog)), gc.Equals, "hello, world")
+}
+
+func (s *MemoryClientSuite) TestReadOffsets(c *gc.C) {
+	var client = NewMemoryClient()
+
+	var result, _ = client.Head(journal.ReadArgs{Journal: aRecoveryLog})
+	c.Check(result.Error, gc.Equals, journal.ErrNotFound)
+
+	client.Write(aRecoveryLog, []byte("hello, world"))
+
+	// Offset zero reads from the journal beginning.
+	result, rc := client.Get(journal.ReadArgs{Journal: aRecoveryLog, Offset: 0})
+	c.Check(result.Error, gc.IsNil)
+	c.Check(result.Offset, gc.Equals, int64(0))
+	c.Check(result.WriteHead, gc.Equals, int64(12))
+	c.Check(result.Fragment.End, gc.Equals, int64(12))
+	c.Check(readAll(c, rc), gc.Equals, "hello, world")
+
+	// As do explicit offsets.
+	result, rc = client.Get(journal.ReadArgs{Journal: aRecoveryLog, Offset: 7})
+	c.Check(result.Offset, gc.Equals, int64(7))
+	c.Check(readAll(c, rc), gc.Equals, "world")
+
+	// Non-blocking reads at the write head aren't available.
+	result, rc = client.Get(journal.ReadArgs{Journal: aRecoveryLog, Offset: -1})
+	c.Check(result.Error, gc.Equals, journal.ErrNotYetAvailable)
+	c.Check(result.Offset, gc.Equals, int64(12))
+	c.Check(rc, gc.IsNil)
+
+	result, _ = client.Head(journal.ReadArgs{Journal: aRecoveryLog, Offset: 12})
+	c.Check(result.Error, gc.Equals, journal.ErrNotYetAvailable)
+	c.Check(result.WriteHead, gc.Equals, int64(12))
+}
+
+func (s *MemoryClientSuite) TestReadableLimit(c *gc.C) {
+	var client = NewMemoryClient()
+	client.Write(aRecoveryLog, []byte("hello, world"))
+	client.SetReadable(aRecoveryLog, 5)
+
+	var result, rc = client.Get(journal.ReadArgs{Journal: aRecoveryLog, Offset: 0})
+	c.Check(result.WriteHead, gc.Equals, int64(5))
+	c.Check(readAll(c, rc), gc.Equals, "hello")
+
+	result, _ = client.Get(journal.ReadArgs{Journal: aRecoveryLog, Offset: 5})
+	c.Check(result.Error, gc.Equals, journal.ErrNotYetAvailable)
+
+	client.SetReadable(aRecoveryLog, -1)
+
+	result, rc = client.Get(journal.ReadArgs{Journal: aRecoveryLog, Offset: 5})
+	c.Check(result.Error, gc.IsNil)
+	c.Check(readAll(c, rc), gc.Equals, ", world")
+}
+
+func (s *MemoryClientSuite) TestBlockingReadAwaitsContent(c *gc.C) {
+	var client = NewMemoryClient()
+	client.Write(aRecoveryLog, []byte("hello"))
+
+	var result, rc = client.Get(journal.ReadArgs{
+		Journal:  aRecoveryLog,
+		Offset:   -1,
+		Blocking: true,
+	})
+	c.Check(result.Error, gc.IsNil)
+	c.Check(result.Offset, gc.Equals, int64(5))
+
+	var readCh = make(chan string)
+	go func() {
+		var buf = make([]byte, 64)
+		var n, _ = rc.Read(buf)
+		readCh <- string(buf[:n])
+	}()
+
+	select {
+	case <-readCh:
+		c.Fatal("read didn't block at the write head")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	client.Write(aRecoveryLog, []byte(", world"))
+	c.Check(<-readCh, gc.Equals, ", world")
+
+	// Close releases a blocked read with EOF.
+	go func() {
+		var _, err = rc.Read(make([]byte, 64))
+		c.Check(err, gc.Equals, io.EOF)
+		close(readCh)
+	}()
+	c.Check(rc.Close(), gc.IsNil)
+	<-readCh
+}
+
+func (s *MemoryClientSuite) TestDeadlineReadReturnsEOF(c *gc.C) {
+	var clock = journal.NewManualClock(time.Unix(1500000000, 0))
+
+	var client = NewMemoryClient()
+	client.SetClock(clock)
+	client.Write(aRecoveryLog, []byte("hello"))
+
+	var result, rc = client.Get(journal.ReadArgs{
+		Journal:  aRecoveryLog,
+		Offset:   3,
+		Deadline: clock.Now().Add(time.Second),
+	})
+	c.Check(result.Error, gc.IsNil)
+
+	var readCh = make(chan string)
+	go func() { readCh <- readAll(c, rc) }()
+
+	// Expect available content is read, and the reader then blocks until the
+	// deadline passes.
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	c.Check(<-readCh, gc.Equals, "lo")
+	client.Write(aRecoveryLog, []byte("!"))
+
+	// A deadline which has already passed reads only available content.
+	result, rc = client.Get(journal.ReadArgs{
+		Journal:  aRecoveryLog,
+		Offset:   0,
+		Deadline: clock.Now().Add(-time.Second),
+	})
+	c.Check(readAll(c, rc), gc.Equals, "hello!")
+}
+
+// readAll reads |rc| through EOF.
+func readAll(c *gc.C, rc io.ReadCloser) string {
+	defer rc.Close()
+
+	var b, err = ioutil.ReadAll(rc)
+	c.Assert(err, gc.IsNil)
+	return string(b)
+}
+
+var _ = gc.Suite(&MemoryClientSuite{})
@@ -0,0 +1,292 @@
+package recoverylog
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// Size of content chunks read ahead by a prefetcher.
+const prefetchChunkSize = 1 << 16
+
+// Length of the queue of each write applier.
+const writeApplierQueueSize = 16
+
+// SetPrefetch arranges for a subsequent Play invocation to read up to |size|
+// bytes of each journal of the recovery log ahead of the operation being
+// played. Content is fetched concurrently with the decoding and application
+// of operations, which continue to be applied in log order. Zero (the
+// default) disables prefetching.
+func (p *Player) SetPrefetch(size int) { p.prefetchSize = size }
+
+// SetWriteParallelism arranges for a subsequent Play invocation to apply
+// Write operations to local files using |n| concurrent goroutines. Writes
+// of a single Fnode are always applied in order, by the same goroutine, and
+// all pending writes are applied before an Fnode is unlinked, before a view
+// is linked (see LinkView), and before playback completes. One or less (the
+// default) applies writes serially with playback.
+func (p *Player) SetWriteParallelism(n int) { p.writeParallelism = n }
+
+// logReader reads a journal of the recovery log.
+type logReader struct {
+	rr *journal.RetryReader
+	br *bufio.Reader
+	// Reads ahead of |rr|, if prefetching is enabled. |br| then reads from
+	// |pf| rather than |rr|.
+	pf *prefetcher
+}
+
+func newLogReader(rr *journal.RetryReader, prefetchSize int) logReader {
+	if prefetchSize <= 0 {
+		return logReader{rr: rr, br: bufio.NewReader(rr)}
+	}
+	var pf = newPrefetcher(rr, prefetchSize)
+	return logReader{rr: rr, br: bufio.NewReader(pf), pf: pf}
+}
+
+// mark returns the Mark of the next operation to be read from |br|.
+func (r logReader) mark() journal.Mark {
+	if r.pf == nil {
+		return r.rr.AdjustedMark(r.br)
+	}
+	return journal.Mark{
+		Journal: r.rr.Mark.Journal,
+		Offset:  r.pf.offset - int64(r.br.Buffered()),
+	}
+}
+
+// readOffset returns the offset through which content has been read into
+// |br|.
+func (r logReader) readOffset() int64 {
+	if r.pf == nil {
+		return r.rr.Mark.Offset
+	}
+	return r.pf.offset
+}
+
+// writeHead returns the journal WriteHead, as of the last read into |br|.
+func (r logReader) writeHead() int64 {
+	if r.pf == nil {
+		return r.rr.Result.WriteHead
+	}
+	return r.pf.writeHead
+}
+
+// seek seeks the logReader to absolute |offset|, discarding buffered content.
+func (r logReader) seek(offset int64) error {
+	if r.pf == nil {
+		if _, err := r.rr.Seek(offset, os.SEEK_SET); err != nil {
+			return err
+		}
+		r.br.Reset(r.rr)
+		return nil
+	}
+	if err := r.pf.seek(offset); err != nil {
+		return err
+	}
+	r.br.Reset(r.pf)
+	return nil
+}
+
+// close stops prefetching, if enabled, and closes the RetryReader.
+func (r logReader) close() error {
+	if r.pf != nil {
+		r.pf.halt()
+	}
+	return r.rr.Close()
+}
+
+// prefetcher is an io.Reader which reads ahead of a RetryReader into a
+// bounded queue of chunks, concurrently with reads of previously read chunks.
+type prefetcher struct {
+	rr     *journal.RetryReader
+	chunks chan prefetchChunk
+	stop   chan struct{}
+	done   chan struct{}
+
+	// Remainder of the chunk being read.
+	cur prefetchChunk
+	// Offset of the next byte returned by Read, and the WriteHead of the read
+	// which produced it.
+	offset, writeHead int64
+}
+
+type prefetchChunk struct {
+	b         []byte
+	offset    int64
+	writeHead int64
+	err       error
+}
+
+func newPrefetcher(rr *journal.RetryReader, size int) *prefetcher {
+	var n = size / prefetchChunkSize
+	if n < 1 {
+		n = 1
+	}
+	var pf = &prefetcher{
+		rr:     rr,
+		chunks: make(chan prefetchChunk, n),
+	}
+	pf.start()
+	return pf
+}
+
+func (pf *prefetcher) start() {
+	pf.cur = prefetchChunk{}
+	pf.offset, pf.writeHead = pf.rr.Mark.Offset, pf.rr.Result.WriteHead
+	pf.stop, pf.done = make(chan struct{}), make(chan struct{})
+
+	go pf.loop(pf.chunks, pf.stop, pf.done)
+}
+
+// halt stops the read-ahead goroutine, and discards queued chunks. Only
+// after halt returns may |rr| be used by the caller.
+func (pf *prefetcher) halt() {
+	close(pf.stop)
+	<-pf.done
+
+	for len(pf.chunks) != 0 {
+		<-pf.chunks
+	}
+}
+
+func (pf *prefetcher) loop(chunks chan<- prefetchChunk, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	for {
+		var b = make([]byte, prefetchChunkSize)
+		var n, err = pf.rr.Read(b)
+
+		// |rr| may skip forward prior to the read. Its Mark reflects the offset
+		// following the read content.
+		var chunk = prefetchChunk{
+			b:         b[:n],
+			offset:    pf.rr.Mark.Offset - int64(n),
+			writeHead: pf.rr.Result.WriteHead,
+			err:       err,
+		}
+		select {
+		case chunks <- chunk:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (pf *prefetcher) Read(p []byte) (int, error) {
+	if len(pf.cur.b) == 0 && pf.cur.err == nil {
+		pf.cur = <-pf.chunks
+		pf.offset, pf.writeHead = pf.cur.offset, pf.cur.writeHead
+	}
+	var n = copy(p, pf.cur.b)
+	pf.cur.b = pf.cur.b[n:]
+	pf.offset += int64(n)
+
+	if len(pf.cur.b) == 0 && pf.cur.err != nil {
+		var err = pf.cur.err
+		pf.cur.err = nil
+		return n, err
+	}
+	return n, nil
+}
+
+// seek halts read-ahead, seeks the RetryReader to absolute |offset|, and
+// resumes read-ahead from |offset|.
+func (pf *prefetcher) seek(offset int64) error {
+	pf.halt()
+
+	var _, err = pf.rr.Seek(offset, os.SEEK_SET)
+	pf.start()
+	return err
+}
+
+// writeAppliers apply Write operations to local files using concurrent
+// goroutines. Each Fnode is mapped to a single goroutine, which applies its
+// writes in order.
+type writeAppliers struct {
+	queues []chan writeTask
+	// Outstanding writeTasks.
+	pending sync.WaitGroup
+
+	// First error encountered by an applier.
+	err error
+	mu  sync.Mutex
+}
+
+type writeTask struct {
+	file    File
+	offset  int64
+	content []byte
+}
+
+func newWriteAppliers(n int) *writeAppliers {
+	var a = &writeAppliers{queues: make([]chan writeTask, n)}
+
+	for i := range a.queues {
+		a.queues[i] = make(chan writeTask, writeApplierQueueSize)
+		go a.serve(a.queues[i])
+	}
+	return a
+}
+
+func (a *writeAppliers) serve(queue <-chan writeTask) {
+	for task := range queue {
+		var _, err = task.file.Seek(task.offset, 0)
+		if err == nil {
+			_, err = task.file.Write(task.content)
+		}
+		if err != nil {
+			a.mu.Lock()
+			if a.err == nil {
+				a.err = err
+			}
+			a.mu.Unlock()
+		}
+		a.pending.Done()
+	}
+}
+
+// write reads |length| bytes of |r|, and queues their write at |offset| of
+// |file| of |fnode|. It returns an error previously encountered by an
+// applier, if any.
+func (a *writeAppliers) write(fnode Fnode, file File, offset int64, r io.Reader, length int64) error {
+	if err := a.firstErr(); err != nil {
+		return err
+	}
+
+	var content = make([]byte, length)
+	if _, err := io.ReadFull(r, content); err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+
+	a.pending.Add(1)
+	a.queues[int(fnode)%len(a.queues)] <- writeTask{file: file, offset: offset, content: content}
+	return nil
+}
+
+// flush blocks until queued writes have been applied, and returns the first
+// error encountered by an applier, if any.
+func (a *writeAppliers) flush() error {
+	a.pending.Wait()
+	return a.firstErr()
+}
+
+// stop flushes queued writes, and stops the applier goroutines.
+func (a *writeAppliers) stop() {
+	a.pending.Wait()
+
+	for _, q := range a.queues {
+		close(q)
+	}
+}
+
+func (a *writeAppliers) firstErr() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
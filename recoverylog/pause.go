@@ -0,0 +1,127 @@
+package recoverylog
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+var (
+	ErrRecorderPaused    = fmt.Errorf("recorder is paused")
+	ErrRecorderNotPaused = fmt.Errorf("recorder is not paused")
+)
+
+// Pause stops the Recorder from appending to the recovery log, until Resume
+// is called. It's intended for brief maintenance operations during which the
+// log must not change (eg, while an external snapshot of the log is taken),
+// and which don't warrant closing the database.
+//
+// The database needn't be quiesced. While paused, file operations observed by
+// the Recorder continue to be applied to its FSM, but the frames which record
+// them are buffered in memory rather than appended. Resume appends buffered
+// frames in their original order, and no observed operation is lost.
+// However, operations observed while paused are not durable until Resume.
+// WriteBarriers (and file Syncs, which RocksDB issues when flushing a memtable
+// or writing its WAL) block until Resume's appends have committed: a database
+// must not be paused for longer than it can tolerate a stalled flush or
+// synced write. FSMHints aren't published to a hints journal while paused.
+//
+// BuildHints may reference operations which are buffered. As with any hints,
+// they should be stored only after a subsequent WriteBarrier resolves, which
+// for hints built while paused occurs after Resume.
+//
+// Pause returns ErrRecorderPaused if the Recorder is already paused.
+func (r *Recorder) Pause() error {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	if r.paused != nil {
+		return ErrRecorderPaused
+	}
+	r.paused = &pausedFrames{
+		resumed: &journal.AsyncAppend{Ready: make(chan struct{})},
+	}
+	return nil
+}
+
+// Resume appends frames buffered while the Recorder was paused, in order,
+// and resumes appending frames as operations are observed. The returned
+// AsyncAppend resolves when all buffered frames have committed, as do
+// WriteBarriers issued while the Recorder was paused. Resume returns
+// ErrRecorderNotPaused if the Recorder isn't paused.
+func (r *Recorder) Resume() (*journal.AsyncAppend, error) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	var paused = r.paused
+	if paused == nil {
+		return nil, ErrRecorderNotPaused
+	}
+	r.paused = nil
+
+	for _, f := range paused.frames {
+		var result, err = r.writer.Write(r.fsm.mark(f.shard).Journal, f.content)
+		if err != nil {
+			log.WithField("err", err).Panic("writing paused op frame")
+		}
+		r.metrics.appendedBytes.Add(float64(len(f.content)))
+		r.updateWriteHead(f.shard, result)
+	}
+	var barrier = allAppends(r.barriers())
+
+	log.WithFields(log.Fields{
+		"log":    r.fsm.LogMark.Journal,
+		"frames": len(paused.frames),
+		"bytes":  paused.size,
+	}).Info("resumed paused recorder")
+
+	go func(resumed *journal.AsyncAppend) {
+		<-barrier.Ready
+
+		resumed.AppendResult = barrier.AppendResult
+		close(resumed.Ready)
+	}(paused.resumed)
+
+	r.maybePublishHints()
+	return paused.resumed, nil
+}
+
+// pausedFrames are frames recorded while a Recorder is paused.
+type pausedFrames struct {
+	frames []pausedFrame
+	// Total length of |frames|.
+	size int64
+	// Resolved once |frames| have been appended and committed by Resume.
+	resumed *journal.AsyncAppend
+}
+
+type pausedFrame struct {
+	// Journal of the log to which the frame is written.
+	shard   int
+	content []byte
+}
+
+// add buffers |frame|, written to journal |shard| of the log. A nil |frame|
+// is a write barrier, which requires no buffering. Returns an AsyncAppend
+// which resolves on the commit of buffered frames after Resume.
+func (p *pausedFrames) add(shard int, frame []byte) *journal.AsyncAppend {
+	if frame != nil {
+		p.frames = append(p.frames, pausedFrame{shard: shard, content: frame})
+		p.size += int64(len(frame))
+	}
+	return p.resumed
+}
+
+// addReader buffers frame content of |r|. Content is copied, as its
+// underlying buffers may be re-used by the caller after the frame is recorded.
+func (p *pausedFrames) addReader(shard int, r io.Reader) *journal.AsyncAppend {
+	var frame, err = ioutil.ReadAll(r)
+	if err != nil {
+		log.WithField("err", err).Panic("buffering paused op frame")
+	}
+	return p.add(shard, frame)
+}
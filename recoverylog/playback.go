@@ -5,11 +5,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -29,21 +29,97 @@ const (
 // Error returned by Player.Play() & MakeLive() upon Player.Cancel().
 var ErrPlaybackCancelled = fmt.Errorf("playback cancelled")
 
+// Error returned by Player.MakeLive() if playback didn't reach the log head
+// within the timeout of SetMakeLiveTimeout.
+var ErrNotCaughtUp = fmt.Errorf("playback has not caught up to the log head")
+
+// PlayerMode determines the handling of corrupt recovery log operations.
+type PlayerMode int
+
+const (
+	// StrictMode aborts playback upon an operation which cannot be decoded,
+	// or a frame which fails its CRC.
+	StrictMode PlayerMode = iota
+	// LenientMode skips over corrupt operations, re-synchronizing with the next
+	// valid operation of the log. Skipped ranges of the log are returned by
+	// MakeLive, and indicate that recovered file state may be partial.
+	LenientMode
+)
+
+// SkippedRange is a range of the recovery log, as [Begin, End), which was
+// skipped by a LenientMode Player.
+type SkippedRange struct {
+	Begin, End int64
+	// Of a sharded recovery log, the journal of the range if it's one of
+	// FSMHints.Shards. Empty if the range is of FSMHints.Log.
+	Journal journal.Name
+}
+
 type Player struct {
 	fsm *FSM
 	// Prefix added to recovered file paths.
 	localDir string
+	// File system into which file state is recovered. See SetFS.
+	fs FS
 	// Mapping of live Fnodes to local backing files.
-	backingFiles map[Fnode]*os.File
+	backingFiles map[Fnode]File
 
 	// Signals to Play() service loop that Cancel() has been called.
 	cancelCh chan struct{}
 	// Signals to Play() service loop that MakeLive() has been called.
-	makeLiveCh chan struct{}
+	makeLiveCh   chan struct{}
+	makeLiveOnce sync.Once
+	// Maximum duration for which MakeLive() waits. Zero if unbounded.
+	makeLiveTimeout time.Duration
 	// Closed by Play() to signal to MakeLive() that Play() has exited.
 	playExitCh chan error
 	// Closed by Play() to signal that playback has reached the log head.
 	atHeadCh chan struct{}
+	// Requests of LinkView, served by the Play() service loop.
+	viewCh chan viewRequest
+	// Closed by Play() upon its exit.
+	exitedCh chan struct{}
+	// Notified of the applied offset as playback tails the log head. See
+	// SetTailNotify.
+	tailCh chan<- int64
+	// Applied offset of the last notification of |tailCh|.
+	tailNotified int64
+
+	// Paths and sizes of Fnode content seeded by SeedFromSnapshot or
+	// SeedFromLocalDir.
+	seedPaths map[Fnode]string
+	seedSizes map[Fnode]int64
+
+	// Directory into which Fnodes are staged. If empty, |fnodeStagingDir|
+	// within |localDir| is used.
+	stagingDir string
+	// If set, playback content is retained on disk upon abort.
+	keepOnCancel bool
+	// Directories retained by a |keepOnCancel| abort.
+	kept []string
+
+	mode PlayerMode
+	// Ranges of the log skipped in LenientMode.
+	skipped []SkippedRange
+	// Set after a skipped range, until the next valid operation is read.
+	resync bool
+
+	// Progress of playback. See Stats.
+	stats playerStats
+	// Offset through which operations have been applied. See AppliedOffset.
+	// Accessed atomically.
+	applied int64
+	// Index of the journal of the log from which the next operation is read.
+	// Always zero, unless the log is sharded.
+	shard int
+	// Clock of recovery log reads and Stats. See SetClock.
+	clock journal.Clock
+	// Bytes of each journal read ahead of playback. See SetPrefetch.
+	prefetchSize int
+	// Number of goroutines applying writes. See SetWriteParallelism.
+	writeParallelism int
+	// Applies writes concurrently with playback, if |writeParallelism| > 1.
+	appliers *writeAppliers
 }
 
 // NewPlayer returns a new Player for recovering the log indicated by |hints|
@@ -57,12 +133,19 @@ func NewPlayer(hints FSMHints, localDir string) (*Player, error) {
 	return &Player{
 		fsm:          fsm,
 		localDir:     localDir,
-		backingFiles: make(map[Fnode]*os.File),
+		fs:           OSFS{},
+		backingFiles: make(map[Fnode]File),
 		cancelCh:     make(chan struct{}),
 		makeLiveCh:   make(chan struct{}),
 		// Buffered because Play() may exit before MakeLive() is called.
 		playExitCh: make(chan error, 1),
 		atHeadCh:   make(chan struct{}),
+		viewCh:     make(chan viewRequest),
+		exitedCh:   make(chan struct{}),
+		applied:    -1,
+		clock:      journal.SystemClock,
+
+		tailNotified: -1,
 	}, nil
 }
 
@@ -70,17 +153,48 @@ func NewPlayer(hints FSMHints, localDir string) (*Player, error) {
 // has exited as well, after successfully restoring local file state to match
 // operations in the recovery-log through the current write head. The Player
 // FSM instance is returned, which can be used to construct Recorder for
-// recording further file state changes.
-func (p *Player) MakeLive() (*FSM, error) {
-	close(p.makeLiveCh)
+// recording further file state changes. In LenientMode, ranges of the log
+// which were skipped due to corruption are also returned. If any were, the
+// recovered file state is partial.
+//
+// MakeLive may be called at any time, including before Play has reached the
+// log head: it blocks until playback reads through the write head of the log
+// as of the MakeLive call, and never returns partially recovered file state.
+// If Play fails or is Cancelled while MakeLive is blocked, its error (eg,
+// ErrPlaybackCancelled) is returned. If a timeout is set (see
+// SetMakeLiveTimeout) and elapses first, ErrNotCaughtUp is returned. Playback
+// then continues towards the log head: MakeLive may be called again to
+// continue waiting, or Cancel called to abort playback.
+func (p *Player) MakeLive() (*FSM, []SkippedRange, error) {
+	p.makeLiveOnce.Do(func() { close(p.makeLiveCh) })
+
+	var timeoutCh <-chan time.Time
+	if p.makeLiveTimeout != 0 {
+		timeoutCh = p.clock.After(p.makeLiveTimeout)
+	}
 
 	// Wait for Play() to exit.
-	if err := <-p.playExitCh; err != nil {
-		return nil, err
+	select {
+	case err := <-p.playExitCh:
+		if err != nil {
+			return nil, nil, err
+		}
+	case <-timeoutCh:
+		return nil, nil, ErrNotCaughtUp
 	}
-	return p.fsm, nil
+	return p.fsm, p.skipped, nil
 }
 
+// AppliedOffset returns the absolute offset of the recovery log through which
+// playback has applied operations to its FSM: the offset immediately
+// following the last applied operation. It's -1 if playback hasn't yet applied
+// an operation. AppliedOffset is updated continuously by Play, and may be
+// called from any goroutine. Compared with the log write head, it allows a
+// coordinator of multiple Players (eg, of standby replicas) to determine how
+// far each lags the log. Of a sharded log, it's the sum of offsets of each of
+// its journals, like PlayerStats.Offset.
+func (p *Player) AppliedOffset() int64 { return atomic.LoadInt64(&p.applied) }
+
 // IsAtLogHead returns true if playback has reached the WriteHead returned
 // by a Gazette Journal read. Note that Gazette reads are not transactional,
 // and this determination may be slightly stale.
@@ -103,6 +217,158 @@ func (p *Player) SetCancelChan(cancelCh chan struct{}) {
 	p.cancelCh = cancelCh
 }
 
+// LinkView populates |dir| with the file state recovered by playback thus far,
+// while Play continues to run. Immutable files (SSTs) are hard-linked, and
+// other files are copied through their current length. The view is consistent
+// with the recovery log through the last played operation, and lags the log
+// head (and the database which is writing it). LinkView blocks until Play
+// services the request, and returns ErrPlaybackCancelled if Play has exited.
+func (p *Player) LinkView(dir string) error {
+	var _, err = p.linkViewAt(dir)
+	return err
+}
+
+// linkViewAt is LinkView, which also returns the AppliedOffset with which
+// the view is consistent.
+func (p *Player) linkViewAt(dir string) (int64, error) {
+	var req = viewRequest{dir: dir, resultCh: make(chan viewResult, 1)}
+
+	select {
+	case p.viewCh <- req:
+		var result = <-req.resultCh
+		return result.offset, result.err
+	case <-p.exitedCh:
+		return 0, ErrPlaybackCancelled
+	}
+}
+
+type viewRequest struct {
+	dir      string
+	resultCh chan viewResult
+}
+
+type viewResult struct {
+	offset int64
+	err    error
+}
+
+// SetMode sets the PlayerMode used by a subsequent Play invocation. Players
+// use StrictMode by default.
+func (p *Player) SetMode(mode PlayerMode) { p.mode = mode }
+
+// SetStagingDir arranges for a subsequent Play invocation to stage recovered
+// Fnode content within |dir|, rather than within the Player's local directory.
+// |dir| should be dedicated to the Player: like the local directory, its prior
+// content is removed when Play begins. If |dir| is on a different file system
+// than the local directory, staged content is copied (rather than linked)
+// into the local directory upon MakeLive.
+func (p *Player) SetStagingDir(dir string) { p.stagingDir = dir }
+
+// SetKeepOnCancel determines whether content recovered by Play is retained
+// on disk should playback fail or be cancelled, for forensic inspection. By
+// default, it's removed. Retained directories are returned by KeptDirs.
+// Successful playback is unaffected: MakeLive hands off the local directory
+// to the caller in either case.
+func (p *Player) SetKeepOnCancel(keep bool) { p.keepOnCancel = keep }
+
+// SetMakeLiveTimeout bounds the duration for which MakeLive waits for playback
+// to reach the log head. By default, MakeLive waits indefinitely.
+func (p *Player) SetMakeLiveTimeout(timeout time.Duration) { p.makeLiveTimeout = timeout }
+
+// SetTailNotify arranges for a subsequent Play invocation to notify
+// |notifyCh| of the AppliedOffset each time playback, having applied further
+// operations, reaches the (approximate) log head. Play continues to apply
+// operations as they're recorded until MakeLive or Cancel, and a warm standby
+// may use notifications to Refresh a WarmReader (see WarmReader.Tail) and serve
+// reads which trail the log head only briefly. Notifications don't block
+// playback: if |notifyCh| isn't ready, the notification is retried the next
+// time playback reaches the log head. Play closes |notifyCh| upon its exit.
+func (p *Player) SetTailNotify(notifyCh chan<- int64) { p.tailCh = notifyCh }
+
+// SetClock arranges for a subsequent Play invocation to use |clock| for
+// recovery log read deadlines, cool-offs following read errors, Stats
+// estimates, and MakeLive timeouts. It's intended for testing.
+func (p *Player) SetClock(clock journal.Clock) { p.clock = clock }
+
+// SetFS arranges for a subsequent Play invocation to recover file state into
+// |fs|, rather than the local file system. |fs| is also used by LinkView, and
+// to remove content upon an aborted Play. File state recovered into an FS
+// other than OSFS isn't usable by a database Recorder after MakeLive. SetFS
+// must be called before SeedFromLocalDir, if it's used.
+func (p *Player) SetFS(fs FS) { p.fs = fs }
+
+// KeptDirs returns directories holding content of an aborted Play invocation,
+// which were retained due to SetKeepOnCancel. It's valid only after Play
+// returns.
+func (p *Player) KeptDirs() []string { return p.kept }
+
+// Verify confirms that recovery log offsets from which the Player will read
+// are still present in the journal. It's intended as a pre-flight check prior
+// to Play: if hinted offsets have been removed from the journal (eg, because
+// hints are very stale and fragments have since been expired), Verify returns
+// an ErrHintsBelowHorizon naming the missing range, and the caller may fall
+// back to more recent hints or a Snapshot.
+func (p *Player) Verify(client journal.Header) error {
+	var marks []journal.Mark
+	for _, segment := range p.fsm.hintedSegments {
+		marks = append(marks, journal.NewMark(p.fsm.LogMark.Journal, segment.FirstOffset))
+
+		for i, offset := range segment.ShardOffsets {
+			if i < len(p.fsm.ShardMarks) {
+				marks = append(marks, journal.NewMark(p.fsm.ShardMarks[i].Journal, offset))
+			}
+		}
+	}
+	if len(p.fsm.hintedSegments) == 0 {
+		// Playback begins from the seeded Snapshot, or from hints without
+		// segments, at the current LogMark (and ShardMarks).
+		for shard := 0; shard != p.fsm.shardCount(); shard++ {
+			if mark := *p.fsm.mark(shard); mark.Offset > 0 {
+				marks = append(marks, mark)
+			}
+		}
+	}
+
+	for _, mark := range marks {
+		if mark.Offset < 0 {
+			continue
+		}
+		var result, _ = client.Head(journal.ReadArgs{
+			Journal:  mark.Journal,
+			Offset:   mark.Offset,
+			Blocking: false,
+		})
+
+		switch result.Error {
+		case nil:
+			if result.Offset > mark.Offset {
+				// The journal skipped forward over a range which is no longer present.
+				return ErrHintsBelowHorizon{Log: mark.Journal, Begin: mark.Offset, End: result.Offset}
+			}
+		case journal.ErrNotYetAvailable:
+			if mark.Offset < result.WriteHead {
+				return ErrHintsBelowHorizon{Log: mark.Journal, Begin: mark.Offset, End: result.WriteHead}
+			}
+		default:
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// ErrHintsBelowHorizon is returned by Player.Verify if a recovery log range
+// required for playback is no longer present in the journal.
+type ErrHintsBelowHorizon struct {
+	Log journal.Name
+	// Missing range of the recovery log, as [Begin, End).
+	Begin, End int64
+}
+
+func (e ErrHintsBelowHorizon) Error() string {
+	return fmt.Sprintf("hinted range [%d, %d) of log %s is no longer available",
+		e.Begin, e.End, e.Log)
+}
+
 // Begins playing the prepared player. Returns on the first encountered
 // unrecoverable error, or upon a successful MakeLive().
 func (p *Player) Play(client journal.Client) error {
@@ -115,23 +381,38 @@ func (p *Player) Play(client journal.Client) error {
 			// Remove partial content from disk on playback failure or cancel.
 			p.cleanupAfterAbort()
 		}
+		close(p.exitedCh)
+		if p.tailCh != nil {
+			close(p.tailCh)
+		}
 		p.playExitCh <- err
 	}()
 
 	if err = p.preparePlayback(); err != nil {
 		return err
 	}
+	if p.writeParallelism > 1 {
+		p.appliers = newWriteAppliers(p.writeParallelism)
+		defer p.appliers.stop()
+	}
+
+	// Open a reader of each journal of the log (of which there's one, unless
+	// the log is sharded). Note - here the fsm.LogMark is initialized to -1 on
+	// a new Player.
+	var readers = make([]logReader, p.fsm.shardCount())
+	for shard := range readers {
+		var rr = journal.NewRetryReader(*p.fsm.mark(shard), client)
 
-	// Note - here the fsm.LogMark is initialized to -1 on a new Player.
-	var rr = journal.NewRetryReader(p.fsm.LogMark, client)
-	defer rr.Close()
+		// Configure |rr| to periodically return EOF when no content is available.
+		rr.EOFTimeout = blockInterval
+		rr.Clock = p.clock
 
-	// Configure |rr| to periodically return EOF when no content is available.
-	rr.EOFTimeout = blockInterval
+		readers[shard] = newLogReader(rr, p.prefetchSize)
+		defer readers[shard].close()
+	}
 
 	var atHeadCh = p.atHeadCh // Retain on stack so it may be nil'd.
-	var br = bufio.NewReader(rr)
-	var makeLiveBarrier *journal.AsyncAppend
+	var makeLiveBarriers []*journal.AsyncAppend
 
 	// Play until we're asked to make ourselves live, we've read through to the
 	// transactionally determined recoverylog WriteHead, and we time out
@@ -142,39 +423,69 @@ func (p *Player) Play(client journal.Client) error {
 		case <-p.makeLiveCh:
 			p.makeLiveCh = nil // Don't select again.
 
-			// Issue an empty write (a write barrier) to transactionally determine
-			// the minimum WriteHead we must read through.
-			if makeLiveBarrier, err = client.Write(p.fsm.LogMark.Journal, nil); err != nil {
-				return err
-			}
-			<-makeLiveBarrier.Ready
+			// Issue an empty write (a write barrier) to each journal of the log,
+			// to transactionally determine the minimum WriteHeads we must read
+			// through.
+			for shard := range readers {
+				var barrier *journal.AsyncAppend
 
-			if err = makeLiveBarrier.Error; err != nil {
-				return err
+				if barrier, err = client.Write(p.fsm.mark(shard).Journal, nil); err != nil {
+					return err
+				}
+				<-barrier.Ready
+
+				if err = barrier.Error; err != nil {
+					return err
+				}
+				makeLiveBarriers = append(makeLiveBarriers, barrier)
 			}
 
 		case <-p.cancelCh:
 			err = ErrPlaybackCancelled
 			return err
 
+		case req := <-p.viewCh:
+			req.resultCh <- viewResult{
+				offset: atomic.LoadInt64(&p.applied),
+				err:    p.linkView(req.dir),
+			}
+
 		default:
 			// Non-blocking.
 		}
 
-		if s := p.fsm.hintedSegments; len(s) != 0 && s[0].FirstOffset > rr.AdjustedMark(br).Offset {
-			// Seek the RetryReader forward to the next hinted offset.
-			if _, err = rr.Seek(s[0].FirstOffset, os.SEEK_SET); err != nil {
-				return err
-			}
-			br.Reset(rr)
+		p.updateStats(readers)
+
+		var sought bool
+		if sought, err = p.seekToHints(readers); err != nil {
+			return err
+		} else if sought {
 			continue
 		}
 
+		// The next operation is read from the journal which records it.
+		p.shard = p.fsm.shardOf(p.fsm.NextSeqNo)
+		var lr, br = readers[p.shard], readers[p.shard].br
+
 		// Play the next operation. First Peek to ensure the next byte has been
 		// pre-fetched, which guarantees resolution of the absolute operation offset.
 		if _, err = br.Peek(1); err == nil {
-			p.fsm.LogMark = rr.AdjustedMark(br)
-			err = p.playOperation(br)
+			*p.fsm.mark(p.shard) = lr.mark()
+
+			var seqNo = p.fsm.NextSeqNo
+			if err = p.playOperation(br); err == nil && seqNo != p.fsm.NextSeqNo {
+				// The operation was applied to the FSM.
+				var offset, _ = logOffsets(readers)
+				atomic.StoreInt64(&p.applied, offset)
+			}
+		}
+
+		if resync, ok := err.(resyncOffset); ok {
+			// Seek the reader back to the next plausible frame header.
+			if err = lr.seek(int64(resync)); err != nil {
+				return err
+			}
+			continue
 		}
 
 		if err == io.EOF {
@@ -187,17 +498,20 @@ func (p *Player) Play(client journal.Client) error {
 				close(atHeadCh)
 				atHeadCh = nil
 			}
+			p.notifyTail()
 
-			if makeLiveBarrier != nil {
-				var target = makeLiveBarrier.WriteHead
+			if makeLiveBarriers != nil {
+				// Of a sharded log, the next operation would be recorded only to the
+				// journal of |lr|. Reading it through its target write head suffices.
+				var target = makeLiveBarriers[p.shard].WriteHead
 
 				// A read WriteHead can increase that of |makeLiveBarrier|, but should
 				// not decrease it. Reads are not transactional and can be stale.
-				if rr.Result.WriteHead > target {
-					target = rr.Result.WriteHead
+				if wh := lr.writeHead(); wh > target {
+					target = wh
 				}
 
-				if rr.Mark.Offset == target {
+				if lr.readOffset() == target {
 					// Exit condition: we timed out waiting for content, we've been asked
 					// to make ourselves Live, and we've read to the target write head.
 					err = p.makeLive()
@@ -207,54 +521,180 @@ func (p *Player) Play(client journal.Client) error {
 		} else if err != nil {
 			// Any other error aborts playback.
 			return err
-		} else if atHeadCh != nil && rr.Result.WriteHead <= rr.Mark.Offset {
-			// Signal that playback has reached the approximate log head.
-			close(atHeadCh)
-			atHeadCh = nil
+		} else {
+			if atHeadCh != nil && lr.writeHead() <= lr.readOffset() {
+				// Signal that playback has reached the approximate log head.
+				close(atHeadCh)
+				atHeadCh = nil
+			}
+			if lr.writeHead() <= lr.mark().Offset {
+				// All content through the head has also been applied.
+				p.notifyTail()
+			}
 		}
 	}
 }
 
-func (p *Player) preparePlayback() error {
-	// File nodes are staged into a directory within |localDir| during playback.
-	var fileNodesDir = filepath.Join(p.localDir, fnodeStagingDir)
+// notifyTail notifies |tailCh| of the AppliedOffset, if operations have been
+// applied since its last notification.
+func (p *Player) notifyTail() {
+	var applied = atomic.LoadInt64(&p.applied)
+	if p.tailCh == nil || applied == p.tailNotified {
+		return
+	}
+	select {
+	case p.tailCh <- applied:
+		p.tailNotified = applied
+	default:
+		// Retry on the next call.
+	}
+}
+
+// seekToHints seeks |readers| forward to the offsets of the next hinted
+// Segment, if they're behind them. It returns whether any reader was sought.
+func (p *Player) seekToHints(readers []logReader) (bool, error) {
+	var s = p.fsm.hintedSegments
+	if len(s) == 0 {
+		return false, nil
+	}
+	var sought bool
+
+	for shard, r := range readers {
+		var offset = s[0].FirstOffset
+		if shard != 0 {
+			if shard > len(s[0].ShardOffsets) {
+				continue
+			}
+			offset = s[0].ShardOffsets[shard-1]
+		}
+
+		if offset > r.mark().Offset {
+			// Seek the reader forward to the next hinted offset.
+			if err := r.seek(offset); err != nil {
+				return false, err
+			}
+			sought = true
+		}
+	}
+	return sought, nil
+}
+
+// updateStats updates Stats with the progress of |readers|. Of a sharded log,
+// progress is the sum of that of each of its journals.
+func (p *Player) updateStats(readers []logReader) {
+	var offset, writeHead = logOffsets(readers)
+	p.stats.update(p.clock.Now(), offset, writeHead)
+}
 
-	// Remove all prior content under |p.localDir|.
-	if err := os.RemoveAll(p.localDir); err != nil {
+// logOffsets returns the offset of |readers| and the WriteHead they last read.
+// Of a sharded log, each is the sum of that of each of its journals. The
+// offset is -1 if any reader hasn't yet determined its offset.
+func logOffsets(readers []logReader) (offset, writeHead int64) {
+	for _, r := range readers {
+		var o = r.mark().Offset
+		if o < 0 {
+			return -1, 0
+		}
+		offset, writeHead = offset+o, writeHead+r.writeHead()
+	}
+	return offset, writeHead
+}
+
+func (p *Player) preparePlayback() error {
+	// Remove all prior content under |p.localDir| and the staging directory.
+	if err := p.fs.RemoveAll(p.localDir); err != nil {
+		return err
+	} else if err = p.fs.RemoveAll(p.stagingPath()); err != nil {
 		return err
-	} else if err := os.MkdirAll(fileNodesDir, 0777); err != nil {
+	} else if err = p.fs.MkdirAll(p.localDir); err != nil {
+		return err
+	} else if err = p.fs.MkdirAll(p.stagingPath()); err != nil {
 		return err
 	}
-	return nil
+	return p.seedFnodes()
 }
 
 func (p *Player) cleanupAfterAbort() {
+	if p.appliers != nil {
+		p.appliers.flush() // Errors are moot.
+	}
 	for _, fnode := range p.backingFiles {
 		if err := fnode.Close(); err != nil {
 			log.WithField("err", err).Warn("closing fnode after abort")
 		}
 	}
-	if err := os.RemoveAll(p.localDir); err != nil {
-		log.WithField("err", err).Warn("removing localDir after abort")
+
+	var dirs = []string{p.localDir}
+	if p.stagingDir != "" {
+		dirs = append(dirs, p.stagingDir)
+	}
+
+	if p.keepOnCancel {
+		p.kept = dirs
+		log.WithField("dirs", dirs).Warn("retaining playback directories after abort")
+		return
+	}
+	for _, dir := range dirs {
+		if err := p.fs.RemoveAll(dir); err != nil {
+			log.WithFields(log.Fields{"dir": dir, "err": err}).Warn("removing directory after abort")
+		}
 	}
 }
 
 func (p *Player) playOperation(br *bufio.Reader) error {
 	var b, err = topic.FixedFraming.Unpack(br)
+	var payload []byte
 	var op RecordedOp
 
 	if err != nil {
 		return err
-	} else if err = topic.FixedFraming.Unmarshal(b, &op); err == topic.ErrDesyncDetected {
+	} else if payload, err = topic.FixedFramePayload(b); err == topic.ErrDesyncDetected {
 		// Garbage frame. Treat as no-op operation, allowing playback to continue.
-		log.WithField("mark", p.fsm.LogMark).Warn("detected de-synchronization")
+		log.WithFields(log.Fields{"mark": *p.fsm.mark(p.shard), "err": err}).Warn("detected de-synchronization")
+
+		if p.mode == LenientMode {
+			p.skip(int64(len(b)))
+		}
 		return nil
-	} else if err != nil {
-		return err
+	} else if err == topic.ErrCorruptFrame {
+		// A frame which fails its CRC may hold an operation, which cannot be
+		// played. Playback must abort, unless lenient.
+		if p.mode != LenientMode {
+			return err
+		}
+		log.WithFields(log.Fields{"mark": *p.fsm.mark(p.shard), "err": err}).Warn("skipping corrupt frame")
+
+		p.skip(int64(len(b)))
+		return nil
+	} else if err = op.Unmarshal(payload); err != nil {
+		if p.mode != LenientMode {
+			return err
+		}
+		log.WithFields(log.Fields{"mark": *p.fsm.mark(p.shard), "err": err}).Warn("skipping corrupt operation")
+
+		// The frame length may itself be corrupt. Skip only through the next
+		// plausible frame header within the frame, if there is one.
+		var i = topic.ScanFixedFrameHeader(b)
+		p.skip(int64(i))
+
+		if i != len(b) {
+			return resyncOffset(p.fsm.mark(p.shard).Offset + int64(i))
+		}
+		return nil
+	}
+	p.stats.played()
+
+	if p.resync {
+		// This is the first valid operation following a skipped range, which
+		// may have held operations. Step the FSM forward to this operation.
+		if op.SeqNo > p.fsm.NextSeqNo {
+			p.fsm.skipTo(op.SeqNo, op.Checksum)
+		}
+		p.resync = false
 	}
 
 	// Run the operation through the FSM to verify validity.
-	if fsmErr := p.fsm.Apply(&op, b[topic.FixedFrameHeaderLength:]); fsmErr != nil {
+	if fsmErr := p.fsm.Apply(&op, payload); fsmErr != nil {
 		// Log but otherwise ignore FSM errors: the Player is still in a consistent
 		// state, and we may make further progress later in the log.
 		if fsmErr == ErrFnodeNotTracked {
@@ -287,14 +727,124 @@ func (p *Player) playOperation(br *bufio.Reader) error {
 	return nil
 }
 
+// skip records that |length| bytes of the log at the current LogMark were
+// skipped, extending the last SkippedRange if it's adjacent.
+func (p *Player) skip(length int64) {
+	var mark = p.fsm.mark(p.shard)
+	var begin, end = mark.Offset, mark.Offset + length
+
+	var name journal.Name
+	if p.shard != 0 {
+		name = mark.Journal
+	}
+
+	if l := len(p.skipped); l != 0 && p.skipped[l-1].End == begin && p.skipped[l-1].Journal == name {
+		p.skipped[l-1].End = end
+	} else {
+		p.skipped = append(p.skipped, SkippedRange{Begin: begin, End: end, Journal: name})
+	}
+	p.resync = true
+}
+
+// resyncOffset is returned by playOperation to request that playback seek
+// to the log offset, from which content was skipped.
+type resyncOffset int64
+
+func (r resyncOffset) Error() string {
+	return fmt.Sprintf("resync at offset %d", int64(r))
+}
+
+// linkView populates |dir| with the current recovered file state.
+func (p *Player) linkView(dir string) error {
+	if p.appliers != nil {
+		if err := p.appliers.flush(); err != nil {
+			return err
+		}
+	}
+	for fnode, liveNode := range p.fsm.LiveNodes {
+		for link := range liveNode.Links {
+			var targetPath = filepath.Join(dir, link)
+
+			if err := p.fs.MkdirAll(filepath.Dir(targetPath)); err != nil {
+				return err
+			} else if strings.HasSuffix(link, ".sst") {
+				// SSTs are never modified once referenced by the database MANIFEST.
+				if err = linkOrCopy(p.fs, p.stagedPath(fnode), targetPath); err != nil {
+					return err
+				}
+			} else if err = copyFile(p.fs, p.stagedPath(fnode), targetPath); err != nil {
+				return err
+			}
+		}
+	}
+	for path, content := range p.fsm.Properties {
+		var targetPath = filepath.Join(dir, path)
+
+		if err := p.fs.MkdirAll(filepath.Dir(targetPath)); err != nil {
+			return err
+		} else if err = writeFile(p.fs, targetPath, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies the content of |src| to new file |dst| of |fs|.
+func copyFile(fs FS, src, dst string) error {
+	var r, err = fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := fs.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// linkOrCopy hard-links |src| to |dst| of |fs|, or copies it if they're on
+// different file systems.
+func linkOrCopy(fs FS, src, dst string) error {
+	var err = fs.Link(src, dst)
+	if err == ErrCrossDevice {
+		err = copyFile(fs, src, dst)
+	}
+	return err
+}
+
+// writeFile writes |content| to new file |path| of |fs|.
+func writeFile(fs FS, path, content string) error {
+	var w, err = fs.Create(path)
+	if err != nil {
+		return err
+	} else if _, err = io.Copy(w, strings.NewReader(content)); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// stagingPath returns the directory into which Fnodes are staged.
+func (p *Player) stagingPath() string {
+	if p.stagingDir != "" {
+		return p.stagingDir
+	}
+	return filepath.Join(p.localDir, fnodeStagingDir)
+}
+
 func (p *Player) stagedPath(fnode Fnode) string {
 	fname := strconv.FormatInt(int64(fnode), 10)
-	return filepath.Join(p.localDir, fnodeStagingDir, fname)
+	return filepath.Join(p.stagingPath(), fname)
 }
 
 func (p *Player) create(fnode Fnode) error {
-	backingFile, err := os.OpenFile(p.stagedPath(fnode),
-		os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666) // Expect file to not exist.
+	backingFile, err := p.fs.Create(p.stagedPath(fnode)) // Expect file to not exist.
 	if err == nil {
 		p.backingFiles[fnode] = backingFile
 	}
@@ -308,10 +858,16 @@ func (p *Player) unlink(fnode Fnode) error {
 	}
 	backingFile := p.backingFiles[fnode]
 
+	// Pending writes of |fnode| must be applied before it's closed.
+	if p.appliers != nil {
+		if err := p.appliers.flush(); err != nil {
+			return err
+		}
+	}
 	// Close and remove the local backing file.
 	if err := backingFile.Close(); err != nil {
 		return err
-	} else if err = os.Remove(p.stagedPath(fnode)); err != nil {
+	} else if err = p.fs.Remove(p.stagedPath(fnode)); err != nil {
 		return err
 	}
 	delete(p.backingFiles, fnode)
@@ -321,6 +877,10 @@ func (p *Player) unlink(fnode Fnode) error {
 func (p *Player) write(op *RecordedOp_Write, r io.Reader) error {
 	var backingFile = p.backingFiles[Fnode(op.Fnode)]
 
+	if p.appliers != nil {
+		return p.appliers.write(Fnode(op.Fnode), backingFile, op.Offset, r, op.Length)
+	}
+
 	// Seek to the indicated offset.
 	if _, err := backingFile.Seek(op.Offset, 0); err != nil {
 		return err
@@ -342,8 +902,17 @@ func copyFixed(w io.Writer, r io.Reader, length int64) error {
 }
 
 func (p *Player) makeLive() error {
+	if p.appliers != nil {
+		if err := p.appliers.flush(); err != nil {
+			return err
+		}
+	}
 	if p.fsm.HasHints() {
-		return fmt.Errorf("FSM has remaining unused hints: %+v", p.fsm)
+		if len(p.skipped) == 0 {
+			return fmt.Errorf("FSM has remaining unused hints: %+v", p.fsm)
+		}
+		// Hinted operations may have been within skipped ranges.
+		log.WithFields(log.Fields{"skipped": p.skipped}).Warn("FSM has remaining unused hints")
 	}
 	for fnode, liveNode := range p.fsm.LiveNodes {
 		backingFile := p.backingFiles[fnode]
@@ -353,9 +922,9 @@ func (p *Player) makeLive() error {
 		for link := range liveNode.Links {
 			targetPath := filepath.Join(p.localDir, link)
 
-			if err := os.MkdirAll(filepath.Dir(targetPath), 0777); err != nil {
+			if err := p.fs.MkdirAll(filepath.Dir(targetPath)); err != nil {
 				return err
-			} else if err = os.Link(p.stagedPath(fnode), targetPath); err != nil {
+			} else if err = linkOrCopy(p.fs, p.stagedPath(fnode), targetPath); err != nil {
 				return err
 			}
 			log.WithFields(log.Fields{"fnode": fnode, "target": targetPath}).Info("linked file")
@@ -363,7 +932,7 @@ func (p *Player) makeLive() error {
 		// Close and removed the staged file.
 		if err := backingFile.Close(); err != nil {
 			return err
-		} else if err = os.Remove(p.stagedPath(fnode)); err != nil {
+		} else if err = p.fs.Remove(p.stagedPath(fnode)); err != nil {
 			return err
 		}
 	}
@@ -372,7 +941,7 @@ func (p *Player) makeLive() error {
 		log.WithField("files", p.backingFiles).Panic("backing files not in FSM")
 	}
 	// Remove staging directory.
-	if err := os.Remove(filepath.Join(p.localDir, fnodeStagingDir)); err != nil {
+	if err := p.fs.Remove(p.stagingPath()); err != nil {
 		return err
 	}
 
@@ -381,14 +950,9 @@ func (p *Player) makeLive() error {
 		targetPath := filepath.Join(p.localDir, path)
 
 		// Write |content| to |targetPath|. Expect it to not exist.
-		if err := os.MkdirAll(filepath.Dir(targetPath), 0777); err != nil {
-			return err
-		} else if fout, err := os.OpenFile(targetPath,
-			os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666); err != nil {
-			return err
-		} else if _, err = io.Copy(fout, strings.NewReader(content)); err != nil {
+		if err := p.fs.MkdirAll(filepath.Dir(targetPath)); err != nil {
 			return err
-		} else if err = fout.Close(); err != nil {
+		} else if err = writeFile(p.fs, targetPath, content); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,119 @@
+package recoverylog
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Minimum interval between updates of Player throughput estimates.
+	statsInterval = 1 * time.Second
+	// Weight of the most recent interval in rolling throughput estimates.
+	statsSmoothing = 0.3
+)
+
+// PlayerStats is a snapshot of Player progress through the recovery log.
+type PlayerStats struct {
+	// Offset of the recovery log through which playback has progressed, and the
+	// most recently observed WriteHead of the log.
+	Offset, WriteHead int64
+	// Total operations played.
+	Ops int64
+	// Rolling estimates of the rate of progress through the recovery log.
+	// Note that progress includes ranges of the log which are skipped over
+	// because they're not required by hints.
+	BytesPerSecond, OpsPerSecond float64
+	// Estimated time remaining until playback reaches the log WriteHead.
+	// Zero if playback is at the WriteHead, or if it's CatchingUp.
+	ETA time.Duration
+	// CatchingUp is true if playback is behind the WriteHead, but the WriteHead
+	// is advancing (by an active writer) at least as quickly as playback, and
+	// there's no useful estimate of time remaining.
+	CatchingUp bool
+}
+
+// Stats returns a snapshot of Player progress. The snapshot is updated by Play
+// about once per second, and Stats is cheap to call frequently.
+func (p *Player) Stats() PlayerStats {
+	p.stats.mu.Lock()
+	defer p.stats.mu.Unlock()
+
+	return p.stats.current
+}
+
+// playerStats tracks the progress of Play. It's updated only by the Play
+// goroutine, which holds |mu| only while publishing a new |current|.
+type playerStats struct {
+	mu      sync.Mutex
+	current PlayerStats
+
+	// Operations played thus far.
+	ops int64
+	// Time, offset, WriteHead, and ops of the last update.
+	lastTime                      time.Time
+	lastOffset, lastHead, lastOps int64
+	// Rolling estimate of the rate of WriteHead increase.
+	headRate float64
+	// Set after the first estimate is made.
+	estimated bool
+}
+
+// played records that an operation was read from the log.
+func (s *playerStats) played() { s.ops++ }
+
+// update rolls estimates forward to time |now|, with playback at |offset|
+// of a log having |writeHead|. Estimates are updated only if |statsInterval|
+// has elapsed since the last update.
+func (s *playerStats) update(now time.Time, offset, writeHead int64) {
+	if offset < 0 {
+		return // Playback hasn't yet determined its offset.
+	} else if s.lastTime.IsZero() {
+		s.lastTime, s.lastOffset, s.lastHead, s.lastOps = now, offset, writeHead, s.ops
+
+		s.mu.Lock()
+		s.current.Offset, s.current.WriteHead = offset, writeHead
+		s.mu.Unlock()
+		return
+	}
+
+	var elapsed = now.Sub(s.lastTime).Seconds()
+	if elapsed < statsInterval.Seconds() {
+		return
+	}
+	var next = s.current
+	var bytesRate = float64(offset-s.lastOffset) / elapsed
+	var opsRate = float64(s.ops-s.lastOps) / elapsed
+	var headRate = float64(writeHead-s.lastHead) / elapsed
+
+	if s.estimated {
+		bytesRate = smooth(next.BytesPerSecond, bytesRate)
+		opsRate = smooth(next.OpsPerSecond, opsRate)
+		headRate = smooth(s.headRate, headRate)
+	}
+	next.Offset, next.WriteHead, next.Ops = offset, writeHead, s.ops
+	next.BytesPerSecond, next.OpsPerSecond, s.headRate = bytesRate, opsRate, headRate
+	s.estimated = true
+
+	var remaining = writeHead - offset
+	var rate = next.BytesPerSecond - s.headRate
+
+	if remaining <= 0 {
+		next.ETA, next.CatchingUp = 0, false
+	} else if rate <= 0 {
+		next.ETA, next.CatchingUp = 0, true
+	} else {
+		next.ETA = time.Duration(float64(remaining) / rate * float64(time.Second))
+		next.CatchingUp = false
+	}
+
+	s.lastTime, s.lastOffset, s.lastHead, s.lastOps = now, offset, writeHead, s.ops
+
+	s.mu.Lock()
+	s.current = next
+	s.mu.Unlock()
+}
+
+// smooth returns an exponentially-weighted moving average of |prev| and |sample|.
+func smooth(prev, sample float64) float64 {
+	return statsSmoothing*sample + (1-statsSmoothing)*prev
+}
@@ -3,12 +3,18 @@ package recoverylog
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	gc "github.com/go-check/check"
+	rocks "github.com/tecbot/gorocksdb"
 
 	"github.com/LiveRamp/gazette/journal"
 	"github.com/LiveRamp/gazette/topic"
@@ -51,6 +57,7 @@ func (s *PlaybackSuite) SetUpTest(c *gc.C) {
 }
 
 func (s *PlaybackSuite) TestPlayerInit(c *gc.C) {
+	c.Check(s.player.AppliedOffset(), gc.Equals, int64(-1))
 	c.Check(s.player.localDir, gc.Equals, s.localDir)
 
 	_, err := os.Stat(filepath.Join(s.localDir, fnodeStagingDir))
@@ -237,6 +244,151 @@ func (s *PlaybackSuite) TestMakeLive(c *gc.C) {
 	c.Check(string(bytes), gc.Equals, "prop-value")
 }
 
+func (s *PlaybackSuite) TestMakeLiveWithStagingDir(c *gc.C) {
+	var stagingDir, err = ioutil.TempDir("", "playback-staging")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(stagingDir)
+
+	s.player.SetStagingDir(stagingDir)
+	c.Check(s.player.preparePlayback(), gc.IsNil)
+	c.Check(s.player.stagedPath(42), gc.Equals, filepath.Join(stagingDir, "42"))
+
+	c.Check(s.apply(c, s.frameCreate("/a/path")), gc.IsNil)
+	c.Check(s.apply(c, s.frameCreate("/skipped/path")), gc.IsNil)
+	c.Check(s.apply(c, s.frameCreate("/another/path")), gc.IsNil)
+	c.Check(s.apply(c, s.frameLink(42, "/linked/path")), gc.IsNil)
+	c.Check(s.apply(c, s.frameUnlink(43, "/skipped/path")), gc.IsNil)
+
+	c.Check(s.player.makeLive(), gc.IsNil)
+
+	// Expect the staging directory was removed, and files were linked into
+	// final locations of the local directory.
+	_, err = os.Stat(stagingDir)
+	c.Check(os.IsNotExist(err), gc.Equals, true)
+
+	for _, path := range []string{"a/path", "another/path", "linked/path"} {
+		_, err = os.Stat(filepath.Join(s.localDir, path))
+		c.Check(err, gc.IsNil)
+	}
+}
+
+func (s *PlaybackSuite) TestCleanupAfterAbort(c *gc.C) {
+	c.Check(s.apply(c, s.frameCreate("/a/path")), gc.IsNil)
+
+	// Expect content is retained if KeepOnCancel is set.
+	s.player.SetKeepOnCancel(true)
+	s.player.cleanupAfterAbort()
+
+	c.Check(s.player.KeptDirs(), gc.DeepEquals, []string{s.localDir})
+	_, err := os.Stat(s.player.stagedPath(42))
+	c.Check(err, gc.IsNil)
+
+	// Otherwise, it's removed.
+	s.player.SetKeepOnCancel(false)
+	s.player.cleanupAfterAbort()
+
+	_, err = os.Stat(s.localDir)
+	c.Check(os.IsNotExist(err), gc.Equals, true)
+}
+
+func (s *PlaybackSuite) TestMutationsUseFS(c *gc.C) {
+	var fs = &recordingFS{root: s.localDir}
+	s.player.SetFS(fs)
+
+	c.Check(s.player.preparePlayback(), gc.IsNil)
+	c.Check(s.apply(c, s.frameCreate("/a/path")), gc.IsNil)
+	c.Check(s.apply(c, s.frameCreate("/skipped/path")), gc.IsNil)
+	c.Check(s.apply(c, s.frameCreate("/another/path")), gc.IsNil)
+
+	var buf = s.frameWrite(42, 0, 7)
+	buf.WriteString("content")
+	c.Check(s.apply(c, buf), gc.IsNil)
+
+	c.Check(fs.ops, gc.DeepEquals, []string{
+		"RemoveAll ",
+		"RemoveAll /.fnodes",
+		"MkdirAll ",
+		"MkdirAll /.fnodes",
+		"Create /.fnodes/42",
+		"Create /.fnodes/44",
+	})
+	fs.ops = nil
+
+	// Links which cross file systems are copied instead.
+	fs.crossDevice = true
+	c.Check(s.player.makeLive(), gc.IsNil)
+
+	// Live Fnodes are made live in random order.
+	sort.Strings(fs.ops)
+	c.Check(fs.ops, gc.DeepEquals, []string{
+		"Create /a/path",
+		"Create /another/path",
+		"Create /property/path",
+		"Link /.fnodes/42 /a/path",
+		"Link /.fnodes/44 /another/path",
+		"MkdirAll /a",
+		"MkdirAll /another",
+		"MkdirAll /property",
+		"Open /.fnodes/42",
+		"Open /.fnodes/44",
+		"Remove /.fnodes",
+		"Remove /.fnodes/42",
+		"Remove /.fnodes/44",
+	})
+	fs.ops = nil
+
+	content, err := ioutil.ReadFile(filepath.Join(s.localDir, "a/path"))
+	c.Check(err, gc.IsNil)
+	c.Check(string(content), gc.Equals, "content")
+
+	// Cleanup of an aborted Play is also made through the FS.
+	s.player.cleanupAfterAbort()
+	c.Check(fs.ops, gc.DeepEquals, []string{"RemoveAll "})
+}
+
+func (s *PlaybackSuite) TestLinkView(c *gc.C) {
+	c.Check(s.apply(c, s.frameCreate("/a/path")), gc.IsNil)
+	c.Check(s.apply(c, s.frameCreate("/skipped/path")), gc.IsNil)
+	c.Check(s.apply(c, s.frameCreate("/000123.sst")), gc.IsNil)
+	c.Check(s.apply(c, s.frameLink(42, "/linked/path")), gc.IsNil)
+
+	var buf = s.frameWrite(42, 0, 7)
+	buf.WriteString("content")
+	c.Check(s.apply(c, buf), gc.IsNil)
+
+	viewDir, err := ioutil.TempDir("", "playback-suite-view")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(viewDir)
+
+	c.Check(s.player.linkView(viewDir), gc.IsNil)
+
+	for path, expect := range map[string]string{
+		"a/path":        "content",
+		"linked/path":   "content",
+		"property/path": "prop-value",
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(viewDir, path))
+		c.Check(err, gc.IsNil)
+		c.Check(string(content), gc.Equals, expect)
+	}
+	// Non-hinted Fnodes are not played, and are not in the view.
+	_, err = os.Stat(filepath.Join(viewDir, "skipped/path"))
+	c.Check(os.IsNotExist(err), gc.Equals, true)
+
+	// Copied files don't reflect further playback, but linked SSTs do.
+	buf = s.frameWrite(42, 7, 5)
+	buf.WriteString(" more")
+	c.Check(s.apply(c, buf), gc.IsNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(viewDir, "a/path"))
+	c.Check(err, gc.IsNil)
+	c.Check(string(content), gc.Equals, "content")
+
+	viewInfo, _ := os.Stat(filepath.Join(viewDir, "000123.sst"))
+	stagedInfo, _ := os.Stat(s.player.stagedPath(44))
+	c.Check(os.SameFile(viewInfo, stagedInfo), gc.Equals, true)
+}
+
 func (s *PlaybackSuite) TestHintsRemainOnMakeLive(c *gc.C) {
 	c.Check(s.apply(c, s.frameCreate("/a/path")), gc.IsNil)
 
@@ -244,13 +396,257 @@ func (s *PlaybackSuite) TestHintsRemainOnMakeLive(c *gc.C) {
 	c.Check(err, gc.ErrorMatches, "FSM has remaining unused hints.*")
 }
 
+func (s *PlaybackSuite) TestSeedFromSnapshot(c *gc.C) {
+	seedDir, err := ioutil.TempDir("", "playback-suite-seed")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(seedDir)
+
+	// Seeded content extends beyond the Snapshot.
+	c.Assert(ioutil.WriteFile(filepath.Join(seedDir, "42"),
+		[]byte("seeded-content-and-more"), 0666), gc.IsNil)
+
+	var snapshot = Snapshot{
+		Log:          aRecoveryLog,
+		Offset:       1234,
+		NextSeqNo:    50,
+		NextChecksum: 0x1234,
+		Fnodes: []SnapshotFnode{{
+			Fnode:    42,
+			Links:    []string{"/a/path", "/linked/path"},
+			Segments: []Segment{{Author: 100, FirstSeqNo: 42, LastSeqNo: 45}},
+			Size:     14,
+		}},
+		Properties: []Property{{Path: "/property/path", Content: "prop-value"}},
+	}
+	c.Check(s.player.SeedFromSnapshot(snapshot, seedDir), gc.IsNil)
+	c.Check(s.player.preparePlayback(), gc.IsNil)
+
+	// Expect playback begins from the Snapshot, with no remaining hints.
+	c.Check(s.player.fsm.LogMark, gc.Equals, journal.NewMark(aRecoveryLog, 1234))
+	c.Check(s.player.fsm.NextSeqNo, gc.Equals, int64(50))
+	c.Check(s.player.fsm.HasHints(), gc.Equals, false)
+
+	// Operations following the Snapshot are applied to seeded content.
+	var buf = s.frameWrite(42, 14, 5)
+	buf.WriteString("-more")
+	c.Check(s.apply(c, buf), gc.IsNil)
+
+	c.Check(s.player.makeLive(), gc.IsNil)
+
+	for _, path := range []string{"a/path", "linked/path"} {
+		content, err := ioutil.ReadFile(filepath.Join(s.localDir, path))
+		c.Check(err, gc.IsNil)
+		c.Check(string(content), gc.Equals, "seeded-content-more")
+	}
+	content, err := ioutil.ReadFile(filepath.Join(s.localDir, "property/path"))
+	c.Check(err, gc.IsNil)
+	c.Check(string(content), gc.Equals, "prop-value")
+
+	// Hints of the recovered FSM retain Segments of the Snapshot (here,
+	// extended by the following operation of the same Author).
+	c.Check(s.player.fsm.BuildHints().LiveNodes[0].Segments,
+		gc.DeepEquals, []Segment{{Author: 100, FirstSeqNo: 42, LastSeqNo: 50}})
+
+	// A Snapshot of another log is rejected.
+	snapshot.Log = "other/log"
+	c.Check(s.player.SeedFromSnapshot(snapshot, seedDir), gc.ErrorMatches,
+		"snapshot log other/log doesn't match player log a/recovery/log")
+}
+
+func (s *PlaybackSuite) TestSeedFromLocalDir(c *gc.C) {
+	seedDir, err := ioutil.TempDir("", "playback-suite-seed")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(seedDir)
+
+	// |seedDir| is a materialized database, with content at recorded paths.
+	c.Assert(os.MkdirAll(filepath.Join(seedDir, "a"), 0750), gc.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(seedDir, "a/path"),
+		[]byte("seeded-content"), 0666), gc.IsNil)
+
+	var snapshot = Snapshot{
+		Log:          aRecoveryLog,
+		Offset:       1234,
+		NextSeqNo:    50,
+		NextChecksum: 0x1234,
+		Fnodes: []SnapshotFnode{{
+			Fnode:    42,
+			Links:    []string{"/a/path", "/linked/path"},
+			Segments: []Segment{{Author: 100, FirstSeqNo: 42, LastSeqNo: 45}},
+			Size:     14,
+		}},
+	}
+
+	// Seeded files must be at least as long as the Snapshot.
+	snapshot.Fnodes[0].Size = 15
+	c.Check(s.player.SeedFromLocalDir(snapshot, seedDir), gc.ErrorMatches,
+		`seeded file .*/a/path is shorter than snapshot fnode 42 \(14 < 15\)`)
+	snapshot.Fnodes[0].Size = 14
+
+	// Snapshots must have a known offset.
+	snapshot.Offset = -1
+	c.Check(s.player.SeedFromLocalDir(snapshot, seedDir), gc.ErrorMatches,
+		"snapshot offset -1 is unknown")
+	snapshot.Offset = 1234
+
+	c.Check(s.player.SeedFromLocalDir(snapshot, seedDir), gc.IsNil)
+	c.Check(s.player.preparePlayback(), gc.IsNil)
+
+	c.Check(s.player.fsm.LogMark, gc.Equals, journal.NewMark(aRecoveryLog, 1234))
+	c.Check(s.player.fsm.HasHints(), gc.Equals, false)
+
+	// Only operations following the Snapshot are applied to seeded files.
+	var buf = s.frameWrite(42, 14, 5)
+	buf.WriteString("-more")
+	c.Check(s.apply(c, buf), gc.IsNil)
+
+	c.Check(s.player.makeLive(), gc.IsNil)
+
+	for _, path := range []string{"a/path", "linked/path"} {
+		content, err := ioutil.ReadFile(filepath.Join(s.localDir, path))
+		c.Check(err, gc.IsNil)
+		c.Check(string(content), gc.Equals, "seeded-content-more")
+	}
+}
+
+func (s *PlaybackSuite) TestSeedValidationAgainstHints(c *gc.C) {
+	var player, err = NewPlayer(FSMHints{
+		Log: aRecoveryLog,
+		LiveNodes: []HintedFnode{
+			{Fnode: 42, Segments: []Segment{
+				{Author: 100, FirstSeqNo: 42, FirstOffset: 1000, LastSeqNo: 45},
+				{Author: 100, FirstSeqNo: 60, FirstOffset: 2000, LastSeqNo: 61}}},
+		},
+	}, s.localDir)
+	c.Assert(err, gc.IsNil)
+
+	var snapshot = Snapshot{Log: aRecoveryLog, Offset: 1500, NextSeqNo: 50}
+
+	// A Snapshot of another log is rejected.
+	snapshot.Log = "other/log"
+	c.Check(player.validateSeed(snapshot), gc.ErrorMatches,
+		"snapshot log other/log doesn't match player log a/recovery/log")
+	snapshot.Log = aRecoveryLog
+
+	// As is a Snapshot which is beyond the offset of a hinted operation
+	// which follows it.
+	snapshot.Offset = 2500
+	c.Check(player.validateSeed(snapshot), gc.ErrorMatches,
+		`snapshot offset 2500 is beyond hinted operation 60 \(at offset 2000\)`)
+
+	// Snapshots which are within, or precede, hinted segments are valid.
+	for _, offset := range []int64{0, 1500, 2000} {
+		snapshot.Offset = offset
+		c.Check(player.validateSeed(snapshot), gc.IsNil)
+	}
+}
+
+func (s *PlaybackSuite) TestCorruptOperations(c *gc.C) {
+	// A frame having a payload which doesn't decode.
+	var corrupt = s.frameCreate("/a/path").Bytes()
+	for i := topic.FixedFrameHeaderLength; i != len(corrupt); i++ {
+		corrupt[i] = 0xff
+	}
+	// In StrictMode, it aborts playback.
+	c.Check(s.apply(c, bytes.NewBuffer(corrupt)), gc.NotNil)
+
+	s.player.SetMode(LenientMode)
+	s.player.fsm.LogMark.Offset = 100
+
+	// In LenientMode, it's skipped.
+	c.Check(s.apply(c, bytes.NewBuffer(corrupt)), gc.IsNil)
+	c.Check(s.player.skipped, gc.DeepEquals,
+		[]SkippedRange{{Begin: 100, End: 100 + int64(len(corrupt))}})
+	c.Check(s.player.fsm.NextSeqNo, gc.Equals, int64(42))
+
+	// The next valid operation follows the skipped one. Expect the FSM steps
+	// forward to apply it.
+	s.player.fsm.LogMark.Offset = 100 + int64(len(corrupt))
+	c.Check(s.apply(c, s.frameAt(43, 0x1234, RecordedOp{
+		Create: &RecordedOp_Create{Path: "/another/path"}})), gc.IsNil)
+	c.Check(s.player.fsm.NextSeqNo, gc.Equals, int64(44))
+	c.Check(s.player.resync, gc.Equals, false)
+
+	// A corrupt frame which embeds a following frame. Expect the Player skips
+	// only through the embedded frame header, and requests a seek to it.
+	var embedded = s.frameCreate("/embedded/path").Bytes()
+	var outer = append([]byte(nil), embedded[:topic.FixedFrameHeaderLength]...)
+	outer = append(outer, 0xff, 0xff, 0xff, 0xff)
+	outer = append(outer, embedded...)
+	outer[4] = byte(len(outer) - topic.FixedFrameHeaderLength) // Length header.
+
+	s.player.fsm.LogMark.Offset = 200
+	c.Check(s.player.playOperation(bufio.NewReader(bytes.NewReader(outer))),
+		gc.Equals, resyncOffset(212))
+	c.Check(s.player.skipped, gc.DeepEquals, []SkippedRange{
+		{Begin: 100, End: 100 + int64(len(corrupt))},
+		{Begin: 200, End: 212},
+	})
+}
+
+func (s *PlaybackSuite) TestCorruptFrameAbortsStrictPlayback(c *gc.C) {
+	var log, hints, _ = s.recordFixture(c)
+
+	// Append an operation frame having a CRC, and corrupt its payload.
+	var op = RecordedOp{SeqNo: 1234, Author: 100, Create: &RecordedOp_Create{Path: "/a/path"}}
+	var frame, err = topic.FixedFramingCRC.Encode(&op, nil)
+	c.Assert(err, gc.IsNil)
+	frame[len(frame)-1] ^= 0xff
+
+	_, err = log.Write(aRecoveryLog, frame)
+	c.Assert(err, gc.IsNil)
+
+	var player, dir, playErrCh = s.startPlay(c, log, hints)
+	defer os.RemoveAll(dir)
+
+	// Expect playback aborts upon reaching the corrupt frame.
+	c.Check(<-playErrCh, gc.Equals, topic.ErrCorruptFrame)
+
+	var _, _, liveErr = player.MakeLive()
+	c.Check(liveErr, gc.Equals, topic.ErrCorruptFrame)
+}
+
+func (s *PlaybackSuite) TestVerify(c *gc.C) {
+	s.player.fsm.hintedSegments = []Segment{
+		{Author: 100, FirstSeqNo: 42, FirstOffset: 100, LastSeqNo: 45},
+		{Author: 100, FirstSeqNo: 50, FirstOffset: 200, LastSeqNo: 52},
+	}
+
+	// All hinted offsets are present.
+	var header = stubHeader{
+		100: {Offset: 100, WriteHead: 300, Fragment: journal.Fragment{Begin: 0, End: 150}},
+		200: {Offset: 200, WriteHead: 300, Fragment: journal.Fragment{Begin: 150, End: 300}},
+	}
+	c.Check(s.player.Verify(header), gc.IsNil)
+
+	// The fragment covering offset 100 was removed, and the journal skips
+	// forward to the next available fragment.
+	header[100] = journal.ReadResult{Offset: 150, WriteHead: 300,
+		Fragment: journal.Fragment{Begin: 150, End: 300}}
+
+	var err = s.player.Verify(header)
+	c.Check(err, gc.DeepEquals, ErrHintsBelowHorizon{Log: aRecoveryLog, Begin: 100, End: 150})
+	c.Check(err, gc.ErrorMatches, `hinted range \[100, 150\) of log a/recovery/log is no longer available`)
+
+	// No fragment covers offset 100, which is below the write head.
+	header[100] = journal.ReadResult{Error: journal.ErrNotYetAvailable, WriteHead: 300}
+	c.Check(s.player.Verify(header), gc.DeepEquals,
+		ErrHintsBelowHorizon{Log: aRecoveryLog, Begin: 100, End: 300})
+
+	// Other errors are passed through.
+	header[100] = journal.ReadResult{Error: journal.ErrNotFound}
+	c.Check(s.player.Verify(header), gc.Equals, journal.ErrNotFound)
+}
+
 func (s *PlaybackSuite) frame(op RecordedOp) *bytes.Buffer {
 	if s.player.fsm.NextSeqNo != 0 {
-		op.SeqNo = s.player.fsm.NextSeqNo
-	} else {
-		op.SeqNo = 1
+		return s.frameAt(s.player.fsm.NextSeqNo, s.player.fsm.NextChecksum, op)
 	}
-	op.Checksum = s.player.fsm.NextChecksum
+	return s.frameAt(1, s.player.fsm.NextChecksum, op)
+}
+
+func (s *PlaybackSuite) frameAt(seqNo int64, checksum uint32, op RecordedOp) *bytes.Buffer {
+	op.SeqNo = seqNo
+	op.Checksum = checksum
 	op.Author = 100
 
 	if frame, err := topic.FixedFraming.Encode(&op, nil); err != nil {
@@ -260,6 +656,366 @@ func (s *PlaybackSuite) frame(op RecordedOp) *bytes.Buffer {
 	}
 }
 
+func (s *PlaybackSuite) TestStats(c *gc.C) {
+	var stats playerStats
+	var t0 = time.Unix(1500000000, 0)
+
+	// Updates prior to an offset being determined are ignored.
+	stats.update(t0, -1, 0)
+	c.Check(stats.current, gc.Equals, PlayerStats{})
+
+	stats.update(t0, 1000, 11000)
+	c.Check(stats.current, gc.Equals, PlayerStats{Offset: 1000, WriteHead: 11000})
+
+	for i := 0; i != 10; i++ {
+		stats.played()
+	}
+	// Updates within |statsInterval| are ignored.
+	stats.update(t0.Add(statsInterval/2), 1500, 11000)
+	c.Check(stats.current.Offset, gc.Equals, int64(1000))
+
+	// First estimate. 2000 bytes and 10 ops over two seconds.
+	stats.update(t0.Add(2*time.Second), 3000, 11000)
+	c.Check(stats.current, gc.Equals, PlayerStats{
+		Offset:         3000,
+		WriteHead:      11000,
+		Ops:            10,
+		BytesPerSecond: 1000,
+		OpsPerSecond:   5,
+		ETA:            8 * time.Second,
+	})
+
+	// The WriteHead advances more quickly than playback. Rates are smoothed.
+	stats.update(t0.Add(3*time.Second), 3500, 21000)
+	c.Check(stats.current, gc.Equals, PlayerStats{
+		Offset:         3500,
+		WriteHead:      21000,
+		Ops:            10,
+		BytesPerSecond: 850,
+		OpsPerSecond:   3.5,
+		CatchingUp:     true,
+	})
+
+	// Playback reaches the WriteHead.
+	stats.update(t0.Add(4*time.Second), 21000, 21000)
+	c.Check(stats.current.ETA, gc.Equals, time.Duration(0))
+	c.Check(stats.current.CatchingUp, gc.Equals, false)
+
+	// Stats are reflected by the Player.
+	var player = &Player{stats: playerStats{current: PlayerStats{Offset: 42}}}
+	c.Check(player.Stats(), gc.Equals, PlayerStats{Offset: 42})
+}
+
+func (s *PlaybackSuite) TestMakeLiveBeforeLogHead(c *gc.C) {
+	var log, hints, partial = s.recordFixture(c)
+	log.SetReadable(aRecoveryLog, partial) // Playback cannot yet read through the log head.
+
+	var player, dir, playErrCh = s.startPlay(c, log, hints)
+	defer os.RemoveAll(dir)
+
+	var liveCh = make(chan error, 1)
+	go func() {
+		var _, _, err = player.MakeLive()
+		liveCh <- err
+	}()
+
+	// Expect MakeLive blocks while playback remains behind the log head.
+	select {
+	case err := <-liveCh:
+		c.Fatalf("MakeLive returned before the log head was read: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	log.SetReadable(aRecoveryLog, -1)
+	c.Check(<-liveCh, gc.IsNil)
+	c.Check(<-playErrCh, gc.IsNil)
+	s.expectFixtureRecovered(c, dir)
+}
+
+func (s *PlaybackSuite) TestMakeLiveAfterLogHead(c *gc.C) {
+	var log, hints, _ = s.recordFixture(c)
+
+	var player, dir, playErrCh = s.startPlay(c, log, hints)
+	defer os.RemoveAll(dir)
+
+	<-player.atHeadCh
+	c.Check(player.IsAtLogHead(), gc.Equals, true)
+
+	var fsm, skipped, err = player.MakeLive()
+	c.Check(err, gc.IsNil)
+	c.Check(skipped, gc.HasLen, 0)
+	c.Check(fsm.HasHints(), gc.Equals, false)
+
+	c.Check(<-playErrCh, gc.IsNil)
+	s.expectFixtureRecovered(c, dir)
+}
+
+func (s *PlaybackSuite) TestAppliedOffset(c *gc.C) {
+	var log, hints, partial = s.recordFixture(c)
+	log.SetReadable(aRecoveryLog, partial)
+
+	var player, dir, playErrCh = s.startPlay(c, log, hints)
+	defer os.RemoveAll(dir)
+
+	// Expect the applied offset advances through readable operations.
+	for player.AppliedOffset() != partial {
+		time.Sleep(time.Millisecond)
+	}
+	log.SetReadable(aRecoveryLog, -1)
+
+	for player.AppliedOffset() != log.WriteHead(aRecoveryLog) {
+		time.Sleep(time.Millisecond)
+	}
+	var _, _, err = player.MakeLive()
+	c.Check(err, gc.IsNil)
+	c.Check(<-playErrCh, gc.IsNil)
+	c.Check(player.AppliedOffset(), gc.Equals, log.WriteHead(aRecoveryLog))
+}
+
+func (s *PlaybackSuite) TestCancelDuringMakeLive(c *gc.C) {
+	var log, hints, partial = s.recordFixture(c)
+	log.SetReadable(aRecoveryLog, partial)
+
+	var player, dir, playErrCh = s.startPlay(c, log, hints)
+	defer os.RemoveAll(dir)
+
+	var liveCh = make(chan error, 1)
+	go func() {
+		var _, _, err = player.MakeLive()
+		liveCh <- err
+	}()
+
+	select {
+	case err := <-liveCh:
+		c.Fatalf("MakeLive returned before the log head was read: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	player.Cancel()
+
+	c.Check(<-liveCh, gc.Equals, ErrPlaybackCancelled)
+	c.Check(<-playErrCh, gc.Equals, ErrPlaybackCancelled)
+}
+
+func (s *PlaybackSuite) TestMakeLiveTimeout(c *gc.C) {
+	var log, hints, partial = s.recordFixture(c)
+	log.SetReadable(aRecoveryLog, partial)
+
+	var dir, err = ioutil.TempDir("", "playback-live")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(dir)
+
+	player, err := NewPlayer(hints, dir)
+	c.Assert(err, gc.IsNil)
+
+	var clock = journal.NewManualClock(time.Unix(1500000000, 0))
+	player.SetClock(clock)
+	player.SetMakeLiveTimeout(time.Minute)
+
+	var playErrCh = make(chan error, 1)
+	go func() { playErrCh <- player.Play(log) }()
+
+	var liveCh = make(chan error, 1)
+	go func() {
+		var _, _, err = player.MakeLive()
+		liveCh <- err
+	}()
+
+	// Expect ErrNotCaughtUp once the timeout elapses.
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+	c.Check(<-liveCh, gc.Equals, ErrNotCaughtUp)
+
+	// Playback continues. A subsequent MakeLive succeeds once the head is read.
+	log.SetReadable(aRecoveryLog, -1)
+
+	_, _, err = player.MakeLive()
+	c.Check(err, gc.IsNil)
+	c.Check(<-playErrCh, gc.IsNil)
+	s.expectFixtureRecovered(c, dir)
+}
+
+func (s *PlaybackSuite) TestTailNotify(c *gc.C) {
+	var log, hints, partial = s.recordFixture(c)
+	log.SetReadable(aRecoveryLog, partial)
+
+	var dir, err = ioutil.TempDir("", "playback-live")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(dir)
+
+	player, err := NewPlayer(hints, dir)
+	c.Assert(err, gc.IsNil)
+
+	var notifyCh = make(chan int64, 1)
+	player.SetTailNotify(notifyCh)
+
+	var playErrCh = make(chan error, 1)
+	go func() { playErrCh <- player.Play(log) }()
+
+	// Expect a notification upon reaching the readable log head.
+	c.Check(<-notifyCh, gc.Equals, partial)
+
+	// As the log grows, playback continues to apply operations and notifies
+	// again upon reaching the new head.
+	log.SetReadable(aRecoveryLog, -1)
+	c.Check(<-notifyCh, gc.Equals, log.WriteHead(aRecoveryLog))
+
+	// A view reflects the notified offset.
+	viewDir, err := ioutil.TempDir("", "playback-view")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(viewDir)
+
+	offset, err := player.linkViewAt(viewDir)
+	c.Check(err, gc.IsNil)
+	c.Check(offset, gc.Equals, log.WriteHead(aRecoveryLog))
+	s.expectFixtureRecovered(c, viewDir)
+
+	var _, _, liveErr = player.MakeLive()
+	c.Check(liveErr, gc.IsNil)
+	c.Check(<-playErrCh, gc.IsNil)
+
+	// Play closes the notification channel upon exit.
+	var _, ok = <-notifyCh
+	c.Check(ok, gc.Equals, false)
+}
+
+func (s *PlaybackSuite) TestParallelPlayback(c *gc.C) {
+	var log, hints, partial = s.recordFixture(c)
+	log.SetReadable(aRecoveryLog, partial)
+
+	var dir, err = ioutil.TempDir("", "playback-live")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(dir)
+
+	player, err := NewPlayer(hints, dir)
+	c.Assert(err, gc.IsNil)
+	player.SetPrefetch(1)
+	player.SetWriteParallelism(4)
+
+	var playErrCh = make(chan error, 1)
+	go func() { playErrCh <- player.Play(log) }()
+
+	// Prefetched content is applied through the readable portion of the log.
+	for player.AppliedOffset() != partial {
+		time.Sleep(time.Millisecond)
+	}
+	log.SetReadable(aRecoveryLog, -1)
+
+	var _, _, liveErr = player.MakeLive()
+	c.Check(liveErr, gc.IsNil)
+	c.Check(<-playErrCh, gc.IsNil)
+	s.expectFixtureRecovered(c, dir)
+}
+
+func (s *PlaybackSuite) TestParallelWritesOfManyFiles(c *gc.C) {
+	var recDir, err = ioutil.TempDir("", "playback-recorder")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(recDir)
+
+	var log = NewMemoryClient()
+	fsm, err := NewFSM(FSMHints{Log: aRecoveryLog})
+	c.Assert(err, gc.IsNil)
+	recorder, err := NewRecorder(fsm, len(recDir), log)
+	c.Assert(err, gc.IsNil)
+
+	// Interleave appends to many files, and delete some of them.
+	var files []rocks.WritableFileObserver
+	for i := 0; i != 10; i++ {
+		files = append(files, recorder.NewWritableFile(fmt.Sprintf("%s/file-%d", recDir, i)))
+	}
+	for round := 0; round != 5; round++ {
+		for i, f := range files {
+			f.Append([]byte(fmt.Sprintf("%d.%d;", i, round)))
+		}
+	}
+	for i := 0; i < len(files); i += 3 {
+		recorder.DeleteFile(fmt.Sprintf("%s/file-%d", recDir, i))
+	}
+	<-recorder.WriteBarrier().Ready
+
+	dir, err := ioutil.TempDir("", "playback-live")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(dir)
+
+	player, err := NewPlayer(recorder.BuildHints(), dir)
+	c.Assert(err, gc.IsNil)
+	player.SetPrefetch(1 << 20)
+	player.SetWriteParallelism(3)
+
+	var playErrCh = make(chan error, 1)
+	go func() { playErrCh <- player.Play(log) }()
+
+	var _, _, liveErr = player.MakeLive()
+	c.Check(liveErr, gc.IsNil)
+	c.Check(<-playErrCh, gc.IsNil)
+
+	for i := range files {
+		var b, err = ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("file-%d", i)))
+
+		if i%3 == 0 {
+			c.Check(os.IsNotExist(err), gc.Equals, true)
+			continue
+		}
+		c.Check(err, gc.IsNil)
+		c.Check(string(b), gc.Equals,
+			fmt.Sprintf("%d.0;%d.1;%d.2;%d.3;%d.4;", i, i, i, i, i))
+	}
+}
+
+// recordFixture records operations of a fixture database into a MemoryClient.
+// It returns the log, hints of the recording, and an offset of the log
+// through which only a portion of the operations have been recorded.
+func (s *PlaybackSuite) recordFixture(c *gc.C) (*MemoryClient, FSMHints, int64) {
+	var dir, err = ioutil.TempDir("", "playback-recorder")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(dir)
+
+	var log = NewMemoryClient()
+
+	fsm, err := NewFSM(FSMHints{Log: aRecoveryLog})
+	c.Assert(err, gc.IsNil)
+	recorder, err := NewRecorder(fsm, len(dir), log)
+	c.Assert(err, gc.IsNil)
+
+	var file = recorder.NewWritableFile(dir + "/a/file")
+	file.Append([]byte("hello, "))
+	var partial = log.WriteHead(aRecoveryLog)
+
+	file.Append([]byte("world"))
+	recorder.NewWritableFile(dir + "/another/file").Append([]byte("foo"))
+	<-recorder.WriteBarrier().Ready
+
+	return log, recorder.BuildHints(), partial
+}
+
+// startPlay begins playback of |hints| from |log| into a new directory.
+func (s *PlaybackSuite) startPlay(c *gc.C, log *MemoryClient,
+	hints FSMHints) (*Player, string, <-chan error) {
+
+	var dir, err = ioutil.TempDir("", "playback-live")
+	c.Assert(err, gc.IsNil)
+
+	player, err := NewPlayer(hints, dir)
+	c.Assert(err, gc.IsNil)
+
+	var playErrCh = make(chan error, 1)
+	go func() { playErrCh <- player.Play(log) }()
+
+	return player, dir, playErrCh
+}
+
+func (s *PlaybackSuite) expectFixtureRecovered(c *gc.C, dir string) {
+	for path, content := range map[string]string{
+		"a/file":       "hello, world",
+		"another/file": "foo",
+	} {
+		var b, err = ioutil.ReadFile(filepath.Join(dir, path))
+		c.Check(err, gc.IsNil)
+		c.Check(string(b), gc.Equals, content)
+	}
+}
+
 func (s *PlaybackSuite) frameCreate(path string) *bytes.Buffer {
 	return s.frame(RecordedOp{Create: &RecordedOp_Create{Path: path}})
 }
@@ -290,4 +1046,60 @@ func (s *PlaybackSuite) apply(c *gc.C, buf *bytes.Buffer) error {
 	return err
 }
 
+// stubHeader is a journal.Header returning fixed ReadResults keyed on offset.
+// recordingFS is an OSFS which records mutations of paths under |root|.
+type recordingFS struct {
+	OSFS
+	root string
+	ops  []string
+	// If set, Link fails with ErrCrossDevice.
+	crossDevice bool
+}
+
+func (fs *recordingFS) record(op string, paths ...string) {
+	for _, p := range paths {
+		op += " " + strings.TrimPrefix(p, fs.root)
+	}
+	fs.ops = append(fs.ops, op)
+}
+
+func (fs *recordingFS) Create(path string) (File, error) {
+	fs.record("Create", path)
+	return fs.OSFS.Create(path)
+}
+
+func (fs *recordingFS) Open(path string) (io.ReadCloser, error) {
+	fs.record("Open", path)
+	return fs.OSFS.Open(path)
+}
+
+func (fs *recordingFS) Link(oldpath, newpath string) error {
+	fs.record("Link", oldpath, newpath)
+	if fs.crossDevice {
+		return ErrCrossDevice
+	}
+	return fs.OSFS.Link(oldpath, newpath)
+}
+
+func (fs *recordingFS) Remove(path string) error {
+	fs.record("Remove", path)
+	return fs.OSFS.Remove(path)
+}
+
+func (fs *recordingFS) RemoveAll(path string) error {
+	fs.record("RemoveAll", path)
+	return fs.OSFS.RemoveAll(path)
+}
+
+func (fs *recordingFS) MkdirAll(path string) error {
+	fs.record("MkdirAll", path)
+	return fs.OSFS.MkdirAll(path)
+}
+
+type stubHeader map[int64]journal.ReadResult
+
+func (h stubHeader) Head(args journal.ReadArgs) (journal.ReadResult, *url.URL) {
+	return h[args.Offset], nil
+}
+
 var _ = gc.Suite(&PlaybackSuite{})
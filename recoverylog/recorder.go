@@ -9,6 +9,7 @@ import (
 	"math/big"
 	"path/filepath"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	rocks "github.com/tecbot/gorocksdb"
@@ -24,6 +25,11 @@ var propertyFiles = map[string]struct{}{
 	"/IDENTITY": {},
 }
 
+// Maximum length of Fnode content retained by a Recorder to detect renames
+// which don't change the content of the target path. It accommodates files
+// such as CURRENT and OPTIONS, which RocksDB frequently re-writes.
+const maxRetainedContentLength = 1 << 16
+
 // Recorder observes a sequence of changes to a file-system, and preserves
 // those changes via a written Gazette journal of file-system operations.
 type Recorder struct {
@@ -34,31 +40,72 @@ type Recorder struct {
 	stripLen int
 	// Client for interacting with |opLog|.
 	writer journal.Writer
-	// A recent write, which will be used to update the FSM Offset once committed.
-	pendingWrite *journal.AsyncAppend
+	// Recent writes of each journal of the log, which are used to update FSM
+	// offsets once committed.
+	pendingWrites []*journal.AsyncAppend
+	// Journal of the log to which the current frame is written.
+	frameShard int
+	// Lengths of live Fnodes written by this Recorder. See Snapshot.
+	fnodeSizes map[Fnode]int64
+	// Content of small, live Fnodes written by this Recorder. See RenameFile.
+	fnodeContent map[Fnode]*retainedContent
+	// Fnodes which are open for writing. See Compact.
+	openFnodes map[Fnode]struct{}
+	// Set once recording has been handed off to another Recorder. See Handoff.
+	handedOff bool
+	// Publication of FSMHints to a hints journal or HintsStore. See
+	// SetHintsJournal and SetHintsStore.
+	hints *hintsPublisher
+	// Set while recording is paused. See Pause.
+	paused *pausedFrames
+	// Index of recorded SST content, if SST files are deduplicated.
+	// See SetSSTDedup.
+	sstIndex *sstIndex
+	// Metrics of the Recorder. In-flight appends are guarded by |mu|.
+	metrics recorderMetrics
 	// Used to serialize access to |fsm| and writes to |opLog|.
 	mu sync.Mutex
 }
 
 func NewRecorder(fsm *FSM, stripLen int, writer journal.Writer) (*Recorder, error) {
-	recorderId, err := rand.Int(rand.Reader, big.NewInt(math.MaxUint32-1))
-	if err != nil {
-		return nil, err
+	return newRecorder(fsm, make(map[Fnode]int64), 0, stripLen, writer)
+}
+
+// newRecorder returns a Recorder of |fsm|, having a random Author other
+// than |exclude|.
+func newRecorder(fsm *FSM, fnodeSizes map[Fnode]int64, exclude Author,
+	stripLen int, writer journal.Writer) (*Recorder, error) {
+
+	var id = exclude
+	for id == exclude {
+		recorderId, err := rand.Int(rand.Reader, big.NewInt(math.MaxUint32-1))
+		if err != nil {
+			return nil, err
+		}
+		id = Author(recorderId.Int64()) + 1
 	}
 
 	recorder := &Recorder{
-		fsm:      fsm,
-		id:       Author(recorderId.Int64()) + 1,
-		stripLen: stripLen,
-		writer:   writer,
+		fsm:           fsm,
+		id:            id,
+		stripLen:      stripLen,
+		writer:        writer,
+		pendingWrites: make([]*journal.AsyncAppend, fsm.shardCount()),
+		fnodeSizes:    fnodeSizes,
+		fnodeContent:  make(map[Fnode]*retainedContent),
+		openFnodes:    make(map[Fnode]struct{}),
+		metrics:       newRecorderMetrics(fsm.LogMark.Journal),
 	}
 
-	// Issue an initial WriteBarrier to determine a lower-bound offset
-	// for all subsequent recorded operations.
-	op := recorder.WriteBarrier()
-	<-op.Ready
-	recorder.fsm.LogMark.Offset = op.WriteHead
+	// Issue an initial write barrier to each journal of the log, to determine
+	// lower-bound offsets for all subsequent recorded operations.
+	for shard, op := range recorder.barriers() {
+		<-op.Ready
 
+		if mark := recorder.fsm.mark(shard); op.WriteHead > mark.Offset {
+			mark.Offset = op.WriteHead
+		}
+	}
 	return recorder, nil
 }
 
@@ -84,6 +131,10 @@ func (r *Recorder) NewWritableFile(path string) rocks.WritableFileObserver {
 
 	prevFnode, prevExists := r.fsm.Links[path]
 
+	if prevExists {
+		r.reserve(2)
+	}
+
 	// Decompose the creation into two operations:
 	//  * Unlinking |prevFnode| linked at |path| if |prevExists|.
 	//  * Creating the new fnode backing |path|.
@@ -97,7 +148,16 @@ func (r *Recorder) NewWritableFile(path string) rocks.WritableFileObserver {
 
 	// Perform an atomic write of both operations.
 	r.recordFrame(frame)
-	return &fileRecorder{r, r.fsm.Links[path], 0}
+	var fnode = r.fsm.Links[path]
+	r.fnodeSizes[fnode] = 0
+	r.fnodeContent[fnode] = new(retainedContent)
+	r.openFnodes[fnode] = struct{}{}
+
+	var fr = &fileRecorder{Recorder: r, fnode: fnode}
+	if r.isDedupCandidate(path) {
+		fr.dedup = &dedupFile{path: path}
+	}
+	return fr
 }
 
 // rocks.EnvObserver implementation.
@@ -157,6 +217,15 @@ func (r *Recorder) RenameFile(srcPath, targetPath string) {
 	}
 	prevFnode, prevExists := r.fsm.Links[target]
 
+	if prevExists && r.isIdenticalContent(fnode, prevFnode) {
+		// The rename doesn't change the content of |target|. Rather than
+		// re-linking |target|, record only the unlink of |src|. Recovered
+		// content of |target| remains bit-exact.
+		r.recordFrame(r.process(
+			RecordedOp{Unlink: &RecordedOp_Link{Fnode: fnode, Path: src}}, nil))
+		return
+	}
+
 	// Decompose the rename into multiple operations:
 	//  * Unlinking |prevFnode| linked at |target| if |prevExists|.
 	//  * If |target| is a property, recording a property update.
@@ -164,6 +233,12 @@ func (r *Recorder) RenameFile(srcPath, targetPath string) {
 	//  * Unlinking the |fnode| from |src|.
 	var frame []byte
 
+	if prevExists {
+		r.reserve(3)
+	} else {
+		r.reserve(2)
+	}
+
 	if prevExists {
 		frame = r.process(RecordedOp{
 			Unlink: &RecordedOp_Link{Fnode: prevFnode, Path: target}}, frame)
@@ -174,8 +249,11 @@ func (r *Recorder) RenameFile(srcPath, targetPath string) {
 		if err != nil {
 			log.WithFields(log.Fields{"err": err, "path": targetPath}).Panic("reading file")
 		}
-		frame = r.process(RecordedOp{
-			Property: &Property{Path: target, Content: string(content)}}, frame)
+		// Property content which is unchanged needn't be recorded again.
+		if prev, ok := r.fsm.Properties[target]; !ok || prev != string(content) {
+			frame = r.process(RecordedOp{
+				Property: &Property{Path: target, Content: string(content)}}, frame)
+		}
 	} else {
 		frame = r.process(RecordedOp{
 			Link: &RecordedOp_Link{Fnode: fnode, Path: target}}, frame)
@@ -189,7 +267,10 @@ func (r *Recorder) RenameFile(srcPath, targetPath string) {
 }
 
 // Builds and returns a set of state-machine hints which may be used to fully
-// reconstruct the state of this Recorder.
+// reconstruct the state of this Recorder. BuildHints may be called from any
+// goroutine, concurrently with ongoing recording: hints are a consistent
+// snapshot of the FSM as of the last recorded operation, and share no state
+// with the Recorder.
 func (r *Recorder) BuildHints() FSMHints {
 	defer r.mu.Unlock()
 	r.mu.Lock()
@@ -197,8 +278,28 @@ func (r *Recorder) BuildHints() FSMHints {
 	return r.fsm.BuildHints()
 }
 
+// Author returns the unique Author of operations recorded by this Recorder.
+func (r *Recorder) Author() Author { return r.id }
+
+// SetAuthor sets the Author of operations recorded by this Recorder, which is
+// otherwise randomly generated. It must be called before any operations are
+// recorded. Authors must be unique across Recorders of a recovery log, and
+// SetAuthor is intended for tests which require reproducible recordings (eg,
+// golden FSMHints of a sequence of operations).
+func (r *Recorder) SetAuthor(id Author) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	if id == 0 {
+		log.Panic("invalid zero Author")
+	}
+	r.id = id
+}
+
 // Issues an empty write. When this barrier write completes, it is
 // guaranteed that all content written prior to barrier has also committed.
+// Of a sharded log, an empty write is issued to each of its journals, and the
+// returned barrier resolves when all have committed.
 func (r *Recorder) WriteBarrier() *journal.AsyncAppend {
 	defer r.mu.Unlock()
 	r.mu.Lock()
@@ -206,7 +307,47 @@ func (r *Recorder) WriteBarrier() *journal.AsyncAppend {
 	return r.recordFrame(nil)
 }
 
+// barriers issues an empty write to each journal of the log.
+func (r *Recorder) barriers() []*journal.AsyncAppend {
+	var out []*journal.AsyncAppend
+
+	for shard := 0; shard != r.fsm.shardCount(); shard++ {
+		result, err := r.writer.Write(r.fsm.mark(shard).Journal, nil)
+		if err != nil {
+			log.WithField("err", err).Panic("writing barrier")
+		}
+		r.updateWriteHead(shard, result)
+		out = append(out, result)
+	}
+	return out
+}
+
+// reserve ensures that the next |ops| operations fall within a single block of
+// a sharded log, by first recording no-op operations through the end of the
+// current block if required. It's a no-op if the log isn't sharded.
+func (r *Recorder) reserve(ops int) {
+	if r.fsm.shardCount() == 1 {
+		return
+	}
+	var seqNo = r.fsm.NextSeqNo
+	if seqNo == 0 {
+		seqNo = 1
+	}
+	if seqNo%shardBlockOps+int64(ops) <= shardBlockOps {
+		return
+	}
+
+	var frame []byte
+	for remaining := shardBlockOps - seqNo%shardBlockOps; remaining != 0; remaining-- {
+		frame = r.process(RecordedOp{}, frame)
+	}
+	r.recordFrame(frame)
+}
+
 func (r *Recorder) process(op RecordedOp, b []byte) []byte {
+	if r.handedOff {
+		log.WithField("op", op).Panic("recorder was handed off")
+	}
 	if r.fsm.NextSeqNo == 0 {
 		op.SeqNo = 1
 	} else {
@@ -215,24 +356,63 @@ func (r *Recorder) process(op RecordedOp, b []byte) []byte {
 	op.Checksum = r.fsm.NextChecksum
 	op.Author = r.id
 
+	if epoch := r.fsm.Epoch; epoch != 0 {
+		op.Epoch = &epoch
+	}
+
 	var err error
 	var offset = len(b)
 
+	if offset == 0 {
+		// |op| begins a frame. Route the frame to the journal of |op|.
+		r.frameShard = r.fsm.shardOf(op.SeqNo)
+	}
+
 	if b, err = topic.FixedFraming.Encode(&op, b); err != nil {
 		log.WithFields(log.Fields{"op": op, "err": err}).Panic("framing")
 	}
 	if err = r.fsm.Apply(&op, b[offset+topic.FixedFrameHeaderLength:]); err != nil {
 		log.WithFields(log.Fields{"op": op, "err": err}).Panic("recorder FSM error")
 	}
+
+	if op.Unlink != nil {
+		if _, isLive := r.fsm.LiveNodes[op.Unlink.Fnode]; !isLive {
+			delete(r.fnodeSizes, op.Unlink.Fnode)
+			delete(r.fnodeContent, op.Unlink.Fnode)
+		}
+	}
+	if r.hints != nil {
+		r.hints.pendingOps++
+	}
+	r.metrics.ops.Inc()
 	return b
 }
 
+// isIdenticalContent returns whether Fnodes |a| and |b| are distinct, were
+// each fully written and closed by this Recorder, and have identical content.
+// Closed Fnodes are never written again: RocksDB re-writes a path by creating
+// a new file.
+func (r *Recorder) isIdenticalContent(a, b Fnode) bool {
+	var ca, cb = r.fnodeContent[a], r.fnodeContent[b]
+
+	return a != b && ca != nil && cb != nil && ca.closed && cb.closed &&
+		bytes.Equal(ca.content, cb.content)
+}
+
+// retainedContent is the content of a small Fnode written by a Recorder.
+type retainedContent struct {
+	content []byte
+	closed  bool
+}
+
 type fileRecorder struct {
 	*Recorder
 
 	// File being tracked, and the next write offset within the file.
 	fnode  Fnode
 	offset int64
+	// Buffered content of an SST file which may be deduplicated. See SetSSTDedup.
+	dedup *dedupFile
 }
 
 // rocks.EnvObserver implementation.
@@ -240,6 +420,14 @@ func (r *fileRecorder) Append(data []byte) {
 	defer r.mu.Unlock()
 	r.mu.Lock()
 
+	if r.dedup != nil && r.bufferForDedup(data) {
+		return
+	}
+	r.append(data)
+}
+
+// append records |data| at the current offset of the file. |mu| must be held.
+func (r *fileRecorder) append(data []byte) {
 	var frame = r.process(RecordedOp{Write: &RecordedOp_Write{
 		Fnode:  r.fnode,
 		Offset: r.offset,
@@ -249,32 +437,92 @@ func (r *fileRecorder) Append(data []byte) {
 	// Perform an atomic write of the operation and its data.
 	r.recordFromReader(io.MultiReader(
 		bytes.NewReader(frame),
-		bytes.NewReader(data)))
+		bytes.NewReader(data)), int64(len(frame)+len(data)))
 
 	r.offset += int64(len(data))
+	r.fnodeSizes[r.fnode] = r.offset
+
+	if c, ok := r.fnodeContent[r.fnode]; !ok {
+		// Content is not retained.
+	} else if r.offset > maxRetainedContentLength {
+		delete(r.fnodeContent, r.fnode)
+	} else {
+		c.content = append(c.content, data...)
+	}
 }
 
 // rocks.EnvObserver implementation.
-func (r *fileRecorder) Close()                         {}
-func (r *fileRecorder) Sync()                          { <-r.WriteBarrier().Ready }
-func (r *fileRecorder) Fsync()                         { <-r.WriteBarrier().Ready }
-func (r *fileRecorder) RangeSync(offset, nbytes int64) { <-r.WriteBarrier().Ready }
+func (r *fileRecorder) Close() {
+	defer r.mu.Unlock()
+	r.mu.Lock()
 
-func (r *Recorder) recordFromReader(frame io.Reader) *journal.AsyncAppend {
-	result, err := r.writer.ReadFrom(r.fsm.LogMark.Journal, frame)
+	if r.dedup != nil {
+		r.closeDedup()
+	}
+	if c, ok := r.fnodeContent[r.fnode]; ok {
+		c.closed = true
+	}
+	delete(r.openFnodes, r.fnode)
+}
+
+// rocks.EnvObserver implementation.
+func (r *fileRecorder) Sync()                          { r.syncBarrier() }
+func (r *fileRecorder) Fsync()                         { r.syncBarrier() }
+func (r *fileRecorder) RangeSync(offset, nbytes int64) { r.syncBarrier() }
+
+// syncBarrier records any buffered content of the file, and awaits a barrier.
+func (r *fileRecorder) syncBarrier() {
+	r.mu.Lock()
+	if r.dedup != nil {
+		r.flushDedup()
+	}
+	r.mu.Unlock()
+
+	r.awaitBarrier()
+}
+
+// awaitBarrier issues a WriteBarrier and blocks until it commits.
+func (r *Recorder) awaitBarrier() {
+	var started = time.Now()
+	<-r.WriteBarrier().Ready
+
+	r.metrics.blocked(started)
+}
+
+// recordFromReader writes |frame|, of |size| bytes, to the journal of its
+// first operation.
+func (r *Recorder) recordFromReader(frame io.Reader, size int64) *journal.AsyncAppend {
+	if r.paused != nil {
+		return r.paused.addReader(r.frameShard, frame)
+	}
+	result, err := r.writer.ReadFrom(r.fsm.mark(r.frameShard).Journal, frame)
 	if err != nil {
 		log.WithField("err", err).Panic("writing op frame")
 	}
-	r.updateWriteHead(result)
+	r.metrics.appendedBytes.Add(float64(size))
+	r.updateWriteHead(r.frameShard, result)
+	r.maybePublishHints()
 	return result
 }
 
+// recordFrame writes |frame| to the journal of its first operation. A nil
+// |frame| is a write barrier, which is written to each journal of the log.
 func (r *Recorder) recordFrame(frame []byte) *journal.AsyncAppend {
-	result, err := r.writer.Write(r.fsm.LogMark.Journal, frame)
-	if err != nil {
-		log.WithField("err", err).Panic("writing op frame")
+	var result *journal.AsyncAppend
+
+	if r.paused != nil {
+		return r.paused.add(r.frameShard, frame)
+	} else if frame == nil {
+		result = allAppends(r.barriers())
+	} else {
+		var err error
+		if result, err = r.writer.Write(r.fsm.mark(r.frameShard).Journal, frame); err != nil {
+			log.WithField("err", err).Panic("writing op frame")
+		}
+		r.metrics.appendedBytes.Add(float64(len(frame)))
+		r.updateWriteHead(r.frameShard, result)
 	}
-	r.updateWriteHead(result)
+	r.maybePublishHints()
 	return result
 }
 
@@ -285,22 +533,27 @@ func (r *Recorder) recordFrame(frame []byte) *journal.AsyncAppend {
 // provides a tight bound while still being correct in the case of competing
 // writes from multiple Recorders. With each issued write, we check whether
 // a previously retained write has completed and update the FSM offset if so.
-func (r *Recorder) updateWriteHead(write *journal.AsyncAppend) {
-	if r.pendingWrite == nil {
-		r.pendingWrite = write
-	} else if r.pendingWrite.Ready == nil {
+// Offsets of each journal of a sharded log are tracked independently.
+func (r *Recorder) updateWriteHead(shard int, write *journal.AsyncAppend) {
+	r.metrics.appended(write)
+
+	var pending = r.pendingWrites[shard]
+
+	if pending == nil {
+		r.pendingWrites[shard], pending = write, write
+	} else if pending.Ready == nil {
 		// Indicates |pendingWrite| was modified outside of Recorder.
 		panic("pendingWrite.Ready is nil")
 	}
 
 	select {
-	case <-r.pendingWrite.Ready:
+	case <-pending.Ready:
 		// A previous append operation has completed. Update from the returned
-		// WriteHead, and track |write| as the next |pendingWrite|.
-		r.fsm.LogMark.Offset = r.pendingWrite.WriteHead
-		r.pendingWrite = write
+		// WriteHead, and track |write| as the next pending write.
+		r.fsm.mark(shard).Offset = pending.WriteHead
+		r.pendingWrites[shard] = write
 	default:
-		// |pendingWrite| hasn't committed yet. Drop |write|.
+		// |pending| hasn't committed yet. Drop |write|.
 		return
 	}
 }
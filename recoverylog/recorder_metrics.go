@@ -0,0 +1,62 @@
+package recoverylog
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/metrics"
+)
+
+// recorderMetrics are the metrics.RecorderCollectors of a Recorder. Each is
+// bound to the recovery log label once, when the Recorder is created, such
+// that recording an operation requires only atomic updates of collectors and
+// no label lookups. To export them, register metrics.RecorderCollectors().
+type recorderMetrics struct {
+	ops            prometheus.Counter
+	appendedBytes  prometheus.Counter
+	blockedSeconds prometheus.Counter
+	inFlight       prometheus.Gauge
+
+	// Appends which are not yet known to have committed, in the order issued.
+	// Appends of a journal commit in order, and committed appends are popped
+	// from the front as further appends are issued. Of a sharded log, the
+	// in-flight count is an upper bound, as journals commit independently.
+	inFlightAppends []*journal.AsyncAppend
+}
+
+func newRecorderMetrics(log journal.Name) recorderMetrics {
+	var label = log.String()
+
+	return recorderMetrics{
+		ops:            metrics.RecorderOpsTotal.WithLabelValues(label),
+		appendedBytes:  metrics.RecorderAppendedBytesTotal.WithLabelValues(label),
+		blockedSeconds: metrics.RecorderBlockedSecondsTotal.WithLabelValues(label),
+		inFlight:       metrics.RecorderInFlightAppends.WithLabelValues(label),
+	}
+}
+
+// appended tracks |write| as in-flight, and updates the in-flight gauge.
+func (m *recorderMetrics) appended(write *journal.AsyncAppend) {
+	m.inFlightAppends = append(m.inFlightAppends, write)
+
+	var i int
+	for ; i != len(m.inFlightAppends); i++ {
+		select {
+		case <-m.inFlightAppends[i].Ready:
+			m.inFlightAppends[i] = nil // Release for GC.
+			continue
+		default:
+		}
+		break
+	}
+	m.inFlightAppends = m.inFlightAppends[i:]
+	m.inFlight.Set(float64(len(m.inFlightAppends)))
+}
+
+// blocked adds the duration since |started|, during which the database was
+// blocked on a commit of the recovery log.
+func (m *recorderMetrics) blocked(started time.Time) {
+	m.blockedSeconds.Add(time.Since(started).Seconds())
+}
@@ -0,0 +1,84 @@
+package recoverylog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gc "github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type RecorderMetricsSuite struct{}
+
+func (s *RecorderMetricsSuite) TestInFlightAppends(c *gc.C) {
+	var m = newRecorderMetrics("a/in-flight-log")
+
+	var resolved = func() *journal.AsyncAppend {
+		var a = &journal.AsyncAppend{Ready: make(chan struct{})}
+		close(a.Ready)
+		return a
+	}
+	var pending = &journal.AsyncAppend{Ready: make(chan struct{})}
+
+	m.appended(resolved())
+	c.Check(m.inFlightAppends, gc.HasLen, 0)
+
+	// Appends which follow a pending append remain in-flight until it commits.
+	m.appended(pending)
+	m.appended(resolved())
+	c.Check(m.inFlightAppends, gc.HasLen, 2)
+	c.Check(gaugeValue(c, m.inFlight), gc.Equals, float64(2))
+
+	close(pending.Ready)
+	m.appended(resolved())
+	c.Check(m.inFlightAppends, gc.HasLen, 0)
+	c.Check(gaugeValue(c, m.inFlight), gc.Equals, float64(0))
+}
+
+func (s *RecorderMetricsSuite) TestRecordedOpsAndBytes(c *gc.C) {
+	const log journal.Name = "a/metrics-log"
+
+	var tmpDir, err = ioutil.TempDir("", "recorder-metrics-suite")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(tmpDir)
+
+	var client = NewMemoryClient()
+
+	fsm, err := NewFSM(FSMHints{Log: log})
+	c.Assert(err, gc.IsNil)
+	recorder, err := NewRecorder(fsm, len(tmpDir), client)
+	c.Assert(err, gc.IsNil)
+
+	var handle = recorder.NewWritableFile(filepath.Join(tmpDir, "file"))
+	handle.Append([]byte("file content"))
+	handle.Sync()
+	handle.Close()
+	recorder.DeleteFile(filepath.Join(tmpDir, "file"))
+	<-recorder.WriteBarrier().Ready
+
+	// Expect each of create, write, and unlink operations was counted, and
+	// that appended bytes match the content of the log.
+	c.Check(counterValue(c, recorder.metrics.ops), gc.Equals, float64(3))
+	c.Check(counterValue(c, recorder.metrics.appendedBytes), gc.Equals,
+		float64(client.WriteHead(log)))
+	c.Check(counterValue(c, recorder.metrics.blockedSeconds) > 0, gc.Equals, true)
+	c.Check(gaugeValue(c, recorder.metrics.inFlight), gc.Equals, float64(0))
+}
+
+func counterValue(c *gc.C, counter prometheus.Counter) float64 {
+	var m dto.Metric
+	c.Assert(counter.Write(&m), gc.IsNil)
+	return m.GetCounter().GetValue()
+}
+
+func gaugeValue(c *gc.C, gauge prometheus.Gauge) float64 {
+	var m dto.Metric
+	c.Assert(gauge.Write(&m), gc.IsNil)
+	return m.GetGauge().GetValue()
+}
+
+var _ = gc.Suite(&RecorderMetricsSuite{})
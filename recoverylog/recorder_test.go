@@ -3,9 +3,13 @@ package recoverylog
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
@@ -15,7 +19,10 @@ import (
 	"github.com/LiveRamp/gazette/topic"
 )
 
-const opLog = journal.Name("a/journal")
+const (
+	opLog    = journal.Name("a/journal")
+	hintsLog = journal.Name("a/hints")
+)
 
 type RecorderSuite struct {
 	recorder  *Recorder
@@ -24,6 +31,7 @@ type RecorderSuite struct {
 	br        *bufio.Reader // Wraps |writes|.
 	writeHead int64
 	promise   chan struct{} // Returned promise fixture for captured writes.
+	hints     []byte        // Captured writes of |hintsLog|.
 }
 
 func (s *RecorderSuite) SetUpTest(c *gc.C) {
@@ -35,6 +43,7 @@ func (s *RecorderSuite) SetUpTest(c *gc.C) {
 	s.writes = bytes.NewBuffer(nil)
 	s.br = bufio.NewReader(s.writes)
 	s.writeHead = 42
+	s.hints = nil
 	s.promise = make(chan struct{})
 	close(s.promise)
 
@@ -196,6 +205,71 @@ func (s *RecorderSuite) TestFileAppends(c *gc.C) {
 	c.Check(s.readLen(c, op.Write.Length), gc.Equals, "second-write")
 }
 
+func (s *RecorderSuite) TestPauseAndResume(c *gc.C) {
+	var handle = s.recorder.NewWritableFile(s.tmpDir + "/path/to/sst")
+	_ = s.parseOp(c)
+
+	var writeHead = s.writeHead
+
+	c.Check(s.recorder.Pause(), gc.IsNil)
+	c.Check(s.recorder.Pause(), gc.Equals, ErrRecorderPaused)
+
+	// Model a memtable flush while paused: content is appended to a new file,
+	// which is synced, and a MANIFEST update is then created.
+	var buf = []byte("flushed content")
+	handle.Append(buf)
+	copy(buf, "clobbered by db") // Caller may re-use its buffer.
+
+	var barrier = s.recorder.WriteBarrier()
+	s.recorder.NewWritableFile(s.tmpDir + "/MANIFEST-000002")
+
+	// Expect operations were applied to the FSM, but nothing was written,
+	// and the barrier hasn't resolved.
+	c.Check(s.recorder.fsm.NextSeqNo, gc.Equals, int64(4))
+	c.Check(s.writes.Len(), gc.Equals, 0)
+	c.Check(s.writeHead, gc.Equals, writeHead)
+
+	select {
+	case <-barrier.Ready:
+		c.Error("barrier resolved while paused")
+	default:
+	}
+
+	resumed, err := s.recorder.Resume()
+	c.Check(err, gc.IsNil)
+	<-resumed.Ready
+	<-barrier.Ready
+
+	_, err = s.recorder.Resume()
+	c.Check(err, gc.Equals, ErrRecorderNotPaused)
+
+	// Expect buffered operations were written in order.
+	var op = s.parseOp(c)
+	c.Check(op.SeqNo, gc.Equals, int64(2))
+	c.Check(op.Write.Fnode, gc.Equals, Fnode(1))
+	c.Check(s.readLen(c, op.Write.Length), gc.Equals, "flushed content")
+
+	op = s.parseOp(c)
+	c.Check(op.SeqNo, gc.Equals, int64(3))
+	c.Check(op.Create.Path, gc.Equals, "/MANIFEST-000002")
+
+	// Recording proceeds as usual.
+	handle.Append([]byte("more"))
+	op = s.parseOp(c)
+	c.Check(op.SeqNo, gc.Equals, int64(4))
+	c.Check(s.readLen(c, op.Write.Length), gc.Equals, "more")
+}
+
+func (s *RecorderSuite) TestHandoffWhilePaused(c *gc.C) {
+	c.Check(s.recorder.Pause(), gc.IsNil)
+
+	var _, err = s.recorder.Handoff(s.tmpDir)
+	c.Check(err, gc.Equals, ErrRecorderPaused)
+
+	_, err = s.recorder.Resume()
+	c.Check(err, gc.IsNil)
+}
+
 func (s *RecorderSuite) TestPropertyUpdate(c *gc.C) {
 	// Properties are updated when a file is renamed to a property path.
 	s.recorder.NewWritableFile(s.tmpDir + "/tmp_file")
@@ -224,6 +298,75 @@ func (s *RecorderSuite) TestPropertyUpdate(c *gc.C) {
 		map[string]string{"/IDENTITY": "value"})
 }
 
+func (s *RecorderSuite) TestRenameWithIdenticalContent(c *gc.C) {
+	// writeCurrent re-writes CURRENT via a temporary file, as RocksDB does,
+	// and returns the number of recorded operations.
+	var writeCurrent = func(content string) (ops int) {
+		var handle = s.recorder.NewWritableFile(s.tmpDir + "/000001.dbtmp")
+		handle.Append([]byte(content))
+		handle.Close()
+		s.recorder.RenameFile(s.tmpDir+"/000001.dbtmp", s.tmpDir+"/CURRENT")
+
+		for {
+			if _, err := s.br.Peek(1); err == io.EOF {
+				return
+			}
+			if op := s.parseOp(c); op.Write != nil {
+				_ = s.readLen(c, op.Write.Length)
+			}
+			ops++
+		}
+	}
+	// Initial write: create, write, link, and unlink.
+	c.Check(writeCurrent("MANIFEST-000001\n"), gc.Equals, 4)
+	var fnode = s.recorder.fsm.Links["/CURRENT"]
+
+	// Steady-state re-writes of identical content elide the re-link of CURRENT.
+	for i := 0; i != 3; i++ {
+		c.Check(writeCurrent("MANIFEST-000001\n"), gc.Equals, 3)
+		c.Check(s.recorder.fsm.Links["/CURRENT"], gc.Equals, fnode)
+	}
+	c.Check(s.recorder.fsm.LiveNodes, gc.HasLen, 1)
+
+	// Changed content is re-linked: create, write, unlink, link, and unlink.
+	c.Check(writeCurrent("MANIFEST-000002\n"), gc.Equals, 5)
+	c.Check(s.recorder.fsm.Links["/CURRENT"], gc.Not(gc.Equals), fnode)
+
+	// Content of a file which is still open may change, and isn't compared.
+	var handle = s.recorder.NewWritableFile(s.tmpDir + "/000001.dbtmp")
+	handle.Append([]byte("MANIFEST-000002\n"))
+	s.recorder.RenameFile(s.tmpDir+"/000001.dbtmp", s.tmpDir+"/CURRENT")
+
+	for _, expect := range []string{"create", "write", "unlink", "link", "unlink"} {
+		var op = s.parseOp(c)
+		if op.Write != nil {
+			_ = s.readLen(c, op.Write.Length)
+		}
+		c.Check(expect == "create" && op.Create != nil ||
+			expect == "write" && op.Write != nil ||
+			expect == "link" && op.Link != nil ||
+			expect == "unlink" && op.Unlink != nil, gc.Equals, true)
+	}
+}
+
+func (s *RecorderSuite) TestUnchangedPropertyUpdate(c *gc.C) {
+	c.Assert(ioutil.WriteFile(s.tmpDir+"/IDENTITY", []byte("value"), 0666), gc.IsNil)
+
+	for _, expectProperty := range []bool{true, false} {
+		s.recorder.NewWritableFile(s.tmpDir + "/tmp_file")
+		_ = s.parseOp(c)
+		s.recorder.RenameFile(s.tmpDir+"/tmp_file", s.tmpDir+"/IDENTITY")
+
+		// A property update is recorded only if content changed.
+		if expectProperty {
+			c.Check(s.parseOp(c).Property.Content, gc.Equals, "value")
+		}
+		c.Check(s.parseOp(c).Unlink.Path, gc.Equals, "/tmp_file")
+	}
+	c.Check(s.recorder.fsm.Properties, gc.DeepEquals,
+		map[string]string{"/IDENTITY": "value"})
+}
+
 func (s *RecorderSuite) TestFileSync(c *gc.C) {
 	handle := s.recorder.NewWritableFile(s.tmpDir + "/source/path")
 	_ = s.parseOp(c)
@@ -273,6 +416,241 @@ func (s *RecorderSuite) TestHints(c *gc.C) {
 	s.br.Reset(s.writes)
 }
 
+func (s *RecorderSuite) TestConcurrentBuildHints(c *gc.C) {
+	var done = make(chan struct{})
+
+	// Record files and appends from a writer goroutine.
+	go func() {
+		defer close(done)
+
+		for i := 0; i != 200; i++ {
+			var handle = s.recorder.NewWritableFile(
+				filepath.Join(s.tmpDir, "file", strconv.Itoa(i)))
+
+			for j := 0; j != 5; j++ {
+				handle.Append([]byte("write"))
+			}
+			handle.Close()
+		}
+	}()
+
+	var maxOffset, maxSeqNo int64 = -1, -1
+	for loop := true; loop; {
+		select {
+		case <-done:
+			loop = false
+		default:
+		}
+
+		// Expect each BuildHints is individually valid, and that hints are
+		// monotonic in their maximum offset and SeqNo.
+		var hints = s.recorder.BuildHints()
+		c.Assert(hints.Validate(), gc.IsNil)
+
+		var offset, seqNo int64 = -1, -1
+		for _, node := range hints.LiveNodes {
+			for _, segment := range node.Segments {
+				if segment.FirstOffset > offset {
+					offset = segment.FirstOffset
+				}
+				if segment.LastSeqNo > seqNo {
+					seqNo = segment.LastSeqNo
+				}
+			}
+		}
+		c.Assert(offset >= maxOffset, gc.Equals, true)
+		c.Assert(seqNo >= maxSeqNo, gc.Equals, true)
+		maxOffset, maxSeqNo = offset, seqNo
+	}
+
+	c.Check(maxSeqNo, gc.Equals, int64(200*6))
+
+	// Clear recorded frames not checked in this test.
+	s.writes.Reset()
+	s.br.Reset(s.writes)
+}
+
+func (s *RecorderSuite) TestHintsAreReproducible(c *gc.C) {
+	c.Assert(ioutil.WriteFile(s.tmpDir+"/IDENTITY", []byte("identity"), 0666), gc.IsNil)
+
+	// Drive a recorder of an independent log through a fixed sequence of
+	// operations, and return its JSON-encoded hints.
+	var record = func() []byte {
+		var log = NewMemoryClient()
+
+		var fsm, err = NewFSM(FSMHints{Log: opLog})
+		c.Assert(err, gc.IsNil)
+		recorder, err := NewRecorder(fsm, len(s.tmpDir), log)
+		c.Assert(err, gc.IsNil)
+		recorder.SetAuthor(0xfeedbeef)
+
+		for i := 0; i != 10; i++ {
+			var handle = recorder.NewWritableFile(
+				filepath.Join(s.tmpDir, "file", strconv.Itoa(i)))
+			handle.Append([]byte("write " + strconv.Itoa(i)))
+			handle.Close()
+		}
+		recorder.LinkFile(s.tmpDir+"/file/3", s.tmpDir+"/link/3")
+		recorder.DeleteFile(s.tmpDir + "/file/5")
+		recorder.NewWritableFile(s.tmpDir + "/tmp_identity")
+		recorder.RenameFile(s.tmpDir+"/tmp_identity", s.tmpDir+"/IDENTITY")
+		recorder.RenameFile(s.tmpDir+"/file/7", s.tmpDir+"/file/1")
+		<-recorder.WriteBarrier().Ready
+
+		var hints = recorder.BuildHints()
+		c.Check(hints.Validate(), gc.IsNil)
+		c.Check(hints.LiveNodes, gc.HasLen, 8)
+		c.Check(hints.Properties, gc.DeepEquals,
+			[]Property{{Path: "/IDENTITY", Content: "identity"}})
+
+		b, err := json.Marshal(hints)
+		c.Assert(err, gc.IsNil)
+		return b
+	}
+
+	// Expect serialized hints of the two recorders are byte-identical.
+	c.Check(bytes.Equal(record(), record()), gc.Equals, true)
+}
+
+func (s *RecorderSuite) TestSnapshot(c *gc.C) {
+	var handle = s.recorder.NewWritableFile(s.tmpDir + "/path/one")
+	_ = s.parseOp(c)
+	handle.Append([]byte("content"))
+	_ = s.parseOp(c)
+	_ = s.readLen(c, 7)
+	s.recorder.LinkFile(s.tmpDir+"/path/one", s.tmpDir+"/path/two")
+	_ = s.parseOp(c)
+
+	// Mirror recorded files on disk. Content of the file extends beyond
+	// operations which have been recorded thus far.
+	c.Assert(os.MkdirAll(filepath.Join(s.tmpDir, "path"), 0777), gc.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.tmpDir, "path/one"),
+		[]byte("content-and-more"), 0666), gc.IsNil)
+
+	stageDir, err := ioutil.TempDir("", "recorder-suite-stage")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(stageDir)
+
+	snapshot, err := s.recorder.Snapshot(s.tmpDir, stageDir)
+	c.Check(err, gc.IsNil)
+
+	c.Check(snapshot, gc.DeepEquals, Snapshot{
+		Log:          opLog,
+		Offset:       s.recorder.fsm.LogMark.Offset,
+		NextSeqNo:    4,
+		NextChecksum: s.recorder.fsm.NextChecksum,
+		Fnodes: []SnapshotFnode{{
+			Fnode:    1,
+			Links:    []string{"/path/one", "/path/two"},
+			Segments: s.recorder.fsm.LiveNodes[1].Segments,
+			Size:     7, // Recorded length, rather than current length on disk.
+		}},
+	})
+
+	// Expect content was linked into |stageDir|.
+	content, err := ioutil.ReadFile(filepath.Join(stageDir, "1"))
+	c.Check(err, gc.IsNil)
+	c.Check(string(content), gc.Equals, "content-and-more")
+}
+
+func (s *RecorderSuite) TestHandoff(c *gc.C) {
+	var handle = s.recorder.NewWritableFile(s.tmpDir + "/path/one")
+	_ = s.parseOp(c)
+	handle.Append([]byte("content"))
+	_ = s.parseOp(c)
+	_ = s.readLen(c, 7)
+
+	c.Assert(os.MkdirAll(filepath.Join(s.tmpDir, "path"), 0777), gc.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.tmpDir, "path/one"),
+		[]byte("content"), 0666), gc.IsNil)
+
+	var outgoing = s.recorder
+	handoff, err := outgoing.Handoff(s.tmpDir)
+	c.Check(err, gc.IsNil)
+
+	c.Check(handoff.Author, gc.Equals, outgoing.id)
+	c.Check(handoff.Offset, gc.Equals, s.writeHead)
+	c.Check(handoff.NextSeqNo, gc.Equals, int64(3))
+	c.Check(handoff.Fnodes, gc.DeepEquals, []SnapshotFnode{{
+		Fnode:    1,
+		Links:    []string{"/path/one"},
+		Segments: outgoing.fsm.LiveNodes[1].Segments,
+		Size:     7,
+	}})
+
+	// Expect the outgoing Recorder refuses to record further operations.
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		outgoing.DeleteFile(s.tmpDir + "/path/one")
+	}()
+	c.Check(recovered, gc.NotNil)
+
+	// The incoming Recorder continues the operation sequence, as a new Author.
+	s.recorder, err = NewRecorderFromHandoff(handoff, len(s.tmpDir), s)
+	c.Assert(err, gc.IsNil)
+	c.Check(s.recorder.id, gc.Not(gc.Equals), outgoing.id)
+	c.Check(s.recorder.fsm.LogMark.Offset, gc.Equals, handoff.Offset)
+
+	s.recorder.LinkFile(s.tmpDir+"/path/one", s.tmpDir+"/path/two")
+
+	var op = s.parseOp(c)
+	c.Check(op.SeqNo, gc.Equals, int64(3))
+	c.Check(op.Checksum, gc.Equals, handoff.NextChecksum)
+	c.Check(op.Author, gc.Equals, s.recorder.id)
+	c.Check(op.Link, gc.DeepEquals, &RecordedOp_Link{Fnode: 1, Path: "/path/two"})
+
+	// Its operations are of a strictly higher epoch, which hints carry.
+	c.Check(op.GetEpoch(), gc.Equals, handoff.Epoch+1)
+	c.Check(s.recorder.BuildHints().Epoch, gc.Equals, handoff.Epoch+1)
+
+	// Hints of the incoming Recorder reference Segments of both Authors.
+	var segments = s.recorder.BuildHints().LiveNodes[0].Segments
+	c.Check(segments, gc.HasLen, 2)
+	c.Check(segments[0].Author, gc.Equals, outgoing.id)
+	c.Check(segments[1].Author, gc.Equals, s.recorder.id)
+	c.Check(segments[1].FirstOffset, gc.Equals, handoff.Offset)
+}
+
+func (s *RecorderSuite) TestPublishHints(c *gc.C) {
+	c.Check(s.recorder.SetHintsJournal(opLog, 0, 1), gc.ErrorMatches,
+		"hints journal must differ from recovery log a/journal")
+	c.Check(s.recorder.SetHintsJournal(hintsLog, 0, 2), gc.IsNil)
+
+	// A single operation doesn't trigger publication.
+	s.recorder.NewWritableFile(s.tmpDir + "/path/one")
+	_ = s.parseOp(c)
+	c.Check(s.recorder.hints.inFlight, gc.IsNil)
+
+	// A second does. Expect hints are published after a write barrier.
+	s.recorder.NewWritableFile(s.tmpDir + "/path/two")
+	_ = s.parseOp(c)
+	var expect = s.recorder.BuildHints()
+
+	<-s.recorder.hints.inFlight
+
+	var frame, err = topic.FixedFraming.Unpack(bufio.NewReader(bytes.NewReader(s.hints)))
+	c.Check(err, gc.IsNil)
+	var hints FSMHints
+	c.Check(topic.FixedFraming.Unmarshal(frame, &hints), gc.IsNil)
+	c.Check(hints, gc.DeepEquals, expect)
+
+	// Published hints follow leading content of the hints journal.
+	var content = append([]byte("leading content"), s.hints...)
+	var client = fixedJournalClient{content: content}
+
+	defer func(w int64) { publishedHintsWindow = w }(publishedHintsWindow)
+	publishedHintsWindow = 4 // Expect the window is extended.
+
+	hints, err = ReadPublishedHints(client, hintsLog)
+	c.Check(err, gc.IsNil)
+	c.Check(hints, gc.DeepEquals, expect)
+
+	// A journal without published hints.
+	hints, err = ReadPublishedHints(fixedJournalClient{content: []byte("leading content")}, hintsLog)
+	c.Check(err, gc.Equals, ErrNoPublishedHints)
+}
+
 func (s *RecorderSuite) parseOp(c *gc.C) RecordedOp {
 	var frame, err = topic.FixedFraming.Unpack(s.br)
 	c.Assert(err, gc.IsNil)
@@ -295,6 +673,10 @@ func (s *RecorderSuite) readLen(c *gc.C, length int64) string {
 
 // journal.Writer implementation
 func (s *RecorderSuite) Write(log journal.Name, buf []byte) (*journal.AsyncAppend, error) {
+	if log == hintsLog {
+		s.hints = append(s.hints, buf...)
+		return &journal.AsyncAppend{Ready: s.promise}, nil
+	}
 	n, _ := s.writes.Write(buf)
 	s.writeHead += int64(n)
 
@@ -315,6 +697,24 @@ func (s *RecorderSuite) ReadFrom(log journal.Name, r io.Reader) (*journal.AsyncA
 	}, nil
 }
 
+// fixedJournalClient is a journal.Client which serves reads of fixed content.
+type fixedJournalClient struct {
+	journal.Client
+	content []byte
+}
+
+func (f fixedJournalClient) Head(args journal.ReadArgs) (journal.ReadResult, *url.URL) {
+	return journal.ReadResult{Offset: args.Offset, WriteHead: int64(len(f.content))}, nil
+}
+
+func (f fixedJournalClient) Get(args journal.ReadArgs) (journal.ReadResult, io.ReadCloser) {
+	return journal.ReadResult{
+		Offset:    args.Offset,
+		WriteHead: int64(len(f.content)),
+		Fragment:  journal.Fragment{Journal: args.Journal, Begin: 0, End: int64(len(f.content))},
+	}, ioutil.NopCloser(bytes.NewReader(f.content[args.Offset:]))
+}
+
 var _ = gc.Suite(&RecorderSuite{})
 
 func Test(t *testing.T) { gc.TestingT(t) }
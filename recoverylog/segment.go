@@ -45,6 +45,7 @@ func (s *SegmentSet) Add(segment Segment) error {
 			segment.FirstSeqNo = prev.FirstSeqNo
 			segment.FirstOffset = prev.FirstOffset
 			segment.FirstChecksum = prev.FirstChecksum
+			segment.ShardOffsets = prev.ShardOffsets
 			begin--
 		}
 	}
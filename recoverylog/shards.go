@@ -0,0 +1,104 @@
+package recoverylog
+
+import (
+	"fmt"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// A recovery log may be sharded across multiple journals, such that its
+// append throughput isn't bounded by that of a single journal. The journals of
+// a sharded log are FSMHints.Log and FSMHints.Shards, indexed from zero in that
+// order. Operations remain totally ordered by SeqNo, and the journal which
+// records an operation is a function of its SeqNo alone: consecutive blocks of
+// |shardBlockOps| SeqNos are assigned to journals in round-robin order (see
+// shardOf). A Player therefore reads the next expected SeqNo from exactly one
+// journal, and sharded playback retains the semantics of a single journal.
+//
+// A Recorder writes each frame of operations with a single, atomic append.
+// Frames must not span blocks of different journals, and the Recorder pads
+// the remainder of a block with no-op operations where a frame would otherwise
+// cross a block boundary.
+//
+// Whether a log is sharded (and the journals of its shards) is fixed when the
+// log is first recorded: FSMHints of an existing, unsharded log must not be
+// given Shards.
+
+// Number of consecutive SeqNos assigned to a single journal of a sharded log.
+// It must be at least the maximum number of operations of a Recorder frame.
+const shardBlockOps = 16
+
+// shardOf returns the index of the journal which records operation |seqNo|,
+// of a log having |count| journals.
+func shardOf(seqNo int64, count int) int {
+	if count <= 1 {
+		return 0
+	}
+	return int((seqNo / shardBlockOps) % int64(count))
+}
+
+// shardCount returns the number of journals of the FSM recovery log.
+func (m *FSM) shardCount() int { return 1 + len(m.ShardMarks) }
+
+// shardOf returns the index of the journal of the FSM which records |seqNo|.
+func (m *FSM) shardOf(seqNo int64) int { return shardOf(seqNo, m.shardCount()) }
+
+// mark returns the Mark of journal |shard| of the FSM recovery log.
+func (m *FSM) mark(shard int) *journal.Mark {
+	if shard == 0 {
+		return &m.LogMark
+	}
+	return &m.ShardMarks[shard-1]
+}
+
+// shardOffsets returns current offsets of ShardMarks, or nil if the FSM
+// recovery log isn't sharded.
+func (m *FSM) shardOffsets() []int64 {
+	if len(m.ShardMarks) == 0 {
+		return nil
+	}
+	var out = make([]int64, len(m.ShardMarks))
+	for i, mark := range m.ShardMarks {
+		out[i] = mark.Offset
+	}
+	return out
+}
+
+// validateShards returns an error if |shards| are not valid, distinct
+// journals other than |log|.
+func validateShards(log journal.Name, shards []journal.Name) error {
+	var seen = map[journal.Name]struct{}{log: {}}
+
+	for _, shard := range shards {
+		if err := shard.Validate(); err != nil {
+			return err
+		} else if _, ok := seen[shard]; ok {
+			return fmt.Errorf("duplicate recovery log shard %s", shard)
+		}
+		seen[shard] = struct{}{}
+	}
+	return nil
+}
+
+// allAppends returns an AsyncAppend which resolves when each of |appends|
+// has resolved. Its Error is the first of any Error of |appends|, and its
+// WriteHead is that of |appends[0]|.
+func allAppends(appends []*journal.AsyncAppend) *journal.AsyncAppend {
+	if len(appends) == 1 {
+		return appends[0]
+	}
+	var all = &journal.AsyncAppend{Ready: make(chan struct{})}
+
+	go func() {
+		for _, a := range appends {
+			<-a.Ready
+
+			if a.Error != nil && all.Error == nil {
+				all.Error = a.Error
+			}
+		}
+		all.WriteHead = appends[0].WriteHead
+		close(all.Ready)
+	}()
+	return all
+}
@@ -0,0 +1,170 @@
+package recoverylog
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	gc "github.com/go-check/check"
+
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/topic"
+)
+
+type ShardsSuite struct{}
+
+func (s *ShardsSuite) TestShardOf(c *gc.C) {
+	for _, tc := range []struct {
+		seqNo  int64
+		count  int
+		expect int
+	}{
+		{0, 1, 0},
+		{1234, 1, 0},
+		{0, 3, 0},
+		{15, 3, 0},
+		{16, 3, 1},
+		{31, 3, 1},
+		{32, 3, 2},
+		{48, 3, 0},
+		{16, 2, 1},
+		{32, 2, 0},
+	} {
+		c.Check(shardOf(tc.seqNo, tc.count), gc.Equals, tc.expect)
+	}
+}
+
+func (s *ShardsSuite) TestHintsValidation(c *gc.C) {
+	var hints = FSMHints{Log: "a/log", Shards: []journal.Name{"a/log-1", "a/log-2"}}
+	c.Check(hints.Validate(), gc.IsNil)
+
+	hints.Shards[1] = "a/log-1"
+	c.Check(hints.Validate(), gc.ErrorMatches, "duplicate recovery log shard a/log-1")
+	hints.Shards[1] = "a/log"
+	c.Check(hints.Validate(), gc.ErrorMatches, "duplicate recovery log shard a/log")
+	hints.Shards[1] = "/invalid"
+	c.Check(hints.Validate(), gc.ErrorMatches, "invalid journal name .*")
+
+	var _, err = NewFSM(hints)
+	c.Check(err, gc.ErrorMatches, "invalid journal name .*")
+
+	hints.Shards[1] = "a/log-2"
+	fsm, err := NewFSM(hints)
+	c.Check(err, gc.IsNil)
+	c.Check(fsm.ShardMarks, gc.DeepEquals, []journal.Mark{
+		journal.NewMark("a/log-1", -1), journal.NewMark("a/log-2", -1)})
+	c.Check(fsm.BuildHints().Shards, gc.DeepEquals, hints.Shards)
+}
+
+func (s *ShardsSuite) TestRecorderRoutesFramesByBlock(c *gc.C) {
+	var tmpDir, err = ioutil.TempDir("", "shards-suite")
+	c.Assert(err, gc.IsNil)
+	defer os.RemoveAll(tmpDir)
+
+	var shards = []journal.Name{opLog, "a/journal-1", "a/journal-2"}
+	var writer = newShardWriter()
+
+	fsm, err := NewFSM(FSMHints{Log: shards[0], Shards: shards[1:]})
+	c.Assert(err, gc.IsNil)
+	recorder, err := NewRecorder(fsm, len(tmpDir), writer)
+	c.Assert(err, gc.IsNil)
+
+	// Expect initial barriers were written to, and Marks taken from, each journal.
+	c.Check(fsm.LogMark.Offset, gc.Equals, int64(0))
+	c.Check(fsm.ShardMarks[0].Offset, gc.Equals, int64(0))
+	c.Check(fsm.ShardMarks[1].Offset, gc.Equals, int64(0))
+
+	// Record enough operations to cycle through each shard. Renames of an
+	// existing target record three-operation frames, which must be padded
+	// to not cross block boundaries.
+	for i := 0; i != 24; i++ {
+		recorder.NewWritableFile(tmpDir + "/a").Append([]byte("content"))
+		recorder.NewWritableFile(tmpDir + "/b")
+		recorder.RenameFile(tmpDir+"/b", tmpDir+"/a")
+	}
+	<-recorder.WriteBarrier().Ready
+
+	var frames int
+	for shard, name := range shards {
+		var br = bufio.NewReader(bytes.NewReader(writer.content[name]))
+
+		for {
+			var frame, err = topic.FixedFraming.Unpack(br)
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, gc.IsNil)
+
+			var op RecordedOp
+			c.Check(topic.FixedFraming.Unmarshal(frame, &op), gc.IsNil)
+
+			// Expect each operation is recorded to the journal of its block.
+			c.Check(shardOf(op.SeqNo, len(shards)), gc.Equals, shard)
+
+			if op.Write != nil {
+				_, err = io.CopyN(ioutil.Discard, br, op.Write.Length)
+				c.Check(err, gc.IsNil)
+			}
+			frames++
+		}
+	}
+	c.Check(frames, gc.Equals, int(fsm.NextSeqNo-1))
+
+	// Expect that FSM Marks reflect the write head of each journal.
+	c.Check(fsm.LogMark.Offset, gc.Equals, int64(len(writer.content[shards[0]])))
+	c.Check(fsm.ShardMarks[0].Offset, gc.Equals, int64(len(writer.content[shards[1]])))
+	c.Check(fsm.ShardMarks[1].Offset, gc.Equals, int64(len(writer.content[shards[2]])))
+
+	// Expect hinted Segments reference offsets of each shard.
+	for _, node := range recorder.BuildHints().LiveNodes {
+		for _, segment := range node.Segments {
+			c.Check(segment.ShardOffsets, gc.HasLen, 2)
+		}
+	}
+}
+
+func (s *ShardsSuite) TestSetHintsJournalRejectsShards(c *gc.C) {
+	fsm, err := NewFSM(FSMHints{Log: opLog, Shards: []journal.Name{"a/journal-1"}})
+	c.Assert(err, gc.IsNil)
+	recorder, err := NewRecorder(fsm, 0, newShardWriter())
+	c.Assert(err, gc.IsNil)
+
+	c.Check(recorder.SetHintsJournal("a/journal-1", 0, 0), gc.ErrorMatches,
+		"hints journal must differ from recovery log a/journal-1")
+	c.Check(recorder.SetHintsJournal(hintsLog, 0, 0), gc.IsNil)
+}
+
+// shardWriter is a journal.Writer which retains content written to each
+// journal, and resolves writes immediately.
+type shardWriter struct {
+	content map[journal.Name][]byte
+}
+
+func newShardWriter() *shardWriter {
+	return &shardWriter{content: make(map[journal.Name][]byte)}
+}
+
+func (w *shardWriter) Write(name journal.Name, buf []byte) (*journal.AsyncAppend, error) {
+	w.content[name] = append(w.content[name], buf...)
+	return w.resolved(name), nil
+}
+
+func (w *shardWriter) ReadFrom(name journal.Name, r io.Reader) (*journal.AsyncAppend, error) {
+	var buf, _ = ioutil.ReadAll(r)
+	w.content[name] = append(w.content[name], buf...)
+	return w.resolved(name), nil
+}
+
+func (w *shardWriter) resolved(name journal.Name) *journal.AsyncAppend {
+	var ready = make(chan struct{})
+	close(ready)
+
+	return &journal.AsyncAppend{
+		Ready:        ready,
+		AppendResult: journal.AppendResult{WriteHead: int64(len(w.content[name]))},
+	}
+}
+
+var _ = gc.Suite(&ShardsSuite{})
@@ -0,0 +1,268 @@
+package recoverylog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+// Snapshot is a point-in-time capture of recorded file state. Alongside the
+// content of each of its Fnodes, a Snapshot allows a Player to begin playback
+// from Snapshot.Offset, rather than reading all hinted segments of the log.
+type Snapshot struct {
+	// Recovery log of the Snapshot.
+	Log journal.Name
+	// Offset of the recovery log from which operations following the Snapshot
+	// are read. Offset is a lower bound: operations between Offset and the
+	// Snapshot are skipped by sequence number during playback.
+	Offset int64
+	// Of a sharded recovery log, Marks of each additional journal from which
+	// operations following the Snapshot are read (see FSMHints.Shards).
+	Shards []journal.Mark
+	// Expected sequence number and checksum of the next operation.
+	NextSeqNo    int64
+	NextChecksum uint32
+	// Recorder epoch as of the Snapshot. See FSM.Epoch.
+	Epoch int64
+	// Live Fnodes of the Snapshot, ordered on Fnode.
+	Fnodes []SnapshotFnode
+	// Property files of the Snapshot.
+	Properties []Property
+}
+
+// SnapshotFnode is a live Fnode of a Snapshot.
+type SnapshotFnode struct {
+	Fnode Fnode
+	// Active paths of the Fnode.
+	Links []string
+	// Ordered log Segments which contain Fnode operations.
+	Segments []Segment
+	// Length of Fnode content as of the Snapshot.
+	Size int64
+}
+
+// ContentName is the file name of SnapshotFnode content within a directory
+// staged by Recorder.Snapshot, or seeded to Player.SeedFromSnapshot.
+func (n SnapshotFnode) ContentName() string {
+	return strconv.FormatInt(int64(n.Fnode), 10)
+}
+
+// Snapshot captures current recorded file state. The content of each live
+// Fnode is hard-linked from its path under |localDir| (the recorded directory)
+// into |stageDir|, under its SnapshotFnode.ContentName. Staged content may be
+// further appended to after Snapshot returns (eg, if it's a log which is still
+// being written), but content through SnapshotFnode.Size is stable. Recorded
+// file operations are blocked only for the duration of the call.
+func (r *Recorder) Snapshot(localDir, stageDir string) (Snapshot, error) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+
+	return r.snapshot(localDir, stageDir)
+}
+
+// snapshot captures current recorded file state, hard-linking Fnode content
+// into |stageDir| if it's non-empty. |r.mu| must be held.
+func (r *Recorder) snapshot(localDir, stageDir string) (Snapshot, error) {
+	var snapshot = Snapshot{
+		Log:          r.fsm.LogMark.Journal,
+		Offset:       r.fsm.LogMark.Offset,
+		NextSeqNo:    r.fsm.NextSeqNo,
+		NextChecksum: r.fsm.NextChecksum,
+		Epoch:        r.fsm.Epoch,
+		Shards:       append([]journal.Mark(nil), r.fsm.ShardMarks...),
+	}
+
+	for fnode, state := range r.fsm.LiveNodes {
+		var node = SnapshotFnode{
+			Fnode:    fnode,
+			Segments: append([]Segment(nil), state.Segments...),
+		}
+		for link := range state.Links {
+			node.Links = append(node.Links, link)
+		}
+		sort.Strings(node.Links)
+
+		var local = filepath.Join(localDir, node.Links[0])
+		if stageDir != "" {
+			if err := os.Link(local, filepath.Join(stageDir, node.ContentName())); err != nil {
+				return Snapshot{}, err
+			}
+		}
+
+		if size, ok := r.fnodeSizes[fnode]; ok {
+			node.Size = size
+		} else if info, err := os.Stat(local); err != nil {
+			return Snapshot{}, err
+		} else {
+			// |fnode| was not written by this Recorder, and is not being appended to.
+			node.Size = info.Size()
+		}
+		snapshot.Fnodes = append(snapshot.Fnodes, node)
+	}
+	sort.Sort(snapshotFnodeOrder(snapshot.Fnodes))
+
+	for path, content := range r.fsm.Properties {
+		snapshot.Properties = append(snapshot.Properties, Property{Path: path, Content: content})
+	}
+	sort.Sort(propertyOrder(snapshot.Properties))
+	return snapshot, nil
+}
+
+// SeedFromSnapshot prepares the Player to recover from |snapshot|, rather than
+// from its hints. |seedDir| must hold the content of each Snapshot Fnode under
+// its SnapshotFnode.ContentName, and must not be within the Player's local
+// directory. Seeded content is moved into place when Play begins, and only
+// recovery log operations which follow the Snapshot are then played.
+// SeedFromSnapshot must be called before Play.
+func (p *Player) SeedFromSnapshot(snapshot Snapshot, seedDir string) error {
+	if err := p.validateSeed(snapshot); err != nil {
+		return err
+	}
+	var paths = make(map[Fnode]string)
+	for _, node := range snapshot.Fnodes {
+		paths[node.Fnode] = filepath.Join(seedDir, node.ContentName())
+	}
+
+	var fsm, sizes = fsmFromSnapshot(snapshot)
+	p.fsm, p.seedPaths, p.seedSizes = fsm, paths, sizes
+	return nil
+}
+
+// SeedFromLocalDir prepares the Player to recover from |dir|, a local directory
+// holding a materialization of recorded file state as of |snapshot| (for
+// example, a prior local directory of a Player or Recorder, with |snapshot|
+// captured by Recorder.Snapshot with an empty stage directory). Files of |dir|
+// are at their recorded paths, and must be at least as long as their Snapshot
+// Fnode. As with SeedFromSnapshot, |dir| must not be within the Player's local
+// directory, its files are moved into place when Play begins, and only
+// operations which follow the Snapshot are then played. Other content of |dir|
+// is ignored. SeedFromLocalDir must be called before Play.
+func (p *Player) SeedFromLocalDir(snapshot Snapshot, dir string) error {
+	if err := p.validateSeed(snapshot); err != nil {
+		return err
+	}
+	var paths = make(map[Fnode]string)
+
+	for _, node := range snapshot.Fnodes {
+		if len(node.Links) == 0 {
+			return fmt.Errorf("snapshot fnode %d has no links", node.Fnode)
+		}
+		var path = filepath.Join(dir, node.Links[0])
+
+		if info, err := p.fs.Stat(path); err != nil {
+			return err
+		} else if info.Size() < node.Size {
+			return fmt.Errorf("seeded file %s is shorter than snapshot fnode %d (%d < %d)",
+				path, node.Fnode, info.Size(), node.Size)
+		}
+		paths[node.Fnode] = path
+	}
+
+	var fsm, sizes = fsmFromSnapshot(snapshot)
+	p.fsm, p.seedPaths, p.seedSizes = fsm, paths, sizes
+	return nil
+}
+
+// validateSeed confirms that |snapshot| is consistent with the hints of the
+// Player: it must be of the same log (and log shards), at known offsets, and
+// its offset must not be beyond that of any hinted operation which follows it
+// (as playback from the Snapshot offset would then skip that operation).
+func (p *Player) validateSeed(snapshot Snapshot) error {
+	if snapshot.Log != p.fsm.LogMark.Journal {
+		return fmt.Errorf("snapshot log %s doesn't match player log %s",
+			snapshot.Log, p.fsm.LogMark.Journal)
+	} else if snapshot.Offset < 0 {
+		return fmt.Errorf("snapshot offset %d is unknown", snapshot.Offset)
+	} else if len(snapshot.Shards) != len(p.fsm.ShardMarks) {
+		return fmt.Errorf("snapshot has %d log shards, but player has %d",
+			len(snapshot.Shards), len(p.fsm.ShardMarks))
+	}
+	for i, mark := range snapshot.Shards {
+		if mark.Journal != p.fsm.ShardMarks[i].Journal {
+			return fmt.Errorf("snapshot log shard %s doesn't match player log shard %s",
+				mark.Journal, p.fsm.ShardMarks[i].Journal)
+		} else if mark.Offset < 0 {
+			return fmt.Errorf("snapshot log shard %s offset %d is unknown",
+				mark.Journal, mark.Offset)
+		}
+	}
+	for _, s := range p.fsm.hintedSegments {
+		if s.FirstSeqNo >= snapshot.NextSeqNo && s.FirstOffset >= 0 && s.FirstOffset < snapshot.Offset {
+			return fmt.Errorf("snapshot offset %d is beyond hinted operation %d (at offset %d)",
+				snapshot.Offset, s.FirstSeqNo, s.FirstOffset)
+		}
+	}
+	return nil
+}
+
+// fsmFromSnapshot returns an FSM of the recorded file state of |snapshot|,
+// and the sizes of its Fnodes.
+func fsmFromSnapshot(snapshot Snapshot) (*FSM, map[Fnode]int64) {
+	var fsm = &FSM{
+		LogMark:      journal.NewMark(snapshot.Log, snapshot.Offset),
+		ShardMarks:   append([]journal.Mark(nil), snapshot.Shards...),
+		NextSeqNo:    snapshot.NextSeqNo,
+		NextChecksum: snapshot.NextChecksum,
+		Epoch:        snapshot.Epoch,
+		Properties:   make(map[string]string),
+		LiveNodes:    make(map[Fnode]*FnodeState),
+		Links:        make(map[string]Fnode),
+	}
+	var sizes = make(map[Fnode]int64)
+
+	for _, node := range snapshot.Fnodes {
+		var state = &FnodeState{
+			Links:    make(map[string]struct{}),
+			Segments: append([]Segment(nil), node.Segments...),
+		}
+		for _, link := range node.Links {
+			state.Links[link] = struct{}{}
+			fsm.Links[link] = node.Fnode
+		}
+		fsm.LiveNodes[node.Fnode] = state
+		sizes[node.Fnode] = node.Size
+	}
+	for _, prop := range snapshot.Properties {
+		fsm.Properties[prop.Path] = prop.Content
+	}
+	return fsm, sizes
+}
+
+// seedFnodes moves seeded Fnode content into the staging directory.
+func (p *Player) seedFnodes() error {
+	for fnode, size := range p.seedSizes {
+		if err := p.fs.Rename(p.seedPaths[fnode], p.stagedPath(fnode)); err != nil {
+			return err
+		}
+		var backingFile, err = p.fs.OpenForWrite(p.stagedPath(fnode))
+		if err != nil {
+			return err
+		}
+		p.backingFiles[fnode] = backingFile
+
+		// Seeded content may extend beyond the Snapshot. Discard it, as it's
+		// re-written by operations which follow.
+		if err = backingFile.Truncate(size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sort.Interface SnapshotFnode implementation ordered on Fnode.
+type snapshotFnodeOrder []SnapshotFnode
+
+func (n snapshotFnodeOrder) Len() int           { return len(n) }
+func (n snapshotFnodeOrder) Less(i, j int) bool { return n[i].Fnode < n[j].Fnode }
+func (n snapshotFnodeOrder) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+
+// sort.Interface Property implementation ordered on Path.
+type propertyOrder []Property
+
+func (p propertyOrder) Len() int           { return len(p) }
+func (p propertyOrder) Less(i, j int) bool { return p[i].Path < p[j].Path }
+func (p propertyOrder) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
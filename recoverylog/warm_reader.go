@@ -0,0 +1,148 @@
+package recoverylog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	rocks "github.com/tecbot/gorocksdb"
+)
+
+// Error returned by WarmReader.View prior to a successful Refresh.
+var ErrNoWarmView = fmt.Errorf("warm view not yet available")
+
+// WarmReader serves reads of a RocksDB database which is still being recovered
+// by a Player, allowing a warm standby to scale reads prior to its promotion.
+// Reads are eventually consistent: they reflect recovery log operations played
+// as of the last Refresh, and lag the database which is writing the log.
+//
+// Each Refresh captures a view of the recovered file state (see
+// Player.LinkView) into a new directory, and opens it as a read-only database.
+// Refresh should be called periodically as playback progresses, or upon
+// notifications of a tailing Player (see Tail).
+type WarmReader struct {
+	player  *Player
+	dir     string
+	options *rocks.Options
+
+	// Generation of the next view directory.
+	next int
+	// Current view directory and database, and the Player AppliedOffset with
+	// which the view is consistent. Reads hold |mu| for reading.
+	viewDir string
+	db      *rocks.DB
+	offset  int64
+	mu      sync.RWMutex
+}
+
+// NewWarmReader returns a WarmReader of |player|. View directories are
+// created under |dir|, which should be on the same file system as the Player's
+// staging directory (otherwise, SSTs are copied into each view). The database is opened with |options|, which must not
+// reference a recorded Env.
+func NewWarmReader(player *Player, dir string, options *rocks.Options) *WarmReader {
+	return &WarmReader{
+		player:  player,
+		dir:     dir,
+		options: options,
+		offset:  -1,
+	}
+}
+
+// Refresh captures a new view of the Player's recovered file state, and
+// re-opens the read-only database from it. On success, the previous database
+// is closed once current reads of it complete. An error is returned if the
+// Player has exited, or if the view cannot be opened (eg, because the database
+// hasn't yet been created in the recovery log).
+func (w *WarmReader) Refresh() error {
+	var viewDir = filepath.Join(w.dir, strconv.Itoa(w.next))
+	w.next++
+
+	if err := os.MkdirAll(viewDir, 0777); err != nil {
+		return err
+	}
+	var offset, err = w.player.linkViewAt(viewDir)
+	if err != nil {
+		os.RemoveAll(viewDir)
+		return err
+	}
+
+	db, err := rocks.OpenDbForReadOnly(w.options, viewDir, false)
+	if err != nil {
+		os.RemoveAll(viewDir)
+		return err
+	}
+
+	w.mu.Lock()
+	var prevDB, prevDir = w.db, w.viewDir
+	w.db, w.viewDir, w.offset = db, viewDir, offset
+	w.mu.Unlock()
+
+	if prevDB != nil {
+		prevDB.Close()
+		os.RemoveAll(prevDir)
+	}
+	return nil
+}
+
+// Tail Refreshes the WarmReader upon each notification of |notifyCh|, which
+// is typically passed to Player.SetTailNotify, and returns when |notifyCh| is
+// closed or the Player exits. Notifications received during a Refresh are
+// coalesced. A failed Refresh (eg, because the database hasn't yet been
+// created in the recovery log) is logged, and the WarmReader continues to
+// serve its current view.
+func (w *WarmReader) Tail(notifyCh <-chan int64) {
+	for range notifyCh {
+		// Drain a notification which arrived during the last Refresh.
+		select {
+		case _, ok := <-notifyCh:
+			if !ok {
+				return
+			}
+		default:
+		}
+
+		if err := w.Refresh(); err == ErrPlaybackCancelled {
+			return
+		} else if err != nil {
+			log.WithFields(log.Fields{"err": err, "dir": w.dir}).
+				Warn("failed to refresh warm view")
+		}
+	}
+}
+
+// Offset returns the Player AppliedOffset with which the current view is
+// consistent, or -1 if no view has yet been successfully Refreshed. Callers
+// may compare it with the log write head to bound the staleness of reads.
+func (w *WarmReader) Offset() int64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.offset
+}
+
+// View invokes |fn| with the current read-only database. The database may not
+// be retained beyond the invocation. If no view has yet been successfully
+// Refreshed, |fn| is not invoked and ErrNoWarmView is returned.
+func (w *WarmReader) View(fn func(*rocks.DB) error) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.db == nil {
+		return ErrNoWarmView
+	}
+	return fn(w.db)
+}
+
+// Close closes the current database, and removes view directories.
+func (w *WarmReader) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.db != nil {
+		w.db.Close()
+		w.db = nil
+	}
+	os.RemoveAll(w.viewDir)
+}
@@ -0,0 +1,452 @@
+// gazctl is a command-line tool for interacting with Gazette brokers and
+// consumers. It reads and appends journal content, lists persisted fragments,
+// creates and deletes journals, inspects the shard status of a consumer, and prints
+// the FSMHints of a consumer shard.
+//
+// Usage:
+//
+//	gazctl [flags] <command> [command flags] [arguments]
+//
+// Run "gazctl help" for the list of commands, and "gazctl <command> -h" for
+// the flags of a command.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"github.com/LiveRamp/gazette/consumer"
+	"github.com/LiveRamp/gazette/envflag"
+	"github.com/LiveRamp/gazette/envflagfactory"
+	"github.com/LiveRamp/gazette/gazette"
+	"github.com/LiveRamp/gazette/journal"
+	"github.com/LiveRamp/gazette/keepalive"
+	"github.com/LiveRamp/gazette/recoverylog"
+)
+
+var (
+	gazetteEndpoint = envflagfactory.NewGazetteServiceEndpoint()
+	etcdEndpoint    = envflagfactory.NewEtcdServiceEndpoint()
+
+	bearerToken = flag.String("token", "", "Bearer token presented to brokers, if required")
+)
+
+// command is a gazctl subcommand. |run| is invoked with the command's
+// arguments (excluding the command name itself).
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"read", "Read a journal offset range to stdout", readCmd},
+	{"append", "Append stdin to a journal", appendCmd},
+	{"fragments", "List persisted fragments of a journal", fragmentsCmd},
+	{"create", "Create one or more journals", createCmd},
+	{"delete", "Delete one or more journals", deleteCmd},
+	{"shards", "Show shard status of a consumer", shardsCmd},
+	{"hints", "Print the FSMHints of a consumer shard", hintsCmd},
+}
+
+func main() {
+	log.SetOutput(os.Stderr)
+	flag.Usage = usage
+	envflag.CommandLine.Parse()
+	flag.Parse()
+
+	if flag.NArg() == 0 || flag.Arg(0) == "help" {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name != flag.Arg(0) {
+			continue
+		}
+		if err := cmd.run(flag.Args()[1:]); err != nil {
+			log.WithFields(log.Fields{"command": cmd.name, "err": err}).Fatal("command failed")
+		}
+		return
+	}
+	log.WithField("command", flag.Arg(0)).Fatal("unknown command (see gazctl help)")
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] <command> [command flags] [arguments]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// readCmd copies journal content of an offset range to stdout.
+func readCmd(args []string) error {
+	var fs = flag.NewFlagSet("read", flag.ExitOnError)
+	var offset = fs.Int64("offset", 0, "Journal offset to read from")
+	var end = fs.Int64("end", -1, "Journal offset to read through (exclusive). "+
+		"If -1, reads through the current write head (or indefinitely, with -block)")
+	var block = fs.Bool("block", false, "Block for, and continue to read, newly appended content")
+	var since = fs.Duration("since", 0, "If set, read from the offset at which content was "+
+		"written this long ago (eg, 2h), rather than -offset. Approximate to fragment boundaries")
+	fs.Usage = func() { commandUsage(fs, "read", "<journal>") }
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var name = journal.Name(fs.Arg(0))
+	var client = newGazetteClient()
+
+	if *since != 0 {
+		var off, err = client.OffsetForTime(name, time.Now().Add(-*since))
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{"journal": name, "offset": off}).Info("resolved offset")
+		*offset = off
+	}
+
+	var rr = journal.NewRetryReader(journal.NewMark(name, *offset), client)
+	defer rr.Close()
+
+	if !*block {
+		// Return EOF upon reaching the write head.
+		rr.EOFTimeout = time.Second
+	}
+
+	var err error
+	if *end != -1 {
+		_, err = io.CopyN(os.Stdout, rr, *end-*offset)
+	} else {
+		_, err = io.Copy(os.Stdout, rr)
+	}
+	if err == io.EOF {
+		err = nil // Reached the write head before |end|.
+	}
+	return err
+}
+
+// appendCmd appends stdin to a journal.
+func appendCmd(args []string) error {
+	var fs = flag.NewFlagSet("append", flag.ExitOnError)
+	var atomic = fs.Bool("atomic", false, "Append stdin as a single atomic write. "+
+		"Otherwise, stdin is appended in chunks as it's read")
+	fs.Usage = func() { commandUsage(fs, "append", "<journal>") }
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var name = journal.Name(fs.Arg(0))
+	var client = newGazetteClient()
+
+	if *atomic {
+		var result = client.Put(journal.AppendArgs{Journal: name, Content: os.Stdin})
+		if result.Error == nil {
+			log.WithFields(log.Fields{"journal": name, "writeHead": result.WriteHead}).Info("appended")
+		}
+		return result.Error
+	}
+
+	var writeService = gazette.NewWriteService(client)
+	writeService.Start()
+	defer writeService.Stop() // Flush writes on exit.
+
+	var promise, err = writeService.ReadFrom(name, os.Stdin)
+	if err != nil {
+		return err
+	}
+	<-promise.Ready
+	return promise.Error
+}
+
+// fragmentsCmd lists persisted fragments of a journal.
+func fragmentsCmd(args []string) error {
+	var fs = flag.NewFlagSet("fragments", flag.ExitOnError)
+	var begin = fs.Int64("begin", 0, "Journal offset from which to list fragments")
+	var end = fs.Int64("end", -1, "Journal offset through which to list fragments. "+
+		"If -1, all persisted fragments from |begin| are listed")
+	var urls = fs.Bool("urls", false, "Include signed fragment URLs")
+	fs.Usage = func() { commandUsage(fs, "fragments", "<journal>") }
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var name = journal.Name(fs.Arg(0))
+
+	var fragments, err = newGazetteClient().ListFragments(name, *begin, *end)
+	if err != nil {
+		return err
+	}
+
+	var header = []string{"Name", "Begin", "End", "Size", "Codec", "Modified"}
+	if *urls {
+		header = append(header, "URL")
+	}
+	var table = tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+
+	for _, f := range fragments {
+		var row = []string{
+			f.ContentName(),
+			strconv.FormatInt(f.Begin, 10),
+			strconv.FormatInt(f.End, 10),
+			strconv.FormatInt(f.Size(), 10),
+			fmt.Sprint(f.Codec),
+			formatTime(f.RemoteModTime),
+		}
+		if *urls {
+			row = append(row, f.Location.String())
+		}
+		table.Append(row)
+	}
+	table.Render()
+	return nil
+}
+
+// createCmd creates journals.
+func createCmd(args []string) error {
+	var fs = flag.NewFlagSet("create", flag.ExitOnError)
+	var ignoreExists = fs.Bool("ignoreExists", false, "Don't fail if a journal already exists")
+	var replication = fs.Int("replication", 0,
+		"Number of brokers serving each journal, including its master. Zero uses the broker default")
+	fs.Usage = func() { commandUsage(fs, "create", "<journal> [<journal> ...]") }
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var client = newGazetteClient()
+
+	for _, arg := range fs.Args() {
+		var name = journal.Name(arg)
+
+		if err := client.CreateWithReplication(context.Background(), name, *replication); err == journal.ErrExists && *ignoreExists {
+			log.WithField("journal", name).Info("journal exists")
+		} else if err != nil {
+			return fmt.Errorf("creating %s: %s", name, err)
+		} else {
+			log.WithField("journal", name).Info("created journal")
+		}
+	}
+	return nil
+}
+
+// deleteCmd deletes journals.
+func deleteCmd(args []string) error {
+	var fs = flag.NewFlagSet("delete", flag.ExitOnError)
+	fs.Usage = func() { commandUsage(fs, "delete", "<journal> [<journal> ...]") }
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var client = newGazetteClient()
+
+	for _, arg := range fs.Args() {
+		var name = journal.Name(arg)
+
+		if err := client.Delete(name); err != nil {
+			return fmt.Errorf("deleting %s: %s", name, err)
+		}
+		log.WithField("journal", name).Info("deleted journal")
+	}
+	return nil
+}
+
+// shardsCmd prints the shards of a consumer, and the status of their replicas.
+func shardsCmd(args []string) error {
+	var fs = flag.NewFlagSet("shards", flag.ExitOnError)
+	fs.Usage = func() { commandUsage(fs, "shards", "<consumer host:port>") }
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var conn, err = grpc.DialContext(ctx, fs.Arg(0),
+		grpc.WithBlock(),
+		grpc.WithDialer(keepalive.DialerFunc),
+		grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	state, err := consumer.NewConsumerClient(conn).CurrentConsumerState(ctx, &consumer.Empty{})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Consumer: %s\nReplicas: %d\nEndpoints: %s\n\n",
+		state.Root, state.ReplicaCount, strings.Join(state.Endpoints, ", "))
+
+	var table = tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Shard", "Topic", "Partition", "Primary", "Replicas"})
+
+	for _, shard := range state.Shards {
+		var primary string
+		var replicas []string
+
+		for _, r := range shard.Replicas {
+			if r.Status == consumer.ConsumerState_Replica_PRIMARY {
+				primary = r.Endpoint
+			} else {
+				replicas = append(replicas, fmt.Sprintf("%s (%s)", r.Endpoint, r.Status))
+			}
+		}
+		table.Append([]string{
+			shard.Id.String(),
+			shard.Topic,
+			shard.Partition.String(),
+			primary,
+			strings.Join(replicas, ", "),
+		})
+	}
+	table.Render()
+	return nil
+}
+
+// hintsCmd prints FSMHints stored in Etcd (or a file) in readable form.
+func hintsCmd(args []string) error {
+	var fs = flag.NewFlagSet("hints", flag.ExitOnError)
+	var file = fs.Bool("file", false, "Read hints from the named file (or \"-\" for stdin), rather than Etcd")
+	var raw = fs.Bool("json", false, "Print hints as indented JSON")
+	fs.Usage = func() {
+		commandUsage(fs, "hints", "<etcd key> (eg, /consumers/my-consumer/hints/shard-000)")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var content []byte
+	var err error
+
+	if !*file {
+		content, err = readEtcdKey(fs.Arg(0))
+	} else if fs.Arg(0) == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	var hints recoverylog.FSMHints
+	if err = json.Unmarshal(content, &hints); err != nil {
+		return err
+	}
+
+	if *raw {
+		if content, err = json.MarshalIndent(hints, "", "  "); err == nil {
+			_, err = fmt.Printf("%s\n", content)
+		}
+		return err
+	}
+	printHints(os.Stdout, hints)
+	return nil
+}
+
+// printHints writes a summary of |hints| to |w|: its log, and its live
+// Fnodes, their Segments, and its properties (in path order).
+func printHints(w io.Writer, hints recoverylog.FSMHints) {
+	fmt.Fprintf(w, "Log: %s\n", hints.Log)
+	if len(hints.Shards) != 0 {
+		var shards []string
+		for _, s := range hints.Shards {
+			shards = append(shards, s.String())
+		}
+		fmt.Fprintf(w, "Shards: %s\n", strings.Join(shards, ", "))
+	}
+	fmt.Fprintf(w, "\nLive Fnodes: %d\n", len(hints.LiveNodes))
+
+	var table = tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Fnode", "Author", "First SeqNo", "Last SeqNo", "First Offset"})
+
+	for _, node := range hints.LiveNodes {
+		for _, s := range node.Segments {
+			table.Append([]string{
+				strconv.FormatInt(int64(node.Fnode), 10),
+				fmt.Sprintf("%08x", uint32(s.Author)),
+				strconv.FormatInt(s.FirstSeqNo, 10),
+				strconv.FormatInt(s.LastSeqNo, 10),
+				strconv.FormatInt(s.FirstOffset, 10),
+			})
+		}
+	}
+	table.Render()
+
+	if len(hints.Properties) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nProperties: %d\n", len(hints.Properties))
+
+	for _, p := range hints.Properties {
+		fmt.Fprintf(w, "%s:\n%s\n", p.Path, p.Content)
+	}
+}
+
+// commandUsage prints the usage of a command FlagSet |fs|.
+func commandUsage(fs *flag.FlagSet, name, arguments string) {
+	fmt.Fprintf(os.Stderr, "Usage: %s %s [flags] %s\n\nFlags:\n", os.Args[0], name, arguments)
+	fs.PrintDefaults()
+}
+
+func newGazetteClient() *gazette.Client {
+	var client, err = gazette.NewClient(*gazetteEndpoint)
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to init gazette client")
+	}
+	if *bearerToken != "" {
+		client.SetBearerToken(*bearerToken)
+	}
+	return client
+}
+
+func readEtcdKey(key string) ([]byte, error) {
+	var etcdClient, err = etcd.New(etcd.Config{
+		Endpoints: []string{"http://" + *etcdEndpoint}})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := etcd.NewKeysAPI(etcdClient).Get(context.Background(), key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(resp.Node.Value), nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
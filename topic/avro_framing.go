@@ -0,0 +1,145 @@
+package topic
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// AvroFraming is a Framing implementation which encodes messages using the Avro
+// single-object encoding: a two-byte marker, the 8-byte little-endian
+// CRC-64-AVRO fingerprint of the message schema, and the Avro binary encoding
+// of the message. Each single-object encoding is prefixed with its uvarint
+// length, as with VarintFraming. Unlike an Avro Object Container File, every
+// frame is self-describing, which allows a journal to be appended to by many
+// independent writers.
+//
+// Messages must implement AvroMessage. AvroFraming doesn't perform schema
+// resolution: a frame having a schema fingerprint other than that of the
+// decoded Message fails to Unmarshal with ErrAvroSchemaMismatch. Consumers of
+// multiple schema versions may instead read single-object encodings (eg, via
+// FrameReader.Next) and resolve schemas themselves.
+var AvroFraming = new(avroFraming)
+
+// AvroMessage is a Message which is encoded by AvroFraming.
+type AvroMessage interface {
+	// AvroFingerprint returns the CRC-64-AVRO fingerprint of the Parsing
+	// Canonical Form of the Message schema (see AvroSchemaFingerprint).
+	AvroFingerprint() uint64
+	// MarshalAvro appends the Avro binary encoding of the Message onto |b|,
+	// returning the resulting buffer.
+	MarshalAvro(b []byte) ([]byte, error)
+	// UnmarshalAvro decodes the Message from its Avro binary encoding.
+	UnmarshalAvro([]byte) error
+}
+
+type avroFraming struct{}
+
+// Encode implements topic.Framing.
+func (*avroFraming) Encode(msg Message, b []byte) ([]byte, error) {
+	var am, ok = msg.(AvroMessage)
+	if !ok {
+		return nil, fmt.Errorf("%+v is not avro-frameable (must implement AvroMessage)", msg)
+	}
+	var offset = len(b)
+	var fingerprint [8]byte
+	binary.LittleEndian.PutUint64(fingerprint[:], am.AvroFingerprint())
+
+	// Encode the single-object encoding, then shift it to make room for its
+	// length header, which isn't known until the message is marshaled.
+	b = append(b, avroMarker[:]...)
+	b = append(b, fingerprint[:]...)
+
+	var err error
+	if b, err = am.MarshalAvro(b); err != nil {
+		return nil, err
+	}
+	var size = len(b) - offset
+
+	var header [binary.MaxVarintLen64]byte
+	var headerLen = binary.PutUvarint(header[:], uint64(size))
+
+	b = append(b, header[:headerLen]...)
+	copy(b[offset+headerLen:], b[offset:offset+size])
+	copy(b[offset:], header[:headerLen])
+
+	return b, nil
+}
+
+// Unpack returns the next frame of content from the Reader, including the
+// frame header.
+//
+// It implements topic.Framing.
+func (*avroFraming) Unpack(r *bufio.Reader) ([]byte, error) { return VarintFraming.Unpack(r) }
+
+// Unmarshal verifies the frame header and schema fingerprint, and unpacks
+// Message content.
+//
+// It implements topic.Framing.
+func (*avroFraming) Unmarshal(b []byte, msg Message) error {
+	var am, ok = msg.(AvroMessage)
+	if !ok {
+		return fmt.Errorf("%+v is not avro-frameable (must implement AvroMessage)", msg)
+	}
+
+	if payload, err := avroFramePayload(b); err != nil {
+		return err
+	} else if binary.LittleEndian.Uint64(payload[2:10]) != am.AvroFingerprint() {
+		return ErrAvroSchemaMismatch
+	} else {
+		return am.UnmarshalAvro(payload[10:])
+	}
+}
+
+// Payload verifies the frame header, and returns the Avro single-object
+// encoding of frame |b|.
+//
+// It implements topic.PayloadFraming.
+func (*avroFraming) Payload(b []byte) ([]byte, error) { return avroFramePayload(b) }
+
+func avroFramePayload(b []byte) ([]byte, error) {
+	var payload, err = varintFramePayload(b)
+	if err != nil {
+		return nil, err
+	} else if len(payload) < 10 || payload[0] != avroMarker[0] || payload[1] != avroMarker[1] {
+		return nil, ErrAvroHeader
+	}
+	return payload, nil
+}
+
+// AvroSchemaFingerprint returns the CRC-64-AVRO (Rabin) fingerprint of
+// |schema|, which should be in Parsing Canonical Form. For example, the
+// fingerprint of schema `"int"` is 0x7275d51a3f395c8f.
+func AvroSchemaFingerprint(schema []byte) uint64 {
+	var fp uint64 = avroFingerprintEmpty
+	for _, c := range schema {
+		fp = (fp >> 8) ^ avroFingerprintTable[byte(fp)^c]
+	}
+	return fp
+}
+
+// Marker which begins an Avro single-object encoding.
+var avroMarker = [2]byte{0xc3, 0x01}
+
+const avroFingerprintEmpty = 0xc15d213aa4d7a795
+
+var avroFingerprintTable = func() (table [256]uint64) {
+	for i := range table {
+		var fp = uint64(i)
+		for j := 0; j != 8; j++ {
+			fp = (fp >> 1) ^ (avroFingerprintEmpty & -(fp & 1))
+		}
+		table[i] = fp
+	}
+	return
+}()
+
+var (
+	// Error returned by Unmarshal or Payload if a frame isn't an Avro
+	// single-object encoding.
+	ErrAvroHeader = errors.New("invalid avro single-object header")
+	// Error returned by Unmarshal if the schema fingerprint of a frame doesn't
+	// match that of the Message.
+	ErrAvroSchemaMismatch = errors.New("avro schema fingerprint doesn't match message")
+)
@@ -0,0 +1,157 @@
+package topic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing/iotest"
+
+	gc "github.com/go-check/check"
+)
+
+type AvroFramingSuite struct{}
+
+func (s *AvroFramingSuite) TestImplementsFraming(c *gc.C) {
+	// Verified by the compiler.
+	var _ Framing = AvroFraming
+	var _ PayloadFraming = AvroFraming
+	c.Succeed()
+}
+
+func (s *AvroFramingSuite) TestSchemaFingerprints(c *gc.C) {
+	// Fixtures of the Avro specification test suite.
+	c.Check(AvroSchemaFingerprint([]byte(`"null"`)), gc.Equals, uint64(7195948357588979594))
+	c.Check(AvroSchemaFingerprint([]byte(`"int"`)), gc.Equals, uint64(0x7275d51a3f395c8f))
+}
+
+func (s *AvroFramingSuite) TestFramingWithFixture(c *gc.C) {
+	var buf, err = AvroFraming.Encode(&avroFixture{A: 1, B: "hi"}, nil)
+	c.Check(err, gc.IsNil)
+
+	var expect = []byte{0x0e, 0xc3, 0x01}
+	expect = append(expect, fingerprintBytes(avroFixtureFingerprint)...)
+	expect = append(expect, 0x02, 0x04, 'h', 'i')
+	c.Check(buf, gc.DeepEquals, expect)
+
+	// Append another message.
+	buf, err = AvroFraming.Encode(&avroFixture{A: -2}, buf)
+	c.Check(err, gc.IsNil)
+
+	expect = append(expect, 0x0c, 0xc3, 0x01)
+	expect = append(expect, fingerprintBytes(avroFixtureFingerprint)...)
+	expect = append(expect, 0x03, 0x00)
+	c.Check(buf, gc.DeepEquals, expect)
+
+	// The frame payload is the Avro single-object encoding.
+	payload, err := AvroFraming.Payload(buf[:15])
+	c.Check(err, gc.IsNil)
+	c.Check(payload, gc.DeepEquals, buf[1:15])
+}
+
+func (s *AvroFramingSuite) TestEncodingError(c *gc.C) {
+	var buf, err = AvroFraming.Encode(&avroFixture{err: errors.New("error!")}, nil)
+	c.Check(err, gc.ErrorMatches, "error!")
+	c.Check(buf, gc.HasLen, 0)
+
+	_, err = AvroFraming.Encode(struct{}{}, nil)
+	c.Check(err, gc.ErrorMatches, ".* is not avro-frameable .*")
+}
+
+func (s *AvroFramingSuite) TestRoundTrip(c *gc.C) {
+	// String lengths about the boundaries of 1 and 2-byte frame headers.
+	var lengths = []int{0, 1, 113, 114, 115, 1000}
+
+	var buf []byte
+	for i, l := range lengths {
+		var err error
+		buf, err = AvroFraming.Encode(&avroFixture{A: int64(i), B: strings.Repeat("x", l)}, buf)
+		c.Assert(err, gc.IsNil)
+	}
+
+	var r = bufio.NewReaderSize(iotest.OneByteReader(bytes.NewReader(buf)), 16)
+
+	for i, l := range lengths {
+		var frame, err = AvroFraming.Unpack(r)
+		c.Assert(err, gc.IsNil)
+
+		var msg avroFixture
+		c.Check(AvroFraming.Unmarshal(frame, &msg), gc.IsNil)
+		c.Check(msg.A, gc.Equals, int64(i))
+		c.Check(msg.B, gc.HasLen, l)
+	}
+	var _, err = AvroFraming.Unpack(r)
+	c.Check(err, gc.Equals, io.EOF)
+}
+
+func (s *AvroFramingSuite) TestCorruptFramesAndSchemaMismatch(c *gc.C) {
+	var fixture, _ = AvroFraming.Encode(&avroFixture{A: 1, B: "hi"}, nil)
+	var msg avroFixture
+
+	// A frame with a header which doesn't match its length.
+	c.Check(AvroFraming.Unmarshal(fixture[:len(fixture)-1], &msg), gc.Equals, ErrVarintFrameLength)
+
+	// A frame which isn't a single-object encoding.
+	var corrupt = append([]byte(nil), fixture...)
+	corrupt[1] = 0xc4
+	c.Check(AvroFraming.Unmarshal(corrupt, &msg), gc.Equals, ErrAvroHeader)
+	var _, err = AvroFraming.Payload(corrupt)
+	c.Check(err, gc.Equals, ErrAvroHeader)
+	c.Check(AvroFraming.Unmarshal([]byte{0x02, 0xc3, 0x01}, &msg), gc.Equals, ErrAvroHeader)
+
+	// A frame written with a different schema.
+	var other = append([]byte(nil), fixture...)
+	binary.LittleEndian.PutUint64(other[3:11], AvroSchemaFingerprint([]byte(`"int"`)))
+	c.Check(AvroFraming.Unmarshal(other, &msg), gc.Equals, ErrAvroSchemaMismatch)
+
+	c.Check(AvroFraming.Unmarshal(fixture, struct{}{}), gc.ErrorMatches, ".* is not avro-frameable .*")
+}
+
+// avroFixture is a hand-written AvroMessage of a record having long "a" and
+// string "b" fields.
+type avroFixture struct {
+	A   int64
+	B   string
+	err error
+}
+
+var avroFixtureFingerprint = AvroSchemaFingerprint([]byte(`{"name":"fixture","type":"record",` +
+	`"fields":[{"name":"a","type":"long"},{"name":"b","type":"string"}]}`))
+
+func (f *avroFixture) AvroFingerprint() uint64 { return avroFixtureFingerprint }
+
+func (f *avroFixture) MarshalAvro(b []byte) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	// Avro longs and string lengths are zig-zag varints, as are Go varints.
+	var tmp [binary.MaxVarintLen64]byte
+	b = append(b, tmp[:binary.PutVarint(tmp[:], f.A)]...)
+	b = append(b, tmp[:binary.PutVarint(tmp[:], int64(len(f.B)))]...)
+	return append(b, f.B...), nil
+}
+
+func (f *avroFixture) UnmarshalAvro(b []byte) error {
+	var a, n = binary.Varint(b)
+	if n <= 0 {
+		return errors.New("invalid long")
+	}
+	b = b[n:]
+
+	var l, m = binary.Varint(b)
+	if m <= 0 || l < 0 || int64(len(b)-m) != l {
+		return errors.New("invalid string")
+	}
+	f.A, f.B = a, string(b[m:])
+	return nil
+}
+
+func fingerprintBytes(fp uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], fp)
+	return b[:]
+}
+
+var _ = gc.Suite(&AvroFramingSuite{})
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"hash/fnv"
+	"sync/atomic"
 
 	"github.com/LiveRamp/gazette/journal"
 )
@@ -27,6 +28,24 @@ type Framing interface {
 	Unmarshal([]byte, Message) error
 }
 
+// PayloadFraming is an optional Framing capable of stripping the header (or
+// suffix) of a frame, returning its Message payload. See FramePayload.
+type PayloadFraming interface {
+	// Payload returns the Message payload of a frame previously produced by
+	// Unpack. It returns an error if the frame is corrupt. The payload
+	// references the frame, and is invalidated with it.
+	Payload([]byte) ([]byte, error)
+}
+
+// FramePayload returns the Message payload of frame |b|, previously produced by
+// Unpack of |framing|. |framing| must be a PayloadFraming.
+func FramePayload(framing Framing, b []byte) ([]byte, error) {
+	if pf, ok := framing.(PayloadFraming); ok {
+		return pf.Payload(b)
+	}
+	return nil, fmt.Errorf("%T is not a PayloadFraming", framing)
+}
+
 // Fixupable is an optional Message type capable of being "fixed up" after
 // decoding. This provides an opportunity to apply migrations or
 // initialization after a code-generated decode implementation has completed.
@@ -60,7 +79,20 @@ type Description struct {
 	// typically used for pooling of message instances.
 	PutMessage func(Message) `json:"-"`
 	// Serialization used for Topic messages.
-	Framing
+	Framing `json:"-"`
+	// Identifier of the registered Framing used for Topic messages (eg,
+	// "fixed/v1"), which is consulted only if Framing is nil. FramingID allows
+	// the Framing of a Topic to be selected by configuration.
+	FramingID string `json:",omitempty"`
+}
+
+// ResolveFraming returns the Framing of the Topic: Framing if set, and
+// otherwise the Framing registered under FramingID.
+func (d *Description) ResolveFraming() (Framing, error) {
+	if d.Framing != nil {
+		return d.Framing, nil
+	}
+	return LookupFraming(d.FramingID)
 }
 
 // Partition pairs a Gazette Journal with the topic it implements.
@@ -77,6 +109,9 @@ type Envelope struct {
 	journal.Mark
 	// Message value.
 	Message
+	// Stamp of the message, if the Topic Framing is a StampedFraming and the
+	// message was stamped. Otherwise, Stamp is zero-valued.
+	Stamp Stamp
 }
 
 // Returns the Partition of the message Envelope.
@@ -98,20 +133,50 @@ func EnumeratePartitions(name string, partitions int) func() []journal.Name {
 	}
 }
 
-// ModuloPartitionMapping returns a closure which maps a Message into a stable
-// member of |partitions| using modulo arithmetic. It requires a |routingKey|
-// function, which extracts and encodes a key from Message,
-// returning the result of appending it to the argument []byte.
-func ModuloPartitionMapping(partitions func() []journal.Name,
-	routingKey func(Message, []byte) []byte) func(Message) journal.Name {
+// PartitionFunc maps a Message to one of |partitions|, which is non-empty.
+type PartitionFunc func(msg Message, partitions []journal.Name) journal.Name
 
-	return func(msg Message) journal.Name {
+// Mapping returns a closure suitable for use as Description.MappedPartition,
+// which maps a Message to a member of the current |partitions| using the
+// PartitionFunc.
+func (fn PartitionFunc) Mapping(partitions func() []journal.Name) func(Message) journal.Name {
+	return func(msg Message) journal.Name { return fn(msg, partitions()) }
+}
+
+// HashPartitionFunc returns a PartitionFunc which maps a Message into a stable
+// member of partitions by the hash of its key, using modulo arithmetic. It
+// requires a |routingKey| function, which extracts and encodes a key from
+// Message, returning the result of appending it to the argument []byte.
+func HashPartitionFunc(routingKey func(Message, []byte) []byte) PartitionFunc {
+	return func(msg Message, partitions []journal.Name) journal.Name {
 		var tmp [32]byte
 
 		var h = fnv.New32a()
 		h.Write(routingKey(msg, tmp[:0]))
 
-		var parts = partitions()
-		return parts[int(h.Sum32())%len(parts)]
+		return partitions[int(h.Sum32())%len(partitions)]
 	}
 }
+
+// RoundRobinPartitionFunc returns a PartitionFunc which maps successive
+// Messages to successive partitions, spreading Messages evenly across
+// partitions without regard to their content.
+func RoundRobinPartitionFunc() PartitionFunc {
+	var next uint32
+
+	return func(msg Message, partitions []journal.Name) journal.Name {
+		var n = atomic.AddUint32(&next, 1) - 1
+		return partitions[int(n%uint32(len(partitions)))]
+	}
+}
+
+// ModuloPartitionMapping returns a closure which maps a Message into a stable
+// member of |partitions| using modulo arithmetic. It requires a |routingKey|
+// function, which extracts and encodes a key from Message,
+// returning the result of appending it to the argument []byte. It's
+// equivalent to HashPartitionFunc(routingKey).Mapping(partitions).
+func ModuloPartitionMapping(partitions func() []journal.Name,
+	routingKey func(Message, []byte) []byte) func(Message) journal.Name {
+
+	return HashPartitionFunc(routingKey).Mapping(partitions)
+}
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	gc "github.com/go-check/check"
+
+	"github.com/LiveRamp/gazette/journal"
 )
 
 type TopicSuite struct{}
@@ -85,6 +87,34 @@ func (s *TopicSuite) TestModuloRoutingWithCommonFactors(c *gc.C) {
 	}
 }
 
+func (s *TopicSuite) TestPartitionFuncs(c *gc.C) {
+	var partitions = EnumeratePartitions("a/topic", 3)
+
+	// Hashed routing is equivalent to ModuloPartitionMapping.
+	var hashed = HashPartitionFunc(identityRouter).Mapping(partitions)
+	var modulo = ModuloPartitionMapping(partitions, identityRouter)
+
+	for _, key := range []string{"foo", "bar", "baz", "quux"} {
+		c.Check(hashed(key), gc.Equals, modulo(key))
+	}
+
+	// Round-robin routing cycles through partitions.
+	var roundRobin = RoundRobinPartitionFunc().Mapping(partitions)
+	var routed []journal.Name
+
+	for i := 0; i != 4; i++ {
+		routed = append(routed, roundRobin("msg"))
+	}
+	c.Check(routed, gc.DeepEquals, []journal.Name{
+		"a/topic/part-000", "a/topic/part-001", "a/topic/part-002", "a/topic/part-000"})
+
+	// Custom PartitionFuncs are invoked with current partitions.
+	var last = PartitionFunc(func(msg Message, parts []journal.Name) journal.Name {
+		return parts[len(parts)-1]
+	}).Mapping(partitions)
+	c.Check(last("msg"), gc.Equals, journal.Name("a/topic/part-002"))
+}
+
 func identityRouter(message Message, b []byte) []byte { return append(b, message.(string)...) }
 
 var _ = gc.Suite(&TopicSuite{})
@@ -0,0 +1,50 @@
+package topic
+
+import (
+	"bufio"
+	"io"
+)
+
+// FrameReader reads successive messages of a Framing from an io.Reader, such
+// as a journal read stream. It buffers the Reader, and frames may span any
+// number of underlying reads.
+type FrameReader struct {
+	framing Framing
+	br      *bufio.Reader
+}
+
+// NewFrameReader returns a FrameReader of |framing| frames read from |r|.
+func NewFrameReader(r io.Reader, framing Framing) *FrameReader {
+	var br, ok = r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &FrameReader{framing: framing, br: br}
+}
+
+// Next returns the message payload of the next complete frame, stripped of
+// its framing header (see FramePayload). The Framing must be a PayloadFraming.
+// The returned []byte is invalidated by the next call to Next or Decode. Next
+// returns io.EOF if the Reader ends at a frame boundary, and
+// io.ErrUnexpectedEOF if it ends partway through a frame. An error of a
+// corrupt frame doesn't invalidate the FrameReader, and further frames may be
+// read.
+func (fr *FrameReader) Next() ([]byte, error) {
+	if frame, err := fr.framing.Unpack(fr.br); err != nil {
+		return nil, err
+	} else {
+		return FramePayload(fr.framing, frame)
+	}
+}
+
+// Decode reads the next frame and unmarshals it into |msg|. Errors are those
+// of the Framing's Unpack or Unmarshal, and are otherwise as returned by Next.
+// A Framing Unmarshal error doesn't invalidate the FrameReader, and further
+// frames may be read.
+func (fr *FrameReader) Decode(msg Message) error {
+	if frame, err := fr.framing.Unpack(fr.br); err != nil {
+		return err
+	} else {
+		return fr.framing.Unmarshal(frame, msg)
+	}
+}
@@ -0,0 +1,121 @@
+package topic
+
+import (
+	"bytes"
+	"io"
+	"testing/iotest"
+
+	gc "github.com/go-check/check"
+)
+
+type FrameReaderSuite struct{}
+
+func (s *FrameReaderSuite) TestReadingFrames(c *gc.C) {
+	for _, framing := range []Framing{FixedFraming, FixedFramingCRC, VarintFraming} {
+		var buf []byte
+		var expect = []string{"", "foo", string(bytes.Repeat([]byte{'x'}, 5000)), "bar"}
+
+		for _, m := range expect {
+			var err error
+			buf, err = framing.Encode(frameablestring(m), buf)
+			c.Assert(err, gc.IsNil)
+		}
+
+		// Read a byte at a time, such that frames span many underlying reads.
+		var fr = NewFrameReader(iotest.OneByteReader(bytes.NewReader(buf)), framing)
+
+		for _, m := range expect {
+			var msg frameablestring
+			c.Check(fr.Decode(&msg), gc.IsNil)
+			c.Check(string(msg), gc.Equals, m)
+		}
+		// Expect a clean EOF at the frame boundary.
+		var _, err = fr.Next()
+		c.Check(err, gc.Equals, io.EOF)
+
+		// Next returns message payloads, without framing headers.
+		fr = NewFrameReader(iotest.OneByteReader(bytes.NewReader(buf)), framing)
+
+		for _, m := range expect {
+			var payload, err = fr.Next()
+			c.Check(err, gc.IsNil)
+			c.Check(string(payload), gc.Equals, m)
+		}
+		_, err = fr.Next()
+		c.Check(err, gc.Equals, io.EOF)
+	}
+}
+
+func (s *FrameReaderSuite) TestStampedPayloads(c *gc.C) {
+	var framing = NewStampedFraming(FixedFraming, NewProducerID())
+
+	// Interleave stamped and unstamped frames.
+	var buf, _ = framing.Encode(frameablestring("foo"), nil)
+	buf, _ = FixedFraming.Encode(frameablestring("bar"), buf)
+	buf, _ = framing.Encode(frameablestring("baz"), buf)
+
+	var fr = NewFrameReader(bytes.NewReader(buf), framing)
+
+	for _, m := range []string{"foo", "bar", "baz"} {
+		var payload, err = fr.Next()
+		c.Check(err, gc.IsNil)
+		c.Check(string(payload), gc.Equals, m)
+	}
+	var _, err = fr.Next()
+	c.Check(err, gc.Equals, io.EOF)
+}
+
+func (s *FrameReaderSuite) TestCorruptFrameDoesNotInvalidateReader(c *gc.C) {
+	var buf, _ = FixedFramingCRC.Encode(frameablestring("foo"), nil)
+	buf[len(buf)-1] ^= 0xff // Corrupt the payload.
+	buf, _ = FixedFramingCRC.Encode(frameablestring("bar"), buf)
+
+	var fr = NewFrameReader(bytes.NewReader(buf), FixedFramingCRC)
+
+	var _, err = fr.Next()
+	c.Check(err, gc.Equals, ErrCorruptFrame)
+
+	// Remaining content of the corrupt frame is de-synchronized.
+	_, err = fr.Next()
+	c.Check(err, gc.Equals, ErrDesyncDetected)
+
+	payload, err := fr.Next()
+	c.Check(err, gc.IsNil)
+	c.Check(string(payload), gc.Equals, "bar")
+}
+
+func (s *FrameReaderSuite) TestNextRequiresPayloadFraming(c *gc.C) {
+	var fr = NewFrameReader(bytes.NewReader([]byte("foo\n")), unpackOnlyFraming{JsonFraming})
+
+	var _, err = fr.Next()
+	c.Check(err, gc.ErrorMatches, "topic.unpackOnlyFraming is not a PayloadFraming")
+}
+
+func (s *FrameReaderSuite) TestTruncatedFinalFrame(c *gc.C) {
+	var buf, _ = JsonFraming.Encode(struct{ A int }{42}, nil)
+	buf, _ = JsonFraming.Encode(struct{ A int }{53}, buf)
+
+	var fr = NewFrameReader(bytes.NewReader(buf[:len(buf)-3]), JsonFraming)
+
+	var payload, err = fr.Next()
+	c.Check(err, gc.IsNil)
+	c.Check(string(payload), gc.Equals, `{"A":42}`)
+
+	_, err = fr.Next()
+	c.Check(err, gc.Equals, io.ErrUnexpectedEOF)
+}
+
+func (s *FrameReaderSuite) TestDecodeErrorDoesNotInvalidateReader(c *gc.C) {
+	var fixture = []byte(`{"A":"unterminated}` + "\n" + `{"A":"ok"}` + "\n")
+	var fr = NewFrameReader(bytes.NewReader(fixture), JsonFraming)
+
+	var msg struct{ A string }
+	c.Check(fr.Decode(&msg), gc.ErrorMatches, "invalid character .*")
+	c.Check(fr.Decode(&msg), gc.IsNil)
+	c.Check(msg.A, gc.Equals, "ok")
+}
+
+// unpackOnlyFraming is a Framing which is not a PayloadFraming.
+type unpackOnlyFraming struct{ Framing }
+
+var _ = gc.Suite(&FrameReaderSuite{})
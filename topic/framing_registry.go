@@ -0,0 +1,60 @@
+package topic
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Identifiers under which Framings of this package are registered. An
+// identifier is stable for a given wire format: a Framing which changes its
+// encoding must be registered under a new identifier (eg, "fixed/v2").
+const (
+	AvroFramingID         = "avro/v1"
+	FixedFramingID        = "fixed/v1"
+	FixedFramingCRCID     = "fixed/v2"
+	JsonFramingID         = "json/v1"
+	VarintFramingID       = "varint/v1"
+	StampedFixedFramingID = "stamped-fixed/v1"
+)
+
+// RegisterFraming registers |framing| under identifier |id|, such that it may
+// be selected by Description.FramingID. RegisterFraming is typically called
+// from an init function, and panics if |id| is already registered.
+func RegisterFraming(id string, framing Framing) {
+	framingsMu.Lock()
+	defer framingsMu.Unlock()
+
+	if framing == nil {
+		panic("topic: RegisterFraming of nil Framing " + id)
+	} else if _, ok := framings[id]; ok {
+		panic("topic: RegisterFraming called twice for " + id)
+	}
+	framings[id] = framing
+}
+
+// LookupFraming returns the Framing registered under identifier |id|.
+func LookupFraming(id string) (Framing, error) {
+	framingsMu.RLock()
+	defer framingsMu.RUnlock()
+
+	if framing, ok := framings[id]; ok {
+		return framing, nil
+	}
+	return nil, fmt.Errorf("framing %q is not registered", id)
+}
+
+var (
+	framingsMu sync.RWMutex
+	framings   = make(map[string]Framing)
+)
+
+func init() {
+	RegisterFraming(AvroFramingID, AvroFraming)
+	RegisterFraming(FixedFramingID, FixedFraming)
+	RegisterFraming(FixedFramingCRCID, FixedFramingCRC)
+	RegisterFraming(JsonFramingID, JsonFraming)
+	RegisterFraming(VarintFramingID, VarintFraming)
+	// Messages encoded by the registered StampedFraming are stamped with a
+	// ProducerID unique to this process.
+	RegisterFraming(StampedFixedFramingID, NewStampedFraming(FixedFraming, NewProducerID()))
+}
@@ -0,0 +1,58 @@
+package topic
+
+import (
+	gc "github.com/go-check/check"
+)
+
+type FramingRegistrySuite struct{}
+
+func (s *FramingRegistrySuite) TestBuiltinFramingsAreRegistered(c *gc.C) {
+	for id, expect := range map[string]Framing{
+		AvroFramingID:   AvroFraming,
+		FixedFramingID:  FixedFraming,
+		JsonFramingID:   JsonFraming,
+		VarintFramingID: VarintFraming,
+	} {
+		var framing, err = LookupFraming(id)
+		c.Check(err, gc.IsNil)
+		c.Check(framing, gc.Equals, expect)
+	}
+
+	// The registered StampedFraming wraps FixedFraming.
+	var framing, err = LookupFraming(StampedFixedFramingID)
+	c.Check(err, gc.IsNil)
+	c.Check(framing.(*StampedFraming).Framing, gc.Equals, FixedFraming)
+
+	_, err = LookupFraming("unknown/v1")
+	c.Check(err, gc.ErrorMatches, `framing "unknown/v1" is not registered`)
+}
+
+func (s *FramingRegistrySuite) TestRegisterTwicePanics(c *gc.C) {
+	c.Check(func() { RegisterFraming(FixedFramingID, JsonFraming) },
+		gc.PanicMatches, "topic: RegisterFraming called twice for fixed/v1")
+	c.Check(func() { RegisterFraming("nil/v1", nil) },
+		gc.PanicMatches, "topic: RegisterFraming of nil Framing nil/v1")
+}
+
+func (s *FramingRegistrySuite) TestDescriptionResolution(c *gc.C) {
+	// FramingID is resolved through the registry.
+	var desc = &Description{FramingID: JsonFramingID}
+
+	var framing, err = desc.ResolveFraming()
+	c.Check(err, gc.IsNil)
+	c.Check(framing, gc.Equals, JsonFraming)
+
+	// An explicit Framing takes precedence.
+	desc.Framing = FixedFraming
+
+	framing, err = desc.ResolveFraming()
+	c.Check(err, gc.IsNil)
+	c.Check(framing, gc.Equals, FixedFraming)
+
+	// Neither a Framing nor a registered FramingID.
+	desc = &Description{FramingID: "unknown/v1"}
+	_, err = desc.ResolveFraming()
+	c.Check(err, gc.ErrorMatches, `framing "unknown/v1" is not registered`)
+}
+
+var _ = gc.Suite(&FramingRegistrySuite{})
@@ -9,6 +9,8 @@ import (
 
 // JsonFraming is a Framing implementation which encodes messages as line-
 // delimited JSON. Messages must be encode-able by the encoding/json package.
+// Each encoded message occupies exactly one line: newlines within string values
+// are escaped, and output of json.Marshaler implementations is compacted.
 var JsonFraming = new(jsonFraming)
 
 type jsonFraming struct{}
@@ -33,6 +35,13 @@ func (*jsonFraming) Unmarshal(line []byte, msg Message) error {
 	return json.Unmarshal(line, msg)
 }
 
+// Payload returns the JSON document of |line|, without its newline.
+//
+// It implements topic.PayloadFraming.
+func (*jsonFraming) Payload(line []byte) ([]byte, error) {
+	return bytes.TrimSuffix(line, []byte{'\n'}), nil
+}
+
 // unpackLine returns bytes through to the first encountered newline "\n". If
 // the complete line is in the Reader buffer, no alloc or copy is needed.
 func unpackLine(r *bufio.Reader) ([]byte, error) {
@@ -1,6 +1,7 @@
 package topic
 
 import (
+	"encoding/json"
 	"io"
 
 	gc "github.com/go-check/check"
@@ -34,6 +35,28 @@ func (s *JsonFramingSuite) TestFramingWithFixture(c *gc.C) {
 	c.Check(&orig[0], gc.Equals, &buf[0]) // No reallocation occurred.
 }
 
+func (s *JsonFramingSuite) TestEmbeddedNewlines(c *gc.C) {
+	var buf, err = JsonFraming.Encode(struct {
+		A string
+		B json.RawMessage
+	}{"multi\nline", json.RawMessage("{\n  \"indented\": true\n}")}, nil)
+
+	c.Check(err, gc.IsNil)
+	c.Check(string(buf), gc.Equals, `{"A":"multi\nline","B":{"indented":true}}`+"\n")
+
+	// Expect the message round-trips as a single frame.
+	var r = testReader(buf)
+	frame, err := JsonFraming.Unpack(r)
+	c.Check(err, gc.IsNil)
+
+	var msg struct{ A string }
+	c.Check(JsonFraming.Unmarshal(frame, &msg), gc.IsNil)
+	c.Check(msg.A, gc.Equals, "multi\nline")
+
+	_, err = JsonFraming.Unpack(r)
+	c.Check(err, gc.Equals, io.EOF)
+}
+
 func (s *JsonFramingSuite) TestEncodingError(c *gc.C) {
 	var buf, err = JsonFraming.Encode(struct {
 		Unencodable chan struct{}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"io/ioutil"
 
 	"github.com/LiveRamp/gazette/journal"
 )
@@ -16,6 +17,9 @@ type MemoryWriter struct {
 	new     func() Message
 
 	Messages []Envelope
+	// Bytes written to each journal, which is reported as the WriteHead
+	// of resolved AsyncAppends.
+	writeHeads map[journal.Name]int64
 }
 
 func NewMemoryWriter(framing Framing, new func() Message) *MemoryWriter {
@@ -27,10 +31,23 @@ func (w *MemoryWriter) Write(j journal.Name, b []byte) (*journal.AsyncAppend, er
 }
 
 func (w *MemoryWriter) ReadFrom(j journal.Name, r io.Reader) (*journal.AsyncAppend, error) {
-	var br = bufio.NewReader(r)
+	var content, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var br = bufio.NewReader(bytes.NewReader(content))
+
+	if w.writeHeads == nil {
+		w.writeHeads = make(map[journal.Name]int64)
+	}
+	w.writeHeads[j] += int64(len(content))
 
 	var result = &journal.AsyncAppend{
-		Ready: make(chan struct{}),
+		AppendResult: journal.AppendResult{WriteHead: w.writeHeads[j]},
+		Journal:      j,
+		Begin:        w.writeHeads[j] - int64(len(content)),
+		End:          w.writeHeads[j],
+		Ready:        make(chan struct{}),
 	}
 	close(result.Ready)
 
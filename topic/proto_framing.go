@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 )
 
@@ -13,14 +14,30 @@ import (
 // functions for marshal support (eg, generated Protobuf messages satisfy this
 // interface). Messages are encoded as a 4-byte magic word for de-synchronization
 // detection, followed by a little-endian uint32 length, followed by payload bytes.
-var FixedFraming = new(fixedFraming)
-
-const FixedFrameHeaderLength = 8
+var FixedFraming = &fixedFraming{}
+
+// FixedFramingCRC is a FixedFraming which additionally protects each payload
+// with a CRC32-C checksum. Frames are encoded with a distinct magic word,
+// followed by a little-endian uint32 length, a little-endian uint32 CRC32-C of
+// the payload, and then payload bytes. Both FixedFraming and FixedFramingCRC
+// decode either frame version, but readers which pre-date FixedFramingCRC
+// treat its frames as de-synchronized content. Writers should adopt it only
+// once all readers of a journal have been upgraded.
+var FixedFramingCRC = &fixedFraming{crc: true}
+
+const (
+	// Header length of a FixedFraming frame.
+	FixedFrameHeaderLength = 8
+	// Header length of a FixedFramingCRC frame.
+	FixedFrameCRCHeaderLength = 12
+)
 
-type fixedFraming struct{}
+type fixedFraming struct {
+	crc bool // Encode with a CRC32-C header.
+}
 
 // Encode implements topic.Framing.
-func (*fixedFraming) Encode(msg Message, b []byte) ([]byte, error) {
+func (f *fixedFraming) Encode(msg Message, b []byte) ([]byte, error) {
 	var p, ok = msg.(interface {
 		Size() int
 		MarshalTo([]byte) (int, error)
@@ -29,7 +46,11 @@ func (*fixedFraming) Encode(msg Message, b []byte) ([]byte, error) {
 		return nil, fmt.Errorf("%+v is not fixed-frameable (must implement Size and MarshalTo)", msg)
 	}
 
-	var size = FixedFrameHeaderLength + p.Size()
+	var headerLen = FixedFrameHeaderLength
+	if f.crc {
+		headerLen = FixedFrameCRCHeaderLength
+	}
+	var size = headerLen + p.Size()
 	var offset = len(b)
 
 	if size > (cap(b) - offset) {
@@ -39,19 +60,33 @@ func (*fixedFraming) Encode(msg Message, b []byte) ([]byte, error) {
 	}
 
 	// Header consists of a magic word (for de-sync detection), and a 4-byte length.
-	copy(b[offset:offset+4], magicWord[:])
-	binary.LittleEndian.PutUint32(b[offset+4:offset+8], uint32(size-FixedFrameHeaderLength))
+	// The magic word is written below, after the payload is marshaled.
+	binary.LittleEndian.PutUint32(b[offset+4:offset+8], uint32(size-headerLen))
 
-	if _, err := p.MarshalTo(b[offset+FixedFrameHeaderLength:]); err != nil {
+	if _, err := p.MarshalTo(b[offset+headerLen:]); err != nil {
 		return nil, err
 	}
+
+	if f.crc {
+		// The CRC header version has a distinct magic word, and a 4-byte CRC.
+		copy(b[offset:offset+4], magicWordCRC[:])
+		binary.LittleEndian.PutUint32(b[offset+8:offset+12],
+			crc32.Checksum(b[offset+headerLen:], crcTable))
+	} else {
+		copy(b[offset:offset+4], magicWord[:])
+	}
 	return b, nil
 }
 
 // Unpack returns the next fixed frame of content from the Reader, including
 // the frame header. If the magic word is not detected (indicating a desync),
 // Unpack attempts to continue reading until the next magic word, returning
-// the interleaved but desynchronized content.
+// the interleaved but desynchronized content. If a frame with a CRC header
+// is fully buffered and fails verification (eg, because its length header
+// is corrupt, or it's truncated and followed by another frame), only the
+// frame magic word is consumed and returned. This produces an ErrCorruptFrame
+// on a later Unmarshal, and the following Unpack resumes from the next
+// magic word.
 //
 // It implements topic.Framing.
 func (*fixedFraming) Unpack(r *bufio.Reader) ([]byte, error) {
@@ -66,29 +101,38 @@ func (*fixedFraming) Unpack(r *bufio.Reader) ([]byte, error) {
 		return nil, err
 	}
 
-	if !matchesMagicWord(b) {
+	var headerLen int
+	if matchesMagicWord(b, magicWord) {
+		headerLen = FixedFrameHeaderLength
+	} else if matchesMagicWord(b, magicWordCRC) {
+		headerLen = FixedFrameCRCHeaderLength
+	} else {
 		// We are not at the expected frame boundary. Scan forward within the buffered
 		// region to the beginning of the next magic word. Return the intermediate
 		// jumbled frame (this will produce an ErrDesyncDetected on a later Unmarshal).
 		b, _ = r.Peek(r.Buffered())
 
-		var i, j = 1, 1 + len(b) - len(magicWord)
-		for ; i != j; i++ {
-			if matchesMagicWord(b[i:]) {
-				break
-			}
+		var i = ScanFixedFrameHeader(b)
+		if i == len(b) {
+			// Retain trailing bytes which may begin a magic word completed by
+			// further content.
+			i = len(b) - (len(magicWord) - 1)
 		}
 		r.Discard(i)
 		return b[:i], nil
 	}
 
 	// Next 4 bytes are encoded size. Combine with header for full frame size.
-	var size = FixedFrameHeaderLength + int(binary.LittleEndian.Uint32(b[4:]))
+	var size = headerLen + int(binary.LittleEndian.Uint32(b[4:]))
 
 	// Fast path: check if the full frame is available in buffer. Return the
 	// buffer internal slice without copying. It is invalidated by the next
 	// Unpack (or other Reader operation).
 	if b, err = r.Peek(size); err == nil {
+		if headerLen == FixedFrameCRCHeaderLength && !verifyCRC(b) {
+			r.Discard(len(magicWordCRC))
+			return b[:len(magicWordCRC)], nil
+		}
 		r.Discard(size)
 		return b, nil
 	}
@@ -101,7 +145,8 @@ func (*fixedFraming) Unpack(r *bufio.Reader) ([]byte, error) {
 
 // Unmarshal verifies the frame header and unpacks Message content. If the frame
 // header indicates a desync occurred (incorrect magic word), ErrDesyncDetected
-// is returned.
+// is returned. If the frame has a CRC header and its payload fails verification,
+// ErrCorruptFrame is returned.
 //
 // It implements topic.Framing.
 func (*fixedFraming) Unmarshal(b []byte, msg Message) error {
@@ -111,19 +156,68 @@ func (*fixedFraming) Unmarshal(b []byte, msg Message) error {
 
 	if !ok {
 		return fmt.Errorf("%+v is not fixed-frameable (must implement Unmarshal)", msg)
-	} else if !matchesMagicWord(b) {
-		return ErrDesyncDetected
 	}
-	return p.Unmarshal(b[FixedFrameHeaderLength:])
+
+	var payload, err = FixedFramePayload(b)
+	if err != nil {
+		return err
+	}
+	return p.Unmarshal(payload)
 }
 
-func matchesMagicWord(b []byte) bool {
-	return b[0] == magicWord[0] && b[1] == magicWord[1] && b[2] == magicWord[2] && b[3] == magicWord[3]
+// Payload returns the payload of frame |b|. See FixedFramePayload.
+//
+// It implements topic.PayloadFraming.
+func (*fixedFraming) Payload(b []byte) ([]byte, error) { return FixedFramePayload(b) }
+
+// FixedFramePayload returns the payload of frame |b|, which was produced by
+// FixedFraming or FixedFramingCRC and returned by Unpack. The CRC of |b| is
+// verified, if it has one.
+func FixedFramePayload(b []byte) ([]byte, error) {
+	if matchesMagicWord(b, magicWord) {
+		return b[FixedFrameHeaderLength:], nil
+	} else if !matchesMagicWord(b, magicWordCRC) {
+		return nil, ErrDesyncDetected
+	} else if len(b) < FixedFrameCRCHeaderLength || !verifyCRC(b) {
+		return nil, ErrCorruptFrame
+	}
+	return b[FixedFrameCRCHeaderLength:], nil
+}
+
+// ScanFixedFrameHeader returns the index of the first plausible FixedFraming
+// or FixedFramingCRC frame header of |b| which follows its first byte, or
+// len(b) if |b| has no such header. It may be used to re-synchronize with
+// frame boundaries after a corrupt frame.
+func ScanFixedFrameHeader(b []byte) int {
+	for i := 1; i+len(magicWord) <= len(b); i++ {
+		if matchesMagicWord(b[i:], magicWord) || matchesMagicWord(b[i:], magicWordCRC) {
+			return i
+		}
+	}
+	return len(b)
+}
+
+// verifyCRC returns whether the length and CRC header of CRC frame |b|
+// match its payload.
+func verifyCRC(b []byte) bool {
+	var payload = b[FixedFrameCRCHeaderLength:]
+
+	return binary.LittleEndian.Uint32(b[4:8]) == uint32(len(payload)) &&
+		binary.LittleEndian.Uint32(b[8:12]) == crc32.Checksum(payload, crcTable)
+}
+
+func matchesMagicWord(b []byte, word [4]byte) bool {
+	return len(b) >= 4 && b[0] == word[0] && b[1] == word[1] && b[2] == word[2] && b[3] == word[3]
 }
 
 var (
 	// Error returned by Unmarshal upon detection of an invalid frame.
 	ErrDesyncDetected = errors.New("detected de-synchronization")
+	// Error returned by Unmarshal upon a CRC mismatch of a frame.
+	ErrCorruptFrame = errors.New("frame CRC mismatch")
+
+	magicWord    = [4]byte{0x66, 0x33, 0x93, 0x36}
+	magicWordCRC = [4]byte{0x66, 0x33, 0x93, 0x37}
 
-	magicWord = [4]byte{0x66, 0x33, 0x93, 0x36}
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
 )
@@ -145,6 +145,96 @@ func (s *FixedFramingSuite) TestUnderflowReadingDesyncHeader(c *gc.C) {
 	c.Check(b, gc.DeepEquals, fixture[13+8:])
 }
 
+func (s *FixedFramingSuite) TestCRCFramingWithFixture(c *gc.C) {
+	var buf, err = FixedFramingCRC.Encode(frameablestring("test message content"), nil)
+	c.Check(err, gc.IsNil)
+	c.Check(buf, gc.DeepEquals, []byte{
+		0x66, 0x33, 0x93, 0x37, 0x14, 0x0, 0x0, 0x0, 0x9, 0x75, 0x82, 0xb,
+		't', 'e', 's', 't', ' ', 'm', 'e', 's', 's', 'a', 'g', 'e',
+		' ', 'c', 'o', 'n', 't', 'e', 'n', 't'})
+
+	// Append a message without a CRC. Expect both frame versions are decoded
+	// by either Framing.
+	buf, err = FixedFraming.Encode(frameablestring("foo message"), buf)
+	c.Check(err, gc.IsNil)
+
+	for _, framing := range []Framing{FixedFraming, FixedFramingCRC} {
+		var r = testReader(buf)
+
+		for _, expect := range []string{"test message content", "foo message"} {
+			var frame, err = framing.Unpack(r)
+			c.Check(err, gc.IsNil)
+
+			var msg frameablestring
+			c.Check(framing.Unmarshal(frame, &msg), gc.IsNil)
+			c.Check(string(msg), gc.Equals, expect)
+		}
+	}
+}
+
+func (s *FixedFramingSuite) TestCRCMismatch(c *gc.C) {
+	var fixture, _ = FixedFramingCRC.Encode(frameablestring("test message content"), nil)
+	fixture[20] ^= 0xff // Corrupt payload content.
+
+	var frame, err = FixedFraming.Unpack(testReader(fixture))
+	c.Check(err, gc.IsNil)
+
+	var msg frameablestring
+	c.Check(FixedFraming.Unmarshal(frame, &msg), gc.Equals, ErrCorruptFrame)
+
+	// Unmarshal also verifies frames Unpacked without verification (eg, if
+	// the frame was larger than the Reader buffer).
+	_, err = FixedFramePayload(fixture)
+	c.Check(err, gc.Equals, ErrCorruptFrame)
+	c.Check(FixedFraming.Unmarshal(fixture, &msg), gc.Equals, ErrCorruptFrame)
+}
+
+func (s *FixedFramingSuite) TestResyncAfterTruncatedCRCFrame(c *gc.C) {
+	var truncated, _ = FixedFramingCRC.Encode(frameablestring("truncated content"), nil)
+	truncated = truncated[:len(truncated)-8]
+
+	var fixture, _ = FixedFramingCRC.Encode(frameablestring("foo"), truncated)
+	fixture, _ = FixedFramingCRC.Encode(frameablestring("bar"), fixture)
+
+	// The truncated frame's length spans into the following frame. Use a buffer
+	// which holds all content, such that the CRC is verified by Unpack.
+	var r = bufio.NewReader(bytes.NewReader(fixture))
+
+	// Expect the magic word of the truncated frame is returned as corrupt.
+	var frame, err = FixedFraming.Unpack(r)
+	c.Check(err, gc.IsNil)
+	c.Check(frame, gc.DeepEquals, magicWordCRC[:])
+
+	var msg frameablestring
+	c.Check(FixedFraming.Unmarshal(frame, &msg), gc.Equals, ErrCorruptFrame)
+
+	// Then the remainder of the truncated frame, as de-synchronized content.
+	frame, err = FixedFraming.Unpack(r)
+	c.Check(err, gc.IsNil)
+	c.Check(FixedFraming.Unmarshal(frame, &msg), gc.Equals, ErrDesyncDetected)
+
+	// Following frames are read normally.
+	for _, expect := range []string{"foo", "bar"} {
+		frame, err = FixedFraming.Unpack(r)
+		c.Check(err, gc.IsNil)
+		c.Check(FixedFraming.Unmarshal(frame, &msg), gc.IsNil)
+		c.Check(string(msg), gc.Equals, expect)
+	}
+}
+
+func (s *FixedFramingSuite) TestScanFrameHeader(c *gc.C) {
+	var fixture, _ = FixedFraming.Encode(frameablestring("foo"), []byte("garbage"))
+	fixture, _ = FixedFramingCRC.Encode(frameablestring("bar"), fixture)
+
+	// Headers are found only beyond the first byte.
+	c.Check(ScanFixedFrameHeader(fixture), gc.Equals, 7)
+	c.Check(ScanFixedFrameHeader(fixture[7:]), gc.Equals, 11)
+	c.Check(ScanFixedFrameHeader(fixture[18:]), gc.Equals, len(fixture[18:]))
+
+	// A partial trailing magic word isn't a header.
+	c.Check(ScanFixedFrameHeader(fixture[:10]), gc.Equals, 10)
+}
+
 func testReader(t []byte) *bufio.Reader {
 	// Using a small buffered reader forces the message content Peek
 	// underflow handling / ReadFull path.
@@ -6,36 +6,77 @@ import (
 	"github.com/LiveRamp/gazette/journal"
 )
 
-// A Publisher publishes Messages to a Topic.
+// A Publisher publishes Messages to a Topic. Each Message is written to the
+// Topic partition which Description.MappedPartition maps it to (see
+// PartitionFunc), via the Writer of the partition.
 type Publisher struct {
 	journal.Writer
+	// Writers of specific partitions, which are used instead of Writer.
+	partitionWriters map[journal.Name]journal.Writer
 }
 
 func NewPublisher(w journal.Writer) *Publisher {
 	return &Publisher{Writer: w}
 }
 
+// SetPartitionWriter routes writes of |partition| to |w|, rather than the
+// Writer of the Publisher (eg, to a WriteService of the Gazette cluster which
+// serves |partition|). SetPartitionWriter must be called before the Publisher
+// is used.
+func (p *Publisher) SetPartitionWriter(partition journal.Name, w journal.Writer) {
+	if p.partitionWriters == nil {
+		p.partitionWriters = make(map[journal.Name]journal.Writer)
+	}
+	p.partitionWriters[partition] = w
+}
+
 // Publish frames |msg|, routes it to the appropriate Topic partition, and
 // writes the resulting encoding. If |msg| implements `Validate() error`,
 // the message is Validated prior to framing, and any validation error returned.
 func (p Publisher) Publish(msg Message, to *Description) error {
+	var _, err = p.PublishAsync(msg, to)
+	return err
+}
+
+// PublishAsync is Publish, and additionally returns the AsyncAppend of the
+// write. Once Ready, the AsyncAppend Journal is the partition of |msg|, and
+// its Begin and End are the committed offsets of |msg| within the partition
+// (if known to the Writer: see journal.AsyncAppend).
+func (p Publisher) PublishAsync(msg Message, to *Description) (*journal.AsyncAppend, error) {
 	// Enforce optional Message validation.
 	if v, ok := msg.(interface {
 		Validate() error
 	}); ok {
 		if err := v.Validate(); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	if buffer, err := to.Framing.Encode(msg, publishBufferPool.Get().([]byte)); err != nil {
-		return err
-	} else if _, err = p.Writer.Write(to.MappedPartition(msg), buffer); err != nil {
-		return err
-	} else {
-		publishBufferPool.Put(buffer[:0])
+	var framing, err = to.ResolveFraming()
+	if err != nil {
+		return nil, err
+	}
+	var partition = to.MappedPartition(msg)
+
+	var buffer []byte
+	var aa *journal.AsyncAppend
+
+	if buffer, err = framing.Encode(msg, publishBufferPool.Get().([]byte)); err != nil {
+		return nil, err
+	} else if aa, err = p.writerOf(partition).Write(partition, buffer); err != nil {
+		return nil, err
+	}
+	publishBufferPool.Put(buffer[:0])
+
+	return aa, nil
+}
+
+// writerOf returns the Writer of |partition|.
+func (p Publisher) writerOf(partition journal.Name) journal.Writer {
+	if w, ok := p.partitionWriters[partition]; ok {
+		return w
 	}
-	return nil
+	return p.Writer
 }
 
 var publishBufferPool = sync.Pool{
@@ -0,0 +1,68 @@
+package topic
+
+import (
+	"errors"
+
+	gc "github.com/go-check/check"
+
+	"github.com/LiveRamp/gazette/journal"
+)
+
+type PublisherSuite struct{}
+
+func (s *PublisherSuite) TestPublishToMappedPartitions(c *gc.C) {
+	var newMsg = func() Message { return new(frameablestring) }
+	var defaultWriter = NewMemoryWriter(FixedFraming, newMsg)
+	var otherWriter = NewMemoryWriter(FixedFraming, newMsg)
+
+	var desc = &Description{
+		Name:       "a/topic",
+		Partitions: EnumeratePartitions("a/topic", 2),
+		Framing:    FixedFraming,
+	}
+	desc.MappedPartition = RoundRobinPartitionFunc().Mapping(desc.Partitions)
+
+	var pub = NewPublisher(defaultWriter)
+	pub.SetPartitionWriter("a/topic/part-001", otherWriter)
+
+	var aa, err = pub.PublishAsync(frameablestring("one"), desc)
+	c.Check(err, gc.IsNil)
+	c.Check(aa.Wait(), gc.IsNil)
+	c.Check(aa.Journal, gc.Equals, journal.Name("a/topic/part-000"))
+	c.Check(aa.Begin, gc.Equals, int64(0))
+	c.Check(aa.End, gc.Equals, int64(FixedFrameHeaderLength+3))
+
+	c.Check(pub.Publish(frameablestring("two"), desc), gc.IsNil)
+
+	aa, err = pub.PublishAsync(frameablestring("three"), desc)
+	c.Check(err, gc.IsNil)
+	c.Check(aa.Journal, gc.Equals, journal.Name("a/topic/part-000"))
+	c.Check(aa.Begin, gc.Equals, int64(FixedFrameHeaderLength+3))
+	c.Check(aa.End, gc.Equals, int64(2*FixedFrameHeaderLength+3+5))
+
+	// Expect partition "a/topic/part-001" was written via its own Writer.
+	c.Check(defaultWriter.Messages, gc.HasLen, 2)
+	c.Check(otherWriter.Messages, gc.HasLen, 1)
+	c.Check(otherWriter.Messages[0].Mark.Journal, gc.Equals, journal.Name("a/topic/part-001"))
+	c.Check(*otherWriter.Messages[0].Message.(*frameablestring), gc.Equals, frameablestring("two"))
+}
+
+func (s *PublisherSuite) TestValidationError(c *gc.C) {
+	var writer = NewMemoryWriter(FixedFraming, func() Message { return new(frameablestring) })
+
+	var desc = &Description{
+		Name:            "a/topic",
+		Partitions:      EnumeratePartitions("a/topic", 1),
+		MappedPartition: func(Message) journal.Name { panic("not called") },
+		Framing:         FixedFraming,
+	}
+	var aa, err = NewPublisher(writer).PublishAsync(invalidMessage{}, desc)
+	c.Check(err, gc.ErrorMatches, "invalid!")
+	c.Check(aa, gc.IsNil)
+}
+
+type invalidMessage struct{}
+
+func (invalidMessage) Validate() error { return errors.New("invalid!") }
+
+var _ = gc.Suite(&PublisherSuite{})
@@ -0,0 +1,172 @@
+package topic
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"sync/atomic"
+)
+
+// ProducerID uniquely identifies a producer of stamped messages (typically, a
+// single process publishing to a topic).
+type ProducerID [8]byte
+
+// NewProducerID returns a new, random ProducerID.
+func NewProducerID() ProducerID {
+	var id ProducerID
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err) // crypto/rand fails only if the system entropy source does.
+	}
+	return id
+}
+
+func (id ProducerID) String() string { return hex.EncodeToString(id[:]) }
+
+// Stamp identifies a message by its ProducerID and producer sequence number.
+// Sequence numbers of a producer begin at one and increase with each message
+// it encodes, such that a message which is written more than once (eg, due to
+// a retried write) is identifiable as a duplicate by its Stamp.
+type Stamp struct {
+	Producer ProducerID
+	Sequence uint64
+}
+
+// IsZero returns whether the Stamp is the zero value (eg, of an unstamped
+// message).
+func (s Stamp) IsZero() bool { return s == Stamp{} }
+
+// StampedFraming is a Framing which wraps another, prefixing each encoded
+// frame with a Stamp of its ProducerID and the next sequence number. Stamps
+// are assigned by Encode, so re-sent encodings of a message (eg, by a retried
+// or resumed journal write) carry the same Stamp, while a message which is
+// re-encoded is a distinct message. A StampedFraming may be used concurrently,
+// but sequence numbers are then ordered by Encode and not by the order of
+// subsequent journal writes.
+//
+// Unpack and Unmarshal also accept unstamped frames of the wrapped Framing,
+// allowing an existing topic to be migrated to a StampedFraming in place.
+type StampedFraming struct {
+	// Last sequence number assigned by Encode. Accessed atomically, and first
+	// in the struct to guarantee 64-bit alignment.
+	sequence uint64
+	producer ProducerID
+
+	// Framing of stamped messages.
+	Framing
+}
+
+// NewStampedFraming returns a StampedFraming which wraps |framing|, stamping
+// messages with |producer|.
+func NewStampedFraming(framing Framing, producer ProducerID) *StampedFraming {
+	return &StampedFraming{Framing: framing, producer: producer}
+}
+
+// Producer returns the ProducerID of the StampedFraming.
+func (f *StampedFraming) Producer() ProducerID { return f.producer }
+
+// Encode implements topic.Framing.
+func (f *StampedFraming) Encode(msg Message, b []byte) ([]byte, error) {
+	var offset = len(b)
+
+	b = append(b, stampMagicWord[:]...)
+	b = append(b, f.producer[:]...)
+	b = append(b, make([]byte, 8)...)
+
+	var out, err = f.Framing.Encode(msg, b)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint64(out[offset+stampSequenceOffset:],
+		atomic.AddUint64(&f.sequence, 1))
+
+	return out, nil
+}
+
+// Unpack returns the next frame of the Reader, including its Stamp header if
+// the frame is stamped.
+//
+// It implements topic.Framing.
+func (f *StampedFraming) Unpack(r *bufio.Reader) ([]byte, error) {
+	// Match the magic word one byte at a time. Peeking the full header could
+	// block on a short, unstamped final frame of a Reader which hasn't yet
+	// reached EOF (eg, a live journal).
+	for i := range stampMagicWord {
+		if b, err := r.Peek(i + 1); err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			return f.Framing.Unpack(r) // Surfaces an error of the wrapped Framing.
+		} else if b[i] != stampMagicWord[i] {
+			return f.Framing.Unpack(r) // Not a stamped frame.
+		}
+	}
+
+	var header [stampHeaderLength]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	var frame, err = f.Framing.Unpack(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF // We've already read a header.
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(header[:], frame...), nil
+}
+
+// Unmarshal unpacks Message content of the frame, which may be stamped.
+//
+// It implements topic.Framing.
+func (f *StampedFraming) Unmarshal(b []byte, msg Message) error {
+	if isStamped(b) {
+		b = b[stampHeaderLength:]
+	}
+	return f.Framing.Unmarshal(b, msg)
+}
+
+// Payload returns the payload of the frame, which may be stamped. The wrapped
+// Framing must be a PayloadFraming.
+//
+// It implements topic.PayloadFraming.
+func (f *StampedFraming) Payload(b []byte) ([]byte, error) {
+	if isStamped(b) {
+		b = b[stampHeaderLength:]
+	}
+	return FramePayload(f.Framing, b)
+}
+
+// Stamp returns the Stamp of frame |b|, previously returned by Unpack, or
+// false if |b| is unstamped.
+func (f *StampedFraming) Stamp(b []byte) (Stamp, bool) {
+	if !isStamped(b) {
+		return Stamp{}, false
+	}
+	var s Stamp
+	copy(s.Producer[:], b[stampProducerOffset:stampSequenceOffset])
+	s.Sequence = binary.BigEndian.Uint64(b[stampSequenceOffset:stampHeaderLength])
+
+	return s, true
+}
+
+func isStamped(b []byte) bool {
+	return len(b) >= stampHeaderLength && bytes.Equal(b[:len(stampMagicWord)], stampMagicWord[:])
+}
+
+// The stamp header is a magic word, followed by the ProducerID and the
+// big-endian sequence number. The magic word is distinct from that of
+// FixedFraming.
+var stampMagicWord = [4]byte{0x73, 0x74, 0xa5, 0x1d}
+
+const (
+	stampProducerOffset = 4
+	stampSequenceOffset = stampProducerOffset + 8
+	stampHeaderLength   = stampSequenceOffset + 8
+)
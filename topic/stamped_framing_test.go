@@ -0,0 +1,94 @@
+package topic
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing/iotest"
+
+	gc "github.com/go-check/check"
+)
+
+type StampedFramingSuite struct{}
+
+func (s *StampedFramingSuite) TestImplementsFraming(c *gc.C) {
+	// Verified by the compiler.
+	var _ Framing = new(StampedFraming)
+	c.Succeed()
+}
+
+func (s *StampedFramingSuite) TestFramingWithFixture(c *gc.C) {
+	var producer = ProducerID{1, 2, 3, 4, 5, 6, 7, 8}
+	var framing = NewStampedFraming(VarintFraming, producer)
+
+	var buf, err = framing.Encode(frameablestring("foo"), nil)
+	c.Check(err, gc.IsNil)
+	buf, err = framing.Encode(frameablestring("bar"), buf)
+	c.Check(err, gc.IsNil)
+
+	c.Check(buf, gc.DeepEquals, []byte{
+		0x73, 0x74, 0xa5, 0x1d, 1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0, 0, 0, 0, 1, 0x3, 'f', 'o', 'o',
+		0x73, 0x74, 0xa5, 0x1d, 1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0, 0, 0, 0, 2, 0x3, 'b', 'a', 'r'})
+	c.Check(producer.String(), gc.Equals, "0102030405060708")
+
+	// Encoding errors are passed through.
+	_, err = framing.Encode(frameableerror("test message"), nil)
+	c.Check(err, gc.ErrorMatches, "error!")
+}
+
+func (s *StampedFramingSuite) TestRoundTripWithUnstampedFrames(c *gc.C) {
+	var framing = NewStampedFraming(VarintFraming, NewProducerID())
+
+	// Interleave stamped frames with unstamped frames of the wrapped Framing.
+	var buf []byte
+	for i, msg := range []string{"one", "", "three", "four"} {
+		var err error
+		if i%2 == 0 {
+			buf, err = framing.Encode(frameablestring(msg), buf)
+		} else {
+			buf, err = VarintFraming.Encode(frameablestring(msg), buf)
+		}
+		c.Assert(err, gc.IsNil)
+	}
+	// Read one byte at a time, such that headers are split across reads.
+	var r = bufio.NewReaderSize(iotest.OneByteReader(bytes.NewReader(buf)), 16)
+
+	for i, expect := range []Stamp{
+		{Producer: framing.Producer(), Sequence: 1},
+		{},
+		{Producer: framing.Producer(), Sequence: 2},
+		{},
+	} {
+		var frame, err = framing.Unpack(r)
+		c.Assert(err, gc.IsNil)
+
+		var stamp, ok = framing.Stamp(frame)
+		c.Check(ok, gc.Equals, !expect.IsZero())
+		c.Check(stamp, gc.Equals, expect)
+
+		var msg frameablestring
+		c.Check(framing.Unmarshal(frame, &msg), gc.IsNil)
+		c.Check(string(msg), gc.Equals, []string{"one", "", "three", "four"}[i])
+	}
+	var _, err = framing.Unpack(r)
+	c.Check(err, gc.Equals, io.EOF)
+}
+
+func (s *StampedFramingSuite) TestUnexpectedEOF(c *gc.C) {
+	var framing = NewStampedFraming(VarintFraming, NewProducerID())
+	var buf, _ = framing.Encode(frameablestring("a message"), nil)
+
+	// EOF within the stamp header.
+	var _, err = framing.Unpack(bufio.NewReader(bytes.NewReader(buf[:10])))
+	c.Check(err, gc.Equals, io.ErrUnexpectedEOF)
+
+	// EOF following the stamp header.
+	_, err = framing.Unpack(bufio.NewReader(bytes.NewReader(buf[:stampHeaderLength])))
+	c.Check(err, gc.Equals, io.ErrUnexpectedEOF)
+
+	// EOF within the frame of the wrapped Framing.
+	_, err = framing.Unpack(bufio.NewReader(bytes.NewReader(buf[:len(buf)-1])))
+	c.Check(err, gc.Equals, io.ErrUnexpectedEOF)
+}
+
+var _ = gc.Suite(&StampedFramingSuite{})
@@ -0,0 +1,139 @@
+package topic
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// VarintFraming is a Framing implementation which encodes messages in a binary
+// format with a variable-length header. Messages must support Size and
+// MarshalTo functions for marshal support (eg, generated Protobuf messages
+// satisfy this interface). Messages are encoded as a uvarint payload length,
+// followed by payload bytes. As compared with FixedFraming, the header of small
+// messages is more compact and payloads are not limited to 4GB, but framing
+// de-synchronization cannot be detected.
+var VarintFraming = new(varintFraming)
+
+type varintFraming struct{}
+
+// Encode implements topic.Framing.
+func (*varintFraming) Encode(msg Message, b []byte) ([]byte, error) {
+	var p, ok = msg.(interface {
+		Size() int
+		MarshalTo([]byte) (int, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("%+v is not varint-frameable (must implement Size and MarshalTo)", msg)
+	}
+
+	var header [binary.MaxVarintLen64]byte
+	var headerLen = binary.PutUvarint(header[:], uint64(p.Size()))
+
+	var size = headerLen + p.Size()
+	var offset = len(b)
+
+	if size > (cap(b) - offset) {
+		b = append(b, make([]byte, size)...)
+	} else {
+		b = b[:offset+size]
+	}
+
+	copy(b[offset:], header[:headerLen])
+
+	if _, err := p.MarshalTo(b[offset+headerLen:]); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Unpack returns the next varint frame of content from the Reader, including
+// the frame header. Headers and payloads may span multiple reads of the
+// underlying Reader.
+//
+// It implements topic.Framing.
+func (*varintFraming) Unpack(r *bufio.Reader) ([]byte, error) {
+	// Peek one byte at a time until the varint header terminates. Peeking
+	// further (eg, binary.MaxVarintLen64 bytes) could block on a short final
+	// frame of a Reader which hasn't yet reached EOF (eg, a live journal).
+	var b []byte
+	var err error
+
+	for len(b) == 0 || b[len(b)-1]&0x80 != 0 {
+		if len(b) == binary.MaxVarintLen64 {
+			return nil, ErrVarintOverflow
+		} else if b, err = r.Peek(len(b) + 1); err != nil {
+			if err == io.EOF && len(b) != 0 {
+				// If we read at least one byte, then an EOF is unexpected (it should
+				// occur only on whole-message boundaries).
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+
+	var payloadLen, headerLen = binary.Uvarint(b)
+	if headerLen <= 0 || payloadLen > maxVarintFramePayload {
+		return nil, ErrVarintOverflow
+	}
+	var size = headerLen + int(payloadLen)
+
+	// Fast path: check if the full frame is available in buffer. Return the
+	// buffer internal slice without copying. It is invalidated by the next
+	// Unpack (or other Reader operation).
+	if b, err = r.Peek(size); err == nil {
+		r.Discard(size)
+		return b, nil
+	}
+
+	// Slow path. Allocate and attempt to Read the full frame.
+	b = make([]byte, size)
+	if _, err = io.ReadFull(r, b); err == io.EOF {
+		err = io.ErrUnexpectedEOF // We've already Peeked a header.
+	}
+	return b, err
+}
+
+// Unmarshal verifies the frame header and unpacks Message content.
+//
+// It implements topic.Framing.
+func (*varintFraming) Unmarshal(b []byte, msg Message) error {
+	var p, ok = msg.(interface {
+		Unmarshal([]byte) error
+	})
+	if !ok {
+		return fmt.Errorf("%+v is not varint-frameable (must implement Unmarshal)", msg)
+	}
+
+	if payload, err := varintFramePayload(b); err != nil {
+		return err
+	} else {
+		return p.Unmarshal(payload)
+	}
+}
+
+// Payload verifies the frame header, and returns the payload of frame |b|.
+//
+// It implements topic.PayloadFraming.
+func (*varintFraming) Payload(b []byte) ([]byte, error) { return varintFramePayload(b) }
+
+func varintFramePayload(b []byte) ([]byte, error) {
+	var payloadLen, headerLen = binary.Uvarint(b)
+	if headerLen <= 0 || uint64(len(b)-headerLen) != payloadLen {
+		return nil, ErrVarintFrameLength
+	}
+	return b[headerLen:], nil
+}
+
+// Maximum payload length of a varint frame. Larger lengths are assumed to
+// indicate a corrupt header, rather than being allocated.
+const maxVarintFramePayload = 1 << 40 // 1TB.
+
+var (
+	// Error returned by Unpack upon reading an invalid varint header.
+	ErrVarintOverflow = errors.New("varint frame header overflow")
+	// Error returned by Unmarshal if the frame length doesn't match its header.
+	ErrVarintFrameLength = errors.New("varint frame length doesn't match header")
+)
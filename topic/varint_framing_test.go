@@ -0,0 +1,109 @@
+package topic
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing/iotest"
+
+	gc "github.com/go-check/check"
+)
+
+type VarintFramingSuite struct{}
+
+func (s *VarintFramingSuite) TestImplementsFraming(c *gc.C) {
+	// Verified by the compiler.
+	var _ Framing = VarintFraming
+	c.Succeed()
+}
+
+func (s *VarintFramingSuite) TestFramingWithFixture(c *gc.C) {
+	var buf, err = VarintFraming.Encode(frameablestring("test message content"), nil)
+	c.Check(err, gc.IsNil)
+	c.Check(buf, gc.DeepEquals, []byte{
+		0x14, 't', 'e', 's', 't', ' ', 'm', 'e', 's', 's', 'a', 'g', 'e',
+		' ', 'c', 'o', 'n', 't', 'e', 'n', 't'})
+
+	// Append another message.
+	buf, err = VarintFraming.Encode(frameablestring("foo message"), buf)
+	c.Check(err, gc.IsNil)
+	c.Check(buf, gc.DeepEquals, []byte{
+		0x14, 't', 'e', 's', 't', ' ', 'm', 'e', 's', 's', 'a', 'g', 'e',
+		' ', 'c', 'o', 'n', 't', 'e', 'n', 't',
+		0xb, 'f', 'o', 'o', ' ', 'm', 'e', 's', 's', 'a', 'g', 'e'})
+}
+
+func (s *VarintFramingSuite) TestEncodingError(c *gc.C) {
+	var buf, err = VarintFraming.Encode(frameableerror("test message"), nil)
+	c.Check(err, gc.ErrorMatches, "error!")
+	c.Check(buf, gc.HasLen, 0)
+
+	_, err = VarintFraming.Encode(struct{}{}, nil)
+	c.Check(err, gc.ErrorMatches, ".* is not varint-frameable .*")
+}
+
+func (s *VarintFramingSuite) TestRoundTripAtContinuationBoundaries(c *gc.C) {
+	// Payload lengths about the boundaries of 1, 2, and 3-byte varint headers.
+	var lengths = []int{0, 1, 127, 128, 129, 16383, 16384, 16385}
+
+	var buf []byte
+	for _, l := range lengths {
+		var err error
+		buf, err = VarintFraming.Encode(frameablestring(bytes.Repeat([]byte{'x'}, l)), buf)
+		c.Assert(err, gc.IsNil)
+	}
+
+	// Read one byte at a time through a minimal buffer, such that headers are
+	// split across reads and most payloads are longer than the buffer.
+	var r = bufio.NewReaderSize(iotest.OneByteReader(bytes.NewReader(buf)), 16)
+
+	for _, l := range lengths {
+		var frame, err = VarintFraming.Unpack(r)
+		c.Assert(err, gc.IsNil)
+
+		var msg frameablestring
+		c.Check(VarintFraming.Unmarshal(frame, &msg), gc.IsNil)
+		c.Check(msg, gc.HasLen, l)
+	}
+	var _, err = VarintFraming.Unpack(r)
+	c.Check(err, gc.Equals, io.EOF)
+}
+
+func (s *VarintFramingSuite) TestIncompleteBufferHandling(c *gc.C) {
+	var fixture, _ = VarintFraming.Encode(frameablestring(bytes.Repeat([]byte{'x'}, 200)), nil)
+	c.Assert(fixture[:2], gc.DeepEquals, []byte{0xc8, 0x01})
+
+	// EOF at first byte.
+	var _, err = VarintFraming.Unpack(testReader(fixture[0:0]))
+	c.Check(err, gc.Equals, io.EOF)
+
+	// EOF partway through header.
+	_, err = VarintFraming.Unpack(testReader(fixture[0:1]))
+	c.Check(err, gc.Equals, io.ErrUnexpectedEOF)
+
+	// EOF just after reading complete header.
+	_, err = VarintFraming.Unpack(testReader(fixture[0:2]))
+	c.Check(err, gc.Equals, io.ErrUnexpectedEOF)
+
+	// EOF partway through the message.
+	_, err = VarintFraming.Unpack(testReader(fixture[0:100]))
+	c.Check(err, gc.Equals, io.ErrUnexpectedEOF)
+
+	// Full message. Success.
+	_, err = VarintFraming.Unpack(testReader(fixture))
+	c.Check(err, gc.IsNil)
+}
+
+func (s *VarintFramingSuite) TestCorruptHeaders(c *gc.C) {
+	// A varint which overflows 64 bits.
+	var fixture = bytes.Repeat([]byte{0xff}, 11)
+	var _, err = VarintFraming.Unpack(testReader(fixture))
+	c.Check(err, gc.Equals, ErrVarintOverflow)
+
+	// A frame with a header which doesn't match its length.
+	var msg frameablestring
+	c.Check(VarintFraming.Unmarshal([]byte{0x3, 'f', 'o'}, &msg), gc.Equals, ErrVarintFrameLength)
+	c.Check(VarintFraming.Unmarshal(nil, &msg), gc.Equals, ErrVarintFrameLength)
+}
+
+var _ = gc.Suite(&VarintFramingSuite{})